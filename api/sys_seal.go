@@ -78,6 +78,30 @@ type SealStatusResponse struct {
 	ClusterID    string `json:"cluster_id,omitempty"`
 	RecoverySeal bool   `json:"recovery_seal"`
 	StorageType  string `json:"storage_type,omitempty"`
+
+	// MigrationStatus is set once the node has been in seal migration mode
+	MigrationStatus *SealMigrationStatus `json:"migration_status,omitempty"`
+
+	// Wrappers and NeedsRewrap are only set for a multiseal
+	Wrappers    []*SealWrapperStatus `json:"wrappers,omitempty"`
+	NeedsRewrap bool                 `json:"needs_rewrap,omitempty"`
+}
+
+type SealWrapperStatus struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Priority    int    `json:"priority"`
+	Healthy     bool   `json:"healthy"`
+	LastError   string `json:"last_error,omitempty"`
+	LastChecked string `json:"last_checked,omitempty"`
+}
+
+type SealMigrationStatus struct {
+	State     string `json:"state"`
+	FromType  string `json:"from_type"`
+	ToType    string `json:"to_type"`
+	Error     string `json:"error,omitempty"`
+	UpdatedAt string `json:"updated_at"`
 }
 
 type UnsealOpts struct {
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/hashicorp/vault/sdk/helper/consts"
+)
+
+// TransitDefaultMountPoint is the default path at which the transit secrets
+// engine is mounted.
+const TransitDefaultMountPoint = "transit"
+
+// Transit is used to stream data through the transit secrets engine.
+type Transit struct {
+	c          *Client
+	MountPoint string
+}
+
+// Transit returns the client for the transit secrets engine mounted at the
+// default path.
+func (c *Client) Transit() *Transit {
+	return c.TransitWithMountPoint(TransitDefaultMountPoint)
+}
+
+// TransitWithMountPoint returns the client for the transit secrets engine
+// mounted at the given path.
+func (c *Client) TransitWithMountPoint(mountPoint string) *Transit {
+	return &Transit{
+		c:          c,
+		MountPoint: mountPoint,
+	}
+}
+
+// TransitStreamOptions are the optional parameters of stream operations.
+type TransitStreamOptions struct {
+	// Context is the context for key derivation, required if key derivation
+	// is enabled on the key.
+	Context []byte
+
+	// KeyVersion is the version of the key to encrypt with, the latest one
+	// if 0.
+	KeyVersion int
+
+	// ChunkSize is the size in bytes of the chunks the plaintext is split
+	// into when encrypting, the server's default if 0.
+	ChunkSize int
+}
+
+// EncryptStream encrypts everything read from plaintext with the named key and
+// writes the resulting stream to ciphertext as it is returned, so that neither
+// is held in memory. The client timeout does not apply; use ctx to bound the
+// operation.
+func (t *Transit) EncryptStream(ctx context.Context, name string, plaintext io.Reader, ciphertext io.Writer, opts *TransitStreamOptions) error {
+	return t.stream(ctx, fmt.Sprintf("/v1/%s/encrypt-stream/%s", t.MountPoint, name), plaintext, ciphertext, opts)
+}
+
+// DecryptStream decrypts a stream returned by EncryptStream with the named key
+// and writes the plaintext to plaintext as it is returned. Each chunk is
+// authenticated before being written, but if the stream turns out to be
+// truncated or tampered with an error is returned after the chunks preceding
+// the failure were written.
+func (t *Transit) DecryptStream(ctx context.Context, name string, ciphertext io.Reader, plaintext io.Writer, opts *TransitStreamOptions) error {
+	return t.stream(ctx, fmt.Sprintf("/v1/%s/decrypt-stream/%s", t.MountPoint, name), ciphertext, plaintext, opts)
+}
+
+func (t *Transit) stream(ctx context.Context, path string, in io.Reader, out io.Writer, opts *TransitStreamOptions) error {
+	r := t.c.NewRequest("POST", path)
+	if opts != nil {
+		if len(opts.Context) != 0 {
+			r.Params.Set("context", base64.StdEncoding.EncodeToString(opts.Context))
+		}
+		if opts.KeyVersion != 0 {
+			r.Params.Set("key_version", strconv.Itoa(opts.KeyVersion))
+		}
+		if opts.ChunkSize != 0 {
+			r.Params.Set("chunk_size", strconv.Itoa(opts.ChunkSize))
+		}
+	}
+
+	// The body is set on the HTTP request directly, as retryable requests
+	// read it in memory to be able to replay it.
+	req, err := r.toRetryableHTTP()
+	if err != nil {
+		return err
+	}
+	httpReq := req.Request.WithContext(ctx)
+	httpReq.Body = ioutil.NopCloser(in)
+	httpReq.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := t.c.config.HttpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Standby nodes redirect stream requests to the active node rather than
+	// forwarding them. The input has already been consumed, so the request
+	// cannot be replayed and has to be sent to the active node again.
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect:
+		location, err := resp.Location()
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("stream request redirected to %q, stream requests must be sent to the active node", location)
+	}
+
+	result := &Response{Response: resp}
+	if err := result.Error(); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return err
+	}
+
+	// Errors occurring once the output started are reported in a trailer,
+	// which is only available after the body has been read
+	if msg := resp.Trailer.Get(consts.StreamErrorTrailerName); msg != "" {
+		return fmt.Errorf("error processing stream: %s", msg)
+	}
+
+	return nil
+}
@@ -36,6 +36,13 @@ type Backend interface {
 	Invalidate(context.Context)
 }
 
+// Closer is implemented by the audit backends holding resources, such as
+// background goroutines, that must be released once the backend is disabled
+// or the audit devices are torn down on seal.
+type Closer interface {
+	Close()
+}
+
 // BackendConfig contains configuration parameters used in the factory func to
 // instantiate audit backends
 type BackendConfig struct {
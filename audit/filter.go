@@ -0,0 +1,350 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Filter decides which requests and responses an audit device receives. It
+// is parsed from an expression comparing the fields below to quoted strings
+// with the ==, != and matches (regular expression) operators, combined with
+// and, or, not and parentheses, for example:
+//
+//   mount_type != "transit" or operation != "update"
+//
+// The supported fields are:
+//
+//   mount_path     - path of the mount handling the request, e.g. "secret/"
+//   mount_type     - type of the mount handling the request, e.g. "kv"
+//   operation      - request operation, e.g. "read" or "update"
+//   namespace      - path of the request's namespace, "" for the root namespace
+//   auth_method    - path of the auth method which issued the client token, or
+//                    of the auth method being logged in to, e.g. "userpass/"
+//   response_error - "true" if the request failed, "false" otherwise
+type Filter struct {
+	raw  string
+	expr filterNode
+}
+
+const (
+	FilterFieldMountPath     = "mount_path"
+	FilterFieldMountType     = "mount_type"
+	FilterFieldOperation     = "operation"
+	FilterFieldNamespace     = "namespace"
+	FilterFieldAuthMethod    = "auth_method"
+	FilterFieldResponseError = "response_error"
+)
+
+var filterFields = map[string]bool{
+	FilterFieldMountPath:     true,
+	FilterFieldMountType:     true,
+	FilterFieldOperation:     true,
+	FilterFieldNamespace:     true,
+	FilterFieldAuthMethod:    true,
+	FilterFieldResponseError: true,
+}
+
+// ParseFilter parses the filter expression. An empty expression returns a
+// nil filter, which matches everything.
+func ParseFilter(raw string) (*Filter, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	tokens, err := lexFilter(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in audit filter", p.tokens[p.pos].value)
+	}
+
+	return &Filter{
+		raw:  raw,
+		expr: expr,
+	}, nil
+}
+
+// String returns the filter expression
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.raw
+}
+
+// Matches returns whether the request or response described by the input
+// should be logged. A nil filter matches everything.
+func (f *Filter) Matches(ctx context.Context, in *logical.LogInput) bool {
+	if f == nil {
+		return true
+	}
+	return f.expr.eval(filterValues(ctx, in))
+}
+
+// filterValues returns the values of the filter fields for the input
+func filterValues(ctx context.Context, in *logical.LogInput) map[string]string {
+	values := make(map[string]string, len(filterFields))
+
+	if ns, err := namespace.FromContext(ctx); err == nil {
+		values[FilterFieldNamespace] = ns.Path
+	}
+
+	responseError := in.OuterErr != nil
+	if in.Response != nil && in.Response.IsError() {
+		responseError = true
+	}
+	values[FilterFieldResponseError] = strconv.FormatBool(responseError)
+
+	req := in.Request
+	if req == nil {
+		return values
+	}
+
+	values[FilterFieldMountPath] = req.MountPoint
+	values[FilterFieldMountType] = req.MountType
+	values[FilterFieldOperation] = string(req.Operation)
+
+	switch te := req.TokenEntry(); {
+	case te != nil && strings.HasPrefix(te.Path, "auth/"):
+		method := strings.TrimPrefix(te.Path, "auth/")
+		if i := strings.Index(method, "/"); i >= 0 {
+			method = method[:i+1]
+		}
+		values[FilterFieldAuthMethod] = method
+	case te == nil && strings.HasPrefix(req.MountPoint, "auth/"):
+		values[FilterFieldAuthMethod] = strings.TrimPrefix(req.MountPoint, "auth/")
+	}
+
+	return values
+}
+
+type filterNode interface {
+	eval(values map[string]string) bool
+}
+
+type filterAnd struct{ left, right filterNode }
+
+func (n *filterAnd) eval(values map[string]string) bool {
+	return n.left.eval(values) && n.right.eval(values)
+}
+
+type filterOr struct{ left, right filterNode }
+
+func (n *filterOr) eval(values map[string]string) bool {
+	return n.left.eval(values) || n.right.eval(values)
+}
+
+type filterNot struct{ node filterNode }
+
+func (n *filterNot) eval(values map[string]string) bool {
+	return !n.node.eval(values)
+}
+
+type filterComparison struct {
+	field string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (n *filterComparison) eval(values map[string]string) bool {
+	value := values[n.field]
+	switch n.op {
+	case "==":
+		return value == n.value
+	case "!=":
+		return value != n.value
+	default:
+		return n.re.MatchString(value)
+	}
+}
+
+const (
+	filterTokenWord = iota
+	filterTokenString
+	filterTokenOp
+	filterTokenLeftParen
+	filterTokenRightParen
+)
+
+type filterToken struct {
+	kind  int
+	value string
+}
+
+func lexFilter(raw string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(raw); {
+		c := raw[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, filterToken{filterTokenLeftParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, filterToken{filterTokenRightParen, ")"})
+			i++
+		case c == '=' || c == '!':
+			if i+1 >= len(raw) || raw[i+1] != '=' {
+				return nil, fmt.Errorf("invalid operator at offset %d in audit filter", i)
+			}
+			tokens = append(tokens, filterToken{filterTokenOp, raw[i : i+2]})
+			i += 2
+		case c == '"':
+			end := i + 1
+			for ; end < len(raw) && raw[end] != '"'; end++ {
+				if raw[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(raw) {
+				return nil, fmt.Errorf("unterminated string at offset %d in audit filter", i)
+			}
+			value, err := strconv.Unquote(raw[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at offset %d in audit filter: %v", i, err)
+			}
+			tokens = append(tokens, filterToken{filterTokenString, value})
+			i = end + 1
+		case c == '_' || unicode.IsLetter(rune(c)):
+			end := i
+			for end < len(raw) && (raw[end] == '_' || unicode.IsLetter(rune(raw[end]))) {
+				end++
+			}
+			tokens = append(tokens, filterToken{filterTokenWord, raw[i:end]})
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d in audit filter", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) next() (filterToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}, false
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t, true
+}
+
+func (p *filterParser) peekWord(word string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == filterTokenWord && p.tokens[p.pos].value == word
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("and") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	t, ok := p.next()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of audit filter")
+	}
+
+	switch {
+	case t.kind == filterTokenWord && t.value == "not":
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &filterNot{node}, nil
+
+	case t.kind == filterTokenLeftParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.next(); !ok || t.kind != filterTokenRightParen {
+			return nil, fmt.Errorf("missing closing parenthesis in audit filter")
+		}
+		return node, nil
+
+	case t.kind == filterTokenWord:
+		if !filterFields[t.value] {
+			return nil, fmt.Errorf("unknown field %q in audit filter", t.value)
+		}
+		return p.parseComparison(t.value)
+
+	default:
+		return nil, fmt.Errorf("unexpected %q in audit filter", t.value)
+	}
+}
+
+func (p *filterParser) parseComparison(field string) (filterNode, error) {
+	op, ok := p.next()
+	if !ok {
+		return nil, fmt.Errorf("missing operator after %q in audit filter", field)
+	}
+	if op.kind != filterTokenOp && !(op.kind == filterTokenWord && op.value == "matches") {
+		return nil, fmt.Errorf("unexpected %q after %q in audit filter", op.value, field)
+	}
+
+	value, ok := p.next()
+	if !ok || value.kind != filterTokenString {
+		return nil, fmt.Errorf("expected a quoted string after %q %s in audit filter", field, op.value)
+	}
+
+	node := &filterComparison{
+		field: field,
+		op:    op.value,
+		value: value.value,
+	}
+	if node.op == "matches" {
+		re, err := regexp.Compile(value.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q in audit filter: %v", value.value, err)
+		}
+		node.re = re
+	}
+	return node, nil
+}
@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestParseFilter_Invalid(t *testing.T) {
+	for _, raw := range []string{
+		`mount_type`,
+		`mount_type ==`,
+		`mount_type == kv`,
+		`mount_type = "kv"`,
+		`path == "secret/"`,
+		`mount_type == "kv" and`,
+		`(mount_type == "kv"`,
+		`mount_type == "kv")`,
+		`mount_type == "kv" mount_path == "kv/"`,
+		`mount_type matches "("`,
+		`mount_type == "kv`,
+		`mount_type == 1`,
+	} {
+		if _, err := ParseFilter(raw); err == nil {
+			t.Fatalf("expected error parsing %q", raw)
+		}
+	}
+
+	filter, err := ParseFilter("  ")
+	if err != nil || filter != nil {
+		t.Fatalf("expected nil filter, got %v, %v", filter, err)
+	}
+}
+
+func TestFilter_Matches(t *testing.T) {
+	ctx := namespace.ContextWithNamespace(context.Background(), &namespace.Namespace{
+		ID:   "ns1",
+		Path: "ns1/",
+	})
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "transit/encrypt/foo",
+		MountPoint: "transit/",
+		MountType:  "transit",
+	}
+	req.SetTokenEntry(&logical.TokenEntry{Path: "auth/approle/login"})
+	in := &logical.LogInput{Request: req}
+
+	loginReq := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "auth/userpass/login/bob",
+		MountPoint: "auth/userpass/",
+		MountType:  "userpass",
+	}
+	failedIn := &logical.LogInput{Request: loginReq, OuterErr: errors.New("permission denied")}
+
+	cases := []struct {
+		filter string
+		in     *logical.LogInput
+		match  bool
+	}{
+		{`mount_type == "transit"`, in, true},
+		{`mount_type != "transit"`, in, false},
+		{`mount_path == "transit/" and operation == "update"`, in, true},
+		{`operation == "read" or namespace == "ns1/"`, in, true},
+		{`not (operation == "update")`, in, false},
+		{`not operation == "read" and mount_type == "kv" or namespace == "ns1/"`, in, true},
+		{`auth_method == "approle/"`, in, true},
+		{`response_error == "false"`, in, true},
+		{`mount_path matches "^trans"`, in, true},
+		{`auth_method == "userpass/" and response_error == "true"`, failedIn, true},
+		{`mount_type matches "^(kv|transit)$"`, failedIn, false},
+	}
+
+	for _, tc := range cases {
+		filter, err := ParseFilter(tc.filter)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.filter, err)
+		}
+		if match := filter.Matches(ctx, tc.in); match != tc.match {
+			t.Fatalf("%q: expected %t, got %t", tc.filter, tc.match, match)
+		}
+	}
+
+	var filter *Filter
+	if !filter.Matches(ctx, in) {
+		t.Fatal("expected nil filter to match")
+	}
+}
@@ -0,0 +1,135 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+var (
+	chainHMACRe = regexp.MustCompile(`,"chain_hmac":("(?:[^"\\]|\\.)*")}$`)
+	chainPrevRe = regexp.MustCompile(`,"chain_prev":("(?:[^"\\]|\\.)*")}$`)
+
+	// ErrNotChained is returned when parsing an entry which is not part of a
+	// hash chain
+	ErrNotChained = errors.New("audit entry has no chain_hmac field")
+)
+
+// HashChain links JSON audit entries together to make the audit log tamper
+// evident. Each linked entry gets a chain_prev field holding the chain_hmac of
+// the previous entry, and a chain_hmac field holding the HMAC of the entry
+// including chain_prev, computed with the audit device's salt. Editing,
+// removing or reordering entries breaks the chain, which can be checked with
+// the sys/audit-hash endpoint of the device.
+//
+// Entries must be written in the order they are linked, so callers should
+// link and write them while holding the device's write lock.
+type HashChain struct {
+	l        sync.Mutex
+	prev     string
+	hashFunc func(context.Context, string) (string, error)
+}
+
+// NewHashChain returns a hash chain continuing from the given chain_hmac,
+// which may be empty to start a new chain. hashFunc is usually the GetHash
+// method of the audit backend.
+func NewHashChain(hashFunc func(context.Context, string) (string, error), prev string) *HashChain {
+	return &HashChain{
+		prev:     prev,
+		hashFunc: hashFunc,
+	}
+}
+
+// ParseHashChainConfig parses the hash_chain option of an audit device, which
+// defaults to false and requires the json format
+func ParseHashChainConfig(config map[string]string, format string) (bool, error) {
+	raw, ok := config["hash_chain"]
+	if !ok {
+		return false, nil
+	}
+	hashChain, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, err
+	}
+	if hashChain && format != "json" {
+		return false, errors.New("hash_chain requires the json format")
+	}
+	return hashChain, nil
+}
+
+// Link returns the formatted entry with the chain fields added
+func (c *HashChain) Link(ctx context.Context, entry []byte) ([]byte, error) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	trimmed := bytes.TrimRight(entry, "\n")
+	if !bytes.HasSuffix(trimmed, []byte("}")) {
+		return nil, errors.New("hash chaining requires JSON formatted audit entries")
+	}
+
+	signed, err := appendJSONField(trimmed, "chain_prev", c.prev)
+	if err != nil {
+		return nil, err
+	}
+	hmac, err := c.hashFunc(ctx, string(signed))
+	if err != nil {
+		return nil, err
+	}
+	linked, err := appendJSONField(signed, "chain_hmac", hmac)
+	if err != nil {
+		return nil, err
+	}
+
+	c.prev = hmac
+	return append(linked, '\n'), nil
+}
+
+// ParseChainedEntry splits a line of an audit log into the signed part of the
+// entry, whose HMAC is the chain_hmac, and its chain_prev and chain_hmac
+// fields. It returns ErrNotChained if the line is not a linked entry.
+func ParseChainedEntry(line []byte) (signed []byte, prev, hmac string, err error) {
+	line = bytes.TrimRight(line, "\r\n")
+
+	loc := chainHMACRe.FindSubmatchIndex(line)
+	if loc == nil {
+		return nil, "", "", ErrNotChained
+	}
+	if err := json.Unmarshal(line[loc[2]:loc[3]], &hmac); err != nil {
+		return nil, "", "", err
+	}
+
+	signed = make([]byte, 0, loc[0]+1)
+	signed = append(signed, line[:loc[0]]...)
+	signed = append(signed, '}')
+
+	loc = chainPrevRe.FindSubmatchIndex(signed)
+	if loc == nil {
+		return nil, "", "", errors.New("audit entry has no chain_prev field")
+	}
+	if err := json.Unmarshal(signed[loc[2]:loc[3]], &prev); err != nil {
+		return nil, "", "", err
+	}
+
+	return signed, prev, hmac, nil
+}
+
+// appendJSONField adds a string field at the end of the JSON object
+func appendJSONField(object []byte, name, value string) ([]byte, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, len(object)+len(name)+len(encoded)+5)
+	result = append(result, object[:len(object)-1]...)
+	result = append(result, `,"`...)
+	result = append(result, name...)
+	result = append(result, `":`...)
+	result = append(result, encoded...)
+	result = append(result, '}')
+	return result, nil
+}
@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/helper/salt"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestHashChain(t *testing.T) {
+	ctx := context.Background()
+	s, err := salt.NewSalt(ctx, &logical.InmemStorage{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashFunc := func(_ context.Context, data string) (string, error) {
+		return HashString(s, data), nil
+	}
+
+	chain := NewHashChain(hashFunc, "")
+	var lines [][]byte
+	for _, entry := range []string{
+		`{"type":"request","request":{"path":"secret/foo"}}` + "\n",
+		`{"type":"response","request":{"path":"secret/foo"}}` + "\n",
+		`prefix{"type":"request","request":{"path":"secret/\"bar\""}}` + "\n",
+	} {
+		linked, err := chain.Link(ctx, []byte(entry))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasSuffix(linked, []byte("}\n")) {
+			t.Fatalf("bad linked entry: %q", linked)
+		}
+		lines = append(lines, linked)
+	}
+
+	// Linked entries are still valid JSON
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(lines[0], &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["chain_prev"] != "" || fields["chain_hmac"] == "" {
+		t.Fatalf("bad chain fields: %v", fields)
+	}
+
+	prevHMAC := ""
+	for i, line := range lines {
+		signed, prev, hmac, err := ParseChainedEntry(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prev != prevHMAC {
+			t.Fatalf("line %d: expected chain_prev %q, got %q", i, prevHMAC, prev)
+		}
+		if expected := HashString(s, string(signed)); hmac != expected {
+			t.Fatalf("line %d: expected chain_hmac %q, got %q", i, expected, hmac)
+		}
+		prevHMAC = hmac
+	}
+
+	// Editing an entry changes the HMAC of its signed part
+	tampered := bytes.Replace(lines[1], []byte("secret/foo"), []byte("secret/baz"), 1)
+	signed, _, hmac, err := ParseChainedEntry(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if HashString(s, string(signed)) == hmac {
+		t.Fatal("expected tampered entry to fail verification")
+	}
+
+	if _, _, _, err := ParseChainedEntry([]byte(`{"type":"request"}`)); err != ErrNotChained {
+		t.Fatalf("expected ErrNotChained, got %v", err)
+	}
+	if _, err := chain.Link(ctx, []byte("<json></json>\n")); err == nil {
+		t.Fatal("expected error linking a non JSON entry")
+	}
+}
+
+func TestParseHashChainConfig(t *testing.T) {
+	cases := []struct {
+		config   map[string]string
+		format   string
+		expected bool
+		err      bool
+	}{
+		{map[string]string{}, "json", false, false},
+		{map[string]string{}, "jsonx", false, false},
+		{map[string]string{"hash_chain": "true"}, "json", true, false},
+		{map[string]string{"hash_chain": "false"}, "jsonx", false, false},
+		{map[string]string{"hash_chain": "true"}, "jsonx", false, true},
+		{map[string]string{"hash_chain": "yes"}, "json", false, true},
+	}
+
+	for _, tc := range cases {
+		hashChain, err := ParseHashChainConfig(tc.config, tc.format)
+		if (err != nil) != tc.err {
+			t.Fatalf("config %v with format %q: unexpected error: %v", tc.config, tc.format, err)
+		}
+		if hashChain != tc.expected {
+			t.Fatalf("config %v with format %q: expected %t, got %t", tc.config, tc.format, tc.expected, hashChain)
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/audit"
@@ -18,6 +19,10 @@ import (
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
+// chainTailSize is how much of the end of an existing file is searched for
+// the last linked entry when hash chaining is enabled
+const chainTailSize = 1024 * 1024
+
 func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, error) {
 	if conf.SaltConfig == nil {
 		return nil, fmt.Errorf("nil salt config")
@@ -72,6 +77,12 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		logRaw = b
 	}
 
+	// Check if hash chaining is enabled
+	hashChain, err := audit.ParseHashChainConfig(conf.Config, format)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check if mode is provided
 	mode := os.FileMode(0600)
 	if modeRaw, ok := conf.Config["mode"]; ok {
@@ -84,9 +95,18 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		}
 	}
 
+	rotate, err := parseRotateConfig(conf.Config)
+	if err != nil {
+		return nil, err
+	}
+	if rotate.enabled() && (path == "stdout" || path == "discard") {
+		return nil, fmt.Errorf("rotation is not supported with file_path %q", path)
+	}
+
 	b := &Backend{
 		path:       path,
 		mode:       mode,
+		rotate:     rotate,
 		saltConfig: conf.SaltConfig,
 		saltView:   conf.SaltView,
 		salt:       new(atomic.Value),
@@ -125,14 +145,57 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		}
 	}
 
+	if hashChain {
+		// Continue the chain of the entries already in the file
+		var prev string
+		if path != "stdout" && path != "discard" {
+			prev, err = lastChainHMAC(path)
+			if err != nil {
+				return nil, errwrap.Wrapf(fmt.Sprintf("failed to read the hash chain from %q: {{err}}", path), err)
+			}
+		}
+		b.chain = audit.NewHashChain(b.GetHash, prev)
+	}
+
 	return b, nil
 }
 
+// lastChainHMAC returns the chain_hmac of the last linked entry in the last
+// megabyte of the file, or an empty string if there is none
+func lastChainHMAC(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	offset := info.Size() - chainTailSize
+	if offset < 0 {
+		offset = 0
+	}
+	tail := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return "", err
+	}
+
+	lines := bytes.Split(tail, []byte("\n"))
+	for i := len(lines) - 1; i >= 0; i-- {
+		if _, _, hmac, err := audit.ParseChainedEntry(lines[i]); err == nil {
+			return hmac, nil
+		}
+	}
+	return "", nil
+}
+
 // Backend is the audit backend for the file-based audit store.
 //
-// NOTE: This audit backend is currently very simple: it appends to a file.
-// It doesn't do anything more at the moment to assist with rotation
-// or reset the write cursor, this should be done in the future.
+// It appends to a file, which is rotated once it exceeds the configured size
+// or age if rotation is enabled. Otherwise rotation is left to external tools,
+// which can make the backend reopen the file by sending a SIGHUP.
 type Backend struct {
 	path string
 
@@ -143,6 +206,19 @@ type Backend struct {
 	f        *os.File
 	mode     os.FileMode
 
+	// rotate is the rotation policy. size and openedAt track the size of the
+	// current file and when it was started, and are protected by fileLock.
+	// cleanupLock serializes the compression and pruning of rotated files.
+	rotate      *rotateConfig
+	size        int64
+	openedAt    time.Time
+	cleanupLock sync.Mutex
+
+	// chain links the entries together if hash chaining is enabled. It is
+	// only used while holding fileLock so that entries are written in the
+	// order they are linked.
+	chain *audit.HashChain
+
 	saltMutex  sync.RWMutex
 	salt       *atomic.Value
 	saltConfig *salt.Config
@@ -203,19 +279,35 @@ func (b *Backend) LogRequest(ctx context.Context, in *logical.LogInput) error {
 }
 
 func (b *Backend) log(ctx context.Context, buf *bytes.Buffer, writer io.Writer) error {
-	reader := bytes.NewReader(buf.Bytes())
-
 	b.fileLock.Lock()
 
+	entry := buf.Bytes()
+	if b.chain != nil {
+		linked, err := b.chain.Link(ctx, entry)
+		if err != nil {
+			b.fileLock.Unlock()
+			return err
+		}
+		entry = linked
+	}
+	reader := bytes.NewReader(entry)
+
 	if writer == nil {
 		if err := b.open(); err != nil {
 			b.fileLock.Unlock()
 			return err
 		}
+		if b.shouldRotate(len(entry)) {
+			if err := b.rotateFile(); err != nil {
+				b.fileLock.Unlock()
+				return err
+			}
+		}
 		writer = b.f
 	}
 
-	if _, err := reader.WriteTo(writer); err == nil {
+	if n, err := reader.WriteTo(writer); err == nil {
+		b.size += n
 		b.fileLock.Unlock()
 		return nil
 	} else if b.path == "stdout" {
@@ -235,7 +327,8 @@ func (b *Backend) log(ctx context.Context, buf *bytes.Buffer, writer io.Writer)
 	}
 
 	reader.Seek(0, io.SeekStart)
-	_, err := reader.WriteTo(writer)
+	n, err := reader.WriteTo(b.f)
+	b.size += n
 	b.fileLock.Unlock()
 	return err
 }
@@ -286,6 +379,13 @@ func (b *Backend) open() error {
 		}
 	}
 
+	b.size = 0
+	b.openedAt = time.Now()
+	if info, err := b.f.Stat(); err == nil {
+		b.size = info.Size()
+		b.openedAt = b.startedAt(info)
+	}
+
 	return nil
 }
 
@@ -1,11 +1,13 @@
 package file
 
 import (
+	"compress/gzip"
 	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -93,6 +95,290 @@ func TestAuditFile_fileModeExisting(t *testing.T) {
 	}
 }
 
+func TestAuditFile_rotateConfig(t *testing.T) {
+	path, err := ioutil.TempDir("", "vault-test_audit_file-rotate_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	config := map[string]string{
+		"path":         filepath.Join(path, "auditTest.txt"),
+		"rotate_bytes": "1024",
+	}
+	_, err = Factory(context.Background(), &audit.BackendConfig{
+		SaltConfig: &salt.Config{},
+		SaltView:   &logical.InmemStorage{},
+		Config:     config,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The effective rotation policy is reported in the options
+	expected := map[string]string{
+		"rotate_bytes":     "1024",
+		"rotate_duration":  "0s",
+		"rotate_max_files": "0",
+		"rotate_compress":  "false",
+	}
+	for k, v := range expected {
+		if config[k] != v {
+			t.Fatalf("expected option %q to be %q, got %q", k, v, config[k])
+		}
+	}
+
+	for _, config := range []map[string]string{
+		{"path": "stdout", "rotate_bytes": "1024"},
+		{"path": filepath.Join(path, "auditTest.txt"), "rotate_bytes": "-1"},
+		{"path": filepath.Join(path, "auditTest.txt"), "rotate_duration": "soon"},
+		{"path": filepath.Join(path, "auditTest.txt"), "rotate_compress": "maybe"},
+	} {
+		_, err = Factory(context.Background(), &audit.BackendConfig{
+			SaltConfig: &salt.Config{},
+			SaltView:   &logical.InmemStorage{},
+			Config:     config,
+		})
+		if err == nil {
+			t.Fatalf("expected error with options %v", config)
+		}
+	}
+}
+
+func TestAuditFile_rotate(t *testing.T) {
+	path, err := ioutil.TempDir("", "vault-test_audit_file-rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	file := filepath.Join(path, "auditTest.txt")
+	be, err := Factory(context.Background(), &audit.BackendConfig{
+		SaltConfig: &salt.Config{},
+		SaltView:   &logical.InmemStorage{},
+		Config: map[string]string{
+			"path":             file,
+			"rotate_bytes":     "1",
+			"rotate_max_files": "2",
+			"rotate_compress":  "true",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := be.(*Backend)
+
+	in := &logical.LogInput{
+		Request: &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "/foo",
+		},
+	}
+	ctx := namespace.RootContext(nil)
+	for i := 0; i < 4; i++ {
+		if err := b.LogRequest(ctx, in); err != nil {
+			t.Fatal(err)
+		}
+		// Wait for the background cleanup of each rotation so that the
+		// timestamps of the rotated files differ
+		time.Sleep(10 * time.Millisecond)
+		b.cleanupLock.Lock()
+		b.cleanupLock.Unlock()
+	}
+
+	// Every entry but the last was rotated, and only the two most recent
+	// rotated files were kept
+	files, err := b.rotatedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 rotated files, got %v", files)
+	}
+	for _, rotated := range files {
+		if filepath.Ext(rotated) != ".gz" {
+			t.Fatalf("expected compressed rotated file, got %q", rotated)
+		}
+		f, err := os.Open(rotated)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := ioutil.ReadAll(gz)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(contents), `"type":"request"`) {
+			t.Fatalf("bad rotated file contents: %s", contents)
+		}
+	}
+
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(contents), "\n") != 1 {
+		t.Fatalf("expected a single entry in the current file, got %s", contents)
+	}
+}
+
+func TestAuditFile_rotateDurationReopen(t *testing.T) {
+	path, err := ioutil.TempDir("", "vault-test_audit_file-rotate_duration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	file := filepath.Join(path, "auditTest.txt")
+	config := map[string]string{
+		"path":            file,
+		"rotate_duration": "1h",
+	}
+	factory := func() *Backend {
+		be, err := Factory(context.Background(), &audit.BackendConfig{
+			SaltConfig: &salt.Config{},
+			SaltView:   &logical.InmemStorage{},
+			Config:     config,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return be.(*Backend)
+	}
+
+	in := &logical.LogInput{
+		Request: &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "/foo",
+		},
+	}
+	ctx := namespace.RootContext(nil)
+	expectRotated := func(b *Backend, expected int) {
+		t.Helper()
+		files, err := b.rotatedFiles()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != expected {
+			t.Fatalf("expected %d rotated files, got %v", expected, files)
+		}
+	}
+
+	// A file never rotated is as old as its last modification
+	if err := ioutil.WriteFile(file, []byte("{}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(file, old, old); err != nil {
+		t.Fatal(err)
+	}
+	b := factory()
+	if err := b.LogRequest(ctx, in); err != nil {
+		t.Fatal(err)
+	}
+	expectRotated(b, 1)
+
+	// Reopening a file which was just rotated keeps it
+	if err := b.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.LogRequest(ctx, in); err != nil {
+		t.Fatal(err)
+	}
+	expectRotated(b, 1)
+
+	// A file is as old as the most recent rotation, even when it was modified
+	// afterwards
+	files, err := b.rotatedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := file + "." + old.UTC().Format(rotatedTimeFormat)
+	if err := os.Rename(files[0], rotated); err != nil {
+		t.Fatal(err)
+	}
+	b = factory()
+	if err := b.LogRequest(ctx, in); err != nil {
+		t.Fatal(err)
+	}
+	expectRotated(b, 2)
+}
+
+func TestAuditFile_hashChain(t *testing.T) {
+	path, err := ioutil.TempDir("", "vault-test_audit_file-hash_chain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	file := filepath.Join(path, "auditTest.txt")
+	view := &logical.InmemStorage{}
+	in := &logical.LogInput{
+		Request: &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "/foo",
+		},
+	}
+	ctx := namespace.RootContext(nil)
+
+	// The chain continues across backends opening the same file
+	for i := 0; i < 2; i++ {
+		be, err := Factory(context.Background(), &audit.BackendConfig{
+			SaltConfig: &salt.Config{},
+			SaltView:   view,
+			Config: map[string]string{
+				"path":       file,
+				"hash_chain": "true",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 2; j++ {
+			if err := be.LogRequest(ctx, in); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(lines))
+	}
+	prevHMAC := ""
+	for i, line := range lines {
+		_, prev, hmac, err := audit.ParseChainedEntry([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prev != prevHMAC {
+			t.Fatalf("line %d: expected chain_prev %q, got %q", i, prevHMAC, prev)
+		}
+		prevHMAC = hmac
+	}
+
+	_, err = Factory(context.Background(), &audit.BackendConfig{
+		SaltConfig: &salt.Config{},
+		SaltView:   view,
+		Config: map[string]string{
+			"path":       file,
+			"format":     "jsonx",
+			"hash_chain": "true",
+		},
+	})
+	if err == nil {
+		t.Fatal("expected error enabling hash chaining with the jsonx format")
+	}
+}
+
 func BenchmarkAuditFile_request(b *testing.B) {
 	config := map[string]string{
 		"path": "/dev/null",
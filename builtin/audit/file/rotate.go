@@ -0,0 +1,247 @@
+package file
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/helper/parseutil"
+)
+
+// rotatedTimeFormat is the format of the timestamp appended to the name of
+// rotated files. It sorts lexically in chronological order.
+const rotatedTimeFormat = "20060102T150405.000000000Z"
+
+// rotateConfig is the rotation policy of the file audit device
+type rotateConfig struct {
+	// Bytes is the size after which the file is rotated, 0 to disable size
+	// based rotation
+	Bytes int64
+
+	// Duration is the time after which the file is rotated, 0 to disable time
+	// based rotation
+	Duration time.Duration
+
+	// MaxFiles is the number of rotated files to keep, 0 to keep them all
+	MaxFiles int
+
+	// Compress gzips the rotated files
+	Compress bool
+}
+
+func (r *rotateConfig) enabled() bool {
+	return r.Bytes > 0 || r.Duration > 0
+}
+
+// parseRotateConfig parses the rotation options. When rotation is enabled,
+// the effective policy is written back to the options so that it is reported
+// by sys/audit.
+func parseRotateConfig(config map[string]string) (*rotateConfig, error) {
+	r := &rotateConfig{}
+
+	if raw, ok := config["rotate_bytes"]; ok {
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to parse rotate_bytes: {{err}}", err)
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("rotate_bytes must not be negative")
+		}
+		r.Bytes = value
+	}
+
+	if raw, ok := config["rotate_duration"]; ok {
+		value, err := parseutil.ParseDurationSecond(raw)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to parse rotate_duration: {{err}}", err)
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("rotate_duration must not be negative")
+		}
+		r.Duration = value
+	}
+
+	if raw, ok := config["rotate_max_files"]; ok {
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to parse rotate_max_files: {{err}}", err)
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("rotate_max_files must not be negative")
+		}
+		r.MaxFiles = value
+	}
+
+	if raw, ok := config["rotate_compress"]; ok {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to parse rotate_compress: {{err}}", err)
+		}
+		r.Compress = value
+	}
+
+	if r.enabled() {
+		config["rotate_bytes"] = strconv.FormatInt(r.Bytes, 10)
+		config["rotate_duration"] = r.Duration.String()
+		config["rotate_max_files"] = strconv.Itoa(r.MaxFiles)
+		config["rotate_compress"] = strconv.FormatBool(r.Compress)
+	}
+
+	return r, nil
+}
+
+// shouldRotate returns whether the file must be rotated before writing size
+// more bytes to it. The file lock must be held before calling this.
+func (b *Backend) shouldRotate(size int) bool {
+	if b.rotate == nil || !b.rotate.enabled() {
+		return false
+	}
+	if b.rotate.Bytes > 0 && b.size > 0 && b.size+int64(size) > b.rotate.Bytes {
+		return true
+	}
+	if b.rotate.Duration > 0 && time.Since(b.openedAt) >= b.rotate.Duration {
+		return true
+	}
+	return false
+}
+
+// rotateFile renames the current file with a timestamp suffix and opens a new
+// one. Compressing the rotated file and removing the files exceeding the
+// retention count are done in the background. The file lock must be held
+// before calling this.
+func (b *Backend) rotateFile() error {
+	if b.f != nil {
+		err := b.f.Close()
+		b.f = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	rotated := b.path + "." + time.Now().UTC().Format(rotatedTimeFormat)
+	if err := os.Rename(b.path, rotated); err != nil {
+		return errwrap.Wrapf("failed to rotate audit file: {{err}}", err)
+	}
+
+	if err := b.open(); err != nil {
+		return err
+	}
+
+	go b.cleanupRotated(rotated)
+	return nil
+}
+
+// cleanupRotated compresses the rotated file if configured and removes the
+// oldest rotated files beyond the retention count
+func (b *Backend) cleanupRotated(rotated string) {
+	b.cleanupLock.Lock()
+	defer b.cleanupLock.Unlock()
+
+	if b.rotate.Compress {
+		// Failures leave the rotated file uncompressed
+		compressFile(rotated, b.mode)
+	}
+
+	if b.rotate.MaxFiles > 0 {
+		files, err := b.rotatedFiles()
+		if err != nil {
+			return
+		}
+		for len(files) > b.rotate.MaxFiles {
+			os.Remove(files[0])
+			files = files[1:]
+		}
+	}
+}
+
+// startedAt returns when the current file, just opened, was started, which is
+// the baseline of time based rotation. A file which already holds entries was
+// started by the most recent rotation, or, if it was never rotated, at the
+// latest when it was last modified, so that reopening it on restart or SIGHUP
+// does not postpone its rotation.
+func (b *Backend) startedAt(info os.FileInfo) time.Time {
+	now := time.Now()
+	if info.Size() == 0 || b.rotate == nil || b.rotate.Duration == 0 {
+		return now
+	}
+
+	if files, err := b.rotatedFiles(); err == nil && len(files) > 0 {
+		if rotatedAt, err := b.rotatedTime(files[len(files)-1]); err == nil && rotatedAt.Before(now) {
+			return rotatedAt
+		}
+	}
+	if modTime := info.ModTime(); modTime.Before(now) {
+		return modTime
+	}
+	return now
+}
+
+// rotatedTime returns the timestamp in the name of a rotated file
+func (b *Backend) rotatedTime(path string) (time.Time, error) {
+	prefix := filepath.Base(b.path) + "."
+	timestamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), prefix), ".gz")
+	return time.Parse(rotatedTimeFormat, timestamp)
+}
+
+// rotatedFiles returns the rotated files, oldest first
+func (b *Backend) rotatedFiles() ([]string, error) {
+	dir := filepath.Dir(b.path)
+	prefix := filepath.Base(b.path) + "."
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if _, err := b.rotatedTime(name); err != nil {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// compressFile gzips the file, replacing it with a .gz file
+func compressFile(path string, mode os.FileMode) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,563 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/sdk/helper/parseutil"
+	"github.com/hashicorp/vault/sdk/helper/salt"
+	"github.com/hashicorp/vault/sdk/helper/tlsutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// BufferFullBlock makes requests wait for room in the buffer when it is
+	// full, failing them if none frees up before they time out
+	BufferFullBlock = "block"
+
+	// BufferFullDrop discards new entries when the buffer is full
+	BufferFullDrop = "drop"
+)
+
+// ErrBufferFull is returned when an entry could not be buffered before the
+// request context was done
+var ErrBufferFull = errors.New("http audit buffer is full")
+
+// ErrClosed is returned when an entry is logged once the backend is closed
+var ErrClosed = errors.New("http audit device is closed")
+
+func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, error) {
+	if conf.SaltConfig == nil {
+		return nil, fmt.Errorf("nil salt config")
+	}
+	if conf.SaltView == nil {
+		return nil, fmt.Errorf("nil salt view")
+	}
+
+	url, ok := conf.Config["url"]
+	if !ok {
+		return nil, fmt.Errorf("url is required")
+	}
+
+	format, ok := conf.Config["format"]
+	if !ok {
+		format = "json"
+	}
+	var contentType string
+	switch format {
+	case "json":
+		contentType = "application/x-ndjson"
+	case "jsonx":
+		contentType = "application/xml"
+	default:
+		return nil, fmt.Errorf("unknown format type %q", format)
+	}
+
+	// Check if hashing of accessor is disabled
+	hmacAccessor := true
+	if hmacAccessorRaw, ok := conf.Config["hmac_accessor"]; ok {
+		value, err := strconv.ParseBool(hmacAccessorRaw)
+		if err != nil {
+			return nil, err
+		}
+		hmacAccessor = value
+	}
+
+	// Check if raw logging is enabled
+	logRaw := false
+	if raw, ok := conf.Config["log_raw"]; ok {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		logRaw = b
+	}
+
+	batchSize, err := parseInt(conf.Config, "batch_size", 100, 1)
+	if err != nil {
+		return nil, err
+	}
+	bufferSize, err := parseInt(conf.Config, "buffer_size", 10000, 1)
+	if err != nil {
+		return nil, err
+	}
+	if bufferSize < batchSize {
+		return nil, fmt.Errorf("buffer_size must be at least batch_size")
+	}
+	maxRetries, err := parseInt(conf.Config, "max_retries", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	batchInterval, err := parseDuration(conf.Config, "batch_interval", "1s")
+	if err != nil {
+		return nil, err
+	}
+	requestTimeout, err := parseDuration(conf.Config, "request_timeout", "10s")
+	if err != nil {
+		return nil, err
+	}
+	minBackoff, err := parseDuration(conf.Config, "retry_min_backoff", "1s")
+	if err != nil {
+		return nil, err
+	}
+	maxBackoff, err := parseDuration(conf.Config, "retry_max_backoff", "1m")
+	if err != nil {
+		return nil, err
+	}
+	if minBackoff <= 0 || maxBackoff < minBackoff {
+		return nil, fmt.Errorf("retry_min_backoff must be positive and no greater than retry_max_backoff")
+	}
+
+	// Check if hash chaining is enabled
+	hashChain, err := audit.ParseHashChainConfig(conf.Config, format)
+	if err != nil {
+		return nil, err
+	}
+
+	bufferFull, ok := conf.Config["buffer_full"]
+	if !ok {
+		bufferFull = BufferFullBlock
+	}
+	switch bufferFull {
+	case BufferFullBlock, BufferFullDrop:
+	default:
+		return nil, fmt.Errorf("unknown buffer_full behavior %q", bufferFull)
+	}
+
+	tlsConfig, err := parseTLSConfig(conf.Config)
+	if err != nil {
+		return nil, err
+	}
+	transport := cleanhttp.DefaultPooledTransport()
+	transport.TLSClientConfig = tlsConfig
+
+	b := &Backend{
+		saltConfig: conf.SaltConfig,
+		saltView:   conf.SaltView,
+		formatConfig: audit.FormatterConfig{
+			Raw:          logRaw,
+			HMACAccessor: hmacAccessor,
+		},
+
+		url:         url,
+		contentType: contentType,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   requestTimeout,
+		},
+
+		batchSize:     batchSize,
+		batchInterval: batchInterval,
+		bufferSize:    bufferSize,
+		block:         bufferFull == BufferFullBlock,
+		maxRetries:    maxRetries,
+		minBackoff:    minBackoff,
+		maxBackoff:    maxBackoff,
+
+		spaceCh: make(chan struct{}),
+		fullCh:  make(chan struct{}, 1),
+		stopCh:  make(chan struct{}),
+	}
+
+	switch format {
+	case "json":
+		b.formatter.AuditFormatWriter = &audit.JSONFormatWriter{
+			Prefix:   conf.Config["prefix"],
+			SaltFunc: b.Salt,
+		}
+	case "jsonx":
+		b.formatter.AuditFormatWriter = &audit.JSONxFormatWriter{
+			Prefix:   conf.Config["prefix"],
+			SaltFunc: b.Salt,
+		}
+	}
+
+	if hashChain {
+		b.chain = audit.NewHashChain(b.GetHash, "")
+	}
+
+	return b, nil
+}
+
+// Backend is the audit backend for the http audit transport. Formatted
+// entries are buffered in memory and POSTed in batches to the configured URL
+// by a background sender, which runs for as long as the buffer is not empty.
+// An entry is only removed from the buffer once it has been delivered, given
+// up on after max_retries failed attempts, or the backend is closed.
+type Backend struct {
+	formatter    audit.AuditFormatter
+	formatConfig audit.FormatterConfig
+
+	url         string
+	contentType string
+	client      *http.Client
+
+	batchSize     int
+	batchInterval time.Duration
+	bufferSize    int
+	block         bool
+	maxRetries    int
+	minBackoff    time.Duration
+	maxBackoff    time.Duration
+
+	// bufferLock protects buffer, sending and spaceCh. spaceCh is closed and
+	// replaced whenever entries are removed from the buffer, to wake up the
+	// requests waiting for room. fullCh is signaled when a full batch is
+	// buffered, so that it is sent without waiting for the batch interval.
+	bufferLock sync.Mutex
+	buffer     [][]byte
+	sending    bool
+	spaceCh    chan struct{}
+	fullCh     chan struct{}
+
+	// stopCh is closed when the backend is closed, to stop the sender and
+	// the requests waiting for room
+	stopCh   chan struct{}
+	stopOnce sync.Once
+
+	// chain links the entries together if hash chaining is enabled. It is
+	// only used while holding bufferLock, so that entries are buffered in the
+	// order they are linked.
+	chain *audit.HashChain
+
+	saltMutex  sync.RWMutex
+	salt       *salt.Salt
+	saltConfig *salt.Config
+	saltView   logical.Storage
+}
+
+var (
+	_ audit.Backend = (*Backend)(nil)
+	_ audit.Closer  = (*Backend)(nil)
+)
+
+func (b *Backend) GetHash(ctx context.Context, data string) (string, error) {
+	salt, err := b.Salt(ctx)
+	if err != nil {
+		return "", err
+	}
+	return audit.HashString(salt, data), nil
+}
+
+func (b *Backend) LogRequest(ctx context.Context, in *logical.LogInput) error {
+	var buf bytes.Buffer
+	if err := b.formatter.FormatRequest(ctx, &buf, b.formatConfig, in); err != nil {
+		return err
+	}
+
+	return b.enqueue(ctx, buf.Bytes())
+}
+
+func (b *Backend) LogResponse(ctx context.Context, in *logical.LogInput) error {
+	var buf bytes.Buffer
+	if err := b.formatter.FormatResponse(ctx, &buf, b.formatConfig, in); err != nil {
+		return err
+	}
+
+	return b.enqueue(ctx, buf.Bytes())
+}
+
+// enqueue adds the formatted entry to the buffer and starts the sender if it
+// is not running. When the buffer is full the entry is either dropped, or
+// waits for room until the context is done.
+func (b *Backend) enqueue(ctx context.Context, entry []byte) error {
+	b.bufferLock.Lock()
+	if b.closed() {
+		b.bufferLock.Unlock()
+		return ErrClosed
+	}
+	for len(b.buffer) >= b.bufferSize {
+		if !b.block {
+			b.bufferLock.Unlock()
+			metrics.IncrCounter([]string{"audit", "http", "dropped"}, 1)
+			return nil
+		}
+
+		spaceCh := b.spaceCh
+		b.bufferLock.Unlock()
+		select {
+		case <-ctx.Done():
+			return ErrBufferFull
+		case <-b.stopCh:
+			return ErrClosed
+		case <-spaceCh:
+		}
+		b.bufferLock.Lock()
+		if b.closed() {
+			b.bufferLock.Unlock()
+			return ErrClosed
+		}
+	}
+	defer b.bufferLock.Unlock()
+
+	if b.chain != nil {
+		linked, err := b.chain.Link(ctx, entry)
+		if err != nil {
+			return err
+		}
+		entry = linked
+	}
+
+	b.buffer = append(b.buffer, entry)
+	if len(b.buffer) >= b.batchSize {
+		select {
+		case b.fullCh <- struct{}{}:
+		default:
+		}
+	}
+
+	if !b.sending {
+		b.sending = true
+		go b.send()
+	}
+
+	return nil
+}
+
+// send delivers the buffered entries in batches until the buffer is empty or
+// the backend is closed
+func (b *Backend) send() {
+	for {
+		timer := time.NewTimer(b.batchInterval)
+		select {
+		case <-timer.C:
+		case <-b.fullCh:
+			timer.Stop()
+		case <-b.stopCh:
+			timer.Stop()
+		}
+
+		for {
+			b.bufferLock.Lock()
+			n := len(b.buffer)
+			if n > 0 && b.closed() {
+				metrics.IncrCounter([]string{"audit", "http", "dropped"}, float32(n))
+				b.buffer = nil
+				n = 0
+			}
+			if n == 0 {
+				b.sending = false
+				b.bufferLock.Unlock()
+				return
+			}
+			if n > b.batchSize {
+				n = b.batchSize
+			}
+			batch := b.buffer[:n]
+			b.bufferLock.Unlock()
+
+			b.deliver(batch)
+
+			b.bufferLock.Lock()
+			b.buffer = b.buffer[n:]
+			close(b.spaceCh)
+			b.spaceCh = make(chan struct{})
+			remaining := len(b.buffer)
+			b.bufferLock.Unlock()
+
+			// Send the next full batch right away, otherwise wait for the
+			// batch interval
+			if remaining < b.batchSize {
+				break
+			}
+		}
+	}
+}
+
+// deliver POSTs the batch, retrying with exponential backoff until it
+// succeeds, max_retries is exceeded or the backend is closed
+func (b *Backend) deliver(batch [][]byte) {
+	body := bytes.Join(batch, nil)
+	backoff := b.minBackoff
+	for attempt := 0; ; attempt++ {
+		err := b.post(body)
+		if err == nil {
+			metrics.IncrCounter([]string{"audit", "http", "sent"}, float32(len(batch)))
+			return
+		}
+
+		if b.maxRetries > 0 && attempt >= b.maxRetries {
+			metrics.IncrCounter([]string{"audit", "http", "dropped"}, float32(len(batch)))
+			return
+		}
+
+		metrics.IncrCounter([]string{"audit", "http", "retries"}, 1)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-b.stopCh:
+			timer.Stop()
+			metrics.IncrCounter([]string{"audit", "http", "dropped"}, float32(len(batch)))
+			return
+		}
+		backoff *= 2
+		if backoff > b.maxBackoff {
+			backoff = b.maxBackoff
+		}
+	}
+}
+
+func (b *Backend) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, b.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", b.contentType)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %d from %q", resp.StatusCode, b.url)
+	}
+	return nil
+}
+
+func (b *Backend) Reload(_ context.Context) error {
+	return nil
+}
+
+// Close stops the sender, discarding the entries not delivered yet, and fails
+// the requests waiting for room in the buffer. It is called when the device is
+// disabled or the audit devices are torn down on seal.
+func (b *Backend) Close() {
+	b.stopOnce.Do(func() {
+		close(b.stopCh)
+		if transport, ok := b.client.Transport.(*http.Transport); ok {
+			transport.CloseIdleConnections()
+		}
+	})
+}
+
+func (b *Backend) closed() bool {
+	select {
+	case <-b.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func (b *Backend) Salt(ctx context.Context) (*salt.Salt, error) {
+	b.saltMutex.RLock()
+	if b.salt != nil {
+		defer b.saltMutex.RUnlock()
+		return b.salt, nil
+	}
+	b.saltMutex.RUnlock()
+	b.saltMutex.Lock()
+	defer b.saltMutex.Unlock()
+	if b.salt != nil {
+		return b.salt, nil
+	}
+	salt, err := salt.NewSalt(ctx, b.saltView, b.saltConfig)
+	if err != nil {
+		return nil, err
+	}
+	b.salt = salt
+	return salt, nil
+}
+
+func (b *Backend) Invalidate(_ context.Context) {
+	b.saltMutex.Lock()
+	defer b.saltMutex.Unlock()
+	b.salt = nil
+}
+
+func parseInt(config map[string]string, key string, defaultValue, min int) (int, error) {
+	raw, ok := config[key]
+	if !ok {
+		return defaultValue, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errwrap.Wrapf(fmt.Sprintf("failed to parse %s: {{err}}", key), err)
+	}
+	if value < min {
+		return 0, fmt.Errorf("%s must be at least %d", key, min)
+	}
+	return value, nil
+}
+
+func parseDuration(config map[string]string, key, defaultValue string) (time.Duration, error) {
+	raw, ok := config[key]
+	if !ok {
+		raw = defaultValue
+	}
+	value, err := parseutil.ParseDurationSecond(raw)
+	if err != nil {
+		return 0, errwrap.Wrapf(fmt.Sprintf("failed to parse %s: {{err}}", key), err)
+	}
+	return value, nil
+}
+
+// parseTLSConfig returns the TLS configuration for the connections to the
+// endpoint, or nil if none of the TLS options are set
+func parseTLSConfig(config map[string]string) (*tls.Config, error) {
+	var caCert, clientCert, clientKey []byte
+	for key, value := range map[string]*[]byte{
+		"tls_ca_cert":     &caCert,
+		"tls_client_cert": &clientCert,
+		"tls_client_key":  &clientKey,
+	} {
+		path, ok := config[key]
+		if !ok {
+			continue
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("failed to read %s: {{err}}", key), err)
+		}
+		*value = contents
+	}
+	if (len(clientCert) == 0) != (len(clientKey) == 0) {
+		return nil, fmt.Errorf("tls_client_cert and tls_client_key must be set together")
+	}
+
+	skipVerify := false
+	if raw, ok := config["tls_skip_verify"]; ok {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		skipVerify = value
+	}
+	serverName := config["tls_server_name"]
+
+	if len(caCert) == 0 && len(clientCert) == 0 && !skipVerify && serverName == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if len(caCert) != 0 || len(clientCert) != 0 {
+		var err error
+		tlsConfig, err = tlsutil.ClientTLSConfig(caCert, clientCert, clientKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	tlsConfig.ServerName = serverName
+	tlsConfig.InsecureSkipVerify = skipVerify
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,273 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/helper/salt"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type testCollector struct {
+	sync.Mutex
+	// failures is the number of requests to fail before accepting entries
+	failures int
+	requests int
+	entries  []map[string]interface{}
+}
+
+func (c *testCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	c.Lock()
+	defer c.Unlock()
+	c.requests++
+	if c.failures > 0 {
+		c.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	for _, line := range bytes.Split(bytes.TrimSpace(body), []byte("\n")) {
+		entry := make(map[string]interface{})
+		if err := json.Unmarshal(line, &entry); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		c.entries = append(c.entries, entry)
+	}
+}
+
+func (c *testCollector) stats() (int, int) {
+	c.Lock()
+	defer c.Unlock()
+	return c.requests, len(c.entries)
+}
+
+func testBackend(t *testing.T, config map[string]string) *Backend {
+	t.Helper()
+
+	b, err := Factory(context.Background(), &audit.BackendConfig{
+		SaltConfig: &salt.Config{},
+		SaltView:   &logical.InmemStorage{},
+		Config:     config,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.(*Backend)
+}
+
+func testLogInput() *logical.LogInput {
+	return &logical.LogInput{
+		Auth: &logical.Auth{
+			ClientToken: "foo",
+			Accessor:    "bar",
+			DisplayName: "testtoken",
+			Policies:    []string{"root"},
+			TokenType:   logical.TokenTypeService,
+		},
+		Request: &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "/foo",
+			Connection: &logical.Connection{
+				RemoteAddr: "127.0.0.1",
+			},
+		},
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the audit entries to be delivered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAuditHTTP_Factory(t *testing.T) {
+	for name, config := range map[string]map[string]string{
+		"no url":               {},
+		"bad format":           {"url": "http://127.0.0.1", "format": "xml"},
+		"bad buffer_full":      {"url": "http://127.0.0.1", "buffer_full": "wait"},
+		"buffer below batch":   {"url": "http://127.0.0.1", "batch_size": "10", "buffer_size": "5"},
+		"zero batch_size":      {"url": "http://127.0.0.1", "batch_size": "0"},
+		"bad backoff":          {"url": "http://127.0.0.1", "retry_min_backoff": "10s", "retry_max_backoff": "1s"},
+		"client cert only":     {"url": "http://127.0.0.1", "tls_client_cert": "/nonexistent"},
+		"missing tls ca cert":  {"url": "http://127.0.0.1", "tls_ca_cert": "/nonexistent"},
+		"bad tls_skip_verify":  {"url": "http://127.0.0.1", "tls_skip_verify": "maybe"},
+		"bad request_timeout":  {"url": "http://127.0.0.1", "request_timeout": "soon"},
+		"negative max_retries": {"url": "http://127.0.0.1", "max_retries": "-1"},
+	} {
+		_, err := Factory(context.Background(), &audit.BackendConfig{
+			SaltConfig: &salt.Config{},
+			SaltView:   &logical.InmemStorage{},
+			Config:     config,
+		})
+		if err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+func TestAuditHTTP_Batching(t *testing.T) {
+	collector := &testCollector{}
+	ts := httptest.NewServer(collector)
+	defer ts.Close()
+
+	b := testBackend(t, map[string]string{
+		"url":            ts.URL,
+		"batch_size":     "5",
+		"batch_interval": "1h",
+	})
+
+	ctx := namespace.RootContext(nil)
+	for i := 0; i < 10; i++ {
+		if err := b.LogRequest(ctx, testLogInput()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Full batches are sent without waiting for the batch interval
+	waitFor(t, func() bool {
+		_, entries := collector.stats()
+		return entries == 10
+	})
+	if requests, _ := collector.stats(); requests != 2 {
+		t.Fatalf("expected 2 batches, got %d", requests)
+	}
+
+	collector.Lock()
+	defer collector.Unlock()
+	if collector.entries[0]["type"] != "request" {
+		t.Fatalf("bad entry: %v", collector.entries[0])
+	}
+}
+
+func TestAuditHTTP_Retry(t *testing.T) {
+	collector := &testCollector{failures: 2}
+	ts := httptest.NewServer(collector)
+	defer ts.Close()
+
+	b := testBackend(t, map[string]string{
+		"url":               ts.URL,
+		"batch_interval":    "10ms",
+		"retry_min_backoff": "10ms",
+		"retry_max_backoff": "20ms",
+	})
+
+	if err := b.LogRequest(namespace.RootContext(nil), testLogInput()); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool {
+		_, entries := collector.stats()
+		return entries == 1
+	})
+	if requests, _ := collector.stats(); requests != 3 {
+		t.Fatalf("expected 3 attempts, got %d", requests)
+	}
+}
+
+func TestAuditHTTP_BufferFull(t *testing.T) {
+	collector := &testCollector{failures: 1000}
+	ts := httptest.NewServer(collector)
+	defer ts.Close()
+
+	config := map[string]string{
+		"url":               ts.URL,
+		"batch_size":        "1",
+		"buffer_size":       "1",
+		"retry_min_backoff": "1h",
+		"retry_max_backoff": "1h",
+	}
+
+	// Blocking backends fail the request once it times out waiting for room
+	b := testBackend(t, config)
+	if err := b.LogRequest(namespace.RootContext(nil), testLogInput()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(namespace.RootContext(nil), 100*time.Millisecond)
+	defer cancel()
+	if err := b.LogRequest(ctx, testLogInput()); err != ErrBufferFull {
+		t.Fatalf("expected ErrBufferFull, got %v", err)
+	}
+
+	// Dropping backends discard the entry
+	config["buffer_full"] = BufferFullDrop
+	b = testBackend(t, config)
+	for i := 0; i < 2; i++ {
+		if err := b.LogRequest(namespace.RootContext(nil), testLogInput()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.bufferLock.Lock()
+	defer b.bufferLock.Unlock()
+	if len(b.buffer) != 1 {
+		t.Fatalf("expected 1 buffered entry, got %d", len(b.buffer))
+	}
+}
+
+func TestAuditHTTP_Close(t *testing.T) {
+	collector := &testCollector{failures: 1000}
+	ts := httptest.NewServer(collector)
+	defer ts.Close()
+
+	b := testBackend(t, map[string]string{
+		"url":               ts.URL,
+		"batch_size":        "1",
+		"buffer_size":       "1",
+		"batch_interval":    "10ms",
+		"retry_min_backoff": "1h",
+		"retry_max_backoff": "1h",
+	})
+
+	if err := b.LogRequest(namespace.RootContext(nil), testLogInput()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		requests, _ := collector.stats()
+		return requests == 1
+	})
+
+	// The buffer is full and the batch is never delivered, so this request
+	// waits for room until the backend is closed
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- b.LogRequest(namespace.RootContext(nil), testLogInput())
+	}()
+
+	b.Close()
+	select {
+	case err := <-errCh:
+		if err != ErrClosed {
+			t.Fatalf("expected ErrClosed, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the blocked request to fail")
+	}
+
+	// The sender stops retrying and discards the buffered entries
+	waitFor(t, func() bool {
+		b.bufferLock.Lock()
+		defer b.bufferLock.Unlock()
+		return !b.sending && len(b.buffer) == 0
+	})
+
+	if err := b.LogRequest(namespace.RootContext(nil), testLogInput()); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+	b.Close()
+}
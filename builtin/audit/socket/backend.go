@@ -73,6 +73,12 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		logRaw = b
 	}
 
+	// Check if hash chaining is enabled
+	hashChain, err := audit.ParseHashChainConfig(conf.Config, format)
+	if err != nil {
+		return nil, err
+	}
+
 	b := &Backend{
 		saltConfig: conf.SaltConfig,
 		saltView:   conf.SaltView,
@@ -99,6 +105,10 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		}
 	}
 
+	if hashChain {
+		b.chain = audit.NewHashChain(b.GetHash, "")
+	}
+
 	return b, nil
 }
 
@@ -113,6 +123,10 @@ type Backend struct {
 	address       string
 	socketType    string
 
+	// chain links the entries together if hash chaining is enabled. It is
+	// only used while holding the backend lock.
+	chain *audit.HashChain
+
 	sync.Mutex
 
 	saltMutex  sync.RWMutex
@@ -140,18 +154,7 @@ func (b *Backend) LogRequest(ctx context.Context, in *logical.LogInput) error {
 	b.Lock()
 	defer b.Unlock()
 
-	err := b.write(ctx, buf.Bytes())
-	if err != nil {
-		rErr := b.reconnect(ctx)
-		if rErr != nil {
-			err = multierror.Append(err, rErr)
-		} else {
-			// Try once more after reconnecting
-			err = b.write(ctx, buf.Bytes())
-		}
-	}
-
-	return err
+	return b.writeEntry(ctx, buf.Bytes())
 }
 
 func (b *Backend) LogResponse(ctx context.Context, in *logical.LogInput) error {
@@ -163,14 +166,29 @@ func (b *Backend) LogResponse(ctx context.Context, in *logical.LogInput) error {
 	b.Lock()
 	defer b.Unlock()
 
-	err := b.write(ctx, buf.Bytes())
+	return b.writeEntry(ctx, buf.Bytes())
+}
+
+// writeEntry links the entry to the hash chain if enabled and writes it,
+// reconnecting once on failure. The backend lock must be held before calling
+// this.
+func (b *Backend) writeEntry(ctx context.Context, entry []byte) error {
+	if b.chain != nil {
+		linked, err := b.chain.Link(ctx, entry)
+		if err != nil {
+			return err
+		}
+		entry = linked
+	}
+
+	err := b.write(ctx, entry)
 	if err != nil {
 		rErr := b.reconnect(ctx)
 		if rErr != nil {
 			err = multierror.Append(err, rErr)
 		} else {
 			// Try once more after reconnecting
-			err = b.write(ctx, buf.Bytes())
+			err = b.write(ctx, entry)
 		}
 	}
 
@@ -69,6 +69,12 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		return nil, err
 	}
 
+	// Check if hash chaining is enabled
+	hashChain, err := audit.ParseHashChainConfig(conf.Config, format)
+	if err != nil {
+		return nil, err
+	}
+
 	b := &Backend{
 		logger:     logger,
 		saltConfig: conf.SaltConfig,
@@ -92,6 +98,10 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		}
 	}
 
+	if hashChain {
+		b.chain = audit.NewHashChain(b.GetHash, "")
+	}
+
 	return b, nil
 }
 
@@ -102,6 +112,12 @@ type Backend struct {
 	formatter    audit.AuditFormatter
 	formatConfig audit.FormatterConfig
 
+	// chain links the entries together if hash chaining is enabled.
+	// chainLock is held while linking and writing an entry so that entries
+	// are written in the order they are linked.
+	chainLock sync.Mutex
+	chain     *audit.HashChain
+
 	saltMutex  sync.RWMutex
 	salt       *salt.Salt
 	saltConfig *salt.Config
@@ -124,9 +140,7 @@ func (b *Backend) LogRequest(ctx context.Context, in *logical.LogInput) error {
 		return err
 	}
 
-	// Write out to syslog
-	_, err := b.logger.Write(buf.Bytes())
-	return err
+	return b.write(ctx, buf.Bytes())
 }
 
 func (b *Backend) LogResponse(ctx context.Context, in *logical.LogInput) error {
@@ -135,8 +149,23 @@ func (b *Backend) LogResponse(ctx context.Context, in *logical.LogInput) error {
 		return err
 	}
 
+	return b.write(ctx, buf.Bytes())
+}
+
+func (b *Backend) write(ctx context.Context, entry []byte) error {
+	if b.chain != nil {
+		b.chainLock.Lock()
+		defer b.chainLock.Unlock()
+
+		linked, err := b.chain.Link(ctx, entry)
+		if err != nil {
+			return err
+		}
+		entry = linked
+	}
+
 	// Write out to syslog
-	_, err := b.logger.Write(buf.Bytes())
+	_, err := b.logger.Write(entry)
 	return err
 }
 
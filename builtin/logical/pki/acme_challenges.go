@@ -0,0 +1,112 @@
+package pki
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const (
+	acmeValidationTimeout = 10 * time.Second
+
+	// acmeMaxChallengeResponse bounds the amount of data read back from an
+	// http-01 challenge response
+	acmeMaxChallengeResponse = 4096
+)
+
+// validateACMEChallenge checks whether the given challenge is fulfilled for
+// the identifier. On failure, the returned error is suitable for reporting
+// back to the client.
+func (b *backend) validateACMEChallenge(ctx context.Context, config *acmeConfig, identifier string, chall *acmeChallenge, key *jose.JSONWebKey) *acmeError {
+	keyAuth, err := keyAuthorization(chall.Token, key)
+	if err != nil {
+		return acmeServerInternal("failed to compute key authorization: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, acmeValidationTimeout)
+	defer cancel()
+
+	switch chall.Type {
+	case acmeChallengeHTTP01:
+		return b.validateHTTP01(ctx, identifier, chall.Token, keyAuth)
+	case acmeChallengeDNS01:
+		return validateDNS01(ctx, config.DNSResolver, identifier, keyAuth)
+	default:
+		return acmeMalformed("unsupported challenge type %q", chall.Type)
+	}
+}
+
+func (b *backend) validateHTTP01(ctx context.Context, domain, token, keyAuth string) *acmeError {
+	host := domain
+	if b.acmeHTTP01Port != 0 {
+		host = net.JoinHostPort(domain, strconv.Itoa(b.acmeHTTP01Port))
+	}
+	url := fmt.Sprintf("http://%s/.well-known/acme-challenge/%s", host, token)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return acmeMalformed("failed to build challenge request: %s", err)
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := cleanhttp.DefaultClient().Do(req)
+	if err != nil {
+		return newACMEError("connection", http.StatusBadRequest, "failed to fetch %s: %s", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newACMEError("incorrectResponse", http.StatusForbidden, "fetching %s returned status %d", url, resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, acmeMaxChallengeResponse))
+	if err != nil {
+		return newACMEError("connection", http.StatusBadRequest, "failed to read response from %s: %s", url, err)
+	}
+
+	if strings.TrimSpace(string(body)) != keyAuth {
+		return newACMEError("incorrectResponse", http.StatusForbidden, "key authorization served at %s does not match", url)
+	}
+
+	return nil
+}
+
+func validateDNS01(ctx context.Context, resolverAddr, domain, keyAuth string) *acmeError {
+	resolver := net.DefaultResolver
+	if resolverAddr != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, resolverAddr)
+			},
+		}
+	}
+
+	name := "_acme-challenge." + strings.TrimPrefix(domain, "*.")
+	records, err := resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return newACMEError("dns", http.StatusBadRequest, "failed to look up TXT records for %s: %s", name, err)
+	}
+
+	digest := sha256.Sum256([]byte(keyAuth))
+	expected := base64.RawURLEncoding.EncodeToString(digest[:])
+	for _, record := range records {
+		if record == expected {
+			return nil
+		}
+	}
+
+	return newACMEError("incorrectResponse", http.StatusForbidden, "no TXT record for %s matches the key authorization", name)
+}
@@ -0,0 +1,290 @@
+package pki
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const (
+	acmeErrorPrefix = "urn:ietf:params:acme:error:"
+
+	// acmeNonceLifetime is how long a nonce handed out to a client remains
+	// redeemable
+	acmeNonceLifetime = 15 * time.Minute
+
+	// acmeMaxNonces bounds the number of outstanding nonces, as they can be
+	// requested without authentication
+	acmeMaxNonces = 50000
+)
+
+// acmeSignatureAlgorithms are the JWS algorithms accepted on ACME requests.
+// RFC 8555 forbids "none" and MAC-based algorithms.
+var acmeSignatureAlgorithms = map[string]bool{
+	string(jose.RS256): true,
+	string(jose.ES256): true,
+	string(jose.ES384): true,
+	string(jose.ES512): true,
+	string(jose.EdDSA): true,
+}
+
+// acmeError is a problem document as described in RFC 7807 and section 6.7
+// of RFC 8555
+type acmeError struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+func newACMEError(errType string, status int, format string, args ...interface{}) *acmeError {
+	return &acmeError{
+		Type:   acmeErrorPrefix + errType,
+		Detail: fmt.Sprintf(format, args...),
+		Status: status,
+	}
+}
+
+func acmeMalformed(format string, args ...interface{}) *acmeError {
+	return newACMEError("malformed", http.StatusBadRequest, format, args...)
+}
+
+func acmeUnauthorized(format string, args ...interface{}) *acmeError {
+	return newACMEError("unauthorized", http.StatusForbidden, format, args...)
+}
+
+func acmeServerInternal(format string, args ...interface{}) *acmeError {
+	return newACMEError("serverInternal", http.StatusInternalServerError, format, args...)
+}
+
+func acmeNotFound(format string, args ...interface{}) *acmeError {
+	return newACMEError("malformed", http.StatusNotFound, format, args...)
+}
+
+// acmeNonces tracks the anti-replay nonces handed out to ACME clients. Nonces
+// are kept in memory; ACME requests are always served by the active node.
+type acmeNonces struct {
+	l         sync.Mutex
+	nonces    map[string]time.Time
+	lastPrune time.Time
+}
+
+func newACMENonces() *acmeNonces {
+	return &acmeNonces{
+		nonces: make(map[string]time.Time),
+	}
+}
+
+func (n *acmeNonces) issue() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(buf)
+
+	now := time.Now()
+
+	n.l.Lock()
+	defer n.l.Unlock()
+
+	if now.Sub(n.lastPrune) > time.Minute {
+		for k, expires := range n.nonces {
+			if now.After(expires) {
+				delete(n.nonces, k)
+			}
+		}
+		n.lastPrune = now
+	}
+
+	// Once the bound is reached, outstanding nonces are dropped to make room;
+	// clients retry requests rejected with a badNonce error
+	for k := range n.nonces {
+		if len(n.nonces) < acmeMaxNonces {
+			break
+		}
+		delete(n.nonces, k)
+	}
+	n.nonces[nonce] = now.Add(acmeNonceLifetime)
+
+	return nonce, nil
+}
+
+// redeem consumes the given nonce, returning whether it was valid
+func (n *acmeNonces) redeem(nonce string) bool {
+	n.l.Lock()
+	defer n.l.Unlock()
+
+	expires, ok := n.nonces[nonce]
+	if !ok {
+		return false
+	}
+	delete(n.nonces, nonce)
+
+	return time.Now().Before(expires)
+}
+
+// acmeRequest is a JWS-authenticated ACME request whose signature has been
+// verified
+type acmeRequest struct {
+	payload []byte
+
+	// jwk is set when the request was signed with an embedded key, as is
+	// done when creating an account or revoking with a certificate's key
+	jwk *jose.JSONWebKey
+
+	// account is set when the request was signed by an existing account
+	account *acmeAccount
+}
+
+// postAsGet returns whether the request is a POST-as-GET request, which
+// carries an empty payload.
+func (r *acmeRequest) postAsGet() bool {
+	return len(r.payload) == 0
+}
+
+func (r *acmeRequest) decodePayload(out interface{}) *acmeError {
+	if r.postAsGet() {
+		return acmeMalformed("request payload must not be empty")
+	}
+	if err := json.Unmarshal(r.payload, out); err != nil {
+		return acmeMalformed("failed to decode request payload: %s", err)
+	}
+	return nil
+}
+
+// acmeKeyMode describes how an ACME request identifies the key it is signed
+// with
+type acmeKeyMode int
+
+const (
+	// acmeKeyNone marks endpoints which do not take a JWS at all
+	acmeKeyNone acmeKeyMode = iota
+
+	// acmeKeyAccount requires a "kid" header referencing a valid account
+	acmeKeyAccount
+
+	// acmeKeyJWK requires the key to be embedded in a "jwk" header
+	acmeKeyJWK
+
+	// acmeKeyAny accepts either form
+	acmeKeyAny
+)
+
+// verifyACMERequest parses and verifies the flattened JWS carried by an ACME
+// request, locating the verification key as required by mode.
+func (b *backend) verifyACMERequest(ctx context.Context, req *logical.Request, data *framework.FieldData, ac *acmeContext, mode acmeKeyMode) (*acmeRequest, *acmeError) {
+	raw, err := json.Marshal(map[string]interface{}{
+		"protected": data.Get("protected").(string),
+		"payload":   data.Get("payload").(string),
+		"signature": data.Get("signature").(string),
+	})
+	if err != nil {
+		return nil, acmeMalformed("failed to encode JWS: %s", err)
+	}
+
+	jws, err := jose.ParseSigned(string(raw))
+	if err != nil {
+		return nil, acmeMalformed("failed to parse JWS: %s", err)
+	}
+	if len(jws.Signatures) != 1 {
+		return nil, acmeMalformed("JWS must carry exactly one signature")
+	}
+	header := jws.Signatures[0].Protected
+
+	if !acmeSignatureAlgorithms[header.Algorithm] {
+		return nil, newACMEError("badSignatureAlgorithm", http.StatusBadRequest, "unsupported signature algorithm %q", header.Algorithm)
+	}
+
+	if header.Nonce == "" || !b.acmeNonces.redeem(header.Nonce) {
+		return nil, newACMEError("badNonce", http.StatusBadRequest, "invalid or expired nonce")
+	}
+
+	url, _ := header.ExtraHeaders[jose.HeaderKey("url")].(string)
+	if url != ac.requestURL {
+		return nil, acmeUnauthorized("JWS url header %q does not match the request URL %q", url, ac.requestURL)
+	}
+
+	ret := &acmeRequest{}
+	var verificationKey *jose.JSONWebKey
+	switch {
+	case header.JSONWebKey != nil && header.KeyID != "":
+		return nil, acmeMalformed("JWS must not carry both jwk and kid headers")
+
+	case mode == acmeKeyJWK && header.JSONWebKey == nil:
+		return nil, acmeMalformed("JWS must carry a jwk header")
+
+	case mode == acmeKeyAccount && header.KeyID == "":
+		return nil, acmeMalformed("JWS must carry a kid header")
+
+	case header.JSONWebKey != nil:
+		if !header.JSONWebKey.Valid() || !header.JSONWebKey.IsPublic() {
+			return nil, newACMEError("badPublicKey", http.StatusBadRequest, "jwk header must carry a valid public key")
+		}
+		verificationKey = header.JSONWebKey
+		ret.jwk = header.JSONWebKey
+
+	case header.KeyID != "":
+		accountID := acmeAccountIDFromURL(header.KeyID)
+		if accountID == "" {
+			return nil, newACMEError("accountDoesNotExist", http.StatusBadRequest, "unknown account %q", header.KeyID)
+		}
+		account, err := getACMEAccount(ctx, req.Storage, accountID)
+		if err != nil {
+			b.Logger().Error("failed to load ACME account", "error", err)
+			return nil, acmeServerInternal("failed to load account")
+		}
+		if account == nil {
+			return nil, newACMEError("accountDoesNotExist", http.StatusBadRequest, "unknown account %q", header.KeyID)
+		}
+		if account.Status != acmeStatusValid {
+			return nil, acmeUnauthorized("account is %s", account.Status)
+		}
+		verificationKey, err = account.publicKey()
+		if err != nil {
+			b.Logger().Error("failed to decode ACME account key", "error", err)
+			return nil, acmeServerInternal("failed to load account key")
+		}
+		ret.account = account
+
+	default:
+		return nil, acmeMalformed("JWS must carry either a jwk or a kid header")
+	}
+
+	ret.payload, err = jws.Verify(verificationKey)
+	if err != nil {
+		return nil, acmeMalformed("JWS signature verification failed")
+	}
+
+	return ret, nil
+}
+
+// acmeAccountIDFromURL extracts the account ID from an account URL. Accounts
+// are shared by all directories of a mount, so the URL may point at any of
+// them.
+func acmeAccountIDFromURL(accountURL string) string {
+	idx := strings.LastIndex(accountURL, "/account/")
+	if idx == -1 {
+		return ""
+	}
+	return accountURL[idx+len("/account/"):]
+}
+
+// keyAuthorization returns the key authorization of a challenge token as
+// described in section 8.1 of RFC 8555.
+func keyAuthorization(token string, key *jose.JSONWebKey) (string, error) {
+	thumbprint, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	return token + "." + base64.RawURLEncoding.EncodeToString(thumbprint), nil
+}
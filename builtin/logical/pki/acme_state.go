@@ -0,0 +1,220 @@
+package pki
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/logical"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const (
+	acmeStatusPending     = "pending"
+	acmeStatusReady       = "ready"
+	acmeStatusProcessing  = "processing"
+	acmeStatusValid       = "valid"
+	acmeStatusInvalid     = "invalid"
+	acmeStatusDeactivated = "deactivated"
+	acmeStatusRevoked     = "revoked"
+
+	acmeChallengeHTTP01 = "http-01"
+	acmeChallengeDNS01  = "dns-01"
+
+	// acmeOrderLifetime bounds how long an order and its authorizations may
+	// remain pending
+	acmeOrderLifetime = 24 * time.Hour
+
+	acmeAccountPrefix           = "acme/accounts/"
+	acmeAccountThumbprintPrefix = "acme/account-thumbprints/"
+	acmeOrderPrefix             = "acme/orders/"
+	acmeAuthorizationPrefix     = "acme/authorizations/"
+	acmeCertPrefix              = "acme/certs/"
+)
+
+type acmeAccount struct {
+	ID         string    `json:"id"`
+	Status     string    `json:"status"`
+	Contact    []string  `json:"contact"`
+	JWK        []byte    `json:"jwk"`
+	Thumbprint string    `json:"thumbprint"`
+	OrderIDs   []string  `json:"order_ids"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (a *acmeAccount) publicKey() (*jose.JSONWebKey, error) {
+	var key jose.JSONWebKey
+	if err := json.Unmarshal(a.JWK, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+type acmeIdentifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type acmeOrder struct {
+	ID               string           `json:"id"`
+	AccountID        string           `json:"account_id"`
+	Role             string           `json:"role"`
+	Status           string           `json:"status"`
+	Expires          time.Time        `json:"expires"`
+	Identifiers      []acmeIdentifier `json:"identifiers"`
+	AuthorizationIDs []string         `json:"authorization_ids"`
+	CertSerial       string           `json:"cert_serial"`
+}
+
+type acmeChallenge struct {
+	Type      string     `json:"type"`
+	Token     string     `json:"token"`
+	Status    string     `json:"status"`
+	Validated time.Time  `json:"validated"`
+	Error     *acmeError `json:"error"`
+}
+
+type acmeAuthorization struct {
+	ID         string           `json:"id"`
+	AccountID  string           `json:"account_id"`
+	OrderID    string           `json:"order_id"`
+	Identifier acmeIdentifier   `json:"identifier"`
+	Wildcard   bool             `json:"wildcard"`
+	Status     string           `json:"status"`
+	Expires    time.Time        `json:"expires"`
+	Challenges []*acmeChallenge `json:"challenges"`
+}
+
+// acmeCertOwner records the account that ordered an ACME issued certificate,
+// allowing the account to download and revoke it later
+type acmeCertOwner struct {
+	AccountID   string `json:"account_id"`
+	IssuerID    string `json:"issuer_id"`
+	Certificate []byte `json:"certificate"`
+}
+
+func newACMEID() (string, error) {
+	return uuid.GenerateUUID()
+}
+
+func getACMEEntry(ctx context.Context, s logical.Storage, key string, out interface{}) (bool, error) {
+	entry, err := s.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		return false, nil
+	}
+	if err := entry.DecodeJSON(out); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func putACMEEntry(ctx context.Context, s logical.Storage, key string, in interface{}) error {
+	entry, err := logical.StorageEntryJSON(key, in)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+func getACMEAccount(ctx context.Context, s logical.Storage, id string) (*acmeAccount, error) {
+	var account acmeAccount
+	found, err := getACMEEntry(ctx, s, acmeAccountPrefix+id, &account)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// getACMEAccountByThumbprint returns the account registered with the key of
+// the given thumbprint, if any
+func getACMEAccountByThumbprint(ctx context.Context, s logical.Storage, thumbprint string) (*acmeAccount, error) {
+	entry, err := s.Get(ctx, acmeAccountThumbprintPrefix+thumbprint)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return getACMEAccount(ctx, s, string(entry.Value))
+}
+
+func putACMEAccount(ctx context.Context, s logical.Storage, account *acmeAccount) error {
+	if err := putACMEEntry(ctx, s, acmeAccountPrefix+account.ID, account); err != nil {
+		return err
+	}
+	return s.Put(ctx, &logical.StorageEntry{
+		Key:   acmeAccountThumbprintPrefix + account.Thumbprint,
+		Value: []byte(account.ID),
+	})
+}
+
+func getACMEOrder(ctx context.Context, s logical.Storage, id string) (*acmeOrder, error) {
+	var order acmeOrder
+	found, err := getACMEEntry(ctx, s, acmeOrderPrefix+id, &order)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func putACMEOrder(ctx context.Context, s logical.Storage, order *acmeOrder) error {
+	return putACMEEntry(ctx, s, acmeOrderPrefix+order.ID, order)
+}
+
+func getACMEAuthorization(ctx context.Context, s logical.Storage, id string) (*acmeAuthorization, error) {
+	var authz acmeAuthorization
+	found, err := getACMEEntry(ctx, s, acmeAuthorizationPrefix+id, &authz)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &authz, nil
+}
+
+func putACMEAuthorization(ctx context.Context, s logical.Storage, authz *acmeAuthorization) error {
+	return putACMEEntry(ctx, s, acmeAuthorizationPrefix+authz.ID, authz)
+}
+
+// refreshStatus moves pending or ready orders whose authorizations have
+// changed, or which have expired, into their next state. It returns whether
+// the order was modified.
+func (o *acmeOrder) refreshStatus(ctx context.Context, s logical.Storage) (bool, error) {
+	if o.Status != acmeStatusPending && o.Status != acmeStatusReady {
+		return false, nil
+	}
+
+	if time.Now().After(o.Expires) {
+		o.Status = acmeStatusInvalid
+		return true, nil
+	}
+
+	if o.Status != acmeStatusPending {
+		return false, nil
+	}
+
+	ready := true
+	for _, id := range o.AuthorizationIDs {
+		authz, err := getACMEAuthorization(ctx, s, id)
+		if err != nil {
+			return false, err
+		}
+		if authz == nil {
+			o.Status = acmeStatusInvalid
+			return true, nil
+		}
+		switch authz.Status {
+		case acmeStatusValid:
+		case acmeStatusPending:
+			ready = false
+		default:
+			o.Status = acmeStatusInvalid
+			return true, nil
+		}
+	}
+
+	if ready {
+		o.Status = acmeStatusReady
+		return true, nil
+	}
+	return false, nil
+}
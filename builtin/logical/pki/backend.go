@@ -33,12 +33,19 @@ func Backend(conf *logical.BackendConfig) *backend {
 				"ca",
 				"crl/pem",
 				"crl",
+				"ca/issuer/*",
+				"crl/issuer/*",
+				"ocsp",
+				"ocsp/*",
+				"acme/*",
 			},
 
 			LocalStorage: []string{
 				"revoked/",
 				"crl",
+				"crls/",
 				"certs/",
+				"acme/",
 			},
 
 			Root: []string{
@@ -48,45 +55,68 @@ func Backend(conf *logical.BackendConfig) *backend {
 
 			SealWrapStorage: []string{
 				"config/ca_bundle",
+				"issuers/",
 			},
-		},
 
-		Paths: []*framework.Path{
-			pathListRoles(&b),
-			pathRoles(&b),
-			pathGenerateRoot(&b),
-			pathSignIntermediate(&b),
-			pathSignSelfIssued(&b),
-			pathDeleteRoot(&b),
-			pathGenerateIntermediate(&b),
-			pathSetSignedIntermediate(&b),
-			pathConfigCA(&b),
-			pathConfigCRL(&b),
-			pathConfigURLs(&b),
-			pathSignVerbatim(&b),
-			pathSign(&b),
-			pathIssue(&b),
-			pathRotateCRL(&b),
-			pathFetchCA(&b),
-			pathFetchCAChain(&b),
-			pathFetchCRL(&b),
-			pathFetchCRLViaCertPath(&b),
-			pathFetchValid(&b),
-			pathFetchListCerts(&b),
-			pathRevoke(&b),
-			pathTidy(&b),
+			AllowedResponseHeaders: []string{
+				"Replay-Nonce",
+				"Link",
+				"Location",
+			},
 		},
 
+		Paths: framework.PathAppend(
+			[]*framework.Path{
+				pathListRoles(&b),
+				pathRoles(&b),
+				pathGenerateRoot(&b),
+				pathGenerateIssuerRoot(&b),
+				pathSignIntermediate(&b),
+				pathSignSelfIssued(&b),
+				pathDeleteRoot(&b),
+				pathGenerateIntermediate(&b),
+				pathSetSignedIntermediate(&b),
+				pathConfigCA(&b),
+				pathConfigCRL(&b),
+				pathConfigURLs(&b),
+				pathConfigACME(&b),
+				pathConfigIssuers(&b),
+				pathListIssuers(&b),
+				pathIssuer(&b),
+				pathCrossSignIssuer(&b),
+				pathSignVerbatim(&b),
+				pathSign(&b),
+				pathIssue(&b),
+				pathRotateCRL(&b),
+				pathFetchCA(&b),
+				pathFetchCAChain(&b),
+				pathFetchCRL(&b),
+				pathFetchCRLViaCertPath(&b),
+				pathFetchIssuerCA(&b),
+				pathFetchIssuerCRL(&b),
+				pathFetchValid(&b),
+				pathFetchListCerts(&b),
+				pathRevoke(&b),
+				pathOCSPGet(&b),
+				pathOCSPPost(&b),
+				pathTidy(&b),
+			},
+			pathsACME(&b),
+		),
+
 		Secrets: []*framework.Secret{
 			secretCerts(&b),
 		},
 
+		InitializeFunc: b.initialize,
+
 		BackendType: logical.TypeLogical,
 	}
 
 	b.crlLifetime = time.Hour * 72
 	b.tidyCASGuard = new(uint32)
 	b.storage = conf.StorageView
+	b.acmeNonces = newACMENonces()
 
 	return &b
 }
@@ -98,6 +128,16 @@ type backend struct {
 	crlLifetime       time.Duration
 	revokeStorageLock sync.RWMutex
 	tidyCASGuard      *uint32
+
+	// issuersLock guards changes to the set of issuers and the default
+	issuersLock sync.Mutex
+
+	acmeNonces *acmeNonces
+	acmeLock   sync.Mutex
+
+	// acmeHTTP01Port overrides the port http-01 challenges are validated
+	// against, which is otherwise 80; used by tests
+	acmeHTTP01Port int
 }
 
 const backendHelp = `
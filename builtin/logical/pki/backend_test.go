@@ -2189,7 +2189,7 @@ func TestBackend_SignSelfIssued(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	signingBundle, err := fetchCAInfo(context.Background(), &logical.Request{Storage: storage})
+	signingBundle, err := b.fetchCAInfo(context.Background(), &logical.Request{Storage: storage})
 	if err != nil {
 		t.Fatal(err)
 	}
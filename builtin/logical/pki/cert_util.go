@@ -69,45 +69,9 @@ func getFormat(data *framework.FieldData) string {
 
 // Fetches the CA info. Unlike other certificates, the CA info is stored
 // in the backend as a CertBundle, because we are storing its private key
-func fetchCAInfo(ctx context.Context, req *logical.Request) (*certutil.CAInfoBundle, error) {
-	bundleEntry, err := req.Storage.Get(ctx, "config/ca_bundle")
-	if err != nil {
-		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch local CA certificate/key: %v", err)}
-	}
-	if bundleEntry == nil {
-		return nil, errutil.UserError{Err: "backend must be configured with a CA certificate/key"}
-	}
-
-	var bundle certutil.CertBundle
-	if err := bundleEntry.DecodeJSON(&bundle); err != nil {
-		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to decode local CA certificate/key: %v", err)}
-	}
-
-	parsedBundle, err := bundle.ToParsedCertBundle()
-	if err != nil {
-		return nil, errutil.InternalError{Err: err.Error()}
-	}
-
-	if parsedBundle.Certificate == nil {
-		return nil, errutil.InternalError{Err: "stored CA information not able to be parsed"}
-	}
-
-	caInfo := &certutil.CAInfoBundle{*parsedBundle, nil}
-
-	entries, err := getURLs(ctx, req)
-	if err != nil {
-		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch URL information: %v", err)}
-	}
-	if entries == nil {
-		entries = &certutil.URLEntries{
-			IssuingCertificates:   []string{},
-			CRLDistributionPoints: []string{},
-			OCSPServers:           []string{},
-		}
-	}
-	caInfo.URLs = entries
-
-	return caInfo, nil
+func (b *backend) fetchCAInfo(ctx context.Context, req *logical.Request) (*certutil.CAInfoBundle, error) {
+	_, caInfo, err := b.fetchIssuerCAInfo(ctx, req, defaultIssuerRef)
+	return caInfo, err
 }
 
 // Allows fetching certificates from the backend; it handles the slightly
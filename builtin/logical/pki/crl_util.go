@@ -5,7 +5,6 @@ import (
 	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -20,6 +19,7 @@ type revocationInfo struct {
 	CertificateBytes  []byte    `json:"certificate_bytes"`
 	RevocationTime    int64     `json:"revocation_time"`
 	RevocationTimeUTC time.Time `json:"revocation_time_utc"`
+	IssuerID          string    `json:"issuer_id,omitempty"`
 }
 
 // Revokes a cert, and tries to be smart about error recovery
@@ -33,19 +33,29 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 		return nil, nil
 	}
 
-	signingBundle, caErr := fetchCAInfo(ctx, req)
-	switch caErr.(type) {
-	case errutil.UserError:
-		return logical.ErrorResponse(fmt.Sprintf("could not fetch the CA certificate: %s", caErr)), nil
-	case errutil.InternalError:
-		return nil, fmt.Errorf("error fetching CA certificate: %s", caErr)
+	issuerIDs, err := b.listIssuers(ctx, req.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching CA certificate: %s", err)
 	}
-	if signingBundle == nil {
-		return nil, errors.New("CA info not found")
+	if len(issuerIDs) == 0 {
+		return logical.ErrorResponse("could not fetch the CA certificate: backend must be configured with a CA certificate/key"), nil
 	}
 	colonSerial := strings.Replace(strings.ToLower(serial), "-", ":", -1)
-	if colonSerial == certutil.GetHexFormatted(signingBundle.Certificate.SerialNumber.Bytes(), ":") {
-		return logical.ErrorResponse("adding CA to CRL is not allowed"), nil
+	for _, id := range issuerIDs {
+		issuer, err := getIssuer(ctx, req.Storage, id)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching CA certificate: %s", err)
+		}
+		if issuer == nil {
+			continue
+		}
+		issuerCert, err := issuer.certificate()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing CA certificate: %s", err)
+		}
+		if colonSerial == certutil.GetHexFormatted(issuerCert.SerialNumber.Bytes(), ":") {
+			return logical.ErrorResponse("adding CA to CRL is not allowed"), nil
+		}
 	}
 
 	alreadyRevoked := false
@@ -103,8 +113,16 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 			return nil, nil
 		}
 
+		issuer, err := b.issuerOfCert(ctx, req.Storage, cert)
+		if err != nil {
+			return nil, errwrap.Wrapf("error finding issuer of certificate: {{err}}", err)
+		}
+
 		currTime := time.Now()
 		revInfo.CertificateBytes = certEntry.Value
+		if issuer != nil {
+			revInfo.IssuerID = issuer.ID
+		}
 		revInfo.RevocationTime = currTime.Unix()
 		revInfo.RevocationTimeUTC = currTime.UTC()
 
@@ -139,8 +157,9 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 	return resp, nil
 }
 
-// Builds a CRL by going through the list of revoked certificates and building
-// a new CRL with the stored revocation times and serial numbers.
+// Builds a CRL for each issuer by going through the list of revoked
+// certificates and building new CRLs with the stored revocation times and
+// serial numbers. The default issuer's CRL is also written to "crl".
 func buildCRL(ctx context.Context, b *backend, req *logical.Request, forceNew bool) error {
 	crlInfo, err := b.CRL(ctx, req.Storage)
 	if err != nil {
@@ -148,9 +167,7 @@ func buildCRL(ctx context.Context, b *backend, req *logical.Request, forceNew bo
 	}
 
 	crlLifetime := b.crlLifetime
-	var revokedCerts []pkix.RevokedCertificate
-	var revInfo revocationInfo
-	var revokedSerials []string
+	disabled := false
 
 	if crlInfo != nil {
 		if crlInfo.Expiry != "" {
@@ -165,73 +182,121 @@ func buildCRL(ctx context.Context, b *backend, req *logical.Request, forceNew bo
 			if !forceNew {
 				return nil
 			}
-			goto WRITE
+			disabled = true
 		}
 	}
 
-	revokedSerials, err = req.Storage.List(ctx, "revoked/")
+	issuerIDs, err := b.listIssuers(ctx, req.Storage)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching CA certificate: %s", err)}
+	}
+	if len(issuerIDs) == 0 {
+		return errutil.UserError{Err: "could not fetch the CA certificate: backend must be configured with a CA certificate/key"}
+	}
+	issuersConfig, err := getIssuersConfig(ctx, req.Storage)
 	if err != nil {
-		return errutil.InternalError{Err: fmt.Sprintf("error fetching list of revoked certs: %s", err)}
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching issuers config: %s", err)}
 	}
 
-	for _, serial := range revokedSerials {
-		revokedEntry, err := req.Storage.Get(ctx, "revoked/"+serial)
+	issuers := make(map[string]*certutil.ParsedCertBundle, len(issuerIDs))
+	for _, id := range issuerIDs {
+		issuer, err := getIssuer(ctx, req.Storage, id)
 		if err != nil {
-			return errutil.InternalError{Err: fmt.Sprintf("unable to fetch revoked cert with serial %s: %s", serial, err)}
-		}
-		if revokedEntry == nil {
-			return errutil.InternalError{Err: fmt.Sprintf("revoked certificate entry for serial %s is nil", serial)}
+			return errutil.InternalError{Err: fmt.Sprintf("error fetching issuer %s: %s", id, err)}
 		}
-		if revokedEntry.Value == nil || len(revokedEntry.Value) == 0 {
-			// TODO: In this case, remove it and continue? How likely is this to
-			// happen? Alternately, could skip it entirely, or could implement a
-			// delete function so that there is a way to remove these
-			return errutil.InternalError{Err: fmt.Sprintf("found revoked serial but actual certificate is empty")}
+		if issuer == nil {
+			continue
 		}
-
-		err = revokedEntry.DecodeJSON(&revInfo)
+		parsedBundle, err := issuer.Bundle.ToParsedCertBundle()
 		if err != nil {
-			return errutil.InternalError{Err: fmt.Sprintf("error decoding revocation entry for serial %s: %s", serial, err)}
+			return errutil.InternalError{Err: fmt.Sprintf("error parsing issuer %s: %s", id, err)}
 		}
+		issuers[id] = parsedBundle
+	}
 
-		revokedCert, err := x509.ParseCertificate(revInfo.CertificateBytes)
+	revokedCerts := make(map[string][]pkix.RevokedCertificate, len(issuers))
+	if !disabled {
+		revokedSerials, err := req.Storage.List(ctx, "revoked/")
 		if err != nil {
-			return errutil.InternalError{Err: fmt.Sprintf("unable to parse stored revoked certificate with serial %s: %s", serial, err)}
+			return errutil.InternalError{Err: fmt.Sprintf("error fetching list of revoked certs: %s", err)}
 		}
 
-		// NOTE: We have to change this to UTC time because the CRL standard
-		// mandates it but Go will happily encode the CRL without this.
-		newRevCert := pkix.RevokedCertificate{
-			SerialNumber: revokedCert.SerialNumber,
-		}
-		if !revInfo.RevocationTimeUTC.IsZero() {
-			newRevCert.RevocationTime = revInfo.RevocationTimeUTC
-		} else {
-			newRevCert.RevocationTime = time.Unix(revInfo.RevocationTime, 0).UTC()
+		for _, serial := range revokedSerials {
+			var revInfo revocationInfo
+			revokedEntry, err := req.Storage.Get(ctx, "revoked/"+serial)
+			if err != nil {
+				return errutil.InternalError{Err: fmt.Sprintf("unable to fetch revoked cert with serial %s: %s", serial, err)}
+			}
+			if revokedEntry == nil {
+				return errutil.InternalError{Err: fmt.Sprintf("revoked certificate entry for serial %s is nil", serial)}
+			}
+			if revokedEntry.Value == nil || len(revokedEntry.Value) == 0 {
+				// TODO: In this case, remove it and continue? How likely is this to
+				// happen? Alternately, could skip it entirely, or could implement a
+				// delete function so that there is a way to remove these
+				return errutil.InternalError{Err: fmt.Sprintf("found revoked serial but actual certificate is empty")}
+			}
+
+			err = revokedEntry.DecodeJSON(&revInfo)
+			if err != nil {
+				return errutil.InternalError{Err: fmt.Sprintf("error decoding revocation entry for serial %s: %s", serial, err)}
+			}
+
+			revokedCert, err := x509.ParseCertificate(revInfo.CertificateBytes)
+			if err != nil {
+				return errutil.InternalError{Err: fmt.Sprintf("unable to parse stored revoked certificate with serial %s: %s", serial, err)}
+			}
+
+			// Entries revoked before issuers existed don't record one; fall
+			// back to checking signatures, and then to the default issuer
+			issuerID := revInfo.IssuerID
+			if _, ok := issuers[issuerID]; !ok {
+				issuerID = issuersConfig.DefaultIssuerID
+				for id, parsedBundle := range issuers {
+					if revokedCert.CheckSignatureFrom(parsedBundle.Certificate) == nil {
+						issuerID = id
+						break
+					}
+				}
+			}
+
+			// NOTE: We have to change this to UTC time because the CRL standard
+			// mandates it but Go will happily encode the CRL without this.
+			newRevCert := pkix.RevokedCertificate{
+				SerialNumber: revokedCert.SerialNumber,
+			}
+			if !revInfo.RevocationTimeUTC.IsZero() {
+				newRevCert.RevocationTime = revInfo.RevocationTimeUTC
+			} else {
+				newRevCert.RevocationTime = time.Unix(revInfo.RevocationTime, 0).UTC()
+			}
+			revokedCerts[issuerID] = append(revokedCerts[issuerID], newRevCert)
 		}
-		revokedCerts = append(revokedCerts, newRevCert)
 	}
 
-WRITE:
-	signingBundle, caErr := fetchCAInfo(ctx, req)
-	switch caErr.(type) {
-	case errutil.UserError:
-		return errutil.UserError{Err: fmt.Sprintf("could not fetch the CA certificate: %s", caErr)}
-	case errutil.InternalError:
-		return errutil.InternalError{Err: fmt.Sprintf("error fetching CA certificate: %s", caErr)}
-	}
+	for id, signingBundle := range issuers {
+		crlBytes, err := signingBundle.Certificate.CreateCRL(rand.Reader, signingBundle.PrivateKey, revokedCerts[id], time.Now(), time.Now().Add(crlLifetime))
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error creating new CRL: %s", err)}
+		}
 
-	crlBytes, err := signingBundle.Certificate.CreateCRL(rand.Reader, signingBundle.PrivateKey, revokedCerts, time.Now(), time.Now().Add(crlLifetime))
-	if err != nil {
-		return errutil.InternalError{Err: fmt.Sprintf("error creating new CRL: %s", err)}
-	}
+		err = req.Storage.Put(ctx, &logical.StorageEntry{
+			Key:   issuerCRLPrefix + id,
+			Value: crlBytes,
+		})
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error storing CRL: %s", err)}
+		}
 
-	err = req.Storage.Put(ctx, &logical.StorageEntry{
-		Key:   "crl",
-		Value: crlBytes,
-	})
-	if err != nil {
-		return errutil.InternalError{Err: fmt.Sprintf("error storing CRL: %s", err)}
+		if id == issuersConfig.DefaultIssuerID {
+			err = req.Storage.Put(ctx, &logical.StorageEntry{
+				Key:   defaultIssuerCRLKey,
+				Value: crlBytes,
+			})
+			if err != nil {
+				return errutil.InternalError{Err: fmt.Sprintf("error storing CRL: %s", err)}
+			}
+		}
 	}
 
 	return nil
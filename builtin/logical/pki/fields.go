@@ -286,3 +286,32 @@ func addCAIssueFields(fields map[string]*framework.FieldSchema) map[string]*fram
 
 	return fields
 }
+
+// addIssuerNameField adds the name to give an issuer created by the request
+func addIssuerNameField(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["issuer_name"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Optional name to give the new issuer, which can
+be used in place of its ID to refer to it. Must be
+unique within the mount and may not be "default".`,
+	}
+
+	return fields
+}
+
+// addIssuerRefField adds the reference to the issuer that should sign the
+// request
+func addIssuerRefField(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["issuer_ref"] = &framework.FieldSchema{
+		Type:    framework.TypeString,
+		Default: defaultIssuerRef,
+		Description: `ID or name of the issuer to sign with, or
+"default" to use the mount's default issuer.
+Defaults to "default".`,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Name: "Issuer",
+		},
+	}
+
+	return fields
+}
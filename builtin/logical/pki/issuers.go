@@ -0,0 +1,415 @@
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// defaultIssuerRef refers to whichever issuer is currently the default
+	defaultIssuerRef = "default"
+
+	issuerPrefix        = "issuers/"
+	issuerCRLPrefix     = "crls/"
+	issuersConfigKey    = "config/issuers"
+	legacyCABundleKey   = "config/ca_bundle"
+	defaultIssuerCAKey  = "ca"
+	defaultIssuerCRLKey = "crl"
+)
+
+// issuerEntry is a CA certificate and key held by this mount. Certificates
+// are always signed by a single issuer; a mount may hold several to allow
+// rotating the CA without standing up a new mount.
+type issuerEntry struct {
+	ID     string               `json:"id"`
+	Name   string               `json:"name"`
+	Bundle *certutil.CertBundle `json:"bundle"`
+
+	// CrossSigned holds PEM certificates for this issuer's subject and key
+	// signed by other issuers, which are handed out alongside certificates
+	// it issues so that chains to the other issuers remain valid
+	CrossSigned []string `json:"cross_signed"`
+}
+
+type issuersConfig struct {
+	DefaultIssuerID string `json:"default"`
+}
+
+func (i *issuerEntry) certificate() (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(i.Bundle.Certificate))
+	if block == nil {
+		return nil, fmt.Errorf("no certificate found for issuer %s", i.ID)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// crossSignedBlocks returns the certificates cross-signing this issuer
+func (i *issuerEntry) crossSignedBlocks() ([]*certutil.CertBlock, error) {
+	var ret []*certutil.CertBlock
+	for _, certPEM := range i.CrossSigned {
+		block, _ := pem.Decode([]byte(certPEM))
+		if block == nil {
+			return nil, fmt.Errorf("invalid cross-signed certificate for issuer %s", i.ID)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, &certutil.CertBlock{
+			Certificate: cert,
+			Bytes:       block.Bytes,
+		})
+	}
+	return ret, nil
+}
+
+func (i *issuerEntry) toResponseData(isDefault bool) map[string]interface{} {
+	caChain := i.Bundle.CAChain
+	if caChain == nil {
+		caChain = []string{}
+	}
+	crossSigned := i.CrossSigned
+	if crossSigned == nil {
+		crossSigned = []string{}
+	}
+	return map[string]interface{}{
+		"issuer_id":     i.ID,
+		"issuer_name":   i.Name,
+		"certificate":   i.Bundle.Certificate,
+		"ca_chain":      caChain,
+		"cross_signed":  crossSigned,
+		"serial_number": i.Bundle.SerialNumber,
+		"is_default":    isDefault,
+	}
+}
+
+func getIssuersConfig(ctx context.Context, s logical.Storage) (*issuersConfig, error) {
+	entry, err := s.Get(ctx, issuersConfigKey)
+	if err != nil {
+		return nil, err
+	}
+	config := &issuersConfig{}
+	if entry != nil {
+		if err := entry.DecodeJSON(config); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+func putIssuersConfig(ctx context.Context, s logical.Storage, config *issuersConfig) error {
+	entry, err := logical.StorageEntryJSON(issuersConfigKey, config)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+func getIssuer(ctx context.Context, s logical.Storage, id string) (*issuerEntry, error) {
+	entry, err := s.Get(ctx, issuerPrefix+id)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var issuer issuerEntry
+	if err := entry.DecodeJSON(&issuer); err != nil {
+		return nil, err
+	}
+	return &issuer, nil
+}
+
+func putIssuer(ctx context.Context, s logical.Storage, issuer *issuerEntry) error {
+	entry, err := logical.StorageEntryJSON(issuerPrefix+issuer.ID, issuer)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// listIssuers returns the IDs of all issuers
+func (b *backend) listIssuers(ctx context.Context, s logical.Storage) ([]string, error) {
+	return s.List(ctx, issuerPrefix)
+}
+
+func (b *backend) initialize(ctx context.Context, req *logical.InitializationRequest) error {
+	// Only the primary's active node may upgrade storage
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby | consts.ReplicationPerformanceSecondary | consts.ReplicationDRSecondary) {
+		return nil
+	}
+
+	return b.migrateLegacyCABundle(ctx, req.Storage)
+}
+
+// migrateLegacyCABundle turns the single CA bundle stored by older versions
+// into the default issuer. Bundles holding only a key are pending
+// intermediate CSRs and are left alone.
+func (b *backend) migrateLegacyCABundle(ctx context.Context, s logical.Storage) error {
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	entry, err := s.Get(ctx, legacyCABundleKey)
+	if err != nil || entry == nil {
+		return err
+	}
+	var cb certutil.CertBundle
+	if err := entry.DecodeJSON(&cb); err != nil {
+		return err
+	}
+	if cb.Certificate == "" {
+		return nil
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return err
+	}
+	issuer := &issuerEntry{
+		ID:     id,
+		Bundle: &cb,
+	}
+	if err := putIssuer(ctx, s, issuer); err != nil {
+		return err
+	}
+
+	config, err := getIssuersConfig(ctx, s)
+	if err != nil {
+		return err
+	}
+	if config.DefaultIssuerID == "" {
+		config.DefaultIssuerID = id
+		if err := putIssuersConfig(ctx, s, config); err != nil {
+			return err
+		}
+		crlEntry, err := s.Get(ctx, defaultIssuerCRLKey)
+		if err != nil {
+			return err
+		}
+		if crlEntry != nil {
+			crlEntry.Key = issuerCRLPrefix + id
+			if err := s.Put(ctx, crlEntry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.Delete(ctx, legacyCABundleKey)
+}
+
+// resolveIssuer returns the issuer with the given ID or name, or the default
+// issuer for "default" or an empty reference. It returns nil if there is no
+// such issuer.
+func (b *backend) resolveIssuer(ctx context.Context, s logical.Storage, ref string) (*issuerEntry, error) {
+	ids, err := b.listIssuers(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if ref == "" || ref == defaultIssuerRef {
+		config, err := getIssuersConfig(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		if config.DefaultIssuerID == "" {
+			return nil, nil
+		}
+		return getIssuer(ctx, s, config.DefaultIssuerID)
+	}
+
+	for _, id := range ids {
+		if id == ref {
+			return getIssuer(ctx, s, id)
+		}
+	}
+	for _, id := range ids {
+		issuer, err := getIssuer(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+		if issuer != nil && issuer.Name == ref {
+			return issuer, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// validateIssuerName checks that a name may be given to the issuer with the
+// given ID.
+func (b *backend) validateIssuerName(ctx context.Context, s logical.Storage, id, name string) error {
+	if name == "" {
+		return nil
+	}
+	if name == defaultIssuerRef {
+		return errutil.UserError{Err: fmt.Sprintf("%q is reserved and cannot be used as an issuer name", defaultIssuerRef)}
+	}
+	if strings.Contains(name, "/") {
+		return errutil.UserError{Err: "issuer names may not contain slashes"}
+	}
+
+	ids, err := b.listIssuers(ctx, s)
+	if err != nil {
+		return err
+	}
+	for _, otherID := range ids {
+		if otherID == name {
+			return errutil.UserError{Err: fmt.Sprintf("issuer name %q collides with an issuer ID", name)}
+		}
+		if otherID == id {
+			continue
+		}
+		other, err := getIssuer(ctx, s, otherID)
+		if err != nil {
+			return err
+		}
+		if other != nil && other.Name == name {
+			return errutil.UserError{Err: fmt.Sprintf("an issuer named %q already exists", name)}
+		}
+	}
+	return nil
+}
+
+// importIssuer stores a CA bundle as a new issuer. The first issuer of a
+// mount always becomes its default.
+func (b *backend) importIssuer(ctx context.Context, req *logical.Request, cb *certutil.CertBundle, name string, makeDefault bool) (*issuerEntry, error) {
+	if err := b.validateIssuerName(ctx, req.Storage, "", name); err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	issuer := &issuerEntry{
+		ID:     id,
+		Name:   name,
+		Bundle: cb,
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	if err := putIssuer(ctx, req.Storage, issuer); err != nil {
+		return nil, err
+	}
+
+	config, err := getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if makeDefault || config.DefaultIssuerID == "" {
+		if err := b.setDefaultIssuer(ctx, req.Storage, config, issuer); err != nil {
+			return nil, err
+		}
+	}
+
+	return issuer, nil
+}
+
+// setDefaultIssuer points the default issuer at the given one, keeping the
+// legacy "ca" entry in sync. The caller must hold issuersLock and rebuild the
+// CRL afterwards.
+func (b *backend) setDefaultIssuer(ctx context.Context, s logical.Storage, config *issuersConfig, issuer *issuerEntry) error {
+	config.DefaultIssuerID = issuer.ID
+	if err := putIssuersConfig(ctx, s, config); err != nil {
+		return err
+	}
+
+	cert, err := issuer.certificate()
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, &logical.StorageEntry{
+		Key:   defaultIssuerCAKey,
+		Value: cert.Raw,
+	})
+}
+
+// fetchIssuerCAInfo returns the issuer referenced by ref along with its
+// signing bundle.
+func (b *backend) fetchIssuerCAInfo(ctx context.Context, req *logical.Request, ref string) (*issuerEntry, *certutil.CAInfoBundle, error) {
+	issuer, err := b.resolveIssuer(ctx, req.Storage, ref)
+	if err != nil {
+		return nil, nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch local CA certificate/key: %v", err)}
+	}
+	if issuer == nil {
+		if ref == "" || ref == defaultIssuerRef {
+			return nil, nil, errutil.UserError{Err: "backend must be configured with a CA certificate/key"}
+		}
+		return nil, nil, errutil.UserError{Err: fmt.Sprintf("issuer %q does not exist", ref)}
+	}
+
+	parsedBundle, err := issuer.Bundle.ToParsedCertBundle()
+	if err != nil {
+		return nil, nil, errutil.InternalError{Err: err.Error()}
+	}
+	if parsedBundle.Certificate == nil {
+		return nil, nil, errutil.InternalError{Err: "stored CA information not able to be parsed"}
+	}
+
+	caInfo := &certutil.CAInfoBundle{
+		ParsedCertBundle: *parsedBundle,
+	}
+
+	entries, err := getURLs(ctx, req)
+	if err != nil {
+		return nil, nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch URL information: %v", err)}
+	}
+	if entries == nil {
+		entries = &certutil.URLEntries{
+			IssuingCertificates:   []string{},
+			CRLDistributionPoints: []string{},
+			OCSPServers:           []string{},
+		}
+	}
+	caInfo.URLs = entries
+
+	return issuer, caInfo, nil
+}
+
+// issuerOfCert returns the issuer that signed the given certificate, if it
+// is held by this mount.
+func (b *backend) issuerOfCert(ctx context.Context, s logical.Storage, cert *x509.Certificate) (*issuerEntry, error) {
+	ids, err := b.listIssuers(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		issuer, err := getIssuer(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+		if issuer == nil {
+			continue
+		}
+		issuerCert, err := issuer.certificate()
+		if err != nil {
+			return nil, err
+		}
+		if cert.CheckSignatureFrom(issuerCert) == nil {
+			return issuer, nil
+		}
+	}
+	return nil, nil
+}
+
+// appendCrossSigned adds the certificates cross-signing the issuer to the CA
+// chain of a freshly issued bundle.
+func appendCrossSigned(parsedBundle *certutil.ParsedCertBundle, issuer *issuerEntry) error {
+	blocks, err := issuer.crossSignedBlocks()
+	if err != nil {
+		return err
+	}
+	parsedBundle.CAChain = append(parsedBundle.CAChain, blocks...)
+	return nil
+}
@@ -0,0 +1,299 @@
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func issuersTestRequest(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	t.Helper()
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  op,
+		Path:       path,
+		Storage:    s,
+		Data:       data,
+		MountPoint: "pki/",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %s %s: resp: %#v\nerr: %v", op, path, resp, err)
+	}
+	return resp
+}
+
+func TestPki_MultipleIssuers(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	resp := issuersTestRequest(t, b, s, logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "root-2019.myvault.com",
+		"ttl":         "40h",
+		"issuer_name": "old",
+	})
+	oldID := resp.Data["issuer_id"].(string)
+	oldRoot := parseCert(t, resp.Data["certificate"].(string))
+
+	// The legacy endpoint refuses to replace the root
+	resp = issuersTestRequest(t, b, s, logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "other.myvault.com",
+	})
+	if len(resp.Warnings) == 0 || resp.Data != nil {
+		t.Fatalf("expected a warning, got %#v", resp)
+	}
+
+	resp = issuersTestRequest(t, b, s, logical.UpdateOperation, "issuers/generate/root/internal", map[string]interface{}{
+		"common_name": "root-2020.myvault.com",
+		"ttl":         "40h",
+		"issuer_name": "new",
+	})
+	newID := resp.Data["issuer_id"].(string)
+	newRoot := parseCert(t, resp.Data["certificate"].(string))
+
+	resp = issuersTestRequest(t, b, s, logical.ListOperation, "issuers/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 2 {
+		t.Fatalf("expected two issuers, got %v", keys)
+	}
+	keyInfo := resp.Data["key_info"].(map[string]interface{})
+	if !keyInfo[oldID].(map[string]interface{})["is_default"].(bool) {
+		t.Fatal("expected the first issuer to be the default")
+	}
+
+	// Names are unique and "default" is reserved
+	for _, name := range []string{"old", "default"} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issuer/new",
+			Storage:   s,
+			Data: map[string]interface{}{
+				"issuer_name": name,
+			},
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected an error naming an issuer %q, got %#v", name, resp)
+		}
+	}
+
+	// Roles sign with the default issuer unless told otherwise
+	issuersTestRequest(t, b, s, logical.UpdateOperation, "roles/default", map[string]interface{}{
+		"allowed_domains":  "myvault.com",
+		"allow_subdomains": true,
+	})
+	issuersTestRequest(t, b, s, logical.UpdateOperation, "roles/pinned", map[string]interface{}{
+		"allowed_domains":  "myvault.com",
+		"allow_subdomains": true,
+		"issuer_ref":       "new",
+	})
+	resp = issuersTestRequest(t, b, s, logical.ReadOperation, "roles/default", nil)
+	if resp.Data["issuer_ref"] != "default" {
+		t.Fatalf("bad issuer_ref: %v", resp.Data["issuer_ref"])
+	}
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/missing",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"issuer_ref": "nope",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for a role with an unknown issuer, got %#v", resp)
+	}
+
+	resp = issuersTestRequest(t, b, s, logical.UpdateOperation, "issue/default", map[string]interface{}{
+		"common_name": "a.myvault.com",
+	})
+	defaultLeaf := parseCert(t, resp.Data["certificate"].(string))
+	if err := defaultLeaf.CheckSignatureFrom(oldRoot); err != nil {
+		t.Fatalf("expected the default issuer to sign: %v", err)
+	}
+	resp = issuersTestRequest(t, b, s, logical.UpdateOperation, "issue/pinned", map[string]interface{}{
+		"common_name": "b.myvault.com",
+	})
+	pinnedLeaf := parseCert(t, resp.Data["certificate"].(string))
+	if err := pinnedLeaf.CheckSignatureFrom(newRoot); err != nil {
+		t.Fatalf("expected the role's issuer to sign: %v", err)
+	}
+
+	// Each issuer's CRL only lists the certificates it issued
+	issuersTestRequest(t, b, s, logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": certutil.GetHexFormatted(pinnedLeaf.SerialNumber.Bytes(), ":"),
+	})
+	checkCRL := func(ref string, issuer *x509.Certificate, revoked *x509.Certificate) {
+		t.Helper()
+
+		resp := issuersTestRequest(t, b, s, logical.ReadOperation, "crl/issuer/"+ref, nil)
+		crl, err := x509.ParseCRL(resp.Data[logical.HTTPRawBody].([]byte))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := issuer.CheckCRLSignature(crl); err != nil {
+			t.Fatalf("CRL for %s not signed by its issuer: %v", ref, err)
+		}
+		entries := crl.TBSCertList.RevokedCertificates
+		switch {
+		case revoked == nil && len(entries) != 0:
+			t.Fatalf("expected an empty CRL for %s, got %d entries", ref, len(entries))
+		case revoked != nil && (len(entries) != 1 || entries[0].SerialNumber.Cmp(revoked.SerialNumber) != 0):
+			t.Fatalf("expected the CRL for %s to list only %s", ref, revoked.SerialNumber)
+		}
+	}
+	checkCRL("old", oldRoot, nil)
+	checkCRL(newID, newRoot, pinnedLeaf)
+
+	// Switching the default changes what the legacy endpoints serve
+	issuersTestRequest(t, b, s, logical.UpdateOperation, "config/issuers", map[string]interface{}{
+		"default": "new",
+	})
+	resp = issuersTestRequest(t, b, s, logical.ReadOperation, "config/issuers", nil)
+	if resp.Data["default"] != newID {
+		t.Fatalf("bad default: %v", resp.Data["default"])
+	}
+	resp = issuersTestRequest(t, b, s, logical.ReadOperation, "ca", nil)
+	if caCert, err := x509.ParseCertificate(resp.Data[logical.HTTPRawBody].([]byte)); err != nil || !caCert.Equal(newRoot) {
+		t.Fatalf("expected the new default issuer from ca, err: %v", err)
+	}
+	resp = issuersTestRequest(t, b, s, logical.ReadOperation, "crl", nil)
+	crl, err := x509.ParseCRL(resp.Data[logical.HTTPRawBody].([]byte))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := newRoot.CheckCRLSignature(crl); err != nil {
+		t.Fatalf("expected the default CRL to be signed by the new issuer: %v", err)
+	}
+	resp = issuersTestRequest(t, b, s, logical.UpdateOperation, "issue/default", map[string]interface{}{
+		"common_name": "c.myvault.com",
+	})
+	if err := parseCert(t, resp.Data["certificate"].(string)).CheckSignatureFrom(newRoot); err != nil {
+		t.Fatalf("expected the new default issuer to sign: %v", err)
+	}
+
+	resp = issuersTestRequest(t, b, s, logical.ReadOperation, "issuer/default", nil)
+	if resp.Data["issuer_id"] != newID || !resp.Data["is_default"].(bool) {
+		t.Fatalf("bad default issuer: %#v", resp.Data)
+	}
+}
+
+func TestPki_CrossSignIssuer(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	resp := issuersTestRequest(t, b, s, logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "root-2019.myvault.com",
+		"ttl":         "40h",
+		"issuer_name": "old",
+	})
+	oldRoot := parseCert(t, resp.Data["certificate"].(string))
+	resp = issuersTestRequest(t, b, s, logical.UpdateOperation, "issuers/generate/root/internal", map[string]interface{}{
+		"common_name": "root-2020.myvault.com",
+		"ttl":         "40h",
+		"issuer_name": "new",
+	})
+	newRoot := parseCert(t, resp.Data["certificate"].(string))
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "issuer/new/cross-sign",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"signing_issuer_ref": "new",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error cross-signing an issuer with itself, got %#v", resp)
+	}
+
+	resp = issuersTestRequest(t, b, s, logical.UpdateOperation, "issuer/new/cross-sign", map[string]interface{}{
+		"signing_issuer_ref": "old",
+	})
+	crossSigned := parseCert(t, resp.Data["certificate"].(string))
+	if crossSigned.Subject.String() != newRoot.Subject.String() {
+		t.Fatalf("bad cross-signed subject: %s", crossSigned.Subject)
+	}
+	if err := crossSigned.CheckSignatureFrom(oldRoot); err != nil {
+		t.Fatal(err)
+	}
+
+	resp = issuersTestRequest(t, b, s, logical.ReadOperation, "issuer/new", nil)
+	if crossSignedPEMs := resp.Data["cross_signed"].([]string); len(crossSignedPEMs) != 1 {
+		t.Fatalf("expected one cross-signed certificate, got %d", len(crossSignedPEMs))
+	}
+
+	// Certificates from the new issuer carry the cross-signed certificate so
+	// clients that only trust the old root can still validate them
+	issuersTestRequest(t, b, s, logical.UpdateOperation, "roles/test", map[string]interface{}{
+		"allowed_domains":  "myvault.com",
+		"allow_subdomains": true,
+		"issuer_ref":       "new",
+	})
+	resp = issuersTestRequest(t, b, s, logical.UpdateOperation, "issue/test", map[string]interface{}{
+		"common_name": "a.myvault.com",
+	})
+	leaf := parseCert(t, resp.Data["certificate"].(string))
+	intermediates := x509.NewCertPool()
+	for _, caPEM := range resp.Data["ca_chain"].([]string) {
+		intermediates.AddCert(parseCert(t, caPEM))
+	}
+
+	for name, root := range map[string]*x509.Certificate{"old": oldRoot, "new": newRoot} {
+		roots := x509.NewCertPool()
+		roots.AddCert(root)
+		_, err := leaf.Verify(x509.VerifyOptions{
+			DNSName:       "a.myvault.com",
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			t.Fatalf("failed to verify against the %s root: %v", name, err)
+		}
+	}
+}
+
+func TestPki_LegacyCAMigration(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	resp := issuersTestRequest(t, b, s, logical.UpdateOperation, "root/generate/exported", map[string]interface{}{
+		"common_name": "myvault.com",
+	})
+	pemBundle := resp.Data["private_key"].(string) + "\n" + resp.Data["certificate"].(string)
+	parsedBundle, err := certutil.ParsePEMBundle(pemBundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb, err := parsedBundle.ToCertBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lay storage out the way it was before issuers existed
+	b, s = createBackendWithStorage(t)
+	entry, err := logical.StorageEntryJSON(legacyCABundleKey, cb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(context.Background(), entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Initialize(context.Background(), &logical.InitializationRequest{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err = s.Get(context.Background(), legacyCABundleKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry != nil {
+		t.Fatal("expected the legacy CA bundle to be migrated")
+	}
+
+	resp = issuersTestRequest(t, b, s, logical.ReadOperation, "issuer/default", nil)
+	if strings.TrimSpace(resp.Data["certificate"].(string)) != strings.TrimSpace(cb.Certificate) {
+		t.Fatal("expected the legacy CA to become the default issuer")
+	}
+	if resp.Data["issuer_name"] != "" {
+		t.Fatalf("bad issuer name: %v", resp.Data["issuer_name"])
+	}
+}
@@ -0,0 +1,255 @@
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestBackend_OCSP(t *testing.T) {
+	coreConfig := &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"pki": Factory,
+		},
+	}
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	client := cluster.Cores[0].Client
+	err := client.Sys().Mount("pki", &api.MountInput{
+		Type: "pki",
+		Config: api.MountConfigInput{
+			DefaultLeaseTTL: "16h",
+			MaxLeaseTTL:     "60h",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Logical().Write("pki/root/generate/internal", map[string]interface{}{
+		"ttl":         "40h",
+		"common_name": "myvault.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert := parseCert(t, resp.Data["certificate"].(string))
+
+	ocspURL := client.Address() + "/v1/pki/ocsp"
+	_, err = client.Logical().Write("pki/config/urls", map[string]interface{}{
+		"ocsp_servers": ocspURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Logical().Write("pki/roles/test", map[string]interface{}{
+		"allowed_domains":  "foobar.com",
+		"allow_subdomains": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func() *x509.Certificate {
+		resp, err := client.Logical().Write("pki/issue/test", map[string]interface{}{
+			"common_name": "test.foobar.com",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parseCert(t, resp.Data["certificate"].(string))
+	}
+
+	good := issue()
+	revoked := issue()
+
+	// Issued certificates must point clients at the responder
+	if len(good.OCSPServer) != 1 || good.OCSPServer[0] != ocspURL {
+		t.Fatalf("expected OCSP server %q in AIA, got %v", ocspURL, good.OCSPServer)
+	}
+
+	_, err = client.Logical().Write("pki/revoke", map[string]interface{}{
+		"serial_number": certutil.GetHexFormatted(revoked.SerialNumber.Bytes(), ":"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := func(cert *x509.Certificate, usePost bool) *ocsp.Response {
+		t.Helper()
+
+		der, err := ocsp.CreateRequest(cert, caCert, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var req *api.Request
+		if usePost {
+			req = client.NewRequest("POST", "/v1/pki/ocsp")
+			req.BodyBytes = der
+			if req.Headers == nil {
+				req.Headers = http.Header{}
+			}
+			req.Headers.Set("Content-Type", "application/ocsp-request")
+		} else {
+			req = client.NewRequest("GET", "/v1/pki/ocsp/"+url.PathEscape(base64.StdEncoding.EncodeToString(der)))
+		}
+
+		httpResp, err := client.RawRequest(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer httpResp.Body.Close()
+
+		if ct := httpResp.Header.Get("Content-Type"); ct != "application/ocsp-response" {
+			t.Fatalf("bad content type %q", ct)
+		}
+		body, err := ioutil.ReadAll(httpResp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ocspResp, err := ocsp.ParseResponseForCert(body, cert, caCert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ocspResp
+	}
+
+	for _, usePost := range []bool{false, true} {
+		ocspResp := query(good, usePost)
+		if ocspResp.Status != ocsp.Good {
+			t.Fatalf("expected good status, got %d", ocspResp.Status)
+		}
+		if ocspResp.NextUpdate.Sub(ocspResp.ThisUpdate) != defaultOCSPExpiry {
+			t.Fatalf("bad response validity: %s to %s", ocspResp.ThisUpdate, ocspResp.NextUpdate)
+		}
+
+		ocspResp = query(revoked, usePost)
+		if ocspResp.Status != ocsp.Revoked {
+			t.Fatalf("expected revoked status, got %d", ocspResp.Status)
+		}
+		if ocspResp.RevokedAt.IsZero() {
+			t.Fatal("expected a revocation time")
+		}
+	}
+
+	// Certificates from another CA are not ours to answer for
+	otherCA, err := x509.ParseCertificate(caCert.Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCA.RawSubject = []byte("not the issuer")
+	der, err := ocsp.CreateRequest(good, otherCA, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpResp, err := client.RawRequest(client.NewRequest("GET", "/v1/pki/ocsp/"+url.PathEscape(base64.StdEncoding.EncodeToString(der))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(httpResp.Body)
+	httpResp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ocsp.ParseResponse(body, nil); err != (ocsp.ResponseError{Status: ocsp.Unauthorized}) {
+		t.Fatalf("expected unauthorized response, got %v", err)
+	}
+
+	// Disabling the responder must stop it from vouching for certificates
+	_, err = client.Logical().Write("pki/config/crl", map[string]interface{}{
+		"ocsp_disable": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err = ocsp.CreateRequest(good, caCert, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpResp, err = client.RawRequest(client.NewRequest("GET", "/v1/pki/ocsp/"+url.PathEscape(base64.StdEncoding.EncodeToString(der))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err = ioutil.ReadAll(httpResp.Body)
+	httpResp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ocsp.ParseResponse(body, nil); err != (ocsp.ResponseError{Status: ocsp.Unauthorized}) {
+		t.Fatalf("expected unauthorized response, got %v", err)
+	}
+}
+
+func parseCert(t *testing.T, pemCert string) *x509.Certificate {
+	t.Helper()
+
+	block, _ := pem.Decode([]byte(pemCert))
+	if block == nil {
+		t.Fatal("failed to decode certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// failingListStorage fails listing, so that looking up the issuers fails with
+// an error that is neither a user nor an internal error.
+type failingListStorage struct {
+	logical.Storage
+}
+
+func (s *failingListStorage) List(context.Context, string) ([]string, error) {
+	return nil, errors.New("list failed")
+}
+
+func TestBackend_OCSP_IssuerLookupError(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "root/generate/internal",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"common_name": "myvault.com",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	caCert := parseCert(t, resp.Data["certificate"].(string))
+
+	der, err := ocsp.CreateRequest(caCert, caCert, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = b.answerOCSP(context.Background(), &logical.Request{Storage: &failingListStorage{s}}, der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := resp.Data[logical.HTTPRawBody].([]byte)
+	if _, err := ocsp.ParseResponse(body, nil); err != (ocsp.ResponseError{Status: ocsp.InternalError}) {
+		t.Fatalf("expected internal error response, got %v", err)
+	}
+}
@@ -0,0 +1,1232 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const (
+	acmeContentTypeJSON    = "application/json"
+	acmeContentTypeProblem = "application/problem+json"
+	acmeContentTypePEM     = "application/pem-certificate-chain"
+)
+
+// acmeContext carries the per-request ACME configuration: the role orders
+// are placed against and the URLs the client sees
+type acmeContext struct {
+	config   *acmeConfig
+	roleName string
+	role     *roleEntry
+
+	// baseURL is the URL of the directory the client is using, without
+	// the trailing "/directory"
+	baseURL string
+
+	// requestURL is the full URL of the current request, which must match
+	// the "url" header of the JWS
+	requestURL string
+}
+
+func (ac *acmeContext) accountURL(id string) string {
+	return ac.baseURL + "/account/" + id
+}
+
+func (ac *acmeContext) orderURL(id string) string {
+	return ac.baseURL + "/order/" + id
+}
+
+func (ac *acmeContext) authorizationURL(id string) string {
+	return ac.baseURL + "/authorization/" + id
+}
+
+func (ac *acmeContext) challengeURL(authzID, challType string) string {
+	return ac.baseURL + "/challenge/" + authzID + "/" + challType
+}
+
+// acmeResponse is the result of an ACME operation. Body is encoded as JSON
+// unless it is a []byte, in which case it is sent verbatim with the given
+// content type.
+type acmeResponse struct {
+	status      int
+	body        interface{}
+	contentType string
+	location    string
+	links       []string
+}
+
+type acmeOperation func(context.Context, *logical.Request, *framework.FieldData, *acmeContext, *acmeRequest) (*acmeResponse, *acmeError)
+
+func acmePattern(suffix string) string {
+	return "acme/(roles/" + framework.GenericNameRegex("role") + "/)?" + suffix
+}
+
+func acmeFields(extra map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields := map[string]*framework.FieldSchema{
+		"role": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: `The role to place orders against. Defaults to the configured default_role.`,
+		},
+		"protected": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: `The protected header of the flattened JWS.`,
+		},
+		"payload": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: `The payload of the flattened JWS.`,
+		},
+		"signature": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: `The signature of the flattened JWS.`,
+		},
+	}
+	for k, v := range extra {
+		fields[k] = v
+	}
+	return fields
+}
+
+func pathsACME(b *backend) []*framework.Path {
+	idField := func(description string) map[string]*framework.FieldSchema {
+		return map[string]*framework.FieldSchema{
+			"id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: description,
+			},
+		}
+	}
+
+	return []*framework.Path{
+		{
+			Pattern: acmePattern("directory"),
+			Fields:  acmeFields(nil),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.acmeWrapper(acmeKeyNone, b.acmeDirectory),
+			},
+			HelpSynopsis:    pathACMEHelpSyn,
+			HelpDescription: pathACMEHelpDesc,
+		},
+		{
+			Pattern: acmePattern("new-nonce"),
+			Fields:  acmeFields(nil),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.acmeWrapper(acmeKeyNone, b.acmeNewNonce(http.StatusNoContent)),
+				logical.HeaderOperation: b.acmeWrapper(acmeKeyNone, b.acmeNewNonce(http.StatusOK)),
+			},
+			HelpSynopsis:    pathACMEHelpSyn,
+			HelpDescription: pathACMEHelpDesc,
+		},
+		{
+			Pattern: acmePattern("new-account"),
+			Fields:  acmeFields(nil),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.acmeWrapper(acmeKeyJWK, b.acmeNewAccount),
+			},
+			HelpSynopsis:    pathACMEHelpSyn,
+			HelpDescription: pathACMEHelpDesc,
+		},
+		{
+			Pattern: acmePattern("account/" + framework.GenericNameRegex("id")),
+			Fields:  acmeFields(idField("The ID of the account.")),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.acmeWrapper(acmeKeyAccount, b.acmeAccountUpdate),
+			},
+			HelpSynopsis:    pathACMEHelpSyn,
+			HelpDescription: pathACMEHelpDesc,
+		},
+		{
+			Pattern: acmePattern("account/" + framework.GenericNameRegex("id") + "/orders"),
+			Fields:  acmeFields(idField("The ID of the account.")),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.acmeWrapper(acmeKeyAccount, b.acmeAccountOrders),
+			},
+			HelpSynopsis:    pathACMEHelpSyn,
+			HelpDescription: pathACMEHelpDesc,
+		},
+		{
+			Pattern: acmePattern("key-change"),
+			Fields:  acmeFields(nil),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.acmeWrapper(acmeKeyAccount, b.acmeKeyChange),
+			},
+			HelpSynopsis:    pathACMEHelpSyn,
+			HelpDescription: pathACMEHelpDesc,
+		},
+		{
+			Pattern: acmePattern("new-order"),
+			Fields:  acmeFields(nil),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.acmeWrapper(acmeKeyAccount, b.acmeNewOrder),
+			},
+			HelpSynopsis:    pathACMEHelpSyn,
+			HelpDescription: pathACMEHelpDesc,
+		},
+		{
+			Pattern: acmePattern("order/" + framework.GenericNameRegex("id")),
+			Fields:  acmeFields(idField("The ID of the order.")),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.acmeWrapper(acmeKeyAccount, b.acmeOrderRead),
+			},
+			HelpSynopsis:    pathACMEHelpSyn,
+			HelpDescription: pathACMEHelpDesc,
+		},
+		{
+			Pattern: acmePattern("order/" + framework.GenericNameRegex("id") + "/finalize"),
+			Fields:  acmeFields(idField("The ID of the order.")),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.acmeWrapper(acmeKeyAccount, b.acmeOrderFinalize),
+			},
+			HelpSynopsis:    pathACMEHelpSyn,
+			HelpDescription: pathACMEHelpDesc,
+		},
+		{
+			Pattern: acmePattern("order/" + framework.GenericNameRegex("id") + "/cert"),
+			Fields:  acmeFields(idField("The ID of the order.")),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.acmeWrapper(acmeKeyAccount, b.acmeOrderCert),
+			},
+			HelpSynopsis:    pathACMEHelpSyn,
+			HelpDescription: pathACMEHelpDesc,
+		},
+		{
+			Pattern: acmePattern("authorization/" + framework.GenericNameRegex("id")),
+			Fields:  acmeFields(idField("The ID of the authorization.")),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.acmeWrapper(acmeKeyAccount, b.acmeAuthorizationUpdate),
+			},
+			HelpSynopsis:    pathACMEHelpSyn,
+			HelpDescription: pathACMEHelpDesc,
+		},
+		{
+			Pattern: acmePattern("challenge/" + framework.GenericNameRegex("id") + "/(?P<type>http-01|dns-01)"),
+			Fields: acmeFields(map[string]*framework.FieldSchema{
+				"id": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The ID of the authorization the challenge belongs to.",
+				},
+				"type": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The challenge type.",
+				},
+			}),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.acmeWrapper(acmeKeyAccount, b.acmeChallengeRespond),
+			},
+			HelpSynopsis:    pathACMEHelpSyn,
+			HelpDescription: pathACMEHelpDesc,
+		},
+		{
+			Pattern: acmePattern("revoke-cert"),
+			Fields:  acmeFields(nil),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.acmeWrapper(acmeKeyAny, b.acmeRevokeCert),
+			},
+			HelpSynopsis:    pathACMEHelpSyn,
+			HelpDescription: pathACMEHelpDesc,
+		},
+	}
+}
+
+// acmeWrapper resolves the ACME context of a request, verifies its JWS as
+// required by mode and renders the outcome of op as a raw HTTP response
+func (b *backend) acmeWrapper(mode acmeKeyMode, op acmeOperation) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		ac, acmeErr, err := b.acmeContextFor(ctx, req, data)
+		if err != nil {
+			return nil, err
+		}
+
+		var resp *acmeResponse
+		if acmeErr == nil {
+			var ar *acmeRequest
+			if mode != acmeKeyNone {
+				ar, acmeErr = b.verifyACMERequest(ctx, req, data, ac, mode)
+			}
+			if acmeErr == nil {
+				resp, acmeErr = op(ctx, req, data, ac, ar)
+			}
+		}
+
+		return b.acmeLogicalResponse(ac, resp, acmeErr)
+	}
+}
+
+func (b *backend) acmeContextFor(ctx context.Context, req *logical.Request, data *framework.FieldData) (*acmeContext, *acmeError, error) {
+	config, err := b.acmeConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, nil, err
+	}
+	ac := &acmeContext{
+		config:     config,
+		baseURL:    config.BaseURL + "/acme",
+		requestURL: config.BaseURL + "/" + req.Path,
+	}
+
+	if !config.Enabled {
+		return ac, acmeUnauthorized("ACME is not enabled on this mount"), nil
+	}
+
+	ac.roleName = data.Get("role").(string)
+	if ac.roleName != "" {
+		ac.baseURL += "/roles/" + ac.roleName
+	} else {
+		ac.roleName = config.DefaultRole
+	}
+	if ac.roleName == "" {
+		return ac, acmeMalformed("no role specified and no default role configured"), nil
+	}
+	if !config.roleAllowed(ac.roleName) {
+		return ac, acmeUnauthorized("role %q may not be used through ACME", ac.roleName), nil
+	}
+
+	ac.role, err = b.getRole(ctx, req.Storage, ac.roleName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ac.role == nil {
+		return ac, acmeNotFound("unknown role %q", ac.roleName), nil
+	}
+
+	return ac, nil, nil
+}
+
+func (b *backend) acmeLogicalResponse(ac *acmeContext, resp *acmeResponse, acmeErr *acmeError) (*logical.Response, error) {
+	if acmeErr != nil {
+		resp = &acmeResponse{
+			status:      acmeErr.Status,
+			body:        acmeErr,
+			contentType: acmeContentTypeProblem,
+		}
+	}
+
+	var body []byte
+	switch resp.body.(type) {
+	case nil:
+	case []byte:
+		body = resp.body.([]byte)
+	default:
+		var err error
+		body, err = json.Marshal(resp.body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	contentType := resp.contentType
+	if contentType == "" {
+		contentType = acmeContentTypeJSON
+	}
+
+	nonce, err := b.acmeNonces.issue()
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string][]string{
+		"Replay-Nonce": []string{nonce},
+		"Link":         []string{fmt.Sprintf(`<%s/directory>;rel="index"`, ac.baseURL)},
+	}
+	for _, link := range resp.links {
+		headers["Link"] = append(headers["Link"], link)
+	}
+	if resp.location != "" {
+		headers["Location"] = []string{resp.location}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:      resp.status,
+			logical.HTTPContentType:     contentType,
+			logical.HTTPRawBody:         body,
+			logical.HTTPRawCacheControl: "no-store",
+		},
+		Headers: headers,
+	}, nil
+}
+
+func (b *backend) acmeDirectory(ctx context.Context, req *logical.Request, data *framework.FieldData, ac *acmeContext, ar *acmeRequest) (*acmeResponse, *acmeError) {
+	return &acmeResponse{
+		status: http.StatusOK,
+		body: map[string]interface{}{
+			"newNonce":   ac.baseURL + "/new-nonce",
+			"newAccount": ac.baseURL + "/new-account",
+			"newOrder":   ac.baseURL + "/new-order",
+			"revokeCert": ac.baseURL + "/revoke-cert",
+			"keyChange":  ac.baseURL + "/key-change",
+			"meta": map[string]interface{}{
+				"externalAccountRequired": false,
+			},
+		},
+	}, nil
+}
+
+// acmeNewNonce returns an empty response; every ACME response carries a
+// fresh nonce
+func (b *backend) acmeNewNonce(status int) acmeOperation {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData, ac *acmeContext, ar *acmeRequest) (*acmeResponse, *acmeError) {
+		return &acmeResponse{
+			status: status,
+		}, nil
+	}
+}
+
+func (b *backend) acmeAccountObject(ac *acmeContext, account *acmeAccount) map[string]interface{} {
+	contact := account.Contact
+	if contact == nil {
+		contact = []string{}
+	}
+	return map[string]interface{}{
+		"status":  account.Status,
+		"contact": contact,
+		"orders":  ac.accountURL(account.ID) + "/orders",
+	}
+}
+
+func validateACMEContacts(contacts []string) *acmeError {
+	for _, contact := range contacts {
+		if !strings.HasPrefix(contact, "mailto:") {
+			return newACMEError("unsupportedContact", http.StatusBadRequest, "unsupported contact %q", contact)
+		}
+		if strings.ContainsAny(contact, ",?") {
+			return newACMEError("invalidContact", http.StatusBadRequest, "invalid contact %q", contact)
+		}
+	}
+	return nil
+}
+
+func (b *backend) acmeNewAccount(ctx context.Context, req *logical.Request, data *framework.FieldData, ac *acmeContext, ar *acmeRequest) (*acmeResponse, *acmeError) {
+	var payload struct {
+		Contact              []string `json:"contact"`
+		TermsOfServiceAgreed bool     `json:"termsOfServiceAgreed"`
+		OnlyReturnExisting   bool     `json:"onlyReturnExisting"`
+	}
+	if acmeErr := ar.decodePayload(&payload); acmeErr != nil {
+		return nil, acmeErr
+	}
+
+	thumbprint, err := ar.jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, newACMEError("badPublicKey", http.StatusBadRequest, "failed to compute key thumbprint: %s", err)
+	}
+	encodedThumbprint := base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	account, err := getACMEAccountByThumbprint(ctx, req.Storage, encodedThumbprint)
+	if err != nil {
+		return nil, acmeServerInternal("failed to look up account: %s", err)
+	}
+	if account != nil {
+		return &acmeResponse{
+			status:   http.StatusOK,
+			body:     b.acmeAccountObject(ac, account),
+			location: ac.accountURL(account.ID),
+		}, nil
+	}
+	if payload.OnlyReturnExisting {
+		return nil, newACMEError("accountDoesNotExist", http.StatusBadRequest, "no account exists for this key")
+	}
+
+	if acmeErr := validateACMEContacts(payload.Contact); acmeErr != nil {
+		return nil, acmeErr
+	}
+
+	jwk, err := ar.jwk.MarshalJSON()
+	if err != nil {
+		return nil, acmeServerInternal("failed to encode account key: %s", err)
+	}
+	id, err := newACMEID()
+	if err != nil {
+		return nil, acmeServerInternal("failed to generate account ID: %s", err)
+	}
+
+	account = &acmeAccount{
+		ID:         id,
+		Status:     acmeStatusValid,
+		Contact:    payload.Contact,
+		JWK:        jwk,
+		Thumbprint: encodedThumbprint,
+		CreatedAt:  time.Now(),
+	}
+	if err := putACMEAccount(ctx, req.Storage, account); err != nil {
+		return nil, acmeServerInternal("failed to store account: %s", err)
+	}
+
+	return &acmeResponse{
+		status:   http.StatusCreated,
+		body:     b.acmeAccountObject(ac, account),
+		location: ac.accountURL(account.ID),
+	}, nil
+}
+
+func (b *backend) acmeAccountUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData, ac *acmeContext, ar *acmeRequest) (*acmeResponse, *acmeError) {
+	if ar.account.ID != data.Get("id").(string) {
+		return nil, acmeUnauthorized("account does not match the request signer")
+	}
+
+	if ar.postAsGet() {
+		return &acmeResponse{
+			status: http.StatusOK,
+			body:   b.acmeAccountObject(ac, ar.account),
+		}, nil
+	}
+
+	var payload struct {
+		Contact []string `json:"contact"`
+		Status  string   `json:"status"`
+	}
+	if acmeErr := ar.decodePayload(&payload); acmeErr != nil {
+		return nil, acmeErr
+	}
+
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	account := ar.account
+	switch payload.Status {
+	case "":
+	case acmeStatusDeactivated:
+		account.Status = acmeStatusDeactivated
+	default:
+		return nil, acmeMalformed("accounts may only be deactivated")
+	}
+	if payload.Contact != nil {
+		if acmeErr := validateACMEContacts(payload.Contact); acmeErr != nil {
+			return nil, acmeErr
+		}
+		account.Contact = payload.Contact
+	}
+
+	if err := putACMEAccount(ctx, req.Storage, account); err != nil {
+		return nil, acmeServerInternal("failed to store account: %s", err)
+	}
+
+	return &acmeResponse{
+		status: http.StatusOK,
+		body:   b.acmeAccountObject(ac, account),
+	}, nil
+}
+
+func (b *backend) acmeAccountOrders(ctx context.Context, req *logical.Request, data *framework.FieldData, ac *acmeContext, ar *acmeRequest) (*acmeResponse, *acmeError) {
+	if ar.account.ID != data.Get("id").(string) {
+		return nil, acmeUnauthorized("account does not match the request signer")
+	}
+
+	orders := []string{}
+	for _, id := range ar.account.OrderIDs {
+		orders = append(orders, ac.orderURL(id))
+	}
+
+	return &acmeResponse{
+		status: http.StatusOK,
+		body: map[string]interface{}{
+			"orders": orders,
+		},
+	}, nil
+}
+
+// acmeKeyChange rolls an account over to a new key as described in section
+// 7.3.5 of RFC 8555
+func (b *backend) acmeKeyChange(ctx context.Context, req *logical.Request, data *framework.FieldData, ac *acmeContext, ar *acmeRequest) (*acmeResponse, *acmeError) {
+	inner, err := jose.ParseSigned(string(ar.payload))
+	if err != nil {
+		return nil, acmeMalformed("failed to parse inner JWS: %s", err)
+	}
+	if len(inner.Signatures) != 1 {
+		return nil, acmeMalformed("inner JWS must carry exactly one signature")
+	}
+	header := inner.Signatures[0].Protected
+	if !acmeSignatureAlgorithms[header.Algorithm] {
+		return nil, newACMEError("badSignatureAlgorithm", http.StatusBadRequest, "unsupported signature algorithm %q", header.Algorithm)
+	}
+	if header.JSONWebKey == nil || !header.JSONWebKey.Valid() || !header.JSONWebKey.IsPublic() {
+		return nil, acmeMalformed("inner JWS must carry a jwk header with a public key")
+	}
+	if url, _ := header.ExtraHeaders[jose.HeaderKey("url")].(string); url != ac.requestURL {
+		return nil, acmeMalformed("inner JWS url header does not match the request URL")
+	}
+
+	innerPayload, err := inner.Verify(header.JSONWebKey)
+	if err != nil {
+		return nil, acmeMalformed("inner JWS signature verification failed")
+	}
+
+	var payload struct {
+		Account string          `json:"account"`
+		OldKey  jose.JSONWebKey `json:"oldKey"`
+	}
+	if err := json.Unmarshal(innerPayload, &payload); err != nil {
+		return nil, acmeMalformed("failed to decode inner JWS payload: %s", err)
+	}
+	if acmeAccountIDFromURL(payload.Account) != ar.account.ID {
+		return nil, acmeMalformed("inner JWS account does not match the request signer")
+	}
+
+	oldThumbprint, err := payload.OldKey.Thumbprint(crypto.SHA256)
+	if err != nil || base64.RawURLEncoding.EncodeToString(oldThumbprint) != ar.account.Thumbprint {
+		return nil, acmeMalformed("oldKey does not match the current account key")
+	}
+
+	newThumbprint, err := header.JSONWebKey.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, newACMEError("badPublicKey", http.StatusBadRequest, "failed to compute key thumbprint: %s", err)
+	}
+	encodedThumbprint := base64.RawURLEncoding.EncodeToString(newThumbprint)
+
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	existing, err := getACMEAccountByThumbprint(ctx, req.Storage, encodedThumbprint)
+	if err != nil {
+		return nil, acmeServerInternal("failed to look up account: %s", err)
+	}
+	if existing != nil {
+		conflict := acmeMalformed("the new key is already in use by another account")
+		conflict.Status = http.StatusConflict
+		return &acmeResponse{
+			status:      http.StatusConflict,
+			body:        conflict,
+			contentType: acmeContentTypeProblem,
+			location:    ac.accountURL(existing.ID),
+		}, nil
+	}
+
+	jwk, err := header.JSONWebKey.MarshalJSON()
+	if err != nil {
+		return nil, acmeServerInternal("failed to encode account key: %s", err)
+	}
+
+	account := ar.account
+	oldIndex := acmeAccountThumbprintPrefix + account.Thumbprint
+	account.JWK = jwk
+	account.Thumbprint = encodedThumbprint
+	if err := putACMEAccount(ctx, req.Storage, account); err != nil {
+		return nil, acmeServerInternal("failed to store account: %s", err)
+	}
+	if err := req.Storage.Delete(ctx, oldIndex); err != nil {
+		return nil, acmeServerInternal("failed to remove old key index: %s", err)
+	}
+
+	return &acmeResponse{
+		status: http.StatusOK,
+		body:   b.acmeAccountObject(ac, account),
+	}, nil
+}
+
+func (b *backend) acmeOrderObject(ac *acmeContext, order *acmeOrder) map[string]interface{} {
+	authorizations := make([]string, 0, len(order.AuthorizationIDs))
+	for _, id := range order.AuthorizationIDs {
+		authorizations = append(authorizations, ac.authorizationURL(id))
+	}
+
+	ret := map[string]interface{}{
+		"status":         order.Status,
+		"expires":        order.Expires.Format(time.RFC3339),
+		"identifiers":    order.Identifiers,
+		"authorizations": authorizations,
+		"finalize":       ac.orderURL(order.ID) + "/finalize",
+	}
+	if order.Status == acmeStatusValid {
+		ret["certificate"] = ac.orderURL(order.ID) + "/cert"
+	}
+
+	return ret
+}
+
+func newACMEToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func (b *backend) acmeNewOrder(ctx context.Context, req *logical.Request, data *framework.FieldData, ac *acmeContext, ar *acmeRequest) (*acmeResponse, *acmeError) {
+	var payload struct {
+		Identifiers []acmeIdentifier `json:"identifiers"`
+		NotBefore   string           `json:"notBefore"`
+		NotAfter    string           `json:"notAfter"`
+	}
+	if acmeErr := ar.decodePayload(&payload); acmeErr != nil {
+		return nil, acmeErr
+	}
+
+	if payload.NotBefore != "" || payload.NotAfter != "" {
+		return nil, acmeMalformed("notBefore and notAfter are not supported; validity is governed by the role")
+	}
+	if len(payload.Identifiers) == 0 {
+		return nil, acmeMalformed("at least one identifier is required")
+	}
+
+	var names []string
+	for _, identifier := range payload.Identifiers {
+		if identifier.Type != "dns" {
+			return nil, newACMEError("unsupportedIdentifier", http.StatusBadRequest, "unsupported identifier type %q", identifier.Type)
+		}
+		name := strings.ToLower(strings.TrimSpace(identifier.Value))
+		if name == "" {
+			return nil, acmeMalformed("identifier values must not be empty")
+		}
+		names = append(names, name)
+	}
+	names = strutil.RemoveDuplicates(names, false)
+
+	if badName := validateNames(&inputBundle{role: ac.role, req: req}, names); badName != "" {
+		return nil, newACMEError("rejectedIdentifier", http.StatusBadRequest, "name %q is not allowed by role %q", badName, ac.roleName)
+	}
+
+	orderID, err := newACMEID()
+	if err != nil {
+		return nil, acmeServerInternal("failed to generate order ID: %s", err)
+	}
+	order := &acmeOrder{
+		ID:        orderID,
+		AccountID: ar.account.ID,
+		Role:      ac.roleName,
+		Status:    acmeStatusPending,
+		Expires:   time.Now().Add(acmeOrderLifetime),
+	}
+
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	for _, name := range names {
+		authz := &acmeAuthorization{
+			AccountID: ar.account.ID,
+			OrderID:   order.ID,
+			Identifier: acmeIdentifier{
+				Type:  "dns",
+				Value: strings.TrimPrefix(name, "*."),
+			},
+			Wildcard: strings.HasPrefix(name, "*."),
+			Status:   acmeStatusPending,
+			Expires:  order.Expires,
+		}
+		authz.ID, err = newACMEID()
+		if err != nil {
+			return nil, acmeServerInternal("failed to generate authorization ID: %s", err)
+		}
+
+		challTypes := []string{acmeChallengeHTTP01, acmeChallengeDNS01}
+		if authz.Wildcard {
+			// Wildcard names can only be proven through DNS
+			challTypes = []string{acmeChallengeDNS01}
+		}
+		for _, challType := range challTypes {
+			token, err := newACMEToken()
+			if err != nil {
+				return nil, acmeServerInternal("failed to generate challenge token: %s", err)
+			}
+			authz.Challenges = append(authz.Challenges, &acmeChallenge{
+				Type:   challType,
+				Token:  token,
+				Status: acmeStatusPending,
+			})
+		}
+
+		if err := putACMEAuthorization(ctx, req.Storage, authz); err != nil {
+			return nil, acmeServerInternal("failed to store authorization: %s", err)
+		}
+
+		order.Identifiers = append(order.Identifiers, acmeIdentifier{Type: "dns", Value: name})
+		order.AuthorizationIDs = append(order.AuthorizationIDs, authz.ID)
+	}
+
+	if err := putACMEOrder(ctx, req.Storage, order); err != nil {
+		return nil, acmeServerInternal("failed to store order: %s", err)
+	}
+
+	account := ar.account
+	account.OrderIDs = append(account.OrderIDs, order.ID)
+	if err := putACMEAccount(ctx, req.Storage, account); err != nil {
+		return nil, acmeServerInternal("failed to store account: %s", err)
+	}
+
+	return &acmeResponse{
+		status:   http.StatusCreated,
+		body:     b.acmeOrderObject(ac, order),
+		location: ac.orderURL(order.ID),
+	}, nil
+}
+
+// acmeLoadOrder fetches the order named in the request, ensuring it belongs
+// to the signing account and refreshing its status. The caller must hold
+// acmeLock.
+func (b *backend) acmeLoadOrder(ctx context.Context, req *logical.Request, data *framework.FieldData, ac *acmeContext, ar *acmeRequest) (*acmeOrder, *acmeError) {
+	order, err := getACMEOrder(ctx, req.Storage, data.Get("id").(string))
+	if err != nil {
+		return nil, acmeServerInternal("failed to load order: %s", err)
+	}
+	if order == nil || order.Role != ac.roleName {
+		return nil, acmeNotFound("order not found")
+	}
+	if order.AccountID != ar.account.ID {
+		return nil, acmeUnauthorized("order does not belong to the request signer")
+	}
+
+	changed, err := order.refreshStatus(ctx, req.Storage)
+	if err != nil {
+		return nil, acmeServerInternal("failed to refresh order: %s", err)
+	}
+	if changed {
+		if err := putACMEOrder(ctx, req.Storage, order); err != nil {
+			return nil, acmeServerInternal("failed to store order: %s", err)
+		}
+	}
+
+	return order, nil
+}
+
+func (b *backend) acmeOrderRead(ctx context.Context, req *logical.Request, data *framework.FieldData, ac *acmeContext, ar *acmeRequest) (*acmeResponse, *acmeError) {
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	order, acmeErr := b.acmeLoadOrder(ctx, req, data, ac, ar)
+	if acmeErr != nil {
+		return nil, acmeErr
+	}
+
+	return &acmeResponse{
+		status: http.StatusOK,
+		body:   b.acmeOrderObject(ac, order),
+	}, nil
+}
+
+func (b *backend) acmeOrderFinalize(ctx context.Context, req *logical.Request, data *framework.FieldData, ac *acmeContext, ar *acmeRequest) (*acmeResponse, *acmeError) {
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+	if acmeErr := ar.decodePayload(&payload); acmeErr != nil {
+		return nil, acmeErr
+	}
+	csrBytes, err := base64.RawURLEncoding.DecodeString(payload.CSR)
+	if err != nil {
+		return nil, newACMEError("badCSR", http.StatusBadRequest, "failed to decode CSR: %s", err)
+	}
+	csr, err := x509.ParseCertificateRequest(csrBytes)
+	if err != nil {
+		return nil, newACMEError("badCSR", http.StatusBadRequest, "failed to parse CSR: %s", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, newACMEError("badCSR", http.StatusBadRequest, "invalid CSR signature: %s", err)
+	}
+
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	order, acmeErr := b.acmeLoadOrder(ctx, req, data, ac, ar)
+	if acmeErr != nil {
+		return nil, acmeErr
+	}
+	if order.Status != acmeStatusReady {
+		return nil, newACMEError("orderNotReady", http.StatusForbidden, "order is %s", order.Status)
+	}
+
+	if len(csr.IPAddresses) > 0 || len(csr.EmailAddresses) > 0 || len(csr.URIs) > 0 {
+		return nil, newACMEError("badCSR", http.StatusBadRequest, "CSR may only contain DNS names")
+	}
+	csrNames := csr.DNSNames
+	if csr.Subject.CommonName != "" {
+		csrNames = append(csrNames, strings.ToLower(csr.Subject.CommonName))
+	}
+	csrNames = strutil.ParseDedupLowercaseAndSortStrings(strings.Join(csrNames, ","), ",")
+	var orderNames []string
+	for _, identifier := range order.Identifiers {
+		orderNames = append(orderNames, identifier.Value)
+	}
+	sort.Strings(orderNames)
+	if !strutil.EquivalentSlices(csrNames, orderNames) {
+		return nil, newACMEError("badCSR", http.StatusBadRequest, "CSR names %v do not match the order identifiers %v", csrNames, orderNames)
+	}
+
+	issuer, signingBundle, err := b.fetchIssuerCAInfo(ctx, req, ac.role.Issuer)
+	if err != nil {
+		return nil, acmeServerInternal("could not fetch the CA certificate: %s", err)
+	}
+
+	// Names have been validated against the order, so take them from the
+	// CSR regardless of how the role treats CSRs for the sign endpoint
+	role := *ac.role
+	role.UseCSRCommonName = true
+	role.UseCSRSANs = true
+	role.RequireCN = false
+
+	csrPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE REQUEST",
+		Bytes: csrBytes,
+	})
+	input := &inputBundle{
+		role: &role,
+		req:  req,
+		apiData: &framework.FieldData{
+			Raw: map[string]interface{}{
+				"csr": string(csrPEM),
+			},
+			Schema: pathSign(b).Fields,
+		},
+	}
+	parsedBundle, err := signCert(b, input, signingBundle, false, true)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return nil, newACMEError("badCSR", http.StatusBadRequest, "%s", err)
+		default:
+			return nil, acmeServerInternal("failed to sign certificate: %s", err)
+		}
+	}
+
+	// ACME issued certificates are always stored, regardless of no_store,
+	// as clients may revoke them later
+	serial := normalizeSerial(certutil.GetHexFormatted(parsedBundle.Certificate.SerialNumber.Bytes(), ":"))
+	err = req.Storage.Put(ctx, &logical.StorageEntry{
+		Key:   "certs/" + serial,
+		Value: parsedBundle.CertificateBytes,
+	})
+	if err != nil {
+		return nil, acmeServerInternal("unable to store certificate: %s", err)
+	}
+	err = putACMEEntry(ctx, req.Storage, acmeCertPrefix+serial, &acmeCertOwner{
+		AccountID:   ar.account.ID,
+		IssuerID:    issuer.ID,
+		Certificate: parsedBundle.CertificateBytes,
+	})
+	if err != nil {
+		return nil, acmeServerInternal("unable to store certificate: %s", err)
+	}
+
+	order.Status = acmeStatusValid
+	order.CertSerial = serial
+	if err := putACMEOrder(ctx, req.Storage, order); err != nil {
+		return nil, acmeServerInternal("failed to store order: %s", err)
+	}
+
+	return &acmeResponse{
+		status:   http.StatusOK,
+		body:     b.acmeOrderObject(ac, order),
+		location: ac.orderURL(order.ID),
+	}, nil
+}
+
+func (b *backend) acmeOrderCert(ctx context.Context, req *logical.Request, data *framework.FieldData, ac *acmeContext, ar *acmeRequest) (*acmeResponse, *acmeError) {
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	order, acmeErr := b.acmeLoadOrder(ctx, req, data, ac, ar)
+	if acmeErr != nil {
+		return nil, acmeErr
+	}
+	if order.Status != acmeStatusValid {
+		return nil, acmeNotFound("order is %s and has no certificate", order.Status)
+	}
+
+	var owner acmeCertOwner
+	found, err := getACMEEntry(ctx, req.Storage, acmeCertPrefix+order.CertSerial, &owner)
+	if err != nil {
+		return nil, acmeServerInternal("failed to load certificate: %s", err)
+	}
+	if !found {
+		return nil, acmeNotFound("certificate not found")
+	}
+
+	issuer, signingBundle, err := b.fetchIssuerCAInfo(ctx, req, owner.IssuerID)
+	if err != nil {
+		return nil, acmeServerInternal("could not fetch the CA certificate: %s", err)
+	}
+	caChain := signingBundle.GetCAChain()
+	crossSigned, err := issuer.crossSignedBlocks()
+	if err != nil {
+		return nil, acmeServerInternal("could not fetch the CA certificate: %s", err)
+	}
+	caChain = append(caChain, crossSigned...)
+
+	var chain bytes.Buffer
+	pem.Encode(&chain, &pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: owner.Certificate,
+	})
+	for _, ca := range caChain {
+		pem.Encode(&chain, &pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: ca.Bytes,
+		})
+	}
+
+	return &acmeResponse{
+		status:      http.StatusOK,
+		body:        chain.Bytes(),
+		contentType: acmeContentTypePEM,
+	}, nil
+}
+
+func (b *backend) acmeAuthorizationObject(ac *acmeContext, authz *acmeAuthorization) map[string]interface{} {
+	challenges := make([]interface{}, 0, len(authz.Challenges))
+	for _, chall := range authz.Challenges {
+		challenges = append(challenges, b.acmeChallengeObject(ac, authz, chall))
+	}
+
+	ret := map[string]interface{}{
+		"identifier": authz.Identifier,
+		"status":     authz.Status,
+		"expires":    authz.Expires.Format(time.RFC3339),
+		"challenges": challenges,
+	}
+	if authz.Wildcard {
+		ret["wildcard"] = true
+	}
+
+	return ret
+}
+
+func (b *backend) acmeChallengeObject(ac *acmeContext, authz *acmeAuthorization, chall *acmeChallenge) map[string]interface{} {
+	ret := map[string]interface{}{
+		"type":   chall.Type,
+		"url":    ac.challengeURL(authz.ID, chall.Type),
+		"token":  chall.Token,
+		"status": chall.Status,
+	}
+	if !chall.Validated.IsZero() {
+		ret["validated"] = chall.Validated.Format(time.RFC3339)
+	}
+	if chall.Error != nil {
+		ret["error"] = chall.Error
+	}
+
+	return ret
+}
+
+// acmeLoadAuthorization fetches the authorization with the given ID,
+// ensuring it belongs to the signing account and expiring it if needed. The
+// caller must hold acmeLock.
+func (b *backend) acmeLoadAuthorization(ctx context.Context, req *logical.Request, id string, ar *acmeRequest) (*acmeAuthorization, *acmeError) {
+	authz, err := getACMEAuthorization(ctx, req.Storage, id)
+	if err != nil {
+		return nil, acmeServerInternal("failed to load authorization: %s", err)
+	}
+	if authz == nil {
+		return nil, acmeNotFound("authorization not found")
+	}
+	if authz.AccountID != ar.account.ID {
+		return nil, acmeUnauthorized("authorization does not belong to the request signer")
+	}
+
+	if authz.Status == acmeStatusPending && time.Now().After(authz.Expires) {
+		authz.Status = acmeStatusInvalid
+		if err := putACMEAuthorization(ctx, req.Storage, authz); err != nil {
+			return nil, acmeServerInternal("failed to store authorization: %s", err)
+		}
+	}
+
+	return authz, nil
+}
+
+func (b *backend) acmeAuthorizationUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData, ac *acmeContext, ar *acmeRequest) (*acmeResponse, *acmeError) {
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	authz, acmeErr := b.acmeLoadAuthorization(ctx, req, data.Get("id").(string), ar)
+	if acmeErr != nil {
+		return nil, acmeErr
+	}
+
+	if !ar.postAsGet() {
+		var payload struct {
+			Status string `json:"status"`
+		}
+		if acmeErr := ar.decodePayload(&payload); acmeErr != nil {
+			return nil, acmeErr
+		}
+		if payload.Status != acmeStatusDeactivated {
+			return nil, acmeMalformed("authorizations may only be deactivated")
+		}
+		if authz.Status != acmeStatusPending && authz.Status != acmeStatusValid {
+			return nil, acmeMalformed("authorization is %s", authz.Status)
+		}
+		authz.Status = acmeStatusDeactivated
+		if err := putACMEAuthorization(ctx, req.Storage, authz); err != nil {
+			return nil, acmeServerInternal("failed to store authorization: %s", err)
+		}
+	}
+
+	return &acmeResponse{
+		status: http.StatusOK,
+		body:   b.acmeAuthorizationObject(ac, authz),
+	}, nil
+}
+
+// acmeChallengeRespond validates a challenge once the client indicates it is
+// ready. Validation happens synchronously, so the returned challenge is
+// already valid or invalid.
+func (b *backend) acmeChallengeRespond(ctx context.Context, req *logical.Request, data *framework.FieldData, ac *acmeContext, ar *acmeRequest) (*acmeResponse, *acmeError) {
+	authzID := data.Get("id").(string)
+	challType := data.Get("type").(string)
+
+	b.acmeLock.Lock()
+	authz, acmeErr := b.acmeLoadAuthorization(ctx, req, authzID, ar)
+	b.acmeLock.Unlock()
+	if acmeErr != nil {
+		return nil, acmeErr
+	}
+
+	var chall *acmeChallenge
+	for _, c := range authz.Challenges {
+		if c.Type == challType {
+			chall = c
+		}
+	}
+	if chall == nil {
+		return nil, acmeNotFound("challenge not found")
+	}
+
+	links := []string{fmt.Sprintf(`<%s>;rel="up"`, ac.authorizationURL(authz.ID))}
+
+	// POST-as-GET only reports the challenge; an empty object asks for it to
+	// be validated
+	if ar.postAsGet() || authz.Status != acmeStatusPending || chall.Status != acmeStatusPending {
+		return &acmeResponse{
+			status: http.StatusOK,
+			body:   b.acmeChallengeObject(ac, authz, chall),
+			links:  links,
+		}, nil
+	}
+
+	key, err := ar.account.publicKey()
+	if err != nil {
+		return nil, acmeServerInternal("failed to load account key: %s", err)
+	}
+
+	// Validation reaches out to the client's infrastructure, so it is done
+	// without holding the lock
+	validationErr := b.validateACMEChallenge(ctx, ac.config, authz.Identifier.Value, chall, key)
+
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	authz, acmeErr = b.acmeLoadAuthorization(ctx, req, authzID, ar)
+	if acmeErr != nil {
+		return nil, acmeErr
+	}
+	for _, c := range authz.Challenges {
+		if c.Type == challType {
+			chall = c
+		}
+	}
+
+	if authz.Status == acmeStatusPending && chall.Status == acmeStatusPending {
+		if validationErr != nil {
+			chall.Status = acmeStatusInvalid
+			chall.Error = validationErr
+			authz.Status = acmeStatusInvalid
+		} else {
+			chall.Status = acmeStatusValid
+			chall.Validated = time.Now()
+			authz.Status = acmeStatusValid
+		}
+		if err := putACMEAuthorization(ctx, req.Storage, authz); err != nil {
+			return nil, acmeServerInternal("failed to store authorization: %s", err)
+		}
+	}
+
+	return &acmeResponse{
+		status: http.StatusOK,
+		body:   b.acmeChallengeObject(ac, authz, chall),
+		links:  links,
+	}, nil
+}
+
+func (b *backend) acmeRevokeCert(ctx context.Context, req *logical.Request, data *framework.FieldData, ac *acmeContext, ar *acmeRequest) (*acmeResponse, *acmeError) {
+	var payload struct {
+		Certificate string `json:"certificate"`
+		Reason      int    `json:"reason"`
+	}
+	if acmeErr := ar.decodePayload(&payload); acmeErr != nil {
+		return nil, acmeErr
+	}
+	certBytes, err := base64.RawURLEncoding.DecodeString(payload.Certificate)
+	if err != nil {
+		return nil, acmeMalformed("failed to decode certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return nil, acmeMalformed("failed to parse certificate: %s", err)
+	}
+	serial := normalizeSerial(certutil.GetHexFormatted(cert.SerialNumber.Bytes(), ":"))
+
+	var owner acmeCertOwner
+	found, err := getACMEEntry(ctx, req.Storage, acmeCertPrefix+serial, &owner)
+	if err != nil {
+		return nil, acmeServerInternal("failed to load certificate: %s", err)
+	}
+	if !found || !bytes.Equal(owner.Certificate, certBytes) {
+		return nil, acmeNotFound("certificate was not issued through ACME by this mount")
+	}
+
+	switch {
+	case ar.account != nil:
+		if owner.AccountID != ar.account.ID {
+			return nil, acmeUnauthorized("certificate was not issued to the request signer")
+		}
+	default:
+		certKey := jose.JSONWebKey{Key: cert.PublicKey}
+		certThumbprint, err := certKey.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return nil, acmeUnauthorized("unable to compare certificate key: %s", err)
+		}
+		jwkThumbprint, err := ar.jwk.Thumbprint(crypto.SHA256)
+		if err != nil || !bytes.Equal(certThumbprint, jwkThumbprint) {
+			return nil, acmeUnauthorized("request was not signed by the certificate key")
+		}
+	}
+
+	b.revokeStorageLock.Lock()
+	defer b.revokeStorageLock.Unlock()
+
+	revEntry, err := fetchCertBySerial(ctx, req, "revoked/", serial)
+	if err != nil {
+		return nil, acmeServerInternal("failed to look up revocation: %s", err)
+	}
+	if revEntry != nil {
+		return nil, newACMEError("alreadyRevoked", http.StatusBadRequest, "certificate is already revoked")
+	}
+
+	resp, err := revokeCert(ctx, b, req, strings.Replace(serial, "-", ":", -1), false)
+	if err != nil {
+		return nil, acmeServerInternal("failed to revoke certificate: %s", err)
+	}
+	if resp != nil && resp.IsError() {
+		return nil, acmeMalformed("%s", resp.Error())
+	}
+
+	return &acmeResponse{
+		status: http.StatusOK,
+	}, nil
+}
+
+const pathACMEHelpSyn = `
+ACME (RFC 8555) server endpoints.
+`
+
+const pathACMEHelpDesc = `
+These endpoints implement an ACME server for automated certificate issuance.
+They are unauthenticated; requests are authenticated by JWS signatures as
+described in RFC 8555. Orders placed through "acme/directory" are subject to
+the name policy of the configured default role, and orders placed through
+"acme/roles/<role>/directory" to that of the named role. See "config/acme".
+`
@@ -0,0 +1,690 @@
+package pki
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault"
+	"golang.org/x/net/dns/dnsmessage"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// acmeTestClient is a minimal ACME client speaking to a test cluster
+type acmeTestClient struct {
+	t       *testing.T
+	client  *api.Client
+	baseURL string
+	key     *ecdsa.PrivateKey
+	kid     string
+	nonce   string
+}
+
+type acmeTestResponse struct {
+	status  int
+	headers http.Header
+	body    []byte
+}
+
+func (r *acmeTestResponse) decode(t *testing.T, out interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(r.body, out); err != nil {
+		t.Fatalf("failed to decode %q: %v", r.body, err)
+	}
+}
+
+func (r *acmeTestResponse) problemType() string {
+	var problem struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(r.body, &problem)
+	return strings.TrimPrefix(problem.Type, acmeErrorPrefix)
+}
+
+func (c *acmeTestClient) do(method, target string, body []byte) *acmeTestResponse {
+	c.t.Helper()
+
+	req := c.client.NewRequest(method, strings.TrimPrefix(target, c.client.Address()))
+	req.ClientToken = ""
+	if body != nil {
+		req.BodyBytes = body
+		req.Headers = http.Header{}
+		req.Headers.Set("Content-Type", "application/jose+json")
+	}
+
+	httpResp, err := c.client.RawRequest(req)
+	if httpResp == nil {
+		c.t.Fatal(err)
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if nonce := httpResp.Header.Get("Replay-Nonce"); nonce != "" {
+		c.nonce = nonce
+	}
+
+	return &acmeTestResponse{
+		status:  httpResp.StatusCode,
+		headers: httpResp.Header,
+		body:    respBody,
+	}
+}
+
+// Nonce implements jose.NonceSource
+func (c *acmeTestClient) Nonce() (string, error) {
+	if c.nonce == "" {
+		c.do("HEAD", c.baseURL+"/new-nonce", nil)
+	}
+	nonce := c.nonce
+	c.nonce = ""
+	return nonce, nil
+}
+
+func (c *acmeTestClient) sign(target string, payload []byte, embedJWK bool) []byte {
+	c.t.Helper()
+
+	opts := &jose.SignerOptions{
+		NonceSource: c,
+		EmbedJWK:    embedJWK,
+	}
+	opts.WithHeader("url", target)
+	if !embedJWK {
+		opts.WithHeader("kid", c.kid)
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: c.key}, opts)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return []byte(jws.FullSerialize())
+}
+
+func (c *acmeTestClient) post(target string, payload interface{}) *acmeTestResponse {
+	c.t.Helper()
+
+	var raw []byte
+	if payload != nil {
+		var err error
+		if raw, err = json.Marshal(payload); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	return c.do("POST", target, c.sign(target, raw, c.kid == ""))
+}
+
+func (c *acmeTestClient) keyAuthorization(token string) string {
+	c.t.Helper()
+	keyAuth, err := keyAuthorization(token, &jose.JSONWebKey{Key: c.key.Public()})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return keyAuth
+}
+
+type acmeTestOrder struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+}
+
+type acmeTestAuthorization struct {
+	Status     string `json:"status"`
+	Identifier struct {
+		Value string `json:"value"`
+	} `json:"identifier"`
+	Challenges []struct {
+		Type   string `json:"type"`
+		URL    string `json:"url"`
+		Token  string `json:"token"`
+		Status string `json:"status"`
+	} `json:"challenges"`
+}
+
+// newOrder places an order for the given names and returns it along with
+// its location
+func (c *acmeTestClient) newOrder(names ...string) (*acmeTestOrder, string) {
+	c.t.Helper()
+
+	var identifiers []map[string]string
+	for _, name := range names {
+		identifiers = append(identifiers, map[string]string{"type": "dns", "value": name})
+	}
+	resp := c.post(c.baseURL+"/new-order", map[string]interface{}{
+		"identifiers": identifiers,
+	})
+	if resp.status != http.StatusCreated {
+		c.t.Fatalf("bad status creating order: %d: %s", resp.status, resp.body)
+	}
+
+	var order acmeTestOrder
+	resp.decode(c.t, &order)
+	return &order, resp.headers.Get("Location")
+}
+
+// solve completes the challenge of the given type for every authorization
+// of the order, with prepare publishing the key authorization
+func (c *acmeTestClient) solve(order *acmeTestOrder, challType string, prepare func(domain, token, keyAuth string)) {
+	c.t.Helper()
+
+	for _, authzURL := range order.Authorizations {
+		var authz acmeTestAuthorization
+		c.post(authzURL, nil).decode(c.t, &authz)
+
+		found := false
+		for _, chall := range authz.Challenges {
+			if chall.Type != challType {
+				continue
+			}
+			found = true
+			prepare(authz.Identifier.Value, chall.Token, c.keyAuthorization(chall.Token))
+
+			resp := c.post(chall.URL, map[string]interface{}{})
+			var result struct {
+				Status string `json:"status"`
+			}
+			resp.decode(c.t, &result)
+			if result.Status != acmeStatusValid {
+				c.t.Fatalf("challenge for %s was not validated: %s", authz.Identifier.Value, resp.body)
+			}
+		}
+		if !found {
+			c.t.Fatalf("no %s challenge offered for %s", challType, authz.Identifier.Value)
+		}
+	}
+}
+
+// finalize submits a CSR for the names of a ready order and returns the
+// issued certificate
+func (c *acmeTestClient) finalize(orderURL string, order *acmeTestOrder, names ...string) *x509.Certificate {
+	c.t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: names[0]},
+		DNSNames: names,
+	}, key)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	resp := c.post(order.Finalize, map[string]interface{}{
+		"csr": base64.RawURLEncoding.EncodeToString(csr),
+	})
+	if resp.status != http.StatusOK {
+		c.t.Fatalf("bad status finalizing order: %d: %s", resp.status, resp.body)
+	}
+	resp.decode(c.t, order)
+	if order.Status != acmeStatusValid || order.Certificate == "" {
+		c.t.Fatalf("order not valid after finalizing: %s", resp.body)
+	}
+
+	resp = c.post(order.Certificate, nil)
+	if ct := resp.headers.Get("Content-Type"); ct != acmeContentTypePEM {
+		c.t.Fatalf("bad certificate content type %q", ct)
+	}
+	block, _ := pem.Decode(resp.body)
+	if block == nil {
+		c.t.Fatalf("no certificate in %q", resp.body)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return cert
+}
+
+// acmeTestDNSServer is a DNS stand-in answering TXT queries from a map
+type acmeTestDNSServer struct {
+	conn net.PacketConn
+
+	l       sync.Mutex
+	records map[string][]string
+}
+
+func newACMETestDNSServer(t *testing.T) *acmeTestDNSServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &acmeTestDNSServer{
+		conn:    conn,
+		records: make(map[string][]string),
+	}
+	go s.serve()
+	return s
+}
+
+func (s *acmeTestDNSServer) setTXT(name, value string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.records[name+"."] = append(s.records[name+"."], value)
+}
+
+func (s *acmeTestDNSServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		var p dnsmessage.Parser
+		header, err := p.Start(buf[:n])
+		if err != nil {
+			continue
+		}
+		question, err := p.Question()
+		if err != nil {
+			continue
+		}
+
+		s.l.Lock()
+		values := s.records[question.Name.String()]
+		s.l.Unlock()
+
+		respHeader := dnsmessage.Header{
+			ID:            header.ID,
+			Response:      true,
+			Authoritative: true,
+		}
+		if question.Type != dnsmessage.TypeTXT || len(values) == 0 {
+			respHeader.RCode = dnsmessage.RCodeNameError
+		}
+
+		b := dnsmessage.NewBuilder(nil, respHeader)
+		b.EnableCompression()
+		b.StartQuestions()
+		b.Question(question)
+		b.StartAnswers()
+		if respHeader.RCode == dnsmessage.RCodeSuccess {
+			for _, value := range values {
+				b.TXTResource(dnsmessage.ResourceHeader{
+					Name:  question.Name,
+					Type:  dnsmessage.TypeTXT,
+					Class: dnsmessage.ClassINET,
+				}, dnsmessage.TXTResource{TXT: []string{value}})
+			}
+		}
+		msg, err := b.Finish()
+		if err != nil {
+			continue
+		}
+		s.conn.WriteTo(msg, addr)
+	}
+}
+
+func TestBackend_ACME(t *testing.T) {
+	// http-01 challenges are served by a local stand-in
+	var tokensLock sync.Mutex
+	tokens := make(map[string]string)
+	challengeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokensLock.Lock()
+		keyAuth, ok := tokens[strings.TrimPrefix(r.URL.Path, "/.well-known/acme-challenge/")]
+		tokensLock.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(keyAuth))
+	}))
+	defer challengeServer.Close()
+	challengeURL, err := url.Parse(challengeServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challengePort, err := strconv.Atoi(challengeURL.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dnsServer := newACMETestDNSServer(t)
+	defer dnsServer.conn.Close()
+
+	coreConfig := &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"pki": func(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
+				b := Backend(conf)
+				b.acmeHTTP01Port = challengePort
+				if err := b.Setup(ctx, conf); err != nil {
+					return nil, err
+				}
+				return b, nil
+			},
+		},
+	}
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	client := cluster.Cores[0].Client
+	err = client.Sys().Mount("pki", &api.MountInput{
+		Type: "pki",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Logical().Write("pki/root/generate/internal", map[string]interface{}{
+		"ttl":         "40h",
+		"common_name": "myvault.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert := parseCert(t, resp.Data["certificate"].(string))
+
+	_, err = client.Logical().Write("pki/roles/web", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"key_bits":         256,
+		"ttl":              "1h",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Logical().Write("pki/roles/other", map[string]interface{}{
+		"allowed_domains":  "example.org",
+		"allow_subdomains": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mountURL := client.Address() + "/v1/pki"
+	c := &acmeTestClient{
+		t:       t,
+		client:  client,
+		baseURL: mountURL + "/acme",
+		key:     key,
+	}
+
+	// ACME is off until configured
+	if r := c.do("GET", c.baseURL+"/directory", nil); r.status != http.StatusForbidden || r.problemType() != "unauthorized" {
+		t.Fatalf("expected ACME to be disabled, got %d: %s", r.status, r.body)
+	}
+	_, err = client.Logical().Write("pki/config/acme", map[string]interface{}{
+		"enabled": true,
+	})
+	if err == nil {
+		t.Fatal("expected an error enabling ACME without base_url")
+	}
+	_, err = client.Logical().Write("pki/config/acme", map[string]interface{}{
+		"enabled":       true,
+		"base_url":      mountURL,
+		"default_role":  "web",
+		"allowed_roles": "web",
+		"dns_resolver":  dnsServer.conn.LocalAddr().String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := c.do("GET", c.baseURL+"/directory", nil)
+	if r.status != http.StatusOK {
+		t.Fatalf("bad directory status %d: %s", r.status, r.body)
+	}
+	var directory map[string]interface{}
+	r.decode(t, &directory)
+	if directory["newAccount"] != c.baseURL+"/new-account" {
+		t.Fatalf("bad directory: %v", directory)
+	}
+
+	r = c.do("HEAD", c.baseURL+"/new-nonce", nil)
+	if r.status != http.StatusOK || r.headers.Get("Replay-Nonce") == "" {
+		t.Fatalf("expected a nonce, got %d: %v", r.status, r.headers)
+	}
+
+	// Roles not listed in allowed_roles are refused
+	if r := c.do("GET", mountURL+"/acme/roles/other/directory", nil); r.status != http.StatusForbidden {
+		t.Fatalf("expected role to be refused, got %d: %s", r.status, r.body)
+	}
+
+	// Account creation is idempotent per key
+	r = c.post(c.baseURL+"/new-account", map[string]interface{}{
+		"contact":              []string{"mailto:admin@example.com"},
+		"termsOfServiceAgreed": true,
+	})
+	if r.status != http.StatusCreated {
+		t.Fatalf("bad status creating account: %d: %s", r.status, r.body)
+	}
+	kid := r.headers.Get("Location")
+	r = c.post(c.baseURL+"/new-account", map[string]interface{}{
+		"onlyReturnExisting": true,
+	})
+	if r.status != http.StatusOK || r.headers.Get("Location") != kid {
+		t.Fatalf("expected existing account %q, got %d: %v", kid, r.status, r.headers)
+	}
+	c.kid = kid
+
+	// Nonces cannot be replayed
+	body := c.sign(c.baseURL+"/new-order", []byte(`{"identifiers":[{"type":"dns","value":"localhost"}]}`), false)
+	c.do("POST", c.baseURL+"/new-order", body)
+	if r := c.do("POST", c.baseURL+"/new-order", body); r.problemType() != "badNonce" {
+		t.Fatalf("expected a badNonce error, got %d: %s", r.status, r.body)
+	}
+
+	// The role's name policy applies to orders
+	r = c.post(c.baseURL+"/new-order", map[string]interface{}{
+		"identifiers": []map[string]string{{"type": "dns", "value": "www.example.net"}},
+	})
+	if r.problemType() != "rejectedIdentifier" {
+		t.Fatalf("expected identifier to be rejected, got %d: %s", r.status, r.body)
+	}
+
+	// http-01
+	order, orderURL := c.newOrder("localhost")
+	if order.Status != acmeStatusPending {
+		t.Fatalf("expected pending order, got %q", order.Status)
+	}
+	c.solve(order, acmeChallengeHTTP01, func(domain, token, keyAuth string) {
+		tokensLock.Lock()
+		tokens[token] = keyAuth
+		tokensLock.Unlock()
+	})
+	c.post(orderURL, nil).decode(t, order)
+	if order.Status != acmeStatusReady {
+		t.Fatalf("expected ready order, got %q", order.Status)
+	}
+	cert := c.finalize(orderURL, order, "localhost")
+	if len(cert.DNSNames) != 1 || cert.DNSNames[0] != "localhost" {
+		t.Fatalf("bad certificate names %v", cert.DNSNames)
+	}
+	if err := cert.CheckSignatureFrom(caCert); err != nil {
+		t.Fatal(err)
+	}
+
+	// dns-01, including a wildcard, through the role-specific directory
+	c.baseURL = mountURL + "/acme/roles/web"
+	order, orderURL = c.newOrder("*.example.com", "www.example.com")
+	for _, authzURL := range order.Authorizations {
+		var authz acmeTestAuthorization
+		c.post(authzURL, nil).decode(t, &authz)
+		if authz.Identifier.Value == "example.com" && len(authz.Challenges) != 1 {
+			t.Fatalf("expected only dns-01 for a wildcard, got %v", authz.Challenges)
+		}
+	}
+	c.solve(order, acmeChallengeDNS01, func(domain, token, keyAuth string) {
+		digest := sha256.Sum256([]byte(keyAuth))
+		dnsServer.setTXT("_acme-challenge."+domain, base64.RawURLEncoding.EncodeToString(digest[:]))
+	})
+	cert = c.finalize(orderURL, order, "*.example.com", "www.example.com")
+	if len(cert.DNSNames) != 2 {
+		t.Fatalf("bad certificate names %v", cert.DNSNames)
+	}
+
+	// A challenge that cannot be satisfied invalidates the order
+	order, orderURL = c.newOrder("missing.example.com")
+	var authz acmeTestAuthorization
+	c.post(order.Authorizations[0], nil).decode(t, &authz)
+	for _, chall := range authz.Challenges {
+		if chall.Type == acmeChallengeDNS01 {
+			c.post(chall.URL, map[string]interface{}{})
+		}
+	}
+	c.post(orderURL, nil).decode(t, order)
+	if order.Status != acmeStatusInvalid {
+		t.Fatalf("expected invalid order, got %q", order.Status)
+	}
+
+	// Orders cannot be finalized with names that were not authorized
+	order, orderURL = c.newOrder("localhost")
+	c.solve(order, acmeChallengeHTTP01, func(domain, token, keyAuth string) {
+		tokensLock.Lock()
+		tokens[token] = keyAuth
+		tokensLock.Unlock()
+	})
+	csrKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		DNSNames: []string{"localhost", "www.example.com"},
+	}, csrKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = c.post(order.Finalize, map[string]interface{}{
+		"csr": base64.RawURLEncoding.EncodeToString(csr),
+	})
+	if r.problemType() != "badCSR" {
+		t.Fatalf("expected a badCSR error, got %d: %s", r.status, r.body)
+	}
+
+	// Revocation by the ordering account
+	revoke := map[string]interface{}{
+		"certificate": base64.RawURLEncoding.EncodeToString(cert.Raw),
+	}
+	if r := c.post(c.baseURL+"/revoke-cert", revoke); r.status != http.StatusOK {
+		t.Fatalf("bad status revoking certificate: %d: %s", r.status, r.body)
+	}
+	if r := c.post(c.baseURL+"/revoke-cert", revoke); r.problemType() != "alreadyRevoked" {
+		t.Fatalf("expected an alreadyRevoked error, got %d: %s", r.status, r.body)
+	}
+
+	// Other accounts cannot act on this account's resources
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := &acmeTestClient{
+		t:       t,
+		client:  client,
+		baseURL: c.baseURL,
+		key:     otherKey,
+	}
+	r = other.post(other.baseURL+"/new-account", map[string]interface{}{})
+	other.kid = r.headers.Get("Location")
+	if r := other.post(orderURL, nil); r.problemType() != "unauthorized" {
+		t.Fatalf("expected an unauthorized error, got %d: %s", r.status, r.body)
+	}
+
+	// Key rollover
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	innerSigner, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: newKey}, (&jose.SignerOptions{
+		EmbedJWK: true,
+	}).WithHeader("url", c.baseURL+"/key-change"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	innerPayload, err := json.Marshal(map[string]interface{}{
+		"account": c.kid,
+		"oldKey":  jose.JSONWebKey{Key: c.key.Public()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := innerSigner.Sign(innerPayload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = c.do("POST", c.baseURL+"/key-change", c.sign(c.baseURL+"/key-change", []byte(inner.FullSerialize()), false))
+	if r.status != http.StatusOK {
+		t.Fatalf("bad status changing key: %d: %s", r.status, r.body)
+	}
+	if r := c.post(c.kid, nil); r.problemType() != "malformed" {
+		t.Fatalf("expected the old key to be rejected, got %d: %s", r.status, r.body)
+	}
+	c.key = newKey
+	var account map[string]interface{}
+	c.post(c.kid, nil).decode(t, &account)
+	if account["status"] != acmeStatusValid {
+		t.Fatalf("bad account: %v", account)
+	}
+}
+
+func TestACMENonces_Bounded(t *testing.T) {
+	n := newACMENonces()
+
+	first, err := n.issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last string
+	for i := 0; i < acmeMaxNonces; i++ {
+		if last, err = n.issue(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(n.nonces) != acmeMaxNonces {
+		t.Fatalf("expected %d outstanding nonces, got %d", acmeMaxNonces, len(n.nonces))
+	}
+
+	// The latest nonce is always redeemable, and nonces are redeemed once
+	if !n.redeem(last) || n.redeem(last) {
+		t.Fatal("bad redemption of the latest nonce")
+	}
+
+	// Expired nonces are pruned
+	n.l.Lock()
+	for k := range n.nonces {
+		n.nonces[k] = time.Now().Add(-time.Second)
+	}
+	n.lastPrune = time.Time{}
+	n.l.Unlock()
+	if _, err := n.issue(); err != nil {
+		t.Fatal(err)
+	}
+	if len(n.nonces) != 1 || n.redeem(first) {
+		t.Fatalf("expected expired nonces to be pruned, got %d", len(n.nonces))
+	}
+}
@@ -0,0 +1,175 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// acmeConfig holds the configuration of the ACME server
+type acmeConfig struct {
+	Enabled      bool     `json:"enabled"`
+	BaseURL      string   `json:"base_url"`
+	DefaultRole  string   `json:"default_role"`
+	AllowedRoles []string `json:"allowed_roles"`
+	DNSResolver  string   `json:"dns_resolver"`
+}
+
+func pathConfigACME(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/acme",
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: `If set to true, enables the ACME server on this mount.`,
+			},
+			"base_url": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The URL of this mount as seen by ACME clients,
+for example "https://vault.example.com:8200/v1/pki".
+Required to enable ACME.`,
+			},
+			"default_role": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The role whose name policy applies to orders
+placed through the "acme/directory" endpoint. If
+unset, clients must use a role-specific directory.`,
+			},
+			"allowed_roles": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of roles that may be used
+through the "acme/roles/<role>/directory" endpoints.
+If empty, any role may be used.`,
+			},
+			"dns_resolver": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The host:port of the DNS server used to validate
+dns-01 challenges. If unset, the system resolver
+is used.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathACMEConfigRead,
+			logical.UpdateOperation: b.pathACMEConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigACMEHelpSyn,
+		HelpDescription: pathConfigACMEHelpDesc,
+	}
+}
+
+func (b *backend) acmeConfig(ctx context.Context, s logical.Storage) (*acmeConfig, error) {
+	entry, err := s.Get(ctx, "config/acme")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return &acmeConfig{}, nil
+	}
+
+	var result acmeConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// roleAllowed returns whether ACME clients may request certificates using
+// the given role.
+func (c *acmeConfig) roleAllowed(role string) bool {
+	if role == c.DefaultRole {
+		return true
+	}
+	return len(c.AllowedRoles) == 0 || strutil.StrListContains(c.AllowedRoles, role)
+}
+
+func (b *backend) pathACMEConfigRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.acmeConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":       config.Enabled,
+			"base_url":      config.BaseURL,
+			"default_role":  config.DefaultRole,
+			"allowed_roles": config.AllowedRoles,
+			"dns_resolver":  config.DNSResolver,
+		},
+	}, nil
+}
+
+func (b *backend) pathACMEConfigWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.acmeConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := data.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+	if baseURLRaw, ok := data.GetOk("base_url"); ok {
+		config.BaseURL = strings.TrimSuffix(baseURLRaw.(string), "/")
+		if config.BaseURL != "" && !govalidator.IsURL(config.BaseURL) {
+			return logical.ErrorResponse(fmt.Sprintf("invalid base_url: %s", config.BaseURL)), nil
+		}
+	}
+	if defaultRoleRaw, ok := data.GetOk("default_role"); ok {
+		config.DefaultRole = defaultRoleRaw.(string)
+	}
+	if allowedRolesRaw, ok := data.GetOk("allowed_roles"); ok {
+		config.AllowedRoles = allowedRolesRaw.([]string)
+	}
+	if resolverRaw, ok := data.GetOk("dns_resolver"); ok {
+		config.DNSResolver = resolverRaw.(string)
+		if config.DNSResolver != "" {
+			if _, _, err := net.SplitHostPort(config.DNSResolver); err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("dns_resolver must be of the form host:port: %s", err)), nil
+			}
+		}
+	}
+
+	if config.Enabled && config.BaseURL == "" {
+		return logical.ErrorResponse("base_url must be set to enable ACME"), nil
+	}
+
+	if config.DefaultRole != "" {
+		role, err := b.getRole(ctx, req.Storage, config.DefaultRole)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return logical.ErrorResponse(fmt.Sprintf("default_role %q does not exist", config.DefaultRole)), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("config/acme", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+const pathConfigACMEHelpSyn = `
+Configure the ACME server.
+`
+
+const pathConfigACMEHelpDesc = `
+This endpoint configures the ACME (RFC 8555) server of this mount. ACME
+clients place orders through "acme/directory", which applies the name policy
+of the default role, or through "acme/roles/<role>/directory" to use a
+specific role.
+`
@@ -11,10 +11,16 @@ import (
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
-// CRLConfig holds basic CRL configuration information
+// defaultOCSPExpiry is how long OCSP responses are valid for when no
+// ocsp_expiry has been configured
+const defaultOCSPExpiry = 12 * time.Hour
+
+// CRLConfig holds basic CRL and OCSP configuration information
 type crlConfig struct {
-	Expiry  string `json:"expiry" mapstructure:"expiry"`
-	Disable bool   `json:"disable"`
+	Expiry      string `json:"expiry" mapstructure:"expiry"`
+	Disable     bool   `json:"disable"`
+	OCSPDisable bool   `json:"ocsp_disable"`
+	OCSPExpiry  string `json:"ocsp_expiry"`
 }
 
 func pathConfigCRL(b *backend) *framework.Path {
@@ -31,6 +37,17 @@ valid; defaults to 72 hours`,
 				Type:        framework.TypeBool,
 				Description: `If set to true, disables generating the CRL entirely.`,
 			},
+			"ocsp_disable": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: `If set to true, the OCSP responder answers every request as unauthorized.`,
+			},
+			"ocsp_expiry": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The amount of time an OCSP response should be
+valid; defaults to 12 hours. A value of "0s" omits
+the next update time from responses.`,
+				Default: "12h",
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -71,8 +88,10 @@ func (b *backend) pathCRLRead(ctx context.Context, req *logical.Request, data *f
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"expiry":  config.Expiry,
-			"disable": config.Disable,
+			"expiry":       config.Expiry,
+			"disable":      config.Disable,
+			"ocsp_disable": config.OCSPDisable,
+			"ocsp_expiry":  config.OCSPExpiry,
 		},
 	}, nil
 }
@@ -95,6 +114,22 @@ func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *fra
 		config.Expiry = expiry
 	}
 
+	if ocspExpiryRaw, ok := d.GetOk("ocsp_expiry"); ok {
+		ocspExpiry := ocspExpiryRaw.(string)
+		dur, err := time.ParseDuration(ocspExpiry)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("given ocsp_expiry could not be decoded: %s", err)), nil
+		}
+		if dur < 0 {
+			return logical.ErrorResponse("ocsp_expiry must not be negative"), nil
+		}
+		config.OCSPExpiry = ocspExpiry
+	}
+
+	if ocspDisableRaw, ok := d.GetOk("ocsp_disable"); ok {
+		config.OCSPDisable = ocspDisableRaw.(bool)
+	}
+
 	var oldDisable bool
 	if disableRaw, ok := d.GetOk("disable"); ok {
 		oldDisable = config.Disable
@@ -125,9 +160,10 @@ func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *fra
 }
 
 const pathConfigCRLHelpSyn = `
-Configure the CRL expiration.
+Configure the CRL and OCSP response expiration.
 `
 
 const pathConfigCRLHelpDesc = `
-This endpoint allows configuration of the CRL lifetime.
+This endpoint allows configuration of the CRL lifetime and of the
+lifetime of responses from the OCSP responder.
 `
@@ -59,6 +59,8 @@ endpoint.`,
 		HelpDescription: pathSetSignedIntermediateHelpDesc,
 	}
 
+	ret.Fields = addIssuerNameField(ret.Fields)
+
 	return ret
 }
 
@@ -163,8 +165,13 @@ func (b *backend) pathSetSignedIntermediate(ctx context.Context, req *logical.Re
 		return logical.ErrorResponse("supplied certificate could not be successfully parsed"), nil
 	}
 
+	issuerName := data.Get("issuer_name").(string)
+	if err := b.validateIssuerName(ctx, req.Storage, "", issuerName); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
 	cb := &certutil.CertBundle{}
-	entry, err := req.Storage.Get(ctx, "config/ca_bundle")
+	entry, err := req.Storage.Get(ctx, legacyCABundleKey)
 	if err != nil {
 		return nil, err
 	}
@@ -206,25 +213,22 @@ func (b *backend) pathSetSignedIntermediate(ctx context.Context, req *logical.Re
 		return nil, errwrap.Wrapf("error converting raw values into cert bundle: {{err}}", err)
 	}
 
-	entry, err = logical.StorageEntryJSON("config/ca_bundle", cb)
-	if err != nil {
-		return nil, err
-	}
-	err = req.Storage.Put(ctx, entry)
-	if err != nil {
-		return nil, err
+	if _, err := b.importIssuer(ctx, req, cb, issuerName, true); err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
 	}
 
-	entry.Key = "certs/" + normalizeSerial(cb.SerialNumber)
-	entry.Value = inputBundle.CertificateBytes
-	err = req.Storage.Put(ctx, entry)
+	// The pending key now lives in the issuer
+	err = req.Storage.Delete(ctx, legacyCABundleKey)
 	if err != nil {
 		return nil, err
 	}
 
-	// For ease of later use, also store just the certificate at a known
-	// location
-	entry.Key = "ca"
+	entry.Key = "certs/" + normalizeSerial(cb.SerialNumber)
 	entry.Value = inputBundle.CertificateBytes
 	err = req.Storage.Put(ctx, entry)
 	if err != nil {
@@ -101,6 +101,8 @@ this value to an empty list.`,
 		Description: `A comma-separated string or list of extended key usage oids.`,
 	}
 
+	ret.Fields = addIssuerRefField(ret.Fields)
+
 	return ret
 }
 
@@ -168,6 +170,7 @@ func (b *backend) pathSignVerbatim(ctx context.Context, req *logical.Request, da
 		KeyUsage:             data.Get("key_usage").([]string),
 		ExtKeyUsage:          data.Get("ext_key_usage").([]string),
 		ExtKeyUsageOIDs:      data.Get("ext_key_usage_oids").([]string),
+		Issuer:               data.Get("issuer_ref").(string),
 	}
 
 	*entry.GenerateLease = false
@@ -183,6 +186,9 @@ func (b *backend) pathSignVerbatim(ctx context.Context, req *logical.Request, da
 			*entry.GenerateLease = *role.GenerateLease
 		}
 		entry.NoStore = role.NoStore
+		if _, ok := data.GetOk("issuer_ref"); !ok {
+			entry.Issuer = role.Issuer
+		}
 	}
 
 	return b.pathIssueSignCert(ctx, req, data, entry, true, true)
@@ -201,7 +207,7 @@ func (b *backend) pathIssueSignCert(ctx context.Context, req *logical.Request, d
 	}
 
 	var caErr error
-	signingBundle, caErr := fetchCAInfo(ctx, req)
+	issuer, signingBundle, caErr := b.fetchIssuerCAInfo(ctx, req, role.Issuer)
 	switch caErr.(type) {
 	case errutil.UserError:
 		return nil, errutil.UserError{Err: fmt.Sprintf(
@@ -234,6 +240,10 @@ func (b *backend) pathIssueSignCert(ctx context.Context, req *logical.Request, d
 		}
 	}
 
+	if err := appendCrossSigned(parsedBundle, issuer); err != nil {
+		return nil, err
+	}
+
 	signingCB, err := signingBundle.ToCertBundle()
 	if err != nil {
 		return nil, errwrap.Wrapf("error converting raw signing bundle to cert bundle: {{err}}", err)
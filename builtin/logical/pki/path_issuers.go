@@ -0,0 +1,537 @@
+package pki
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathListIssuers(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuers/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathIssuerList,
+		},
+
+		HelpSynopsis:    pathListIssuersHelpSyn,
+		HelpDescription: pathListIssuersHelpDesc,
+	}
+}
+
+func pathIssuer(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuer/" + framework.GenericNameRegex("issuer_ref"),
+		Fields: map[string]*framework.FieldSchema{
+			"issuer_ref": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `ID or name of the issuer, or "default".`,
+			},
+			"issuer_name": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Name for the issuer, which can be used in place
+of its ID to refer to it. Must be unique within the
+mount and may not be "default".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathIssuerRead,
+			logical.UpdateOperation: b.pathIssuerWrite,
+			logical.DeleteOperation: b.pathIssuerDelete,
+		},
+
+		HelpSynopsis:    pathIssuerHelpSyn,
+		HelpDescription: pathIssuerHelpDesc,
+	}
+}
+
+func pathCrossSignIssuer(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuer/" + framework.GenericNameRegex("issuer_ref") + "/cross-sign",
+		Fields: map[string]*framework.FieldSchema{
+			"issuer_ref": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `ID or name of the issuer to cross-sign, or "default".`,
+			},
+			"signing_issuer_ref": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `ID or name of the issuer whose key signs the
+cross-signed certificate, or "default".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathIssuerCrossSign,
+		},
+
+		HelpSynopsis:    pathCrossSignIssuerHelpSyn,
+		HelpDescription: pathCrossSignIssuerHelpDesc,
+	}
+}
+
+func pathConfigIssuers(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/issuers",
+		Fields: map[string]*framework.FieldSchema{
+			"default": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `ID or name of the issuer to use by default.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigIssuersRead,
+			logical.UpdateOperation: b.pathConfigIssuersWrite,
+		},
+
+		HelpSynopsis:    pathConfigIssuersHelpSyn,
+		HelpDescription: pathConfigIssuersHelpDesc,
+	}
+}
+
+// Returns an issuer's certificate in raw format
+func pathFetchIssuerCA(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "ca/issuer/" + framework.GenericNameRegex("issuer_ref") + "(/pem)?",
+		Fields: map[string]*framework.FieldSchema{
+			"issuer_ref": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `ID or name of the issuer, or "default".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathFetchIssuerRead,
+		},
+
+		HelpSynopsis:    pathFetchIssuerHelpSyn,
+		HelpDescription: pathFetchIssuerHelpDesc,
+	}
+}
+
+// Returns an issuer's CRL in raw format
+func pathFetchIssuerCRL(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "crl/issuer/" + framework.GenericNameRegex("issuer_ref") + "(/pem)?",
+		Fields: map[string]*framework.FieldSchema{
+			"issuer_ref": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `ID or name of the issuer, or "default".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathFetchIssuerRead,
+		},
+
+		HelpSynopsis:    pathFetchIssuerHelpSyn,
+		HelpDescription: pathFetchIssuerHelpDesc,
+	}
+}
+
+func (b *backend) pathIssuerList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ids, err := b.listIssuers(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	config, err := getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(ids)
+	keyInfo := make(map[string]interface{}, len(ids))
+	for _, id := range ids {
+		issuer, err := getIssuer(ctx, req.Storage, id)
+		if err != nil {
+			return nil, err
+		}
+		if issuer == nil {
+			continue
+		}
+		keyInfo[id] = map[string]interface{}{
+			"issuer_name": issuer.Name,
+			"is_default":  id == config.DefaultIssuerID,
+		}
+	}
+
+	return logical.ListResponseWithInfo(ids, keyInfo), nil
+}
+
+func (b *backend) pathIssuerRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuer, err := b.resolveIssuer(ctx, req.Storage, data.Get("issuer_ref").(string))
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		return nil, nil
+	}
+	config, err := getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: issuer.toResponseData(issuer.ID == config.DefaultIssuerID),
+	}, nil
+}
+
+func (b *backend) pathIssuerWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ref := data.Get("issuer_ref").(string)
+	issuer, err := b.resolveIssuer(ctx, req.Storage, ref)
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		return logical.ErrorResponse(fmt.Sprintf("issuer %q does not exist", ref)), nil
+	}
+
+	if nameRaw, ok := data.GetOk("issuer_name"); ok {
+		name := nameRaw.(string)
+		if err := b.validateIssuerName(ctx, req.Storage, issuer.ID, name); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		issuer.Name = name
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	if err := putIssuer(ctx, req.Storage, issuer); err != nil {
+		return nil, err
+	}
+
+	config, err := getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: issuer.toResponseData(issuer.ID == config.DefaultIssuerID),
+	}, nil
+}
+
+func (b *backend) pathIssuerDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuer, err := b.resolveIssuer(ctx, req.Storage, data.Get("issuer_ref").(string))
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		return nil, nil
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	if err := req.Storage.Delete(ctx, issuerPrefix+issuer.ID); err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, issuerCRLPrefix+issuer.ID); err != nil {
+		return nil, err
+	}
+
+	config, err := getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config.DefaultIssuerID != issuer.ID {
+		return nil, nil
+	}
+
+	// Certificates can no longer be issued from the default issuer until a
+	// new one is chosen; as with deleting the root, the old certificate and
+	// CRL remain readable until then
+	config.DefaultIssuerID = ""
+	if err := putIssuersConfig(ctx, req.Storage, config); err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{}
+	resp.AddWarning(fmt.Sprintf("The deleted issuer was the default issuer; set a new default via %sconfig/issuers.", req.MountPoint))
+	return resp, nil
+}
+
+func (b *backend) pathConfigIssuersRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"default": config.DefaultIssuerID,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigIssuersWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ref := data.Get("default").(string)
+	if ref == "" || ref == defaultIssuerRef {
+		return logical.ErrorResponse(`"default" must be the ID or name of an issuer`), nil
+	}
+
+	issuer, err := b.resolveIssuer(ctx, req.Storage, ref)
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		return logical.ErrorResponse(fmt.Sprintf("issuer %q does not exist", ref)), nil
+	}
+
+	err = func() error {
+		b.issuersLock.Lock()
+		defer b.issuersLock.Unlock()
+
+		config, err := getIssuersConfig(ctx, req.Storage)
+		if err != nil {
+			return err
+		}
+		return b.setDefaultIssuer(ctx, req.Storage, config, issuer)
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	// Rebuild the CRLs so that the default CRL matches the new default issuer
+	b.revokeStorageLock.RLock()
+	defer b.revokeStorageLock.RUnlock()
+
+	crlErr := buildCRL(ctx, b, req, true)
+	switch crlErr.(type) {
+	case errutil.UserError:
+		return logical.ErrorResponse(fmt.Sprintf("Error during CRL building: %s", crlErr)), nil
+	case errutil.InternalError:
+		return nil, errwrap.Wrapf("error encountered during CRL building: {{err}}", crlErr)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"default": issuer.ID,
+		},
+	}, nil
+}
+
+func (b *backend) pathIssuerCrossSign(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ref := data.Get("issuer_ref").(string)
+	target, err := b.resolveIssuer(ctx, req.Storage, ref)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return logical.ErrorResponse(fmt.Sprintf("issuer %q does not exist", ref)), nil
+	}
+
+	signingRef := data.Get("signing_issuer_ref").(string)
+	if signingRef == "" {
+		return logical.ErrorResponse(`"signing_issuer_ref" is required`), nil
+	}
+	signer, signingBundle, err := b.fetchIssuerCAInfo(ctx, req, signingRef)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
+	}
+	if signer.ID == target.ID {
+		return logical.ErrorResponse("an issuer cannot cross-sign itself"), nil
+	}
+
+	targetCert, err := target.certificate()
+	if err != nil {
+		return nil, err
+	}
+
+	serialNumber, err := certutil.GenerateSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	// The cross-signed certificate carries the target's subject and key, so
+	// certificates issued by the target chain to the signer through it
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               targetCert.Subject,
+		NotBefore:             targetCert.NotBefore,
+		NotAfter:              targetCert.NotAfter,
+		KeyUsage:              targetCert.KeyUsage,
+		ExtKeyUsage:           targetCert.ExtKeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            targetCert.MaxPathLen,
+		MaxPathLenZero:        targetCert.MaxPathLenZero,
+		SubjectKeyId:          targetCert.SubjectKeyId,
+		PermittedDNSDomains:   targetCert.PermittedDNSDomains,
+	}
+	if signingBundle.Certificate.NotAfter.Before(template.NotAfter) {
+		template.NotAfter = signingBundle.Certificate.NotAfter
+	}
+	if signingBundle.URLs != nil {
+		template.IssuingCertificateURL = signingBundle.URLs.IssuingCertificates
+		template.CRLDistributionPoints = signingBundle.URLs.CRLDistributionPoints
+		template.OCSPServer = signingBundle.URLs.OCSPServers
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, signingBundle.Certificate, targetCert.PublicKey, signingBundle.PrivateKey)
+	if err != nil {
+		return nil, errwrap.Wrapf("error cross-signing issuer: {{err}}", err)
+	}
+	certPEM := strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: certBytes,
+	})))
+
+	serial := certutil.GetHexFormatted(serialNumber.Bytes(), ":")
+	err = req.Storage.Put(ctx, &logical.StorageEntry{
+		Key:   "certs/" + normalizeSerial(serial),
+		Value: certBytes,
+	})
+	if err != nil {
+		return nil, errwrap.Wrapf("unable to store certificate locally: {{err}}", err)
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	// Reload the target so concurrent cross-signings aren't lost
+	target, err = getIssuer(ctx, req.Storage, target.ID)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return logical.ErrorResponse("issuer was deleted while being cross-signed"), nil
+	}
+	target.CrossSigned = append(target.CrossSigned, certPEM)
+	if err := putIssuer(ctx, req.Storage, target); err != nil {
+		return nil, err
+	}
+
+	signingCB, err := signingBundle.ToCertBundle()
+	if err != nil {
+		return nil, errwrap.Wrapf("error converting raw signing bundle to cert bundle: {{err}}", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"certificate":   certPEM,
+			"issuing_ca":    signingCB.Certificate,
+			"serial_number": serial,
+			"expiration":    template.NotAfter.Unix(),
+			"issuer_id":     target.ID,
+		},
+	}, nil
+}
+
+func (b *backend) pathFetchIssuerRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuer, err := b.resolveIssuer(ctx, req.Storage, data.Get("issuer_ref").(string))
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		return nil, nil
+	}
+
+	var contentType, pemType string
+	var body []byte
+	switch {
+	case strings.HasPrefix(req.Path, "ca/"):
+		contentType = "application/pkix-cert"
+		pemType = "CERTIFICATE"
+		cert, err := issuer.certificate()
+		if err != nil {
+			return nil, err
+		}
+		body = cert.Raw
+	default:
+		contentType = "application/pkix-crl"
+		pemType = "X509 CRL"
+		entry, err := req.Storage.Get(ctx, issuerCRLPrefix+issuer.ID)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			body = entry.Value
+		}
+	}
+
+	if strings.HasSuffix(req.Path, "/pem") && len(body) > 0 {
+		body = []byte(strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{
+			Type:  pemType,
+			Bytes: body,
+		}))))
+	}
+
+	statusCode := 200
+	if len(body) == 0 {
+		statusCode = 204
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: contentType,
+			logical.HTTPRawBody:     body,
+			logical.HTTPStatusCode:  statusCode,
+		},
+	}, nil
+}
+
+const pathListIssuersHelpSyn = `
+List the issuers held by this mount.
+`
+
+const pathListIssuersHelpDesc = `
+Issuers are listed by ID, along with their names and which one is the
+default.
+`
+
+const pathIssuerHelpSyn = `
+Read, rename, or delete an issuer.
+`
+
+const pathIssuerHelpDesc = `
+An issuer is a CA certificate and key held by this mount. Issuers can be
+referred to by ID, by name, or as "default" for the mount's default issuer.
+Deleting an issuer removes its key; certificates it issued remain valid.
+`
+
+const pathCrossSignIssuerHelpSyn = `
+Cross-sign an issuer with another issuer of this mount.
+`
+
+const pathCrossSignIssuerHelpDesc = `
+This signs the issuer's subject and public key with the key of the issuer
+given in "signing_issuer_ref". The resulting certificate is returned with the
+CA chain of certificates the issuer signs afterwards, so clients trusting
+either issuer can validate them. This is useful while rotating a root.
+`
+
+const pathConfigIssuersHelpSyn = `
+Configure the default issuer of this mount.
+`
+
+const pathConfigIssuersHelpDesc = `
+The default issuer signs certificates for roles and endpoints that don't
+select an issuer, and its certificate and CRL are returned from the "ca" and
+"crl" endpoints.
+`
+
+const pathFetchIssuerHelpSyn = `
+Fetch an issuer's CA certificate or CRL.
+`
+
+const pathFetchIssuerHelpDesc = `
+This returns the issuer's certificate or CRL in DER encoding. Add "/pem" to
+get PEM encoding.
+`
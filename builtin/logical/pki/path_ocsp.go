@@ -0,0 +1,299 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	ocspRequestContentType  = "application/ocsp-request"
+	ocspResponseContentType = "application/ocsp-response"
+
+	// maxOCSPRequestSize bounds the size of POSTed OCSP requests; a request
+	// for a single certificate is only a few hundred bytes.
+	maxOCSPRequestSize = 64 * 1024
+)
+
+// Answers OCSP requests sent as the final path segment of a GET request, as
+// described in Appendix A.1 of RFC 6960
+func pathOCSPGet(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "ocsp/" + framework.MatchAllRegex("req"),
+		Fields: map[string]*framework.FieldSchema{
+			"req": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `The base64-encoded, DER-encoded OCSP request`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathOCSPRead,
+		},
+
+		HelpSynopsis:    pathOCSPHelpSyn,
+		HelpDescription: pathOCSPHelpDesc,
+	}
+}
+
+// Answers OCSP requests sent as the body of a POST request
+func pathOCSPPost(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "ocsp",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathOCSPWrite,
+		},
+
+		HelpSynopsis:    pathOCSPHelpSyn,
+		HelpDescription: pathOCSPHelpDesc,
+	}
+}
+
+func (b *backend) pathOCSPRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	encoded := data.Get("req").(string)
+
+	// Clients are supposed to URL-encode the request but some send the raw
+	// base64, so only unescape when needed.
+	if strings.Contains(encoded, "%") {
+		unescaped, err := url.PathUnescape(encoded)
+		if err != nil {
+			return ocspRawResponse(ocsp.MalformedRequestErrorResponse), nil
+		}
+		encoded = unescaped
+	}
+
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return ocspRawResponse(ocsp.MalformedRequestErrorResponse), nil
+	}
+
+	return b.answerOCSP(ctx, req, der)
+}
+
+func (b *backend) pathOCSPWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if req.HTTPRequest == nil || req.HTTPRequest.Body == nil {
+		return ocspRawResponse(ocsp.MalformedRequestErrorResponse), nil
+	}
+
+	der, err := ioutil.ReadAll(&io.LimitedReader{R: req.HTTPRequest.Body, N: maxOCSPRequestSize + 1})
+	if err != nil || len(der) > maxOCSPRequestSize {
+		return ocspRawResponse(ocsp.MalformedRequestErrorResponse), nil
+	}
+
+	return b.answerOCSP(ctx, req, der)
+}
+
+// answerOCSP builds a signed OCSP response for the given DER-encoded request
+// using the same revocation entries used to build the CRL.
+func (b *backend) answerOCSP(ctx context.Context, req *logical.Request, der []byte) (*logical.Response, error) {
+	crlConfig, err := b.CRL(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if crlConfig != nil && crlConfig.OCSPDisable {
+		return ocspRawResponse(ocsp.UnauthorizedErrorResponse), nil
+	}
+
+	ocspReq, err := ocsp.ParseRequest(der)
+	if err != nil {
+		return ocspRawResponse(ocsp.MalformedRequestErrorResponse), nil
+	}
+
+	caInfo, err := b.ocspIssuerFor(ctx, req, ocspReq)
+	switch err.(type) {
+	case nil:
+	case errutil.UserError:
+		return ocspRawResponse(ocsp.MalformedRequestErrorResponse), nil
+	default:
+		b.Logger().Error("failed to fetch CA for OCSP response", "error", err)
+		return ocspRawResponse(ocsp.InternalErrorErrorResponse), nil
+	}
+	if caInfo == nil {
+		// We are not authoritative for certificates of other CAs
+		return ocspRawResponse(ocsp.UnauthorizedErrorResponse), nil
+	}
+
+	template, err := b.ocspStatus(ctx, req, ocspReq.SerialNumber.Bytes())
+	if err != nil {
+		b.Logger().Error("failed to look up certificate status for OCSP response", "error", err)
+		return ocspRawResponse(ocsp.InternalErrorErrorResponse), nil
+	}
+
+	ocspLifetime := defaultOCSPExpiry
+	if crlConfig != nil && crlConfig.OCSPExpiry != "" {
+		ocspLifetime, err = time.ParseDuration(crlConfig.OCSPExpiry)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing OCSP expiry of %s", crlConfig.OCSPExpiry)
+		}
+	}
+
+	now := time.Now().UTC()
+	template.SerialNumber = ocspReq.SerialNumber
+	template.IssuerHash = ocspReq.HashAlgorithm
+	template.ThisUpdate = now
+	if ocspLifetime > 0 {
+		template.NextUpdate = now.Add(ocspLifetime)
+	}
+
+	ocspResp, err := ocsp.CreateResponse(caInfo.Certificate, caInfo.Certificate, template, caInfo.PrivateKey)
+	if err != nil {
+		b.Logger().Error("failed to sign OCSP response", "error", err)
+		return ocspRawResponse(ocsp.InternalErrorErrorResponse), nil
+	}
+
+	return ocspRawResponse(ocspResp), nil
+}
+
+// ocspIssuerFor returns the signing bundle of the issuer the request asks
+// about, or nil if none of this mount's issuers match.
+func (b *backend) ocspIssuerFor(ctx context.Context, req *logical.Request, ocspReq *ocsp.Request) (*certutil.CAInfoBundle, error) {
+	issuerIDs, err := b.listIssuers(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range issuerIDs {
+		issuer, err := getIssuer(ctx, req.Storage, id)
+		if err != nil {
+			return nil, err
+		}
+		if issuer == nil {
+			continue
+		}
+		issuerCert, err := issuer.certificate()
+		if err != nil {
+			return nil, err
+		}
+		matches, err := ocspRequestMatchesIssuer(ocspReq, issuerCert)
+		if err != nil {
+			return nil, errutil.UserError{Err: err.Error()}
+		}
+		if matches {
+			_, caInfo, err := b.fetchIssuerCAInfo(ctx, req, id)
+			return caInfo, err
+		}
+	}
+	return nil, nil
+}
+
+// ocspStatus returns a response template carrying the status of the
+// certificate with the given serial number.
+func (b *backend) ocspStatus(ctx context.Context, req *logical.Request, serialBytes []byte) (ocsp.Response, error) {
+	hyphenSerial := certutil.GetHexFormatted(serialBytes, "-")
+	colonSerial := certutil.GetHexFormatted(serialBytes, ":")
+
+	// Storage is only read here, never migrated as fetchCertBySerial does,
+	// since OCSP requests may be served by nodes that cannot write.
+	revokedEntry, err := getFirstEntry(ctx, req.Storage, "revoked/"+hyphenSerial, "revoked/"+colonSerial)
+	if err != nil {
+		return ocsp.Response{}, err
+	}
+	if revokedEntry != nil {
+		var revInfo revocationInfo
+		if err := revokedEntry.DecodeJSON(&revInfo); err != nil {
+			return ocsp.Response{}, fmt.Errorf("error decoding revocation entry for serial %s: %s", hyphenSerial, err)
+		}
+
+		revokedAt := revInfo.RevocationTimeUTC
+		if revokedAt.IsZero() {
+			revokedAt = time.Unix(revInfo.RevocationTime, 0).UTC()
+		}
+		return ocsp.Response{
+			Status:           ocsp.Revoked,
+			RevokedAt:        revokedAt,
+			RevocationReason: ocsp.Unspecified,
+		}, nil
+	}
+
+	certEntry, err := getFirstEntry(ctx, req.Storage, "certs/"+hyphenSerial, "certs/"+colonSerial)
+	if err != nil {
+		return ocsp.Response{}, err
+	}
+	if certEntry == nil {
+		return ocsp.Response{Status: ocsp.Unknown}, nil
+	}
+
+	return ocsp.Response{Status: ocsp.Good}, nil
+}
+
+// getFirstEntry returns the first storage entry found at the given keys.
+func getFirstEntry(ctx context.Context, s logical.Storage, keys ...string) (*logical.StorageEntry, error) {
+	for _, key := range keys {
+		entry, err := s.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil && len(entry.Value) > 0 {
+			return entry, nil
+		}
+	}
+	return nil, nil
+}
+
+// ocspRequestMatchesIssuer returns whether the request asks about a
+// certificate issued by the given CA certificate.
+func ocspRequestMatchesIssuer(ocspReq *ocsp.Request, issuer *x509.Certificate) (bool, error) {
+	if !ocspReq.HashAlgorithm.Available() {
+		return false, fmt.Errorf("unsupported hash algorithm")
+	}
+
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &publicKeyInfo); err != nil {
+		return false, err
+	}
+
+	nameHash := hashBytes(ocspReq.HashAlgorithm, issuer.RawSubject)
+	keyHash := hashBytes(ocspReq.HashAlgorithm, publicKeyInfo.PublicKey.RightAlign())
+
+	return bytes.Equal(nameHash, ocspReq.IssuerNameHash) && bytes.Equal(keyHash, ocspReq.IssuerKeyHash), nil
+}
+
+func hashBytes(hash crypto.Hash, data []byte) []byte {
+	h := hash.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func ocspRawResponse(body []byte) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: ocspResponseContentType,
+			logical.HTTPRawBody:     body,
+			logical.HTTPStatusCode:  200,
+		},
+	}
+}
+
+const pathOCSPHelpSyn = `
+Query a certificate's revocation status through OCSP.
+`
+
+const pathOCSPHelpDesc = `
+This endpoint implements an OCSP responder as described in RFC 6960. Requests
+may be sent either as the body of a POST request with a Content-Type of
+"application/ocsp-request", or base64-encoded as the final segment of a GET
+request to "ocsp/<request>". Responses are signed by the CA and are built from
+the same revocation entries used to generate the CRL.
+
+To have issued certificates point clients at this responder, add its URL to
+the "ocsp_servers" value of the "config/urls" endpoint.
+`
@@ -365,6 +365,16 @@ for "generate_lease".`,
 					Value: 30,
 				},
 			},
+			"issuer_ref": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: defaultIssuerRef,
+				Description: `ID or name of the issuer that signs certificates
+for this role, or "default" to follow the mount's
+default issuer. Defaults to "default".`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name: "Issuer",
+				},
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -573,6 +583,7 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 		PolicyIdentifiers:             data.Get("policy_identifiers").([]string),
 		BasicConstraintsValidForNonCA: data.Get("basic_constraints_valid_for_non_ca").(bool),
 		NotBeforeDuration:             time.Duration(data.Get("not_before_duration").(int)) * time.Second,
+		Issuer:                        data.Get("issuer_ref").(string),
 	}
 
 	allowedOtherSANs := data.Get("allowed_other_sans").([]string)
@@ -626,6 +637,16 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 		}
 	}
 
+	if entry.Issuer != defaultIssuerRef {
+		issuer, err := b.resolveIssuer(ctx, req.Storage, entry.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		if issuer == nil {
+			return logical.ErrorResponse(fmt.Sprintf("issuer %q does not exist", entry.Issuer)), nil
+		}
+	}
+
 	// Store it
 	jsonEntry, err := logical.StorageEntryJSON("role/"+name, entry)
 	if err != nil {
@@ -767,6 +788,7 @@ type roleEntry struct {
 	ExtKeyUsageOIDs               []string      `json:"ext_key_usage_oids" mapstructure:"ext_key_usage_oids"`
 	BasicConstraintsValidForNonCA bool          `json:"basic_constraints_valid_for_non_ca" mapstructure:"basic_constraints_valid_for_non_ca"`
 	NotBeforeDuration             time.Duration `json:"not_before_duration" mapstructure:"not_before_duration"`
+	Issuer                        string        `json:"issuer_ref" mapstructure:"issuer_ref"`
 
 	// Used internally for signing intermediates
 	AllowExpirationPastCA bool
@@ -818,6 +840,10 @@ func (r *roleEntry) ToResponseData() map[string]interface{} {
 	if r.GenerateLease != nil {
 		responseData["generate_lease"] = r.GenerateLease
 	}
+	responseData["issuer_ref"] = r.Issuer
+	if r.Issuer == "" {
+		responseData["issuer_ref"] = defaultIssuerRef
+	}
 	return responseData
 }
 
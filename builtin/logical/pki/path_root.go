@@ -34,6 +34,16 @@ func pathGenerateRoot(b *backend) *framework.Path {
 	ret.Fields = addCACommonFields(map[string]*framework.FieldSchema{})
 	ret.Fields = addCAKeyGenerationFields(ret.Fields)
 	ret.Fields = addCAIssueFields(ret.Fields)
+	ret.Fields = addIssuerNameField(ret.Fields)
+
+	return ret
+}
+
+func pathGenerateIssuerRoot(b *backend) *framework.Path {
+	ret := pathGenerateRoot(b)
+	ret.Pattern = "issuers/generate/root/" + framework.GenericNameRegex("exported")
+	ret.HelpSynopsis = pathGenerateIssuerRootHelpSyn
+	ret.HelpDescription = pathGenerateIssuerRootHelpDesc
 
 	return ret
 }
@@ -67,6 +77,7 @@ func pathSignIntermediate(b *backend) *framework.Path {
 
 	ret.Fields = addCACommonFields(map[string]*framework.FieldSchema{})
 	ret.Fields = addCAIssueFields(ret.Fields)
+	ret.Fields = addIssuerRefField(ret.Fields)
 
 	ret.Fields["csr"] = &framework.FieldSchema{
 		Type:        framework.TypeString,
@@ -110,24 +121,64 @@ func pathSignSelfIssued(b *backend) *framework.Path {
 		HelpDescription: pathSignSelfIssuedHelpDesc,
 	}
 
+	ret.Fields = addIssuerRefField(ret.Fields)
+
 	return ret
 }
 
 func (b *backend) pathCADeleteRoot(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return nil, req.Storage.Delete(ctx, "config/ca_bundle")
+	issuerIDs, err := b.listIssuers(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	for _, id := range issuerIDs {
+		if err := req.Storage.Delete(ctx, issuerPrefix+id); err != nil {
+			return nil, err
+		}
+		if err := req.Storage.Delete(ctx, issuerCRLPrefix+id); err != nil {
+			return nil, err
+		}
+	}
+
+	// As before issuers existed, the old CA certificate and CRL remain
+	// readable until a new CA is configured
+	for _, key := range []string{issuersConfigKey, legacyCABundleKey} {
+		if err := req.Storage.Delete(ctx, key); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
 }
 
 func (b *backend) pathCAGenerateRoot(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	var err error
 
-	entry, err := req.Storage.Get(ctx, "config/ca_bundle")
-	if err != nil {
-		return nil, err
+	// The legacy endpoint only sets up the mount's first CA; additional
+	// issuers are generated via issuers/generate/root
+	if !strings.HasPrefix(req.Path, "issuers/") {
+		issuerIDs, err := b.listIssuers(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := req.Storage.Get(ctx, legacyCABundleKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(issuerIDs) > 0 || entry != nil {
+			resp := &logical.Response{}
+			resp.AddWarning(fmt.Sprintf("Refusing to generate a root certificate over an existing root certificate. If you really want to destroy the original root certificate, please issue a delete against %sroot. To add another root to this mount, use %sissuers/generate/root.", req.MountPoint, req.MountPoint))
+			return resp, nil
+		}
 	}
-	if entry != nil {
-		resp := &logical.Response{}
-		resp.AddWarning(fmt.Sprintf("Refusing to generate a root certificate over an existing root certificate. If you really want to destroy the original root certificate, please issue a delete against %sroot.", req.MountPoint))
-		return resp, nil
+
+	issuerName := data.Get("issuer_name").(string)
+	if err := b.validateIssuerName(ctx, req.Storage, "", issuerName); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
 
 	exported, format, role, errorResp := b.getGenerationParams(data)
@@ -204,15 +255,19 @@ func (b *backend) pathCAGenerateRoot(ctx context.Context, req *logical.Request,
 		}
 	}
 
-	// Store it as the CA bundle
-	entry, err = logical.StorageEntryJSON("config/ca_bundle", cb)
+	// Store it as a new issuer; it only becomes the default if this mount
+	// has no other issuers
+	issuer, err := b.importIssuer(ctx, req, cb, issuerName, false)
 	if err != nil {
-		return nil, err
-	}
-	err = req.Storage.Put(ctx, entry)
-	if err != nil {
-		return nil, err
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
 	}
+	resp.Data["issuer_id"] = issuer.ID
+	resp.Data["issuer_name"] = issuer.Name
 
 	// Also store it as just the certificate identified by serial number, so it
 	// can be revoked
@@ -224,15 +279,6 @@ func (b *backend) pathCAGenerateRoot(ctx context.Context, req *logical.Request,
 		return nil, errwrap.Wrapf("unable to store certificate locally: {{err}}", err)
 	}
 
-	// For ease of later use, also store just the certificate at a known
-	// location
-	entry.Key = "ca"
-	entry.Value = parsedBundle.CertificateBytes
-	err = req.Storage.Put(ctx, entry)
-	if err != nil {
-		return nil, err
-	}
-
 	// Build a fresh CRL
 	err = buildCRL(ctx, b, req, true)
 	if err != nil {
@@ -280,7 +326,7 @@ func (b *backend) pathCASignIntermediate(ctx context.Context, req *logical.Reque
 	}
 
 	var caErr error
-	signingBundle, caErr := fetchCAInfo(ctx, req)
+	_, signingBundle, caErr := b.fetchIssuerCAInfo(ctx, req, data.Get("issuer_ref").(string))
 	switch caErr.(type) {
 	case errutil.UserError:
 		return nil, errutil.UserError{Err: fmt.Sprintf(
@@ -406,7 +452,7 @@ func (b *backend) pathCASignSelfIssued(ctx context.Context, req *logical.Request
 	}
 
 	var caErr error
-	signingBundle, caErr := fetchCAInfo(ctx, req)
+	_, signingBundle, caErr := b.fetchIssuerCAInfo(ctx, req, data.Get("issuer_ref").(string))
 	switch caErr.(type) {
 	case errutil.UserError:
 		return nil, errutil.UserError{Err: fmt.Sprintf(
@@ -457,8 +503,20 @@ const pathGenerateRootHelpDesc = `
 See the API documentation for more information.
 `
 
+const pathGenerateIssuerRootHelpSyn = `
+Generate a new root CA as an additional issuer of this mount.
+`
+
+const pathGenerateIssuerRootHelpDesc = `
+This works like "root/generate", but adds the root alongside any existing
+issuers rather than refusing to replace them. The new issuer only becomes
+the default if the mount has no other issuers; use "config/issuers" to
+change the default and "issuer/:ref/cross-sign" to keep existing chains
+valid while rotating.
+`
+
 const pathDeleteRootHelpSyn = `
-Deletes the root CA key to allow a new one to be generated.
+Deletes all issuers and their keys from the mount.
 `
 
 const pathDeleteRootHelpDesc = `
@@ -2,10 +2,16 @@ package transit
 
 import (
 	"context"
+	"encoding/base64"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/errwrap"
+	multierror "github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/helper/jsonutil"
 	"github.com/hashicorp/vault/sdk/helper/keysutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -28,6 +34,7 @@ func Backend(ctx context.Context, conf *logical.BackendConfig) (*backend, error)
 		PathsSpecial: &logical.Paths{
 			SealWrapStorage: []string{
 				"archive/",
+				"import/",
 				"policy/",
 			},
 		},
@@ -37,27 +44,41 @@ func Backend(ctx context.Context, conf *logical.BackendConfig) (*backend, error)
 			// as the handler is greedy
 			b.pathConfig(),
 			b.pathRotate(),
+			b.pathImport(),
+			b.pathImportVersion(),
 			b.pathRewrap(),
 			b.pathKeys(),
 			b.pathListKeys(),
 			b.pathExportKeys(),
+			b.pathEscrowExport(),
+			b.pathEscrowImport(),
 			b.pathEncrypt(),
 			b.pathDecrypt(),
+			b.pathEncode(),
+			b.pathDecode(),
+			b.pathEncryptStream(),
+			b.pathDecryptStream(),
 			b.pathDatakey(),
 			b.pathRandom(),
 			b.pathHash(),
 			b.pathHMAC(),
+			b.pathCMAC(),
+			b.pathVerifyCMAC(),
+			b.pathKMAC(),
+			b.pathVerifyKMAC(),
 			b.pathSign(),
 			b.pathVerify(),
 			b.pathBackup(),
 			b.pathRestore(),
 			b.pathTrim(),
 			b.pathCacheConfig(),
+			b.pathWrappingKey(),
 		},
 
-		Secrets:     []*framework.Secret{},
-		Invalidate:  b.invalidate,
-		BackendType: logical.TypeLogical,
+		Secrets:      []*framework.Secret{},
+		Invalidate:   b.invalidate,
+		BackendType:  logical.TypeLogical,
+		PeriodicFunc: b.periodicFunc,
 	}
 
 	// determine cacheSize to use. Defaults to 0 which means unlimited
@@ -83,6 +104,9 @@ func Backend(ctx context.Context, conf *logical.BackendConfig) (*backend, error)
 type backend struct {
 	*framework.Backend
 	lm *keysutil.LockManager
+
+	// wrappingKeyLock guards generation of the key import wrapping key
+	wrappingKeyLock sync.Mutex
 }
 
 func GetCacheSizeFromStorage(ctx context.Context, s logical.Storage) (int, error) {
@@ -111,3 +135,141 @@ func (b *backend) invalidate(_ context.Context, key string) {
 		b.lm.InvalidatePolicy(name)
 	}
 }
+
+// autoRotateIndexPrefix is the storage prefix of the index of the keys that
+// have automatic rotation configured, so that the periodic function does not
+// need to load every key.
+const autoRotateIndexPrefix = "auto-rotate/"
+
+// updateAutoRotateIndex adds the named key to the index of the keys that have
+// automatic rotation configured, or removes it from the index if it does not.
+func updateAutoRotateIndex(ctx context.Context, s logical.Storage, name string, p *keysutil.Policy) error {
+	if p.AutoRotatePeriod > 0 || p.MaxEncryptionsPerVersion > 0 {
+		return s.Put(ctx, &logical.StorageEntry{
+			Key: autoRotateIndexPrefix + name,
+		})
+	}
+	return s.Delete(ctx, autoRotateIndexPrefix+name)
+}
+
+// indexRestoredKey updates the index of the keys that have automatic rotation
+// configured for a key restored from the given backup.
+func indexRestoredKey(ctx context.Context, s logical.Storage, name, backupB64 string) error {
+	backupBytes, err := base64.StdEncoding.DecodeString(backupB64)
+	if err != nil {
+		return err
+	}
+	var keyData keysutil.KeyData
+	if err := jsonutil.DecodeJSON(backupBytes, &keyData); err != nil {
+		return err
+	}
+	if keyData.Policy == nil {
+		return nil
+	}
+	if name == "" {
+		name = keyData.Policy.Name
+	}
+	return updateAutoRotateIndex(ctx, s, name, keyData.Policy)
+}
+
+// periodicFunc is invoked once a minute by the RollbackManager. It rotates the
+// keys that are due for automatic rotation and persists the encryption counts
+// of the keys that have a usage limit. Only the keys in the index of the keys
+// that have automatic rotation configured are loaded.
+func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	if !b.System().LocalMount() && b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary|consts.ReplicationPerformanceStandby) {
+		return nil
+	}
+
+	names, err := req.Storage.List(ctx, autoRotateIndexPrefix)
+	if err != nil {
+		return err
+	}
+
+	var errs *multierror.Error
+	for _, name := range names {
+		if err := b.autoRotate(ctx, req.Storage, name); err != nil {
+			errs = multierror.Append(errs, errwrap.Wrapf("error rotating key "+name+": {{err}}", err))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+func (b *backend) autoRotate(ctx context.Context, s logical.Storage, name string) error {
+	p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: s,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return s.Delete(ctx, autoRotateIndexPrefix+name)
+	}
+
+	if !b.System().CachingDisabled() {
+		// Most keys need nothing, so check under the read lock first
+		p.Lock(false)
+		needed := p.NeedsAutoRotation(time.Now()) || p.HasPendingEncryptions()
+		p.Unlock()
+		if !needed {
+			return nil
+		}
+		p.Lock(true)
+	}
+	defer p.Unlock()
+
+	if p.NeedsAutoRotation(time.Now()) {
+		b.Logger().Info("automatically rotating key", "name", name)
+		return p.Rotate(ctx, s, b.GetRandomReader())
+	}
+	if p.HasPendingEncryptions() {
+		return p.Persist(ctx, s)
+	}
+	return nil
+}
+
+// autoRotateAfterUse is deferred by the paths encrypting with a key, once the
+// policy is unlocked. It rotates the key if its latest version reached its
+// usage limit. Failures are only logged, as the rotation is retried by the
+// periodic function.
+func (b *backend) autoRotateAfterUse(ctx context.Context, s logical.Storage, p *keysutil.Policy) {
+	var err error
+	if b.System().CachingDisabled() {
+		err = b.persistUsage(ctx, s, p)
+	} else if p.AutoRotationPending() {
+		p.Lock(true)
+		// Another request may have rotated the key in the meantime
+		if p.AutoRotationPending() {
+			err = p.Rotate(ctx, s, b.GetRandomReader())
+		}
+		p.Unlock()
+	}
+	if err != nil {
+		b.Logger().Error("error automatically rotating key", "name", p.Name, "error", err)
+	}
+}
+
+// persistUsage persists the encryptions counted by a request when the policy
+// cache is disabled, as each request then loads its own instance of the
+// policy, and rotates the key if it reached its usage limit.
+func (b *backend) persistUsage(ctx context.Context, s logical.Storage, p *keysutil.Policy) error {
+	if !p.HasPendingEncryptions() {
+		return nil
+	}
+
+	current, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: s,
+		Name:    p.Name,
+	}, b.GetRandomReader())
+	if err != nil || current == nil {
+		return err
+	}
+	defer current.Unlock()
+
+	current.MergePendingEncryptions(p)
+	if current.NeedsAutoRotation(time.Now()) {
+		return current.Rotate(ctx, s, b.GetRandomReader())
+	}
+	return current.Persist(ctx, s)
+}
@@ -15,6 +15,9 @@ func TestTransit_BackupRestore(t *testing.T) {
 	testBackupRestore(t, "rsa-2048", "encrypt-decrypt")
 	testBackupRestore(t, "rsa-4096", "encrypt-decrypt")
 
+	// Test format-preserving encoding/decoding after a restore
+	testBackupRestore(t, "ff3-1-aes256", "encode-decode")
+
 	// Test signing/verification after a restore for supported keys
 	testBackupRestore(t, "ecdsa-p256", "sign-verify")
 	testBackupRestore(t, "ecdsa-p384", "sign-verify")
@@ -33,6 +36,7 @@ func TestTransit_BackupRestore(t *testing.T) {
 	testBackupRestore(t, "ed25519", "hmac-verify")
 	testBackupRestore(t, "rsa-2048", "hmac-verify")
 	testBackupRestore(t, "rsa-4096", "hmac-verify")
+	testBackupRestore(t, "ff3-1-aes256", "hmac-verify")
 }
 
 func testBackupRestore(t *testing.T, keyType, feature string) {
@@ -105,7 +109,7 @@ func testBackupRestore(t *testing.T, keyType, feature string) {
 
 	// Perform encryption, signing or hmac-ing based on the set 'feature'
 	var encryptReq, signReq, hmacReq *logical.Request
-	var ciphertext, signature, hmac string
+	var ciphertext, signature, hmac, encoded string
 	switch feature {
 	case "encrypt-decrypt":
 		encryptReq = &logical.Request{
@@ -122,6 +126,21 @@ func testBackupRestore(t *testing.T, keyType, feature string) {
 		}
 		ciphertext = resp.Data["ciphertext"].(string)
 
+	case "encode-decode":
+		encodeReq := &logical.Request{
+			Path:      "encode/test",
+			Operation: logical.UpdateOperation,
+			Storage:   s,
+			Data: map[string]interface{}{
+				"value": "4111111111111111",
+			},
+		}
+		resp, err = b.HandleRequest(context.Background(), encodeReq)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("resp: %#v\nerr: %v", resp, err)
+		}
+		encoded = resp.Data["encoded_value"].(string)
+
 	case "sign-verify":
 		signReq = &logical.Request{
 			Path:      "sign/test",
@@ -189,6 +208,23 @@ func testBackupRestore(t *testing.T, keyType, feature string) {
 			if resp.Data["plaintext"].(string) != plaintextB64 {
 				t.Fatalf("bad: plaintext; expected: %q, actual: %q", plaintextB64, resp.Data["plaintext"].(string))
 			}
+		case "encode-decode":
+			decodeReq := &logical.Request{
+				Path:      "decode/" + keyName,
+				Operation: logical.UpdateOperation,
+				Storage:   s,
+				Data: map[string]interface{}{
+					"value":       encoded,
+					"key_version": 1,
+				},
+			}
+			resp, err = b.HandleRequest(context.Background(), decodeReq)
+			if err != nil || (resp != nil && resp.IsError()) {
+				t.Fatalf("resp: %#v\nerr: %v", resp, err)
+			}
+			if resp.Data["decoded_value"].(string) != "4111111111111111" {
+				t.Fatalf("bad: decoded value; expected: %q, actual: %q", "4111111111111111", resp.Data["decoded_value"].(string))
+			}
 		case "sign-verify":
 			verifyReq = &logical.Request{
 				Path:      "verify/" + keyName,
@@ -0,0 +1,443 @@
+package transit
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	macTypeCMAC = "cmac"
+	macTypeKMAC = "kmac"
+)
+
+// batchRequestMACItem represents a request item for batch processing.
+// A map type allows us to distinguish between empty and missing values.
+type batchRequestMACItem map[string]string
+
+// batchResponseMACItem represents a response item for batch processing
+type batchResponseMACItem struct {
+	// CMAC for the input present in the corresponding batch request item
+	CMAC string `json:"cmac,omitempty" mapstructure:"cmac"`
+
+	// KMAC for the input present in the corresponding batch request item
+	KMAC string `json:"kmac,omitempty" mapstructure:"kmac"`
+
+	// Valid indicates whether the MAC matches the MAC derived from the input
+	Valid bool `json:"valid,omitempty" mapstructure:"valid"`
+
+	// Error, if set represents a failure encountered while processing the
+	// corresponding batch request item
+	Error string `json:"error,omitempty" mapstructure:"error"`
+
+	// As for HMAC, both the error response and the error are kept to mimic
+	// the handling of a single input
+	err error
+}
+
+func macFields(macType string, verify bool) map[string]*framework.FieldSchema {
+	fields := map[string]*framework.FieldSchema{
+		"name": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The key to use",
+		},
+
+		"input": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The base64-encoded input data",
+		},
+
+		"context": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Base64 encoded context for key derivation. Required if key derivation is enabled",
+		},
+	}
+
+	if macType == macTypeKMAC {
+		fields["algorithm"] = &framework.FieldSchema{
+			Type:    framework.TypeString,
+			Default: "kmac256",
+			Description: `Algorithm to use. Valid values are:
+
+* kmac128
+* kmac256
+
+Defaults to "kmac256".`,
+		}
+		fields["customization"] = &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The base64-encoded customization string",
+		}
+	}
+
+	if verify {
+		fields[macType] = &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: fmt.Sprintf("The %s, including vault header/key version", strings.ToUpper(macType)),
+		}
+	} else {
+		fields["key_version"] = &framework.FieldSchema{
+			Type: framework.TypeInt,
+			Description: fmt.Sprintf(`The version of the key to use for generating the %s.
+Must be 0 (for latest) or a value greater than or equal
+to the min_encryption_version configured on the key.`, strings.ToUpper(macType)),
+		}
+	}
+
+	return fields
+}
+
+func (b *backend) pathCMAC() *framework.Path {
+	return &framework.Path{
+		Pattern: "cmac/" + framework.GenericNameRegex("name"),
+		Fields:  macFields(macTypeCMAC, false),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathMACWrite(macTypeCMAC),
+		},
+
+		HelpSynopsis:    pathCMACHelpSyn,
+		HelpDescription: pathCMACHelpDesc,
+	}
+}
+
+func (b *backend) pathVerifyCMAC() *framework.Path {
+	return &framework.Path{
+		Pattern: "verify-cmac/" + framework.GenericNameRegex("name"),
+		Fields:  macFields(macTypeCMAC, true),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathMACVerify(macTypeCMAC),
+		},
+
+		HelpSynopsis:    pathVerifyCMACHelpSyn,
+		HelpDescription: pathVerifyCMACHelpDesc,
+	}
+}
+
+func (b *backend) pathKMAC() *framework.Path {
+	return &framework.Path{
+		Pattern: "kmac/" + framework.GenericNameRegex("name"),
+		Fields:  macFields(macTypeKMAC, false),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathMACWrite(macTypeKMAC),
+		},
+
+		HelpSynopsis:    pathKMACHelpSyn,
+		HelpDescription: pathKMACHelpDesc,
+	}
+}
+
+func (b *backend) pathVerifyKMAC() *framework.Path {
+	return &framework.Path{
+		Pattern: "verify-kmac/" + framework.GenericNameRegex("name"),
+		Fields:  macFields(macTypeKMAC, true),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathMACVerify(macTypeKMAC),
+		},
+
+		HelpSynopsis:    pathVerifyKMACHelpSyn,
+		HelpDescription: pathVerifyKMACHelpDesc,
+	}
+}
+
+// parseMACBatchInput returns the items to process, either from batch_input or
+// from the fields of a single request.
+func parseMACBatchInput(d *framework.FieldData, fields ...string) ([]batchRequestMACItem, *logical.Response, error) {
+	batchInputRaw := d.Raw["batch_input"]
+	var batchInputItems []batchRequestMACItem
+	if batchInputRaw != nil {
+		err := mapstructure.Decode(batchInputRaw, &batchInputItems)
+		if err != nil {
+			return nil, nil, errwrap.Wrapf("failed to parse batch input: {{err}}", err)
+		}
+
+		if len(batchInputItems) == 0 {
+			return nil, logical.ErrorResponse("missing batch input to process"), logical.ErrInvalidRequest
+		}
+		return batchInputItems, nil, nil
+	}
+
+	item := batchRequestMACItem{}
+	for _, field := range fields {
+		if _, ok := d.Schema[field]; !ok {
+			continue
+		}
+		if value, ok := d.GetOk(field); ok {
+			item[field] = value.(string)
+		}
+	}
+	return []batchRequestMACItem{item}, nil, nil
+}
+
+// computeMAC decodes the input of a batch item and computes its MAC with the
+// given key version.
+func computeMAC(p *keysutil.Policy, macType string, kmacBits int, ver int, item batchRequestMACItem) ([]byte, error) {
+	rawInput, ok := item["input"]
+	if !ok {
+		return nil, errutil.UserError{Err: fmt.Sprintf("missing input for %s", strings.ToUpper(macType))}
+	}
+	input, err := base64.StdEncoding.DecodeString(rawInput)
+	if err != nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("unable to decode input as base64: %s", err)}
+	}
+
+	var macContext []byte
+	if item["context"] != "" {
+		macContext, err = base64.StdEncoding.DecodeString(item["context"])
+		if err != nil {
+			return nil, errutil.UserError{Err: fmt.Sprintf("failed to base64-decode context: %s", err)}
+		}
+	}
+
+	if macType == macTypeCMAC {
+		return p.CMAC(ver, macContext, input)
+	}
+
+	var customization []byte
+	if item["customization"] != "" {
+		customization, err = base64.StdEncoding.DecodeString(item["customization"])
+		if err != nil {
+			return nil, errutil.UserError{Err: fmt.Sprintf("failed to base64-decode customization: %s", err)}
+		}
+	}
+	return p.KMAC(ver, kmacBits, macContext, customization, input)
+}
+
+func kmacBits(algorithm string) (int, error) {
+	switch algorithm {
+	case "kmac128":
+		return 128, nil
+	case "kmac256":
+		return 256, nil
+	default:
+		return 0, fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+}
+
+func setMACItemError(item *batchResponseMACItem, err error) {
+	switch err.(type) {
+	case errutil.UserError:
+		item.Error = err.Error()
+		item.err = logical.ErrInvalidRequest
+	default:
+		item.Error = err.Error()
+		item.err = err
+	}
+}
+
+func macResponse(d *framework.FieldData, response []batchResponseMACItem, single func(batchResponseMACItem) map[string]interface{}) (*logical.Response, error) {
+	resp := &logical.Response{}
+	if d.Raw["batch_input"] != nil {
+		resp.Data = map[string]interface{}{
+			"batch_results": response,
+		}
+		return resp, nil
+	}
+
+	if response[0].Error != "" || response[0].err != nil {
+		if response[0].Error != "" {
+			return logical.ErrorResponse(response[0].Error), response[0].err
+		}
+		return nil, response[0].err
+	}
+	resp.Data = single(response[0])
+	return resp, nil
+}
+
+func (b *backend) pathMACWrite(macType string) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		var bits int
+		if macType == macTypeKMAC {
+			var err error
+			bits, err = kmacBits(d.Get("algorithm").(string))
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+			}
+		}
+
+		batchInputItems, errResp, err := parseMACBatchInput(d, "input", "context", "customization")
+		if errResp != nil || err != nil {
+			return errResp, err
+		}
+
+		// Get the policy
+		p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
+			Storage: req.Storage,
+			Name:    d.Get("name").(string),
+		}, b.GetRandomReader())
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
+		}
+		if !b.System().CachingDisabled() {
+			p.Lock(false)
+		}
+		defer p.Unlock()
+
+		ver := d.Get("key_version").(int)
+		switch {
+		case ver == 0:
+			ver = p.LatestVersion
+		case p.MinEncryptionVersion > 0 && ver < p.MinEncryptionVersion:
+			return logical.ErrorResponse("cannot generate %s: version is too old (disallowed by policy)", strings.ToUpper(macType)), logical.ErrInvalidRequest
+		}
+
+		response := make([]batchResponseMACItem, len(batchInputItems))
+		for i, item := range batchInputItems {
+			mac, err := computeMAC(p, macType, bits, ver, item)
+			if err != nil {
+				setMACItemError(&response[i], err)
+				continue
+			}
+
+			macStr := fmt.Sprintf("vault:v%d:%s", ver, base64.StdEncoding.EncodeToString(mac))
+			if macType == macTypeCMAC {
+				response[i].CMAC = macStr
+			} else {
+				response[i].KMAC = macStr
+			}
+		}
+
+		return macResponse(d, response, func(item batchResponseMACItem) map[string]interface{} {
+			if macType == macTypeCMAC {
+				return map[string]interface{}{"cmac": item.CMAC}
+			}
+			return map[string]interface{}{"kmac": item.KMAC}
+		})
+	}
+}
+
+func (b *backend) pathMACVerify(macType string) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		var bits int
+		if macType == macTypeKMAC {
+			var err error
+			bits, err = kmacBits(d.Get("algorithm").(string))
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+			}
+		}
+
+		batchInputItems, errResp, err := parseMACBatchInput(d, "input", "context", "customization", macType)
+		if errResp != nil || err != nil {
+			return errResp, err
+		}
+
+		// Get the policy
+		p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
+			Storage: req.Storage,
+			Name:    d.Get("name").(string),
+		}, b.GetRandomReader())
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
+		}
+		if !b.System().CachingDisabled() {
+			p.Lock(false)
+		}
+		defer p.Unlock()
+
+		response := make([]batchResponseMACItem, len(batchInputItems))
+		for i, item := range batchInputItems {
+			verificationMAC, ok := item[macType]
+			if !ok {
+				response[i].Error = fmt.Sprintf("missing %s", macType)
+				response[i].err = logical.ErrInvalidRequest
+				continue
+			}
+
+			// Verify the prefix
+			if !strings.HasPrefix(verificationMAC, "vault:v") {
+				response[i].Error = fmt.Sprintf("invalid %s to verify: no prefix", strings.ToUpper(macType))
+				response[i].err = logical.ErrInvalidRequest
+				continue
+			}
+
+			splitVerificationMAC := strings.SplitN(strings.TrimPrefix(verificationMAC, "vault:v"), ":", 2)
+			if len(splitVerificationMAC) != 2 {
+				response[i].Error = fmt.Sprintf("invalid %s: wrong number of fields", strings.ToUpper(macType))
+				response[i].err = logical.ErrInvalidRequest
+				continue
+			}
+
+			ver, err := strconv.Atoi(splitVerificationMAC[0])
+			if err != nil {
+				response[i].Error = fmt.Sprintf("invalid %s: version number could not be decoded", strings.ToUpper(macType))
+				response[i].err = logical.ErrInvalidRequest
+				continue
+			}
+
+			verBytes, err := base64.StdEncoding.DecodeString(splitVerificationMAC[1])
+			if err != nil {
+				response[i].Error = fmt.Sprintf("unable to decode verification %s as base64: %s", strings.ToUpper(macType), err)
+				response[i].err = logical.ErrInvalidRequest
+				continue
+			}
+
+			if p.MinDecryptionVersion > 0 && ver < p.MinDecryptionVersion {
+				response[i].Error = fmt.Sprintf("cannot verify %s: version is too old (disallowed by policy)", strings.ToUpper(macType))
+				response[i].err = logical.ErrInvalidRequest
+				continue
+			}
+
+			mac, err := computeMAC(p, macType, bits, ver, item)
+			if err != nil {
+				setMACItemError(&response[i], err)
+				continue
+			}
+			response[i].Valid = hmac.Equal(mac, verBytes)
+		}
+
+		return macResponse(d, response, func(item batchResponseMACItem) map[string]interface{} {
+			return map[string]interface{}{"valid": item.Valid}
+		})
+	}
+}
+
+const pathCMACHelpSyn = `Generate a CMAC for input data using the named key`
+
+const pathCMACHelpDesc = `
+Generates an AES-CMAC (RFC 4493) of the given input data using the named AES
+key. The CMAC is computed with a key derived from the named key with HKDF,
+unless the key was imported with cmac_raw_key set, in which case the imported
+key itself is used. CMACs which other parties holding the key must be able to
+verify therefore require importing the key with cmac_raw_key=true.
+`
+
+const pathVerifyCMACHelpSyn = `Verify a CMAC for input data using the named key`
+
+const pathVerifyCMACHelpDesc = `
+Verifies an AES-CMAC generated by the cmac path against the given input data
+using the named AES key.
+`
+
+const pathKMACHelpSyn = `Generate a KMAC for input data using the named key`
+
+const pathKMACHelpDesc = `
+Generates a 256 bit KMAC128 or KMAC256 (NIST SP 800-185) of the given input data
+and optional customization string using the named symmetric key.
+`
+
+const pathVerifyKMACHelpSyn = `Verify a KMAC for input data using the named key`
+
+const pathVerifyKMACHelpDesc = `
+Verifies a KMAC generated by the kmac path against the given input data and
+customization string using the named symmetric key.
+`
@@ -0,0 +1,243 @@
+package transit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestTransit_CMAC(t *testing.T) {
+	var resp *logical.Response
+	var err error
+
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   s,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp
+	}
+
+	doReq("keys/aes128", map[string]interface{}{
+		"type": "aes128-gcm96",
+	})
+	doReq("keys/ed25519", map[string]interface{}{
+		"type": "ed25519",
+	})
+
+	// CMACs are computed with a key dedicated to them rather than with the
+	// encryption key, so they do not match the RFC 4493 test vectors even
+	// once the key is set to the one of the vectors
+	p, _, err := b.lm.GetPolicy(context.Background(), keysutil.PolicyRequest{
+		Storage: s,
+		Name:    "aes128",
+	}, b.GetRandomReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawKey, _ := hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	keyEntry := p.Keys[strconv.Itoa(p.LatestVersion)]
+	keyEntry.Key = rawKey
+	p.Keys[strconv.Itoa(p.LatestVersion)] = keyEntry
+	if err = p.Persist(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+
+	message, _ := hex.DecodeString("6bc1bee22e409f96e93d7e117393172a")
+	input := base64.StdEncoding.EncodeToString(message)
+	expected, _ := hex.DecodeString("070a16b46b4d4144f79bdd9dd04a287c")
+
+	resp = doReq("cmac/aes128", map[string]interface{}{
+		"input": input,
+	})
+	cmac := resp.Data["cmac"].(string)
+	if cmac == "vault:v1:"+base64.StdEncoding.EncodeToString(expected) {
+		t.Fatalf("expected CMAC not to be computed with the encryption key: %s", cmac)
+	}
+
+	// Imported keys can opt into computing CMACs with the raw key
+	doReq("keys/raw/import", map[string]interface{}{
+		"type":         "aes128-gcm96",
+		"ciphertext":   wrapTargetKey(t, b, s, rawKey),
+		"cmac_raw_key": true,
+	})
+	resp = doReq("cmac/raw", map[string]interface{}{
+		"input": input,
+	})
+	if resp.Data["cmac"] != "vault:v1:"+base64.StdEncoding.EncodeToString(expected) {
+		t.Fatalf("bad CMAC with the raw key: %s", resp.Data["cmac"])
+	}
+
+	resp = doReq("verify-cmac/aes128", map[string]interface{}{
+		"input": input,
+		"cmac":  cmac,
+	})
+	if !resp.Data["valid"].(bool) {
+		t.Fatalf("expected CMAC to be valid: %#v", resp.Data)
+	}
+	resp = doReq("verify-cmac/aes128", map[string]interface{}{
+		"input": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+		"cmac":  cmac,
+	})
+	if resp.Data["valid"].(bool) {
+		t.Fatalf("expected CMAC of another input to be invalid: %#v", resp.Data)
+	}
+
+	// CMAC is only supported with AES keys
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "cmac/ed25519",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"input": input,
+		},
+	})
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error computing a CMAC with an ed25519 key, got resp:%#v", resp)
+	}
+
+	// Batch input reports errors per item
+	resp = doReq("cmac/aes128", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"input": input},
+			map[string]interface{}{"input": "not base64"},
+			map[string]interface{}{},
+		},
+	})
+	results := resp.Data["batch_results"].([]batchResponseMACItem)
+	if results[0].CMAC != cmac || results[1].Error == "" || results[2].Error == "" {
+		t.Fatalf("bad batch results: %#v", results)
+	}
+
+	resp = doReq("verify-cmac/aes128", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"input": input, "cmac": cmac},
+			map[string]interface{}{"input": input, "cmac": "vault:v1:AAAA"},
+			map[string]interface{}{"input": input},
+		},
+	})
+	results = resp.Data["batch_results"].([]batchResponseMACItem)
+	if !results[0].Valid || results[1].Valid || results[1].Error != "" || results[2].Error == "" {
+		t.Fatalf("bad batch results: %#v", results)
+	}
+
+	// CMACs of versions below the min decryption version are not verified
+	doReq("keys/aes128/rotate", nil)
+	doReq("keys/aes128/config", map[string]interface{}{
+		"min_decryption_version": 2,
+	})
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "verify-cmac/aes128",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"input": input,
+			"cmac":  cmac,
+		},
+	})
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error verifying a CMAC below the min decryption version, got resp:%#v", resp)
+	}
+}
+
+func TestTransit_KMAC(t *testing.T) {
+	var resp *logical.Response
+	var err error
+
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   s,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp
+	}
+
+	doReq("keys/derived", map[string]interface{}{
+		"type":    "chacha20-poly1305",
+		"derived": true,
+	})
+
+	input := "dGhlIHF1aWNrIGJyb3duIGZveA=="
+	keyContext := base64.StdEncoding.EncodeToString([]byte("device-1"))
+	customization := base64.StdEncoding.EncodeToString([]byte("firmware"))
+
+	// Derived keys require a context
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "kmac/derived",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"input": input,
+		},
+	})
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error computing a KMAC without context, got resp:%#v", resp)
+	}
+
+	for _, algorithm := range []string{"kmac128", "kmac256"} {
+		resp = doReq("kmac/derived", map[string]interface{}{
+			"input":         input,
+			"context":       keyContext,
+			"customization": customization,
+			"algorithm":     algorithm,
+		})
+		kmac := resp.Data["kmac"].(string)
+
+		for _, tc := range []struct {
+			context       string
+			customization string
+			algorithm     string
+			valid         bool
+		}{
+			{keyContext, customization, algorithm, true},
+			{base64.StdEncoding.EncodeToString([]byte("device-2")), customization, algorithm, false},
+			{keyContext, "", algorithm, false},
+		} {
+			resp = doReq("verify-kmac/derived", map[string]interface{}{
+				"input":         input,
+				"context":       tc.context,
+				"customization": tc.customization,
+				"algorithm":     tc.algorithm,
+				"kmac":          kmac,
+			})
+			if resp.Data["valid"].(bool) != tc.valid {
+				t.Fatalf("bad verification of %s with context %q and customization %q: %#v", algorithm, tc.context, tc.customization, resp.Data)
+			}
+		}
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "kmac/derived",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"input":     input,
+			"context":   keyContext,
+			"algorithm": "sha2-256",
+		},
+	})
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error with an unsupported algorithm, got resp:%#v", resp)
+	}
+}
@@ -3,12 +3,17 @@ package transit
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/keysutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
+// minAutoRotatePeriod is the smallest auto rotate period that can be set on a
+// key, as the periodic function checking it only runs once a minute
+const minAutoRotatePeriod = time.Hour
+
 func (b *backend) pathConfig() *framework.Path {
 	return &framework.Path{
 		Pattern: "keys/" + framework.GenericNameRegex("name") + "/config",
@@ -47,6 +52,29 @@ the latest version of the key is allowed.`,
 				Type:        framework.TypeBool,
 				Description: `Enables taking a backup of the named key in plaintext format. Once set, this cannot be disabled.`,
 			},
+
+			"escrow_export": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Restricts the export of the key to Shamir
+shares encrypted to PGP keys through the 'escrow/export'
+endpoint. Once set, this cannot be disabled.`,
+			},
+
+			"auto_rotate_period": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `If set, the age after which the latest version
+of the key is rotated automatically. Must be at least
+one hour. Set to zero to disable automatic rotation.`,
+			},
+
+			"max_encryptions_per_version": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `If set, the number of encryptions after which
+the latest version of the key is rotated automatically.
+The count is approximate, as the encryptions counted
+since it was last persisted are lost if the node stops.
+Set to zero to disable the limit.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -84,6 +112,9 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *
 	originalDeletionAllowed := p.DeletionAllowed
 	originalExportable := p.Exportable
 	originalAllowPlaintextBackup := p.AllowPlaintextBackup
+	originalEscrowExport := p.EscrowExport
+	originalAutoRotatePeriod := p.AutoRotatePeriod
+	originalMaxEncryptionsPerVersion := p.MaxEncryptionsPerVersion
 
 	defer func() {
 		if retErr != nil || (resp != nil && resp.IsError()) {
@@ -92,6 +123,9 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *
 			p.DeletionAllowed = originalDeletionAllowed
 			p.Exportable = originalExportable
 			p.AllowPlaintextBackup = originalAllowPlaintextBackup
+			p.EscrowExport = originalEscrowExport
+			p.AutoRotatePeriod = originalAutoRotatePeriod
+			p.MaxEncryptionsPerVersion = originalMaxEncryptionsPerVersion
 		}
 	}()
 
@@ -185,6 +219,47 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *
 		}
 	}
 
+	escrowExportRaw, ok := d.GetOk("escrow_export")
+	if ok {
+		escrowExport := escrowExportRaw.(bool)
+		// Don't unset the already set value
+		if escrowExport && !p.EscrowExport {
+			p.EscrowExport = escrowExport
+			persistNeeded = true
+		}
+	}
+
+	autoRotatePeriodRaw, ok := d.GetOk("auto_rotate_period")
+	if ok {
+		autoRotatePeriod := time.Duration(autoRotatePeriodRaw.(int)) * time.Second
+		switch {
+		case autoRotatePeriod < 0:
+			return logical.ErrorResponse("auto rotate period cannot be negative"), nil
+		case autoRotatePeriod > 0 && autoRotatePeriod < minAutoRotatePeriod:
+			return logical.ErrorResponse(fmt.Sprintf("auto rotate period must be at least %s", minAutoRotatePeriod)), nil
+		}
+		if autoRotatePeriod != p.AutoRotatePeriod {
+			p.AutoRotatePeriod = autoRotatePeriod
+			persistNeeded = true
+		}
+	}
+
+	maxEncryptionsRaw, ok := d.GetOk("max_encryptions_per_version")
+	if ok {
+		maxEncryptions := int64(maxEncryptionsRaw.(int))
+		if maxEncryptions < 0 {
+			return logical.ErrorResponse("max encryptions per version cannot be negative"), nil
+		}
+		if maxEncryptions != p.MaxEncryptionsPerVersion {
+			p.MaxEncryptionsPerVersion = maxEncryptions
+			persistNeeded = true
+		}
+	}
+
+	if (p.AutoRotatePeriod > 0 || p.MaxEncryptionsPerVersion > 0) && p.Imported && !p.AllowImportedKeyRotation {
+		return logical.ErrorResponse("imported key does not allow rotation within Vault; automatic rotation cannot be enabled"), nil
+	}
+
 	if !persistNeeded {
 		return nil, nil
 	}
@@ -196,11 +271,18 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *
 		return logical.ErrorResponse("min decryption version should not be less then min available version"), nil
 	}
 
+	if err := p.Persist(ctx, req.Storage); err != nil {
+		return nil, err
+	}
+	if err := updateAutoRotateIndex(ctx, req.Storage, p.Name, p); err != nil {
+		return nil, err
+	}
+
 	if len(resp.Warnings) == 0 {
-		return nil, p.Persist(ctx, req.Storage)
+		return nil, nil
 	}
 
-	return resp, p.Persist(ctx, req.Storage)
+	return resp, nil
 }
 
 const pathConfigHelpSyn = `Configure a named encryption key`
@@ -208,5 +290,8 @@ const pathConfigHelpSyn = `Configure a named encryption key`
 const pathConfigHelpDesc = `
 This path is used to configure the named key. Currently, this
 supports adjusting the minimum version of the key allowed to
-be used for decryption via the min_decryption_version parameter.
+be used for decryption via the min_decryption_version parameter,
+enabling automatic rotation via the auto_rotate_period and
+max_encryptions_per_version parameters, and restricting export
+of the key to escrow via the escrow_export parameter.
 `
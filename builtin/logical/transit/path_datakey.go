@@ -109,6 +109,7 @@ func (b *backend) pathDatakeyWrite(ctx context.Context, req *logical.Request, d
 	if p == nil {
 		return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
 	}
+	defer b.autoRotateAfterUse(ctx, req.Storage, p)
 	if !b.System().CachingDisabled() {
 		p.Lock(false)
 	}
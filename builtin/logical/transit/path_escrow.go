@@ -0,0 +1,239 @@
+package transit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/pgpkeys"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/jsonutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/shamir"
+)
+
+func (b *backend) pathEscrowExport() *framework.Path {
+	return &framework.Path{
+		Pattern: "escrow/export/" + framework.GenericNameRegex("name") + framework.OptionalParamRegex("version"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"version": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Version of the key. Defaults to the latest version.",
+			},
+
+			"pgp_keys": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `The base64-encoded PGP public keys to encrypt
+the shares with. One share is created for each key.`,
+			},
+
+			"secret_threshold": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `The number of shares required to import the
+key version. Must be at least 2 and at most the number
+of PGP keys.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathEscrowExportWrite,
+		},
+
+		HelpSynopsis:    pathEscrowExportHelpSyn,
+		HelpDescription: pathEscrowExportHelpDesc,
+	}
+}
+
+func (b *backend) pathEscrowImport() *framework.Path {
+	return &framework.Path{
+		Pattern: "escrow/import" + framework.OptionalParamRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "If set, this will be the name of the imported key.",
+			},
+
+			"shares": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `The decrypted shares returned by the
+'escrow/export' endpoint, hex or base64 encoded.
+At least the threshold number of shares must be given.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathEscrowImportWrite,
+		},
+
+		HelpSynopsis:    pathEscrowImportHelpSyn,
+		HelpDescription: pathEscrowImportHelpDesc,
+	}
+}
+
+func (b *backend) pathEscrowExportWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	version := d.Get("version").(string)
+	pgpKeys := d.Get("pgp_keys").([]string)
+	threshold := d.Get("secret_threshold").(int)
+
+	if len(pgpKeys) == 0 {
+		return logical.ErrorResponse("missing pgp_keys"), logical.ErrInvalidRequest
+	}
+	if threshold < 2 || threshold > len(pgpKeys) {
+		return logical.ErrorResponse("secret_threshold must be at least 2 and at most the number of PGP keys"), logical.ErrInvalidRequest
+	}
+	fingerprints, err := pgpkeys.GetFingerprints(pgpKeys, nil)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	seen := make(map[string]bool, len(fingerprints))
+	for _, fingerprint := range fingerprints {
+		if seen[fingerprint] {
+			return logical.ErrorResponse(fmt.Sprintf("PGP key %s is given more than once", fingerprint)), logical.ErrInvalidRequest
+		}
+		seen[fingerprint] = true
+	}
+
+	p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, nil
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	defer p.Unlock()
+
+	if !p.Exportable {
+		return logical.ErrorResponse("key is not exportable"), logical.ErrInvalidRequest
+	}
+
+	var versionValue int
+	switch version {
+	case "", "latest":
+		versionValue = p.LatestVersion
+	default:
+		versionValue, err = strconv.Atoi(strings.TrimPrefix(version, "v"))
+		if err != nil {
+			return logical.ErrorResponse("invalid key version"), logical.ErrInvalidRequest
+		}
+	}
+
+	keyData, err := p.EscrowVersion(versionValue)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	encoded, err := jsonutil.EncodeJSON(keyData)
+	if err != nil {
+		return nil, err
+	}
+
+	shares, err := shamir.Split(encoded, len(pgpKeys), threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	// As with unseal keys, the shares are hex encoded before being encrypted
+	// so that they can be given back as decrypted
+	hexShares := make([][]byte, len(shares))
+	for i, share := range shares {
+		hexShares[i] = []byte(hex.EncodeToString(share))
+	}
+	_, encryptedShares, err := pgpkeys.EncryptShares(hexShares, pgpKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	retShares := make([]string, len(encryptedShares))
+	for i, share := range encryptedShares {
+		retShares[i] = base64.StdEncoding.EncodeToString(share)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":             p.Name,
+			"type":             p.Type.String(),
+			"version":          versionValue,
+			"secret_threshold": threshold,
+			"shares":           retShares,
+			"pgp_fingerprints": fingerprints,
+		},
+	}, nil
+}
+
+func (b *backend) pathEscrowImportWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	encodedShares := d.Get("shares").([]string)
+	if len(encodedShares) < 2 {
+		return logical.ErrorResponse("at least 2 shares must be given"), logical.ErrInvalidRequest
+	}
+
+	// If a name is given, make sure it does not contain any slashes. The Transit
+	// secret engine does not allow sub-paths in key names
+	keyName := d.Get("name").(string)
+	if strings.Contains(keyName, "/") {
+		return nil, ErrInvalidKeyName
+	}
+
+	shares := make([][]byte, len(encodedShares))
+	for i, encodedShare := range encodedShares {
+		share, err := hex.DecodeString(encodedShare)
+		if err != nil {
+			share, err = base64.StdEncoding.DecodeString(encodedShare)
+			if err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("share %d is neither hex nor base64 encoded", i+1)), logical.ErrInvalidRequest
+			}
+		}
+		shares[i] = share
+	}
+
+	// Combining fewer shares than the threshold, or shares of different
+	// exports, yields random bytes that do not decode as key data
+	combined, err := shamir.Combine(shares)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("failed to combine shares: %v", err)), logical.ErrInvalidRequest
+	}
+	var keyData keysutil.KeyData
+	if err := jsonutil.DecodeJSON(combined, &keyData); err != nil || keyData.Policy == nil {
+		return logical.ErrorResponse("invalid shares or not enough shares to reach the threshold"), logical.ErrInvalidRequest
+	}
+
+	backupB64 := base64.StdEncoding.EncodeToString(combined)
+	err = b.lm.RestorePolicy(ctx, req.Storage, keyName, backupB64, false)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	return nil, indexRestoredKey(ctx, req.Storage, keyName, backupB64)
+}
+
+const pathEscrowExportHelpSyn = `Export a version of the named key as encrypted Shamir shares`
+
+const pathEscrowExportHelpDesc = `
+This path is used to export a version of the named key for escrow. The
+key version is split into Shamir shares, one for each of the given PGP
+keys, and each share is encrypted with its PGP key. The key version can
+only be imported again through the 'escrow/import' endpoint once the
+threshold number of decrypted shares is given.
+`
+
+const pathEscrowImportHelpSyn = `Import a key version from escrow shares`
+
+const pathEscrowImportHelpDesc = `
+This path is used to import a key version exported through the
+'escrow/export' endpoint, given at least the threshold number of its
+decrypted shares. The version is imported as a new key.
+`
@@ -0,0 +1,150 @@
+package transit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/pgpkeys"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestTransit_Escrow(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		t.Helper()
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Storage:   s,
+			Data:      data,
+		})
+	}
+	mustReq := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := doReq(op, path, data)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp
+	}
+	mustFail := func(op logical.Operation, path string, data map[string]interface{}) {
+		t.Helper()
+		resp, err := doReq(op, path, data)
+		if err == nil && (resp == nil || !resp.IsError()) {
+			t.Fatalf("expected error for %s, got resp:%#v", path, resp)
+		}
+	}
+	encrypt := func(name string) string {
+		t.Helper()
+		resp := mustReq(logical.UpdateOperation, "encrypt/"+name, map[string]interface{}{
+			"plaintext": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+		})
+		return resp.Data["ciphertext"].(string)
+	}
+	pgpKeys := []string{pgpkeys.TestPubKey1, pgpkeys.TestPubKey2, pgpkeys.TestPubKey3}
+	privKeys := []string{pgpkeys.TestPrivKey1, pgpkeys.TestPrivKey2, pgpkeys.TestPrivKey3}
+
+	mustReq(logical.UpdateOperation, "keys/foo", map[string]interface{}{
+		"exportable":             true,
+		"allow_plaintext_backup": true,
+	})
+	v1Ciphertext := encrypt("foo")
+	mustReq(logical.UpdateOperation, "keys/foo/rotate", nil)
+	v2Ciphertext := encrypt("foo")
+
+	// Once set, plaintext export and backup are disallowed
+	mustReq(logical.UpdateOperation, "keys/foo/config", map[string]interface{}{
+		"escrow_export": true,
+	})
+	mustReq(logical.UpdateOperation, "keys/foo/config", map[string]interface{}{
+		"escrow_export": false,
+	})
+	resp := mustReq(logical.ReadOperation, "keys/foo", nil)
+	if !resp.Data["escrow_export"].(bool) {
+		t.Fatal("expected escrow_export to stay set")
+	}
+	mustFail(logical.ReadOperation, "export/encryption-key/foo", nil)
+	mustFail(logical.ReadOperation, "backup/foo", nil)
+
+	// Invalid thresholds and duplicate PGP keys are rejected
+	for _, data := range []map[string]interface{}{
+		{"pgp_keys": pgpKeys, "secret_threshold": 1},
+		{"pgp_keys": pgpKeys, "secret_threshold": 4},
+		{"pgp_keys": []string{pgpkeys.TestPubKey1, pgpkeys.TestPubKey1}, "secret_threshold": 2},
+	} {
+		mustFail(logical.UpdateOperation, "escrow/export/foo/1", data)
+	}
+
+	resp = mustReq(logical.UpdateOperation, "escrow/export/foo/1", map[string]interface{}{
+		"pgp_keys":         pgpKeys,
+		"secret_threshold": 2,
+	})
+	if resp.Data["version"].(int) != 1 || len(resp.Data["pgp_fingerprints"].([]string)) != 3 {
+		t.Fatalf("bad escrow export: %#v", resp.Data)
+	}
+	encryptedShares := resp.Data["shares"].([]string)
+	if len(encryptedShares) != 3 {
+		t.Fatalf("expected 3 shares, got %d", len(encryptedShares))
+	}
+	shares := make([]string, len(encryptedShares))
+	for i, encryptedShare := range encryptedShares {
+		buf, err := pgpkeys.DecryptBytes(encryptedShare, privKeys[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		shares[i] = buf.String()
+	}
+
+	// A single share or shares of another export cannot be imported
+	mustFail(logical.UpdateOperation, "escrow/import/bar", map[string]interface{}{
+		"shares": shares[:1],
+	})
+	resp = mustReq(logical.UpdateOperation, "escrow/export/foo", map[string]interface{}{
+		"pgp_keys":         pgpKeys[:2],
+		"secret_threshold": 2,
+	})
+	otherShare, err := pgpkeys.DecryptBytes(resp.Data["shares"].([]string)[0], privKeys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["version"].(int) != 2 {
+		t.Fatalf("expected the latest version to be exported, got %v", resp.Data["version"])
+	}
+	mustFail(logical.UpdateOperation, "escrow/import/bar", map[string]interface{}{
+		"shares": []string{otherShare.String(), shares[1]},
+	})
+
+	// The threshold of shares imports the version as a new key
+	mustFail(logical.UpdateOperation, "escrow/import/foo", map[string]interface{}{
+		"shares": shares[1:],
+	})
+	mustReq(logical.UpdateOperation, "escrow/import/bar", map[string]interface{}{
+		"shares": shares[1:],
+	})
+	resp = mustReq(logical.ReadOperation, "keys/bar", nil)
+	if resp.Data["latest_version"].(int) != 1 || resp.Data["min_available_version"].(int) != 1 || !resp.Data["escrow_export"].(bool) {
+		t.Fatalf("bad imported key: %#v", resp.Data)
+	}
+	resp = mustReq(logical.UpdateOperation, "decrypt/bar", map[string]interface{}{
+		"ciphertext": v1Ciphertext,
+	})
+	if resp.Data["plaintext"].(string) != "dGhlIHF1aWNrIGJyb3duIGZveA==" {
+		t.Fatalf("bad plaintext: %#v", resp.Data)
+	}
+	mustFail(logical.UpdateOperation, "decrypt/bar", map[string]interface{}{
+		"ciphertext": v2Ciphertext,
+	})
+
+	// The imported key can be rotated and used as any other key
+	mustReq(logical.UpdateOperation, "keys/bar/rotate", nil)
+	resp = mustReq(logical.UpdateOperation, "decrypt/bar", map[string]interface{}{
+		"ciphertext": encrypt("bar"),
+	})
+	if resp.Data["plaintext"].(string) != "dGhlIHF1aWNrIGJyb3duIGZveA==" {
+		t.Fatalf("bad plaintext after rotation: %#v", resp.Data)
+	}
+	mustReq(logical.UpdateOperation, "decrypt/bar", map[string]interface{}{
+		"ciphertext": v1Ciphertext,
+	})
+}
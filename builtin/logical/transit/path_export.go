@@ -83,9 +83,13 @@ func (b *backend) pathPolicyExportRead(ctx context.Context, req *logical.Request
 		return logical.ErrorResponse("key is not exportable"), nil
 	}
 
+	if p.EscrowExport {
+		return logical.ErrorResponse("key can only be exported through escrow"), logical.ErrInvalidRequest
+	}
+
 	switch exportType {
 	case exportTypeEncryptionKey:
-		if !p.Type.EncryptionSupported() {
+		if !p.Type.EncryptionSupported() && !p.Type.FPESupported() {
 			return logical.ErrorResponse("encryption not supported for the key"), logical.ErrInvalidRequest
 		}
 	case exportTypeSigningKey:
@@ -155,7 +159,7 @@ func getExportKey(policy *keysutil.Policy, key *keysutil.KeyEntry, exportType st
 
 	case exportTypeEncryptionKey:
 		switch policy.Type {
-		case keysutil.KeyType_AES128_GCM96, keysutil.KeyType_AES256_GCM96, keysutil.KeyType_ChaCha20_Poly1305:
+		case keysutil.KeyType_AES128_GCM96, keysutil.KeyType_AES256_GCM96, keysutil.KeyType_ChaCha20_Poly1305, keysutil.KeyType_FF3_1_AES256:
 			return strings.TrimSpace(base64.StdEncoding.EncodeToString(key.Key)), nil
 
 		case keysutil.KeyType_RSA2048, keysutil.KeyType_RSA4096:
@@ -0,0 +1,264 @@
+package transit
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/mitchellh/mapstructure"
+)
+
+// FPEBatchRequestItem represents a request item for batch format-preserving
+// encryption
+type FPEBatchRequestItem struct {
+	// Value to encode or decode
+	Value string `json:"value" structs:"value" mapstructure:"value"`
+
+	// Base64 encoded tweak
+	Tweak string `json:"tweak" structs:"tweak" mapstructure:"tweak"`
+
+	// DecodedTweak is the base64 decoded version of Tweak
+	DecodedTweak []byte
+
+	// The key version to be used
+	KeyVersion int `json:"key_version" structs:"key_version" mapstructure:"key_version"`
+}
+
+// FPEBatchResponseItem represents a response item for batch format-preserving
+// encryption
+type FPEBatchResponseItem struct {
+	// EncodedValue for the value present in the corresponding batch request
+	// item
+	EncodedValue string `json:"encoded_value,omitempty" structs:"encoded_value" mapstructure:"encoded_value"`
+
+	// DecodedValue for the value present in the corresponding batch request
+	// item
+	DecodedValue string `json:"decoded_value,omitempty" structs:"decoded_value" mapstructure:"decoded_value"`
+
+	// KeyVersion is the version of the key the value was encoded with
+	KeyVersion int `json:"key_version,omitempty" structs:"key_version" mapstructure:"key_version"`
+
+	// Error, if set represents a failure encountered while processing the
+	// corresponding batch request item
+	Error string `json:"error,omitempty" structs:"error" mapstructure:"error"`
+}
+
+func (b *backend) pathEncode() *framework.Path {
+	return &framework.Path{
+		Pattern: "encode/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"value": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Value to encode, made of characters of the key's alphabet",
+			},
+
+			"tweak": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `
+Base64 encoded tweak of exactly 56 bits (7 bytes). The same tweak must be
+provided to decode the value. Defaults to an all-zero tweak.`,
+			},
+
+			"key_version": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `The version of the key to use for encoding.
+Must be 0 (for latest) or a value greater than or equal
+to the min_encryption_version configured on the key.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathFPEWrite(false),
+		},
+
+		HelpSynopsis:    pathEncodeHelpSyn,
+		HelpDescription: pathEncodeHelpDesc,
+	}
+}
+
+func (b *backend) pathDecode() *framework.Path {
+	return &framework.Path{
+		Pattern: "decode/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"value": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Value to decode, as returned by encode",
+			},
+
+			"tweak": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `
+Base64 encoded tweak the value was encoded with. Defaults to an all-zero
+tweak.`,
+			},
+
+			"key_version": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `The version of the key the value was encoded
+with, as returned by encode. Required, as the encoded value
+does not carry it and decoding with another version silently
+returns a wrong value.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathFPEWrite(true),
+		},
+
+		HelpSynopsis:    pathDecodeHelpSyn,
+		HelpDescription: pathDecodeHelpDesc,
+	}
+}
+
+func (b *backend) pathFPEWrite(decode bool) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		batchInputRaw := d.Raw["batch_input"]
+		var batchInputItems []FPEBatchRequestItem
+		var err error
+		if batchInputRaw != nil {
+			err = mapstructure.Decode(batchInputRaw, &batchInputItems)
+			if err != nil {
+				return nil, errwrap.Wrapf("failed to parse batch input: {{err}}", err)
+			}
+
+			if len(batchInputItems) == 0 {
+				return logical.ErrorResponse("missing batch input to process"), logical.ErrInvalidRequest
+			}
+		} else {
+			value := d.Get("value").(string)
+			if len(value) == 0 {
+				return logical.ErrorResponse("missing value to process"), logical.ErrInvalidRequest
+			}
+
+			batchInputItems = make([]FPEBatchRequestItem, 1)
+			batchInputItems[0] = FPEBatchRequestItem{
+				Value:      value,
+				Tweak:      d.Get("tweak").(string),
+				KeyVersion: d.Get("key_version").(int),
+			}
+		}
+
+		batchResponseItems := make([]FPEBatchResponseItem, len(batchInputItems))
+
+		for i, item := range batchInputItems {
+			if item.Value == "" {
+				batchResponseItems[i].Error = "missing value to process"
+				continue
+			}
+
+			// Format-preserving encryption has no integrity check, so a value
+			// decoded with the wrong version is not detected
+			if decode && item.KeyVersion == 0 {
+				batchResponseItems[i].Error = "missing key_version the value was encoded with"
+				continue
+			}
+
+			// Decode the tweak
+			if len(item.Tweak) != 0 {
+				batchInputItems[i].DecodedTweak, err = base64.StdEncoding.DecodeString(item.Tweak)
+				if err != nil {
+					batchResponseItems[i].Error = err.Error()
+					continue
+				}
+			}
+		}
+
+		// Get the policy
+		p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
+			Storage: req.Storage,
+			Name:    d.Get("name").(string),
+		}, b.GetRandomReader())
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
+		}
+		if !decode {
+			defer b.autoRotateAfterUse(ctx, req.Storage, p)
+		}
+		if !b.System().CachingDisabled() {
+			p.Lock(false)
+		}
+
+		for i, item := range batchInputItems {
+			if batchResponseItems[i].Error != "" {
+				continue
+			}
+
+			if decode {
+				batchResponseItems[i].DecodedValue, err = p.DecryptFPE(item.KeyVersion, item.DecodedTweak, item.Value)
+			} else {
+				batchResponseItems[i].EncodedValue, batchResponseItems[i].KeyVersion, err = p.EncryptFPE(item.KeyVersion, item.DecodedTweak, item.Value)
+			}
+			if err != nil {
+				switch err.(type) {
+				case errutil.UserError:
+					batchResponseItems[i].Error = err.Error()
+					continue
+				default:
+					p.Unlock()
+					return nil, err
+				}
+			}
+		}
+
+		resp := &logical.Response{}
+		if batchInputRaw != nil {
+			resp.Data = map[string]interface{}{
+				"batch_results": batchResponseItems,
+			}
+		} else {
+			if batchResponseItems[0].Error != "" {
+				p.Unlock()
+				return logical.ErrorResponse(batchResponseItems[0].Error), logical.ErrInvalidRequest
+			}
+			if decode {
+				resp.Data = map[string]interface{}{
+					"decoded_value": batchResponseItems[0].DecodedValue,
+				}
+			} else {
+				resp.Data = map[string]interface{}{
+					"encoded_value": batchResponseItems[0].EncodedValue,
+					"key_version":   batchResponseItems[0].KeyVersion,
+				}
+			}
+		}
+
+		p.Unlock()
+		return resp, nil
+	}
+}
+
+const pathEncodeHelpSyn = `Encode a value or a batch of values with
+format-preserving encryption using a named key`
+
+const pathEncodeHelpDesc = `
+This path uses the named "ff3-1-aes256" key from the request path to encrypt a
+value made of characters of the key's alphabet into a value of the same length
+and alphabet. As the encoded value does not carry the key version, the version
+used is returned and must be provided to decode the value.
+`
+
+const pathDecodeHelpSyn = `Decode a value or a batch of values encoded with
+format-preserving encryption using a named key`
+
+const pathDecodeHelpDesc = `
+This path uses the named "ff3-1-aes256" key from the request path to decrypt a
+value returned by the encode path, with the key version and tweak it was
+encoded with.
+`
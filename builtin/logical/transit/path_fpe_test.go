@@ -0,0 +1,183 @@
+package transit
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestTransit_FPE(t *testing.T) {
+	var resp *logical.Response
+	var err error
+
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   s,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp
+	}
+
+	// An alphabet is only accepted for format-preserving keys
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "keys/aes",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"alphabet": "0123456789",
+		},
+	})
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error creating an AES key with an alphabet, got resp:%#v", resp)
+	}
+
+	doReq("keys/ssn", map[string]interface{}{
+		"type": "ff3-1-aes256",
+	})
+	doReq("keys/card", map[string]interface{}{
+		"type":     "ff3-1-aes256",
+		"alphabet": "0123456789ABCDEF",
+	})
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "keys/card",
+		Storage:   s,
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["type"] != "ff3-1-aes256" || resp.Data["alphabet"] != "0123456789ABCDEF" {
+		t.Fatalf("bad key: %#v", resp.Data)
+	}
+
+	// Regular encryption is not supported
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "encrypt/ssn",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"plaintext": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+		},
+	})
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error encrypting with an FPE key, got resp:%#v", resp)
+	}
+
+	tweak := base64.StdEncoding.EncodeToString([]byte("1234567"))
+	resp = doReq("encode/ssn", map[string]interface{}{
+		"value": "123456789",
+		"tweak": tweak,
+	})
+	encodedV1 := resp.Data["encoded_value"].(string)
+	if len(encodedV1) != 9 || encodedV1 == "123456789" || resp.Data["key_version"].(int) != 1 {
+		t.Fatalf("bad encoding: %#v", resp.Data)
+	}
+
+	resp = doReq("decode/ssn", map[string]interface{}{
+		"value":       encodedV1,
+		"tweak":       tweak,
+		"key_version": 1,
+	})
+	if resp.Data["decoded_value"] != "123456789" {
+		t.Fatalf("bad decoding: %#v", resp.Data)
+	}
+
+	// The key version must be given to decode
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "decode/ssn",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"value": encodedV1,
+			"tweak": tweak,
+		},
+	})
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error decoding without key_version, got resp:%#v", resp)
+	}
+
+	// A value outside of the key's alphabet is rejected
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "encode/ssn",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"value": "123-45-6789",
+		},
+	})
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error encoding characters outside of the alphabet, got resp:%#v", resp)
+	}
+
+	// After a rotation the latest version is used for encoding and the value
+	// encoded with the previous one is decoded with its version
+	doReq("keys/ssn/rotate", nil)
+	resp = doReq("encode/ssn", map[string]interface{}{
+		"value": "123456789",
+		"tweak": tweak,
+	})
+	if resp.Data["key_version"].(int) != 2 || resp.Data["encoded_value"] == encodedV1 {
+		t.Fatalf("bad encoding after rotation: %#v", resp.Data)
+	}
+
+	resp = doReq("decode/ssn", map[string]interface{}{
+		"value":       encodedV1,
+		"tweak":       tweak,
+		"key_version": 1,
+	})
+	if resp.Data["decoded_value"] != "123456789" {
+		t.Fatalf("bad decoding with the previous version: %#v", resp.Data)
+	}
+
+	doReq("keys/ssn/config", map[string]interface{}{
+		"min_decryption_version": 2,
+	})
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "decode/ssn",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"value":       encodedV1,
+			"tweak":       tweak,
+			"key_version": 1,
+		},
+	})
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error decoding below the min decryption version, got resp:%#v", resp)
+	}
+
+	// Batch encoding reports errors per item
+	resp = doReq("encode/card", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"value": "4111111111111111"},
+			map[string]interface{}{"value": "4111-1111"},
+			map[string]interface{}{"value": "DEADBEEF00", "tweak": tweak},
+		},
+	})
+	encoded := resp.Data["batch_results"].([]FPEBatchResponseItem)
+	if encoded[0].Error != "" || encoded[1].Error == "" || encoded[2].Error != "" {
+		t.Fatalf("bad batch results: %#v", encoded)
+	}
+
+	resp = doReq("decode/card", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"value": encoded[0].EncodedValue, "key_version": encoded[0].KeyVersion},
+			map[string]interface{}{"value": encoded[2].EncodedValue, "key_version": encoded[2].KeyVersion, "tweak": tweak},
+		},
+	})
+	decoded := resp.Data["batch_results"].([]FPEBatchResponseItem)
+	if decoded[0].DecodedValue != "4111111111111111" || decoded[1].DecodedValue != "DEADBEEF00" {
+		t.Fatalf("bad batch results: %#v", decoded)
+	}
+}
@@ -0,0 +1,295 @@
+package transit
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/helper/kwp"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func (b *backend) pathImport() *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/import",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"type": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "aes256-gcm96",
+				Description: `
+The type of key being imported. Currently, "aes128-gcm96" (symmetric), "aes256-gcm96" (symmetric),
+"chacha20-poly1305" (symmetric), "ecdsa-p256" (asymmetric), "ecdsa-p384" (asymmetric), "ecdsa-p521"
+(asymmetric), "ed25519" (asymmetric), "rsa-2048" (asymmetric), "rsa-4096" (asymmetric) and
+"ff3-1-aes256" (format-preserving) are supported. Defaults to "aes256-gcm96".
+`,
+			},
+
+			"alphabet": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The characters that values encoded with
+a "ff3-1-aes256" key are made of. Defaults
+to the decimal digits "0123456789".`,
+			},
+
+			"ciphertext": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The base64-encoded ciphertext of the key
+material to import. This is the RSA-OAEP encryption of
+an ephemeral AES-256 key under the wrapping key returned
+by the 'wrapping_key' endpoint, followed by the key
+material wrapped with the ephemeral key using AES key
+wrap with padding (RFC 5649). Symmetric keys are given
+as raw bytes and asymmetric keys as PKCS#8 DER-encoded
+private keys.`,
+			},
+
+			"hash_function": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "SHA256",
+				Description: `The hash function used for the RSA-OAEP
+encryption of the ephemeral key. Valid values are
+"SHA1", "SHA224", "SHA256", "SHA384" and "SHA512".
+Defaults to "SHA256".`,
+			},
+
+			"allow_rotation": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Allows the imported key to be rotated
+within Vault, generating new key material.`,
+			},
+
+			"cmac_raw_key": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Computes the CMACs of the imported AES
+key with the key material itself rather than with a
+key dedicated to CMACs, so that they match CMACs
+computed outside of Vault with the same key.`,
+			},
+
+			"derived": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Enables key derivation mode. This
+allows for per-transaction unique
+keys for encryption operations.`,
+			},
+
+			"exportable": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Enables keys to be exportable.
+This allows for all the valid keys
+in the key ring to be exported.`,
+			},
+
+			"allow_plaintext_backup": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Enables taking a backup of the named
+key in plaintext format. Once set,
+this cannot be disabled.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathImportWrite,
+		},
+
+		HelpSynopsis:    pathImportHelpSyn,
+		HelpDescription: pathImportHelpDesc,
+	}
+}
+
+func (b *backend) pathImportVersion() *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/import_version",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"ciphertext": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The base64-encoded ciphertext of the key
+material to import, in the same format as accepted
+by the 'import' endpoint.`,
+			},
+
+			"hash_function": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "SHA256",
+				Description: `The hash function used for the RSA-OAEP
+encryption of the ephemeral key. Valid values are
+"SHA1", "SHA224", "SHA256", "SHA384" and "SHA512".
+Defaults to "SHA256".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathImportVersionWrite,
+		},
+
+		HelpSynopsis:    pathImportVersionHelpSyn,
+		HelpDescription: pathImportVersionHelpDesc,
+	}
+}
+
+func (b *backend) pathImportWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	keyType, ok := keyTypeFromString(d.Get("type").(string))
+	if !ok {
+		return logical.ErrorResponse(fmt.Sprintf("unknown key type %v", d.Get("type").(string))), logical.ErrInvalidRequest
+	}
+
+	key, err := b.unwrapImportedKey(ctx, req.Storage, d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	polReq := keysutil.PolicyRequest{
+		Storage:                  req.Storage,
+		Name:                     name,
+		KeyType:                  keyType,
+		Derived:                  d.Get("derived").(bool),
+		Exportable:               d.Get("exportable").(bool),
+		AllowPlaintextBackup:     d.Get("allow_plaintext_backup").(bool),
+		AllowImportedKeyRotation: d.Get("allow_rotation").(bool),
+		CMACRawKey:               d.Get("cmac_raw_key").(bool),
+		FPEAlphabet:              d.Get("alphabet").(string),
+	}
+	if polReq.FPEAlphabet != "" && !keyType.FPESupported() {
+		return logical.ErrorResponse(fmt.Sprintf("alphabet is not supported for keys of type %v", keyType)), logical.ErrInvalidRequest
+	}
+
+	if err := b.lm.ImportPolicy(ctx, polReq, key, b.GetRandomReader()); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathImportVersionWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(true)
+	}
+	defer p.Unlock()
+
+	if !p.Imported {
+		return logical.ErrorResponse("new versions can only be imported into keys that were imported"), logical.ErrInvalidRequest
+	}
+
+	key, err := b.unwrapImportedKey(ctx, req.Storage, d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	if err := p.Import(ctx, req.Storage, key, b.GetRandomReader()); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	return nil, nil
+}
+
+// unwrapImportedKey decrypts the key material in the request's ciphertext
+// field using the backend's wrapping key.
+func (b *backend) unwrapImportedKey(ctx context.Context, storage logical.Storage, d *framework.FieldData) ([]byte, error) {
+	ciphertextB64 := d.Get("ciphertext").(string)
+	if ciphertextB64 == "" {
+		return nil, fmt.Errorf("'ciphertext' must be supplied")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextB64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to base64-decode ciphertext")
+	}
+
+	hashFunc, err := parseImportHashFunction(d.Get("hash_function").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	wrappingKey, err := b.getWrappingKey(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey := wrappingKey.Keys[strconv.Itoa(wrappingKey.LatestVersion)].RSAKey
+
+	// The ciphertext starts with the ephemeral key encrypted under the
+	// wrapping key, which is always exactly the size of the RSA modulus.
+	keySize := rsaKey.Size()
+	if len(ciphertext) <= keySize {
+		return nil, fmt.Errorf("ciphertext is too short to contain wrapped key material")
+	}
+
+	ephemeralKey, err := rsa.DecryptOAEP(hashFunc, b.GetRandomReader(), rsaKey, ciphertext[:keySize], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt ephemeral key: %v", err)
+	}
+
+	key, err := kwp.Unwrap(ephemeralKey, ciphertext[keySize:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap key material: %v", err)
+	}
+
+	return key, nil
+}
+
+func parseImportHashFunction(name string) (hash.Hash, error) {
+	switch strings.ToUpper(name) {
+	case "SHA1":
+		return sha1.New(), nil
+	case "SHA224":
+		return sha256.New224(), nil
+	case "SHA256":
+		return sha256.New(), nil
+	case "SHA384":
+		return sha512.New384(), nil
+	case "SHA512":
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash function %q", name)
+	}
+}
+
+const pathImportHelpSyn = `Imports an externally generated key into a new named key`
+
+const pathImportHelpDesc = `
+This path is used to import externally generated key material into a new
+named key. The key material must be wrapped using the public key returned by
+the 'wrapping_key' endpoint. Imported keys cannot be rotated within Vault
+unless 'allow_rotation' is set; new versions can instead be imported through
+the 'import_version' endpoint.
+`
+
+const pathImportVersionHelpSyn = `Imports externally generated key material as a new version of a named key`
+
+const pathImportVersionHelpDesc = `
+This path is used to import externally generated key material as the latest
+version of a key that was previously imported. The key material must be of
+the same type as the existing key and wrapped in the same way as for the
+'import' endpoint.
+`
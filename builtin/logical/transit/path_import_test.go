@@ -0,0 +1,298 @@
+package transit
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/helper/kwp"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// wrapTargetKey wraps the given key material for import using the backend's
+// published wrapping key, as an external key management system would.
+func wrapTargetKey(t *testing.T, b *backend, s logical.Storage, key []byte) string {
+	t.Helper()
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "wrapping_key",
+		Operation: logical.ReadOperation,
+		Storage:   s,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+
+	block, _ := pem.Decode([]byte(resp.Data["public_key"].(string)))
+	if block == nil {
+		t.Fatal("failed to decode wrapping key PEM")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ephemeralKey := make([]byte, 32)
+	if _, err := rand.Read(ephemeralKey); err != nil {
+		t.Fatal(err)
+	}
+	wrappedEphemeralKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub.(*rsa.PublicKey), ephemeralKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrappedKey, err := kwp.Wrap(ephemeralKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(append(wrappedEphemeralKey, wrappedKey...))
+}
+
+func TestTransit_WrappingKey(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	req := &logical.Request{
+		Path:      "wrapping_key",
+		Operation: logical.ReadOperation,
+		Storage:   s,
+	}
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+	first := resp.Data["public_key"].(string)
+	if first == "" {
+		t.Fatal("expected a public key")
+	}
+
+	// The wrapping key must be stable across reads
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+	if resp.Data["public_key"].(string) != first {
+		t.Fatal("wrapping key changed between reads")
+	}
+
+	// The wrapping key must not show up as a named key
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "keys",
+		Operation: logical.ListOperation,
+		Storage:   s,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys, ok := resp.Data["keys"]; ok && len(keys.([]string)) != 0 {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+}
+
+func TestTransit_Import(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// Import a symmetric key and verify it can decrypt data encrypted
+	// outside of Vault's control by encrypting and decrypting through it
+	aesKey := make([]byte, 32)
+	if _, err := rand.Read(aesKey); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "keys/imported-aes/import",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+		Data: map[string]interface{}{
+			"type":       "aes256-gcm96",
+			"ciphertext": wrapTargetKey(t, b, s, aesKey),
+			"exportable": true,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "export/encryption-key/imported-aes/1",
+		Operation: logical.ReadOperation,
+		Storage:   s,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+	exported := resp.Data["keys"].(map[string]string)["1"]
+	if exported != base64.StdEncoding.EncodeToString(aesKey) {
+		t.Fatal("exported key does not match the imported key material")
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "keys/imported-aes",
+		Operation: logical.ReadOperation,
+		Storage:   s,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+	if !resp.Data["imported_key"].(bool) || resp.Data["allow_imported_key_rotation"].(bool) {
+		t.Fatalf("bad key info: %#v", resp.Data)
+	}
+
+	// Importing over an existing key must fail
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "keys/imported-aes/import",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+		Data: map[string]interface{}{
+			"ciphertext": wrapTargetKey(t, b, s, aesKey),
+		},
+	})
+	if err == nil {
+		t.Fatalf("expected error importing over existing key, got resp: %#v", resp)
+	}
+
+	// Rotation is not allowed unless requested at import time
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "keys/imported-aes/rotate",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+	})
+	if err == nil {
+		t.Fatalf("expected error rotating imported key, got resp: %#v", resp)
+	}
+
+	// New versions can be imported instead
+	newAESKey := make([]byte, 32)
+	if _, err := rand.Read(newAESKey); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "keys/imported-aes/import_version",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+		Data: map[string]interface{}{
+			"ciphertext": wrapTargetKey(t, b, s, newAESKey),
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "keys/imported-aes",
+		Operation: logical.ReadOperation,
+		Storage:   s,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+	if resp.Data["latest_version"].(int) != 2 {
+		t.Fatalf("expected latest version 2, got %v", resp.Data["latest_version"])
+	}
+}
+
+func TestTransit_ImportAsymmetric(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A key type mismatch must be rejected
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "keys/imported-ec/import",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+		Data: map[string]interface{}{
+			"type":       "ecdsa-p256",
+			"ciphertext": wrapTargetKey(t, b, s, der),
+		},
+	})
+	if err == nil {
+		t.Fatalf("expected error importing mismatched key type, got resp: %#v", resp)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "keys/imported-ec/import",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+		Data: map[string]interface{}{
+			"type":           "ecdsa-p384",
+			"ciphertext":     wrapTargetKey(t, b, s, der),
+			"allow_rotation": true,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+
+	// Signatures made with the imported key must verify against the
+	// original public key
+	input := base64.StdEncoding.EncodeToString([]byte("the quick brown fox"))
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "sign/imported-ec",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+		Data: map[string]interface{}{
+			"input":                input,
+			"marshaling_algorithm": "jws",
+			"hash_algorithm":       "sha2-384",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "verify/imported-ec",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+		Data: map[string]interface{}{
+			"input":                input,
+			"signature":            resp.Data["signature"],
+			"marshaling_algorithm": "jws",
+			"hash_algorithm":       "sha2-384",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+	if !resp.Data["valid"].(bool) {
+		t.Fatal("signature made with imported key did not verify")
+	}
+
+	// Rotation was allowed at import time
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "keys/imported-ec/rotate",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+
+	// Tampered ciphertext must be rejected
+	wrapped, _ := base64.StdEncoding.DecodeString(wrapTargetKey(t, b, s, der))
+	wrapped[len(wrapped)-1] ^= 0x01
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "keys/imported-ec-2/import",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+		Data: map[string]interface{}{
+			"type":       "ecdsa-p384",
+			"ciphertext": base64.StdEncoding.EncodeToString(wrapped),
+		},
+	})
+	if err == nil {
+		t.Fatalf("expected error importing tampered ciphertext, got resp: %#v", resp)
+	}
+}
@@ -47,10 +47,17 @@ func (b *backend) pathKeys() *framework.Path {
 				Description: `
 The type of key to create. Currently, "aes128-gcm96" (symmetric), "aes256-gcm96" (symmetric), "ecdsa-p256"
 (asymmetric), "ecdsa-p384" (asymmetric), "ecdsa-p521" (asymmetric), "ed25519" (asymmetric), "rsa-2048" (asymmetric), "rsa-4096"
-(asymmetric) are supported.  Defaults to "aes256-gcm96".
+(asymmetric) and "ff3-1-aes256" (format-preserving) are supported.  Defaults to "aes256-gcm96".
 `,
 			},
 
+			"alphabet": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The characters that values encoded with
+a "ff3-1-aes256" key are made of. Defaults
+to the decimal digits "0123456789".`,
+			},
+
 			"derived": &framework.FieldSchema{
 				Type: framework.TypeBool,
 				Description: `Enables key derivation mode. This
@@ -124,6 +131,7 @@ func (b *backend) pathPolicyWrite(ctx context.Context, req *logical.Request, d *
 	keyType := d.Get("type").(string)
 	exportable := d.Get("exportable").(bool)
 	allowPlaintextBackup := d.Get("allow_plaintext_backup").(bool)
+	alphabet := d.Get("alphabet").(string)
 
 	if !derived && convergent {
 		return logical.ErrorResponse("convergent encryption requires derivation to be enabled"), nil
@@ -137,29 +145,16 @@ func (b *backend) pathPolicyWrite(ctx context.Context, req *logical.Request, d *
 		Convergent:           convergent,
 		Exportable:           exportable,
 		AllowPlaintextBackup: allowPlaintextBackup,
+		FPEAlphabet:          alphabet,
 	}
-	switch keyType {
-	case "aes128-gcm96":
-		polReq.KeyType = keysutil.KeyType_AES128_GCM96
-	case "aes256-gcm96":
-		polReq.KeyType = keysutil.KeyType_AES256_GCM96
-	case "chacha20-poly1305":
-		polReq.KeyType = keysutil.KeyType_ChaCha20_Poly1305
-	case "ecdsa-p256":
-		polReq.KeyType = keysutil.KeyType_ECDSA_P256
-	case "ecdsa-p384":
-		polReq.KeyType = keysutil.KeyType_ECDSA_P384
-	case "ecdsa-p521":
-		polReq.KeyType = keysutil.KeyType_ECDSA_P521
-	case "ed25519":
-		polReq.KeyType = keysutil.KeyType_ED25519
-	case "rsa-2048":
-		polReq.KeyType = keysutil.KeyType_RSA2048
-	case "rsa-4096":
-		polReq.KeyType = keysutil.KeyType_RSA4096
-	default:
+	var ok bool
+	polReq.KeyType, ok = keyTypeFromString(keyType)
+	if !ok {
 		return logical.ErrorResponse(fmt.Sprintf("unknown key type %v", keyType)), logical.ErrInvalidRequest
 	}
+	if alphabet != "" && !polReq.KeyType.FPESupported() {
+		return logical.ErrorResponse(fmt.Sprintf("alphabet is not supported for keys of type %v", keyType)), logical.ErrInvalidRequest
+	}
 
 	p, upserted, err := b.lm.GetPolicy(ctx, polReq, b.GetRandomReader())
 	if err != nil {
@@ -180,6 +175,33 @@ func (b *backend) pathPolicyWrite(ctx context.Context, req *logical.Request, d *
 	return nil, nil
 }
 
+// keyTypeFromString returns the key type with the given API name.
+func keyTypeFromString(keyType string) (keysutil.KeyType, bool) {
+	switch keyType {
+	case "aes128-gcm96":
+		return keysutil.KeyType_AES128_GCM96, true
+	case "aes256-gcm96":
+		return keysutil.KeyType_AES256_GCM96, true
+	case "chacha20-poly1305":
+		return keysutil.KeyType_ChaCha20_Poly1305, true
+	case "ecdsa-p256":
+		return keysutil.KeyType_ECDSA_P256, true
+	case "ecdsa-p384":
+		return keysutil.KeyType_ECDSA_P384, true
+	case "ecdsa-p521":
+		return keysutil.KeyType_ECDSA_P521, true
+	case "ed25519":
+		return keysutil.KeyType_ED25519, true
+	case "rsa-2048":
+		return keysutil.KeyType_RSA2048, true
+	case "rsa-4096":
+		return keysutil.KeyType_RSA4096, true
+	case "ff3-1-aes256":
+		return keysutil.KeyType_FF3_1_AES256, true
+	}
+	return 0, false
+}
+
 // Built-in helper type for returning asymmetric keys
 type asymKey struct {
 	Name         string    `json:"name" structs:"name" mapstructure:"name"`
@@ -218,13 +240,40 @@ func (b *backend) pathPolicyRead(ctx context.Context, req *logical.Request, d *f
 			"latest_version":         p.LatestVersion,
 			"exportable":             p.Exportable,
 			"allow_plaintext_backup": p.AllowPlaintextBackup,
+			"escrow_export":          p.EscrowExport,
 			"supports_encryption":    p.Type.EncryptionSupported(),
 			"supports_decryption":    p.Type.DecryptionSupported(),
 			"supports_signing":       p.Type.SigningSupported(),
 			"supports_derivation":    p.Type.DerivationSupported(),
+			"auto_rotate_period":     int64(p.AutoRotatePeriod.Seconds()),
+			"last_rotation_time":     p.LastRotationTime(),
 		},
 	}
 
+	if next := p.NextAutoRotation(); !next.IsZero() {
+		resp.Data["next_rotation_time"] = next
+	}
+
+	if p.MaxEncryptionsPerVersion > 0 {
+		resp.Data["max_encryptions_per_version"] = p.MaxEncryptionsPerVersion
+		resp.Data["latest_version_encryptions"] = p.EncryptionCount(p.LatestVersion)
+	}
+
+	if p.Imported {
+		resp.Data["imported_key"] = true
+		resp.Data["allow_imported_key_rotation"] = p.AllowImportedKeyRotation
+		if p.CMACRawKey {
+			resp.Data["cmac_raw_key"] = true
+		}
+	}
+
+	if p.Type.FPESupported() {
+		resp.Data["alphabet"] = p.FPEAlphabet
+		if p.FPEAlphabet == "" {
+			resp.Data["alphabet"] = keysutil.DefaultFPEAlphabet
+		}
+	}
+
 	if p.BackupInfo != nil {
 		resp.Data["backup_info"] = map[string]interface{}{
 			"time":    p.BackupInfo.Time,
@@ -262,7 +311,7 @@ func (b *backend) pathPolicyRead(ctx context.Context, req *logical.Request, d *f
 	}
 
 	switch p.Type {
-	case keysutil.KeyType_AES128_GCM96, keysutil.KeyType_AES256_GCM96, keysutil.KeyType_ChaCha20_Poly1305:
+	case keysutil.KeyType_AES128_GCM96, keysutil.KeyType_AES256_GCM96, keysutil.KeyType_ChaCha20_Poly1305, keysutil.KeyType_FF3_1_AES256:
 		retKeys := map[string]int64{}
 		for k, v := range p.Keys {
 			retKeys[k] = v.DeprecatedCreationTime
@@ -345,7 +394,7 @@ func (b *backend) pathPolicyDelete(ctx context.Context, req *logical.Request, d
 		return logical.ErrorResponse(fmt.Sprintf("error deleting policy %s: %s", name, err)), err
 	}
 
-	return nil, nil
+	return nil, req.Storage.Delete(ctx, autoRotateIndexPrefix+name)
 }
 
 const pathPolicyHelpSyn = `Managed named encryption keys`
@@ -51,7 +51,11 @@ func (b *backend) pathRestoreUpdate(ctx context.Context, req *logical.Request, d
 		return nil, ErrInvalidKeyName
 	}
 
-	return nil, b.lm.RestorePolicy(ctx, req.Storage, keyName, backupB64, force)
+	if err := b.lm.RestorePolicy(ctx, req.Storage, keyName, backupB64, force); err != nil {
+		return nil, err
+	}
+
+	return nil, indexRestoredKey(ctx, req.Storage, keyName, backupB64)
 }
 
 const pathRestoreHelpSyn = `Restore the named key`
@@ -45,6 +45,11 @@ func (b *backend) pathRotateWrite(ctx context.Context, req *logical.Request, d *
 		p.Lock(true)
 	}
 
+	if p.Imported && !p.AllowImportedKeyRotation {
+		p.Unlock()
+		return logical.ErrorResponse("imported key does not allow rotation within Vault; import a new version instead"), logical.ErrInvalidRequest
+	}
+
 	// Rotate the policy
 	err = p.Rotate(ctx, req.Storage, b.GetRandomReader())
 
@@ -0,0 +1,184 @@
+package transit
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestTransit_AutoRotate(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Storage:   s,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp
+	}
+
+	encrypt := func(b *backend, s logical.Storage, n int) {
+		t.Helper()
+		batch := make([]interface{}, n)
+		for i := range batch {
+			batch[i] = map[string]interface{}{"plaintext": "dGhlIHF1aWNrIGJyb3duIGZveA=="}
+		}
+		doReq(b, s, logical.UpdateOperation, "encrypt/foo", map[string]interface{}{
+			"batch_input": batch,
+		})
+	}
+
+	doReq(b, s, logical.UpdateOperation, "keys/foo", nil)
+
+	resp := doReq(b, s, logical.ReadOperation, "keys/foo", nil)
+	if resp.Data["auto_rotate_period"].(int64) != 0 || resp.Data["next_rotation_time"] != nil || resp.Data["max_encryptions_per_version"] != nil {
+		t.Fatalf("unexpected automatic rotation: %#v", resp.Data)
+	}
+	lastRotation := resp.Data["last_rotation_time"].(time.Time)
+	if lastRotation.IsZero() {
+		t.Fatalf("missing last rotation time: %#v", resp.Data)
+	}
+
+	// Periods below the minimum are rejected
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "keys/foo/config",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"auto_rotate_period": "30m",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error with a period below the minimum, got resp:%#v", resp)
+	}
+
+	doReq(b, s, logical.UpdateOperation, "keys/foo/config", map[string]interface{}{
+		"auto_rotate_period":          "2h",
+		"max_encryptions_per_version": 3,
+	})
+	resp = doReq(b, s, logical.ReadOperation, "keys/foo", nil)
+	if resp.Data["auto_rotate_period"].(int64) != 7200 ||
+		!resp.Data["next_rotation_time"].(time.Time).Equal(lastRotation.Add(2*time.Hour)) ||
+		resp.Data["max_encryptions_per_version"].(int64) != 3 ||
+		resp.Data["latest_version_encryptions"].(int64) != 0 {
+		t.Fatalf("bad automatic rotation config: %#v", resp.Data)
+	}
+
+	// The key is rotated once the latest version reached the usage limit
+	encrypt(b, s, 2)
+	resp = doReq(b, s, logical.ReadOperation, "keys/foo", nil)
+	if resp.Data["latest_version"].(int) != 1 || resp.Data["latest_version_encryptions"].(int64) != 2 {
+		t.Fatalf("bad key after 2 encryptions: %#v", resp.Data)
+	}
+	encrypt(b, s, 1)
+	resp = doReq(b, s, logical.ReadOperation, "keys/foo", nil)
+	if resp.Data["latest_version"].(int) != 2 || resp.Data["latest_version_encryptions"].(int64) != 0 {
+		t.Fatalf("expected key to be rotated after 3 encryptions: %#v", resp.Data)
+	}
+
+	// The periodic function persists the counts of the new version
+	encrypt(b, s, 1)
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := keysutil.LoadPolicy(context.Background(), s, "policy/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.LatestVersion != 2 || stored.Keys["2"].EncryptionCount != 1 || stored.Keys["1"].EncryptionCount != 3 {
+		t.Fatalf("bad persisted counts: %d %d", stored.Keys["1"].EncryptionCount, stored.Keys["2"].EncryptionCount)
+	}
+
+	// and rotates the key once the latest version is older than the period
+	p, _, err := b.lm.GetPolicy(context.Background(), keysutil.PolicyRequest{
+		Storage: s,
+		Name:    "foo",
+	}, b.GetRandomReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Lock(true)
+	entry := p.Keys[strconv.Itoa(p.LatestVersion)]
+	entry.CreationTime = entry.CreationTime.Add(-3 * time.Hour)
+	p.Keys[strconv.Itoa(p.LatestVersion)] = entry
+	p.Unlock()
+
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+	resp = doReq(b, s, logical.ReadOperation, "keys/foo", nil)
+	if resp.Data["latest_version"].(int) != 3 {
+		t.Fatalf("expected key to be rotated by the periodic function: %#v", resp.Data)
+	}
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+	resp = doReq(b, s, logical.ReadOperation, "keys/foo", nil)
+	if resp.Data["latest_version"].(int) != 3 {
+		t.Fatalf("expected key not to be rotated again: %#v", resp.Data)
+	}
+
+	// Only the keys with automatic rotation configured are indexed for the
+	// periodic function, including the restored ones
+	checkIndex := func(expected ...string) {
+		t.Helper()
+		names, err := s.List(context.Background(), autoRotateIndexPrefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(names)
+		if strings.Join(names, ",") != strings.Join(expected, ",") {
+			t.Fatalf("bad auto rotate index: expected %v, got %v", expected, names)
+		}
+	}
+	doReq(b, s, logical.UpdateOperation, "keys/bar", nil)
+	checkIndex("foo")
+
+	doReq(b, s, logical.UpdateOperation, "keys/foo/config", map[string]interface{}{
+		"exportable":             true,
+		"allow_plaintext_backup": true,
+		"deletion_allowed":       true,
+	})
+	resp = doReq(b, s, logical.ReadOperation, "backup/foo", nil)
+	doReq(b, s, logical.UpdateOperation, "restore/baz", map[string]interface{}{
+		"backup": resp.Data["backup"],
+	})
+	checkIndex("baz", "foo")
+
+	doReq(b, s, logical.DeleteOperation, "keys/foo", nil)
+	doReq(b, s, logical.UpdateOperation, "keys/baz/config", map[string]interface{}{
+		"auto_rotate_period":          0,
+		"max_encryptions_per_version": 0,
+	})
+	checkIndex()
+
+	// Without the policy cache, counts are persisted by each request
+	s = &logical.InmemStorage{}
+	b = createBackendWithForceNoCacheWithSysViewWithStorage(t, s)
+	doReq(b, s, logical.UpdateOperation, "keys/foo", nil)
+	doReq(b, s, logical.UpdateOperation, "keys/foo/config", map[string]interface{}{
+		"max_encryptions_per_version": 2,
+	})
+	encrypt(b, s, 1)
+	resp = doReq(b, s, logical.ReadOperation, "keys/foo", nil)
+	if resp.Data["latest_version"].(int) != 1 || resp.Data["latest_version_encryptions"].(int64) != 1 {
+		t.Fatalf("bad key after 1 encryption without cache: %#v", resp.Data)
+	}
+	encrypt(b, s, 1)
+	resp = doReq(b, s, logical.ReadOperation, "keys/foo", nil)
+	if resp.Data["latest_version"].(int) != 2 {
+		t.Fatalf("expected key to be rotated after 2 encryptions without cache: %#v", resp.Data)
+	}
+}
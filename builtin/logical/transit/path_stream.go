@@ -0,0 +1,217 @@
+package transit
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const streamContentType = "application/octet-stream"
+
+func (b *backend) pathEncryptStream() *framework.Path {
+	return &framework.Path{
+		Pattern: "encrypt-stream/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the policy",
+			},
+
+			"context": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Base64 encoded context for key derivation. Required if key derivation is enabled",
+			},
+
+			"key_version": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `The version of the key to use for encryption.
+Must be 0 (for latest) or a value greater than or equal
+to the min_encryption_version configured on the key.`,
+			},
+
+			"chunk_size": &framework.FieldSchema{
+				Type:    framework.TypeInt,
+				Default: keysutil.DefaultStreamChunkSize,
+				Description: `The size in bytes of the plaintext chunks
+the stream is split into. Defaults to 64 KiB, and
+cannot exceed 1 MiB.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathEncryptStreamWrite,
+		},
+
+		HelpSynopsis:    pathEncryptStreamHelpSyn,
+		HelpDescription: pathEncryptStreamHelpDesc,
+	}
+}
+
+func (b *backend) pathDecryptStream() *framework.Path {
+	return &framework.Path{
+		Pattern: "decrypt-stream/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the policy",
+			},
+
+			"context": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `
+Base64 encoded context for key derivation. Required if key derivation is
+enabled.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathDecryptStreamWrite,
+		},
+
+		HelpSynopsis:    pathDecryptStreamHelpSyn,
+		HelpDescription: pathDecryptStreamHelpDesc,
+	}
+}
+
+func (b *backend) pathEncryptStreamWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if req.HTTPRequest == nil || req.HTTPRequest.Body == nil || req.ResponseWriter == nil {
+		return logical.ErrorResponse("the plaintext must be sent as the request body with the %s content type", streamContentType), logical.ErrInvalidRequest
+	}
+
+	streamCtx, err := decodeStreamContext(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    d.Get("name").(string),
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
+	}
+	defer b.autoRotateAfterUse(ctx, req.Storage, p)
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+
+	// The stream key is derived up front so that the policy is not locked
+	// while the stream is processed
+	enc, err := p.NewStreamEncrypter(d.Get("key_version").(int), streamCtx, d.Get("chunk_size").(int), b.GetRandomReader())
+	p.Unlock()
+	if err != nil {
+		return streamErrorResponse(err)
+	}
+
+	return writeStream(req, func(w io.Writer) error {
+		return enc.Encrypt(w, req.HTTPRequest.Body)
+	})
+}
+
+func (b *backend) pathDecryptStreamWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if req.HTTPRequest == nil || req.HTTPRequest.Body == nil || req.ResponseWriter == nil {
+		return logical.ErrorResponse("the stream must be sent as the request body with the %s content type", streamContentType), logical.ErrInvalidRequest
+	}
+
+	streamCtx, err := decodeStreamContext(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	header, err := keysutil.ReadStreamHeader(req.HTTPRequest.Body)
+	if err != nil {
+		return streamErrorResponse(err)
+	}
+
+	p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    d.Get("name").(string),
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+
+	dec, err := p.NewStreamDecrypter(streamCtx, header)
+	p.Unlock()
+	if err != nil {
+		return streamErrorResponse(err)
+	}
+
+	return writeStream(req, func(w io.Writer) error {
+		return dec.Decrypt(w, req.HTTPRequest.Body)
+	})
+}
+
+func decodeStreamContext(d *framework.FieldData) ([]byte, error) {
+	contextRaw := d.Get("context").(string)
+	if len(contextRaw) == 0 {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(contextRaw)
+}
+
+func streamErrorResponse(err error) (*logical.Response, error) {
+	switch err.(type) {
+	case errutil.UserError:
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	default:
+		return nil, err
+	}
+}
+
+// writeStream writes the output of a stream operation as the response body.
+// Once the output has started the status code can no longer change, so later
+// errors are reported in a trailer instead.
+func writeStream(req *logical.Request, fn func(io.Writer) error) (*logical.Response, error) {
+	header := req.ResponseWriter.Header()
+	header.Set("Content-Type", streamContentType)
+	header.Set("Trailer", consts.StreamErrorTrailerName)
+
+	err := fn(req.ResponseWriter)
+	switch {
+	case err == nil:
+		return nil, nil
+	case req.ResponseWriter.Written():
+		header.Set(consts.StreamErrorTrailerName, err.Error())
+		return nil, nil
+	default:
+		header.Del("Content-Type")
+		header.Del("Trailer")
+		return streamErrorResponse(err)
+	}
+}
+
+const pathEncryptStreamHelpSyn = `Encrypt a stream using a named key`
+
+const pathEncryptStreamHelpDesc = `
+This path uses the named key from the request path to encrypt the request
+body, sent with the application/octet-stream content type, without holding it
+in memory. The body is split into chunks that are encrypted separately and
+returned as they are processed. Other parameters are given in the query
+string.
+`
+
+const pathDecryptStreamHelpSyn = `Decrypt a stream using a named key`
+
+const pathDecryptStreamHelpDesc = `
+This path uses the named key from the request path to decrypt a stream
+returned by the encrypt-stream path, sent as the request body with the
+application/octet-stream content type. Each chunk is authenticated before being
+returned. If the stream turns out to be truncated or tampered with after the
+response started, the error is reported in the X-Vault-Stream-Error trailer.
+`
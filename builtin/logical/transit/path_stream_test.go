@@ -0,0 +1,92 @@
+package transit
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestTransit_Stream(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	doStream := func(path string, body []byte) (*httptest.ResponseRecorder, *logical.Response, error) {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		httpReq := httptest.NewRequest("POST", "/v1/transit/"+path, bytes.NewReader(body))
+		httpReq.Header.Set("Content-Type", streamContentType)
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation:      logical.UpdateOperation,
+			Path:           path,
+			Storage:        s,
+			Data:           map[string]interface{}{},
+			HTTPRequest:    httpReq,
+			ResponseWriter: logical.NewHTTPResponseWriter(recorder),
+		})
+		return recorder, resp, err
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "keys/backup",
+		Storage:   s,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	plaintext := make([]byte, 200*1024)
+	if _, err := rand.Read(plaintext); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder, resp, err := doStream("encrypt-stream/backup", plaintext)
+	if err != nil || resp != nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if recorder.Header().Get(consts.StreamErrorTrailerName) != "" {
+		t.Fatalf("unexpected stream error: %s", recorder.Header().Get(consts.StreamErrorTrailerName))
+	}
+	ciphertext := recorder.Body.Bytes()
+
+	recorder, resp, err = doStream("decrypt-stream/backup", ciphertext)
+	if err != nil || resp != nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if recorder.Header().Get(consts.StreamErrorTrailerName) != "" {
+		t.Fatalf("unexpected stream error: %s", recorder.Header().Get(consts.StreamErrorTrailerName))
+	}
+	if !bytes.Equal(recorder.Body.Bytes(), plaintext) {
+		t.Fatal("bad plaintext after round trip")
+	}
+
+	// A stream truncated after the first chunks has its error reported in the
+	// trailer, as the output has already started
+	recorder, resp, err = doStream("decrypt-stream/backup", ciphertext[:len(ciphertext)-100])
+	if err != nil || resp != nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if recorder.Header().Get(consts.StreamErrorTrailerName) == "" {
+		t.Fatal("expected stream error in the trailer")
+	}
+
+	// An invalid header is reported before any output
+	_, resp, err = doStream("decrypt-stream/backup", []byte("not a stream"))
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error decrypting an invalid stream, got resp:%#v", resp)
+	}
+
+	// Requests without a streamed body are rejected
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "encrypt-stream/backup",
+		Storage:   s,
+	})
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error encrypting without a streamed body, got resp:%#v", resp)
+	}
+}
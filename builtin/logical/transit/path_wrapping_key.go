@@ -0,0 +1,94 @@
+package transit
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	wrappingKeyName          = "wrapping-key"
+	wrappingKeyStoragePrefix = "import/"
+)
+
+func (b *backend) pathWrappingKey() *framework.Path {
+	return &framework.Path{
+		Pattern: "wrapping_key",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathWrappingKeyRead,
+		},
+
+		HelpSynopsis:    pathWrappingKeyHelpSyn,
+		HelpDescription: pathWrappingKeyHelpDesc,
+	}
+}
+
+func (b *backend) pathWrappingKeyRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	p, err := b.getWrappingKey(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	derBytes, err := x509.MarshalPKIXPublicKey(p.Keys[strconv.Itoa(p.LatestVersion)].RSAKey.Public())
+	if err != nil {
+		return nil, errwrap.Wrapf("error marshaling wrapping key: {{err}}", err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: derBytes,
+	})
+	if len(pemBytes) == 0 {
+		return nil, fmt.Errorf("failed to PEM-encode wrapping key")
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"public_key": string(pemBytes),
+		},
+	}, nil
+}
+
+// getWrappingKey returns the RSA key used to unwrap imported key material,
+// generating it on first use. The wrapping key is stored apart from the named
+// keys so that it can never be used for other operations.
+func (b *backend) getWrappingKey(ctx context.Context, storage logical.Storage) (*keysutil.Policy, error) {
+	b.wrappingKeyLock.Lock()
+	defer b.wrappingKeyLock.Unlock()
+
+	p, err := keysutil.LoadPolicy(ctx, storage, wrappingKeyStoragePrefix+"policy/"+wrappingKeyName)
+	if err != nil {
+		return nil, err
+	}
+	if p != nil {
+		return p, nil
+	}
+
+	p = keysutil.NewPolicy(keysutil.PolicyConfig{
+		Name:          wrappingKeyName,
+		Type:          keysutil.KeyType_RSA4096,
+		StoragePrefix: wrappingKeyStoragePrefix,
+	})
+	if err := p.Rotate(ctx, storage, b.GetRandomReader()); err != nil {
+		return nil, errwrap.Wrapf("error generating wrapping key: {{err}}", err)
+	}
+
+	return p, nil
+}
+
+const pathWrappingKeyHelpSyn = `Returns the public key to use for wrapping imported keys`
+
+const pathWrappingKeyHelpDesc = `
+This path is used to retrieve the RSA-4096 public key used to wrap key
+material for import. The key is generated the first time it is requested.
+Key material is imported by encrypting an ephemeral AES-256 key with this
+public key using RSA-OAEP, and wrapping the key material with the ephemeral
+key using AES key wrap with padding (RFC 5649).
+`
@@ -31,6 +31,7 @@ import (
 	"github.com/hashicorp/vault/command/agent/auth/kubernetes"
 	"github.com/hashicorp/vault/command/agent/cache"
 	agentConfig "github.com/hashicorp/vault/command/agent/config"
+	"github.com/hashicorp/vault/command/agent/exec"
 	"github.com/hashicorp/vault/command/agent/sink"
 	"github.com/hashicorp/vault/command/agent/sink/file"
 	"github.com/hashicorp/vault/command/agent/sink/inmem"
@@ -429,19 +430,44 @@ func (c *AgentCommand) Run(args []string) int {
 			return 1
 		}
 
-		// Create the lease cache proxier and set its underlying proxier to
-		// the API proxier.
-		leaseCache, err := cache.NewLeaseCache(&cache.LeaseCacheConfig{
+		// Open the persistent storage of the cache, if configured, so that
+		// cached leases and tokens survive agent restarts
+		leaseCacheConfig := &cache.LeaseCacheConfig{
 			Client:      client,
 			BaseContext: ctx,
 			Proxier:     apiProxy,
 			Logger:      cacheLogger.Named("leasecache"),
-		})
+		}
+		if config.Cache.Persist != nil {
+			ps, err := cache.NewPersistentStorage(&cache.PersistConfig{
+				Path:   config.Cache.Persist.Path,
+				Client: client,
+				Logger: cacheLogger.Named("persist"),
+			})
+			if err != nil {
+				c.UI.Error(fmt.Sprintf("Error opening persistent cache: %v", err))
+				return 1
+			}
+			defer ps.Close()
+
+			leaseCacheConfig.Storage = ps
+			leaseCacheConfig.KeyWrapTTL = config.Cache.Persist.KeyWrapTTL
+		}
+
+		// Create the lease cache proxier and set its underlying proxier to
+		// the API proxier.
+		leaseCache, err := cache.NewLeaseCache(leaseCacheConfig)
 		if err != nil {
 			c.UI.Error(fmt.Sprintf("Error creating lease cache: %v", err))
 			return 1
 		}
 
+		// Restore the persisted cache before serving any request
+		if err := leaseCache.Restore(ctx); err != nil {
+			c.UI.Error(fmt.Sprintf("Error restoring persistent cache: %v", err))
+			return 1
+		}
+
 		var inmemSink sink.Sink
 		if config.Cache.UseAutoAuthToken {
 			cacheLogger.Debug("auto-auth token is allowed to be used; configuring inmem sink")
@@ -528,7 +554,8 @@ func (c *AgentCommand) Run(args []string) int {
 	// TODO: implement support for SIGHUP reloading of configuration
 	// signal.Notify(c.signalCh)
 
-	var ssDoneCh, ahDoneCh, tsDoneCh chan struct{}
+	var ssDoneCh, ahDoneCh, tsDoneCh, esDoneCh chan struct{}
+	var es *exec.Server
 	// Start auto-auth and sink servers
 	if method != nil {
 		enableTokenCh := len(config.Templates) > 0
@@ -538,6 +565,7 @@ func (c *AgentCommand) Run(args []string) int {
 			WrapTTL:                      config.AutoAuth.Method.WrapTTL,
 			EnableReauthOnNewCredentials: config.AutoAuth.EnableReauthOnNewCredentials,
 			EnableTemplateTokenCh:        enableTokenCh,
+			EnableExecTokenCh:            config.Exec != nil,
 		})
 		ahDoneCh = ah.DoneCh
 
@@ -561,6 +589,21 @@ func (c *AgentCommand) Run(args []string) int {
 		go ah.Run(ctx, method)
 		go ss.Run(ctx, ah.OutputCh, sinks)
 		go ts.Run(ctx, ah.TemplateTokenCh, config.Templates)
+
+		if config.Exec != nil {
+			es = exec.NewServer(&exec.ServerConfig{
+				Logger:       c.logger.Named("exec.server"),
+				LogLevel:     level,
+				LogWriter:    c.logWriter,
+				VaultConf:    config.Vault,
+				Namespace:    namespace,
+				EnvTemplates: config.EnvTemplates,
+				Exec:         config.Exec,
+			})
+			esDoneCh = es.DoneCh
+
+			go es.Run(ctx, ah.ExecTokenCh)
+		}
 	}
 
 	// Server configuration output
@@ -599,6 +642,20 @@ func (c *AgentCommand) Run(args []string) int {
 		if tsDoneCh != nil {
 			<-tsDoneCh
 		}
+	case <-esDoneCh:
+		// The child process exited, so exit with its exit code
+		c.logger.Info("child process finished, exiting")
+		cancelFunc()
+		if ahDoneCh != nil {
+			<-ahDoneCh
+		}
+		if ssDoneCh != nil {
+			<-ssDoneCh
+		}
+		if tsDoneCh != nil {
+			<-tsDoneCh
+		}
+		return es.ExitCode()
 	case <-c.ShutdownCh:
 		c.UI.Output("==> Vault agent shutdown triggered")
 		cancelFunc()
@@ -612,6 +669,10 @@ func (c *AgentCommand) Run(args []string) int {
 		if tsDoneCh != nil {
 			<-tsDoneCh
 		}
+
+		if esDoneCh != nil {
+			<-esDoneCh
+		}
 	}
 
 	return 0
@@ -33,12 +33,14 @@ type AuthHandler struct {
 	DoneCh                       chan struct{}
 	OutputCh                     chan string
 	TemplateTokenCh              chan string
+	ExecTokenCh                  chan string
 	logger                       hclog.Logger
 	client                       *api.Client
 	random                       *rand.Rand
 	wrapTTL                      time.Duration
 	enableReauthOnNewCredentials bool
 	enableTemplateTokenCh        bool
+	enableExecTokenCh            bool
 }
 
 type AuthHandlerConfig struct {
@@ -47,6 +49,7 @@ type AuthHandlerConfig struct {
 	WrapTTL                      time.Duration
 	EnableReauthOnNewCredentials bool
 	EnableTemplateTokenCh        bool
+	EnableExecTokenCh            bool
 }
 
 func NewAuthHandler(conf *AuthHandlerConfig) *AuthHandler {
@@ -56,12 +59,14 @@ func NewAuthHandler(conf *AuthHandlerConfig) *AuthHandler {
 		// has been shut down, during agent shutdown, we won't block
 		OutputCh:                     make(chan string, 1),
 		TemplateTokenCh:              make(chan string, 1),
+		ExecTokenCh:                  make(chan string, 1),
 		logger:                       conf.Logger,
 		client:                       conf.Client,
 		random:                       rand.New(rand.NewSource(int64(time.Now().Nanosecond()))),
 		wrapTTL:                      conf.WrapTTL,
 		enableReauthOnNewCredentials: conf.EnableReauthOnNewCredentials,
 		enableTemplateTokenCh:        conf.EnableTemplateTokenCh,
+		enableExecTokenCh:            conf.EnableExecTokenCh,
 	}
 
 	return ah
@@ -85,6 +90,7 @@ func (ah *AuthHandler) Run(ctx context.Context, am AuthMethod) {
 		close(ah.OutputCh)
 		close(ah.DoneCh)
 		close(ah.TemplateTokenCh)
+		close(ah.ExecTokenCh)
 		ah.logger.Info("auth handler stopped")
 	}()
 
@@ -208,6 +214,9 @@ func (ah *AuthHandler) Run(ctx context.Context, am AuthMethod) {
 			if ah.enableTemplateTokenCh {
 				ah.TemplateTokenCh <- secret.Auth.ClientToken
 			}
+			if ah.enableExecTokenCh {
+				ah.ExecTokenCh <- secret.Auth.ClientToken
+			}
 
 			am.CredSuccess()
 		}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"sync"
 	"testing"
@@ -1321,3 +1323,166 @@ func TestCache_AuthTokenCreateOrphan(t *testing.T) {
 		})
 	})
 }
+
+func TestCache_Persist_Restore(t *testing.T) {
+	coreConfig := &vault.CoreConfig{
+		DisableMlock: true,
+		DisableCache: true,
+		Logger:       hclog.NewNullLogger(),
+		LogicalBackends: map[string]logical.Factory{
+			"kv": vault.LeasedPassthroughBackendFactory,
+		},
+	}
+
+	cleanup, client, testClient, _ := setupClusterAndAgent(namespace.RootContext(nil), t, coreConfig)
+	defer cleanup()
+
+	if err := client.Sys().Mount("kv", &api.MountInput{Type: "kv"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Logical().Write("kv/foo", map[string]interface{}{
+		"value": "bar",
+		"ttl":   "1h",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The token that would have been obtained by auto-auth
+	resp, err := client.Logical().Write("auth/userpass/login/foo", map[string]interface{}{
+		"password": "bar",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	autoAuthToken := resp.Auth.ClientToken
+
+	dir, err := ioutil.TempDir("", "agent-cache-persist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cacheLogger := logging.NewVaultLogger(hclog.Trace).Named("cache")
+	listenAddr := "127.0.0.1:0"
+
+	// startAgent starts a caching agent using the persistent cache and
+	// returns a client talking to it along with a func to stop it
+	startAgent := func() (*LeaseCache, *api.Client, func()) {
+		ctx, cancelFunc := context.WithCancel(namespace.RootContext(nil))
+
+		ps, err := NewPersistentStorage(&PersistConfig{
+			Path:   dir,
+			Client: client,
+			Logger: cacheLogger.Named("persist"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		apiProxy, err := NewAPIProxy(&APIProxyConfig{
+			Client: client,
+			Logger: cacheLogger.Named("apiproxy"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		leaseCache, err := NewLeaseCache(&LeaseCacheConfig{
+			Client:      client,
+			BaseContext: ctx,
+			Proxier:     apiProxy,
+			Logger:      cacheLogger.Named("leasecache"),
+			Storage:     ps,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := leaseCache.Restore(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		// The agent listens on the same address across restarts since the
+		// address is part of the cached request
+		listener, err := net.Listen("tcp", listenAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		listenAddr = listener.Addr().String()
+		server := httptest.NewUnstartedServer(Handler(ctx, cacheLogger, leaseCache, nil))
+		server.Listener.Close()
+		server.Listener = listener
+		server.Start()
+
+		agentClient, err := testClient.Clone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := agentClient.SetAddress(server.URL); err != nil {
+			t.Fatal(err)
+		}
+		agentClient.SetToken(autoAuthToken)
+
+		stop := func() {
+			cancelFunc()
+			// Wait for the lifetime watchers to exit
+			time.Sleep(100 * time.Millisecond)
+			server.Close()
+			ps.Close()
+		}
+		return leaseCache, agentClient, stop
+	}
+
+	leaseCache, agentClient, stop := startAgent()
+	if err := leaseCache.RegisterAutoAuthToken(autoAuthToken); err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := agentClient.Logical().Read("kv/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaseID := secret.LeaseID
+
+	secret, err = agentClient.Auth().Token().Create(&api.TokenCreateRequest{
+		Policies: []string{"default"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	childToken := secret.Auth.ClientToken
+
+	stop()
+
+	// The cached lease and tokens are restored after a restart
+	leaseCache, agentClient, stop = startAgent()
+	defer stop()
+
+	for indexName, value := range map[string]string{
+		cachememdb.IndexNameLease: leaseID,
+		cachememdb.IndexNameToken: childToken,
+	} {
+		index, err := leaseCache.db.Get(indexName, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index == nil {
+			t.Fatalf("expected %s %q to be restored", indexName, value)
+		}
+	}
+	index, err := leaseCache.db.Get(cachememdb.IndexNameToken, autoAuthToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index == nil {
+		t.Fatal("expected the auto-auth token to be restored")
+	}
+
+	// The same request is served from the restored cache
+	secret, err = agentClient.Logical().Read("kv/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.LeaseID != leaseID {
+		t.Fatalf("expected cached lease %q, got %q", leaseID, secret.LeaseID)
+	}
+}
@@ -0,0 +1,237 @@
+package cacheboltdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hashicorp/errwrap"
+	hclog "github.com/hashicorp/go-hclog"
+	wrapping "github.com/hashicorp/go-kms-wrapping"
+	aeadwrapper "github.com/hashicorp/go-kms-wrapping/wrappers/aead"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// DatabaseFileName is the name of the persistent cache file in the
+	// configured directory
+	DatabaseFileName = "vault-agent-cache.db"
+
+	// KeyWrappingTokenKey is the meta key under which the response wrapping
+	// token of the encryption key is stored
+	KeyWrappingTokenKey = "key_wrapping_token"
+
+	// Permissions to use on the db file. This is only used if the database
+	// file does not exist and needs to be created.
+	dbFileMode = 0600
+
+	dbOpenTimeout = 1 * time.Second
+)
+
+var (
+	// Bucket names we perform transactions in
+	metaBucketName  = []byte("meta")
+	indexBucketName = []byte("indexes")
+
+	// ErrNoKey is returned when encrypting or decrypting entries before an
+	// encryption key has been set
+	ErrNoKey = errors.New("no encryption key set on the persistent cache")
+)
+
+// BoltStorage is a persistent cache of the agent's lease cache indexes backed
+// by BoltDB. The indexes are encrypted at rest with AES-GCM, while the meta
+// bucket holds the unencrypted values needed to recover the encryption key.
+type BoltStorage struct {
+	db     *bolt.DB
+	logger hclog.Logger
+
+	l       sync.RWMutex
+	wrapper *aeadwrapper.Wrapper
+}
+
+// BoltStorageConfig is the configuration for opening the persistent cache
+type BoltStorageConfig struct {
+	// Path is the directory the database file is created in
+	Path   string
+	Logger hclog.Logger
+}
+
+// NewBoltStorage opens the persistent cache database in the configured
+// directory, creating it if needed. SetKey must be called before any index
+// is stored or read.
+func NewBoltStorage(config *BoltStorageConfig) (*BoltStorage, error) {
+	if config == nil || config.Path == "" {
+		return nil, errors.New("no persistent cache path provided")
+	}
+	if config.Logger == nil {
+		return nil, errors.New("no logger provided")
+	}
+
+	if err := os.MkdirAll(config.Path, 0700); err != nil {
+		return nil, errwrap.Wrapf("failed to create the persistent cache directory: {{err}}", err)
+	}
+
+	dbPath := filepath.Join(config.Path, DatabaseFileName)
+	db, err := bolt.Open(dbPath, dbFileMode, &bolt.Options{Timeout: dbOpenTimeout})
+	if err != nil {
+		return nil, errwrap.Wrapf(fmt.Sprintf("failed to open persistent cache %q: {{err}}", dbPath), err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{metaBucketName, indexBucketName} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return errwrap.Wrapf(fmt.Sprintf("failed to create bucket %q: {{err}}", name), err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStorage{
+		db:     db,
+		logger: config.Logger,
+	}, nil
+}
+
+// SetKey sets the AES-GCM key used to encrypt and decrypt the indexes
+func (b *BoltStorage) SetKey(key []byte) error {
+	wrapper := aeadwrapper.NewWrapper(nil)
+	if err := wrapper.SetAESGCMKeyBytes(key); err != nil {
+		return err
+	}
+
+	b.l.Lock()
+	b.wrapper = wrapper
+	b.l.Unlock()
+	return nil
+}
+
+// Key returns the encryption key, or nil if it has not been set
+func (b *BoltStorage) Key() []byte {
+	b.l.RLock()
+	defer b.l.RUnlock()
+
+	if b.wrapper == nil {
+		return nil
+	}
+	return b.wrapper.GetKeyBytes()
+}
+
+func (b *BoltStorage) getWrapper() (*aeadwrapper.Wrapper, error) {
+	b.l.RLock()
+	defer b.l.RUnlock()
+
+	if b.wrapper == nil {
+		return nil, ErrNoKey
+	}
+	return b.wrapper, nil
+}
+
+// Set encrypts and stores the serialized index under the given ID. The ID is
+// used as additional data so that entries cannot be swapped.
+func (b *BoltStorage) Set(ctx context.Context, id string, plaintext []byte) error {
+	wrapper, err := b.getWrapper()
+	if err != nil {
+		return err
+	}
+
+	blobInfo, err := wrapper.Encrypt(ctx, plaintext, []byte(id))
+	if err != nil {
+		return errwrap.Wrapf("failed to encrypt index: {{err}}", err)
+	}
+	value, err := proto.Marshal(blobInfo)
+	if err != nil {
+		return errwrap.Wrapf("failed to marshal encrypted index: {{err}}", err)
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(indexBucketName).Put([]byte(id), value)
+	})
+}
+
+// Delete removes the index with the given ID. It is not an error if the index
+// does not exist.
+func (b *BoltStorage) Delete(id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(indexBucketName).Delete([]byte(id))
+	})
+}
+
+// GetAll returns the decrypted serialized indexes
+func (b *BoltStorage) GetAll(ctx context.Context) ([][]byte, error) {
+	wrapper, err := b.getWrapper()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries [][]byte
+	err = b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(indexBucketName).ForEach(func(k, v []byte) error {
+			blobInfo := new(wrapping.EncryptedBlobInfo)
+			if err := proto.Unmarshal(v, blobInfo); err != nil {
+				return errwrap.Wrapf(fmt.Sprintf("failed to unmarshal index %q: {{err}}", k), err)
+			}
+			plaintext, err := wrapper.Decrypt(ctx, blobInfo, k)
+			if err != nil {
+				return errwrap.Wrapf(fmt.Sprintf("failed to decrypt index %q: {{err}}", k), err)
+			}
+			entries = append(entries, plaintext)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetMeta returns the unencrypted meta value stored under the given key, or
+// nil if it does not exist
+func (b *BoltStorage) GetMeta(key string) ([]byte, error) {
+	var value []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(metaBucketName).Get([]byte(key)); v != nil {
+			value = make([]byte, len(v))
+			copy(value, v)
+		}
+		return nil
+	})
+	return value, err
+}
+
+// SetMeta stores an unencrypted meta value under the given key. A nil value
+// deletes the key.
+func (b *BoltStorage) SetMeta(key string, value []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(metaBucketName)
+		if value == nil {
+			return bucket.Delete([]byte(key))
+		}
+		return bucket.Put([]byte(key), value)
+	})
+}
+
+// Clear removes all the stored indexes
+func (b *BoltStorage) Clear() error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(indexBucketName); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(indexBucketName)
+		return err
+	})
+}
+
+// Close closes the database
+func (b *BoltStorage) Close() error {
+	return b.db.Close()
+}
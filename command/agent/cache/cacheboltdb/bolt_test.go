@@ -0,0 +1,123 @@
+package cacheboltdb
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	hclog "github.com/hashicorp/go-hclog"
+)
+
+func getTestBoltStorage(t *testing.T, dir string, key []byte) *BoltStorage {
+	t.Helper()
+
+	b, err := NewBoltStorage(&BoltStorageConfig{
+		Path:   dir,
+		Logger: hclog.NewNullLogger(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != nil {
+		if err := b.SetKey(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b
+}
+
+func TestBoltStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent-cache-bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	key := bytes.Repeat([]byte{1}, 32)
+
+	b := getTestBoltStorage(t, dir, nil)
+	if err := b.Set(ctx, "foo", []byte("bar")); err != ErrNoKey {
+		t.Fatalf("expected ErrNoKey, got %v", err)
+	}
+	if err := b.SetKey(key); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"foo", "bar", "baz"} {
+		if err := b.Set(ctx, id, []byte("secret-"+id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Delete("bar"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetMeta(KeyWrappingTokenKey, []byte("wrapping-token")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Entries are encrypted at rest
+	raw, err := ioutil.ReadFile(filepath.Join(dir, DatabaseFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("secret-foo")) {
+		t.Fatal("found plaintext entry in the database file")
+	}
+
+	// Entries survive reopening the database
+	b = getTestBoltStorage(t, dir, key)
+	entries, err := b.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, string(entry))
+	}
+	sort.Strings(got)
+	if len(got) != 2 || got[0] != "secret-baz" || got[1] != "secret-foo" {
+		t.Fatalf("bad entries: %v", got)
+	}
+
+	token, err := b.GetMeta(KeyWrappingTokenKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(token) != "wrapping-token" {
+		t.Fatalf("bad meta value: %q", token)
+	}
+	if err := b.SetMeta(KeyWrappingTokenKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := b.GetMeta(KeyWrappingTokenKey); err != nil || token != nil {
+		t.Fatalf("expected meta value to be deleted, got %q, %v", token, err)
+	}
+
+	// Entries cannot be decrypted with another key
+	if err := b.SetKey(bytes.Repeat([]byte{2}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GetAll(ctx); err == nil {
+		t.Fatal("expected error decrypting entries with the wrong key")
+	}
+
+	if err := b.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = b.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected no entries after clearing, got %d", len(entries))
+	}
+	b.Close()
+}
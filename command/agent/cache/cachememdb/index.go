@@ -1,6 +1,11 @@
 package cachememdb
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
 
 // Index holds the response to be cached along with multiple other values that
 // serve as pointers to refer back to this index.
@@ -44,10 +49,45 @@ type Index struct {
 	// Response is the serialized response object that the agent is caching.
 	Response []byte
 
+	// RequestMethod is the HTTP method of the request that resulted in the
+	// response held by this index.
+	// Required: false, Unique: false
+	RequestMethod string
+
+	// RequestToken is the token used in the request that resulted in the
+	// response held by this index.
+	// Required: false, Unique: false
+	RequestToken string
+
+	// RequestHeader is the header used in the request that resulted in the
+	// response held by this index.
+	// Required: false, Unique: false
+	RequestHeader http.Header
+
+	// LastRenewed is the time the secret in the response held by this index
+	// was last renewed by the agent.
+	// Required: false, Unique: false
+	LastRenewed time.Time
+
 	// RenewCtxInfo holds the context and the corresponding cancel func for the
 	// goroutine that manages the renewal of the secret belonging to the
-	// response in this index.
-	RenewCtxInfo *ContextInfo
+	// response in this index. It is not serialized.
+	RenewCtxInfo *ContextInfo `json:"-"`
+}
+
+// Serialize returns the JSON encoded index so that it can be persisted. The
+// renewal context is not part of the serialized index.
+func (i *Index) Serialize() ([]byte, error) {
+	return json.Marshal(i)
+}
+
+// Deserialize decodes an index previously encoded by Serialize
+func Deserialize(indexBytes []byte) (*Index, error) {
+	index := new(Index)
+	if err := json.Unmarshal(indexBytes, index); err != nil {
+		return nil, err
+	}
+	return index, nil
 }
 
 type IndexName uint32
@@ -18,6 +18,7 @@ import (
 	"github.com/hashicorp/errwrap"
 	hclog "github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/cache/cacheboltdb"
 	cachememdb "github.com/hashicorp/vault/command/agent/cache/cachememdb"
 	"github.com/hashicorp/vault/helper/namespace"
 	nshelper "github.com/hashicorp/vault/helper/namespace"
@@ -78,6 +79,15 @@ type LeaseCache struct {
 	// idLocks is used during cache lookup to ensure that identical requests made
 	// in parallel won't trigger multiple renewal goroutines.
 	idLocks []*locksutil.LockEntry
+
+	// ps is the optional persistent storage the cached indexes are also
+	// written to, so that they can be restored when the agent restarts.
+	ps         *cacheboltdb.BoltStorage
+	keyWrapTTL time.Duration
+
+	// shutdownCtx is the context the lease cache was created with. Persisted
+	// indexes are kept when their renewal stops because it is done.
+	shutdownCtx context.Context
 }
 
 // LeaseCacheConfig is the configuration for initializing a new
@@ -87,6 +97,15 @@ type LeaseCacheConfig struct {
 	BaseContext context.Context
 	Proxier     Proxier
 	Logger      hclog.Logger
+
+	// Storage is the optional persistent storage of the cache, opened with
+	// NewPersistentStorage
+	Storage *cacheboltdb.BoltStorage
+
+	// KeyWrapTTL is the TTL of the response wrapping token protecting the
+	// encryption key of the persistent storage. Defaults to
+	// DefaultKeyWrapTTL.
+	KeyWrapTTL time.Duration
 }
 
 // NewLeaseCache creates a new instance of a LeaseCache.
@@ -111,6 +130,11 @@ func NewLeaseCache(conf *LeaseCacheConfig) (*LeaseCache, error) {
 	// Create a base context for the lease cache layer
 	baseCtxInfo := cachememdb.NewContextInfo(conf.BaseContext)
 
+	keyWrapTTL := conf.KeyWrapTTL
+	if keyWrapTTL == 0 {
+		keyWrapTTL = DefaultKeyWrapTTL
+	}
+
 	return &LeaseCache{
 		client:      conf.Client,
 		proxier:     conf.Proxier,
@@ -119,6 +143,9 @@ func NewLeaseCache(conf *LeaseCacheConfig) (*LeaseCache, error) {
 		baseCtxInfo: baseCtxInfo,
 		l:           &sync.RWMutex{},
 		idLocks:     locksutil.CreateLocks(),
+		ps:          conf.Storage,
+		keyWrapTTL:  keyWrapTTL,
+		shutdownCtx: conf.BaseContext,
 	}, nil
 }
 
@@ -230,9 +257,12 @@ func (c *LeaseCache) Send(ctx context.Context, req *SendRequest) (*SendResponse,
 
 	// Build the index to cache based on the response received
 	index := &cachememdb.Index{
-		ID:          id,
-		Namespace:   namespace,
-		RequestPath: req.Request.URL.Path,
+		ID:            id,
+		Namespace:     namespace,
+		RequestPath:   req.Request.URL.Path,
+		RequestMethod: req.Request.Method,
+		RequestToken:  req.Token,
+		RequestHeader: req.Request.Header,
 	}
 
 	secret, err := api.ParseSecret(bytes.NewReader(resp.ResponseBody))
@@ -359,6 +389,7 @@ func (c *LeaseCache) Send(ctx context.Context, req *SendRequest) (*SendResponse,
 		c.logger.Error("failed to cache the proxied response", "error", err)
 		return nil, err
 	}
+	c.persistIndex(ctx, index)
 
 	// Start renewing the secret in the response
 	go c.startRenewing(renewCtx, index, req, secret)
@@ -384,6 +415,11 @@ func (c *LeaseCache) startRenewing(ctx context.Context, index *cachememdb.Index,
 			c.logger.Error("failed to evict index", "id", id, "error", err)
 			return
 		}
+
+		// Keep the persisted index on shutdown so that it can be restored
+		if c.shutdownCtx.Err() == nil {
+			c.evictPersistedIndex(id)
+		}
 	}()
 
 	client, err := c.client.Clone()
@@ -424,6 +460,10 @@ func (c *LeaseCache) startRenewing(ctx context.Context, index *cachememdb.Index,
 			return
 		case <-watcher.RenewCh():
 			c.logger.Debug("secret renewed", "path", req.Request.URL.Path)
+			if c.ps != nil {
+				index.LastRenewed = time.Now()
+				c.persistIndex(ctx, index)
+			}
 		case <-index.RenewCtxInfo.DoneCh:
 			// This case indicates the renewal process to shutdown and evict
 			// the cache entry. This is triggered when a specific secret
@@ -605,6 +645,13 @@ func (c *LeaseCache) handleCacheClear(ctx context.Context, in *cacheClearInput)
 			return err
 		}
 
+		// Remove the persisted indexes
+		if c.ps != nil {
+			if err := c.ps.Clear(); err != nil {
+				return err
+			}
+		}
+
 	default:
 		return errInvalidType
 	}
@@ -736,6 +783,7 @@ func (c *LeaseCache) handleRevocationRequest(ctx context.Context, req *SendReque
 				c.logger.Error("failed to persist index", "error", err)
 				return false, err
 			}
+			c.persistIndex(ctx, index)
 		}
 
 	case path == vaultPathLeaseRevoke:
@@ -873,6 +921,7 @@ func (c *LeaseCache) RegisterAutoAuthToken(token string) error {
 	// If the index is found, defer its cancelFunc
 	if oldIndex != nil {
 		defer oldIndex.RenewCtxInfo.CancelFunc()
+		c.evictPersistedIndex(oldIndex.ID)
 	}
 
 	// The following randomly generated values are required for index stored by
@@ -915,6 +964,16 @@ func (c *LeaseCache) RegisterAutoAuthToken(token string) error {
 		return err
 	}
 
+	if c.ps != nil {
+		c.persistIndex(context.Background(), index)
+
+		// Wrap the key of the persistent storage again, since the previous
+		// wrapping token is consumed when the key is recovered at startup
+		if err := c.wrapPersistKey(token); err != nil {
+			c.logger.Error("failed to wrap the persistent cache key", "error", err)
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,389 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	hclog "github.com/hashicorp/go-hclog"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/cache/cacheboltdb"
+	"github.com/hashicorp/vault/command/agent/cache/cachememdb"
+)
+
+const (
+	// DefaultKeyWrapTTL is the TTL of the response wrapping token protecting
+	// the encryption key of the persistent cache. The persisted entries cannot
+	// be restored once it has expired.
+	DefaultKeyWrapTTL = 24 * time.Hour
+
+	persistKeySize = 32
+)
+
+// PersistConfig is the configuration for opening the persistent storage of
+// the lease cache
+type PersistConfig struct {
+	// Path is the directory of the persistent cache
+	Path string
+
+	// Client is used to unwrap the encryption key of the persistent cache
+	Client *api.Client
+
+	Logger hclog.Logger
+}
+
+// NewPersistentStorage opens the persistent storage of the lease cache and
+// recovers its encryption key by unwrapping the response wrapping token
+// stored alongside the entries. Wrapping tokens are single use, so the key is
+// wrapped again once the next auto-auth token is registered with the lease
+// cache. If the key cannot be recovered a new one is generated and the
+// entries that can no longer be decrypted are discarded.
+func NewPersistentStorage(conf *PersistConfig) (*cacheboltdb.BoltStorage, error) {
+	if conf == nil {
+		return nil, errors.New("nil configuration provided")
+	}
+	if conf.Client == nil || conf.Logger == nil {
+		return nil, fmt.Errorf("missing configuration required params: %v", conf)
+	}
+
+	ps, err := cacheboltdb.NewBoltStorage(&cacheboltdb.BoltStorageConfig{
+		Path:   conf.Path,
+		Logger: conf.Logger,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := unwrapPersistKey(ps, conf.Client)
+	if err != nil {
+		conf.Logger.Warn("unable to recover the persistent cache key; discarding persisted entries", "error", err)
+	}
+	if key == nil {
+		if err := ps.Clear(); err != nil {
+			ps.Close()
+			return nil, errwrap.Wrapf("failed to clear the persistent cache: {{err}}", err)
+		}
+		key, err = uuid.GenerateRandomBytes(persistKeySize)
+		if err != nil {
+			ps.Close()
+			return nil, errwrap.Wrapf("failed to generate the persistent cache key: {{err}}", err)
+		}
+	}
+
+	if err := ps.SetKey(key); err != nil {
+		ps.Close()
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+// unwrapPersistKey returns the key of the persistent storage, or nil if there
+// is no wrapped key
+func unwrapPersistKey(ps *cacheboltdb.BoltStorage, client *api.Client) ([]byte, error) {
+	wrappingToken, err := ps.GetMeta(cacheboltdb.KeyWrappingTokenKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrappingToken) == 0 {
+		return nil, nil
+	}
+
+	// The wrapping token can only be used once, so it is removed whether or
+	// not the unwrap succeeds
+	if err := ps.SetMeta(cacheboltdb.KeyWrappingTokenKey, nil); err != nil {
+		return nil, err
+	}
+
+	client, err = client.Clone()
+	if err != nil {
+		return nil, err
+	}
+	client.ClearToken()
+
+	secret, err := client.Logical().Unwrap(string(wrappingToken))
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to unwrap the key: {{err}}", err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, errors.New("no key found in the unwrapped response")
+	}
+	encodedKey, ok := secret.Data["key"].(string)
+	if !ok {
+		return nil, errors.New("invalid key found in the unwrapped response")
+	}
+
+	return base64.StdEncoding.DecodeString(encodedKey)
+}
+
+// wrapPersistKey response wraps the encryption key of the persistent storage
+// with the given token and stores the wrapping token so that the key can be
+// recovered when the agent restarts.
+func (c *LeaseCache) wrapPersistKey(token string) error {
+	client, err := c.client.Clone()
+	if err != nil {
+		return err
+	}
+	client.SetToken(token)
+	client.SetWrappingLookupFunc(func(string, string) string {
+		return c.keyWrapTTL.String()
+	})
+
+	secret, err := client.Logical().Write("sys/wrapping/wrap", map[string]interface{}{
+		"key": base64.StdEncoding.EncodeToString(c.ps.Key()),
+	})
+	if err != nil {
+		return err
+	}
+	if secret == nil || secret.WrapInfo == nil || secret.WrapInfo.Token == "" {
+		return errors.New("no wrapping token found in the response")
+	}
+
+	return c.ps.SetMeta(cacheboltdb.KeyWrappingTokenKey, []byte(secret.WrapInfo.Token))
+}
+
+// persistIndex stores the index in the persistent storage, if configured
+func (c *LeaseCache) persistIndex(ctx context.Context, index *cachememdb.Index) {
+	if c.ps == nil {
+		return
+	}
+
+	indexBytes, err := index.Serialize()
+	if err == nil {
+		err = c.ps.Set(ctx, index.ID, indexBytes)
+	}
+	if err != nil {
+		c.logger.Error("failed to persist index", "id", index.ID, "error", err)
+	}
+}
+
+// evictPersistedIndex removes the index from the persistent storage, if
+// configured
+func (c *LeaseCache) evictPersistedIndex(id string) {
+	if c.ps == nil {
+		return
+	}
+
+	if err := c.ps.Delete(id); err != nil {
+		c.logger.Error("failed to delete persisted index", "id", id, "error", err)
+	}
+}
+
+// Restore loads the indexes from the persistent storage back into the cache
+// and resumes the renewal of the secrets that are still valid. Tokens are
+// restored before the leases and child tokens derived from them; entries
+// whose parent token could not be restored, and expired entries, are
+// discarded. It must be called before the cache starts serving requests.
+func (c *LeaseCache) Restore(ctx context.Context) error {
+	if c.ps == nil {
+		return nil
+	}
+
+	entries, err := c.ps.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	var tokens, leases []*cachememdb.Index
+	for _, entry := range entries {
+		index, err := cachememdb.Deserialize(entry)
+		if err != nil {
+			return errwrap.Wrapf("failed to deserialize index: {{err}}", err)
+		}
+		if index.Lease != "" {
+			leases = append(leases, index)
+		} else {
+			tokens = append(tokens, index)
+		}
+	}
+
+	// Restore the tokens in rounds so that parents are in the cache before
+	// their children
+	for len(tokens) > 0 {
+		var pending []*cachememdb.Index
+		for _, index := range tokens {
+			restored, err := c.restoreToken(index, tokens)
+			if err != nil {
+				return err
+			}
+			if !restored {
+				pending = append(pending, index)
+			}
+		}
+		if len(pending) == len(tokens) {
+			for _, index := range pending {
+				c.logger.Debug("discarding persisted token; parent token not restored", "id", index.ID)
+				c.evictPersistedIndex(index.ID)
+			}
+			break
+		}
+		tokens = pending
+	}
+
+	for _, index := range leases {
+		parent, err := c.db.Get(cachememdb.IndexNameToken, index.LeaseToken)
+		if err != nil {
+			return err
+		}
+		if parent == nil {
+			c.logger.Debug("discarding persisted lease; token not restored", "id", index.ID)
+			c.evictPersistedIndex(index.ID)
+			continue
+		}
+		if err := c.restoreIndex(index, parent.RenewCtxInfo.Ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreToken restores a token index. It returns false, without an error,
+// if the token is waiting for its parent in pending to be restored first.
+func (c *LeaseCache) restoreToken(index *cachememdb.Index, pending []*cachememdb.Index) (bool, error) {
+	// The auto-auth token is registered without a response, and is only
+	// restored while it is still valid so that leases it created keep being
+	// served.
+	if len(index.Response) == 0 {
+		if !c.tokenIsValid(index.Token) {
+			c.logger.Debug("discarding persisted auto-auth token; token no longer valid", "id", index.ID)
+			c.evictPersistedIndex(index.ID)
+			return true, nil
+		}
+		ctxInfo := c.createCtxInfo(nil)
+		index.RenewCtxInfo = ctxInfo
+		return true, c.db.Set(index)
+	}
+
+	secret, err := parseCachedSecret(index)
+	if err != nil {
+		return false, err
+	}
+
+	var parentCtx context.Context
+	if secret.Auth != nil && !secret.Auth.Orphan {
+		parent, err := c.db.Get(cachememdb.IndexNameToken, index.RequestToken)
+		if err != nil {
+			return false, err
+		}
+		if parent == nil {
+			for _, p := range pending {
+				if p.Token == index.RequestToken && p != index {
+					return false, nil
+				}
+			}
+			c.logger.Debug("discarding persisted token; parent token not restored", "id", index.ID)
+			c.evictPersistedIndex(index.ID)
+			return true, nil
+		}
+		parentCtx = parent.RenewCtxInfo.Ctx
+	}
+
+	return true, c.restoreIndex(index, parentCtx)
+}
+
+// restoreIndex sets the index in the cache with a renewal context derived
+// from parentCtx, or the base context if nil, and resumes the renewal of its
+// secret. Expired indexes are discarded.
+func (c *LeaseCache) restoreIndex(index *cachememdb.Index, parentCtx context.Context) error {
+	secret, err := parseCachedSecret(index)
+	if err != nil {
+		return err
+	}
+
+	if expired(index, secret) {
+		c.logger.Debug("discarding expired persisted index", "id", index.ID, "path", index.RequestPath)
+		c.evictPersistedIndex(index.ID)
+		return nil
+	}
+
+	renewCtxInfo := c.createCtxInfo(parentCtx)
+	renewCtx := context.WithValue(renewCtxInfo.Ctx, contextIndexID, index.ID)
+	index.RenewCtxInfo = &cachememdb.ContextInfo{
+		Ctx:        renewCtx,
+		CancelFunc: renewCtxInfo.CancelFunc,
+		DoneCh:     renewCtxInfo.DoneCh,
+	}
+
+	if err := c.db.Set(index); err != nil {
+		return err
+	}
+
+	req := &SendRequest{
+		Token: index.RequestToken,
+		Request: &http.Request{
+			Method: index.RequestMethod,
+			URL:    &url.URL{Path: index.RequestPath},
+			Header: index.RequestHeader,
+		},
+	}
+	if req.Request.Header == nil {
+		req.Request.Header = make(http.Header)
+	}
+
+	c.logger.Debug("restored persisted index", "method", index.RequestMethod, "path", index.RequestPath)
+	go c.startRenewing(renewCtx, index, req, secret)
+
+	return nil
+}
+
+// tokenIsValid looks up the given token to check it can still be used
+func (c *LeaseCache) tokenIsValid(token string) bool {
+	client, err := c.client.Clone()
+	if err != nil {
+		return false
+	}
+	client.SetToken(token)
+
+	secret, err := client.Auth().Token().LookupSelf()
+	return err == nil && secret != nil
+}
+
+// parseCachedSecret parses the secret in the cached response of the index
+func parseCachedSecret(index *cachememdb.Index) (*api.Secret, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(index.Response)), nil)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to deserialize cached response: {{err}}", err)
+	}
+	defer resp.Body.Close()
+
+	secret, err := api.ParseSecret(resp.Body)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to parse cached response as secret: {{err}}", err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("no secret in cached response for index %q", index.ID)
+	}
+	return secret, nil
+}
+
+// expired returns whether the secret's TTL has elapsed since it was last
+// renewed, or issued if it never was
+func expired(index *cachememdb.Index, secret *api.Secret) bool {
+	ttl := time.Duration(secret.LeaseDuration) * time.Second
+	if secret.Auth != nil {
+		ttl = time.Duration(secret.Auth.LeaseDuration) * time.Second
+	}
+
+	issued := index.LastRenewed
+	if issued.IsZero() {
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(index.Response)), nil)
+		if err != nil {
+			return true
+		}
+		resp.Body.Close()
+		if issued, err = http.ParseTime(resp.Header.Get("Date")); err != nil {
+			return true
+		}
+	}
+
+	return time.Now().After(issued.Add(ttl))
+}
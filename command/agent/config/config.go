@@ -6,9 +6,11 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"syscall"
 	"time"
 
 	ctconfig "github.com/hashicorp/consul-template/config"
+	"github.com/hashicorp/consul-template/signals"
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/hcl"
@@ -27,8 +29,54 @@ type Config struct {
 	Cache         *Cache                     `hcl:"cache"`
 	Vault         *Vault                     `hcl:"vault"`
 	Templates     []*ctconfig.TemplateConfig `hcl:"templates"`
+	EnvTemplates  []*EnvTemplate             `hcl:"-"`
+	Exec          *Exec                      `hcl:"-"`
 }
 
+// EnvTemplate is a template rendered into an environment variable of the
+// child process run by the agent
+type EnvTemplate struct {
+	// Name is the name of the environment variable
+	Name     string
+	Template *ctconfig.TemplateConfig
+}
+
+// Exec contains the configuration of the child process run by the agent with
+// the rendered env templates in its environment
+type Exec struct {
+	Command []string `hcl:"command"`
+
+	// OnSecretChange is what happens to the child process when the rendered
+	// env templates change: "restart", "signal" or "none"
+	OnSecretChange string `hcl:"on_secret_change"`
+
+	// ReloadSignal is sent to the child process when the rendered env
+	// templates change and OnSecretChange is "signal"
+	ReloadSignalRaw string    `hcl:"reload_signal"`
+	ReloadSignal    os.Signal `hcl:"-"`
+
+	// StopSignal is sent to the child process to stop it gracefully before
+	// KillTimeout elapses
+	StopSignalRaw  string        `hcl:"stop_signal"`
+	StopSignal     os.Signal     `hcl:"-"`
+	KillTimeoutRaw interface{}   `hcl:"kill_timeout"`
+	KillTimeout    time.Duration `hcl:"-"`
+}
+
+const (
+	// ExecOnSecretChangeRestart restarts the child process with the new
+	// environment
+	ExecOnSecretChangeRestart = "restart"
+
+	// ExecOnSecretChangeSignal sends the reload signal to the child process
+	ExecOnSecretChangeSignal = "signal"
+
+	// ExecOnSecretChangeNone leaves the child process running as is
+	ExecOnSecretChangeNone = "none"
+
+	defaultExecKillTimeout = 30 * time.Second
+)
+
 // Vault contains configuration for connnecting to Vault servers
 type Vault struct {
 	Address          string      `hcl:"address"`
@@ -43,7 +91,15 @@ type Vault struct {
 
 // Cache contains any configuration needed for Cache mode
 type Cache struct {
-	UseAutoAuthToken bool `hcl:"use_auto_auth_token"`
+	UseAutoAuthToken bool     `hcl:"use_auto_auth_token"`
+	Persist          *Persist `hcl:"-"`
+}
+
+// Persist contains the configuration of the persistent cache
+type Persist struct {
+	Path          string        `hcl:"path"`
+	KeyWrapTTLRaw interface{}   `hcl:"key_wrap_ttl"`
+	KeyWrapTTL    time.Duration `hcl:"-"`
 }
 
 // Listener contains configuration for any Vault Agent listeners
@@ -138,6 +194,14 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, errwrap.Wrapf("error parsing 'template': {{err}}", err)
 	}
 
+	if err := parseEnvTemplates(&result, list); err != nil {
+		return nil, errwrap.Wrapf("error parsing 'env_template': {{err}}", err)
+	}
+
+	if err := parseExec(&result, list); err != nil {
+		return nil, errwrap.Wrapf("error parsing 'exec': {{err}}", err)
+	}
+
 	if result.Cache != nil {
 		if len(result.Listeners) < 1 {
 			return nil, fmt.Errorf("at least one listener required when cache enabled")
@@ -151,11 +215,31 @@ func LoadConfig(path string) (*Config, error) {
 				return nil, fmt.Errorf("cache.use_auto_auth_token is true and auto_auth uses wrapping")
 			}
 		}
+
+		if result.Cache.Persist != nil && !result.Cache.UseAutoAuthToken {
+			return nil, fmt.Errorf("cache.persist requires cache.use_auto_auth_token to be true")
+		}
+	}
+
+	if len(result.EnvTemplates) > 0 && result.Exec == nil {
+		return nil, fmt.Errorf("env_template requires an exec block")
+	}
+
+	if result.Exec != nil {
+		if result.AutoAuth == nil {
+			return nil, fmt.Errorf("exec requires auto_auth to be configured")
+		}
+		if result.AutoAuth.Method.WrapTTL > 0 {
+			return nil, fmt.Errorf("exec is configured and auto_auth uses wrapping")
+		}
+		if result.ExitAfterAuth {
+			return nil, fmt.Errorf("exec cannot be used with exit_after_auth")
+		}
 	}
 
 	if result.AutoAuth != nil {
-		if len(result.AutoAuth.Sinks) == 0 && (result.Cache == nil || !result.Cache.UseAutoAuthToken) {
-			return nil, fmt.Errorf("auto_auth requires at least one sink or cache.use_auto_auth_token=true ")
+		if len(result.AutoAuth.Sinks) == 0 && (result.Cache == nil || !result.Cache.UseAutoAuthToken) && result.Exec == nil {
+			return nil, fmt.Errorf("auto_auth requires at least one sink, cache.use_auto_auth_token=true or exec")
 		}
 	}
 
@@ -220,6 +304,51 @@ func parseCache(result *Config, list *ast.ObjectList) error {
 	}
 
 	result.Cache = &c
+
+	subs, ok := item.Val.(*ast.ObjectType)
+	if !ok {
+		return fmt.Errorf("could not parse %q as an object", name)
+	}
+
+	if err := parsePersist(result, subs.List); err != nil {
+		return errwrap.Wrapf("error parsing 'persist': {{err}}", err)
+	}
+
+	return nil
+}
+
+func parsePersist(result *Config, list *ast.ObjectList) error {
+	name := "persist"
+
+	persistList := list.Filter(name)
+	if len(persistList.Items) == 0 {
+		return nil
+	}
+
+	if len(persistList.Items) > 1 {
+		return fmt.Errorf("at most one %q block is allowed", name)
+	}
+
+	item := persistList.Items[0]
+
+	var p Persist
+	if err := hcl.DecodeObject(&p, item.Val); err != nil {
+		return err
+	}
+
+	if p.Path == "" {
+		return errors.New("persist path must be specified")
+	}
+
+	if p.KeyWrapTTLRaw != nil {
+		var err error
+		if p.KeyWrapTTL, err = parseutil.ParseDurationSecond(p.KeyWrapTTLRaw); err != nil {
+			return err
+		}
+		p.KeyWrapTTLRaw = nil
+	}
+
+	result.Cache.Persist = &p
 	return nil
 }
 
@@ -435,53 +564,174 @@ func parseTemplates(result *Config, list *ast.ObjectList) error {
 	var tcs []*ctconfig.TemplateConfig
 
 	for _, item := range templateList.Items {
-		var shadow interface{}
-		if err := hcl.DecodeObject(&shadow, item.Val); err != nil {
-			return fmt.Errorf("error decoding config: %s", err)
-		}
-
-		// Convert to a map and flatten the keys we want to flatten
-		parsed, ok := shadow.(map[string]interface{})
-		if !ok {
-			return errors.New("error converting config")
-		}
-
-		// flatten the wait field. The initial "wait" value, if given, is a
-		// []map[string]interface{}, but we need it to be map[string]interface{}.
-		// Consul Template has a method flattenKeys that walks all of parsed and
-		// flattens every key. For Vault Agent, we only care about the wait input.
-		// Only one wait stanza is supported, however Consul Template does not error
-		// with multiple instead it flattens them down, with last value winning.
-		// Here we take the last element of the parsed["wait"] slice to keep
-		// consistency with Consul Template behavior.
-		wait, ok := parsed["wait"].([]map[string]interface{})
-		if ok {
-			parsed["wait"] = wait[len(wait)-1]
-		}
-
-		var tc ctconfig.TemplateConfig
-
-		// Use mapstructure to populate the basic config fields
-		var md mapstructure.Metadata
-		decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
-			DecodeHook: mapstructure.ComposeDecodeHookFunc(
-				ctconfig.StringToFileModeFunc(),
-				ctconfig.StringToWaitDurationHookFunc(),
-				mapstructure.StringToSliceHookFunc(","),
-				mapstructure.StringToTimeDurationHookFunc(),
-			),
-			ErrorUnused: true,
-			Metadata:    &md,
-			Result:      &tc,
+		tc, err := parseTemplateConfig(item)
+		if err != nil {
+			return err
+		}
+		tcs = append(tcs, tc)
+	}
+	result.Templates = tcs
+	return nil
+}
+
+func parseEnvTemplates(result *Config, list *ast.ObjectList) error {
+	name := "env_template"
+
+	templateList := list.Filter(name)
+	if len(templateList.Items) < 1 {
+		return nil
+	}
+
+	var ets []*EnvTemplate
+	seen := make(map[string]bool)
+
+	for _, item := range templateList.Items {
+		if len(item.Keys) != 1 {
+			return errors.New("env_template must be given the name of the environment variable")
+		}
+		envName := item.Keys[0].Token.Value().(string)
+		if envName == "" {
+			return errors.New("env_template must be given the name of the environment variable")
+		}
+		if seen[envName] {
+			return fmt.Errorf("duplicate env_template %q", envName)
+		}
+		seen[envName] = true
+
+		tc, err := parseTemplateConfig(item)
+		if err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("env_template.%s", envName))
+		}
+
+		switch {
+		case tc.Destination != nil:
+			return multierror.Prefix(errors.New("'destination' is not supported"), fmt.Sprintf("env_template.%s", envName))
+		case tc.Command != nil || tc.Exec != nil:
+			return multierror.Prefix(errors.New("'command' is not supported"), fmt.Sprintf("env_template.%s", envName))
+		case tc.Contents == nil && tc.Source == nil:
+			return multierror.Prefix(errors.New("one of 'contents' or 'source' must be specified"), fmt.Sprintf("env_template.%s", envName))
+		}
+
+		ets = append(ets, &EnvTemplate{
+			Name:     envName,
+			Template: tc,
 		})
+	}
+	result.EnvTemplates = ets
+	return nil
+}
+
+// parseTemplateConfig decodes a template block into a Consul Template
+// template configuration
+func parseTemplateConfig(item *ast.ObjectItem) (*ctconfig.TemplateConfig, error) {
+	var shadow interface{}
+	if err := hcl.DecodeObject(&shadow, item.Val); err != nil {
+		return nil, fmt.Errorf("error decoding config: %s", err)
+	}
+
+	// Convert to a map and flatten the keys we want to flatten
+	parsed, ok := shadow.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("error converting config")
+	}
+
+	// flatten the wait field. The initial "wait" value, if given, is a
+	// []map[string]interface{}, but we need it to be map[string]interface{}.
+	// Consul Template has a method flattenKeys that walks all of parsed and
+	// flattens every key. For Vault Agent, we only care about the wait input.
+	// Only one wait stanza is supported, however Consul Template does not error
+	// with multiple instead it flattens them down, with last value winning.
+	// Here we take the last element of the parsed["wait"] slice to keep
+	// consistency with Consul Template behavior.
+	wait, ok := parsed["wait"].([]map[string]interface{})
+	if ok {
+		parsed["wait"] = wait[len(wait)-1]
+	}
+
+	var tc ctconfig.TemplateConfig
+
+	// Use mapstructure to populate the basic config fields
+	var md mapstructure.Metadata
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			ctconfig.StringToFileModeFunc(),
+			ctconfig.StringToWaitDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+			mapstructure.StringToTimeDurationHookFunc(),
+		),
+		ErrorUnused: true,
+		Metadata:    &md,
+		Result:      &tc,
+	})
+	if err != nil {
+		return nil, errors.New("mapstructure decoder creation failed")
+	}
+	if err := decoder.Decode(parsed); err != nil {
+		return nil, err
+	}
+	return &tc, nil
+}
+
+func parseExec(result *Config, list *ast.ObjectList) error {
+	name := "exec"
+
+	execList := list.Filter(name)
+	if len(execList.Items) == 0 {
+		return nil
+	}
+
+	if len(execList.Items) > 1 {
+		return fmt.Errorf("at most one %q block is allowed", name)
+	}
+
+	item := execList.Items[0]
+
+	var e Exec
+	if err := hcl.DecodeObject(&e, item.Val); err != nil {
+		return err
+	}
+
+	if len(e.Command) == 0 || e.Command[0] == "" {
+		return errors.New("exec command must be specified")
+	}
+
+	switch e.OnSecretChange {
+	case "":
+		e.OnSecretChange = ExecOnSecretChangeRestart
+	case ExecOnSecretChangeRestart, ExecOnSecretChangeSignal, ExecOnSecretChangeNone:
+	default:
+		return fmt.Errorf("invalid value for 'on_secret_change': %q", e.OnSecretChange)
+	}
+
+	e.ReloadSignal = syscall.SIGHUP
+	if e.ReloadSignalRaw != "" {
+		sig, err := signals.Parse(e.ReloadSignalRaw)
+		if err != nil {
+			return errwrap.Wrapf("invalid value for 'reload_signal': {{err}}", err)
+		}
+		e.ReloadSignal = sig
+		e.ReloadSignalRaw = ""
+	}
+
+	e.StopSignal = syscall.SIGTERM
+	if e.StopSignalRaw != "" {
+		sig, err := signals.Parse(e.StopSignalRaw)
 		if err != nil {
-			return errors.New("mapstructure decoder creation failed")
+			return errwrap.Wrapf("invalid value for 'stop_signal': {{err}}", err)
 		}
-		if err := decoder.Decode(parsed); err != nil {
+		e.StopSignal = sig
+		e.StopSignalRaw = ""
+	}
+
+	e.KillTimeout = defaultExecKillTimeout
+	if e.KillTimeoutRaw != nil {
+		var err error
+		if e.KillTimeout, err = parseutil.ParseDurationSecond(e.KillTimeoutRaw); err != nil {
 			return err
 		}
-		tcs = append(tcs, &tc)
+		e.KillTimeoutRaw = nil
 	}
-	result.Templates = tcs
+
+	result.Exec = &e
 	return nil
 }
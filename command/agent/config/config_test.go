@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"syscall"
 	"testing"
 	"time"
 
@@ -287,6 +288,53 @@ func TestLoadConfigFile_AgentCache_AutoAuth_NoSink(t *testing.T) {
 	}
 }
 
+func TestLoadConfigFile_AgentCache_Persist(t *testing.T) {
+	config, err := LoadConfig("./test-fixtures/config-cache-persist.hcl")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &Config{
+		AutoAuth: &AutoAuth{
+			Method: &Method{
+				Type:      "aws",
+				MountPath: "auth/aws",
+				Config: map[string]interface{}{
+					"role": "foobar",
+				},
+			},
+		},
+		Cache: &Cache{
+			UseAutoAuthToken: true,
+			Persist: &Persist{
+				Path:       "/vault/agent-cache",
+				KeyWrapTTL: time.Hour,
+			},
+		},
+		Listeners: []*Listener{
+			&Listener{
+				Type: "tcp",
+				Config: map[string]interface{}{
+					"address":     "127.0.0.1:8300",
+					"tls_disable": true,
+				},
+			},
+		},
+		PidFile: "./pidfile",
+	}
+
+	if diff := deep.Equal(config, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func TestLoadConfigFile_Bad_AgentCache_Persist_NoAutoAuthToken(t *testing.T) {
+	_, err := LoadConfig("./test-fixtures/bad-config-cache-persist-no-auto_auth_token.hcl")
+	if err == nil {
+		t.Fatal("LoadConfig should return an error when cache.persist is set and cache.use_auto_auth_token is not true")
+	}
+}
+
 // TestLoadConfigFile_Template tests template definitions in Vault Agent
 func TestLoadConfigFile_Template(t *testing.T) {
 	testCases := map[string]struct {
@@ -389,3 +437,60 @@ func TestLoadConfigFile_Template(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadConfigFile_Exec(t *testing.T) {
+	config, err := LoadConfig("./test-fixtures/config-exec.hcl")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &Config{
+		AutoAuth: &AutoAuth{
+			Method: &Method{
+				Type:      "aws",
+				MountPath: "auth/aws",
+				Config: map[string]interface{}{
+					"role": "foobar",
+				},
+			},
+		},
+		EnvTemplates: []*EnvTemplate{
+			&EnvTemplate{
+				Name: "DB_USERNAME",
+				Template: &ctconfig.TemplateConfig{
+					Contents:      pointerutil.StringPtr(`{{ with secret "database/creds/app" }}{{ .Data.username }}{{ end }}`),
+					ErrMissingKey: pointerutil.BoolPtr(true),
+				},
+			},
+			&EnvTemplate{
+				Name: "DB_PASSWORD",
+				Template: &ctconfig.TemplateConfig{
+					Source: pointerutil.StringPtr("/path/to/password.ctmpl"),
+				},
+			},
+		},
+		Exec: &Exec{
+			Command:        []string{"/path/to/app", "-config", "/path/to/app.conf"},
+			OnSecretChange: ExecOnSecretChangeSignal,
+			ReloadSignal:   syscall.SIGHUP,
+			StopSignal:     syscall.SIGINT,
+			KillTimeout:    10 * time.Second,
+		},
+		PidFile: "./pidfile",
+	}
+
+	if diff := deep.Equal(config, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func TestLoadConfigFile_Bad_EnvTemplate(t *testing.T) {
+	for _, fixture := range []string{
+		"./test-fixtures/bad-config-env_template-no-exec.hcl",
+		"./test-fixtures/bad-config-env_template-destination.hcl",
+	} {
+		if _, err := LoadConfig(fixture); err == nil {
+			t.Fatalf("LoadConfig should return an error loading %s", fixture)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+pid_file = "./pidfile"
+
+auto_auth {
+	method {
+		type = "aws"
+		config = {
+			role = "foobar"
+		}
+	}
+}
+
+env_template "DB_PASSWORD" {
+	contents = "{{ with secret \"database/creds/app\" }}{{ .Data.password }}{{ end }}"
+	destination = "/path/to/password"
+}
+
+exec {
+	command = ["/path/to/app"]
+}
@@ -0,0 +1,24 @@
+pid_file = "./pidfile"
+
+auto_auth {
+	method {
+		type = "aws"
+		config = {
+			role = "foobar"
+		}
+	}
+}
+
+cache {
+	use_auto_auth_token = true
+
+	persist {
+		path = "/vault/agent-cache"
+		key_wrap_ttl = "1h"
+	}
+}
+
+listener "tcp" {
+    address = "127.0.0.1:8300"
+    tls_disable = true
+}
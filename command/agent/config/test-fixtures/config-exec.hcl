@@ -0,0 +1,27 @@
+pid_file = "./pidfile"
+
+auto_auth {
+	method {
+		type = "aws"
+		config = {
+			role = "foobar"
+		}
+	}
+}
+
+env_template "DB_USERNAME" {
+	contents = "{{ with secret \"database/creds/app\" }}{{ .Data.username }}{{ end }}"
+	error_on_missing_key = true
+}
+
+env_template "DB_PASSWORD" {
+	source = "/path/to/password.ctmpl"
+}
+
+exec {
+	command = ["/path/to/app", "-config", "/path/to/app.conf"]
+	on_secret_change = "signal"
+	reload_signal = "SIGHUP"
+	stop_signal = "SIGINT"
+	kill_timeout = "10s"
+}
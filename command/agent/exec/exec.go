@@ -0,0 +1,375 @@
+// Package exec is responsible for running a child process with user supplied
+// templates rendered into its environment variables. The Server type creates a
+// Consul Template Runner in dry mode, so that secrets are never written to
+// disk, starts the child process once every template has been rendered and
+// restarts or signals it when the rendered values change.
+package exec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/consul-template/child"
+	ctconfig "github.com/hashicorp/consul-template/config"
+	"github.com/hashicorp/consul-template/manager"
+	"github.com/hashicorp/go-hclog"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/command/agent/config"
+	"github.com/hashicorp/vault/command/agent/template"
+	"github.com/hashicorp/vault/sdk/helper/pointerutil"
+)
+
+// ServerConfig is a config struct for setting up the basic parts of the
+// Server
+type ServerConfig struct {
+	Logger    hclog.Logger
+	VaultConf *config.Vault
+	Namespace string
+
+	// LogLevel and LogWriter are passed along to the internal Consul Template
+	// Runner, see template.ServerConfig
+	LogLevel  hclog.Level
+	LogWriter io.Writer
+
+	EnvTemplates []*config.EnvTemplate
+	Exec         *config.Exec
+
+	// Stdin, Stdout and Stderr are connected to the child process. They
+	// default to the agent's own.
+	Stdin          io.Reader
+	Stdout, Stderr io.Writer
+}
+
+// Server manages the Consul Template Runner rendering the env templates and
+// the child process they are passed to
+type Server struct {
+	// config holds the ServerConfig used to create it
+	config *ServerConfig
+
+	// runner is the consul-template runner
+	runner *manager.Runner
+
+	// child is the running child process, if started
+	child *child.Child
+
+	// envNames maps the placeholder destination of each template to the name
+	// of its environment variable
+	envNames map[string]string
+
+	// env holds the environment variables the child was last started with
+	env map[string]string
+
+	exitCode int
+
+	DoneCh chan struct{}
+	logger hclog.Logger
+}
+
+// NewServer returns a new configured server
+func NewServer(conf *ServerConfig) *Server {
+	s := Server{
+		DoneCh: make(chan struct{}),
+		logger: conf.Logger,
+		config: conf,
+	}
+	if s.config.Stdin == nil {
+		s.config.Stdin = os.Stdin
+	}
+	if s.config.Stdout == nil {
+		s.config.Stdout = os.Stdout
+	}
+	if s.config.Stderr == nil {
+		s.config.Stderr = os.Stderr
+	}
+	return &s
+}
+
+// ExitCode returns the exit code the agent should exit with once the server
+// is done. It is the exit code of the child process if it exited on its own.
+func (s *Server) ExitCode() int {
+	<-s.DoneCh
+	return s.exitCode
+}
+
+// Run kicks off the internal Consul Template runner, listens for changes to
+// the token from the AuthHandler and supervises the child process. Signals
+// received by the agent that do not shut it down are forwarded to the child.
+// If Done() is called on the context, the child process is stopped and Run
+// returns. Run also returns when the child process exits on its own.
+func (s *Server) Run(ctx context.Context, incoming chan string) {
+	latestToken := new(string)
+	s.logger.Info("starting exec server")
+	defer func() {
+		s.stopChild()
+		s.logger.Info("exec server stopped")
+		close(s.DoneCh)
+	}()
+
+	if incoming == nil {
+		panic("incoming channel is nil")
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, forwardSignals...)
+	defer signal.Stop(sigCh)
+
+	var runnerConfig *ctconfig.Config
+	var renderedCh <-chan struct{}
+	var errCh <-chan error
+	var exitCh <-chan int
+
+	if len(s.config.EnvTemplates) == 0 {
+		s.logger.Info("no env templates found")
+		if err := s.startChild(map[string]string{}); err != nil {
+			s.logger.Error("failed to start child process", "error", err)
+			s.exitCode = 1
+			return
+		}
+		exitCh = s.child.ExitCh()
+	} else {
+		var err error
+		if runnerConfig, err = s.newRunnerConfig(); err != nil {
+			s.logger.Error("exec server failed to generate runner config", "error", err)
+			s.exitCode = 1
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if s.runner != nil {
+				s.runner.Stop()
+			}
+			return
+
+		case token, ok := <-incoming:
+			if !ok {
+				incoming = nil
+				continue
+			}
+			if runnerConfig == nil || token == *latestToken {
+				continue
+			}
+			s.logger.Info("exec server received new token")
+			if s.runner != nil {
+				s.runner.Stop()
+			}
+			*latestToken = token
+			runnerConfig = runnerConfig.Merge(&ctconfig.Config{
+				Vault: &ctconfig.VaultConfig{
+					Token: latestToken,
+				},
+			})
+			var err error
+			if s.runner, err = manager.NewRunner(runnerConfig, true); err != nil {
+				s.logger.Error("exec server failed with new Vault token", "error", err)
+				s.exitCode = 1
+				return
+			}
+			s.runner.SetOutStream(ioutil.Discard)
+			renderedCh = s.runner.TemplateRenderedCh()
+			errCh = s.runner.ErrCh
+			go s.runner.Start()
+
+		case err := <-errCh:
+			s.logger.Error("exec server error", "error", err.Error())
+			s.runner.Stop()
+			s.exitCode = 1
+			return
+
+		case <-renderedCh:
+			env, ok := s.renderedEnv(s.runner.RenderEvents())
+			if !ok {
+				// Not all templates have been rendered yet
+				continue
+			}
+			if err := s.handleRenderedEnv(env); err != nil {
+				s.logger.Error("failed to update child process", "error", err)
+				s.runner.Stop()
+				s.exitCode = 1
+				return
+			}
+			exitCh = s.child.ExitCh()
+
+		case sig := <-sigCh:
+			s.forwardSignal(sig)
+
+		case code := <-exitCh:
+			s.logger.Info("child process exited", "exit_code", code)
+			s.child = nil
+			s.exitCode = code
+			if s.runner != nil {
+				s.runner.Stop()
+			}
+			return
+		}
+	}
+}
+
+// newRunnerConfig returns the runner configuration for the env templates.
+// Each template is given a placeholder destination which is only used to tell
+// the rendered templates apart, since the runner is in dry mode.
+func (s *Server) newRunnerConfig() (*ctconfig.Config, error) {
+	placeholderID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	placeholderDir := filepath.Join(os.TempDir(), "vault-agent-env-"+placeholderID)
+
+	s.envNames = make(map[string]string, len(s.config.EnvTemplates))
+	templates := make(ctconfig.TemplateConfigs, 0, len(s.config.EnvTemplates))
+	for _, et := range s.config.EnvTemplates {
+		tc := et.Template.Copy()
+		destination := filepath.Join(placeholderDir, et.Name)
+		tc.Destination = pointerutil.StringPtr(destination)
+		s.envNames[destination] = et.Name
+		templates = append(templates, tc)
+	}
+
+	return template.NewRunnerConfig(&template.ServerConfig{
+		Logger:    s.logger,
+		VaultConf: s.config.VaultConf,
+		Namespace: s.config.Namespace,
+		LogLevel:  s.config.LogLevel,
+		LogWriter: s.config.LogWriter,
+	}, templates)
+}
+
+// renderedEnv returns the environment variables rendered from the events, and
+// whether every template has been rendered
+func (s *Server) renderedEnv(events map[string]*manager.RenderEvent) (map[string]string, bool) {
+	env := make(map[string]string, len(s.envNames))
+	for _, event := range events {
+		if event.LastWouldRender.IsZero() {
+			continue
+		}
+		for _, tc := range event.TemplateConfigs {
+			if name, ok := s.envNames[ctconfig.StringVal(tc.Destination)]; ok {
+				env[name] = string(event.Contents)
+			}
+		}
+	}
+	return env, len(env) == len(s.envNames)
+}
+
+// handleRenderedEnv starts the child process with the rendered environment
+// variables the first time they are all rendered, and applies the configured
+// change behavior when they change afterwards
+func (s *Server) handleRenderedEnv(env map[string]string) error {
+	if s.child == nil {
+		return s.startChild(env)
+	}
+
+	if envEqual(s.env, env) {
+		return nil
+	}
+
+	switch s.config.Exec.OnSecretChange {
+	case config.ExecOnSecretChangeSignal:
+		s.logger.Info("rendered env templates changed; signaling child process", "signal", s.config.Exec.ReloadSignal)
+		s.env = env
+		return s.child.Signal(s.config.Exec.ReloadSignal)
+	case config.ExecOnSecretChangeNone:
+		s.logger.Info("rendered env templates changed; leaving child process running")
+		return nil
+	default:
+		s.logger.Info("rendered env templates changed; restarting child process")
+		s.stopChild()
+		return s.startChild(env)
+	}
+}
+
+// startChild starts the child process with the given variables added to the
+// agent's environment
+func (s *Server) startChild(env map[string]string) error {
+	c, err := child.New(&child.NewInput{
+		Stdin:        s.config.Stdin,
+		Stdout:       s.config.Stdout,
+		Stderr:       s.config.Stderr,
+		Command:      s.config.Exec.Command[0],
+		Args:         s.config.Exec.Command[1:],
+		Env:          childEnv(os.Environ(), env),
+		ReloadSignal: s.config.Exec.ReloadSignal,
+		KillSignal:   s.config.Exec.StopSignal,
+		KillTimeout:  s.config.Exec.KillTimeout,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("starting child process", "command", s.config.Exec.Command[0])
+	if err := c.Start(); err != nil {
+		return fmt.Errorf("failed to start %q: %v", s.config.Exec.Command[0], err)
+	}
+
+	s.child = c
+	s.env = env
+	return nil
+}
+
+// stopChild gracefully stops the child process, if running, and waits for it
+// to exit
+func (s *Server) stopChild() {
+	if s.child == nil {
+		return
+	}
+	s.logger.Info("stopping child process", "signal", s.config.Exec.StopSignal)
+	s.child.Stop()
+	s.child = nil
+}
+
+func (s *Server) forwardSignal(sig os.Signal) {
+	if s.child == nil {
+		return
+	}
+	s.logger.Debug("forwarding signal to child process", "signal", sig)
+	if err := s.child.Signal(sig); err != nil {
+		s.logger.Error("failed to forward signal to child process", "signal", sig, "error", err)
+	}
+}
+
+// childEnv returns the environment of the child process, where the rendered
+// variables take precedence over the inherited ones
+func childEnv(environ []string, env map[string]string) []string {
+	result := make([]string, 0, len(environ)+len(env))
+	for _, kv := range environ {
+		name := kv
+		if i := strings.Index(kv, "="); i >= 0 {
+			name = kv[:i]
+		}
+		if _, ok := env[name]; ok {
+			continue
+		}
+		result = append(result, kv)
+	}
+
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result = append(result, name+"="+env[name])
+	}
+	return result
+}
+
+func envEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
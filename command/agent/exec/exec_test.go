@@ -0,0 +1,176 @@
+// +build !windows
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	ctconfig "github.com/hashicorp/consul-template/config"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agent/config"
+	"github.com/hashicorp/vault/sdk/helper/logging"
+	"github.com/hashicorp/vault/sdk/helper/pointerutil"
+)
+
+func testServerConfig(t *testing.T, vaultAddr string, envTemplates []*config.EnvTemplate, command ...string) *ServerConfig {
+	t.Helper()
+
+	return &ServerConfig{
+		Logger: logging.NewVaultLogger(hclog.Trace),
+		VaultConf: &config.Vault{
+			Address: vaultAddr,
+		},
+		LogLevel:     hclog.Trace,
+		LogWriter:    hclog.DefaultOutput,
+		EnvTemplates: envTemplates,
+		Exec: &config.Exec{
+			Command:        command,
+			OnSecretChange: config.ExecOnSecretChangeRestart,
+			ReloadSignal:   syscall.SIGHUP,
+			StopSignal:     syscall.SIGTERM,
+			KillTimeout:    5 * time.Second,
+		},
+		Stdin:  os.Stdin,
+		Stdout: ioutil.Discard,
+		Stderr: ioutil.Discard,
+	}
+}
+
+func waitDone(t *testing.T, server *Server) {
+	t.Helper()
+
+	select {
+	case <-server.DoneCh:
+	case <-time.After(30 * time.Second):
+		t.Fatal("timed out waiting for the exec server to finish")
+	}
+}
+
+func TestServerRun_EnvTemplates(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(handleRequest))
+	defer ts.Close()
+	tmpDir, err := ioutil.TempDir("", "agent-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	envTemplates := []*config.EnvTemplate{
+		{
+			Name: "DB_USERNAME",
+			Template: &ctconfig.TemplateConfig{
+				Contents: pointerutil.StringPtr(`{{ with secret "kv/myapp/config" }}{{ .Data.data.username }}{{ end }}`),
+			},
+		},
+		{
+			Name: "DB_PASSWORD",
+			Template: &ctconfig.TemplateConfig{
+				Contents: pointerutil.StringPtr(`{{ with secret "kv/myapp/config" }}{{ .Data.data.password }}{{ end }}`),
+			},
+		},
+	}
+
+	outFile := filepath.Join(tmpDir, "env")
+	script := fmt.Sprintf(`printf "%%s:%%s" "$DB_USERNAME" "$DB_PASSWORD" > %q`, outFile)
+	server := NewServer(testServerConfig(t, ts.URL, envTemplates, "/bin/sh", "-c", script))
+
+	tokenCh := make(chan string, 1)
+	go server.Run(context.Background(), tokenCh)
+
+	// Send a dummy value to trigger the internal Runner to query for secret
+	// info
+	tokenCh <- "test"
+	waitDone(t, server)
+
+	if code := server.ExitCode(); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+
+	// The secrets are only ever rendered into the child's environment
+	content, err := ioutil.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "appuser:password" {
+		t.Fatalf("child process environment didn't match: %q", content)
+	}
+}
+
+func TestServerRun_ExitCode(t *testing.T) {
+	server := NewServer(testServerConfig(t, "http://127.0.0.1:0", nil, "/bin/sh", "-c", "exit 3"))
+
+	go server.Run(context.Background(), make(chan string))
+	waitDone(t, server)
+
+	if code := server.ExitCode(); code != 3 {
+		t.Fatalf("expected exit code 3, got %d", code)
+	}
+}
+
+func TestServerRun_Stop(t *testing.T) {
+	server := NewServer(testServerConfig(t, "http://127.0.0.1:0", nil, "/bin/sh", "-c", "sleep 30"))
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	go server.Run(ctx, make(chan string))
+
+	// Give the child process a moment to start before stopping it
+	time.Sleep(100 * time.Millisecond)
+	cancelFunc()
+	waitDone(t, server)
+}
+
+func TestChildEnv(t *testing.T) {
+	environ := []string{"HOME=/home/app", "DB_PASSWORD=stale", "EMPTY"}
+	env := map[string]string{
+		"DB_USERNAME": "appuser",
+		"DB_PASSWORD": "password",
+	}
+
+	expected := []string{"HOME=/home/app", "EMPTY", "DB_PASSWORD=password", "DB_USERNAME=appuser"}
+	got := childEnv(environ, env)
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+	}
+}
+
+func handleRequest(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, jsonResponse)
+}
+
+var jsonResponse = `
+{
+  "request_id": "8af096e9-518c-7351-eff5-5ba20554b21f",
+  "lease_id": "",
+  "renewable": false,
+  "lease_duration": 0,
+  "data": {
+    "data": {
+      "password": "password",
+      "username": "appuser"
+    },
+    "metadata": {
+      "created_time": "2019-10-07T22:18:44.233247Z",
+      "deletion_time": "",
+      "destroyed": false,
+      "version": 3
+    }
+  },
+  "wrap_info": null,
+  "warnings": null,
+  "auth": null
+}
+`
@@ -0,0 +1,17 @@
+// +build !windows
+
+package exec
+
+import (
+	"os"
+	"syscall"
+)
+
+// forwardSignals are the signals received by the agent that are forwarded to
+// the child process. The signals shutting down the agent stop the child
+// process instead.
+var forwardSignals = []os.Signal{
+	syscall.SIGHUP,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+}
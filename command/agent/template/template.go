@@ -97,7 +97,7 @@ func (ts *Server) Run(ctx context.Context, incoming chan string, templates []*ct
 	// configuration
 	var runnerConfig *ctconfig.Config
 	var runnerConfigErr error
-	if runnerConfig, runnerConfigErr = newRunnerConfig(ts.config, templates); runnerConfigErr != nil {
+	if runnerConfig, runnerConfigErr = NewRunnerConfig(ts.config, templates); runnerConfigErr != nil {
 		ts.logger.Error("template server failed to generate runner config", "error", runnerConfigErr)
 		return
 	}
@@ -185,9 +185,9 @@ func (ts *Server) Run(ctx context.Context, incoming chan string, templates []*ct
 	}
 }
 
-// newRunnerConfig returns a consul-template runner configuration, setting the
+// NewRunnerConfig returns a consul-template runner configuration, setting the
 // Vault and Consul configurations based on the clients configs.
-func newRunnerConfig(sc *ServerConfig, templates ctconfig.TemplateConfigs) (*ctconfig.Config, error) {
+func NewRunnerConfig(sc *ServerConfig, templates ctconfig.TemplateConfigs) (*ctconfig.Config, error) {
 	conf := ctconfig.DefaultConfig()
 	conf.Templates = templates.Copy()
 
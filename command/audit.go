@@ -21,7 +21,8 @@ func (c *AuditCommand) Help() string {
 Usage: vault audit <subcommand> [options] [args]
 
   This command groups subcommands for interacting with Vault's audit devices.
-  Users can list, enable, and disable audit devices.
+  Users can list, enable, and disable audit devices, and verify the hash chain
+  of their logs.
 
   List all enabled audit devices:
 
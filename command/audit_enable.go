@@ -91,6 +91,7 @@ func (c *AuditEnableCommand) AutocompleteArgs() complete.Predictor {
 		"file",
 		"syslog",
 		"socket",
+		"http",
 	)
 }
 
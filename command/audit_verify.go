@@ -0,0 +1,204 @@
+package command
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/audit"
+	"github.com/mitchellh/cli"
+	"github.com/posener/complete"
+)
+
+var _ cli.Command = (*AuditVerifyCommand)(nil)
+var _ cli.CommandAutocomplete = (*AuditVerifyCommand)(nil)
+
+type AuditVerifyCommand struct {
+	*BaseCommand
+}
+
+func (c *AuditVerifyCommand) Synopsis() string {
+	return "Verifies the hash chain of an audit log"
+}
+
+func (c *AuditVerifyCommand) Help() string {
+	helpText := `
+Usage: vault audit verify [options] PATH FILE
+
+  Verifies the hash chain of a log written by an audit device enabled with
+  hash_chain=true. Each entry of the log is checked against the HMAC computed
+  by the audit device at PATH, and against the previous entry. The first
+  edited, removed or reordered entry is reported as a broken link.
+
+  Entries at the beginning of the log written before hash chaining was enabled
+  are skipped. The first chained entry is trusted to follow the end of the
+  previous log if the log was rotated.
+
+  Every entry is hashed by Vault using the "sys/audit-hash" endpoint, so the
+  token must be allowed to use it for the audit device. Only the entries in the
+  log when the command starts are verified, not those written while it runs,
+  such as the entries of these requests.
+
+  Verify the log of the audit device enabled at "file/":
+
+      $ vault audit verify file/ /var/log/vault_audit.log
+
+` + c.Flags().Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *AuditVerifyCommand) Flags() *FlagSets {
+	return c.flagSet(FlagSetHTTP)
+}
+
+func (c *AuditVerifyCommand) AutocompleteArgs() complete.Predictor {
+	return c.PredictVaultAudits()
+}
+
+func (c *AuditVerifyCommand) AutocompleteFlags() complete.Flags {
+	return c.Flags().Completions()
+}
+
+func (c *AuditVerifyCommand) Run(args []string) int {
+	f := c.Flags()
+
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	args = f.Args()
+	switch {
+	case len(args) < 2:
+		c.UI.Error(fmt.Sprintf("Not enough arguments (expected 2, got %d)", len(args)))
+		return 1
+	case len(args) > 2:
+		c.UI.Error(fmt.Sprintf("Too many arguments (expected 2, got %d)", len(args)))
+		return 1
+	}
+
+	path := ensureTrailingSlash(sanitizePath(args[0]))
+
+	file, err := os.Open(args[1])
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error opening audit log: %s", err))
+		return 1
+	}
+	defer file.Close()
+
+	// The log may be written to while it is verified, including by the
+	// requests hashing its entries, so only the entries present now are read
+	info, err := file.Stat()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error opening audit log: %s", err))
+		return 1
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 2
+	}
+
+	result, err := verifyAuditLog(client, path, io.LimitReader(file, info.Size()))
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error verifying audit log: %s", err))
+		return 2
+	}
+
+	for _, line := range result.restarts {
+		c.UI.Warn(fmt.Sprintf("The hash chain restarted at line %d, entries preceding it may have been removed", line))
+	}
+
+	if result.brokenLine > 0 {
+		c.UI.Error(fmt.Sprintf("Hash chain broken at line %d: %s", result.brokenLine, result.brokenReason))
+		return 2
+	}
+
+	if result.verified == 0 {
+		c.UI.Error("No hash chained entries found in the audit log")
+		return 2
+	}
+
+	c.UI.Output(fmt.Sprintf("Success! Verified %d audit log entries", result.verified))
+	return 0
+}
+
+// auditVerifyResult is the outcome of verifying an audit log
+type auditVerifyResult struct {
+	// verified is the number of verified entries
+	verified int
+
+	// restarts holds the lines at which a new hash chain was started
+	restarts []int
+
+	// brokenLine is the line of the first broken link, and brokenReason why
+	// it is broken, or 0 if the chain is intact
+	brokenLine   int
+	brokenReason string
+}
+
+// verifyAuditLog walks the audit log and checks the hash chain, using the
+// audit device at path to compute the HMACs. It stops at the first broken
+// link.
+func verifyAuditLog(client *api.Client, path string, r io.Reader) (*auditVerifyResult, error) {
+	result := &auditVerifyResult{}
+	reader := bufio.NewReader(r)
+
+	var prevHMAC string
+	chained := false
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(strings.TrimSpace(string(line))) == 0 {
+			if err == io.EOF {
+				return result, nil
+			}
+			continue
+		}
+
+		signed, prev, hmac, parseErr := audit.ParseChainedEntry(line)
+		switch {
+		case parseErr == audit.ErrNotChained && !chained:
+			// Entries written before hash chaining was enabled
+		case parseErr != nil:
+			result.brokenLine = lineNum
+			result.brokenReason = parseErr.Error()
+			return result, nil
+		default:
+			switch {
+			case !chained, prev == prevHMAC:
+			case prev == "":
+				result.restarts = append(result.restarts, lineNum)
+			default:
+				result.brokenLine = lineNum
+				result.brokenReason = "the entry does not follow the previous entry"
+				return result, nil
+			}
+
+			expected, hashErr := client.Sys().AuditHash(path, string(signed))
+			if hashErr != nil {
+				return nil, hashErr
+			}
+			if expected != hmac {
+				result.brokenLine = lineNum
+				result.brokenReason = "the entry has been modified"
+				return result, nil
+			}
+
+			chained = true
+			prevHMAC = hmac
+			result.verified++
+		}
+
+		if err == io.EOF {
+			return result, nil
+		}
+	}
+}
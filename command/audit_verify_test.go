@@ -0,0 +1,146 @@
+package command
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/cli"
+)
+
+func testAuditVerifyCommand(tb testing.TB) (*cli.MockUi, *AuditVerifyCommand) {
+	tb.Helper()
+
+	ui := cli.NewMockUi()
+	return ui, &AuditVerifyCommand{
+		BaseCommand: &BaseCommand{
+			UI: ui,
+		},
+	}
+}
+
+func TestAuditVerifyCommand_Run(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		args []string
+		out  string
+		code int
+	}{
+		{
+			"not_enough_args",
+			[]string{"file/"},
+			"Not enough arguments",
+			1,
+		},
+		{
+			"too_many_args",
+			[]string{"foo", "bar", "baz"},
+			"Too many arguments",
+			1,
+		},
+		{
+			"missing_file",
+			[]string{"file/", "/nonexistent/vault_audit.log"},
+			"Error opening audit log",
+			1,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ui, cmd := testAuditVerifyCommand(t)
+
+			code := cmd.Run(tc.args)
+			if code != tc.code {
+				t.Errorf("expected %d to be %d", code, tc.code)
+			}
+
+			combined := ui.OutputWriter.String() + ui.ErrorWriter.String()
+			if !strings.Contains(combined, tc.out) {
+				t.Errorf("expected %q to contain %q", combined, tc.out)
+			}
+		})
+	}
+
+	t.Run("integration", func(t *testing.T) {
+		t.Parallel()
+
+		dir, err := ioutil.TempDir("", "vault-audit-verify")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		logPath := filepath.Join(dir, "audit.log")
+
+		client, closer := testVaultServer(t)
+		defer closer()
+
+		if err := client.Sys().EnableAuditWithOptions("integration_audit_verify", &api.EnableAuditOptions{
+			Type: "file",
+			Options: map[string]string{
+				"file_path":  logPath,
+				"hash_chain": "true",
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Sys().ListMounts(); err != nil {
+			t.Fatal(err)
+		}
+
+		ui, cmd := testAuditVerifyCommand(t)
+		cmd.client = client
+
+		code := cmd.Run([]string{"integration_audit_verify/", logPath})
+		if exp := 0; code != exp {
+			t.Errorf("expected %d to be %d: %s", code, exp, ui.ErrorWriter.String())
+		}
+		expected := "Success! Verified"
+		combined := ui.OutputWriter.String() + ui.ErrorWriter.String()
+		if !strings.Contains(combined, expected) {
+			t.Errorf("expected %q to contain %q", combined, expected)
+		}
+
+		// Removing an entry breaks the chain
+		contents, err := ioutil.ReadFile(logPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := bytes.SplitAfter(contents, []byte("\n"))
+		tampered := append(append([]byte{}, lines[0]...), bytes.Join(lines[2:], nil)...)
+		tamperedPath := filepath.Join(dir, "tampered.log")
+		if err := ioutil.WriteFile(tamperedPath, tampered, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		ui, cmd = testAuditVerifyCommand(t)
+		cmd.client = client
+
+		code = cmd.Run([]string{"integration_audit_verify/", tamperedPath})
+		if exp := 2; code != exp {
+			t.Errorf("expected %d to be %d", code, exp)
+		}
+		expected = "Hash chain broken at line 2"
+		combined = ui.OutputWriter.String() + ui.ErrorWriter.String()
+		if !strings.Contains(combined, expected) {
+			t.Errorf("expected %q to contain %q", combined, expected)
+		}
+	})
+
+	t.Run("no_tabs", func(t *testing.T) {
+		t.Parallel()
+
+		_, cmd := testAuditVerifyCommand(t)
+		assertNoTabs(t, cmd)
+	})
+}
@@ -333,6 +333,24 @@ func OutputSealStatus(ui cli.Ui, client *api.Client, status *api.SealStatusRespo
 	if status.Migration {
 		out = append(out, fmt.Sprintf("Seal Migration in Progress | %t", status.Migration))
 	}
+	if status.MigrationStatus != nil {
+		out = append(out, fmt.Sprintf("Seal Migration | %s -> %s", status.MigrationStatus.FromType, status.MigrationStatus.ToType))
+		out = append(out, fmt.Sprintf("Seal Migration State | %s", status.MigrationStatus.State))
+		if status.MigrationStatus.Error != "" {
+			out = append(out, fmt.Sprintf("Seal Migration Error | %s", status.MigrationStatus.Error))
+		}
+	}
+
+	for _, wrapper := range status.Wrappers {
+		health := "healthy"
+		if !wrapper.Healthy {
+			health = "unhealthy"
+		}
+		out = append(out, fmt.Sprintf("Seal Wrapper %s | %s, priority %d, %s", wrapper.Name, wrapper.Type, wrapper.Priority, health))
+	}
+	if len(status.Wrappers) > 0 {
+		out = append(out, fmt.Sprintf("Seal Keys Need Rewrap | %t", status.NeedsRewrap))
+	}
 
 	out = append(out, fmt.Sprintf("Version | %s", status.Version))
 
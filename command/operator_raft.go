@@ -32,6 +32,10 @@ Usage: vault operator raft <subcommand> [options] [args]
 
       $ vault operator raft configuration
 
+  Returns the health of the raft cluster as seen by autopilot:
+
+      $ vault operator raft autopilot state
+
   Removes a node from the raft cluster:
 
       $ vault operator raft remove-peer
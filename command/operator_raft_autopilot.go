@@ -0,0 +1,40 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+var _ cli.Command = (*OperatorRaftAutopilotCommand)(nil)
+
+type OperatorRaftAutopilotCommand struct {
+	*BaseCommand
+}
+
+func (c *OperatorRaftAutopilotCommand) Synopsis() string {
+	return "Interacts with the autopilot of the raft cluster"
+}
+
+func (c *OperatorRaftAutopilotCommand) Help() string {
+	helpText := `
+Usage: vault operator raft autopilot <subcommand> [options] [args]
+
+  This command groups subcommands for operators interacting with the autopilot of
+  the raft storage backend. Autopilot promotes new servers to voters once they are
+  stable and can remove dead servers from the cluster. Here are a few examples of
+  the raft autopilot operator commands:
+
+  Returns the health of the raft cluster as seen by autopilot:
+
+      $ vault operator raft autopilot state
+
+  Please see the individual subcommand help for detailed usage information.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *OperatorRaftAutopilotCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
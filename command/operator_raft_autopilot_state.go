@@ -0,0 +1,73 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	"github.com/posener/complete"
+)
+
+var _ cli.Command = (*OperatorRaftAutopilotStateCommand)(nil)
+var _ cli.CommandAutocomplete = (*OperatorRaftAutopilotStateCommand)(nil)
+
+type OperatorRaftAutopilotStateCommand struct {
+	*BaseCommand
+}
+
+func (c *OperatorRaftAutopilotStateCommand) Synopsis() string {
+	return "Returns the state of the raft cluster as seen by autopilot"
+}
+
+func (c *OperatorRaftAutopilotStateCommand) Help() string {
+	helpText := `
+Usage: vault operator raft autopilot state
+
+  Provides the health of all the peers in the raft cluster and the failure
+  tolerance of the cluster, as tracked by autopilot on the active node.
+
+	  $ vault operator raft autopilot state
+
+` + c.Flags().Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *OperatorRaftAutopilotStateCommand) Flags() *FlagSets {
+	set := c.flagSet(FlagSetHTTP | FlagSetOutputFormat)
+
+	return set
+}
+
+func (c *OperatorRaftAutopilotStateCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictAnything
+}
+
+func (c *OperatorRaftAutopilotStateCommand) AutocompleteFlags() complete.Flags {
+	return c.Flags().Completions()
+}
+
+func (c *OperatorRaftAutopilotStateCommand) Run(args []string) int {
+	f := c.Flags()
+
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 2
+	}
+
+	secret, err := client.Logical().Read("sys/storage/raft/autopilot/state")
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error reading the raft autopilot state: %s", err))
+		return 2
+	}
+
+	OutputSecret(c.UI, secret)
+
+	return 0
+}
@@ -6,11 +6,13 @@ import (
 	"context"
 	"encoding/base64"
 	"testing"
+	"time"
 
 	hclog "github.com/hashicorp/go-hclog"
 	wrapping "github.com/hashicorp/go-kms-wrapping"
 	aeadwrapper "github.com/hashicorp/go-kms-wrapping/wrappers/aead"
 	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/helper/testhelpers"
 	vaulthttp "github.com/hashicorp/vault/http"
 	"github.com/hashicorp/vault/sdk/helper/logging"
 	"github.com/hashicorp/vault/sdk/physical"
@@ -149,6 +151,9 @@ func TestSealMigration(t *testing.T) {
 			t.Fatalf("expected unsealed state; got %#v", *resp)
 		}
 
+		// The stored keys are migrated once the node becomes active
+		waitForSealMigration(t, client)
+
 		cluster.Cleanup()
 		cluster.Cores = nil
 	}
@@ -243,6 +248,9 @@ func TestSealMigration(t *testing.T) {
 			t.Fatalf("expected unsealed state; got %#v", *resp)
 		}
 
+		// The stored keys are migrated once the node becomes active
+		waitForSealMigration(t, client)
+
 		cluster.Cleanup()
 		cluster.Cores = nil
 	}
@@ -286,6 +294,9 @@ func TestSealMigration(t *testing.T) {
 			t.Fatalf("expected unsealed state; got %#v", *resp)
 		}
 
+		// The stored keys are migrated once the node becomes active
+		waitForSealMigration(t, client)
+
 		cluster.Cleanup()
 		cluster.Cores = nil
 	}
@@ -333,3 +344,120 @@ func TestSealMigration(t *testing.T) {
 		cluster.Cores = nil
 	}
 }
+
+func TestSealMigration_HA(t *testing.T) {
+	logger := logging.NewVaultLogger(hclog.Trace).Named(t.Name())
+	coreConfig := &vault.CoreConfig{
+		DisableSealWrap:     true,
+		OnlineSealMigration: true,
+	}
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		Logger:      logger,
+		HandlerFunc: vaulthttp.Handler,
+		NumCores:    3,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	ctx := context.Background()
+	active := testhelpers.WaitForActiveNode(t, cluster)
+	standbys := testhelpers.DeriveStandbyCores(t, cluster)
+
+	// Migrate the standbys one at a time while the active node keeps serving
+	// requests with the Shamir seal
+	for _, core := range standbys {
+		testhelpers.EnsureCoreSealed(t, core)
+
+		newSeal := vault.NewAutoSeal(seal.NewTestSeal(nil))
+		newSeal.SetCore(core.Core)
+		if err := adjustCoreForSealMigration(logger, core.Core, newSeal, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		var resp *api.SealStatusResponse
+		var err error
+		for _, key := range cluster.BarrierKeys {
+			resp, err = core.Client.Sys().UnsealWithOptions(&api.UnsealOpts{
+				Key:     base64.StdEncoding.EncodeToString(key),
+				Migrate: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if resp.Sealed {
+			t.Fatalf("expected unsealed state; got %#v", *resp)
+		}
+		if resp.MigrationStatus == nil || resp.MigrationStatus.State != vault.SealMigrationStateWaitingForActive {
+			t.Fatalf("expected migration waiting for active node; got %#v", resp.MigrationStatus)
+		}
+
+		if _, err := active.Client.Sys().Health(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	barrierConfig, _, err := active.Core.PhysicalSealConfigs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if barrierConfig.Type != wrapping.Shamir {
+		t.Fatalf("expected stored keys not to be migrated yet, got barrier type %q", barrierConfig.Type)
+	}
+
+	// Stepping down hands over to a migrated standby, which rewraps the
+	// stored keys under the new seal
+	if err := active.Client.Sys().StepDown(); err != nil {
+		t.Fatal(err)
+	}
+	for _, core := range standbys {
+		waitForSealMigration(t, core.Client)
+	}
+
+	barrierConfig, _, err = active.Core.PhysicalSealConfigs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if barrierConfig.Type != wrapping.Test {
+		t.Fatalf("expected stored keys to be migrated, got barrier type %q", barrierConfig.Type)
+	}
+
+	// The unseal keys became the recovery keys
+	newActive := testhelpers.DeriveActiveCore(t, cluster)
+	if newActive == active {
+		t.Fatal("expected a migrated standby to become active")
+	}
+	recoveryKey, err := shamir.Combine(cluster.BarrierKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := newActive.Core.SealAccess().VerifyRecoveryKey(ctx, recoveryKey); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForSealMigration waits for the node to report the seal migration
+// complete
+func waitForSealMigration(t *testing.T, client *api.Client) {
+	t.Helper()
+
+	timeout := time.Now().Add(60 * time.Second)
+	for {
+		if time.Now().After(timeout) {
+			t.Fatal("timeout waiting for seal migration")
+		}
+		resp, err := client.Sys().SealStatus()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.MigrationStatus != nil {
+			switch resp.MigrationStatus.State {
+			case vault.SealMigrationStateComplete:
+				return
+			case vault.SealMigrationStateFailed:
+				t.Fatalf("seal migration failed: %s", resp.MigrationStatus.Error)
+			}
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
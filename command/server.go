@@ -499,8 +499,8 @@ func (c *ServerCommand) runRecoveryMode() int {
 
 	configSeal := config.Seals[0]
 	sealType := wrapping.Shamir
-	if !configSeal.Disabled && os.Getenv("VAULT_SEAL_TYPE") != "" {
-		sealType = os.Getenv("VAULT_SEAL_TYPE")
+	if envSealType := sealTypeFromEnv(); !configSeal.Disabled && envSealType != "" {
+		sealType = envSealType
 		configSeal.Type = sealType
 	} else {
 		sealType = configSeal.Type
@@ -984,19 +984,28 @@ func (c *ServerCommand) Run(args []string) int {
 				config.Seals = append(config.Seals, &server.Seal{Type: wrapping.Shamir})
 			}
 		}
+		// Enabled seals with a priority are combined into a multiseal
+		var multiEntries []*vaultseal.MultiWrapperEntry
 		for _, configSeal := range config.Seals {
+			multi := !configSeal.Disabled && configSeal.Priority != 0
+
 			sealType := wrapping.Shamir
-			if !configSeal.Disabled && os.Getenv("VAULT_SEAL_TYPE") != "" {
-				sealType = os.Getenv("VAULT_SEAL_TYPE")
+			if envSealType := sealTypeFromEnv(); !configSeal.Disabled && !multi && envSealType != "" {
+				sealType = envSealType
 				configSeal.Type = sealType
 			} else {
 				sealType = configSeal.Type
 			}
 
+			sealInfoKeys, sealInfo := &infoKeys, &info
+			if multi {
+				sealInfoKeys, sealInfo = new([]string), &map[string]string{}
+			}
+
 			var seal vault.Seal
 			sealLogger := c.logger.Named(sealType)
 			allLoggers = append(allLoggers, sealLogger)
-			seal, sealConfigError = serverseal.ConfigureSeal(configSeal, &infoKeys, &info, sealLogger, vault.NewDefaultSeal(&vaultseal.Access{
+			seal, sealConfigError = serverseal.ConfigureSeal(configSeal, sealInfoKeys, sealInfo, sealLogger, vault.NewDefaultSeal(&vaultseal.Access{
 				Wrapper: aeadwrapper.NewWrapper(&wrapping.WrapperOptions{
 					Logger: c.logger.Named("shamir"),
 				}),
@@ -1014,9 +1023,28 @@ func (c *ServerCommand) Run(args []string) int {
 				return 1
 			}
 
-			if configSeal.Disabled {
+			switch {
+			case configSeal.Disabled:
 				unwrapSeal = seal
-			} else {
+			case multi:
+				if seal.BarrierType() == wrapping.Shamir {
+					c.UI.Error("Shamir seals cannot be part of a multiseal")
+					return 1
+				}
+				multiEntries = append(multiEntries, &vaultseal.MultiWrapperEntry{
+					Name:     configSeal.Name,
+					Priority: configSeal.Priority,
+					Wrapper:  seal.GetAccess().Wrapper,
+				})
+				for _, k := range *sealInfoKeys {
+					if k == "Seal Type" {
+						continue
+					}
+					key := fmt.Sprintf("%s (%s)", k, configSeal.Name)
+					infoKeys = append(infoKeys, key)
+					info[key] = (*sealInfo)[k]
+				}
+			default:
 				barrierSeal = seal
 			}
 
@@ -1029,6 +1057,29 @@ func (c *ServerCommand) Run(args []string) int {
 			}()
 
 		}
+
+		if len(multiEntries) > 0 {
+			multiLogger := c.logger.Named(vaultseal.MultiWrapperType)
+			allLoggers = append(allLoggers, multiLogger)
+			multiWrapper, err := vaultseal.NewMultiWrapper(multiLogger, multiEntries)
+			if err != nil {
+				c.UI.Error(fmt.Sprintf("Error configuring multiseal: %s", err))
+				return 1
+			}
+
+			// The wrappers are finalized by their own seals
+			barrierSeal = vault.NewAutoSeal(&vaultseal.Access{
+				Wrapper: multiWrapper,
+			})
+
+			wrapperNames := make([]string, 0, len(multiEntries))
+			for _, entry := range multiWrapper.Entries() {
+				wrapperNames = append(wrapperNames, fmt.Sprintf("%s (%s, priority %d)", entry.Name, entry.Wrapper.Type(), entry.Priority))
+			}
+			infoKeys = append(infoKeys, "Seal Type", "Seal Wrappers")
+			info["Seal Type"] = vaultseal.MultiWrapperType
+			info["Seal Wrappers"] = strings.Join(wrapperNames, ", ")
+		}
 	}
 
 	if barrierSeal == nil {
@@ -1065,6 +1116,7 @@ func (c *ServerCommand) Run(args []string) int {
 		EnableUI:                  config.EnableUI,
 		EnableRaw:                 config.EnableRawEndpoint,
 		DisableSealWrap:           config.DisableSealWrap,
+		OnlineSealMigration:       config.OnlineSealMigration,
 		DisablePerformanceStandby: config.DisablePerformanceStandby,
 		DisableIndexing:           config.DisableIndexing,
 		AllLoggers:                allLoggers,
@@ -2576,6 +2628,19 @@ func SetStorageMigration(b physical.Backend, active bool) error {
 	return b.Put(context.Background(), entry)
 }
 
+// sealTypeFromEnv returns the seal type set through the environment, either
+// with VAULT_SEAL_TYPE or, as existing PKCS#11 seal configurations do, with
+// VAULT_HSM_TYPE along with VAULT_HSM_LIB.
+func sealTypeFromEnv() string {
+	if sealType := os.Getenv("VAULT_SEAL_TYPE"); sealType != "" {
+		return sealType
+	}
+	if os.Getenv("VAULT_HSM_LIB") != "" && os.Getenv("VAULT_HSM_TYPE") == wrapping.PKCS11 {
+		return wrapping.PKCS11
+	}
+	return ""
+}
+
 type grpclogFaker struct {
 	logger log.Logger
 	log    bool
@@ -80,6 +80,9 @@ type Config struct {
 	DisableSealWrap    bool        `hcl:"-"`
 	DisableSealWrapRaw interface{} `hcl:"disable_sealwrap"`
 
+	OnlineSealMigration    bool        `hcl:"-"`
+	OnlineSealMigrationRaw interface{} `hcl:"online_seal_migration"`
+
 	DisableIndexing    bool        `hcl:"-"`
 	DisableIndexingRaw interface{} `hcl:"disable_indexing"`
 }
@@ -166,7 +169,13 @@ func (b *ServiceRegistration) GoString() string {
 type Seal struct {
 	Type     string
 	Disabled bool
-	Config   map[string]string
+
+	// Name and Priority are set for each of the seals of a multiseal, which
+	// wraps the barrier keys with several seals
+	Name     string
+	Priority int
+
+	Config map[string]string
 }
 
 func (h *Seal) GoString() string {
@@ -431,6 +440,11 @@ func (c *Config) Merge(c2 *Config) *Config {
 		result.DisableSealWrap = c2.DisableSealWrap
 	}
 
+	result.OnlineSealMigration = c.OnlineSealMigration
+	if c2.OnlineSealMigration {
+		result.OnlineSealMigration = c2.OnlineSealMigration
+	}
+
 	result.DisableIndexing = c.DisableIndexing
 	if c2.DisableIndexing {
 		result.DisableIndexing = c2.DisableIndexing
@@ -566,6 +580,12 @@ func ParseConfig(d string) (*Config, error) {
 		}
 	}
 
+	if result.OnlineSealMigrationRaw != nil {
+		if result.OnlineSealMigration, err = parseutil.ParseBool(result.OnlineSealMigrationRaw); err != nil {
+			return nil, err
+		}
+	}
+
 	if result.DisableIndexingRaw != nil {
 		if result.DisableIndexing, err = parseutil.ParseBool(result.DisableIndexingRaw); err != nil {
 			return nil, err
@@ -878,10 +898,6 @@ func parseServiceRegistration(result *Config, list *ast.ObjectList, name string)
 }
 
 func parseSeals(result *Config, list *ast.ObjectList, blockName string) error {
-	if len(list.Items) > 2 {
-		return fmt.Errorf("only two or less %q blocks are permitted", blockName)
-	}
-
 	seals := make([]*Seal, 0, len(list.Items))
 	for _, item := range list.Items {
 		key := "seal"
@@ -902,18 +918,67 @@ func parseSeals(result *Config, list *ast.ObjectList, blockName string) error {
 			}
 			delete(m, "disabled")
 		}
+		var priority int
+		if v, ok := m["priority"]; ok {
+			priority, err = strconv.Atoi(v)
+			if err != nil {
+				return multierror.Prefix(err, fmt.Sprintf("%s.%s:", blockName, key))
+			}
+			if priority < 1 {
+				return fmt.Errorf("%s.%s: priority must be at least 1", blockName, key)
+			}
+			delete(m, "priority")
+		}
+		name := strings.ToLower(key)
+		if v, ok := m["name"]; ok {
+			name = v
+			delete(m, "name")
+		}
 		seals = append(seals, &Seal{
 			Type:     strings.ToLower(key),
 			Disabled: disabled,
+			Name:     name,
+			Priority: priority,
 			Config:   m,
 		})
 	}
 
-	if len(seals) == 2 &&
-		(seals[0].Disabled && seals[1].Disabled || !seals[0].Disabled && !seals[1].Disabled) {
+	var enabled, disabled []*Seal
+	for _, s := range seals {
+		if s.Disabled {
+			disabled = append(disabled, s)
+		} else {
+			enabled = append(enabled, s)
+		}
+	}
+
+	switch {
+	case len(disabled) > 1:
+		return fmt.Errorf("only one disabled %q block is permitted", blockName)
+	case len(enabled) == 2 && len(disabled) == 0 && enabled[0].Priority == 0 && enabled[1].Priority == 0,
+		len(seals) == 2 && len(enabled) == 0:
 		return errors.New("seals: two seals provided but both are disabled or neither are disabled")
 	}
 
+	// Several enabled seals form a multiseal, each needing a priority
+	if len(enabled) > 1 {
+		names := make(map[string]bool, len(enabled))
+		priorities := make(map[int]bool, len(enabled))
+		for _, s := range enabled {
+			if s.Priority == 0 {
+				return fmt.Errorf("%s.%s: priority must be set when several seals are enabled", blockName, s.Type)
+			}
+			if names[s.Name] {
+				return fmt.Errorf("%s.%s: duplicate seal name %q, name must be set to tell seals of the same type apart", blockName, s.Type, s.Name)
+			}
+			if priorities[s.Priority] {
+				return fmt.Errorf("%s.%s: duplicate seal priority %d", blockName, s.Type, s.Priority)
+			}
+			names[s.Name] = true
+			priorities[s.Priority] = true
+		}
+	}
+
 	result.Seals = seals
 
 	return nil
@@ -1019,6 +1084,8 @@ func (c *Config) Sanitized() map[string]interface{} {
 
 		"disable_sealwrap": c.DisableSealWrap,
 
+		"online_seal_migration": c.OnlineSealMigration,
+
 		"disable_indexing": c.DisableIndexing,
 	}
 
@@ -1073,6 +1140,10 @@ func (c *Config) Sanitized() map[string]interface{} {
 				"type":     s.Type,
 				"disabled": s.Disabled,
 			}
+			if s.Priority != 0 {
+				cleanSeal["name"] = s.Name
+				cleanSeal["priority"] = s.Priority
+			}
 			sanitizedSeals = append(sanitizedSeals, cleanSeal)
 		}
 		result["seals"] = sanitizedSeals
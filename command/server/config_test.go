@@ -37,3 +37,7 @@ func TestParseListeners(t *testing.T) {
 func TestParseEntropy(t *testing.T) {
 	testParseEntropy(t, true)
 }
+
+func TestParseSeals(t *testing.T) {
+	testParseSeals(t)
+}
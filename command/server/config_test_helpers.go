@@ -472,6 +472,7 @@ func testConfig_Sanitized(t *testing.T) {
 		"disable_performance_standby":  false,
 		"disable_printable_check":      false,
 		"disable_sealwrap":             true,
+		"online_seal_migration":        false,
 		"raw_storage_endpoint":         true,
 		"enable_ui":                    true,
 		"ha_storage": map[string]interface{}{
@@ -588,3 +589,135 @@ listener "tcp" {
 	}
 
 }
+
+func testParseSeals(t *testing.T) {
+	cases := []struct {
+		name     string
+		inConfig string
+		outSeals []*Seal
+		outErr   bool
+	}{
+		{
+			name: "single",
+			inConfig: `
+seal "awskms" {
+	kms_key_id = "alias/vault"
+}`,
+			outSeals: []*Seal{
+				{Type: "awskms", Name: "awskms", Config: map[string]string{"kms_key_id": "alias/vault"}},
+			},
+		},
+		{
+			name: "migration",
+			inConfig: `
+seal "awskms" {
+	disabled = "true"
+}
+seal "transit" {
+	key_name = "vault"
+}`,
+			outSeals: []*Seal{
+				{Type: "awskms", Name: "awskms", Disabled: true, Config: map[string]string{}},
+				{Type: "transit", Name: "transit", Config: map[string]string{"key_name": "vault"}},
+			},
+		},
+		{
+			name: "multiseal",
+			inConfig: `
+seal "awskms" {
+	name = "us-east"
+	priority = "1"
+	region = "us-east-1"
+}
+seal "awskms" {
+	name = "us-west"
+	priority = "2"
+	region = "us-west-2"
+}
+seal "transit" {
+	priority = "3"
+}`,
+			outSeals: []*Seal{
+				{Type: "awskms", Name: "us-east", Priority: 1, Config: map[string]string{"region": "us-east-1"}},
+				{Type: "awskms", Name: "us-west", Priority: 2, Config: map[string]string{"region": "us-west-2"}},
+				{Type: "transit", Name: "transit", Priority: 3, Config: map[string]string{}},
+			},
+		},
+		{
+			name: "neither disabled",
+			inConfig: `
+seal "awskms" {}
+seal "transit" {}`,
+			outErr: true,
+		},
+		{
+			name: "both disabled",
+			inConfig: `
+seal "awskms" {
+	disabled = "true"
+}
+seal "transit" {
+	disabled = "true"
+}`,
+			outErr: true,
+		},
+		{
+			name: "missing priority",
+			inConfig: `
+seal "awskms" {
+	priority = "1"
+}
+seal "transit" {}`,
+			outErr: true,
+		},
+		{
+			name: "duplicate priority",
+			inConfig: `
+seal "awskms" {
+	priority = "1"
+}
+seal "transit" {
+	priority = "1"
+}`,
+			outErr: true,
+		},
+		{
+			name: "duplicate name",
+			inConfig: `
+seal "awskms" {
+	priority = "1"
+}
+seal "awskms" {
+	priority = "2"
+}`,
+			outErr: true,
+		},
+		{
+			name: "bad priority",
+			inConfig: `
+seal "awskms" {
+	priority = "0"
+}`,
+			outErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		obj, err := hcl.Parse(strings.TrimSpace(tc.inConfig))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		list, _ := obj.Node.(*ast.ObjectList)
+
+		var config Config
+		err = parseSeals(&config, list.Filter("seal"), "seal")
+		switch {
+		case tc.outErr && err == nil:
+			t.Fatalf("%s: expected error", tc.name)
+		case !tc.outErr && err != nil:
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		case !reflect.DeepEqual(config.Seals, tc.outSeals):
+			t.Fatalf("%s: expected \n\n%#v\n\n to be \n\n%#v\n\n", tc.name, config.Seals, tc.outSeals)
+		}
+	}
+}
@@ -34,7 +34,7 @@ func configureSeal(configSeal *server.Seal, infoKeys *[]string, info *map[string
 		return configureTransitSeal(configSeal, infoKeys, info, logger, inseal)
 
 	case wrapping.PKCS11:
-		return nil, fmt.Errorf("Seal type 'pkcs11' requires the Vault Enterprise HSM binary")
+		return configurePKCS11Seal(configSeal, infoKeys, info, logger, inseal)
 
 	case wrapping.Shamir:
 		return inseal, nil
@@ -0,0 +1,38 @@
+// +build cgo
+
+package seal
+
+import (
+	log "github.com/hashicorp/go-hclog"
+	wrapping "github.com/hashicorp/go-kms-wrapping"
+	"github.com/hashicorp/vault/command/server"
+	"github.com/hashicorp/vault/vault"
+	"github.com/hashicorp/vault/vault/seal"
+	"github.com/hashicorp/vault/vault/seal/pkcs11"
+)
+
+func configurePKCS11Seal(configSeal *server.Seal, infoKeys *[]string, info *map[string]string, logger log.Logger, inseal vault.Seal) (vault.Seal, error) {
+	pkcs11Seal := pkcs11.NewWrapper(&wrapping.WrapperOptions{
+		Logger: logger.ResetNamed("seal-pkcs11"),
+	})
+	sealInfo, err := pkcs11Seal.SetConfig(configSeal.Config)
+	if err != nil {
+		return nil, err
+	}
+	autoseal := vault.NewAutoSeal(&seal.Access{
+		Wrapper: pkcs11Seal,
+	})
+	if sealInfo != nil {
+		*infoKeys = append(*infoKeys, "Seal Type", "PKCS#11 Library", "PKCS#11 Slot", "PKCS#11 Key Label", "PKCS#11 Mechanism")
+		(*info)["Seal Type"] = configSeal.Type
+		(*info)["PKCS#11 Library"] = sealInfo["lib"]
+		(*info)["PKCS#11 Slot"] = sealInfo["slot"]
+		(*info)["PKCS#11 Key Label"] = sealInfo["key_label"]
+		(*info)["PKCS#11 Mechanism"] = sealInfo["mechanism"]
+		if tokenLabel, ok := sealInfo["token_label"]; ok {
+			*infoKeys = append(*infoKeys, "PKCS#11 Token Label")
+			(*info)["PKCS#11 Token Label"] = tokenLabel
+		}
+	}
+	return autoseal, nil
+}
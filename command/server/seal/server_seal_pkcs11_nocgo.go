@@ -0,0 +1,15 @@
+// +build !cgo
+
+package seal
+
+import (
+	"errors"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/server"
+	"github.com/hashicorp/vault/vault"
+)
+
+func configurePKCS11Seal(configSeal *server.Seal, infoKeys *[]string, info *map[string]string, logger log.Logger, inseal vault.Seal) (vault.Seal, error) {
+	return nil, errors.New("Seal type 'pkcs11' requires a Vault binary built with cgo enabled")
+}
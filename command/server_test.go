@@ -287,3 +287,33 @@ func TestServer(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_SealTypeFromEnv(t *testing.T) {
+	for _, env := range []string{"VAULT_SEAL_TYPE", "VAULT_HSM_TYPE", "VAULT_HSM_LIB"} {
+		if v, ok := os.LookupEnv(env); ok {
+			defer os.Setenv(env, v)
+		} else {
+			defer os.Unsetenv(env)
+		}
+		os.Unsetenv(env)
+	}
+
+	if sealType := sealTypeFromEnv(); sealType != "" {
+		t.Fatalf("expected no seal type, got %q", sealType)
+	}
+
+	// Existing PKCS#11 seal configurations set the library and HSM type
+	os.Setenv("VAULT_HSM_TYPE", "pkcs11")
+	if sealType := sealTypeFromEnv(); sealType != "" {
+		t.Fatalf("expected no seal type without a library, got %q", sealType)
+	}
+	os.Setenv("VAULT_HSM_LIB", "/usr/lib/libpkcs11.so")
+	if sealType := sealTypeFromEnv(); sealType != "pkcs11" {
+		t.Fatalf("expected pkcs11 seal type, got %q", sealType)
+	}
+
+	os.Setenv("VAULT_SEAL_TYPE", "transit")
+	if sealType := sealTypeFromEnv(); sealType != "transit" {
+		t.Fatalf("expected VAULT_SEAL_TYPE to take precedence, got %q", sealType)
+	}
+}
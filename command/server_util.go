@@ -39,7 +39,7 @@ func adjustCoreForSealMigration(logger log.Logger, core *vault.Core, barrierSeal
 	if unwrapSeal == nil {
 		// We have the same barrier type and the unwrap seal is nil so we're not
 		// migrating from same to same, IOW we assume it's not a migration
-		if existBarrierSealConfig.Type == barrierSeal.BarrierType() {
+		if vault.SealAcceptsBarrierType(barrierSeal, existBarrierSealConfig.Type) {
 			return nil
 		}
 
@@ -57,7 +57,7 @@ func adjustCoreForSealMigration(logger log.Logger, core *vault.Core, barrierSeal
 	var existSeal vault.Seal
 	var newSeal vault.Seal
 
-	if existBarrierSealConfig.Type == barrierSeal.BarrierType() {
+	if vault.SealAcceptsBarrierType(barrierSeal, existBarrierSealConfig.Type) {
 		// In this case our migration seal is set so we are using it
 		// (potentially) for unwrapping. Set it on core for that purpose then
 		// exit.
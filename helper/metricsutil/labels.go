@@ -0,0 +1,36 @@
+package metricsutil
+
+import (
+	"strings"
+
+	"github.com/armon/go-metrics"
+)
+
+// NamespaceLabel returns the metrics label identifying the given namespace
+// path. The root namespace is reported as "root".
+func NamespaceLabel(nsPath string) metrics.Label {
+	nsPath = strings.Trim(nsPath, "/")
+	if nsPath == "" {
+		nsPath = "root"
+	}
+	return metrics.Label{Name: "namespace", Value: nsPath}
+}
+
+// PathLabel returns the metrics label identifying the given mount or request
+// path. An empty path is reported as "global".
+func PathLabel(path string) metrics.Label {
+	if path == "" {
+		path = "global"
+	}
+	return metrics.Label{Name: "path", Value: path}
+}
+
+// IncrQuotaViolation emits a counter for a request rejected by the named
+// quota of the given type, e.g. "rate_limit".
+func IncrQuotaViolation(quotaType, name, path, nsPath string) {
+	metrics.IncrCounterWithLabels([]string{"quota", quotaType, "violation"}, 1, []metrics.Label{
+		{Name: "name", Value: name},
+		PathLabel(path),
+		NamespaceLabel(nsPath),
+	})
+}
@@ -44,3 +44,15 @@ func TestFormatFromRequest(t *testing.T) {
 		}
 	}
 }
+
+func TestNamespaceLabel(t *testing.T) {
+	for in, expected := range map[string]string{
+		"":         "root",
+		"ns1/":     "ns1",
+		"ns1/ns2/": "ns1/ns2",
+	} {
+		if label := NamespaceLabel(in); label.Name != "namespace" || label.Value != expected {
+			t.Fatalf("bad label for %q: %#v", in, label)
+		}
+	}
+}
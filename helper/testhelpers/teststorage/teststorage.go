@@ -115,6 +115,10 @@ func MakeRaftBackend(t testing.T, coreIdx int, logger hclog.Logger) *vault.Physi
 		"path":                   raftDir,
 		"node_id":                nodeID,
 		"performance_multiplier": "8",
+
+		// Join nodes as voters right away, as tests replace the active node
+		// soon after the cluster is formed
+		"autopilot_server_stabilization_time": "0",
 	}
 
 	backend, err := raft.NewRaftBackend(conf, logger)
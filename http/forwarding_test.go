@@ -2,6 +2,7 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -603,3 +604,68 @@ func TestHTTP_Forwarding_LocalOnly(t *testing.T) {
 	testLocalOnly(cores[1].Client)
 	testLocalOnly(cores[2].Client)
 }
+
+func TestHTTP_Forwarding_Stream(t *testing.T) {
+	coreConfig := &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"transit": transit.Factory,
+		},
+	}
+
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+	cores := cluster.Cores
+
+	vault.TestWaitActive(t, cores[0].Core)
+
+	active := cores[0].Client
+	if err := active.Sys().Mount("transit", &api.MountInput{
+		Type: "transit",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := active.Logical().Write("transit/keys/backup", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := bytes.Repeat([]byte("a"), 1024*1024)
+	ctx := context.Background()
+	if err := active.Transit().EncryptStream(ctx, "backup", bytes.NewReader(plaintext), &bytes.Buffer{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Standbys redirect stream requests to the active node instead of
+	// forwarding them
+	standby := cores[1].Client
+	err := standby.Transit().EncryptStream(ctx, "backup", bytes.NewReader(plaintext), &bytes.Buffer{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "must be sent to the active node") {
+		t.Fatalf("expected redirect error, got %v", err)
+	}
+
+	req, err := http.NewRequest("POST", standby.Address()+"/v1/transit/encrypt-stream/backup", bytes.NewReader(plaintext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(consts.AuthHeaderName, cluster.RootToken)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	config := api.DefaultConfig()
+	config.HttpClient.Transport.(*http.Transport).TLSClientConfig = cores[0].TLSConfig
+	resp, err := config.HttpClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusTemporaryRedirect {
+		t.Fatalf("expected status %d, got %d", http.StatusTemporaryRedirect, resp.StatusCode)
+	}
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := fmt.Sprintf(":%d", cores[0].Listeners[0].Address.Port); !strings.HasSuffix(location.Host, expected) {
+		t.Fatalf("expected redirect to the active node, got %q", location)
+	}
+}
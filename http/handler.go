@@ -8,11 +8,13 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"net"
 	"net/http"
 	"net/textproto"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -28,6 +30,7 @@ import (
 	"github.com/hashicorp/vault/sdk/helper/pathmanager"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/hashicorp/vault/vault"
+	"github.com/hashicorp/vault/vault/quotas"
 )
 
 const (
@@ -167,7 +170,8 @@ func Handler(props *vault.HandlerProperties) http.Handler {
 
 	// Wrap the handler in another handler to trigger all help paths.
 	helpWrappedHandler := wrapHelpHandler(mux, core)
-	corsWrappedHandler := wrapCORSHandler(helpWrappedHandler, core)
+	quotaWrappedHandler := rateLimitQuotaWrapping(helpWrappedHandler, core)
+	corsWrappedHandler := wrapCORSHandler(quotaWrappedHandler, core)
 
 	genericWrappedHandler := genericWrapping(core, corsWrappedHandler, props)
 
@@ -228,6 +232,47 @@ func wrapGenericHandler(core *vault.Core, h http.Handler, maxRequestSize int64,
 	})
 }
 
+// rateLimitQuotaWrapping rejects API requests exceeding the rate limit quota
+// that applies to them with a 429 status code and a Retry-After header.
+func rateLimitQuotaWrapping(handler http.Handler, core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		ns, err := namespace.FromContext(r.Context())
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		clientAddr, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			clientAddr = r.RemoteAddr
+		}
+
+		quotaResp, err := core.ApplyRateLimitQuota(r.Context(), &quotas.Request{
+			Path:          ns.TrimmedPath(strings.TrimPrefix(r.URL.Path, "/v1/")),
+			ClientAddress: clientAddr,
+		})
+		if err != nil {
+			core.Logger().Error("failed to apply rate limit quota", "path", r.URL.Path, "error", err)
+			respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if !quotaResp.Allowed {
+			retryAfter := int(math.Ceil(quotaResp.RetryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			respondError(w, http.StatusTooManyRequests, quotas.ErrRateLimitQuotaExceeded)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
 func WrapForwardedForHandler(h http.Handler, authorizedAddrs []*sockaddr.SockAddrMarshaler, rejectNotPresent, rejectNonAuthz bool, hopSkips int) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		headers, headersOK := r.Header[textproto.CanonicalMIMEHeaderKey("X-Forwarded-For")]
@@ -500,19 +545,9 @@ func parseQuery(values url.Values) map[string]interface{} {
 }
 
 func parseRequest(perfStandby bool, r *http.Request, w http.ResponseWriter, out interface{}) (io.ReadCloser, error) {
-	// Limit the maximum number of bytes to MaxRequestSize to protect
-	// against an indefinite amount of data being read.
-	reader := r.Body
-	ctx := r.Context()
-	maxRequestSize := ctx.Value("max_request_size")
-	if maxRequestSize != nil {
-		max, ok := maxRequestSize.(int64)
-		if !ok {
-			return nil, errors.New("could not parse max_request_size from request context")
-		}
-		if max > 0 {
-			reader = http.MaxBytesReader(w, r.Body, max)
-		}
+	reader, err := limitRequestBody(r, w)
+	if err != nil {
+		return nil, err
 	}
 	var origBody io.ReadWriter
 	if perfStandby {
@@ -521,7 +556,7 @@ func parseRequest(perfStandby bool, r *http.Request, w http.ResponseWriter, out
 		origBody = new(bytes.Buffer)
 		reader = ioutil.NopCloser(io.TeeReader(reader, origBody))
 	}
-	err := jsonutil.DecodeJSONFromReader(reader, out)
+	err = jsonutil.DecodeJSONFromReader(reader, out)
 	if err != nil && err != io.EOF {
 		return nil, errwrap.Wrapf("failed to parse JSON input: {{err}}", err)
 	}
@@ -531,6 +566,47 @@ func parseRequest(perfStandby bool, r *http.Request, w http.ResponseWriter, out
 	return nil, err
 }
 
+// parseFormRequest parses a request body encoded as
+// application/x-www-form-urlencoded, as sent by OAuth 2.0 clients
+func parseFormRequest(perfStandby bool, r *http.Request, w http.ResponseWriter) (map[string]interface{}, io.ReadCloser, error) {
+	reader, err := limitRequestBody(r, w)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, nil, errwrap.Wrapf("failed to read form input: {{err}}", err)
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, nil, errwrap.Wrapf("failed to parse form input: {{err}}", err)
+	}
+
+	var origBody io.ReadCloser
+	if perfStandby {
+		origBody = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	return parseQuery(values), origBody, nil
+}
+
+// limitRequestBody limits the maximum number of bytes read from the request
+// body to MaxRequestSize to protect against an indefinite amount of data
+// being read.
+func limitRequestBody(r *http.Request, w http.ResponseWriter) (io.ReadCloser, error) {
+	reader := r.Body
+	maxRequestSize := r.Context().Value("max_request_size")
+	if maxRequestSize != nil {
+		max, ok := maxRequestSize.(int64)
+		if !ok {
+			return nil, errors.New("could not parse max_request_size from request context")
+		}
+		if max > 0 {
+			reader = http.MaxBytesReader(w, r.Body, max)
+		}
+	}
+	return reader, nil
+}
+
 // handleRequestForwarding determines whether to forward a request or not,
 // falling back on the older behavior of redirecting the client
 func handleRequestForwarding(core *vault.Core, handler http.Handler) http.Handler {
@@ -604,7 +680,9 @@ func forwardRequest(core *vault.Core, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	path := ns.TrimmedPath(r.URL.Path[len("/v1/"):])
-	if alwaysRedirectPaths.HasPath(path) {
+	// Stream requests are redirected as well, since forwarded requests are
+	// read in memory and their size is limited
+	if alwaysRedirectPaths.HasPath(path) || isStreamRequest(path, r) {
 		respondStandby(core, w, r.URL)
 		return
 	}
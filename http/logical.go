@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net"
 	"net/http"
 	"strconv"
@@ -69,16 +70,49 @@ func buildLogicalRequestNoAuth(perfStandby bool, w http.ResponseWriter, r *http.
 			responseWriter = w
 		}
 
-	case "POST", "PUT":
+	case "HEAD":
+		// Only ACME clients send HEAD requests, to fetch a new nonce
+		if !isACMENonceRequest(path) {
+			return nil, nil, http.StatusMethodNotAllowed, nil
+		}
+		op = logical.HeaderOperation
+		data = parseQuery(r.URL.Query())
+
+	case "POST", "PUT", "PATCH":
+		// Only SCIM clients update resources with PATCH, which is handled as
+		// an update, so the HTTP request is passed along for the backend to
+		// tell patches from replacements
+		if r.Method == "PATCH" && !isSCIMRequest(path) {
+			return nil, nil, http.StatusMethodNotAllowed, nil
+		}
+		if isSCIMRequest(path) {
+			passHTTPReq = true
+		}
+
 		op = logical.UpdateOperation
 		// Parse the request if we can
 		if op == logical.UpdateOperation {
-			// If we are uploading a snapshot we don't want to parse it. Instead
-			// we will simply add the HTTP request to the logical request object
-			// for later consumption.
-			if path == "sys/storage/raft/snapshot" || path == "sys/storage/raft/snapshot-force" {
+			// If we are uploading a snapshot or receiving a DER-encoded OCSP
+			// request we don't want to parse it. Instead we will simply add
+			// the HTTP request to the logical request object for later
+			// consumption.
+			if path == "sys/storage/raft/snapshot" || path == "sys/storage/raft/snapshot-force" || isOCSPRequest(path, r) {
 				passHTTPReq = true
 				origBody = r.Body
+			} else if isOIDCTokenRequest(path, r) {
+				data, origBody, err = parseFormRequest(perfStandby, r, w)
+				if err != nil {
+					return nil, nil, http.StatusBadRequest, err
+				}
+			} else if isStreamRequest(path, r) {
+				// Streamed payloads are read from the body by the backend,
+				// which writes its output to the response as it goes, so
+				// parameters are taken from the query string.
+				data = parseQuery(r.URL.Query())
+				passHTTPReq = true
+				origBody = r.Body
+				responseWriter = w
+				enableFullDuplex(w)
 			} else {
 				origBody, err = parseRequest(perfStandby, r, w, &data)
 				if err == io.EOF {
@@ -126,6 +160,70 @@ func buildLogicalRequestNoAuth(perfStandby bool, w http.ResponseWriter, r *http.
 	return req, origBody, 0, nil
 }
 
+// isOCSPRequest returns whether the request is sent to the OCSP endpoint of a
+// PKI mount with a body holding an OCSP request as defined in RFC 6960, which
+// is sent as raw DER rather than JSON. Other requests with that content type
+// are still parsed as JSON.
+func isOCSPRequest(path string, r *http.Request) bool {
+	if !strings.HasSuffix(path, "/ocsp") && !strings.Contains(path, "/ocsp/") {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/ocsp-request"
+}
+
+// isACMENonceRequest returns whether the request is sent to the new-nonce
+// endpoint of a PKI mount's ACME server.
+func isACMENonceRequest(path string) bool {
+	return strings.Contains(path, "/acme/") && strings.HasSuffix(path, "/new-nonce")
+}
+
+// isOIDCTokenRequest returns whether the request is sent to the token endpoint
+// of an OIDC provider with a form encoded body, as OAuth 2.0 clients do. Other
+// form encoded requests are still parsed as JSON, as sent by curl -d.
+func isOIDCTokenRequest(path string, r *http.Request) bool {
+	if !strings.HasPrefix(path, "identity/oidc/provider/") || !strings.HasSuffix(path, "/token") {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/x-www-form-urlencoded"
+}
+
+// isStreamRequest returns whether the request is sent to the stream endpoints
+// of a transit mount with a binary body to be processed by the backend rather
+// than JSON. Other binary requests are still parsed as JSON.
+func isStreamRequest(path string, r *http.Request) bool {
+	if !strings.Contains(path, "/encrypt-stream/") && !strings.Contains(path, "/decrypt-stream/") {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/octet-stream"
+}
+
+// enableFullDuplex allows the request body to be read after the response has
+// started, which HTTP/1.x servers otherwise prevent; HTTP/2 always allows it.
+// Response writers that do not support it are left as they are.
+func enableFullDuplex(w http.ResponseWriter) {
+	if fd, ok := w.(interface{ EnableFullDuplex() error }); ok {
+		fd.EnableFullDuplex()
+	}
+}
+
+// isSCIMRequest returns whether the request is sent to the SCIM provisioning
+// API of the identity store.
+func isSCIMRequest(path string) bool {
+	return strings.HasPrefix(path, "identity/scim/v2/")
+}
+
 func buildLogicalRequest(core *vault.Core, w http.ResponseWriter, r *http.Request) (*logical.Request, io.ReadCloser, int, error) {
 	req, origBody, status, err := buildLogicalRequestNoAuth(core.PerfStandby(), w, r)
 	if err != nil || status != 0 {
@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
@@ -261,6 +262,117 @@ func TestLogical_RawHTTP(t *testing.T) {
 	}
 }
 
+func TestLogical_OIDCProviderEndpoints(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPost(t, token, addr+"/v1/identity/oidc/provider/test", map[string]interface{}{
+		"allowed_client_ids": "*",
+	})
+	testResponseStatus(t, resp, 204)
+
+	// The token endpoint is unauthenticated and accepts form encoded requests
+	form := url.Values{
+		"grant_type": []string{"password"},
+	}
+	resp, err := http.Post(addr+"/v1/identity/oidc/provider/test/token", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testResponseStatus(t, resp, 400)
+	var body map[string]interface{}
+	testResponseBody(t, resp, &body)
+	if body["error"] != "unsupported_grant_type" {
+		t.Fatalf("bad response: %#v", body)
+	}
+
+	// The userinfo endpoint is unauthenticated and validates the bearer token
+	req, err := http.NewRequest("GET", addr+"/v1/identity/oidc/provider/test/userinfo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer invalid")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testResponseStatus(t, resp, 401)
+	body = nil
+	testResponseBody(t, resp, &body)
+	if body["error"] != "invalid_token" {
+		t.Fatalf("bad response: %#v", body)
+	}
+
+	// Other provider paths still require a token
+	resp = testHttpGet(t, "invalid", addr+"/v1/identity/oidc/provider/test")
+	testResponseStatus(t, resp, 403)
+}
+
+func TestLogical_SCIMPatch(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPost(t, token, addr+"/v1/identity/scim/v2/Users", map[string]interface{}{
+		"schemas":  []string{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"userName": "alice",
+	})
+	testResponseStatus(t, resp, 201)
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/scim+json" {
+		t.Fatalf("bad content type: %q", contentType)
+	}
+	var user map[string]interface{}
+	testResponseBody(t, resp, &user)
+
+	// SCIM resources are patched with the PATCH method
+	resp = testHttpData(t, "PATCH", token, addr+"/v1/identity/scim/v2/Users/"+user["id"].(string), map[string]interface{}{
+		"schemas": []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
+		"Operations": []map[string]interface{}{
+			{"op": "replace", "path": "active", "value": false},
+		},
+	}, false, 0)
+	testResponseStatus(t, resp, 200)
+	user = nil
+	testResponseBody(t, resp, &user)
+	if user["active"] != false {
+		t.Fatalf("bad: %#v", user)
+	}
+
+	// Patches must be sent with the PATCH method
+	resp = testHttpPut(t, token, addr+"/v1/identity/scim/v2/Users/"+user["id"].(string), map[string]interface{}{
+		"schemas": []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
+		"Operations": []map[string]interface{}{
+			{"op": "replace", "path": "active", "value": true},
+		},
+	})
+	testResponseStatus(t, resp, 400)
+
+	// Other paths do not accept PATCH
+	resp = testHttpData(t, "PATCH", token, addr+"/v1/secret/foo", map[string]interface{}{
+		"data": "bar",
+	}, false, 0)
+	testResponseStatus(t, resp, 405)
+}
+
+func TestLogical_HeadRequest(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/secret/foo", map[string]interface{}{
+		"data": "bar",
+	})
+	testResponseStatus(t, resp, 204)
+
+	// HEAD requests are only accepted by ACME new-nonce endpoints
+	resp = testHttpData(t, "HEAD", token, addr+"/v1/secret/foo", nil, false, 0)
+	testResponseStatus(t, resp, 405)
+}
+
 func TestLogical_RequestSizeLimit(t *testing.T) {
 	core, _, token := vault.TestCoreUnsealed(t)
 	ln, addr := TestServer(t, core)
@@ -274,6 +386,64 @@ func TestLogical_RequestSizeLimit(t *testing.T) {
 	testResponseStatus(t, resp, 413)
 }
 
+func TestLogical_OctetStreamJSON(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	// Only the transit stream endpoints take a binary body, so a JSON body
+	// sent elsewhere with a binary content type is still parsed as JSON
+	req, err := http.NewRequest("PUT", addr+"/v1/secret/foo", strings.NewReader(`{"data":"bar"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(consts.AuthHeaderName, token)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpGet(t, token, addr+"/v1/secret/foo")
+	testResponseStatus(t, resp, 200)
+	var actual map[string]interface{}
+	testResponseBody(t, resp, &actual)
+	if data, ok := actual["data"].(map[string]interface{}); !ok || data["data"] != "bar" {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestLogical_OCSPContentTypeJSON(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	// Only the OCSP endpoints take a raw DER body, so a JSON body sent
+	// elsewhere with the OCSP content type is still parsed as JSON
+	req, err := http.NewRequest("PUT", addr+"/v1/secret/foo", strings.NewReader(`{"data":"bar"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(consts.AuthHeaderName, token)
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpGet(t, token, addr+"/v1/secret/foo")
+	testResponseStatus(t, resp, 200)
+	var actual map[string]interface{}
+	testResponseBody(t, resp, &actual)
+	if data, ok := actual["data"].(map[string]interface{}); !ok || data["data"] != "bar" {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
 func TestLogical_ListSuffix(t *testing.T) {
 	core, _, rootToken := vault.TestCoreUnsealed(t)
 	req, _ := http.NewRequest("GET", "http://127.0.0.1:8200/v1/secret/foo", nil)
@@ -38,6 +38,7 @@ func TestSysConfigState_Sanitized(t *testing.T) {
 		"disable_performance_standby":  false,
 		"disable_printable_check":      false,
 		"disable_sealwrap":             false,
+		"online_seal_migration":        false,
 		"raw_storage_endpoint":         false,
 		"enable_ui":                    false,
 		"log_format":                   "",
@@ -0,0 +1,118 @@
+package http
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestSysQuotasRateLimit(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	// The quota path must be an existing mount
+	resp := testHttpPut(t, token, addr+"/v1/sys/quotas/rate-limit/kv", map[string]interface{}{
+		"path": "nonexistent/",
+		"rate": 1,
+	})
+	testResponseStatus(t, resp, 400)
+
+	resp = testHttpPut(t, token, addr+"/v1/sys/quotas/rate-limit/kv", map[string]interface{}{
+		"path":  "secret",
+		"rate":  0.5,
+		"burst": 1,
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/quotas/rate-limit/kv")
+	var actual map[string]interface{}
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+	data := actual["data"].(map[string]interface{})
+	if data["path"] != "secret/" || data["rate"] != json.Number("0.5") {
+		t.Fatalf("bad: %#v", data)
+	}
+
+	resp = testHttpPut(t, token, addr+"/v1/secret/foo", map[string]interface{}{
+		"data": "bar",
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpGet(t, token, addr+"/v1/secret/foo")
+	testResponseStatus(t, resp, 429)
+	if resp.Header.Get("Retry-After") != "2" {
+		t.Fatalf("bad Retry-After header: %q", resp.Header.Get("Retry-After"))
+	}
+
+	// Other mounts and exempt paths are unaffected
+	resp = testHttpGet(t, token, addr+"/v1/sys/mounts")
+	testResponseStatus(t, resp, 200)
+	resp = testHttpGet(t, token, addr+"/v1/sys/health")
+	testResponseStatus(t, resp, 200)
+
+	resp = testHttpDelete(t, token, addr+"/v1/sys/quotas/rate-limit/kv")
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpGet(t, token, addr+"/v1/secret/foo")
+	testResponseStatus(t, resp, 200)
+}
+
+func TestSysQuotasLeaseCount(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/sys/quotas/lease-count/tokens", map[string]interface{}{
+		"path":       "auth/token",
+		"max_leases": 2,
+	})
+	testResponseStatus(t, resp, 204)
+
+	for i := 0; i < 2; i++ {
+		resp = testHttpPut(t, token, addr+"/v1/auth/token/create", map[string]interface{}{
+			"ttl": "1h",
+		})
+		testResponseStatus(t, resp, 200)
+	}
+
+	resp = testHttpPut(t, token, addr+"/v1/auth/token/create", map[string]interface{}{
+		"ttl": "1h",
+	})
+	testResponseStatus(t, resp, 400)
+	var actual map[string]interface{}
+	testResponseBody(t, resp, &actual)
+	errs := actual["errors"].([]interface{})
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].(string), "lease count quota exceeded") {
+		t.Fatalf("bad errors: %#v", errs)
+	}
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/leases/counts")
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+	data := actual["data"].(map[string]interface{})
+	counts := data["counts"].(map[string]interface{})
+	if counts["auth/token/"] != json.Number("2") || data["total"] != json.Number("2") {
+		t.Fatalf("bad lease counts: %#v", data)
+	}
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/quotas/lease-count/tokens")
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+	data = actual["data"].(map[string]interface{})
+	if data["lease_count"] != json.Number("2") || data["max_leases"] != json.Number("2") {
+		t.Fatalf("bad quota: %#v", data)
+	}
+
+	resp = testHttpDelete(t, token, addr+"/v1/sys/quotas/lease-count/tokens")
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpPut(t, token, addr+"/v1/auth/token/create", map[string]interface{}{
+		"ttl": "1h",
+	})
+	testResponseStatus(t, resp, 200)
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/sdk/helper/consts"
@@ -192,6 +193,18 @@ func handleSysSealStatusRaw(core *vault.Core, w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	wrappers, needsRewrap, err := sealWrapperStatus(ctx, core)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	migrationStatus, err := sealMigrationStatus(ctx, core)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
 	if sealConfig == nil {
 		respondOk(w, &SealStatusResponse{
 			Type:         core.SealAccess().BarrierType(),
@@ -199,6 +212,7 @@ func handleSysSealStatusRaw(core *vault.Core, w http.ResponseWriter, r *http.Req
 			Sealed:       true,
 			RecoverySeal: core.SealAccess().RecoveryKeySupported(),
 			StorageType:  core.StorageType(),
+			Wrappers:     wrappers,
 		})
 		return
 	}
@@ -222,22 +236,67 @@ func handleSysSealStatusRaw(core *vault.Core, w http.ResponseWriter, r *http.Req
 	progress, nonce := core.SecretProgress()
 
 	respondOk(w, &SealStatusResponse{
-		Type:         sealConfig.Type,
-		Initialized:  true,
-		Sealed:       sealed,
-		T:            sealConfig.SecretThreshold,
-		N:            sealConfig.SecretShares,
-		Progress:     progress,
-		Nonce:        nonce,
-		Version:      version.GetVersion().VersionNumber(),
-		Migration:    core.IsInSealMigration(),
-		ClusterName:  clusterName,
-		ClusterID:    clusterID,
-		RecoverySeal: core.SealAccess().RecoveryKeySupported(),
-		StorageType:  core.StorageType(),
+		Type:            sealConfig.Type,
+		Initialized:     true,
+		Sealed:          sealed,
+		T:               sealConfig.SecretThreshold,
+		N:               sealConfig.SecretShares,
+		Progress:        progress,
+		Nonce:           nonce,
+		Version:         version.GetVersion().VersionNumber(),
+		Migration:       core.IsInSealMigration(),
+		MigrationStatus: migrationStatus,
+		ClusterName:     clusterName,
+		ClusterID:       clusterID,
+		RecoverySeal:    core.SealAccess().RecoveryKeySupported(),
+		StorageType:     core.StorageType(),
+		Wrappers:        wrappers,
+		NeedsRewrap:     needsRewrap,
 	})
 }
 
+// sealWrapperStatus returns the status of the wrappers of a multiseal, and
+// whether the stored keys need to be rewrapped, or nil for other seals
+func sealWrapperStatus(ctx context.Context, core *vault.Core) ([]*SealWrapperStatus, *bool, error) {
+	statuses, needsRewrap, err := core.SealAccess().WrapperStatus(ctx)
+	if err != nil || statuses == nil {
+		return nil, nil, err
+	}
+
+	wrappers := make([]*SealWrapperStatus, 0, len(statuses))
+	for _, status := range statuses {
+		wrapper := &SealWrapperStatus{
+			Name:      status.Name,
+			Type:      status.Type,
+			Priority:  status.Priority,
+			Healthy:   status.Healthy,
+			LastError: status.LastError,
+		}
+		if !status.LastChecked.IsZero() {
+			wrapper.LastChecked = status.LastChecked.UTC().Format(time.RFC3339)
+		}
+		wrappers = append(wrappers, wrapper)
+	}
+	return wrappers, &needsRewrap, nil
+}
+
+// sealMigrationStatus returns the progress of the seal migration on this node,
+// or nil if it has not been in seal migration mode
+func sealMigrationStatus(ctx context.Context, core *vault.Core) (*SealMigrationStatus, error) {
+	status, err := core.SealMigrationStatus(ctx)
+	if err != nil || status == nil {
+		return nil, err
+	}
+
+	return &SealMigrationStatus{
+		State:     status.State,
+		FromType:  status.FromType,
+		ToType:    status.ToType,
+		Error:     status.Error,
+		UpdatedAt: status.UpdatedAt.UTC().Format(time.RFC3339),
+	}, nil
+}
+
 type SealStatusResponse struct {
 	Type         string `json:"type"`
 	Initialized  bool   `json:"initialized"`
@@ -252,6 +311,30 @@ type SealStatusResponse struct {
 	ClusterID    string `json:"cluster_id,omitempty"`
 	RecoverySeal bool   `json:"recovery_seal"`
 	StorageType  string `json:"storage_type,omitempty"`
+
+	// MigrationStatus is set once the node has been in seal migration mode
+	MigrationStatus *SealMigrationStatus `json:"migration_status,omitempty"`
+
+	// Wrappers and NeedsRewrap are only set for a multiseal
+	Wrappers    []*SealWrapperStatus `json:"wrappers,omitempty"`
+	NeedsRewrap *bool                `json:"needs_rewrap,omitempty"`
+}
+
+type SealWrapperStatus struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Priority    int    `json:"priority"`
+	Healthy     bool   `json:"healthy"`
+	LastError   string `json:"last_error,omitempty"`
+	LastChecked string `json:"last_checked,omitempty"`
+}
+
+type SealMigrationStatus struct {
+	State     string `json:"state"`
+	FromType  string `json:"from_type"`
+	ToType    string `json:"to_type"`
+	Error     string `json:"error,omitempty"`
+	UpdatedAt string `json:"updated_at"`
 }
 
 // Note: because we didn't provide explicit tagging in the past we can't do it
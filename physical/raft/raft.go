@@ -105,6 +105,27 @@ type RaftBackend struct {
 
 	// permitPool is used to limit the number of concurrent storage calls.
 	permitPool *physical.PermitPool
+
+	// autopilotConfig holds the autopilot settings parsed from the storage
+	// configuration.
+	autopilotConfig *AutopilotConfig
+
+	// autopilot is the autopilot loop, only running on the active node. It
+	// is guarded by autopilotLock rather than l so that starting and stopping
+	// it never waits on storage operations.
+	autopilot     *autopilot
+	autopilotLock sync.Mutex
+
+	// autoSnapshotConfig holds the automated snapshot settings parsed from
+	// the storage configuration.
+	autoSnapshotConfig *AutoSnapshotConfig
+
+	// autoSnapshotter takes the automated snapshots, only running on the
+	// active node. The fields below are guarded by autoSnapshotLock.
+	autoSnapshotter     *autoSnapshotter
+	autoSnapshotStatus  AutoSnapshotStatus
+	snapshotDestination SnapshotDestination
+	autoSnapshotLock    sync.Mutex
 }
 
 // EnsurePath is used to make sure a path exists
@@ -123,6 +144,16 @@ func NewRaftBackend(conf map[string]string, logger log.Logger) (physical.Backend
 		return nil, fmt.Errorf("failed to create fsm: %v", err)
 	}
 
+	autopilotConfig, err := parseAutopilotConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	autoSnapshotConfig, err := parseAutoSnapshotConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
 	path := os.Getenv(EnvVaultRaftPath)
 	if path == "" {
 		pathFromConfig, ok := conf["path"]
@@ -215,15 +246,17 @@ func NewRaftBackend(conf map[string]string, logger log.Logger) (physical.Backend
 	}
 
 	return &RaftBackend{
-		logger:      logger,
-		fsm:         fsm,
-		conf:        conf,
-		logStore:    log,
-		stableStore: stable,
-		snapStore:   snap,
-		dataDir:     path,
-		localID:     localID,
-		permitPool:  physical.NewPermitPool(physical.DefaultParallelOperations),
+		logger:             logger,
+		fsm:                fsm,
+		conf:               conf,
+		logStore:           log,
+		stableStore:        stable,
+		snapStore:          snap,
+		dataDir:            path,
+		localID:            localID,
+		permitPool:         physical.NewPermitPool(physical.DefaultParallelOperations),
+		autopilotConfig:    autopilotConfig,
+		autoSnapshotConfig: autoSnapshotConfig,
 	}, nil
 }
 
@@ -616,7 +649,9 @@ func (b *RaftBackend) GetConfiguration(ctx context.Context) (*RaftConfigurationR
 	return config, nil
 }
 
-// AddPeer adds a new server to the raft cluster
+// AddPeer adds a new server to the raft cluster. Unless the autopilot server
+// stabilization time is disabled, the server is added as a non-voter and is
+// promoted by autopilot once it is stable.
 func (b *RaftBackend) AddPeer(ctx context.Context, peerID, clusterAddr string) error {
 	b.l.RLock()
 	defer b.l.RUnlock()
@@ -627,6 +662,11 @@ func (b *RaftBackend) AddPeer(ctx context.Context, peerID, clusterAddr string) e
 
 	b.logger.Debug("adding raft peer", "node_id", peerID, "cluster_addr", clusterAddr)
 
+	if b.autopilotConfig.ServerStabilizationTime > 0 {
+		future := b.raft.AddNonvoter(raft.ServerID(peerID), raft.ServerAddress(clusterAddr), 0, 0)
+		return future.Error()
+	}
+
 	future := b.raft.AddVoter(raft.ServerID(peerID), raft.ServerAddress(clusterAddr), 0, 0)
 	return future.Error()
 }
@@ -667,15 +707,7 @@ func (b *RaftBackend) Snapshot(out *logical.HTTPResponseWriter, access *seal.Acc
 		return errors.New("raft storage backend is sealed")
 	}
 
-	// If we have access to the seal create a sealer object
-	var s snapshot.Sealer
-	if access != nil {
-		s = &sealer{
-			access: access,
-		}
-	}
-
-	snap, err := snapshot.NewWithSealer(b.logger.Named("snapshot"), b.raft, s)
+	snap, err := b.newSnapshot(access)
 	if err != nil {
 		return err
 	}
@@ -697,6 +729,41 @@ func (b *RaftBackend) Snapshot(out *logical.HTTPResponseWriter, access *seal.Acc
 	return nil
 }
 
+// SnapshotTo takes a raft snapshot, packages it into a archive file and writes
+// it to the provided writer. Seal access is used to encrypt the SHASUM file in
+// the same way as Snapshot.
+func (b *RaftBackend) SnapshotTo(out io.Writer, access *seal.Access) error {
+	b.l.RLock()
+	defer b.l.RUnlock()
+
+	if b.raft == nil {
+		return errors.New("raft storage backend is sealed")
+	}
+
+	snap, err := b.newSnapshot(access)
+	if err != nil {
+		return err
+	}
+	defer snap.Close()
+
+	_, err = io.Copy(out, snap)
+	return err
+}
+
+// newSnapshot takes a raft snapshot. The caller must hold the read lock and
+// close the snapshot.
+func (b *RaftBackend) newSnapshot(access *seal.Access) (*snapshot.Snapshot, error) {
+	// If we have access to the seal create a sealer object
+	var s snapshot.Sealer
+	if access != nil {
+		s = &sealer{
+			access: access,
+		}
+	}
+
+	return snapshot.NewWithSealer(b.logger.Named("snapshot"), b.raft, s)
+}
+
 // WriteSnapshotToTemp reads a snapshot archive off the provided reader,
 // extracts the data and writes the snapshot to a temporary file. The seal
 // access is used to decrypt the SHASUM file in the archive to ensure this
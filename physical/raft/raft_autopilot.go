@@ -0,0 +1,561 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/vault/sdk/helper/parseutil"
+)
+
+const (
+	// AutopilotStatusLeader is the status of the raft leader
+	AutopilotStatusLeader = "leader"
+
+	// AutopilotStatusVoter is the status of servers that have a vote
+	AutopilotStatusVoter = "voter"
+
+	// AutopilotStatusNonVoter is the status of servers that are staged for
+	// promotion
+	AutopilotStatusNonVoter = "non-voter"
+)
+
+var (
+	// autopilotInterval is how often autopilot reconciles the raft
+	// configuration. Making this a package var allows tests to modify it.
+	autopilotInterval = 10 * time.Second
+
+	defaultLastContactThreshold           = 10 * time.Second
+	defaultDeadServerLastContactThreshold = 24 * time.Hour
+	defaultMaxTrailingLogs                = uint64(1000)
+	defaultServerStabilizationTime        = 10 * time.Second
+)
+
+// FollowerState is the health information a follower reports to the active
+// node through its heartbeats.
+type FollowerState struct {
+	AppliedIndex  uint64
+	LastHeartbeat time.Time
+}
+
+// FollowerStates tracks the state of the followers of the raft cluster as seen
+// by the active node.
+type FollowerStates struct {
+	l         sync.RWMutex
+	followers map[string]*FollowerState
+}
+
+// NewFollowerStates creates an empty set of follower states
+func NewFollowerStates() *FollowerStates {
+	return &FollowerStates{
+		followers: make(map[string]*FollowerState),
+	}
+}
+
+// Update records a heartbeat from the given node
+func (s *FollowerStates) Update(nodeID string, appliedIndex uint64) {
+	s.l.Lock()
+	s.followers[nodeID] = &FollowerState{
+		AppliedIndex:  appliedIndex,
+		LastHeartbeat: time.Now(),
+	}
+	s.l.Unlock()
+}
+
+// Delete stops tracking the given node
+func (s *FollowerStates) Delete(nodeID string) {
+	s.l.Lock()
+	delete(s.followers, nodeID)
+	s.l.Unlock()
+}
+
+// Get returns a copy of the state of the given node, or nil if the node is not
+// tracked.
+func (s *FollowerStates) Get(nodeID string) *FollowerState {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	state, ok := s.followers[nodeID]
+	if !ok {
+		return nil
+	}
+	ret := *state
+	return &ret
+}
+
+// MinIndex returns the lowest applied index reported by the followers
+func (s *FollowerStates) MinIndex() uint64 {
+	var min uint64 = math.MaxUint64
+
+	s.l.RLock()
+	for _, state := range s.followers {
+		if state.AppliedIndex < min {
+			min = state.AppliedIndex
+		}
+	}
+	s.l.RUnlock()
+
+	if min == math.MaxUint64 {
+		return 0
+	}
+
+	return min
+}
+
+// AutopilotConfig holds the settings of the autopilot. They are read from the
+// raft storage configuration.
+type AutopilotConfig struct {
+	// CleanupDeadServers enables the removal of servers that stopped sending
+	// heartbeats for longer than DeadServerLastContactThreshold.
+	CleanupDeadServers bool
+
+	// LastContactThreshold is the maximum time since the last heartbeat of a
+	// server for it to be considered healthy.
+	LastContactThreshold time.Duration
+
+	// DeadServerLastContactThreshold is the time since the last heartbeat after
+	// which a server is considered dead and removed from the cluster.
+	DeadServerLastContactThreshold time.Duration
+
+	// MaxTrailingLogs is the maximum number of log entries a server can trail
+	// the leader by and still be considered healthy.
+	MaxTrailingLogs uint64
+
+	// MinQuorum is the minimum number of voters that autopilot will keep when
+	// removing dead servers.
+	MinQuorum int
+
+	// ServerStabilizationTime is how long a new server must be healthy before
+	// being promoted to a voter. A zero value disables staging and new
+	// servers are added as voters right away.
+	ServerStabilizationTime time.Duration
+}
+
+func parseAutopilotConfig(conf map[string]string) (*AutopilotConfig, error) {
+	config := &AutopilotConfig{
+		LastContactThreshold:           defaultLastContactThreshold,
+		DeadServerLastContactThreshold: defaultDeadServerLastContactThreshold,
+		MaxTrailingLogs:                defaultMaxTrailingLogs,
+		ServerStabilizationTime:        defaultServerStabilizationTime,
+	}
+
+	if raw, ok := conf["autopilot_cleanup_dead_servers"]; ok {
+		cleanup, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to parse autopilot_cleanup_dead_servers: {{err}}", err)
+		}
+		config.CleanupDeadServers = cleanup
+	}
+
+	durations := map[string]*time.Duration{
+		"autopilot_last_contact_threshold":             &config.LastContactThreshold,
+		"autopilot_dead_server_last_contact_threshold": &config.DeadServerLastContactThreshold,
+		"autopilot_server_stabilization_time":          &config.ServerStabilizationTime,
+	}
+	for key, d := range durations {
+		raw, ok := conf[key]
+		if !ok {
+			continue
+		}
+		parsed, err := parseutil.ParseDurationSecond(raw)
+		if err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("failed to parse %s: {{err}}", key), err)
+		}
+		if parsed < 0 {
+			return nil, fmt.Errorf("%s must not be negative", key)
+		}
+		*d = parsed
+	}
+
+	if raw, ok := conf["autopilot_max_trailing_logs"]; ok {
+		maxTrailingLogs, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to parse autopilot_max_trailing_logs: {{err}}", err)
+		}
+		config.MaxTrailingLogs = maxTrailingLogs
+	}
+
+	if raw, ok := conf["autopilot_min_quorum"]; ok {
+		minQuorum, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to parse autopilot_min_quorum: {{err}}", err)
+		}
+		if minQuorum < 0 {
+			return nil, errors.New("autopilot_min_quorum must not be negative")
+		}
+		config.MinQuorum = minQuorum
+	}
+
+	if config.LastContactThreshold == 0 {
+		return nil, errors.New("autopilot_last_contact_threshold must be positive")
+	}
+	if config.DeadServerLastContactThreshold < config.LastContactThreshold {
+		return nil, errors.New("autopilot_dead_server_last_contact_threshold must not be less than autopilot_last_contact_threshold")
+	}
+
+	return config, nil
+}
+
+// AutopilotServer is the state of a single server as seen by autopilot
+type AutopilotServer struct {
+	NodeID      string    `json:"node_id"`
+	Address     string    `json:"address"`
+	Status      string    `json:"status"`
+	Healthy     bool      `json:"healthy"`
+	LastContact string    `json:"last_contact"`
+	LastIndex   uint64    `json:"last_index"`
+	StableSince time.Time `json:"stable_since"`
+}
+
+// AutopilotState is the health of the raft cluster as seen by autopilot
+type AutopilotState struct {
+	// Healthy is true if all the servers are healthy
+	Healthy bool `json:"healthy"`
+
+	// FailureTolerance is the number of voters that can fail while keeping
+	// quorum
+	FailureTolerance int `json:"failure_tolerance"`
+
+	Leader  string             `json:"leader"`
+	Voters  []string           `json:"voters"`
+	Servers []*AutopilotServer `json:"servers"`
+}
+
+// autopilot periodically checks the health of the raft servers, promotes
+// healthy non-voters once they are stable and, if enabled, removes dead
+// servers.
+type autopilot struct {
+	logger         log.Logger
+	backend        *RaftBackend
+	config         *AutopilotConfig
+	followerStates *FollowerStates
+
+	l     sync.RWMutex
+	state *AutopilotState
+
+	// stableSince is the time since which each server has been continuously
+	// healthy
+	stableSince map[string]time.Time
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+
+	// now is used in tests to control time
+	now func() time.Time
+}
+
+// StartAutopilot starts the autopilot loop. It must only be called on the
+// active node, which receives the heartbeats recorded in followerStates.
+func (b *RaftBackend) StartAutopilot(followerStates *FollowerStates) {
+	b.autopilotLock.Lock()
+	defer b.autopilotLock.Unlock()
+
+	if b.autopilot != nil {
+		return
+	}
+
+	b.autopilot = &autopilot{
+		logger:         b.logger.Named("autopilot"),
+		backend:        b,
+		config:         b.autopilotConfig,
+		followerStates: followerStates,
+		stableSince:    make(map[string]time.Time),
+		stopCh:         make(chan struct{}),
+		doneCh:         make(chan struct{}),
+		now:            time.Now,
+	}
+	go b.autopilot.run()
+}
+
+// StopAutopilot stops the autopilot loop and waits for it to exit
+func (b *RaftBackend) StopAutopilot() {
+	b.autopilotLock.Lock()
+	a := b.autopilot
+	b.autopilot = nil
+	b.autopilotLock.Unlock()
+
+	if a == nil {
+		return
+	}
+	close(a.stopCh)
+	<-a.doneCh
+}
+
+// AutopilotState returns the latest state computed by autopilot
+func (b *RaftBackend) AutopilotState() (*AutopilotState, error) {
+	b.autopilotLock.Lock()
+	a := b.autopilot
+	b.autopilotLock.Unlock()
+
+	if a == nil {
+		return nil, errors.New("autopilot is not running")
+	}
+
+	a.l.RLock()
+	state := a.state
+	a.l.RUnlock()
+	if state != nil {
+		return state, nil
+	}
+
+	// The loop has not completed a run yet
+	return a.computeState()
+}
+
+func (a *autopilot) run() {
+	defer close(a.doneCh)
+
+	a.logger.Debug("starting autopilot")
+	ticker := time.NewTicker(autopilotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.stopCh:
+			a.logger.Debug("stopping autopilot")
+			return
+		case <-ticker.C:
+			if err := a.reconcile(); err != nil {
+				a.logger.Error("failed to reconcile raft configuration", "error", err)
+			}
+		}
+	}
+}
+
+// reconcile updates the autopilot state and applies the changes to the raft
+// configuration that it calls for.
+func (a *autopilot) reconcile() error {
+	state, err := a.computeState()
+	if err != nil {
+		return err
+	}
+
+	a.l.Lock()
+	a.state = state
+	a.l.Unlock()
+
+	metrics.SetGauge([]string{"raft", "autopilot", "healthy"}, boolToFloat(state.Healthy))
+	metrics.SetGauge([]string{"raft", "autopilot", "failure_tolerance"}, float32(state.FailureTolerance))
+
+	if err := a.promoteStableServers(state); err != nil {
+		return err
+	}
+	if a.config.CleanupDeadServers {
+		return a.removeDeadServers(state)
+	}
+	return nil
+}
+
+func (a *autopilot) computeState() (*AutopilotState, error) {
+	b := a.backend
+
+	b.l.RLock()
+	if b.raft == nil {
+		b.l.RUnlock()
+		return nil, errors.New("raft storage is not initialized")
+	}
+	future := b.raft.GetConfiguration()
+	lastIndex := b.raft.LastIndex()
+	b.l.RUnlock()
+
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+
+	now := a.now()
+	state := &AutopilotState{
+		Healthy: true,
+		Voters:  []string{},
+	}
+
+	a.l.Lock()
+	defer a.l.Unlock()
+
+	current := make(map[string]bool)
+	healthyVoters := 0
+	for _, server := range future.Configuration().Servers {
+		nodeID := string(server.ID)
+		current[nodeID] = true
+
+		s := &AutopilotServer{
+			NodeID:  nodeID,
+			Address: string(server.Address),
+			Status:  AutopilotStatusNonVoter,
+		}
+		if server.Suffrage == raft.Voter {
+			s.Status = AutopilotStatusVoter
+			state.Voters = append(state.Voters, nodeID)
+		}
+
+		if nodeID == b.NodeID() {
+			s.Status = AutopilotStatusLeader
+			s.Healthy = true
+			s.LastContact = "0s"
+			s.LastIndex = lastIndex
+			state.Leader = nodeID
+		} else if follower := a.followerStates.Get(nodeID); follower != nil {
+			lastContact := now.Sub(follower.LastHeartbeat)
+			s.LastContact = lastContact.Truncate(time.Millisecond).String()
+			s.LastIndex = follower.AppliedIndex
+			s.Healthy = lastContact <= a.config.LastContactThreshold &&
+				follower.AppliedIndex+a.config.MaxTrailingLogs >= lastIndex
+		}
+
+		if s.Healthy {
+			if _, ok := a.stableSince[nodeID]; !ok {
+				a.stableSince[nodeID] = now
+			}
+			s.StableSince = a.stableSince[nodeID]
+			if server.Suffrage == raft.Voter {
+				healthyVoters++
+			}
+		} else {
+			delete(a.stableSince, nodeID)
+			state.Healthy = false
+		}
+
+		state.Servers = append(state.Servers, s)
+	}
+
+	// Forget about servers that left the configuration
+	for nodeID := range a.stableSince {
+		if !current[nodeID] {
+			delete(a.stableSince, nodeID)
+		}
+	}
+
+	sort.Strings(state.Voters)
+	sort.Slice(state.Servers, func(i, j int) bool {
+		return state.Servers[i].NodeID < state.Servers[j].NodeID
+	})
+
+	if tolerance := healthyVoters - (len(state.Voters)/2 + 1); tolerance > 0 {
+		state.FailureTolerance = tolerance
+	}
+
+	return state, nil
+}
+
+// promoteStableServers promotes the non-voters that have been healthy for at
+// least the server stabilization time.
+func (a *autopilot) promoteStableServers(state *AutopilotState) error {
+	now := a.now()
+	for _, s := range state.Servers {
+		if s.Status != AutopilotStatusNonVoter || !s.Healthy {
+			continue
+		}
+		if now.Sub(s.StableSince) < a.config.ServerStabilizationTime {
+			continue
+		}
+
+		a.logger.Info("promoting server to voter", "node_id", s.NodeID)
+		if err := a.backend.addVoter(s.NodeID, s.Address); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("failed to promote server %q: {{err}}", s.NodeID), err)
+		}
+	}
+
+	return nil
+}
+
+// removeDeadServers removes the servers that have not sent a heartbeat for
+// longer than the dead server threshold. Voters are only removed while the
+// dead voters are a minority and the number of remaining voters does not drop
+// below the minimum quorum.
+func (a *autopilot) removeDeadServers(state *AutopilotState) error {
+	now := a.now()
+
+	var deadVoters, deadNonVoters []string
+	for _, s := range state.Servers {
+		if s.Status == AutopilotStatusLeader {
+			continue
+		}
+		follower := a.followerStates.Get(s.NodeID)
+		if follower == nil || now.Sub(follower.LastHeartbeat) < a.config.DeadServerLastContactThreshold {
+			continue
+		}
+		if s.Status == AutopilotStatusVoter {
+			deadVoters = append(deadVoters, s.NodeID)
+		} else {
+			deadNonVoters = append(deadNonVoters, s.NodeID)
+		}
+	}
+
+	for _, nodeID := range deadNonVoters {
+		if err := a.removeServer(nodeID); err != nil {
+			return err
+		}
+	}
+
+	if len(deadVoters) == 0 {
+		return nil
+	}
+
+	voters := len(state.Voters)
+	if len(deadVoters)*2 >= voters {
+		a.logger.Warn("not removing dead voters since they are not a minority of the voters", "dead_voters", deadVoters, "voters", voters)
+		return nil
+	}
+	for _, nodeID := range deadVoters {
+		if voters-1 < a.config.MinQuorum {
+			a.logger.Warn("not removing dead voter since it would take the number of voters below the minimum quorum", "node_id", nodeID, "min_quorum", a.config.MinQuorum)
+			return nil
+		}
+		if err := a.removeServer(nodeID); err != nil {
+			return err
+		}
+		voters--
+	}
+
+	return nil
+}
+
+func (a *autopilot) removeServer(nodeID string) error {
+	a.logger.Info("removing dead server", "node_id", nodeID)
+	if err := a.backend.removeServer(nodeID); err != nil {
+		return errwrap.Wrapf(fmt.Sprintf("failed to remove dead server %q: {{err}}", nodeID), err)
+	}
+	metrics.IncrCounter([]string{"raft", "autopilot", "dead_server_removed"}, 1)
+
+	a.followerStates.Delete(nodeID)
+	a.l.Lock()
+	delete(a.stableSince, nodeID)
+	a.l.Unlock()
+	return nil
+}
+
+func (b *RaftBackend) addVoter(nodeID, address string) error {
+	b.l.RLock()
+	defer b.l.RUnlock()
+
+	if b.raft == nil {
+		return errors.New("raft storage is not initialized")
+	}
+
+	return b.raft.AddVoter(raft.ServerID(nodeID), raft.ServerAddress(address), 0, 0).Error()
+}
+
+func (b *RaftBackend) removeServer(nodeID string) error {
+	b.l.RLock()
+	defer b.l.RUnlock()
+
+	if b.raft == nil {
+		return errors.New("raft storage is not initialized")
+	}
+
+	return b.raft.RemoveServer(raft.ServerID(nodeID), 0, 0).Error()
+}
+
+func boolToFloat(b bool) float32 {
+	if b {
+		return 1
+	}
+	return 0
+}
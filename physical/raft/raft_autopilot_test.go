@@ -0,0 +1,181 @@
+package raft
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestRaft_AutopilotConfig(t *testing.T) {
+	config, err := parseAutopilotConfig(map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.CleanupDeadServers || config.ServerStabilizationTime != defaultServerStabilizationTime || config.MaxTrailingLogs != defaultMaxTrailingLogs {
+		t.Fatalf("bad default config: %#v", config)
+	}
+
+	config, err = parseAutopilotConfig(map[string]string{
+		"autopilot_cleanup_dead_servers":               "true",
+		"autopilot_last_contact_threshold":             "5s",
+		"autopilot_dead_server_last_contact_threshold": "1h",
+		"autopilot_server_stabilization_time":          "0",
+		"autopilot_max_trailing_logs":                  "250",
+		"autopilot_min_quorum":                         "3",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &AutopilotConfig{
+		CleanupDeadServers:             true,
+		LastContactThreshold:           5 * time.Second,
+		DeadServerLastContactThreshold: time.Hour,
+		MaxTrailingLogs:                250,
+		MinQuorum:                      3,
+	}
+	if *config != *expected {
+		t.Fatalf("bad config: expected %#v, got %#v", expected, config)
+	}
+
+	for _, conf := range []map[string]string{
+		{"autopilot_cleanup_dead_servers": "sure"},
+		{"autopilot_last_contact_threshold": "0"},
+		{"autopilot_last_contact_threshold": "1h", "autopilot_dead_server_last_contact_threshold": "1m"},
+		{"autopilot_min_quorum": "-1"},
+	} {
+		if _, err := parseAutopilotConfig(conf); err == nil {
+			t.Fatalf("expected error parsing %v", conf)
+		}
+	}
+}
+
+func TestRaft_Autopilot(t *testing.T) {
+	raft1, dir := getRaft(t, true, true)
+	raft2, dir2 := getRaft(t, false, true)
+	raft3, dir3 := getRaft(t, false, true)
+	defer os.RemoveAll(dir)
+	defer os.RemoveAll(dir2)
+	defer os.RemoveAll(dir3)
+
+	raft1.autopilotConfig = &AutopilotConfig{
+		CleanupDeadServers:             true,
+		LastContactThreshold:           10 * time.Second,
+		DeadServerLastContactThreshold: time.Minute,
+		MaxTrailingLogs:                defaultMaxTrailingLogs,
+		ServerStabilizationTime:        10 * time.Second,
+	}
+
+	// New peers are staged as non-voters
+	addPeer(t, raft1, raft2)
+	addPeer(t, raft1, raft3)
+	assertVoters(t, raft1, map[string]bool{raft1.NodeID(): true, raft2.NodeID(): false, raft3.NodeID(): false})
+
+	now := time.Now()
+	followerStates := NewFollowerStates()
+	heartbeat := func(nodes ...*RaftBackend) {
+		for _, node := range nodes {
+			followerStates.followers[node.NodeID()] = &FollowerState{
+				AppliedIndex:  raft1.AppliedIndex(),
+				LastHeartbeat: now,
+			}
+		}
+	}
+
+	a := &autopilot{
+		logger:         hclog.NewNullLogger(),
+		backend:        raft1,
+		config:         raft1.autopilotConfig,
+		followerStates: followerStates,
+		stableSince:    make(map[string]time.Time),
+		now:            func() time.Time { return now },
+	}
+
+	heartbeat(raft2, raft3)
+	if err := a.reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	if !a.state.Healthy || len(a.state.Voters) != 1 || a.state.FailureTolerance != 0 {
+		t.Fatalf("bad state: %#v", a.state)
+	}
+	assertVoters(t, raft1, map[string]bool{raft1.NodeID(): true, raft2.NodeID(): false, raft3.NodeID(): false})
+
+	// Healthy peers are promoted once stable
+	now = now.Add(11 * time.Second)
+	heartbeat(raft2, raft3)
+	if err := a.reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	assertVoters(t, raft1, map[string]bool{raft1.NodeID(): true, raft2.NodeID(): true, raft3.NodeID(): true})
+
+	heartbeat(raft2, raft3)
+	if err := a.reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	if !a.state.Healthy || len(a.state.Voters) != 3 || a.state.FailureTolerance != 1 {
+		t.Fatalf("bad state: %#v", a.state)
+	}
+
+	// A server that stopped sending heartbeats is first reported as unhealthy
+	// and then removed once dead
+	now = now.Add(30 * time.Second)
+	heartbeat(raft2)
+	if err := a.reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	if a.state.Healthy || a.state.FailureTolerance != 0 {
+		t.Fatalf("bad state: %#v", a.state)
+	}
+	assertVoters(t, raft1, map[string]bool{raft1.NodeID(): true, raft2.NodeID(): true, raft3.NodeID(): true})
+
+	now = now.Add(time.Minute)
+	heartbeat(raft2)
+	if err := a.reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	assertVoters(t, raft1, map[string]bool{raft1.NodeID(): true, raft2.NodeID(): true})
+
+	// Dead voters are not removed when they are not a minority
+	now = now.Add(2 * time.Minute)
+	if err := a.reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	assertVoters(t, raft1, map[string]bool{raft1.NodeID(): true, raft2.NodeID(): true})
+
+	// The state is exposed while autopilot is running
+	if _, err := raft1.AutopilotState(); err == nil {
+		t.Fatal("expected error reading the state without autopilot running")
+	}
+	raft1.StartAutopilot(followerStates)
+	state, err := raft1.AutopilotState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Leader != raft1.NodeID() || len(state.Servers) != 2 {
+		t.Fatalf("bad state: %#v", state)
+	}
+	raft1.StopAutopilot()
+}
+
+func assertVoters(t *testing.T, b *RaftBackend, expected map[string]bool) {
+	t.Helper()
+
+	config, err := b.GetConfiguration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Servers) != len(expected) {
+		t.Fatalf("expected %d servers, got %d", len(expected), len(config.Servers))
+	}
+	for _, server := range config.Servers {
+		voter, ok := expected[server.NodeID]
+		if !ok {
+			t.Fatalf("unexpected server %q", server.NodeID)
+		}
+		if server.Voter != voter {
+			t.Fatalf("expected voter to be %t for server %q", voter, server.NodeID)
+		}
+	}
+}
@@ -0,0 +1,405 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/helper/parseutil"
+	"github.com/hashicorp/vault/vault/seal"
+)
+
+const (
+	autoSnapshotPrefix = "vault-raft-snapshot-"
+	autoSnapshotSuffix = ".snap"
+
+	// autoSnapshotTimeFormat sorts lexically in chronological order
+	autoSnapshotTimeFormat = "20060102T150405.000Z"
+
+	defaultAutoSnapshotRetain = 3
+)
+
+// SnapshotDestination is where automated snapshots are written to. The local
+// file system destination is used by default.
+type SnapshotDestination interface {
+	// String describes the destination in the status and logs
+	String() string
+
+	// Save stores the snapshot read from r under the given name
+	Save(ctx context.Context, name string, r io.Reader) error
+
+	// List returns the names of the stored snapshots
+	List(ctx context.Context) ([]string, error)
+
+	// Delete removes the snapshot with the given name
+	Delete(ctx context.Context, name string) error
+}
+
+// LocalSnapshotDestination writes snapshots to a directory on the local file
+// system.
+type LocalSnapshotDestination struct {
+	Path string
+}
+
+// NewLocalSnapshotDestination creates a destination writing to the given
+// directory, creating it if needed.
+func NewLocalSnapshotDestination(path string) (*LocalSnapshotDestination, error) {
+	if path == "" {
+		return nil, errors.New("no snapshot path provided")
+	}
+	if err := EnsurePath(path, true); err != nil {
+		return nil, err
+	}
+	return &LocalSnapshotDestination{
+		Path: path,
+	}, nil
+}
+
+func (d *LocalSnapshotDestination) String() string {
+	return "file://" + d.Path
+}
+
+// Save writes the snapshot to a temporary file first so that partial
+// snapshots are never left under the final name.
+func (d *LocalSnapshotDestination) Save(ctx context.Context, name string, r io.Reader) error {
+	f, err := ioutil.TempFile(d.Path, name+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(d.Path, name))
+}
+
+// List returns the names of the automated snapshots in the directory
+func (d *LocalSnapshotDestination) List(ctx context.Context) ([]string, error) {
+	files, err := ioutil.ReadDir(d.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if isAutoSnapshotName(file.Name()) {
+			names = append(names, file.Name())
+		}
+	}
+	return names, nil
+}
+
+// Delete removes the given snapshot file
+func (d *LocalSnapshotDestination) Delete(ctx context.Context, name string) error {
+	return os.Remove(filepath.Join(d.Path, filepath.Base(name)))
+}
+
+func isAutoSnapshotName(name string) bool {
+	return strings.HasPrefix(name, autoSnapshotPrefix) && strings.HasSuffix(name, autoSnapshotSuffix)
+}
+
+// AutoSnapshotConfig holds the settings of the automated snapshots. They are
+// read from the raft storage configuration.
+type AutoSnapshotConfig struct {
+	// Interval is how often a snapshot is taken. A zero value disables
+	// automated snapshots.
+	Interval time.Duration
+
+	// Path is the local directory the snapshots are written to
+	Path string
+
+	// Retain is the number of most recent snapshots kept
+	Retain int
+}
+
+func parseAutoSnapshotConfig(conf map[string]string) (*AutoSnapshotConfig, error) {
+	config := &AutoSnapshotConfig{
+		Path:   conf["auto_snapshot_path"],
+		Retain: defaultAutoSnapshotRetain,
+	}
+
+	if raw, ok := conf["auto_snapshot_interval"]; ok {
+		interval, err := parseutil.ParseDurationSecond(raw)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to parse auto_snapshot_interval: {{err}}", err)
+		}
+		if interval < 0 {
+			return nil, errors.New("auto_snapshot_interval must not be negative")
+		}
+		config.Interval = interval
+	}
+
+	if raw, ok := conf["auto_snapshot_retain"]; ok {
+		retain, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to parse auto_snapshot_retain: {{err}}", err)
+		}
+		if retain < 1 {
+			return nil, errors.New("auto_snapshot_retain must be at least 1")
+		}
+		config.Retain = retain
+	}
+
+	if config.Interval > 0 && config.Path == "" {
+		return nil, errors.New("auto_snapshot_path must be set when auto_snapshot_interval is set")
+	}
+
+	return config, nil
+}
+
+// AutoSnapshotStatus reports the outcome of the automated snapshots
+type AutoSnapshotStatus struct {
+	Enabled             bool      `json:"enabled"`
+	Running             bool      `json:"running"`
+	Interval            string    `json:"interval"`
+	Retain              int       `json:"retain"`
+	Destination         string    `json:"destination"`
+	LastSnapshot        string    `json:"last_snapshot"`
+	LastSuccess         time.Time `json:"last_success"`
+	LastFailure         time.Time `json:"last_failure"`
+	LastError           string    `json:"last_error"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+}
+
+// autoSnapshotter periodically writes snapshots to a destination and prunes
+// the old ones.
+type autoSnapshotter struct {
+	logger      log.Logger
+	backend     *RaftBackend
+	config      *AutoSnapshotConfig
+	destination SnapshotDestination
+	access      *seal.Access
+
+	l      sync.RWMutex
+	status AutoSnapshotStatus
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+
+	// now is used in tests to control time
+	now func() time.Time
+}
+
+// SetSnapshotDestination overrides the destination of the automated
+// snapshots, which is the configured local path by default.
+func (b *RaftBackend) SetSnapshotDestination(destination SnapshotDestination) {
+	b.autoSnapshotLock.Lock()
+	b.snapshotDestination = destination
+	b.autoSnapshotLock.Unlock()
+}
+
+// StartAutoSnapshots starts taking snapshots on the configured interval. It is
+// a no-op if automated snapshots are not configured. It must only be called on
+// the active node.
+func (b *RaftBackend) StartAutoSnapshots(access *seal.Access) error {
+	b.autoSnapshotLock.Lock()
+	defer b.autoSnapshotLock.Unlock()
+
+	if b.autoSnapshotConfig.Interval == 0 || b.autoSnapshotter != nil {
+		return nil
+	}
+
+	destination := b.snapshotDestination
+	if destination == nil {
+		local, err := NewLocalSnapshotDestination(b.autoSnapshotConfig.Path)
+		if err != nil {
+			err = errwrap.Wrapf("failed to set up the snapshot destination: {{err}}", err)
+			b.autoSnapshotStatus.LastFailure = time.Now()
+			b.autoSnapshotStatus.LastError = err.Error()
+			return err
+		}
+		destination = local
+	}
+
+	b.autoSnapshotter = &autoSnapshotter{
+		logger:      b.logger.Named("auto-snapshot"),
+		backend:     b,
+		config:      b.autoSnapshotConfig,
+		destination: destination,
+		access:      access,
+		status:      b.autoSnapshotStatus,
+		stopCh:      make(chan struct{}),
+		doneCh:      make(chan struct{}),
+		now:         time.Now,
+	}
+	b.autoSnapshotter.status.Destination = destination.String()
+	go b.autoSnapshotter.run()
+
+	return nil
+}
+
+// StopAutoSnapshots stops taking snapshots and waits for any snapshot in
+// progress to complete.
+func (b *RaftBackend) StopAutoSnapshots() {
+	b.autoSnapshotLock.Lock()
+	s := b.autoSnapshotter
+	b.autoSnapshotter = nil
+	b.autoSnapshotLock.Unlock()
+
+	if s == nil {
+		return
+	}
+	close(s.stopCh)
+	<-s.doneCh
+
+	// Keep the outcome of the last run for when this node becomes active
+	// again
+	b.autoSnapshotLock.Lock()
+	b.autoSnapshotStatus = s.getStatus()
+	b.autoSnapshotLock.Unlock()
+}
+
+// AutoSnapshotStatus returns the status of the automated snapshots
+func (b *RaftBackend) AutoSnapshotStatus() *AutoSnapshotStatus {
+	b.autoSnapshotLock.Lock()
+	s := b.autoSnapshotter
+	status := b.autoSnapshotStatus
+	b.autoSnapshotLock.Unlock()
+
+	if s != nil {
+		status = s.getStatus()
+		status.Running = true
+	}
+
+	config := b.autoSnapshotConfig
+	status.Enabled = config.Interval > 0
+	if status.Enabled {
+		status.Interval = config.Interval.String()
+		status.Retain = config.Retain
+	}
+	return &status
+}
+
+func (s *autoSnapshotter) getStatus() AutoSnapshotStatus {
+	s.l.RLock()
+	defer s.l.RUnlock()
+	return s.status
+}
+
+func (s *autoSnapshotter) run() {
+	defer close(s.doneCh)
+
+	s.logger.Debug("starting automated snapshots", "interval", s.config.Interval, "destination", s.destination.String())
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			s.logger.Debug("stopping automated snapshots")
+			return
+		case <-ticker.C:
+			s.snapshot(context.Background())
+		}
+	}
+}
+
+// snapshot writes a snapshot to the destination, prunes the old snapshots and
+// records the outcome.
+func (s *autoSnapshotter) snapshot(ctx context.Context) {
+	defer metrics.MeasureSince([]string{"raft", "auto_snapshot", "duration"}, time.Now())
+
+	name, err := s.save(ctx)
+	if err == nil {
+		err = s.prune(ctx)
+	}
+
+	now := s.now()
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if err != nil {
+		s.logger.Error("failed to take automated snapshot", "error", err)
+		metrics.IncrCounter([]string{"raft", "auto_snapshot", "failure"}, 1)
+		s.status.LastFailure = now
+		s.status.LastError = err.Error()
+		s.status.ConsecutiveFailures++
+		return
+	}
+
+	s.logger.Info("automated snapshot saved", "name", name)
+	metrics.IncrCounter([]string{"raft", "auto_snapshot", "success"}, 1)
+	metrics.SetGauge([]string{"raft", "auto_snapshot", "last_success"}, float32(now.Unix()))
+	s.status.LastSnapshot = name
+	s.status.LastSuccess = now
+	s.status.ConsecutiveFailures = 0
+}
+
+func (s *autoSnapshotter) save(ctx context.Context) (string, error) {
+	name := autoSnapshotPrefix + s.now().UTC().Format(autoSnapshotTimeFormat) + autoSnapshotSuffix
+
+	pr, pw := io.Pipe()
+	snapErrCh := make(chan error, 1)
+	go func() {
+		err := s.backend.SnapshotTo(pw, s.access)
+		pw.CloseWithError(err)
+		snapErrCh <- err
+	}()
+
+	err := s.destination.Save(ctx, name, pr)
+	// Unblock the snapshot writer if the destination stopped reading early
+	pr.CloseWithError(err)
+	snapErr := <-snapErrCh
+	if err != nil {
+		return "", errwrap.Wrapf(fmt.Sprintf("failed to save snapshot %q: {{err}}", name), err)
+	}
+	if snapErr != nil {
+		return "", errwrap.Wrapf(fmt.Sprintf("failed to take snapshot %q: {{err}}", name), snapErr)
+	}
+
+	return name, nil
+}
+
+// prune deletes the oldest snapshots beyond the number to retain
+func (s *autoSnapshotter) prune(ctx context.Context) error {
+	names, err := s.destination.List(ctx)
+	if err != nil {
+		return errwrap.Wrapf("failed to list snapshots: {{err}}", err)
+	}
+
+	var snapshots []string
+	for _, name := range names {
+		if isAutoSnapshotName(name) {
+			snapshots = append(snapshots, name)
+		}
+	}
+	if len(snapshots) <= s.config.Retain {
+		return nil
+	}
+
+	sort.Strings(snapshots)
+	for _, name := range snapshots[:len(snapshots)-s.config.Retain] {
+		s.logger.Debug("deleting old snapshot", "name", name)
+		if err := s.destination.Delete(ctx, name); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("failed to delete snapshot %q: {{err}}", name), err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/physical"
+)
+
+type failingSnapshotDestination struct{}
+
+func (failingSnapshotDestination) String() string { return "failing" }
+
+func (failingSnapshotDestination) Save(ctx context.Context, name string, r io.Reader) error {
+	return errors.New("destination unavailable")
+}
+
+func (failingSnapshotDestination) List(ctx context.Context) ([]string, error) { return nil, nil }
+
+func (failingSnapshotDestination) Delete(ctx context.Context, name string) error { return nil }
+
+func TestRaft_AutoSnapshotConfig(t *testing.T) {
+	config, err := parseAutoSnapshotConfig(map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Interval != 0 || config.Retain != defaultAutoSnapshotRetain {
+		t.Fatalf("bad default config: %#v", config)
+	}
+
+	config, err = parseAutoSnapshotConfig(map[string]string{
+		"auto_snapshot_interval": "1h",
+		"auto_snapshot_path":     "/tmp/snapshots",
+		"auto_snapshot_retain":   "5",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Interval != time.Hour || config.Path != "/tmp/snapshots" || config.Retain != 5 {
+		t.Fatalf("bad config: %#v", config)
+	}
+
+	for _, conf := range []map[string]string{
+		{"auto_snapshot_interval": "1h"},
+		{"auto_snapshot_interval": "-1h", "auto_snapshot_path": "/tmp"},
+		{"auto_snapshot_retain": "0"},
+	} {
+		if _, err := parseAutoSnapshotConfig(conf); err == nil {
+			t.Fatalf("expected error parsing %v", conf)
+		}
+	}
+}
+
+func TestRaft_AutoSnapshot(t *testing.T) {
+	raft1, dir := getRaft(t, true, false)
+	defer os.RemoveAll(dir)
+
+	for i := 0; i < 10; i++ {
+		if err := raft1.Put(context.Background(), &physical.Entry{
+			Key:   fmt.Sprintf("key-%d", i),
+			Value: []byte(fmt.Sprintf("value-%d", i)),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapDir, err := ioutil.TempDir("", "vault-raft-snapshots-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(snapDir)
+
+	destination, err := NewLocalSnapshotDestination(snapDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files that are not automated snapshots are left alone
+	if err := ioutil.WriteFile(filepath.Join(snapDir, "manual.snap"), []byte("manual"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	s := &autoSnapshotter{
+		logger:      hclog.NewNullLogger(),
+		backend:     raft1,
+		config:      &AutoSnapshotConfig{Interval: time.Minute, Path: snapDir, Retain: 2},
+		destination: destination,
+		now:         func() time.Time { return now },
+	}
+
+	var names []string
+	for i := 0; i < 3; i++ {
+		s.snapshot(context.Background())
+		status := s.getStatus()
+		if status.LastError != "" || status.LastSnapshot == "" || !status.LastSuccess.Equal(now) {
+			t.Fatalf("bad status: %#v", status)
+		}
+		names = append(names, status.LastSnapshot)
+		now = now.Add(time.Minute)
+	}
+
+	stored, err := destination.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 || stored[0] != names[1] || stored[1] != names[2] {
+		t.Fatalf("expected the two most recent snapshots %v, got %v", names[1:], stored)
+	}
+	info, err := os.Stat(filepath.Join(snapDir, names[2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() == 0 {
+		t.Fatal("expected non empty snapshot")
+	}
+	if _, err := os.Stat(filepath.Join(snapDir, "manual.snap")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failures are recorded without losing the last success
+	s.destination = failingSnapshotDestination{}
+	s.snapshot(context.Background())
+	s.snapshot(context.Background())
+	status := s.getStatus()
+	if status.ConsecutiveFailures != 2 || status.LastError == "" || status.LastSnapshot != names[2] {
+		t.Fatalf("bad status: %#v", status)
+	}
+}
+
+func TestRaft_AutoSnapshot_StartStop(t *testing.T) {
+	raft1, dir := getRaft(t, true, false)
+	defer os.RemoveAll(dir)
+
+	snapDir, err := ioutil.TempDir("", "vault-raft-snapshots-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(snapDir)
+
+	if status := raft1.AutoSnapshotStatus(); status.Enabled || status.Running {
+		t.Fatalf("bad status: %#v", status)
+	}
+
+	raft1.autoSnapshotConfig = &AutoSnapshotConfig{
+		Interval: 100 * time.Millisecond,
+		Path:     snapDir,
+		Retain:   1,
+	}
+	if err := raft1.StartAutoSnapshots(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for raft1.AutoSnapshotStatus().LastSnapshot == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for an automated snapshot")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	status := raft1.AutoSnapshotStatus()
+	if !status.Enabled || !status.Running || status.Destination != "file://"+snapDir {
+		t.Fatalf("bad status: %#v", status)
+	}
+
+	raft1.StopAutoSnapshots()
+	status = raft1.AutoSnapshotStatus()
+	if status.Running || status.LastSnapshot == "" {
+		t.Fatalf("bad status after stopping: %#v", status)
+	}
+
+	files, err := ioutil.ReadDir(snapDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected a single retained snapshot, got %d files", len(files))
+	}
+}
@@ -607,6 +607,8 @@ func (t FieldType) Zero() interface{} {
 		return ""
 	case TypeInt:
 		return 0
+	case TypeFloat:
+		return 0.0
 	case TypeBool:
 		return false
 	case TypeMap:
@@ -121,6 +121,28 @@ func TestFieldDataGet(t *testing.T) {
 			42,
 		},
 
+		"float type, float value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeFloat},
+			},
+			map[string]interface{}{
+				"foo": 0.5,
+			},
+			"foo",
+			0.5,
+		},
+
+		"float type, string value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeFloat},
+			},
+			map[string]interface{}{
+				"foo": "2.5",
+			},
+			"foo",
+			2.5,
+		},
+
 		"bool type, bool value": {
 			map[string]*FieldSchema{
 				"foo": &FieldSchema{Type: TypeBool},
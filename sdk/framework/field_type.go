@@ -53,6 +53,9 @@ const (
 	// benevolent MITM for a request, and the headers are sent through and
 	// parsed.
 	TypeHeader
+
+	// TypeFloat parses both float32 and float64 values
+	TypeFloat
 )
 
 func (t FieldType) String() string {
@@ -65,6 +68,8 @@ func (t FieldType) String() string {
 		return "name string"
 	case TypeInt:
 		return "int"
+	case TypeFloat:
+		return "float"
 	case TypeBool:
 		return "bool"
 	case TypeMap:
@@ -552,6 +552,9 @@ func convertType(t FieldType) schemaType {
 		ret.format = "lowercase"
 	case TypeInt:
 		ret.baseType = "integer"
+	case TypeFloat:
+		ret.baseType = "number"
+		ret.format = "float"
 	case TypeDurationSecond, TypeSignedDurationSecond:
 		ret.baseType = "integer"
 		ret.format = "seconds"
@@ -16,6 +16,10 @@ const (
 	// SSRF protection.
 	RequestHeaderName = "X-Vault-Request"
 
+	// StreamErrorTrailerName is the name of the trailer reporting an error
+	// that occurred after a streamed response started.
+	StreamErrorTrailerName = "X-Vault-Stream-Error"
+
 	// PerformanceReplicationALPN is the negotiated protocol used for
 	// performance replication.
 	PerformanceReplicationALPN = "replication_v1"
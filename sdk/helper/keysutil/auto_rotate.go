@@ -0,0 +1,135 @@
+package keysutil
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// recordEncryption counts an encryption performed with the given version if
+// the policy has a usage limit, and flags the policy for rotation once the
+// latest version reached it. It only needs the policy to be read locked; the
+// counts are persisted along with the policy, so the counts of encryptions
+// performed since the policy was last persisted are lost if the node stops,
+// making the limit approximate.
+func (p *Policy) recordEncryption(ver int) {
+	if p.MaxEncryptionsPerVersion <= 0 {
+		return
+	}
+
+	pending := p.addPendingEncryptions(ver, 1)
+
+	if ver == p.LatestVersion && p.Keys[strconv.Itoa(ver)].EncryptionCount+pending >= p.MaxEncryptionsPerVersion {
+		atomic.StoreUint32(&p.rotationPending, 1)
+	}
+}
+
+func (p *Policy) addPendingEncryptions(ver int, n int64) int64 {
+	atomic.StoreUint32(&p.encryptionsCounted, 1)
+	raw, _ := p.pendingEncryptions.LoadOrStore(ver, new(int64))
+	return atomic.AddInt64(raw.(*int64), n)
+}
+
+// flushPendingEncryptions moves the counts of encryptions that have not been
+// persisted yet into the key entries. The policy must be write locked.
+func (p *Policy) flushPendingEncryptions() {
+	if atomic.LoadUint32(&p.encryptionsCounted) == 0 {
+		return
+	}
+	p.pendingEncryptions.Range(func(k, v interface{}) bool {
+		n := atomic.SwapInt64(v.(*int64), 0)
+		if n == 0 {
+			return true
+		}
+		key := strconv.Itoa(k.(int))
+		if entry, ok := p.Keys[key]; ok {
+			entry.EncryptionCount += n
+			p.Keys[key] = entry
+		}
+		return true
+	})
+}
+
+// HasPendingEncryptions returns whether encryptions were counted since the
+// policy was last persisted.
+func (p *Policy) HasPendingEncryptions() bool {
+	if atomic.LoadUint32(&p.encryptionsCounted) == 0 {
+		return false
+	}
+	pending := false
+	p.pendingEncryptions.Range(func(_, v interface{}) bool {
+		pending = atomic.LoadInt64(v.(*int64)) != 0
+		return !pending
+	})
+	return pending
+}
+
+// MergePendingEncryptions adds the encryptions counted on another instance of
+// the same policy that have not been persisted yet. This is used when the
+// policy cache is disabled, as each request then loads its own instance.
+func (p *Policy) MergePendingEncryptions(other *Policy) {
+	if atomic.LoadUint32(&other.encryptionsCounted) == 0 {
+		return
+	}
+	other.pendingEncryptions.Range(func(k, v interface{}) bool {
+		if n := atomic.SwapInt64(v.(*int64), 0); n != 0 {
+			p.addPendingEncryptions(k.(int), n)
+		}
+		return true
+	})
+}
+
+// EncryptionCount returns the number of encryptions performed with the given
+// version, including the ones that have not been persisted yet.
+func (p *Policy) EncryptionCount(ver int) int64 {
+	count := p.Keys[strconv.Itoa(ver)].EncryptionCount
+	if atomic.LoadUint32(&p.encryptionsCounted) == 0 {
+		return count
+	}
+	if raw, ok := p.pendingEncryptions.Load(ver); ok {
+		count += atomic.LoadInt64(raw.(*int64))
+	}
+	return count
+}
+
+// AutoRotationPending returns whether the latest version reached the usage
+// limit of the policy. It does not require the policy to be locked, so that
+// callers can check it before locking the policy to rotate it.
+func (p *Policy) AutoRotationPending() bool {
+	return atomic.LoadUint32(&p.rotationPending) == 1
+}
+
+// LastRotationTime returns the creation time of the latest version.
+func (p *Policy) LastRotationTime() time.Time {
+	entry := p.Keys[strconv.Itoa(p.LatestVersion)]
+	if entry.CreationTime.IsZero() {
+		return time.Unix(entry.DeprecatedCreationTime, 0)
+	}
+	return entry.CreationTime
+}
+
+// NextAutoRotation returns the time at which the latest version is due for
+// automatic rotation, or the zero time if it is not rotated periodically.
+func (p *Policy) NextAutoRotation() time.Time {
+	if p.AutoRotatePeriod <= 0 || !p.autoRotationSupported() {
+		return time.Time{}
+	}
+	return p.LastRotationTime().Add(p.AutoRotatePeriod)
+}
+
+// NeedsAutoRotation returns whether the latest version is due for rotation,
+// either because it is older than the auto rotate period or because it
+// reached the usage limit.
+func (p *Policy) NeedsAutoRotation(now time.Time) bool {
+	if !p.autoRotationSupported() {
+		return false
+	}
+	if next := p.NextAutoRotation(); !next.IsZero() && !now.Before(next) {
+		return true
+	}
+	return p.MaxEncryptionsPerVersion > 0 && p.EncryptionCount(p.LatestVersion) >= p.MaxEncryptionsPerVersion
+}
+
+func (p *Policy) autoRotationSupported() bool {
+	return !p.Imported || p.AllowImportedKeyRotation
+}
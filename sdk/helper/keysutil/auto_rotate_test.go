@@ -0,0 +1,120 @@
+package keysutil
+
+import (
+	"context"
+	"crypto/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func Test_AutoRotate(t *testing.T) {
+	ctx := context.Background()
+	storage := &logical.InmemStorage{}
+	lm, _ := NewLockManager(true, 0)
+
+	p, _, err := lm.GetPolicy(ctx, PolicyRequest{
+		Upsert:  true,
+		Storage: storage,
+		KeyType: KeyType_AES256_GCM96,
+		Name:    "test",
+	}, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if p.NeedsAutoRotation(now) || !p.NextAutoRotation().IsZero() {
+		t.Fatal("expected no automatic rotation without a period or a limit")
+	}
+
+	// Encryptions are only counted with a usage limit
+	if _, err := p.Encrypt(0, nil, nil, "dGhlIHF1aWNrIGJyb3duIGZveA=="); err != nil {
+		t.Fatal(err)
+	}
+	if p.EncryptionCount(1) != 0 || p.HasPendingEncryptions() {
+		t.Fatalf("unexpected encryption count %d", p.EncryptionCount(1))
+	}
+
+	p.MaxEncryptionsPerVersion = 3
+	for i := 0; i < 2; i++ {
+		if _, err := p.Encrypt(0, nil, nil, "dGhlIHF1aWNrIGJyb3duIGZveA=="); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.EncryptionCount(1) != 2 || !p.HasPendingEncryptions() || p.AutoRotationPending() || p.NeedsAutoRotation(now) {
+		t.Fatalf("bad state after 2 encryptions: count %d", p.EncryptionCount(1))
+	}
+
+	// Counts are persisted with the policy
+	if err := p.Persist(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	if p.HasPendingEncryptions() || p.Keys["1"].EncryptionCount != 2 {
+		t.Fatalf("counts not flushed: %d", p.Keys["1"].EncryptionCount)
+	}
+	loaded, err := LoadPolicy(ctx, storage, "policy/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.EncryptionCount(1) != 2 {
+		t.Fatalf("bad persisted count %d", loaded.EncryptionCount(1))
+	}
+
+	// Counts of another instance of the policy can be merged
+	if _, err := loaded.Encrypt(0, nil, nil, "dGhlIHF1aWNrIGJyb3duIGZveA=="); err != nil {
+		t.Fatal(err)
+	}
+	p.MergePendingEncryptions(loaded)
+	if p.EncryptionCount(1) != 3 || loaded.HasPendingEncryptions() {
+		t.Fatalf("bad count after merge: %d", p.EncryptionCount(1))
+	}
+	if !p.NeedsAutoRotation(now) {
+		t.Fatal("expected rotation to be needed once the limit is reached")
+	}
+
+	// Reaching the limit while encrypting flags the policy, until rotation
+	if _, err := p.Encrypt(0, nil, nil, "dGhlIHF1aWNrIGJyb3duIGZveA=="); err != nil {
+		t.Fatal(err)
+	}
+	if !p.AutoRotationPending() {
+		t.Fatal("expected rotation to be pending")
+	}
+	if err := p.Rotate(ctx, storage, rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if p.AutoRotationPending() || p.NeedsAutoRotation(now) || p.EncryptionCount(2) != 0 || p.Keys["1"].EncryptionCount != 4 {
+		t.Fatalf("bad state after rotation: %d %d", p.EncryptionCount(2), p.Keys["1"].EncryptionCount)
+	}
+
+	// Rotation is also due once the latest version is older than the period
+	p.AutoRotatePeriod = time.Hour
+	last := p.LastRotationTime()
+	if !p.NextAutoRotation().Equal(last.Add(time.Hour)) {
+		t.Fatalf("bad next rotation %v", p.NextAutoRotation())
+	}
+	if p.NeedsAutoRotation(last.Add(59*time.Minute)) || !p.NeedsAutoRotation(last.Add(time.Hour)) {
+		t.Fatal("bad rotation schedule")
+	}
+
+	// Imported keys are only rotated if they allow it
+	p.Imported = true
+	if p.NeedsAutoRotation(last.Add(2*time.Hour)) || !p.NextAutoRotation().IsZero() {
+		t.Fatal("expected no automatic rotation of an imported key")
+	}
+	p.AllowImportedKeyRotation = true
+	if !p.NeedsAutoRotation(last.Add(2 * time.Hour)) {
+		t.Fatal("expected automatic rotation of an imported key allowing rotation")
+	}
+
+	// Keys created before creation times were precise fall back to the
+	// deprecated one
+	entry := p.Keys[strconv.Itoa(p.LatestVersion)]
+	entry.CreationTime = time.Time{}
+	p.Keys[strconv.Itoa(p.LatestVersion)] = entry
+	if p.LastRotationTime().Unix() != entry.DeprecatedCreationTime {
+		t.Fatalf("bad last rotation time %v", p.LastRotationTime())
+	}
+}
@@ -0,0 +1,59 @@
+package keysutil
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// EscrowVersion returns the key data of a policy holding only the given
+// version of this policy, so that it can be restored with RestorePolicy as a
+// key whose latest and minimum available version is that version. Ciphertexts
+// created with the version can then be decrypted with the restored key, which
+// is otherwise in the same state as a policy trimmed to that version. The
+// policy must be read locked.
+func (p *Policy) EscrowVersion(ver int) (*KeyData, error) {
+	if !p.Exportable {
+		return nil, fmt.Errorf("exporting is disallowed on the policy")
+	}
+
+	if ver < p.MinDecryptionVersion {
+		return nil, fmt.Errorf("version for export is below minimum decryption version")
+	}
+	entry, ok := p.Keys[strconv.Itoa(ver)]
+	if !ok {
+		return nil, fmt.Errorf("version does not exist or cannot be found")
+	}
+
+	escrowed := &Policy{
+		Name:                     p.Name,
+		Type:                     p.Type,
+		Keys:                     keyEntryMap{strconv.Itoa(ver): entry},
+		Derived:                  p.Derived,
+		KDF:                      p.KDF,
+		ConvergentEncryption:     p.ConvergentEncryption,
+		ConvergentVersion:        p.ConvergentVersion,
+		Exportable:               p.Exportable,
+		AllowPlaintextBackup:     p.AllowPlaintextBackup,
+		EscrowExport:             p.EscrowExport,
+		VersionTemplate:          p.VersionTemplate,
+		StoragePrefix:            p.StoragePrefix,
+		Imported:                 p.Imported,
+		AllowImportedKeyRotation: p.AllowImportedKeyRotation,
+		CMACRawKey:               p.CMACRawKey,
+		FPEAlphabet:              p.FPEAlphabet,
+
+		LatestVersion:        ver,
+		MinDecryptionVersion: ver,
+		MinEncryptionVersion: ver,
+		MinAvailableVersion:  ver,
+		ArchiveVersion:       ver,
+		ArchiveMinVersion:    ver,
+	}
+
+	return &KeyData{
+		Policy: escrowed,
+		ArchivedKeys: &archivedKeys{
+			Keys: []KeyEntry{entry},
+		},
+	}, nil
+}
@@ -0,0 +1,178 @@
+package keysutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"math/big"
+)
+
+const (
+	// ff31TweakSize is the size in bytes of an FF3-1 tweak
+	ff31TweakSize = 7
+
+	// ff31Rounds is the number of Feistel rounds of FF3-1
+	ff31Rounds = 8
+)
+
+// ff31 implements the FF3-1 format-preserving encryption mode of NIST SP
+// 800-38G Revision 1 with AES as the underlying block cipher. It operates on
+// numeral strings, given as slices of digits lower than the radix.
+type ff31 struct {
+	block  cipher.Block
+	radix  *big.Int
+	minLen int
+	maxLen int
+}
+
+func newFF31(key []byte, radix int) (*ff31, error) {
+	if radix < 2 || radix > 1<<16 {
+		return nil, fmt.Errorf("radix must be between 2 and %d, got %d", 1<<16, radix)
+	}
+
+	// FF3-1 uses the AES key with its bytes in reverse order
+	block, err := aes.NewCipher(reverseBytes(key))
+	if err != nil {
+		return nil, err
+	}
+
+	r := big.NewInt(int64(radix))
+
+	// The domain must hold at least a million values
+	minLen := 0
+	for x, min := big.NewInt(1), big.NewInt(1000000); x.Cmp(min) < 0; x.Mul(x, r) {
+		minLen++
+	}
+
+	// Each half must fit in the 96 bits of the round function input
+	halfLen := 0
+	for x, max := new(big.Int).Set(r), new(big.Int).Lsh(big.NewInt(1), 96); x.Cmp(max) <= 0; x.Mul(x, r) {
+		halfLen++
+	}
+
+	return &ff31{
+		block:  block,
+		radix:  r,
+		minLen: minLen,
+		maxLen: 2 * halfLen,
+	}, nil
+}
+
+func (f *ff31) encrypt(tweak []byte, x []int) ([]int, error) {
+	tl, tr, err := f.split(tweak, x)
+	if err != nil {
+		return nil, err
+	}
+	return f.feistel(tl, tr, x, false), nil
+}
+
+func (f *ff31) decrypt(tweak []byte, x []int) ([]int, error) {
+	tl, tr, err := f.split(tweak, x)
+	if err != nil {
+		return nil, err
+	}
+	return f.feistel(tl, tr, x, true), nil
+}
+
+// split validates the input and returns the two 32-bit halves of the 56-bit
+// tweak, the middle nibble going to the end of the right half.
+func (f *ff31) split(tweak []byte, x []int) ([]byte, []byte, error) {
+	if len(x) < f.minLen || len(x) > f.maxLen {
+		return nil, nil, fmt.Errorf("value length must be between %d and %d, got %d", f.minLen, f.maxLen, len(x))
+	}
+	if len(tweak) != ff31TweakSize {
+		return nil, nil, fmt.Errorf("tweak must be %d bytes long, got %d", ff31TweakSize, len(tweak))
+	}
+
+	tl := []byte{tweak[0], tweak[1], tweak[2], tweak[3] & 0xf0}
+	tr := []byte{tweak[4], tweak[5], tweak[6], tweak[3] << 4}
+	return tl, tr, nil
+}
+
+// feistel runs the rounds of FF3-1 over x with the given tweak halves.
+func (f *ff31) feistel(tl, tr []byte, x []int, decrypt bool) []int {
+	n := len(x)
+	u := (n + 1) / 2
+	v := n - u
+	a := append([]int(nil), x[:u]...)
+	b := append([]int(nil), x[u:]...)
+
+	modU := new(big.Int).Exp(f.radix, big.NewInt(int64(u)), nil)
+	modV := new(big.Int).Exp(f.radix, big.NewInt(int64(v)), nil)
+
+	for j := 0; j < ff31Rounds; j++ {
+		i := j
+		if decrypt {
+			i = ff31Rounds - 1 - j
+		}
+
+		m, mod, w := v, modV, tl
+		if i%2 == 0 {
+			m, mod, w = u, modU, tr
+		}
+
+		// The round function input is the tweak half XORed with the round
+		// number, followed by the other half of the value
+		src := b
+		if decrypt {
+			src = a
+		}
+		var p [aes.BlockSize]byte
+		copy(p[:4], w)
+		p[3] ^= byte(i)
+		num := f.num(src).Bytes()
+		copy(p[aes.BlockSize-len(num):], num)
+
+		var s [aes.BlockSize]byte
+		f.block.Encrypt(s[:], reverseBytes(p[:]))
+		y := new(big.Int).SetBytes(reverseBytes(s[:]))
+
+		c := new(big.Int)
+		if decrypt {
+			c.Sub(f.num(b), y)
+		} else {
+			c.Add(f.num(a), y)
+		}
+		c.Mod(c, mod)
+
+		if decrypt {
+			a, b = f.str(c, m), a
+		} else {
+			a, b = b, f.str(c, m)
+		}
+	}
+
+	return append(a, b...)
+}
+
+// num returns the number whose digits in the radix are the given ones, least
+// significant first; this is NUM_radix(REV(x)).
+func (f *ff31) num(x []int) *big.Int {
+	ret := new(big.Int)
+	for i := len(x) - 1; i >= 0; i-- {
+		ret.Mul(ret, f.radix)
+		ret.Add(ret, big.NewInt(int64(x[i])))
+	}
+	return ret
+}
+
+// str returns the m digits of c in the radix, least significant first; this is
+// REV(STR_radix^m(c)).
+func (f *ff31) str(c *big.Int, m int) []int {
+	ret := make([]int, m)
+	c = new(big.Int).Set(c)
+	digit := new(big.Int)
+	for i := 0; i < m; i++ {
+		c.DivMod(c, f.radix, digit)
+		ret[i] = int(digit.Int64())
+	}
+	return ret
+}
+
+func reverseBytes(in []byte) []byte {
+	ret := make([]byte, len(in))
+	for i, b := range in {
+		ret[len(in)-1-i] = b
+	}
+	return ret
+}
@@ -52,6 +52,16 @@ type PolicyRequest struct {
 
 	// Whether to allow plaintext backup
 	AllowPlaintextBackup bool
+
+	// Whether to allow rotation of an imported key
+	AllowImportedKeyRotation bool
+
+	// Whether to compute the CMACs of an imported key with the key material
+	// itself
+	CMACRawKey bool
+
+	// The alphabet of a format-preserving encryption key
+	FPEAlphabet string
 }
 
 type LockManager struct {
@@ -205,6 +215,80 @@ func (lm *LockManager) RestorePolicy(ctx context.Context, storage logical.Storag
 	return nil
 }
 
+// ImportPolicy acquires an exclusive lock on the policy name and creates a new
+// policy whose first version is the given externally generated key material.
+func (lm *LockManager) ImportPolicy(ctx context.Context, req PolicyRequest, key []byte, rand io.Reader) error {
+	lock := locksutil.LockForKey(lm.keyLocks, req.Name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if lm.useCache {
+		if _, ok := lm.cache.Load(req.Name); ok {
+			return fmt.Errorf("key %q already exists", req.Name)
+		}
+	}
+
+	p, err := lm.getPolicyFromStorage(ctx, req.Storage, req.Name)
+	if err != nil {
+		return err
+	}
+	if p != nil {
+		return fmt.Errorf("key %q already exists", req.Name)
+	}
+
+	switch req.KeyType {
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
+	case KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521, KeyType_RSA2048, KeyType_RSA4096:
+		if req.Derived {
+			return fmt.Errorf("key derivation not supported for keys of type %v", req.KeyType)
+		}
+	case KeyType_ED25519:
+	case KeyType_FF3_1_AES256:
+		if req.Derived {
+			return fmt.Errorf("key derivation not supported for keys of type %v", req.KeyType)
+		}
+		if req.FPEAlphabet != "" {
+			if err := ValidateFPEAlphabet(req.FPEAlphabet); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported key type %v", req.KeyType)
+	}
+	if req.CMACRawKey && !req.KeyType.CMACSupported() {
+		return fmt.Errorf("CMAC not supported for key type %v", req.KeyType)
+	}
+
+	p = &Policy{
+		l:                        new(sync.RWMutex),
+		Name:                     req.Name,
+		Type:                     req.KeyType,
+		Derived:                  req.Derived,
+		Exportable:               req.Exportable,
+		AllowPlaintextBackup:     req.AllowPlaintextBackup,
+		AllowImportedKeyRotation: req.AllowImportedKeyRotation,
+		CMACRawKey:               req.CMACRawKey,
+		Imported:                 true,
+	}
+	if req.KeyType == KeyType_FF3_1_AES256 {
+		p.FPEAlphabet = req.FPEAlphabet
+	}
+	if req.Derived {
+		p.KDF = Kdf_hkdf_sha256
+	}
+
+	// Performs the actual persist and does setup
+	if err := p.Import(ctx, req.Storage, key, rand); err != nil {
+		return err
+	}
+
+	if lm.useCache {
+		lm.cache.Store(req.Name, p)
+	}
+
+	return nil
+}
+
 func (lm *LockManager) BackupPolicy(ctx context.Context, storage logical.Storage, name string) (string, error) {
 	var p *Policy
 	var err error
@@ -352,6 +436,18 @@ func (lm *LockManager) GetPolicy(ctx context.Context, req PolicyRequest, rand io
 				return nil, false, fmt.Errorf("key derivation and convergent encryption not supported for keys of type %v", req.KeyType)
 			}
 
+		case KeyType_FF3_1_AES256:
+			if req.Derived || req.Convergent {
+				cleanup()
+				return nil, false, fmt.Errorf("key derivation and convergent encryption not supported for keys of type %v", req.KeyType)
+			}
+			if req.FPEAlphabet != "" {
+				if err := ValidateFPEAlphabet(req.FPEAlphabet); err != nil {
+					cleanup()
+					return nil, false, err
+				}
+			}
+
 		default:
 			cleanup()
 			return nil, false, fmt.Errorf("unsupported key type %v", req.KeyType)
@@ -365,6 +461,9 @@ func (lm *LockManager) GetPolicy(ctx context.Context, req PolicyRequest, rand io
 			Exportable:           req.Exportable,
 			AllowPlaintextBackup: req.AllowPlaintextBackup,
 		}
+		if req.KeyType == KeyType_FF3_1_AES256 {
+			p.FPEAlphabet = req.FPEAlphabet
+		}
 
 		if req.Derived {
 			p.KDF = Kdf_hkdf_sha256
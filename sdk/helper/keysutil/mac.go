@@ -0,0 +1,218 @@
+package keysutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// KMACSize is the size in bytes of the MACs returned by KMAC.
+	KMACSize = 32
+
+	kmacFunctionName = "KMAC"
+
+	// cmacKeyInfo and kmacKeyInfo are the HKDF info strings the keys used to
+	// compute CMACs and KMACs are derived with, so that they differ from the
+	// encryption key and from each other
+	cmacKeyInfo = "cmac"
+	kmacKeyInfo = "kmac"
+)
+
+// cmac computes the AES-CMAC of input as defined in RFC 4493.
+func cmac(block cipher.Block, input []byte) []byte {
+	size := block.BlockSize()
+
+	// Derive the subkeys from the encryption of the zero block
+	k1 := make([]byte, size)
+	block.Encrypt(k1, k1)
+	cmacDouble(k1)
+	k2 := append([]byte(nil), k1...)
+	cmacDouble(k2)
+
+	n := (len(input) + size - 1) / size
+	complete := n > 0 && len(input)%size == 0
+	if n == 0 {
+		n = 1
+	}
+
+	// The last block is masked with the first subkey if it is complete, and
+	// padded then masked with the second one otherwise
+	last := make([]byte, size)
+	rest := input[(n-1)*size:]
+	copy(last, rest)
+	if complete {
+		xorBytes(last, k1)
+	} else {
+		last[len(rest)] = 0x80
+		xorBytes(last, k2)
+	}
+
+	x := make([]byte, size)
+	for i := 0; i < n-1; i++ {
+		xorBytes(x, input[i*size:(i+1)*size])
+		block.Encrypt(x, x)
+	}
+	xorBytes(x, last)
+	block.Encrypt(x, x)
+	return x
+}
+
+func xorBytes(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+// cmacDouble multiplies b by x in GF(2^128) in place.
+func cmacDouble(b []byte) {
+	msb := b[0] >> 7
+	for i := 0; i < len(b)-1; i++ {
+		b[i] = b[i]<<1 | b[i+1]>>7
+	}
+	b[len(b)-1] <<= 1
+	if msb == 1 {
+		b[len(b)-1] ^= 0x87
+	}
+}
+
+// kmac computes the KMAC128 or KMAC256 of input, as defined in NIST SP
+// 800-185, with the given customization string and output size.
+func kmac(bits int, key, customization, input []byte, size int) []byte {
+	var rate int
+	var h sha3.ShakeHash
+	switch bits {
+	case 128:
+		rate = 168
+		h = sha3.NewCShake128([]byte(kmacFunctionName), customization)
+	default:
+		rate = 136
+		h = sha3.NewCShake256([]byte(kmacFunctionName), customization)
+	}
+
+	h.Write(kmacBytepad(kmacEncodeString(key), rate))
+	h.Write(input)
+	h.Write(kmacRightEncode(uint64(size) * 8))
+
+	out := make([]byte, size)
+	h.Read(out)
+	return out
+}
+
+func kmacLeftEncode(x uint64) []byte {
+	var buf [9]byte
+	binary.BigEndian.PutUint64(buf[1:], x)
+	i := 1
+	for i < 8 && buf[i] == 0 {
+		i++
+	}
+	buf[i-1] = byte(9 - i)
+	return buf[i-1:]
+}
+
+func kmacRightEncode(x uint64) []byte {
+	var buf [9]byte
+	binary.BigEndian.PutUint64(buf[:8], x)
+	i := 0
+	for i < 7 && buf[i] == 0 {
+		i++
+	}
+	buf[8] = byte(8 - i)
+	return buf[i:]
+}
+
+func kmacEncodeString(s []byte) []byte {
+	return append(kmacLeftEncode(uint64(len(s))*8), s...)
+}
+
+func kmacBytepad(x []byte, w int) []byte {
+	out := append(kmacLeftEncode(uint64(w)), x...)
+	if rem := len(out) % w; rem != 0 {
+		out = append(out, make([]byte, w-rem)...)
+	}
+	return out
+}
+
+// macKey returns the key of the given version to compute MACs with, derived
+// from the encryption key with HKDF-SHA256 and the given info string unless
+// info is empty. Checking the version against the minimum encryption or
+// decryption version is left to the caller.
+func (p *Policy) macKey(ver int, context []byte, info string) ([]byte, error) {
+	switch {
+	case ver <= 0:
+		return nil, errutil.UserError{Err: "invalid key version"}
+	case ver > p.LatestVersion:
+		return nil, errutil.UserError{Err: "requested version is higher than the latest key version"}
+	}
+	if _, ok := p.Keys[strconv.Itoa(ver)]; !ok {
+		return nil, errutil.UserError{Err: fmt.Sprintf("key version %d not found", ver)}
+	}
+
+	var numBytes int
+	switch p.Type {
+	case KeyType_AES128_GCM96:
+		numBytes = 16
+	default:
+		numBytes = 32
+	}
+	key, err := p.DeriveKey(context, ver, numBytes)
+	if err != nil || info == "" {
+		return key, err
+	}
+
+	macKey := make([]byte, numBytes)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, nil, []byte(info)), macKey); err != nil {
+		return nil, errutil.InternalError{Err: err.Error()}
+	}
+	return macKey, nil
+}
+
+// CMAC computes the AES-CMAC of input with the given version of the key. If
+// the key is derived, the context is used to derive the AES key. The AES key
+// is dedicated to CMACs unless the key was imported with CMACRawKey set.
+func (p *Policy) CMAC(ver int, context, input []byte) ([]byte, error) {
+	if !p.Type.CMACSupported() {
+		return nil, errutil.UserError{Err: fmt.Sprintf("CMAC not supported for key type %v", p.Type)}
+	}
+
+	info := cmacKeyInfo
+	if p.CMACRawKey {
+		info = ""
+	}
+	key, err := p.macKey(ver, context, info)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errutil.InternalError{Err: err.Error()}
+	}
+	return cmac(block, input), nil
+}
+
+// KMAC computes the KMAC128 or KMAC256 of input with the given version of the
+// key and customization string. If the key is derived, the context is used to
+// derive the KMAC key, which is dedicated to KMACs.
+func (p *Policy) KMAC(ver int, bits int, context, customization, input []byte) ([]byte, error) {
+	if !p.Type.KMACSupported() {
+		return nil, errutil.UserError{Err: fmt.Sprintf("KMAC not supported for key type %v", p.Type)}
+	}
+	if bits != 128 && bits != 256 {
+		return nil, errutil.UserError{Err: fmt.Sprintf("unsupported KMAC variant %d", bits)}
+	}
+
+	key, err := p.macKey(ver, context, kmacKeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	return kmac(bits, key, customization, input, KMACSize), nil
+}
@@ -0,0 +1,108 @@
+package keysutil
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+)
+
+func testHexDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// Test vectors from RFC 4493
+func TestCMAC_Vectors(t *testing.T) {
+	block, err := aes.NewCipher(testHexDecode(t, "2b7e151628aed2a6abf7158809cf4f3c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := testHexDecode(t, "6bc1bee22e409f96e93d7e117393172a"+
+		"ae2d8a571e03ac9c9eb76fac45af8e51"+
+		"30c81c46a35ce411e5fbc1191a0a52ef"+
+		"f69f2445df4f9b17ad2b417be66c3710")
+
+	for _, tc := range []struct {
+		length int
+		mac    string
+	}{
+		{0, "bb1d6929e95937287fa37d129b756746"},
+		{16, "070a16b46b4d4144f79bdd9dd04a287c"},
+		{40, "dfa66747de9ae63030ca32611497c827"},
+		{64, "51f0bebf7e3b9d92fc49741779363cfe"},
+	} {
+		if mac := hex.EncodeToString(cmac(block, message[:tc.length])); mac != tc.mac {
+			t.Fatalf("bad CMAC of %d bytes: expected %s, got %s", tc.length, tc.mac, mac)
+		}
+	}
+}
+
+// Test vectors from the NIST SP 800-185 examples
+func TestKMAC_Vectors(t *testing.T) {
+	key := testHexDecode(t, "404142434445464748494a4b4c4d4e4f505152535455565758595a5b5c5d5e5f")
+	input := testHexDecode(t, "00010203")
+
+	for _, tc := range []struct {
+		bits          int
+		customization string
+		size          int
+		mac           string
+	}{
+		{128, "", 32, "e5780b0d3ea6f7d3a429c5706aa43a00fadbd7d49628839e3187243f456ee14e"},
+		{128, "My Tagged Application", 32, "3b1fba963cd8b0b59e8c1a6d71888b7143651af8ba0a7070c0979e2811324aa5"},
+		{256, "My Tagged Application", 64, "20c570c31346f703c9ac36c61c03cb64c3970d0cfc787e9b79599d273a68d2f7f69d4cc3de9d104a351689f27cf6f5951f0103f33f4f24871024d9c27773a8dd"},
+	} {
+		if mac := hex.EncodeToString(kmac(tc.bits, key, []byte(tc.customization), input, tc.size)); mac != tc.mac {
+			t.Fatalf("bad KMAC%d with customization %q: expected %s, got %s", tc.bits, tc.customization, tc.mac, mac)
+		}
+	}
+}
+
+func TestPolicy_MACKeys(t *testing.T) {
+	key := testHexDecode(t, "2b7e151628aed2a6abf7158809cf4f3c")
+	p := &Policy{
+		Type:          KeyType_AES128_GCM96,
+		LatestVersion: 1,
+		Keys: keyEntryMap{
+			"1": KeyEntry{Key: key},
+		},
+	}
+
+	// The CMAC and KMAC keys are dedicated to them
+	cmacKey, err := p.macKey(1, nil, cmacKeyInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kmacKey, err := p.macKey(1, nil, kmacKeyInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmacKey) != len(key) || bytes.Equal(cmacKey, key) || bytes.Equal(kmacKey, key) || bytes.Equal(cmacKey, kmacKey) {
+		t.Fatalf("expected dedicated MAC keys, got cmac:%x kmac:%x", cmacKey, kmacKey)
+	}
+
+	// Unless told to, CMACs are not computed with the raw key
+	input := testHexDecode(t, "6bc1bee22e409f96e93d7e117393172a")
+	expected := "070a16b46b4d4144f79bdd9dd04a287c"
+	mac, err := p.CMAC(1, nil, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(mac) == expected {
+		t.Fatal("expected CMAC not to be computed with the raw key")
+	}
+	p.CMACRawKey = true
+	mac, err = p.CMAC(1, nil, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(mac) != expected {
+		t.Fatalf("bad CMAC with the raw key: %x", mac)
+	}
+}
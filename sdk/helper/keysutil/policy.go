@@ -58,6 +58,7 @@ const (
 	KeyType_ECDSA_P384
 	KeyType_ECDSA_P521
 	KeyType_AES128_GCM96
+	KeyType_FF3_1_AES256
 )
 
 const (
@@ -67,6 +68,10 @@ const (
 
 	// DefaultVersionTemplate is used when no version template is provided.
 	DefaultVersionTemplate = "vault:v{{version}}:"
+
+	// DefaultFPEAlphabet is the alphabet of format-preserving encryption keys
+	// created without one.
+	DefaultFPEAlphabet = "0123456789"
 )
 
 type RestoreInfo struct {
@@ -122,6 +127,30 @@ func (kt KeyType) HashSignatureInput() bool {
 	return false
 }
 
+func (kt KeyType) FPESupported() bool {
+	switch kt {
+	case KeyType_FF3_1_AES256:
+		return true
+	}
+	return false
+}
+
+func (kt KeyType) CMACSupported() bool {
+	switch kt {
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96:
+		return true
+	}
+	return false
+}
+
+func (kt KeyType) KMACSupported() bool {
+	switch kt {
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
+		return true
+	}
+	return false
+}
+
 func (kt KeyType) DerivationSupported() bool {
 	switch kt {
 	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_ED25519:
@@ -150,6 +179,8 @@ func (kt KeyType) String() string {
 		return "rsa-2048"
 	case KeyType_RSA4096:
 		return "rsa-4096"
+	case KeyType_FF3_1_AES256:
+		return "ff3-1-aes256"
 	}
 
 	return "[unknown]"
@@ -187,6 +218,10 @@ type KeyEntry struct {
 	// This is deprecated (but still filled) in favor of the value above which
 	// is more precise
 	DeprecatedCreationTime int64 `json:"creation_time"`
+
+	// EncryptionCount is the number of encryptions performed with this
+	// version, only counted if the policy has a usage limit
+	EncryptionCount int64 `json:"encryption_count,omitempty"`
 }
 
 // deprecatedKeyEntryMap is used to allow JSON marshal/unmarshal
@@ -362,6 +397,11 @@ type Policy struct {
 	// AllowPlaintextBackup allows taking backup of the policy in plaintext
 	AllowPlaintextBackup bool `json:"allow_plaintext_backup"`
 
+	// EscrowExport restricts the export of the policy to Shamir shares of a
+	// single key version, each encrypted to a different PGP key. Plaintext
+	// export and backup are disallowed once it is set.
+	EscrowExport bool `json:"escrow_export,omitempty"`
+
 	// VersionTemplate is used to prefix the ciphertext with information about
 	// the key version. It must inclide {{version}} and a delimiter between the
 	// version prefix and the ciphertext.
@@ -371,6 +411,45 @@ type Policy struct {
 	// policy object.
 	StoragePrefix string `json:"storage_prefix"`
 
+	// Imported indicates whether the key material was generated outside of
+	// Vault and imported
+	Imported bool `json:"imported"`
+
+	// AllowImportedKeyRotation allows an imported key to be rotated, which
+	// generates new key material within Vault
+	AllowImportedKeyRotation bool `json:"allow_imported_key_rotation"`
+
+	// CMACRawKey computes the CMACs of an imported key with the key material
+	// itself rather than with a key dedicated to CMACs, for compatibility
+	// with CMACs computed outside of Vault
+	CMACRawKey bool `json:"cmac_raw_key,omitempty"`
+
+	// FPEAlphabet is the set of characters that values encrypted with a
+	// format-preserving encryption key are made of. DefaultFPEAlphabet is
+	// used if empty.
+	FPEAlphabet string `json:"fpe_alphabet,omitempty"`
+
+	// AutoRotatePeriod is the age at which the latest version of the key is
+	// automatically rotated. Automatic rotation is disabled if zero.
+	AutoRotatePeriod time.Duration `json:"auto_rotate_period,omitempty"`
+
+	// MaxEncryptionsPerVersion is the number of encryptions after which the
+	// latest version of the key is automatically rotated. Encryptions are not
+	// counted if zero.
+	MaxEncryptionsPerVersion int64 `json:"max_encryptions_per_version,omitempty"`
+
+	// pendingEncryptions holds the number of encryptions performed with each
+	// version that have not been persisted yet, as *int64 keyed by version.
+	pendingEncryptions sync.Map
+
+	// encryptionsCounted is set once pendingEncryptions is first used, so
+	// that policies without a usage limit never touch it
+	encryptionsCounted uint32
+
+	// rotationPending is set once the latest version reached
+	// MaxEncryptionsPerVersion
+	rotationPending uint32
+
 	// versionPrefixCache stores caches of version prefix strings and the split
 	// version template.
 	versionPrefixCache sync.Map
@@ -536,6 +615,8 @@ func (p *Policy) Persist(ctx context.Context, storage logical.Storage) (retErr e
 	priorArchiveVersion := p.ArchiveVersion
 	var priorKeys keyEntryMap
 
+	p.flushPendingEncryptions()
+
 	if p.Keys != nil {
 		priorKeys = keyEntryMap{}
 		for k, v := range p.Keys {
@@ -916,6 +997,8 @@ func (p *Policy) Encrypt(ver int, context, nonce []byte, value string) (string,
 	// Prepend some information
 	encoded = p.getVersionPrefix(ver) + encoded
 
+	p.recordEncryption(ver)
+
 	return encoded, nil
 }
 
@@ -1047,6 +1130,148 @@ func (p *Policy) Decrypt(context, nonce []byte, value string) (string, error) {
 	return base64.StdEncoding.EncodeToString(plain), nil
 }
 
+// ValidateFPEAlphabet checks that the given string can be used as the
+// alphabet of a format-preserving encryption key.
+func ValidateFPEAlphabet(alphabet string) error {
+	seen := map[rune]bool{}
+	for _, c := range alphabet {
+		if seen[c] {
+			return fmt.Errorf("alphabet contains the character %q more than once", c)
+		}
+		seen[c] = true
+	}
+	if len(seen) < 2 || len(seen) > 1<<16 {
+		return fmt.Errorf("alphabet must contain between 2 and %d characters", 1<<16)
+	}
+	return nil
+}
+
+// fpeCipher returns the FF3-1 cipher of the given key version along with the
+// alphabet of the policy.
+func (p *Policy) fpeCipher(ver int) (*ff31, []rune, error) {
+	keyEntry, ok := p.Keys[strconv.Itoa(ver)]
+	if !ok {
+		return nil, nil, errutil.UserError{Err: fmt.Sprintf("key version %d not found", ver)}
+	}
+
+	alphabet := p.FPEAlphabet
+	if alphabet == "" {
+		alphabet = DefaultFPEAlphabet
+	}
+	runes := []rune(alphabet)
+
+	f, err := newFF31(keyEntry.Key, len(runes))
+	if err != nil {
+		return nil, nil, errutil.InternalError{Err: err.Error()}
+	}
+	return f, runes, nil
+}
+
+// fpeTweak returns the given tweak, or an all-zero tweak if none is given.
+func fpeTweak(tweak []byte) ([]byte, error) {
+	switch len(tweak) {
+	case 0:
+		return make([]byte, ff31TweakSize), nil
+	case ff31TweakSize:
+		return tweak, nil
+	}
+	return nil, errutil.UserError{Err: fmt.Sprintf("tweak must be %d bytes long", ff31TweakSize)}
+}
+
+// EncryptFPE encrypts the given value with format-preserving encryption. The
+// returned value has the same length as the input and is made of characters of
+// the policy's alphabet, so it cannot carry the key version: the version used
+// is returned and must be provided to DecryptFPE.
+func (p *Policy) EncryptFPE(ver int, tweak []byte, value string) (string, int, error) {
+	if !p.Type.FPESupported() {
+		return "", 0, errutil.UserError{Err: fmt.Sprintf("format-preserving encryption not supported for key type %v", p.Type)}
+	}
+
+	switch {
+	case ver == 0:
+		ver = p.LatestVersion
+	case ver < 0:
+		return "", 0, errutil.UserError{Err: "requested version for encryption is negative"}
+	case ver > p.LatestVersion:
+		return "", 0, errutil.UserError{Err: "requested version for encryption is higher than the latest key version"}
+	case ver < p.MinEncryptionVersion:
+		return "", 0, errutil.UserError{Err: "requested version for encryption is less than the minimum encryption key version"}
+	}
+
+	out, err := p.fpe(ver, tweak, value, false)
+	if err != nil {
+		return "", 0, err
+	}
+
+	p.recordEncryption(ver)
+
+	return out, ver, nil
+}
+
+// DecryptFPE decrypts a value returned by EncryptFPE with the given key
+// version. A zero version selects the latest one.
+func (p *Policy) DecryptFPE(ver int, tweak []byte, value string) (string, error) {
+	if !p.Type.FPESupported() {
+		return "", errutil.UserError{Err: fmt.Sprintf("format-preserving decryption not supported for key type %v", p.Type)}
+	}
+
+	switch {
+	case ver == 0:
+		ver = p.LatestVersion
+	case ver < 0:
+		return "", errutil.UserError{Err: "requested version for decryption is negative"}
+	case ver > p.LatestVersion:
+		return "", errutil.UserError{Err: "requested version for decryption is higher than the latest key version"}
+	}
+
+	if p.MinDecryptionVersion > 0 && ver < p.MinDecryptionVersion {
+		return "", errutil.UserError{Err: ErrTooOld}
+	}
+
+	return p.fpe(ver, tweak, value, true)
+}
+
+func (p *Policy) fpe(ver int, tweak []byte, value string, decrypt bool) (string, error) {
+	tweak, err := fpeTweak(tweak)
+	if err != nil {
+		return "", err
+	}
+
+	f, alphabet, err := p.fpeCipher(ver)
+	if err != nil {
+		return "", err
+	}
+
+	index := make(map[rune]int, len(alphabet))
+	for i, c := range alphabet {
+		index[c] = i
+	}
+
+	digits := make([]int, 0, len(value))
+	for _, c := range value {
+		i, ok := index[c]
+		if !ok {
+			return "", errutil.UserError{Err: fmt.Sprintf("value contains the character %q, which is not in the key's alphabet", c)}
+		}
+		digits = append(digits, i)
+	}
+
+	if decrypt {
+		digits, err = f.decrypt(tweak, digits)
+	} else {
+		digits, err = f.encrypt(tweak, digits)
+	}
+	if err != nil {
+		return "", errutil.UserError{Err: err.Error()}
+	}
+
+	out := make([]rune, len(digits))
+	for i, d := range digits {
+		out[i] = alphabet[d]
+	}
+	return string(out), nil
+}
+
 func (p *Policy) HMACKey(version int) ([]byte, error) {
 	switch {
 	case version < 0:
@@ -1372,6 +1597,10 @@ func (p *Policy) VerifySignature(context, input []byte, hashAlgorithm HashType,
 }
 
 func (p *Policy) Rotate(ctx context.Context, storage logical.Storage, randReader io.Reader) (retErr error) {
+	if p.Imported && !p.AllowImportedKeyRotation {
+		return fmt.Errorf("imported key %q does not allow rotation within Vault", p.Name)
+	}
+
 	priorLatestVersion := p.LatestVersion
 	priorMinDecryptionVersion := p.MinDecryptionVersion
 	var priorKeys keyEntryMap
@@ -1412,7 +1641,7 @@ func (p *Policy) Rotate(ctx context.Context, storage logical.Storage, randReader
 	entry.HMACKey = hmacKey
 
 	switch p.Type {
-	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_FF3_1_AES256:
 		// Default to 256 bit key
 		numBytes := 32
 		if p.Type == KeyType_AES128_GCM96 {
@@ -1442,19 +1671,10 @@ func (p *Policy) Rotate(ctx context.Context, storage logical.Storage, randReader
 		entry.EC_D = privKey.D
 		entry.EC_X = privKey.X
 		entry.EC_Y = privKey.Y
-		derBytes, err := x509.MarshalPKIXPublicKey(privKey.Public())
+		entry.FormattedPublicKey, err = encodePublicKeyPEM(privKey.Public())
 		if err != nil {
-			return errwrap.Wrapf("error marshaling public key: {{err}}", err)
-		}
-		pemBlock := &pem.Block{
-			Type:  "PUBLIC KEY",
-			Bytes: derBytes,
-		}
-		pemBytes := pem.EncodeToMemory(pemBlock)
-		if pemBytes == nil || len(pemBytes) == 0 {
-			return fmt.Errorf("error PEM-encoding public key")
+			return err
 		}
-		entry.FormattedPublicKey = string(pemBytes)
 
 	case KeyType_ED25519:
 		pub, pri, err := ed25519.GenerateKey(randReader)
@@ -1483,6 +1703,7 @@ func (p *Policy) Rotate(ctx context.Context, storage logical.Storage, randReader
 	}
 
 	p.Keys[strconv.Itoa(p.LatestVersion)] = entry
+	atomic.StoreUint32(&p.rotationPending, 0)
 
 	// This ensures that with new key creations min decryption version is set
 	// to 1 rather than the int default of 0, since keys start at 1 (either
@@ -1494,6 +1715,158 @@ func (p *Policy) Rotate(ctx context.Context, storage logical.Storage, randReader
 	return p.Persist(ctx, storage)
 }
 
+// Import adds externally generated key material to the policy as a new key
+// version. Symmetric keys are given as raw bytes and asymmetric keys as a
+// PKCS#8 DER-encoded private key. Only policies created through an import can
+// receive imported versions.
+func (p *Policy) Import(ctx context.Context, storage logical.Storage, key []byte, randReader io.Reader) (retErr error) {
+	if !p.Imported {
+		return fmt.Errorf("key %q was not imported; new versions can only be created by rotation", p.Name)
+	}
+
+	entry, err := p.parseImportedKey(key)
+	if err != nil {
+		return err
+	}
+
+	priorLatestVersion := p.LatestVersion
+	priorMinDecryptionVersion := p.MinDecryptionVersion
+	var priorKeys keyEntryMap
+
+	if p.Keys != nil {
+		priorKeys = keyEntryMap{}
+		for k, v := range p.Keys {
+			priorKeys[k] = v
+		}
+	}
+
+	defer func() {
+		if retErr != nil {
+			p.LatestVersion = priorLatestVersion
+			p.MinDecryptionVersion = priorMinDecryptionVersion
+			p.Keys = priorKeys
+		}
+	}()
+
+	if p.Keys == nil {
+		p.Keys = keyEntryMap{}
+	}
+
+	entry.HMACKey, err = uuid.GenerateRandomBytesWithReader(32, randReader)
+	if err != nil {
+		return err
+	}
+
+	p.LatestVersion += 1
+	p.Keys[strconv.Itoa(p.LatestVersion)] = entry
+	atomic.StoreUint32(&p.rotationPending, 0)
+
+	if p.MinDecryptionVersion == 0 {
+		p.MinDecryptionVersion = 1
+	}
+
+	return p.Persist(ctx, storage)
+}
+
+// parseImportedKey validates that the given key material matches the policy's
+// key type and returns a key entry holding it.
+func (p *Policy) parseImportedKey(key []byte) (KeyEntry, error) {
+	now := time.Now()
+	entry := KeyEntry{
+		CreationTime:           now,
+		DeprecatedCreationTime: now.Unix(),
+	}
+
+	switch p.Type {
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_FF3_1_AES256:
+		numBytes := 32
+		if p.Type == KeyType_AES128_GCM96 {
+			numBytes = 16
+		}
+		if len(key) != numBytes {
+			return entry, fmt.Errorf("invalid key size for key type %v: expected %d bytes, got %d", p.Type, numBytes, len(key))
+		}
+		entry.Key = key
+		return entry, nil
+	}
+
+	parsedKey, err := x509.ParsePKCS8PrivateKey(key)
+	if err != nil {
+		return entry, errwrap.Wrapf("error parsing asymmetric key; it must be a PKCS#8 DER-encoded private key: {{err}}", err)
+	}
+
+	switch p.Type {
+	case KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521:
+		var curve elliptic.Curve
+		switch p.Type {
+		case KeyType_ECDSA_P384:
+			curve = elliptic.P384()
+		case KeyType_ECDSA_P521:
+			curve = elliptic.P521()
+		default:
+			curve = elliptic.P256()
+		}
+
+		privKey, ok := parsedKey.(*ecdsa.PrivateKey)
+		if !ok || privKey.Curve.Params().Name != curve.Params().Name {
+			return entry, fmt.Errorf("imported key is not an ECDSA key on curve %s", curve.Params().Name)
+		}
+		entry.EC_D = privKey.D
+		entry.EC_X = privKey.X
+		entry.EC_Y = privKey.Y
+		entry.FormattedPublicKey, err = encodePublicKeyPEM(privKey.Public())
+		if err != nil {
+			return entry, err
+		}
+
+	case KeyType_ED25519:
+		// The x509 package returns the standard library's ed25519 type,
+		// which is not the same type as ed25519.PrivateKey with older
+		// versions of x/crypto, so rebuild the key from its seed.
+		seeder, ok := parsedKey.(interface{ Seed() []byte })
+		if !ok {
+			return entry, fmt.Errorf("imported key is not an ed25519 key")
+		}
+		privKey := ed25519.NewKeyFromSeed(seeder.Seed())
+		entry.Key = privKey
+		entry.FormattedPublicKey = base64.StdEncoding.EncodeToString(privKey.Public().(ed25519.PublicKey))
+
+	case KeyType_RSA2048, KeyType_RSA4096:
+		bitSize := 2048
+		if p.Type == KeyType_RSA4096 {
+			bitSize = 4096
+		}
+
+		privKey, ok := parsedKey.(*rsa.PrivateKey)
+		if !ok || privKey.N.BitLen() != bitSize {
+			return entry, fmt.Errorf("imported key is not a %d-bit RSA key", bitSize)
+		}
+		entry.RSAKey = privKey
+
+	default:
+		return entry, fmt.Errorf("unsupported key type %v", p.Type)
+	}
+
+	return entry, nil
+}
+
+// encodePublicKeyPEM returns the PEM-encoded PKIX form of the given public key.
+func encodePublicKeyPEM(pub crypto.PublicKey) (string, error) {
+	derBytes, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", errwrap.Wrapf("error marshaling public key: {{err}}", err)
+	}
+	pemBlock := &pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: derBytes,
+	}
+	pemBytes := pem.EncodeToMemory(pemBlock)
+	if pemBytes == nil || len(pemBytes) == 0 {
+		return "", fmt.Errorf("error PEM-encoding public key")
+	}
+	return string(pemBytes), nil
+}
+
 func (p *Policy) MigrateKeyToKeysMap() {
 	now := time.Now()
 	p.Keys = keyEntryMap{
@@ -1516,6 +1889,10 @@ func (p *Policy) Backup(ctx context.Context, storage logical.Storage) (out strin
 		return "", fmt.Errorf("plaintext backup is disallowed on the policy")
 	}
 
+	if p.EscrowExport {
+		return "", fmt.Errorf("the policy can only be exported through escrow")
+	}
+
 	priorBackupInfo := p.BackupInfo
 
 	defer func() {
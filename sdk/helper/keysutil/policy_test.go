@@ -2,9 +2,14 @@ package keysutil
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -613,3 +618,185 @@ func Test_BadArchive(t *testing.T) {
 		t.Fatalf("unexpected key length %d", len(p.Keys))
 	}
 }
+
+func Test_Import(t *testing.T) {
+	ctx := context.Background()
+	lm, _ := NewLockManager(true, 0)
+	storage := &logical.InmemStorage{}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := PolicyRequest{
+		Storage: storage,
+		Name:    "imported",
+		KeyType: KeyType_ECDSA_P256,
+	}
+	if err := lm.ImportPolicy(ctx, req, ecDER, rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if err := lm.ImportPolicy(ctx, req, ecDER, rand.Reader); err == nil {
+		t.Fatal("expected error importing over an existing key")
+	}
+
+	p, _, err := lm.GetPolicy(ctx, PolicyRequest{Storage: storage, Name: "imported"}, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Imported || p.LatestVersion != 1 {
+		t.Fatalf("bad policy after import: imported %t, latest version %d", p.Imported, p.LatestVersion)
+	}
+	if p.Keys["1"].EC_D.Cmp(ecKey.D) != 0 {
+		t.Fatal("imported key material does not match")
+	}
+
+	// Rotation is disallowed unless explicitly allowed at import time
+	if err := p.Rotate(ctx, storage, rand.Reader); err == nil {
+		t.Fatal("expected error rotating imported key")
+	}
+
+	// A key of the wrong type must not be accepted as a new version
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaDER, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Import(ctx, storage, rsaDER, rand.Reader); err == nil {
+		t.Fatal("expected error importing mismatched key type")
+	}
+	if p.LatestVersion != 1 {
+		t.Fatalf("expected latest version to be unchanged, got %d", p.LatestVersion)
+	}
+
+	// Symmetric keys are imported as raw bytes and must have the right size
+	aesReq := PolicyRequest{
+		Storage:                  storage,
+		Name:                     "imported-aes",
+		KeyType:                  KeyType_AES256_GCM96,
+		AllowImportedKeyRotation: true,
+	}
+	if err := lm.ImportPolicy(ctx, aesReq, make([]byte, 16), rand.Reader); err == nil {
+		t.Fatal("expected error importing short AES key")
+	}
+	if err := lm.ImportPolicy(ctx, aesReq, make([]byte, 32), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	p, _, err = lm.GetPolicy(ctx, PolicyRequest{Storage: storage, Name: "imported-aes"}, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Rotate(ctx, storage, rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if p.LatestVersion != 2 {
+		t.Fatalf("expected latest version 2 after rotation, got %d", p.LatestVersion)
+	}
+}
+
+func Test_FPE(t *testing.T) {
+	ctx := context.Background()
+	lm, _ := NewLockManager(true, 0)
+	storage := &logical.InmemStorage{}
+
+	alphabet := "0123456789abcdefghijklmnopqrstuvwxyz"
+	req := PolicyRequest{
+		Upsert:               true,
+		Storage:              storage,
+		Name:                 "fpe",
+		KeyType:              KeyType_FF3_1_AES256,
+		Exportable:           true,
+		AllowPlaintextBackup: true,
+		FPEAlphabet:          "0120",
+	}
+	if _, _, err := lm.GetPolicy(ctx, req, rand.Reader); err == nil {
+		t.Fatal("expected error creating a key with a repeated character in its alphabet")
+	}
+	req.FPEAlphabet = alphabet
+	p, _, err := lm.GetPolicy(ctx, req, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Encrypt(0, nil, nil, "Zm9v"); err == nil {
+		t.Fatal("expected error using an FPE key for regular encryption")
+	}
+	if _, _, err := p.EncryptFPE(0, nil, "abc-12345"); err == nil {
+		t.Fatal("expected error encrypting characters outside of the alphabet")
+	}
+	if _, _, err := p.EncryptFPE(0, nil, "abc"); err == nil {
+		t.Fatal("expected error encrypting a value that is too short")
+	}
+	if _, _, err := p.EncryptFPE(0, []byte("tweak"), "abc12345"); err == nil {
+		t.Fatal("expected error encrypting with a bad tweak size")
+	}
+
+	plaintext := "4111111111111111"
+	tweak := []byte("1234567")
+	encV1, ver, err := p.EncryptFPE(0, tweak, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ver != 1 || len(encV1) != len(plaintext) || encV1 == plaintext {
+		t.Fatalf("bad encryption: version %d, value %q", ver, encV1)
+	}
+	for _, c := range encV1 {
+		if !strings.ContainsRune(alphabet, c) {
+			t.Fatalf("encrypted value %q contains characters outside of the alphabet", encV1)
+		}
+	}
+	if enc, _, _ := p.EncryptFPE(0, nil, plaintext); enc == encV1 {
+		t.Fatal("expected the tweak to change the encrypted value")
+	}
+	if dec, err := p.DecryptFPE(1, tweak, encV1); err != nil || dec != plaintext {
+		t.Fatalf("bad decryption: %q, %v", dec, err)
+	}
+
+	if err := p.Rotate(ctx, storage, rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	encV2, ver, err := p.EncryptFPE(0, tweak, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ver != 2 || encV2 == encV1 {
+		t.Fatalf("expected a different value from the new key version, got version %d, value %q", ver, encV2)
+	}
+	if dec, err := p.DecryptFPE(1, tweak, encV1); err != nil || dec != plaintext {
+		t.Fatalf("bad decryption with the previous key version: %q, %v", dec, err)
+	}
+
+	backup, err := lm.BackupPolicy(ctx, storage, "fpe")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.MinDecryptionVersion = 2
+	if _, err := p.DecryptFPE(1, tweak, encV1); err == nil || err.Error() != ErrTooOld {
+		t.Fatalf("expected %q, got %v", ErrTooOld, err)
+	}
+
+	if err := lm.RestorePolicy(ctx, storage, "fpe-restored", backup, false); err != nil {
+		t.Fatal(err)
+	}
+	p, _, err = lm.GetPolicy(ctx, PolicyRequest{Storage: storage, Name: "fpe-restored"}, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.FPEAlphabet != alphabet {
+		t.Fatalf("alphabet not restored: %q", p.FPEAlphabet)
+	}
+	for ver, enc := range map[int]string{1: encV1, 2: encV2} {
+		if dec, err := p.DecryptFPE(ver, tweak, enc); err != nil || dec != plaintext {
+			t.Fatalf("bad decryption with restored key version %d: %q, %v", ver, dec, err)
+		}
+	}
+}
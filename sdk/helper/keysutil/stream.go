@@ -0,0 +1,315 @@
+package keysutil
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// A stream is made of a header followed by frames. The header holds a magic
+// value, the key version, the chunk size and a random salt, from which a key
+// dedicated to the stream is derived. Each frame holds the length of its
+// ciphertext, whose top bit flags the final frame, followed by the sealed
+// chunk. Chunks are sealed with a nonce built from their index and the final
+// flag, and with the header as additional data, so that frames cannot be
+// reordered, dropped or moved to another stream. The final frame is a trailer
+// holding the total length of the plaintext, so that a truncated stream is
+// detected.
+const (
+	streamMagic      = "VTS\x01"
+	streamSaltSize   = 32
+	streamHeaderSize = len(streamMagic) + 4 + 4 + streamSaltSize
+	streamFinalFlag  = 1 << 31
+	streamKeyInfo    = "vault-transit-stream"
+
+	// DefaultStreamChunkSize is the size of the plaintext chunks of streams
+	// created without a chunk size.
+	DefaultStreamChunkSize = 64 * 1024
+
+	// MaxStreamChunkSize bounds the size of the plaintext chunks of streams,
+	// which are held in memory while being processed.
+	MaxStreamChunkSize = 1024 * 1024
+)
+
+// StreamHeader is the header of an encrypted stream.
+type StreamHeader struct {
+	KeyVersion int
+	ChunkSize  int
+	Salt       []byte
+}
+
+func (h *StreamHeader) marshal() []byte {
+	buf := make([]byte, 0, streamHeaderSize)
+	buf = append(buf, streamMagic...)
+	buf = append(buf, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(buf[len(streamMagic):], uint32(h.KeyVersion))
+	binary.BigEndian.PutUint32(buf[len(streamMagic)+4:], uint32(h.ChunkSize))
+	return append(buf, h.Salt...)
+}
+
+// ReadStreamHeader reads the header of an encrypted stream from r.
+func ReadStreamHeader(r io.Reader) (*StreamHeader, error) {
+	buf := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errutil.UserError{Err: "invalid stream: header is truncated"}
+		}
+		return nil, err
+	}
+	if !bytes.Equal(buf[:len(streamMagic)], []byte(streamMagic)) {
+		return nil, errutil.UserError{Err: "invalid stream: unknown header"}
+	}
+
+	h := &StreamHeader{
+		KeyVersion: int(binary.BigEndian.Uint32(buf[len(streamMagic):])),
+		ChunkSize:  int(binary.BigEndian.Uint32(buf[len(streamMagic)+4:])),
+		Salt:       buf[len(streamMagic)+8:],
+	}
+	if h.ChunkSize <= 0 || h.ChunkSize > MaxStreamChunkSize {
+		return nil, errutil.UserError{Err: "invalid stream: bad chunk size"}
+	}
+	return h, nil
+}
+
+// StreamCipher encrypts or decrypts a single stream. It holds the stream key,
+// so that the policy does not need to stay locked while the stream is
+// processed.
+type StreamCipher struct {
+	aead      cipher.AEAD
+	header    []byte
+	chunkSize int
+}
+
+// NewStreamEncrypter returns a cipher encrypting a new stream with the given
+// key version, 0 meaning the latest one. A chunk size of 0 selects
+// DefaultStreamChunkSize.
+func (p *Policy) NewStreamEncrypter(ver int, context []byte, chunkSize int, randReader io.Reader) (*StreamCipher, error) {
+	switch {
+	case ver == 0:
+		ver = p.LatestVersion
+	case ver < 0:
+		return nil, errutil.UserError{Err: "requested version for encryption is negative"}
+	case ver > p.LatestVersion:
+		return nil, errutil.UserError{Err: "requested version for encryption is higher than the latest key version"}
+	case ver < p.MinEncryptionVersion:
+		return nil, errutil.UserError{Err: "requested version for encryption is less than the minimum encryption key version"}
+	}
+
+	switch {
+	case chunkSize == 0:
+		chunkSize = DefaultStreamChunkSize
+	case chunkSize < 0 || chunkSize > MaxStreamChunkSize:
+		return nil, errutil.UserError{Err: fmt.Sprintf("chunk size must be between 1 and %d bytes", MaxStreamChunkSize)}
+	}
+
+	salt, err := uuid.GenerateRandomBytesWithReader(streamSaltSize, randReader)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := p.newStreamCipher(context, &StreamHeader{
+		KeyVersion: ver,
+		ChunkSize:  chunkSize,
+		Salt:       salt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A stream is counted as a single encryption, as it is sealed with a key
+	// derived for it
+	p.recordEncryption(ver)
+
+	return enc, nil
+}
+
+// NewStreamDecrypter returns a cipher decrypting the stream with the given
+// header, as returned by ReadStreamHeader.
+func (p *Policy) NewStreamDecrypter(context []byte, header *StreamHeader) (*StreamCipher, error) {
+	if header.KeyVersion <= 0 || header.KeyVersion > p.LatestVersion {
+		return nil, errutil.UserError{Err: "invalid stream: bad key version"}
+	}
+	if p.MinDecryptionVersion > 0 && header.KeyVersion < p.MinDecryptionVersion {
+		return nil, errutil.UserError{Err: ErrTooOld}
+	}
+
+	return p.newStreamCipher(context, header)
+}
+
+func (p *Policy) newStreamCipher(context []byte, header *StreamHeader) (*StreamCipher, error) {
+	var numBytes int
+	switch p.Type {
+	case KeyType_AES128_GCM96:
+		numBytes = 16
+	case KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
+		numBytes = 32
+	default:
+		return nil, errutil.UserError{Err: fmt.Sprintf("stream encryption not supported for key type %v", p.Type)}
+	}
+	if p.ConvergentEncryption {
+		return nil, errutil.UserError{Err: "stream encryption not supported for keys with convergent encryption"}
+	}
+	if _, ok := p.Keys[strconv.Itoa(header.KeyVersion)]; !ok {
+		return nil, errutil.UserError{Err: fmt.Sprintf("key version %d not found", header.KeyVersion)}
+	}
+
+	key, err := p.DeriveKey(context, header.KeyVersion, numBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Derive a key dedicated to the stream, so that chunks can be sealed
+	// with counter based nonces
+	streamKey := make([]byte, numBytes)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, header.Salt, []byte(streamKeyInfo)), streamKey); err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("error deriving stream key: %v", err)}
+	}
+
+	var aead cipher.AEAD
+	switch p.Type {
+	case KeyType_ChaCha20_Poly1305:
+		aead, err = chacha20poly1305.New(streamKey)
+	default:
+		var block cipher.Block
+		block, err = aes.NewCipher(streamKey)
+		if err == nil {
+			aead, err = cipher.NewGCM(block)
+		}
+	}
+	if err != nil {
+		return nil, errutil.InternalError{Err: err.Error()}
+	}
+
+	return &StreamCipher{
+		aead:      aead,
+		header:    header.marshal(),
+		chunkSize: header.ChunkSize,
+	}, nil
+}
+
+func (s *StreamCipher) nonce(index uint64, final bool) []byte {
+	nonce := make([]byte, s.aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-9:], index)
+	if final {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+func (s *StreamCipher) writeFrame(w io.Writer, index uint64, final bool, plaintext []byte) error {
+	sealed := s.aead.Seal(nil, s.nonce(index, final), plaintext, s.header)
+
+	length := uint32(len(sealed))
+	if final {
+		length |= streamFinalFlag
+	}
+	var lengthBytes [4]byte
+	binary.BigEndian.PutUint32(lengthBytes[:], length)
+
+	if _, err := w.Write(lengthBytes[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(sealed)
+	return err
+}
+
+// Encrypt reads the plaintext from r until EOF and writes the encrypted stream,
+// header included, to w.
+func (s *StreamCipher) Encrypt(w io.Writer, r io.Reader) error {
+	if _, err := w.Write(s.header); err != nil {
+		return err
+	}
+
+	buf := make([]byte, s.chunkSize)
+	var index, total uint64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if err := s.writeFrame(w, index, false, buf[:n]); err != nil {
+				return err
+			}
+			index++
+			total += uint64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var trailer [8]byte
+	binary.BigEndian.PutUint64(trailer[:], total)
+	return s.writeFrame(w, index, true, trailer[:])
+}
+
+// Decrypt reads the frames of an encrypted stream whose header has already
+// been read from r, and writes the plaintext to w. Each chunk is
+// authenticated before being written, and an error is returned if the stream
+// is truncated or tampered with.
+func (s *StreamCipher) Decrypt(w io.Writer, r io.Reader) error {
+	buf := make([]byte, s.chunkSize+s.aead.Overhead())
+	var index, total uint64
+	for {
+		var lengthBytes [4]byte
+		if _, err := io.ReadFull(r, lengthBytes[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return errutil.UserError{Err: "invalid stream: stream is truncated"}
+			}
+			return err
+		}
+
+		length := binary.BigEndian.Uint32(lengthBytes[:])
+		final := length&streamFinalFlag != 0
+		length &^= streamFinalFlag
+		if int(length) > len(buf) || int(length) < s.aead.Overhead() {
+			return errutil.UserError{Err: "invalid stream: bad frame length"}
+		}
+
+		if _, err := io.ReadFull(r, buf[:length]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return errutil.UserError{Err: "invalid stream: stream is truncated"}
+			}
+			return err
+		}
+
+		plaintext, err := s.aead.Open(buf[:0], s.nonce(index, final), buf[:length], s.header)
+		if err != nil {
+			return errutil.UserError{Err: "invalid stream: message authentication failed"}
+		}
+
+		if final {
+			if len(plaintext) != 8 || binary.BigEndian.Uint64(plaintext) != total {
+				return errutil.UserError{Err: "invalid stream: bad trailer"}
+			}
+			break
+		}
+
+		if _, err := w.Write(plaintext); err != nil {
+			return err
+		}
+		index++
+		total += uint64(len(plaintext))
+	}
+
+	// Nothing may follow the trailer
+	switch _, err := io.ReadFull(r, make([]byte, 1)); err {
+	case io.EOF:
+		return nil
+	case nil:
+		return errutil.UserError{Err: "invalid stream: unexpected data after the trailer"}
+	default:
+		return err
+	}
+}
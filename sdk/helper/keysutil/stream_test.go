@@ -0,0 +1,134 @@
+package keysutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func testStreamRoundTrip(t *testing.T, p *Policy, ctx []byte, plaintext []byte, chunkSize int) []byte {
+	t.Helper()
+
+	enc, err := p.NewStreamEncrypter(0, ctx, chunkSize, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ciphertext bytes.Buffer
+	if err := enc.Encrypt(&ciphertext, bytes.NewReader(plaintext)); err != nil {
+		t.Fatal(err)
+	}
+	encrypted := ciphertext.Bytes()
+
+	out, err := testStreamDecrypt(p, ctx, encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, plaintext) {
+		t.Fatalf("bad plaintext after round trip of %d bytes with chunks of %d bytes", len(plaintext), chunkSize)
+	}
+	return encrypted
+}
+
+func testStreamDecrypt(p *Policy, ctx []byte, encrypted []byte) ([]byte, error) {
+	r := bytes.NewReader(encrypted)
+	header, err := ReadStreamHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := p.NewStreamDecrypter(ctx, header)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := dec.Decrypt(&out, r); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func Test_Stream(t *testing.T) {
+	ctx := context.Background()
+	lm, _ := NewLockManager(true, 0)
+	storage := &logical.InmemStorage{}
+
+	plaintext := make([]byte, 10000)
+	if _, err := rand.Read(plaintext); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, keyType := range []KeyType{KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305} {
+		p, _, err := lm.GetPolicy(ctx, PolicyRequest{
+			Upsert:  true,
+			Storage: storage,
+			Name:    keyType.String(),
+			KeyType: keyType,
+		}, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testStreamRoundTrip(t, p, nil, nil, 0)
+		testStreamRoundTrip(t, p, nil, plaintext, 0)
+		testStreamRoundTrip(t, p, nil, plaintext, 1000)
+		testStreamRoundTrip(t, p, nil, plaintext, 3000)
+	}
+
+	p, _, err := lm.GetPolicy(ctx, PolicyRequest{
+		Upsert:  true,
+		Storage: storage,
+		Name:    "derived",
+		KeyType: KeyType_AES256_GCM96,
+		Derived: true,
+	}, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.NewStreamEncrypter(0, nil, 0, rand.Reader); err == nil {
+		t.Fatal("expected error encrypting a stream with a derived key and no context")
+	}
+	encrypted := testStreamRoundTrip(t, p, []byte("context"), plaintext, 1000)
+	if _, err := testStreamDecrypt(p, []byte("other"), encrypted); err == nil {
+		t.Fatal("expected error decrypting with another context")
+	}
+
+	if _, err := p.NewStreamEncrypter(0, []byte("context"), MaxStreamChunkSize+1, rand.Reader); err == nil {
+		t.Fatal("expected error with a chunk size that is too large")
+	}
+
+	// The stream was encrypted with chunks of 1000 bytes, so each frame is
+	// 4+1000+16 bytes long and the trailer frame is 4+8+16 bytes long
+	frame := 4 + 1000 + 16
+	tampered := map[string][]byte{
+		"truncated header":   encrypted[:streamHeaderSize-1],
+		"missing trailer":    encrypted[:len(encrypted)-(4+8+16)],
+		"truncated frame":    encrypted[:len(encrypted)-10],
+		"dropped frame":      append(append([]byte(nil), encrypted[:streamHeaderSize+frame]...), encrypted[streamHeaderSize+2*frame:]...),
+		"swapped frames":     append(append(append(append([]byte(nil), encrypted[:streamHeaderSize]...), encrypted[streamHeaderSize+frame:streamHeaderSize+2*frame]...), encrypted[streamHeaderSize:streamHeaderSize+frame]...), encrypted[streamHeaderSize+2*frame:]...),
+		"data after trailer": append(append([]byte(nil), encrypted...), 0),
+	}
+	flipped := append([]byte(nil), encrypted...)
+	flipped[streamHeaderSize+100] ^= 1
+	tampered["modified chunk"] = flipped
+	flipped = append([]byte(nil), encrypted...)
+	flipped[len(streamMagic)+8] ^= 1
+	tampered["modified salt"] = flipped
+
+	for name, data := range tampered {
+		if _, err := testStreamDecrypt(p, []byte("context"), data); err == nil {
+			t.Fatalf("expected error decrypting stream with %s", name)
+		}
+	}
+
+	// Streams encrypted with a version below the minimum decryption version
+	// are rejected
+	if err := p.Rotate(ctx, storage, rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	p.MinDecryptionVersion = 2
+	if _, err := testStreamDecrypt(p, []byte("context"), encrypted); err == nil || err.Error() != ErrTooOld {
+		t.Fatalf("expected %q, got %v", ErrTooOld, err)
+	}
+}
@@ -0,0 +1,140 @@
+// Package kwp implements the AES Key Wrap with Padding algorithm described in
+// RFC 5649. It is used to transport key material of arbitrary length under a
+// symmetric key-encryption key.
+package kwp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+const (
+	// semiblockSize is the size of the 64-bit semiblocks the algorithm
+	// operates on.
+	semiblockSize = 8
+
+	// minWrappedSize is the smallest possible output of Wrap, a single AES
+	// block.
+	minWrappedSize = 2 * semiblockSize
+)
+
+// aivPrefix is the constant high half of the Alternative Initial Value
+// defined in section 3 of RFC 5649.
+var aivPrefix = []byte{0xa6, 0x59, 0x59, 0xa6}
+
+var (
+	ErrInvalidKEK        = errors.New("key-encryption key must be a valid AES key")
+	ErrInvalidInput      = errors.New("key material to wrap must not be empty")
+	ErrInvalidCiphertext = errors.New("wrapped key has an invalid length")
+	ErrIntegrityCheck    = errors.New("integrity check failed while unwrapping key")
+)
+
+// Wrap wraps the given key material under kek.
+func Wrap(kek, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, ErrInvalidKEK
+	}
+	if len(plaintext) == 0 || uint64(len(plaintext)) > math.MaxUint32 {
+		return nil, ErrInvalidInput
+	}
+
+	// The padded plaintext is prefixed with the AIV, leaving the first
+	// semiblock free to act as the integrity register.
+	padded := make([]byte, semiblockSize+roundUp(len(plaintext)))
+	copy(padded, aivPrefix)
+	binary.BigEndian.PutUint32(padded[4:semiblockSize], uint32(len(plaintext)))
+	copy(padded[semiblockSize:], plaintext)
+
+	// A single semiblock of input is encrypted directly as one AES block.
+	if len(padded) == minWrappedSize {
+		block.Encrypt(padded, padded)
+		return padded, nil
+	}
+
+	wrap(block, padded)
+	return padded, nil
+}
+
+// Unwrap reverses Wrap, verifying the integrity of the wrapped key before
+// returning the original key material.
+func Unwrap(kek, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, ErrInvalidKEK
+	}
+	if len(ciphertext) < minWrappedSize || len(ciphertext)%semiblockSize != 0 {
+		return nil, ErrInvalidCiphertext
+	}
+
+	out := make([]byte, len(ciphertext))
+	copy(out, ciphertext)
+
+	if len(out) == minWrappedSize {
+		block.Decrypt(out, out)
+	} else {
+		unwrap(block, out)
+	}
+
+	// Validate the AIV, the message length indicator and the padding before
+	// returning anything to the caller.
+	valid := subtle.ConstantTimeCompare(out[:4], aivPrefix)
+	mli := int(binary.BigEndian.Uint32(out[4:semiblockSize]))
+	dataLen := len(out) - semiblockSize
+	if mli <= dataLen-semiblockSize || mli > dataLen {
+		return nil, ErrIntegrityCheck
+	}
+	padding := out[semiblockSize+mli:]
+	valid &= subtle.ConstantTimeCompare(padding, make([]byte, len(padding)))
+	if valid != 1 {
+		return nil, ErrIntegrityCheck
+	}
+
+	return out[semiblockSize : semiblockSize+mli], nil
+}
+
+// wrap implements the wrapping process W of RFC 3394 in place. The first
+// semiblock of buf holds the initial value and the remaining semiblocks hold
+// the data to wrap.
+func wrap(block cipher.Block, buf []byte) {
+	n := len(buf)/semiblockSize - 1
+	var b [aes.BlockSize]byte
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			r := buf[i*semiblockSize : (i+1)*semiblockSize]
+			copy(b[:semiblockSize], buf[:semiblockSize])
+			copy(b[semiblockSize:], r)
+			block.Encrypt(b[:], b[:])
+
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(buf[:semiblockSize], binary.BigEndian.Uint64(b[:semiblockSize])^t)
+			copy(r, b[semiblockSize:])
+		}
+	}
+}
+
+// unwrap implements the unwrapping process W^-1 of RFC 3394 in place.
+func unwrap(block cipher.Block, buf []byte) {
+	n := len(buf)/semiblockSize - 1
+	var b [aes.BlockSize]byte
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			r := buf[i*semiblockSize : (i+1)*semiblockSize]
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(b[:semiblockSize], binary.BigEndian.Uint64(buf[:semiblockSize])^t)
+			copy(b[semiblockSize:], r)
+			block.Decrypt(b[:], b[:])
+
+			copy(buf[:semiblockSize], b[:semiblockSize])
+			copy(r, b[semiblockSize:])
+		}
+	}
+}
+
+func roundUp(n int) int {
+	return (n + semiblockSize - 1) / semiblockSize * semiblockSize
+}
@@ -0,0 +1,108 @@
+package kwp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestKWP_RFC5649Vectors(t *testing.T) {
+	kek := mustDecodeHex(t, "5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8")
+
+	tests := []struct {
+		name    string
+		key     string
+		wrapped string
+	}{
+		{
+			name:    "20 octets",
+			key:     "c37b7e6492584340bed12207808941155068f738",
+			wrapped: "138bdeaa9b8fa7fc61f97742e72248ee5ae6ae5360d1ae6a5f54f373fa543b6a",
+		},
+		{
+			name:    "7 octets",
+			key:     "466f7250617369",
+			wrapped: "afbeb0f07dfbf5419200f2ccb50bb24f",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			key := mustDecodeHex(t, tc.key)
+			expected := mustDecodeHex(t, tc.wrapped)
+
+			wrapped, err := Wrap(kek, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(wrapped, expected) {
+				t.Fatalf("bad wrapped key: expected %x, got %x", expected, wrapped)
+			}
+
+			unwrapped, err := Unwrap(kek, wrapped)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(unwrapped, key) {
+				t.Fatalf("bad unwrapped key: expected %x, got %x", key, unwrapped)
+			}
+		})
+	}
+}
+
+func TestKWP_RoundTrip(t *testing.T) {
+	kek := make([]byte, 32)
+	if _, err := rand.Read(kek); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{1, 8, 9, 16, 32, 33, 1218} {
+		key := make([]byte, size)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatal(err)
+		}
+
+		wrapped, err := Wrap(kek, key)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		unwrapped, err := Unwrap(kek, wrapped)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(unwrapped, key) {
+			t.Fatalf("size %d: unwrapped key does not match", size)
+		}
+	}
+}
+
+func TestKWP_Tampered(t *testing.T) {
+	kek := make([]byte, 32)
+	wrapped, err := Wrap(kek, []byte("super secret key material"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrapped[len(wrapped)-1] ^= 0x01
+	if _, err := Unwrap(kek, wrapped); err != ErrIntegrityCheck {
+		t.Fatalf("expected integrity check failure, got %v", err)
+	}
+
+	if _, err := Unwrap(kek, wrapped[:12]); err != ErrInvalidCiphertext {
+		t.Fatalf("expected invalid ciphertext error, got %v", err)
+	}
+
+	if _, err := Wrap(kek, nil); err != ErrInvalidInput {
+		t.Fatalf("expected invalid input error, got %v", err)
+	}
+}
@@ -127,6 +127,11 @@ type Paths struct {
 	// should be seal wrapped with extra encryption. It is exact matching
 	// unless it ends with '/' in which case it will be treated as a prefix.
 	SealWrapStorage []string
+
+	// AllowedResponseHeaders are response headers the backend always
+	// returns to clients, in addition to those allowed by the mount's
+	// allowed_response_headers tuning
+	AllowedResponseHeaders []string
 }
 
 type Auditor interface {
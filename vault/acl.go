@@ -396,7 +396,7 @@ CHECK:
 
 	operationAllowed := false
 	switch op {
-	case logical.ReadOperation:
+	case logical.ReadOperation, logical.HeaderOperation:
 		operationAllowed = capabilities&ReadCapabilityInt > 0
 	case logical.ListOperation:
 		operationAllowed = capabilities&ListCapabilityInt > 0
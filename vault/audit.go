@@ -93,6 +93,11 @@ func (c *Core) enableAudit(ctx context.Context, entry *MountEntry, updateStorage
 	view.setReadOnlyErr(logical.ErrSetupReadOnly)
 	defer view.setReadOnlyErr(origViewReadOnlyErr)
 
+	filter, err := audit.ParseFilter(entry.Options["filter"])
+	if err != nil {
+		return err
+	}
+
 	// Lookup the new backend
 	backend, err := c.newAuditBackend(ctx, entry, view, entry.Options)
 	if err != nil {
@@ -121,7 +126,7 @@ func (c *Core) enableAudit(ctx context.Context, entry *MountEntry, updateStorage
 	c.audit = newTable
 
 	// Register the backend
-	c.auditBroker.Register(entry.Path, backend, view, entry.Local)
+	c.auditBroker.Register(entry.Path, backend, view, entry.Local, filter)
 	if c.logger.IsInfo() {
 		c.logger.Info("enabled audit backend", "path", entry.Path, "type", entry.Type)
 	}
@@ -372,6 +377,12 @@ func (c *Core) setupAudits(ctx context.Context) error {
 			view.setReadOnlyErr(origViewReadOnlyErr)
 		})
 
+		filter, err := audit.ParseFilter(entry.Options["filter"])
+		if err != nil {
+			c.logger.Error("failed to parse audit filter", "path", entry.Path, "error", err)
+			continue
+		}
+
 		// Initialize the backend
 		backend, err := c.newAuditBackend(ctx, entry, view, entry.Options)
 		if err != nil {
@@ -384,7 +395,7 @@ func (c *Core) setupAudits(ctx context.Context) error {
 		}
 
 		// Mount the backend
-		broker.Register(entry.Path, backend, view, entry.Local)
+		broker.Register(entry.Path, backend, view, entry.Local, filter)
 
 		successCount++
 	}
@@ -410,6 +421,10 @@ func (c *Core) teardownAudits() error {
 		}
 	}
 
+	if c.auditBroker != nil {
+		c.auditBroker.Close()
+	}
+
 	c.audit = nil
 	c.auditBroker = nil
 	return nil
@@ -487,6 +502,12 @@ func (c *Core) newAuditBackend(ctx context.Context, entry *MountEntry, view logi
 				auditLogger.Debug("socket backend options", "path", entry.Path, "address", entry.Options["address"], "socket type", entry.Options["socket_type"])
 			}
 		}
+	case "http":
+		if auditLogger.IsDebug() {
+			if entry.Options != nil {
+				auditLogger.Debug("http backend options", "path", entry.Path, "url", entry.Options["url"], "buffer_full", entry.Options["buffer_full"])
+			}
+		}
 	case "syslog":
 		if auditLogger.IsDebug() {
 			if entry.Options != nil {
@@ -17,6 +17,7 @@ type backendEntry struct {
 	backend audit.Backend
 	view    *BarrierView
 	local   bool
+	filter  *audit.Filter
 }
 
 // AuditBroker is used to provide a single ingest interface to auditable
@@ -36,24 +37,44 @@ func NewAuditBroker(log log.Logger) *AuditBroker {
 	return b
 }
 
-// Register is used to add new audit backend to the broker
-func (a *AuditBroker) Register(name string, b audit.Backend, v *BarrierView, local bool) {
+// Register is used to add new audit backend to the broker. If filter is not
+// nil, the backend only receives the requests and responses it matches.
+func (a *AuditBroker) Register(name string, b audit.Backend, v *BarrierView, local bool, filter *audit.Filter) {
 	a.Lock()
 	defer a.Unlock()
 	a.backends[name] = backendEntry{
 		backend: b,
 		view:    v,
 		local:   local,
+		filter:  filter,
 	}
 }
 
-// Deregister is used to remove an audit backend from the broker
+// Deregister is used to remove an audit backend from the broker. The backend
+// is closed if it implements audit.Closer.
 func (a *AuditBroker) Deregister(name string) {
 	a.Lock()
 	defer a.Unlock()
+	if be, ok := a.backends[name]; ok {
+		if closer, ok := be.backend.(audit.Closer); ok {
+			closer.Close()
+		}
+	}
 	delete(a.backends, name)
 }
 
+// Close closes the registered backends implementing audit.Closer. It is used
+// when the audit devices are torn down, the broker is not used afterwards.
+func (a *AuditBroker) Close() {
+	a.Lock()
+	defer a.Unlock()
+	for _, be := range a.backends {
+		if closer, ok := be.backend.(audit.Closer); ok {
+			closer.Close()
+		}
+	}
+}
+
 // IsRegistered is used to check if a given audit backend is registered
 func (a *AuditBroker) IsRegistered(name string) bool {
 	a.RLock()
@@ -120,9 +141,16 @@ func (a *AuditBroker) LogRequest(ctx context.Context, in *logical.LogInput, head
 		in.Request.Headers = headers
 	}()
 
-	// Ensure at least one backend logs
+	// Ensure at least one backend logs, out of those whose filter matches. The
+	// request fails if there are backends but none of them matches it.
 	anyLogged := false
+	anyMatched := false
 	for name, be := range a.backends {
+		if !be.filter.Matches(ctx, in) {
+			continue
+		}
+		anyMatched = true
+
 		in.Request.Headers = nil
 		transHeaders, thErr := headersConfig.ApplyConfig(ctx, headers, be.backend.GetHash)
 		if thErr != nil {
@@ -141,7 +169,11 @@ func (a *AuditBroker) LogRequest(ctx context.Context, in *logical.LogInput, head
 		}
 	}
 	if !anyLogged && len(a.backends) > 0 {
-		retErr = multierror.Append(retErr, fmt.Errorf("no audit backend succeeded in logging the request"))
+		if anyMatched {
+			retErr = multierror.Append(retErr, fmt.Errorf("no audit backend succeeded in logging the request"))
+		} else {
+			retErr = multierror.Append(retErr, fmt.Errorf("no audit backend filter matched the request"))
+		}
 	}
 
 	return retErr.ErrorOrNil()
@@ -176,9 +208,16 @@ func (a *AuditBroker) LogResponse(ctx context.Context, in *logical.LogInput, hea
 		in.Request.Headers = headers
 	}()
 
-	// Ensure at least one backend logs
+	// Ensure at least one backend logs, out of those whose filter matches. The
+	// response fails if there are backends but none of them matches it.
 	anyLogged := false
+	anyMatched := false
 	for name, be := range a.backends {
+		if !be.filter.Matches(ctx, in) {
+			continue
+		}
+		anyMatched = true
+
 		in.Request.Headers = nil
 		transHeaders, thErr := headersConfig.ApplyConfig(ctx, headers, be.backend.GetHash)
 		if thErr != nil {
@@ -197,7 +236,11 @@ func (a *AuditBroker) LogResponse(ctx context.Context, in *logical.LogInput, hea
 		}
 	}
 	if !anyLogged && len(a.backends) > 0 {
-		retErr = multierror.Append(retErr, fmt.Errorf("no audit backend succeeded in logging the response"))
+		if anyMatched {
+			retErr = multierror.Append(retErr, fmt.Errorf("no audit backend succeeded in logging the response"))
+		} else {
+			retErr = multierror.Append(retErr, fmt.Errorf("no audit backend filter matched the response"))
+		}
 	}
 
 	return retErr.ErrorOrNil()
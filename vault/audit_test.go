@@ -352,13 +352,81 @@ func verifyDefaultAuditTable(t *testing.T, table *MountTable) {
 	}
 }
 
+func TestAuditBroker_Filter(t *testing.T) {
+	l := logging.NewVaultLogger(log.Trace)
+	b := NewAuditBroker(l)
+	a1 := &NoopAudit{}
+	a2 := &NoopAudit{}
+	filter, err := audit.ParseFilter(`mount_type != "transit"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Register("foo", a1, nil, false, filter)
+	b.Register("bar", a2, nil, false, nil)
+
+	headersConf := &AuditedHeadersConfig{
+		Headers: make(map[string]*auditedHeaderSettings),
+	}
+	ctx := namespace.RootContext(nil)
+
+	for _, mountType := range []string{"kv", "transit"} {
+		logInput := &logical.LogInput{
+			Request: &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "foo/bar",
+				MountType: mountType,
+			},
+		}
+		if err := b.LogRequest(ctx, logInput, headersConf); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := b.LogResponse(ctx, logInput, headersConf); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	if len(a1.Req) != 1 || a1.Req[0].MountType != "kv" || len(a1.Resp) != 1 {
+		t.Fatalf("expected the filtered backend to only log the kv request, got %d requests and %d responses", len(a1.Req), len(a1.Resp))
+	}
+	if len(a2.Req) != 2 || len(a2.Resp) != 2 {
+		t.Fatalf("expected the unfiltered backend to log every request, got %d requests and %d responses", len(a2.Req), len(a2.Resp))
+	}
+
+	// Once every backend is filtered, the requests and responses no filter
+	// matches fail rather than going unaudited
+	b.Deregister("bar")
+	logInput := &logical.LogInput{
+		Request: &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "transit/encrypt/foo",
+			MountType: "transit",
+		},
+	}
+	if err := b.LogRequest(ctx, logInput, headersConf); !errwrap.Contains(err, "no audit backend filter matched the request") {
+		t.Fatalf("err: %v", err)
+	}
+	if err := b.LogResponse(ctx, logInput, headersConf); !errwrap.Contains(err, "no audit backend filter matched the response") {
+		t.Fatalf("err: %v", err)
+	}
+	if len(a1.Req) != 1 || len(a1.Resp) != 1 {
+		t.Fatalf("expected the filtered backend not to log the transit request, got %d requests and %d responses", len(a1.Req), len(a1.Resp))
+	}
+
+	// A failing backend fails the requests its filter matches
+	a1.ReqErr = fmt.Errorf("failed")
+	logInput.Request.MountType = "kv"
+	if err := b.LogRequest(ctx, logInput, headersConf); !errwrap.Contains(err, "no audit backend succeeded in logging the request") {
+		t.Fatalf("err: %v", err)
+	}
+}
+
 func TestAuditBroker_LogRequest(t *testing.T) {
 	l := logging.NewVaultLogger(log.Trace)
 	b := NewAuditBroker(l)
 	a1 := &NoopAudit{}
 	a2 := &NoopAudit{}
-	b.Register("foo", a1, nil, false)
-	b.Register("bar", a2, nil, false)
+	b.Register("foo", a1, nil, false, nil)
+	b.Register("bar", a2, nil, false, nil)
 
 	auth := &logical.Auth{
 		ClientToken: "foo",
@@ -443,8 +511,8 @@ func TestAuditBroker_LogResponse(t *testing.T) {
 	b := NewAuditBroker(l)
 	a1 := &NoopAudit{}
 	a2 := &NoopAudit{}
-	b.Register("foo", a1, nil, false)
-	b.Register("bar", a2, nil, false)
+	b.Register("foo", a1, nil, false, nil)
+	b.Register("bar", a2, nil, false, nil)
 
 	auth := &logical.Auth{
 		NumUses:     10,
@@ -549,8 +617,8 @@ func TestAuditBroker_AuditHeaders(t *testing.T) {
 	view := NewBarrierView(barrier, "headers/")
 	a1 := &NoopAudit{}
 	a2 := &NoopAudit{}
-	b.Register("foo", a1, nil, false)
-	b.Register("bar", a2, nil, false)
+	b.Register("foo", a1, nil, false, nil)
+	b.Register("bar", a2, nil, false, nil)
 
 	auth := &logical.Auth{
 		ClientToken: "foo",
@@ -44,6 +44,7 @@ import (
 	sr "github.com/hashicorp/vault/serviceregistration"
 	"github.com/hashicorp/vault/shamir"
 	"github.com/hashicorp/vault/vault/cluster"
+	"github.com/hashicorp/vault/vault/quotas"
 	vaultseal "github.com/hashicorp/vault/vault/seal"
 	cache "github.com/patrickmn/go-cache"
 	"google.golang.org/grpc"
@@ -213,6 +214,18 @@ type Core struct {
 	migrationSeal Seal
 	sealMigrated  *uint32
 
+	// migrationInfo holds the keys to migrate the stored keys with once this
+	// node becomes active, when it was unsealed in seal migration mode as
+	// part of an HA cluster
+	migrationInfo *migrationInformation
+
+	// onlineSealMigration defers the migration of the stored keys of an HA
+	// cluster until a node unsealed in seal migration mode becomes active
+	onlineSealMigration bool
+
+	// sealMigrationStatus holds the *SealMigrationStatus of this node
+	sealMigrationStatus atomic.Value
+
 	// unwrapSeal is the seal to use on Enterprise to unwrap values wrapped
 	// with the previous seal.
 	unwrapSeal Seal
@@ -392,6 +405,9 @@ type Core struct {
 	// CORS Information
 	corsConfig *CORSConfig
 
+	// quotaManager holds the rate limit quotas applied to requests
+	quotaManager *quotas.Manager
+
 	// The active set of upstream cluster addresses; stored via the Echo
 	// mechanism, loaded by the balancer
 	atomicPrimaryClusterAddrs *atomic.Value
@@ -468,7 +484,7 @@ type Core struct {
 	counters counters
 
 	// Stores the raft applied index for standby nodes
-	raftFollowerStates *raftFollowerStates
+	raftFollowerStates *raft.FollowerStates
 	// Stop channel for raft TLS rotations
 	raftTLSRotationStopCh chan struct{}
 	// Stores the pending peers we are waiting to give answers
@@ -544,6 +560,8 @@ type CoreConfig struct {
 
 	DisableSealWrap bool
 
+	OnlineSealMigration bool
+
 	RawConfig *server.Config
 
 	ReloadFuncs     *map[string][]reload.ReloadFunc
@@ -593,6 +611,7 @@ func (c *CoreConfig) Clone() *CoreConfig {
 		EnableRaw:                 c.EnableRaw,
 		PluginDirectory:           c.PluginDirectory,
 		DisableSealWrap:           c.DisableSealWrap,
+		OnlineSealMigration:       c.OnlineSealMigration,
 		ReloadFuncs:               c.ReloadFuncs,
 		ReloadFuncsLock:           c.ReloadFuncsLock,
 		LicensingConfig:           c.LicensingConfig,
@@ -699,6 +718,7 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 		clusterPeerClusterAddrsCache: cache.New(3*cluster.HeartbeatInterval, time.Second),
 		enableMlock:                  !conf.DisableMlock,
 		rawEnabled:                   conf.EnableRaw,
+		onlineSealMigration:          conf.OnlineSealMigration,
 		replicationState:             new(uint32),
 		atomicPrimaryClusterAddrs:    new(atomic.Value),
 		atomicPrimaryFailoverAddrs:   new(atomic.Value),
@@ -770,6 +790,10 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 		Enabled: new(uint32),
 	}
 
+	quotasLogger := c.logger.Named("quotas")
+	c.allLoggers = append(c.allLoggers, quotasLogger)
+	c.quotaManager = quotas.NewManager(quotasLogger)
+
 	if c.seal == nil {
 		c.seal = NewDefaultSeal(&vaultseal.Access{
 			Wrapper: aeadwrapper.NewWrapper(&wrapping.WrapperOptions{
@@ -995,7 +1019,10 @@ func (c *Core) unseal(key []byte, useRecoveryKeys bool) (bool, error) {
 	}
 
 	if masterKey != nil {
-		if c.seal.BarrierType() == wrapping.Shamir {
+		// Until the migration to a Shamir seal is done, the master key is
+		// still stored under the migration seal
+		newShamir := c.seal.BarrierType() == wrapping.Shamir && c.migrationInfo == nil
+		if newShamir {
 			// If this is a legacy shamir seal this serves no purpose but it
 			// doesn't hurt.
 			err = c.seal.GetAccess().Wrapper.(*aeadwrapper.Wrapper).SetAESGCMKeyBytes(masterKey)
@@ -1005,7 +1032,7 @@ func (c *Core) unseal(key []byte, useRecoveryKeys bool) (bool, error) {
 		}
 
 		if !c.isRaftUnseal() {
-			if c.seal.BarrierType() == wrapping.Shamir {
+			if newShamir {
 				cfg, err := c.seal.BarrierConfig(ctx)
 				if err != nil {
 					return false, err
@@ -1212,106 +1239,30 @@ func (c *Core) unsealPart(ctx context.Context, seal Seal, key []byte, useRecover
 			}
 			masterKey = storedKeys[0]
 		}
+
+		// With online seal migration, the active node of an HA cluster keeps
+		// using the stored keys, so they are migrated once this node becomes
+		// active instead, allowing the nodes to be migrated one at a time
+		if c.ha != nil && c.onlineSealMigration {
+			if err := c.prepareSealMigration(ctx, newRecoveryKey, recoveryKey); err != nil {
+				return nil, err
+			}
+			return masterKey, nil
+		}
+
 		// Unseal the barrier so we can rekey
 		if err := c.barrier.Unseal(ctx, masterKey); err != nil {
 			return nil, errwrap.Wrapf("error unsealing barrier with constructed master key: {{err}}", err)
 		}
 		defer c.barrier.Seal()
 
-		switch {
-		case c.migrationSeal.RecoveryKeySupported() && c.seal.RecoveryKeySupported():
-			// Set the recovery and barrier keys to be the same.
-			recoveryKey, err := c.migrationSeal.RecoveryKey(ctx)
-			if err != nil {
-				return nil, errwrap.Wrapf("error getting recovery key to set on new seal: {{err}}", err)
-			}
-
-			if err := c.seal.SetRecoveryKey(ctx, recoveryKey); err != nil {
-				return nil, errwrap.Wrapf("error setting new recovery key information during migrate: {{err}}", err)
-			}
-
-			barrierKeys, err := c.migrationSeal.GetStoredKeys(ctx)
-			if err != nil {
-				return nil, errwrap.Wrapf("error getting stored keys to set on new seal: {{err}}", err)
-			}
-
-			if err := c.seal.SetStoredKeys(ctx, barrierKeys); err != nil {
-				return nil, errwrap.Wrapf("error setting new barrier key information during migrate: {{err}}", err)
-			}
-
-		case c.migrationSeal.RecoveryKeySupported():
-			// Auto to Shamir, since recovery key isn't supported on new seal
-
-			// In this case we have to ensure that the recovery information was
-			// set properly.
-			if recoveryKey == nil {
-				return nil, errors.New("did not get expected recovery information to set new seal during migration")
-			}
-
-			// We have recovery keys; we're going to use them as the new
-			// shamir KeK.
-			err = c.seal.GetAccess().Wrapper.(*aeadwrapper.Wrapper).SetAESGCMKeyBytes(recoveryKey)
-			if err != nil {
-				return nil, errwrap.Wrapf("failed to set master key in seal: {{err}}", err)
-			}
-			if err := c.seal.SetStoredKeys(ctx, [][]byte{masterKey}); err != nil {
-				return nil, errwrap.Wrapf("error setting new barrier key information during migrate: {{err}}", err)
-			}
-
-			masterKey = recoveryKey
-
-		case c.seal.RecoveryKeySupported():
-			// The new seal will have recovery keys; we set it to the existing
-			// master key, so barrier key shares -> recovery key shares
-			if err := c.seal.SetRecoveryKey(ctx, newRecoveryKey); err != nil {
-				return nil, errwrap.Wrapf("error setting new recovery key information: {{err}}", err)
-			}
-
-			// Generate a new master key
-			newMasterKey, err := c.barrier.GenerateKey(c.secureRandomReader)
-			if err != nil {
-				return nil, errwrap.Wrapf("error generating new master key: {{err}}", err)
-			}
-
-			// Rekey the barrier
-			if err := c.barrier.Rekey(ctx, newMasterKey); err != nil {
-				return nil, errwrap.Wrapf("error rekeying barrier during migration: {{err}}", err)
-			}
-
-			// Store the new master key
-			if err := c.seal.SetStoredKeys(ctx, [][]byte{newMasterKey}); err != nil {
-				return nil, errwrap.Wrapf("error storing new master key: {[err}}", err)
-			}
-
-			// Return the new key so it can be used to unlock the barrier
-			masterKey = newMasterKey
-
-		default:
-			return nil, errors.New("unhandled migration case (shamir to shamir)")
-		}
-
-		// At this point we've swapped things around and need to ensure we
-		// don't migrate again
-		c.migrationSeal = nil
-		atomic.StoreUint32(c.sealMigrated, 1)
-
-		// Ensure we populate the new values
-		bc, err := c.seal.BarrierConfig(ctx)
+		masterKey, err = c.migrateSealKeys(ctx, masterKey, newRecoveryKey, recoveryKey)
 		if err != nil {
-			return nil, errwrap.Wrapf("error fetching barrier config after migration: {{err}}", err)
-		}
-		if err := c.seal.SetBarrierConfig(ctx, bc); err != nil {
-			return nil, errwrap.Wrapf("error storing barrier config after migration: {{err}}", err)
+			return nil, err
 		}
 
-		if c.seal.RecoveryKeySupported() {
-			rc, err := c.seal.RecoveryConfig(ctx)
-			if err != nil {
-				return nil, errwrap.Wrapf("error fetching recovery config after migration: {{err}}", err)
-			}
-			if err := c.seal.SetRecoveryConfig(ctx, rc); err != nil {
-				return nil, errwrap.Wrapf("error storing recovery config after migration: {{err}}", err)
-			}
+		if err := c.finishSealMigration(ctx); err != nil {
+			return nil, err
 		}
 	}
 
@@ -1368,8 +1319,10 @@ func (c *Core) unsealInternal(ctx context.Context, masterKey []byte) (bool, erro
 		go c.runStandby(c.standbyDoneCh, c.manualStepDownCh, c.standbyStopCh)
 	}
 
-	// Force a cache bust here, which will also run migration code
-	if c.seal.RecoveryKeySupported() {
+	// Force a cache bust here, which will also run migration code. While the
+	// stored keys wait to be migrated the new seal's configuration is only
+	// cached, so it is kept.
+	if c.seal.RecoveryKeySupported() && c.migrationInfo == nil {
 		c.seal.SetRecoveryConfig(ctx, nil)
 	}
 
@@ -1739,6 +1692,9 @@ func (s standardUnsealStrategy) unseal(ctx context.Context, logger log.Logger, c
 	if err := c.loadCORSConfig(ctx); err != nil {
 		return err
 	}
+	if err := c.setupQuotas(ctx); err != nil {
+		return err
+	}
 	if err := c.loadCurrentRequestCounters(ctx, time.Now()); err != nil {
 		return err
 	}
@@ -1900,6 +1856,9 @@ func (c *Core) preSeal() error {
 	if err := c.teardownAudits(); err != nil {
 		result = multierror.Append(result, errwrap.Wrapf("error tearing down audits: {{err}}", err))
 	}
+	if err := c.teardownQuotas(); err != nil {
+		result = multierror.Append(result, errwrap.Wrapf("error tearing down quotas: {{err}}", err))
+	}
 	if err := c.stopExpiration(); err != nil {
 		result = multierror.Append(result, errwrap.Wrapf("error stopping expiration: {{err}}", err))
 	}
@@ -2094,6 +2053,7 @@ func (c *Core) SetSealsForMigration(migrationSeal, newSeal, unwrapSeal Seal) {
 		c.seal.SetCore(c)
 		c.logger.Warn("entering seal migration mode; Vault will not automatically unseal even if using an autoseal", "from_barrier_type", c.migrationSeal.BarrierType(), "to_barrier_type", c.seal.BarrierType())
 		c.initSealsForMigration()
+		c.setSealMigrationState(SealMigrationStatePending, nil)
 	}
 }
 
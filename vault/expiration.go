@@ -23,6 +23,7 @@ import (
 	"github.com/hashicorp/vault/sdk/helper/jsonutil"
 	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault/quotas"
 	uberAtomic "go.uber.org/atomic"
 )
 
@@ -56,6 +57,10 @@ const (
 type pendingInfo struct {
 	exportLeaseTimes *leaseEntry
 	timer            *time.Timer
+
+	// mountPath is the path, including the namespace path, of the mount the
+	// lease belongs to
+	mountPath string
 }
 
 // ExpirationManager is used by the Core to manage leases. Secrets
@@ -73,6 +78,10 @@ type ExpirationManager struct {
 	pending     map[string]pendingInfo
 	pendingLock sync.RWMutex
 
+	// leaseCounts indexes the number of pending leases by mount path. It is
+	// protected by pendingLock.
+	leaseCounts map[string]int
+
 	tidyLock *int32
 
 	restoreMode        *int32
@@ -148,8 +157,9 @@ func NewExpirationManager(c *Core, view *BarrierView, e ExpireLeaseStrategy, log
 		tokenView:  view.SubView(tokenViewPrefix),
 		tokenStore: c.tokenStore,
 		logger:     logger,
-		pending:    make(map[string]pendingInfo),
-		tidyLock:   new(int32),
+		pending:     make(map[string]pendingInfo),
+		leaseCounts: make(map[string]int),
+		tidyLock:    new(int32),
 
 		// new instances of the expiration manager will go immediately into
 		// restore mode
@@ -242,7 +252,7 @@ func (m *ExpirationManager) invalidate(key string) {
 		m.pendingLock.Lock()
 		if pending, ok := m.pending[leaseID]; ok {
 			pending.timer.Stop()
-			delete(m.pending, leaseID)
+			m.removePendingLocked(leaseID, pending)
 		}
 		m.pendingLock.Unlock()
 	}
@@ -558,6 +568,7 @@ func (m *ExpirationManager) Stop() error {
 		pending.timer.Stop()
 	}
 	m.pending = make(map[string]pendingInfo)
+	m.leaseCounts = make(map[string]int)
 	m.pendingLock.Unlock()
 
 	if m.inRestoreMode() {
@@ -656,7 +667,7 @@ func (m *ExpirationManager) revokeCommon(ctx context.Context, leaseID string, fo
 	m.pendingLock.Lock()
 	if pending, ok := m.pending[leaseID]; ok {
 		pending.timer.Stop()
-		delete(m.pending, leaseID)
+		m.removePendingLocked(leaseID, pending)
 	}
 	m.pendingLock.Unlock()
 
@@ -1122,6 +1133,10 @@ func (m *ExpirationManager) Register(ctx context.Context, req *logical.Request,
 		}
 	}
 
+	if err := m.checkLeaseCountQuota(le); err != nil {
+		return "", err
+	}
+
 	// Encode the entry
 	if err := m.persistEntry(ctx, le); err != nil {
 		return "", err
@@ -1209,6 +1224,12 @@ func (m *ExpirationManager) RegisterAuth(ctx context.Context, te *logical.TokenE
 		Version:     1,
 	}
 
+	if !authExpirationTime.IsZero() {
+		if err := m.checkLeaseCountQuota(&le); err != nil {
+			return err
+		}
+	}
+
 	// Encode the entry
 	if err := m.persistEntry(ctx, &le); err != nil {
 		return err
@@ -1330,7 +1351,7 @@ func (m *ExpirationManager) updatePendingInternal(le *leaseEntry, leaseTotal tim
 		// pending timers.
 		if ok {
 			pending.timer.Stop()
-			delete(m.pending, le.LeaseID)
+			m.removePendingLocked(le.LeaseID, pending)
 		}
 		return
 	}
@@ -1343,8 +1364,10 @@ func (m *ExpirationManager) updatePendingInternal(le *leaseEntry, leaseTotal tim
 			m.expireFunc(m.quitContext, m, le)
 		})
 		pending = pendingInfo{
-			timer: timer,
+			timer:     timer,
+			mountPath: m.leaseMountPath(le),
 		}
+		m.leaseCounts[pending.mountPath]++
 	}
 
 	// Extend the timer by the lease total
@@ -1353,6 +1376,88 @@ func (m *ExpirationManager) updatePendingInternal(le *leaseEntry, leaseTotal tim
 	m.pending[le.LeaseID] = pending
 }
 
+// removePendingLocked removes a lease from the pending map and the lease
+// count index; do not call this without a write lock on m.pending
+func (m *ExpirationManager) removePendingLocked(leaseID string, pending pendingInfo) {
+	delete(m.pending, leaseID)
+
+	m.leaseCounts[pending.mountPath]--
+	if m.leaseCounts[pending.mountPath] <= 0 {
+		delete(m.leaseCounts, pending.mountPath)
+	}
+}
+
+// leaseMountPath returns the path, including the namespace path, of the mount
+// the given lease was created on
+func (m *ExpirationManager) leaseMountPath(le *leaseEntry) string {
+	ns := le.namespace
+	if ns == nil {
+		ns = namespace.RootNamespace
+	}
+	return m.router.MatchingMount(namespace.ContextWithNamespace(m.quitContext, ns), le.Path)
+}
+
+// LeaseCount returns the number of pending leases held under the given mount
+// or namespace path. An empty path counts all the pending leases.
+func (m *ExpirationManager) LeaseCount(path string) int {
+	m.pendingLock.RLock()
+	defer m.pendingLock.RUnlock()
+
+	if path == "" {
+		return len(m.pending)
+	}
+
+	var count int
+	for mountPath, mountCount := range m.leaseCounts {
+		if strings.HasPrefix(mountPath, path) {
+			count += mountCount
+		}
+	}
+	return count
+}
+
+// LeaseCountsByMount returns the number of pending leases of every mount that
+// holds any, keyed by the mount path including the namespace path.
+func (m *ExpirationManager) LeaseCountsByMount() map[string]int {
+	m.pendingLock.RLock()
+	defer m.pendingLock.RUnlock()
+
+	counts := make(map[string]int, len(m.leaseCounts))
+	for mountPath, count := range m.leaseCounts {
+		counts[mountPath] = count
+	}
+	return counts
+}
+
+// checkLeaseCountQuota returns an error wrapping
+// quotas.ErrLeaseCountQuotaExceeded if registering the given lease would
+// exceed the lease count quota that applies to it.
+func (m *ExpirationManager) checkLeaseCountQuota(le *leaseEntry) error {
+	if m.core.quotaManager == nil {
+		return nil
+	}
+
+	ns := le.namespace
+	if ns == nil {
+		ns = namespace.RootNamespace
+	}
+	resp, err := m.core.quotaManager.ApplyQuota(&quotas.Request{
+		Type:          quotas.TypeLeaseCount,
+		Path:          le.Path,
+		NamespacePath: ns.Path,
+		MountPath:     m.leaseMountPath(le),
+		LeaseCount:    m.LeaseCount,
+	})
+	if err != nil {
+		return err
+	}
+	if !resp.Allowed {
+		return errwrap.Wrapf("{{err}}: "+resp.Message, quotas.ErrLeaseCountQuotaExceeded)
+	}
+
+	return nil
+}
+
 // revokeEntry is used to attempt revocation of an internal entry
 func (m *ExpirationManager) revokeEntry(ctx context.Context, le *leaseEntry) error {
 	// Revocation of login tokens is special since we can by-pass the
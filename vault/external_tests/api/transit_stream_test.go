@@ -0,0 +1,62 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestTransit_Stream(t *testing.T) {
+	client, closer := testVaultServer(t)
+	defer closer()
+
+	if err := client.Sys().Mount("transit", &api.MountInput{
+		Type: "transit",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Logical().Write("transit/keys/backup", map[string]interface{}{
+		"derived": true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 5*1024*1024+7)
+	if _, err := rand.Read(plaintext); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	opts := &api.TransitStreamOptions{
+		Context:   []byte("backups"),
+		ChunkSize: 256 * 1024,
+	}
+
+	var ciphertext bytes.Buffer
+	if err := client.Transit().EncryptStream(ctx, "backup", bytes.NewReader(plaintext), &ciphertext, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	var decrypted bytes.Buffer
+	if err := client.Transit().DecryptStream(ctx, "backup", bytes.NewReader(ciphertext.Bytes()), &decrypted, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted.Bytes(), plaintext) {
+		t.Fatal("bad plaintext after round trip")
+	}
+
+	// Errors before the output starts are returned as regular errors
+	if err := client.Transit().EncryptStream(ctx, "backup", bytes.NewReader(plaintext), &bytes.Buffer{}, nil); err == nil {
+		t.Fatal("expected error encrypting without the derivation context")
+	}
+
+	// Errors after the output started are reported through the trailer
+	truncated := ciphertext.Bytes()[:ciphertext.Len()-100]
+	decrypted.Reset()
+	if err := client.Transit().DecryptStream(ctx, "backup", bytes.NewReader(truncated), &decrypted, opts); err == nil {
+		t.Fatal("expected error decrypting a truncated stream")
+	}
+}
@@ -198,6 +198,37 @@ func TestRaft_Configuration(t *testing.T) {
 	}
 }
 
+func TestRaft_AutopilotState(t *testing.T) {
+	cluster := raftCluster(t)
+	defer cluster.Cleanup()
+
+	client := cluster.Cores[0].Client
+	secret, err := client.Logical().Read("sys/storage/raft/autopilot/state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leader := secret.Data["leader"].(string); leader != "core-0" {
+		t.Fatalf("bad leader: %q", leader)
+	}
+	servers := secret.Data["servers"].([]interface{})
+	if len(servers) != 3 {
+		t.Fatalf("incorrect number of servers in the state: %#v", servers)
+	}
+	for _, s := range servers {
+		server := s.(map[string]interface{})
+		switch server["node_id"].(string) {
+		case "core-0":
+			if server["status"].(string) != "leader" || !server["healthy"].(bool) {
+				t.Fatalf("bad leader state: %#v", server)
+			}
+		default:
+			if server["status"].(string) != "voter" {
+				t.Fatalf("bad server state: %#v", server)
+			}
+		}
+	}
+}
+
 func TestRaft_ShamirUnseal(t *testing.T) {
 	cluster := raftCluster(t)
 	defer cluster.Cleanup()
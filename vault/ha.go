@@ -462,6 +462,22 @@ func (c *Core) waitForLeadership(newLeaderCh chan func(), manualStepDownCh, stop
 		c.activeContext = activeCtx
 		c.activeContextCancelFunc.Store(activeCtxCancel)
 
+		// If this node was unsealed in seal migration mode, migrate the
+		// stored keys to the new seal before the seal state is reloaded. If
+		// that fails we seal, as the new seal cannot unwrap the stored keys.
+		if c.migrationInfo != nil {
+			if err := c.migrateSeal(activeCtx); err != nil {
+				c.logger.Error("error migrating seal", "error", err)
+				go c.Shutdown()
+				c.heldHALock = nil
+				lock.Unlock()
+				close(continueCh)
+				c.stateLock.Unlock()
+				metrics.MeasureSince([]string{"core", "leadership_setup_failed"}, activeTime)
+				continue
+			}
+		}
+
 		// This block is used to wipe barrier/seal state and verify that
 		// everything is sane. If we have no sanity in the barrier, we actually
 		// seal, as there's little we can do.
@@ -80,6 +80,9 @@ func NewIdentityStore(ctx context.Context, core *Core, config *logical.BackendCo
 		PathsSpecial: &logical.Paths{
 			Unauthenticated: []string{
 				"oidc/.well-known/*",
+				"oidc/provider/+/.well-known/*",
+				"oidc/provider/+/token",
+				"oidc/provider/+/userinfo",
 			},
 		},
 		PeriodicFunc: func(ctx context.Context, req *logical.Request) error {
@@ -108,6 +111,8 @@ func (i *IdentityStore) paths() []*framework.Path {
 		lookupPaths(i),
 		upgradePaths(i),
 		oidcPaths(i),
+		oidcProviderPaths(i),
+		scimPaths(i),
 	)
 }
 
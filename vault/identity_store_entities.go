@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/golang/protobuf/ptypes"
@@ -122,6 +123,18 @@ func entityPaths(i *IdentityStore) []*framework.Path {
 					Type:        framework.TypeBool,
 					Description: "Setting this will follow the 'mine' strategy for merging MFA secrets. If there are secrets of the same type both in entities that are merged from and in entity into which all others are getting merged, secrets in the destination will be unaltered. If not set, this API will throw an error containing all the conflicts.",
 				},
+				"dry_run": {
+					Type:        framework.TypeBool,
+					Description: "If set, the entities are not merged. Instead, the aliases of different entities on the same mount, the group memberships moving to the entity merged into and the conflicting metadata keys are returned.",
+				},
+				"conflicting_alias_ids_to_keep": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Alias IDs to keep on mounts where more than one of the entities has an alias. If set, at least one alias must be kept on each such mount, and the other aliases on these mounts are deleted. If not set, all the aliases are kept.",
+				},
+				"metadata_key_sources": {
+					Type:        framework.TypeKVPairs,
+					Description: "Metadata keys mapped to the ID of the entity whose value is kept for that key. Metadata keys not set on the entity merged into are copied from the entities merged from, and conflicting keys not listed here keep the value of the entity merged into.",
+				},
 			},
 			Callbacks: map[logical.Operation]framework.OperationFunc{
 				logical.UpdateOperation: i.pathEntityMergeID(),
@@ -148,16 +161,48 @@ func (i *IdentityStore) pathEntityMergeID() framework.OperationFunc {
 
 		force := d.Get("force").(bool)
 
-		// Create a MemDB transaction to merge entities
-		txn := i.db.Txn(true)
-		defer txn.Abort()
-
 		toEntity, err := i.MemDBEntityByID(toEntityID, true)
 		if err != nil {
 			return nil, err
 		}
 
-		userErr, intErr := i.mergeEntity(ctx, txn, toEntity, fromEntityIDs, force, true, false, true)
+		if d.Get("dry_run").(bool) {
+			i.lock.RLock()
+			defer i.lock.RUnlock()
+
+			txn := i.db.Txn(false)
+			defer txn.Abort()
+
+			report, userErr, intErr := i.entityMergeReport(ctx, txn, toEntity, fromEntityIDs)
+			if userErr != nil {
+				return logical.ErrorResponse(userErr.Error()), nil
+			}
+			if intErr != nil {
+				return nil, intErr
+			}
+
+			return &logical.Response{
+				Data: report.responseData(),
+			}, nil
+		}
+
+		// The conflicts are only resolved when asked to, so that merges
+		// which do not resolve them behave as they always did
+		var resolution *entityMergeResolution
+		aliasIDsToKeep := d.Get("conflicting_alias_ids_to_keep").([]string)
+		metadataSources := d.Get("metadata_key_sources").(map[string]string)
+		if len(aliasIDsToKeep) > 0 || len(metadataSources) > 0 {
+			resolution = &entityMergeResolution{
+				aliasIDsToKeep:  aliasIDsToKeep,
+				metadataSources: metadataSources,
+			}
+		}
+
+		// Create a MemDB transaction to merge entities
+		txn := i.db.Txn(true)
+		defer txn.Abort()
+
+		userErr, intErr := i.mergeEntity(ctx, txn, toEntity, fromEntityIDs, force, true, false, true, resolution)
 		if userErr != nil {
 			return logical.ErrorResponse(userErr.Error()), nil
 		}
@@ -608,7 +653,10 @@ func (i *IdentityStore) handlePathEntityListCommon(ctx context.Context, req *log
 	return logical.ListResponseWithInfo(keys, entityInfo), nil
 }
 
-func (i *IdentityStore) mergeEntity(ctx context.Context, txn *memdb.Txn, toEntity *identity.Entity, fromEntityIDs []string, force, grabLock, mergePolicies, persist bool) (error, error) {
+// mergeEntity merges the entities with the given IDs into toEntity. When
+// resolution is set, the conflicts between the entities are resolved and the
+// group memberships and metadata of the entities merged from are moved too.
+func (i *IdentityStore) mergeEntity(ctx context.Context, txn *memdb.Txn, toEntity *identity.Entity, fromEntityIDs []string, force, grabLock, mergePolicies, persist bool, resolution *entityMergeResolution) (error, error) {
 	if grabLock {
 		i.lock.Lock()
 		defer i.lock.Unlock()
@@ -659,6 +707,36 @@ func (i *IdentityStore) mergeEntity(ctx context.Context, txn *memdb.Txn, toEntit
 	}
 
 	isPerfSecondaryOrStandby := i.core.ReplicationState().HasState(consts.ReplicationPerformanceSecondary) || i.core.perfStandby
+
+	var aliasIDsToDelete map[string]bool
+	if resolution != nil {
+		report, userErr, intErr := i.entityMergeReport(ctx, txn, toEntity, fromEntityIDs)
+		if userErr != nil || intErr != nil {
+			return userErr, intErr
+		}
+
+		aliasIDsToDelete, err = resolution.aliasIDsToDelete(report)
+		if err != nil {
+			return err, nil
+		}
+
+		if err := resolution.mergeMetadata(report, toEntity); err != nil {
+			return err, nil
+		}
+
+		var aliases []*identity.Alias
+		for _, alias := range toEntity.Aliases {
+			if !aliasIDsToDelete[alias.ID] {
+				aliases = append(aliases, alias)
+				continue
+			}
+			if err := i.MemDBDeleteAliasByIDInTxn(txn, alias.ID, false); err != nil {
+				return nil, err
+			}
+		}
+		toEntity.Aliases = aliases
+	}
+
 	for _, fromEntityID := range fromEntityIDs {
 		if fromEntityID == toEntity.ID {
 			return errors.New("to_entity_id should not be present in from_entity_ids"), nil
@@ -678,6 +756,14 @@ func (i *IdentityStore) mergeEntity(ctx context.Context, txn *memdb.Txn, toEntit
 		}
 
 		for _, alias := range fromEntity.Aliases {
+			if aliasIDsToDelete[alias.ID] {
+				err = i.MemDBDeleteAliasByIDInTxn(txn, alias.ID, false)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+
 			// Set the desired canonical ID
 			alias.CanonicalID = toEntity.ID
 
@@ -697,6 +783,24 @@ func (i *IdentityStore) mergeEntity(ctx context.Context, txn *memdb.Txn, toEntit
 			toEntity.Policies = strutil.MergeSlices(toEntity.Policies, fromEntity.Policies)
 		}
 
+		// Move the group memberships over to the entity we are merging into
+		if resolution != nil {
+			groups, err := i.MemDBGroupsByMemberEntityIDInTxn(txn, fromEntity.ID, true, false)
+			if err != nil {
+				return nil, err
+			}
+			for _, group := range groups {
+				group.MemberEntityIDs = strutil.StrListDelete(group.MemberEntityIDs, fromEntity.ID)
+				if !strutil.StrListContains(group.MemberEntityIDs, toEntity.ID) {
+					group.MemberEntityIDs = append(group.MemberEntityIDs, toEntity.ID)
+				}
+				err = i.UpsertGroupInTxn(ctx, txn, group, persist && !isPerfSecondaryOrStandby)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
 		// If the entity from which we are merging from was already a merged
 		// entity, transfer over the Merged set to the entity we are
 		// merging into.
@@ -747,6 +851,266 @@ func (i *IdentityStore) mergeEntity(ctx context.Context, txn *memdb.Txn, toEntit
 	return nil, nil
 }
 
+// entityMergeResolution holds how the conflicts between the entities merged
+// through the API are resolved
+type entityMergeResolution struct {
+	// aliasIDsToKeep are the aliases kept on mounts where more than one of
+	// the entities has an alias. If empty, all the aliases are kept.
+	aliasIDsToKeep []string
+
+	// metadataSources maps metadata keys to the ID of the entity whose value
+	// is kept
+	metadataSources map[string]string
+}
+
+// entityMergeReport describes what merging entities changes
+type entityMergeReport struct {
+	// entities are the entity merged into followed by the entities merged
+	// from
+	entities []*identity.Entity
+
+	// aliasConflicts maps the mount accessors on which more than one of the
+	// entities has an alias to these aliases
+	aliasConflicts map[string][]*identity.Alias
+
+	// groupMemberships maps the IDs of the entities merged from to the groups
+	// they are members of
+	groupMemberships map[string][]*identity.Group
+
+	// metadataConflicts maps the metadata keys set to different values by
+	// the entities to the value of each entity
+	metadataConflicts map[string]map[string]string
+}
+
+// entityMergeReport validates the entities to merge and reports the aliases,
+// group memberships and metadata affected by merging them
+func (i *IdentityStore) entityMergeReport(ctx context.Context, txn *memdb.Txn, toEntity *identity.Entity, fromEntityIDs []string) (*entityMergeReport, error, error) {
+	if toEntity == nil {
+		return nil, errors.New("entity id to merge to is invalid"), nil
+	}
+
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if toEntity.NamespaceID != ns.ID {
+		return nil, errors.New("entity id to merge into does not belong to the request's namespace"), nil
+	}
+
+	report := &entityMergeReport{
+		entities:          []*identity.Entity{toEntity},
+		aliasConflicts:    make(map[string][]*identity.Alias),
+		groupMemberships:  make(map[string][]*identity.Group),
+		metadataConflicts: make(map[string]map[string]string),
+	}
+
+	for _, fromEntityID := range fromEntityIDs {
+		if fromEntityID == toEntity.ID {
+			return nil, errors.New("to_entity_id should not be present in from_entity_ids"), nil
+		}
+
+		fromEntity, err := i.MemDBEntityByIDInTxn(txn, fromEntityID, false)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if fromEntity == nil {
+			return nil, errors.New("entity id to merge from is invalid"), nil
+		}
+
+		if fromEntity.NamespaceID != toEntity.NamespaceID {
+			return nil, errors.New("entity id to merge from does not belong to this namespace"), nil
+		}
+
+		groups, err := i.MemDBGroupsByMemberEntityIDInTxn(txn, fromEntity.ID, false, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(groups) > 0 {
+			report.groupMemberships[fromEntity.ID] = groups
+		}
+
+		report.entities = append(report.entities, fromEntity)
+	}
+
+	aliasesByMount := make(map[string][]*identity.Alias)
+	entitiesByMount := make(map[string]map[string]bool)
+	metadata := make(map[string]map[string]string)
+	for _, entity := range report.entities {
+		for _, alias := range entity.Aliases {
+			aliasesByMount[alias.MountAccessor] = append(aliasesByMount[alias.MountAccessor], alias)
+			if entitiesByMount[alias.MountAccessor] == nil {
+				entitiesByMount[alias.MountAccessor] = make(map[string]bool)
+			}
+			entitiesByMount[alias.MountAccessor][entity.ID] = true
+		}
+		for key, value := range entity.Metadata {
+			if metadata[key] == nil {
+				metadata[key] = make(map[string]string)
+			}
+			metadata[key][entity.ID] = value
+		}
+	}
+
+	for mountAccessor, entityIDs := range entitiesByMount {
+		if len(entityIDs) > 1 {
+			report.aliasConflicts[mountAccessor] = aliasesByMount[mountAccessor]
+		}
+	}
+
+	for key, values := range metadata {
+		distinct := make(map[string]bool)
+		for _, value := range values {
+			distinct[value] = true
+		}
+		if len(distinct) > 1 {
+			report.metadataConflicts[key] = values
+		}
+	}
+
+	return report, nil, nil
+}
+
+// conflictingMountAccessors returns the sorted mount accessors on which more
+// than one of the entities has an alias
+func (r *entityMergeReport) conflictingMountAccessors() []string {
+	ret := make([]string, 0, len(r.aliasConflicts))
+	for mountAccessor := range r.aliasConflicts {
+		ret = append(ret, mountAccessor)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (r *entityMergeReport) responseData() map[string]interface{} {
+	aliasConflicts := make([]interface{}, 0, len(r.aliasConflicts))
+	for _, mountAccessor := range r.conflictingMountAccessors() {
+		aliases := make([]interface{}, 0, len(r.aliasConflicts[mountAccessor]))
+		var mountType string
+		for _, alias := range r.aliasConflicts[mountAccessor] {
+			mountType = alias.MountType
+			aliases = append(aliases, map[string]interface{}{
+				"id":        alias.ID,
+				"name":      alias.Name,
+				"entity_id": alias.CanonicalID,
+			})
+		}
+		aliasConflicts = append(aliasConflicts, map[string]interface{}{
+			"mount_accessor": mountAccessor,
+			"mount_type":     mountType,
+			"aliases":        aliases,
+		})
+	}
+
+	groupMemberships := make([]interface{}, 0, len(r.groupMemberships))
+	for _, entity := range r.entities[1:] {
+		for _, group := range r.groupMemberships[entity.ID] {
+			groupMemberships = append(groupMemberships, map[string]interface{}{
+				"group_id":   group.ID,
+				"group_name": group.Name,
+				"entity_id":  entity.ID,
+			})
+		}
+	}
+
+	metadataKeys := make([]string, 0, len(r.metadataConflicts))
+	for key := range r.metadataConflicts {
+		metadataKeys = append(metadataKeys, key)
+	}
+	sort.Strings(metadataKeys)
+
+	metadataConflicts := make([]interface{}, 0, len(r.metadataConflicts))
+	for _, key := range metadataKeys {
+		metadataConflicts = append(metadataConflicts, map[string]interface{}{
+			"key":    key,
+			"values": r.metadataConflicts[key],
+		})
+	}
+
+	return map[string]interface{}{
+		"alias_conflicts":    aliasConflicts,
+		"group_memberships":  groupMemberships,
+		"metadata_conflicts": metadataConflicts,
+	}
+}
+
+// aliasIDsToDelete returns the aliases to delete from the mounts where more
+// than one of the entities has an alias
+func (r *entityMergeResolution) aliasIDsToDelete(report *entityMergeReport) (map[string]bool, error) {
+	if len(r.aliasIDsToKeep) == 0 {
+		return nil, nil
+	}
+
+	keep := make(map[string]bool, len(r.aliasIDsToKeep))
+	for _, aliasID := range r.aliasIDsToKeep {
+		keep[aliasID] = true
+	}
+
+	toDelete := make(map[string]bool)
+	for _, mountAccessor := range report.conflictingMountAccessors() {
+		var kept bool
+		for _, alias := range report.aliasConflicts[mountAccessor] {
+			if keep[alias.ID] {
+				kept = true
+				delete(keep, alias.ID)
+			} else {
+				toDelete[alias.ID] = true
+			}
+		}
+		if !kept {
+			return nil, fmt.Errorf("no alias to keep on mount %q, which has aliases of more than one entity", mountAccessor)
+		}
+	}
+
+	if len(keep) > 0 {
+		unknown := make([]string, 0, len(keep))
+		for aliasID := range keep {
+			unknown = append(unknown, aliasID)
+		}
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("alias IDs %q are not conflicting aliases of the entities", unknown)
+	}
+
+	return toDelete, nil
+}
+
+// mergeMetadata copies the metadata keys of the entities merged from which
+// are not set on toEntity, then applies the chosen values of conflicting keys
+func (r *entityMergeResolution) mergeMetadata(report *entityMergeReport, toEntity *identity.Entity) error {
+	entities := make(map[string]*identity.Entity, len(report.entities))
+	for _, entity := range report.entities {
+		entities[entity.ID] = entity
+	}
+
+	for key, entityID := range r.metadataSources {
+		entity, ok := entities[entityID]
+		if !ok {
+			return fmt.Errorf("entity %q of metadata key %q is not one of the merged entities", entityID, key)
+		}
+		if _, ok := entity.Metadata[key]; !ok {
+			return fmt.Errorf("entity %q does not have metadata key %q", entityID, key)
+		}
+	}
+
+	for _, entity := range report.entities[1:] {
+		for key, value := range entity.Metadata {
+			if _, ok := toEntity.Metadata[key]; ok {
+				continue
+			}
+			if toEntity.Metadata == nil {
+				toEntity.Metadata = make(map[string]string)
+			}
+			toEntity.Metadata[key] = value
+		}
+	}
+
+	for key, entityID := range r.metadataSources {
+		toEntity.Metadata[key] = entities[entityID].Metadata[key]
+	}
+
+	return nil
+}
+
 var entityHelp = map[string][2]string{
 	"entity": {
 		"Create a new entity",
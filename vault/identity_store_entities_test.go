@@ -895,6 +895,165 @@ func TestIdentityStore_EntityCRUD(t *testing.T) {
 	}
 }
 
+func TestIdentityStore_MergeEntitiesByID_Conflicts(t *testing.T) {
+	ctx := namespace.RootContext(nil)
+	is, githubAccessor, _ := testIdentityStoreWithGithubAuth(ctx, t)
+
+	handle := func(path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := is.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp
+	}
+
+	entityID1 := handle("entity", map[string]interface{}{
+		"name":     "entity1",
+		"metadata": []string{"team=vault", "region=us"},
+	}).Data["id"].(string)
+	aliasID1 := handle("entity-alias", map[string]interface{}{
+		"name":           "user1",
+		"mount_accessor": githubAccessor,
+		"canonical_id":   entityID1,
+	}).Data["id"].(string)
+
+	entityID2 := handle("entity", map[string]interface{}{
+		"name":     "entity2",
+		"metadata": []string{"team=consul", "org=hashicorp"},
+	}).Data["id"].(string)
+	aliasID2 := handle("entity-alias", map[string]interface{}{
+		"name":           "user2",
+		"mount_accessor": githubAccessor,
+		"canonical_id":   entityID2,
+	}).Data["id"].(string)
+
+	groupID := handle("group", map[string]interface{}{
+		"name":              "group1",
+		"member_entity_ids": []string{entityID2},
+	}).Data["id"].(string)
+
+	// A dry run reports the conflicts without merging
+	resp := handle("entity/merge", map[string]interface{}{
+		"to_entity_id":    entityID1,
+		"from_entity_ids": []string{entityID2},
+		"dry_run":         true,
+	})
+	aliasConflicts := resp.Data["alias_conflicts"].([]interface{})
+	if len(aliasConflicts) != 1 {
+		t.Fatalf("expected 1 alias conflict, got %#v", aliasConflicts)
+	}
+	conflict := aliasConflicts[0].(map[string]interface{})
+	if conflict["mount_accessor"] != githubAccessor || len(conflict["aliases"].([]interface{})) != 2 {
+		t.Fatalf("bad alias conflict: %#v", conflict)
+	}
+	groupMemberships := resp.Data["group_memberships"].([]interface{})
+	if len(groupMemberships) != 1 || groupMemberships[0].(map[string]interface{})["group_id"] != groupID {
+		t.Fatalf("bad group memberships: %#v", groupMemberships)
+	}
+	metadataConflicts := resp.Data["metadata_conflicts"].([]interface{})
+	expectedConflict := map[string]interface{}{
+		"key":    "team",
+		"values": map[string]string{entityID1: "vault", entityID2: "consul"},
+	}
+	if len(metadataConflicts) != 1 || !reflect.DeepEqual(metadataConflicts[0], expectedConflict) {
+		t.Fatalf("bad metadata conflicts: %#v", metadataConflicts)
+	}
+	entity2, err := is.MemDBEntityByID(entityID2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entity2 == nil {
+		t.Fatal("expected entity not to be merged by a dry run")
+	}
+
+	// Every conflicting mount must keep an alias
+	resp, err = is.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "entity/merge",
+		Data: map[string]interface{}{
+			"to_entity_id":                  entityID1,
+			"from_entity_ids":               []string{entityID2},
+			"conflicting_alias_ids_to_keep": []string{"unknown"},
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error, got err:%v resp:%#v", err, resp)
+	}
+
+	handle("entity/merge", map[string]interface{}{
+		"to_entity_id":                  entityID1,
+		"from_entity_ids":               []string{entityID2},
+		"conflicting_alias_ids_to_keep": []string{aliasID1},
+		"metadata_key_sources":          []string{"team=" + entityID2},
+	})
+
+	entity1, err := is.MemDBEntityByID(entityID1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entity1.Aliases) != 1 || entity1.Aliases[0].ID != aliasID1 {
+		t.Fatalf("bad aliases: %#v", entity1.Aliases)
+	}
+	alias2, err := is.MemDBAliasByID(aliasID2, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alias2 != nil {
+		t.Fatal("expected conflicting alias to be deleted")
+	}
+	expectedMetadata := map[string]string{
+		"team":   "consul",
+		"region": "us",
+		"org":    "hashicorp",
+	}
+	if !reflect.DeepEqual(entity1.Metadata, expectedMetadata) {
+		t.Fatalf("bad metadata: %#v", entity1.Metadata)
+	}
+
+	group, err := is.MemDBGroupByID(groupID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(group.MemberEntityIDs, []string{entityID1}) {
+		t.Fatalf("bad group members: %#v", group.MemberEntityIDs)
+	}
+
+	// Without a resolution, the group memberships and metadata are not moved
+	entityID3 := handle("entity", map[string]interface{}{
+		"name":     "entity3",
+		"metadata": []string{"site=eu"},
+	}).Data["id"].(string)
+	groupID2 := handle("group", map[string]interface{}{
+		"name":              "group2",
+		"member_entity_ids": []string{entityID3},
+	}).Data["id"].(string)
+
+	handle("entity/merge", map[string]interface{}{
+		"to_entity_id":    entityID1,
+		"from_entity_ids": []string{entityID3},
+	})
+
+	entity1, err = is.MemDBEntityByID(entityID1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entity1.Metadata, expectedMetadata) {
+		t.Fatalf("bad metadata: %#v", entity1.Metadata)
+	}
+	group, err = is.MemDBGroupByID(groupID2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(group.MemberEntityIDs, []string{entityID3}) {
+		t.Fatalf("bad group members: %#v", group.MemberEntityIDs)
+	}
+}
+
 func TestIdentityStore_MergeEntitiesByID(t *testing.T) {
 	var err error
 	var resp *logical.Response
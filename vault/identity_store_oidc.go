@@ -331,23 +331,7 @@ func (i *IdentityStore) pathOIDCUpdateConfig(ctx context.Context, req *logical.R
 	issuer := issuerRaw.(string)
 
 	if issuer != "" {
-		// verify that issuer is the correct format:
-		//   - http or https
-		//   - host name
-		//   - optional port
-		//   - nothing more
-		valid := false
-		if u, err := url.Parse(issuer); err == nil {
-			u2 := url.URL{
-				Scheme: u.Scheme,
-				Host:   u.Host,
-			}
-			valid = (*u == u2) &&
-				(u.Scheme == "http" || u.Scheme == "https") &&
-				u.Host != ""
-		}
-
-		if !valid {
+		if !validIssuer(issuer) {
 			return logical.ErrorResponse(
 				"invalid issuer, which must include only a scheme, host, " +
 					"and optional port (e.g. https://example.com:8200)"), nil
@@ -381,6 +365,25 @@ func (i *IdentityStore) pathOIDCUpdateConfig(ctx context.Context, req *logical.R
 	return resp, nil
 }
 
+// validIssuer verifies that issuer is the correct format:
+//   - http or https
+//   - host name
+//   - optional port
+//   - nothing more
+func validIssuer(issuer string) bool {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return false
+	}
+	u2 := url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+	}
+	return (*u == u2) &&
+		(u.Scheme == "http" || u.Scheme == "https") &&
+		u.Host != ""
+}
+
 func (i *IdentityStore) getOIDCConfig(ctx context.Context, s logical.Storage) (*oidcConfig, error) {
 	ns, err := namespace.FromContext(ctx)
 	if err != nil {
@@ -592,6 +595,27 @@ func (i *IdentityStore) pathOIDCDeleteKey(ctx context.Context, req *logical.Requ
 		return logical.ErrorResponse(errorMessage), logical.ErrInvalidRequest
 	}
 
+	// it is also an error to delete a key that is referenced by a client
+	clients, err := i.listOIDCClients(ctx, req.Storage)
+	if err != nil {
+		i.oidcLock.Unlock()
+		return nil, err
+	}
+
+	clientsReferencingTargetKeyName := make([]string, 0)
+	for _, client := range clients {
+		if client.Key == targetKeyName {
+			clientsReferencingTargetKeyName = append(clientsReferencingTargetKeyName, client.Name)
+		}
+	}
+
+	if len(clientsReferencingTargetKeyName) > 0 {
+		errorMessage := fmt.Sprintf("unable to delete key %q because it is currently referenced by these clients: %s",
+			targetKeyName, strings.Join(clientsReferencingTargetKeyName, ", "))
+		i.oidcLock.Unlock()
+		return logical.ErrorResponse(errorMessage), logical.ErrInvalidRequest
+	}
+
 	// key can safely be deleted now
 	err = req.Storage.Delete(ctx, namedKeyConfigPath+targetKeyName)
 	if err != nil {
@@ -700,29 +724,14 @@ func (i *IdentityStore) pathOIDCGenerateToken(ctx context.Context, req *logical.
 		return logical.ErrorResponse("role %q not found", roleName), nil
 	}
 
-	var key *namedKey
-
-	keyRaw, found, err := i.oidcCache.Get(ns, "namedKeys/"+role.Key)
+	key, err := i.getNamedKey(ctx, req.Storage, role.Key)
 	if err != nil {
 		return nil, err
 	}
-
-	if found {
-		key = keyRaw.(*namedKey)
-	} else {
-		entry, _ := req.Storage.Get(ctx, namedKeyConfigPath+role.Key)
-		if entry == nil {
-			return logical.ErrorResponse("key %q not found", role.Key), nil
-		}
-
-		if err := entry.DecodeJSON(&key); err != nil {
-			return nil, err
-		}
-
-		if err := i.oidcCache.SetDefault(ns, "namedKeys/"+role.Key, key); err != nil {
-			return nil, err
-		}
+	if key == nil {
+		return logical.ErrorResponse("key %q not found", role.Key), nil
 	}
+
 	// Validate that the role is allowed to sign with its key (the key could have been updated)
 	if !strutil.StrListContains(key.AllowedClientIDs, "*") && !strutil.StrListContains(key.AllowedClientIDs, role.ClientID) {
 		return logical.ErrorResponse("the key %q does not list the client ID of the role %q as an allowed client ID", role.Key, roleName), nil
@@ -782,6 +791,43 @@ func (i *IdentityStore) pathOIDCGenerateToken(ctx context.Context, req *logical.
 	}, nil
 }
 
+// getNamedKey loads the named key used to sign tokens, or returns nil if it
+// does not exist
+func (i *IdentityStore) getNamedKey(ctx context.Context, s logical.Storage, name string) (*namedKey, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keyRaw, found, err := i.oidcCache.Get(ns, "namedKeys/"+name)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return keyRaw.(*namedKey), nil
+	}
+
+	entry, err := s.Get(ctx, namedKeyConfigPath+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var key *namedKey
+	if err := entry.DecodeJSON(&key); err != nil {
+		return nil, err
+	}
+	key.name = name
+
+	if err := i.oidcCache.SetDefault(ns, "namedKeys/"+name, key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
 func (tok *idToken) generatePayload(logger hclog.Logger, template string, entity *identity.Entity, groups []*identity.Group) ([]byte, error) {
 	output := map[string]interface{}{
 		"iss":       tok.Issuer,
@@ -795,6 +841,19 @@ func (tok *idToken) generatePayload(logger hclog.Logger, template string, entity
 	// Parse and integrate the populated role template. Structural errors with the template _should_
 	// be caught during role configuration. Error found during runtime will be logged, but they will
 	// not block generation of the basic ID token. They should not be returned to the requester.
+	populateTemplateClaims(logger, output, template, requiredClaims, entity, groups)
+
+	payload, err := json.Marshal(output)
+	if err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// populateTemplateClaims merges the claims of the populated template into
+// claims, skipping the restricted claims. Errors are logged.
+func populateTemplateClaims(logger hclog.Logger, claims map[string]interface{}, template string, restrictedClaims []string, entity *identity.Entity, groups []*identity.Group) {
 	_, populatedTemplate, err := identitytpl.PopulateString(identitytpl.PopulateStringInput{
 		Mode:   identitytpl.JSONTemplating,
 		String: template,
@@ -814,20 +873,13 @@ func (tok *idToken) generatePayload(logger hclog.Logger, template string, entity
 		}
 
 		for k, v := range parsed {
-			if !strutil.StrListContains(requiredClaims, k) {
-				output[k] = v
+			if !strutil.StrListContains(restrictedClaims, k) {
+				claims[k] = v
 			} else {
 				logger.Warn("invalid top level OIDC template key", "template", template, "key", k)
 			}
 		}
 	}
-
-	payload, err := json.Marshal(output)
-	if err != nil {
-		return nil, err
-	}
-
-	return payload, nil
 }
 
 func (k *namedKey) signPayload(payload []byte) (string, error) {
@@ -899,30 +951,8 @@ func (i *IdentityStore) pathOIDCCreateUpdateRole(ctx context.Context, req *logic
 	}
 
 	// Validate that template can be parsed and results in valid JSON
-	if role.Template != "" {
-		_, populatedTemplate, err := identitytpl.PopulateString(identitytpl.PopulateStringInput{
-			Mode:   identitytpl.JSONTemplating,
-			String: role.Template,
-			Entity: new(logical.Entity),
-			Groups: make([]*logical.Group, 0),
-			// namespace?
-		})
-
-		if err != nil {
-			return logical.ErrorResponse("error parsing template: %s", err.Error()), nil
-		}
-
-		var tmp map[string]interface{}
-		if err := json.Unmarshal([]byte(populatedTemplate), &tmp); err != nil {
-			return logical.ErrorResponse("error parsing template JSON: %s", err.Error()), nil
-		}
-
-		for key := range tmp {
-			if strutil.StrListContains(requiredClaims, key) {
-				return logical.ErrorResponse(`top level key %q not allowed. Restricted keys: %s`,
-					key, strings.Join(requiredClaims, ", ")), nil
-			}
-		}
+	if err := validateOIDCTemplate(role.Template, requiredClaims); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
 
 	if ttl, ok := d.GetOk("ttl"); ok {
@@ -956,6 +986,39 @@ func (i *IdentityStore) pathOIDCCreateUpdateRole(ctx context.Context, req *logic
 	return nil, nil
 }
 
+// validateOIDCTemplate checks that the template can be parsed, results in
+// valid JSON and does not set any of the restricted claims
+func validateOIDCTemplate(template string, restrictedClaims []string) error {
+	if template == "" {
+		return nil
+	}
+
+	_, populatedTemplate, err := identitytpl.PopulateString(identitytpl.PopulateStringInput{
+		Mode:   identitytpl.JSONTemplating,
+		String: template,
+		Entity: new(logical.Entity),
+		Groups: make([]*logical.Group, 0),
+		// namespace?
+	})
+	if err != nil {
+		return fmt.Errorf("error parsing template: %s", err.Error())
+	}
+
+	var tmp map[string]interface{}
+	if err := json.Unmarshal([]byte(populatedTemplate), &tmp); err != nil {
+		return fmt.Errorf("error parsing template JSON: %s", err.Error())
+	}
+
+	for key := range tmp {
+		if strutil.StrListContains(restrictedClaims, key) {
+			return fmt.Errorf(`top level key %q not allowed. Restricted keys: %s`,
+				key, strings.Join(restrictedClaims, ", "))
+		}
+	}
+
+	return nil
+}
+
 // handleOIDCReadRole is used to read an existing role
 func (i *IdentityStore) pathOIDCReadRole(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	name := d.Get("name").(string)
@@ -1594,6 +1657,10 @@ func (i *IdentityStore) oidcPeriodicFunc(ctx context.Context) {
 				i.Logger().Warn("error expiring OIDC public keys", "err", err)
 			}
 
+			if err := i.expireOIDCProviderTokens(ctx, s); err != nil {
+				i.Logger().Warn("error expiring OIDC provider tokens", "err", err)
+			}
+
 			if err := i.oidcCache.Flush(noNamespace); err != nil {
 				i.Logger().Error("error flushing oidc cache", "err", err)
 			}
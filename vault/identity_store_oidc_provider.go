@@ -0,0 +1,1423 @@
+package vault
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/identity"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/base62"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+)
+
+const (
+	scopeConfigPath    = oidcTokensPrefix + "scopes/"
+	clientConfigPath   = oidcTokensPrefix + "clients/"
+	providerConfigPath = oidcTokensPrefix + "providers/"
+	authCodePath       = oidcTokensPrefix + "auth_codes/"
+	accessTokenPath    = oidcTokensPrefix + "access_tokens/"
+
+	clientTypeConfidential = "confidential"
+	clientTypePublic       = "public"
+
+	codeChallengeMethodPlain = "plain"
+	codeChallengeMethodS256  = "S256"
+
+	// openIDScope is the scope that must be requested by OIDC clients
+	openIDScope = "openid"
+
+	// authCodeTTL is how long an authorization code can be exchanged for
+	// tokens after being issued
+	authCodeTTL = 5 * time.Minute
+)
+
+// providerReservedClaims are the claims of the tokens issued by a provider
+// which scope templates may not overwrite
+var providerReservedClaims = append([]string{"nonce", "auth_time", "at_hash", "c_hash"}, requiredClaims...)
+
+// scope is a set of claims templated from entity data that a client can
+// request from a provider.
+type scope struct {
+	Template    string `json:"template"`
+	Description string `json:"description"`
+}
+
+// client is an application relying on a provider to authenticate entities.
+type client struct {
+	Name           string        `json:"name"`
+	RedirectURIs   []string      `json:"redirect_uris"`
+	Key            string        `json:"key"`
+	IDTokenTTL     time.Duration `json:"id_token_ttl"`
+	AccessTokenTTL time.Duration `json:"access_token_ttl"`
+	Type           string        `json:"client_type"`
+	ClientID       string        `json:"client_id"`
+	ClientSecret   string        `json:"client_secret"`
+}
+
+// provider is an OpenID Connect provider issuing tokens to its clients with
+// the authorization code flow.
+type provider struct {
+	Issuer           string   `json:"issuer"`
+	AllowedClientIDs []string `json:"allowed_client_ids"`
+	ScopesSupported  []string `json:"scopes_supported"`
+
+	// effectiveIssuer is a calculated field and will be either Issuer (if
+	// that's set) or the issuer of the OIDC configuration, followed by the
+	// path of the provider.
+	effectiveIssuer string
+}
+
+// authCode is an authorization code issued to a client, stored under the
+// hash of the code.
+type authCode struct {
+	Provider            string    `json:"provider"`
+	ClientID            string    `json:"client_id"`
+	EntityID            string    `json:"entity_id"`
+	RedirectURI         string    `json:"redirect_uri"`
+	Scopes              []string  `json:"scopes"`
+	Nonce               string    `json:"nonce"`
+	CodeChallenge       string    `json:"code_challenge"`
+	CodeChallengeMethod string    `json:"code_challenge_method"`
+	AuthTime            int64     `json:"auth_time"`
+	ExpireAt            time.Time `json:"expire_at"`
+}
+
+// accessToken is an access token issued to a client for the userinfo
+// endpoint, stored under the hash of the token.
+type accessToken struct {
+	Provider string    `json:"provider"`
+	ClientID string    `json:"client_id"`
+	EntityID string    `json:"entity_id"`
+	Scopes   []string  `json:"scopes"`
+	ExpireAt time.Time `json:"expire_at"`
+}
+
+// providerDiscovery contains the provider metadata returned by the discovery
+// endpoint of a provider.
+//
+// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type providerDiscovery struct {
+	Issuer                string   `json:"issuer"`
+	Keys                  string   `json:"jwks_uri"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+	ScopesSupported       []string `json:"scopes_supported"`
+	ResponseTypes         []string `json:"response_types_supported"`
+	GrantTypes            []string `json:"grant_types_supported"`
+	Subjects              []string `json:"subject_types_supported"`
+	IDTokenAlgs           []string `json:"id_token_signing_alg_values_supported"`
+	AuthMethods           []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+func oidcProviderPaths(i *IdentityStore) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "oidc/scope/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the scope",
+				},
+				"template": {
+					Type:        framework.TypeString,
+					Description: "The template string to use for the claims of the scope. This may be in string-ified JSON or base64 format.",
+				},
+				"description": {
+					Type:        framework.TypeString,
+					Description: "The description of the scope.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: i.pathOIDCCreateUpdateScope,
+				logical.UpdateOperation: i.pathOIDCCreateUpdateScope,
+				logical.ReadOperation:   i.pathOIDCReadScope,
+				logical.DeleteOperation: i.pathOIDCDeleteScope,
+			},
+			ExistenceCheck:  i.pathOIDCScopeExistenceCheck,
+			HelpSynopsis:    "CRUD operations for OIDC scopes.",
+			HelpDescription: "Create, Read, Update, and Delete OIDC scopes. The claims of the scopes requested by a client are added to its ID tokens and userinfo responses.",
+		},
+		{
+			Pattern: "oidc/scope/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathOIDCListScope,
+			},
+			HelpSynopsis:    "List OIDC scopes",
+			HelpDescription: "List all configured OIDC scopes in the identity backend.",
+		},
+		{
+			Pattern: "oidc/client/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the client",
+				},
+				"redirect_uris": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Comma separated string or array of redirection URIs the client may use.",
+				},
+				"key": {
+					Type:        framework.TypeString,
+					Description: "The OIDC key to use for signing ID tokens. The specified key must already exist.",
+				},
+				"id_token_ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: "TTL of the ID tokens issued to the client.",
+					Default:     "24h",
+				},
+				"access_token_ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: "TTL of the access tokens issued to the client.",
+					Default:     "24h",
+				},
+				"client_type": {
+					Type:        framework.TypeString,
+					Description: `The client type, either "confidential" or "public". Public clients do not have a client secret. It cannot be changed once set.`,
+					Default:     clientTypeConfidential,
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: i.pathOIDCCreateUpdateClient,
+				logical.UpdateOperation: i.pathOIDCCreateUpdateClient,
+				logical.ReadOperation:   i.pathOIDCReadClient,
+				logical.DeleteOperation: i.pathOIDCDeleteClient,
+			},
+			ExistenceCheck:  i.pathOIDCClientExistenceCheck,
+			HelpSynopsis:    "CRUD operations for OIDC clients.",
+			HelpDescription: "Create, Read, Update, and Delete OIDC clients. Clients are the applications authenticating entities with OIDC providers.",
+		},
+		{
+			Pattern: "oidc/client/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathOIDCListClient,
+			},
+			HelpSynopsis:    "List OIDC clients",
+			HelpDescription: "List all configured OIDC clients in the identity backend.",
+		},
+		{
+			Pattern: "oidc/provider/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the provider",
+				},
+				"issuer": {
+					Type:        framework.TypeString,
+					Description: "Issuer URL to be used in the iss claim of the tokens. If not set, the issuer of the OIDC configuration will be used.",
+				},
+				"allowed_client_ids": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Comma separated string or array of client ids allowed to use the provider. If empty no clients are allowed. If \"*\" all clients are allowed.",
+				},
+				"scopes_supported": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Comma separated string or array of the scopes clients may request. The specified scopes must already exist.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: i.pathOIDCCreateUpdateProvider,
+				logical.UpdateOperation: i.pathOIDCCreateUpdateProvider,
+				logical.ReadOperation:   i.pathOIDCReadProvider,
+				logical.DeleteOperation: i.pathOIDCDeleteProvider,
+			},
+			ExistenceCheck:  i.pathOIDCProviderExistenceCheck,
+			HelpSynopsis:    "CRUD operations for OIDC providers.",
+			HelpDescription: "Create, Read, Update, and Delete OIDC providers. Providers authenticate entities for their clients with the authorization code flow.",
+		},
+		{
+			Pattern: "oidc/provider/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathOIDCListProvider,
+			},
+			HelpSynopsis:    "List OIDC providers",
+			HelpDescription: "List all configured OIDC providers in the identity backend.",
+		},
+		{
+			Pattern: "oidc/provider/" + framework.GenericNameRegex("name") + "/.well-known/openid-configuration/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the provider",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: i.pathOIDCProviderDiscovery,
+			},
+			HelpSynopsis:    "Query OIDC provider configuration",
+			HelpDescription: "Query this path to retrieve the metadata of the provider, including its endpoints, supported scopes, and signing algorithms.",
+		},
+		{
+			Pattern: "oidc/provider/" + framework.GenericNameRegex("name") + "/.well-known/keys/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the provider",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: i.pathOIDCProviderReadPublicKeys,
+			},
+			HelpSynopsis:    "Retrieve public keys of an OIDC provider",
+			HelpDescription: "Query this path to retrieve the public portion of the keys used to sign the ID tokens issued to the clients of the provider.",
+		},
+		{
+			Pattern: "oidc/provider/" + framework.GenericNameRegex("name") + "/authorize/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the provider",
+				},
+				"client_id": {
+					Type:        framework.TypeString,
+					Description: "The ID of the client requesting authorization.",
+				},
+				"redirect_uri": {
+					Type:        framework.TypeString,
+					Description: "The redirection URI the authorization code is sent to. It must be one of the redirect URIs of the client.",
+				},
+				"response_type": {
+					Type:        framework.TypeString,
+					Description: `The response type, which must be "code".`,
+				},
+				"scope": {
+					Type:        framework.TypeString,
+					Description: `Space separated list of the requested scopes, which must include "openid".`,
+				},
+				"state": {
+					Type:        framework.TypeString,
+					Description: "Opaque value returned with the authorization code.",
+				},
+				"nonce": {
+					Type:        framework.TypeString,
+					Description: "Value added to the ID token to mitigate replay attacks.",
+				},
+				"code_challenge": {
+					Type:        framework.TypeString,
+					Description: "The PKCE code challenge derived from the code verifier.",
+				},
+				"code_challenge_method": {
+					Type:        framework.TypeString,
+					Description: `The method used to derive the code challenge, either "S256" or "plain".`,
+					Default:     codeChallengeMethodPlain,
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   i.pathOIDCAuthorize,
+				logical.UpdateOperation: i.pathOIDCAuthorize,
+			},
+			HelpSynopsis:    "Request an authorization code",
+			HelpDescription: "Issue an authorization code to a client for the entity of the vault token used to call this path. The code can be exchanged for an ID token at the token endpoint of the provider.",
+		},
+		{
+			Pattern: "oidc/provider/" + framework.GenericNameRegex("name") + "/token/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the provider",
+				},
+				"grant_type": {
+					Type:        framework.TypeString,
+					Description: `The grant type, which must be "authorization_code".`,
+				},
+				"code": {
+					Type:        framework.TypeString,
+					Description: "The authorization code issued by the authorize endpoint.",
+				},
+				"redirect_uri": {
+					Type:        framework.TypeString,
+					Description: "The redirection URI given to the authorize endpoint.",
+				},
+				"code_verifier": {
+					Type:        framework.TypeString,
+					Description: "The PKCE code verifier the code challenge was derived from.",
+				},
+				"client_id": {
+					Type:        framework.TypeString,
+					Description: "The ID of the client.",
+				},
+				"client_secret": {
+					Type:        framework.TypeString,
+					Description: "The secret of the client. Public clients do not have one.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: i.pathOIDCToken,
+			},
+			HelpSynopsis:    "Exchange an authorization code for tokens",
+			HelpDescription: "Exchange an authorization code for an ID token and an access token. The request may be form encoded, as sent by OAuth 2.0 clients.",
+		},
+		{
+			Pattern: "oidc/provider/" + framework.GenericNameRegex("name") + "/userinfo/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the provider",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   i.pathOIDCUserInfo,
+				logical.UpdateOperation: i.pathOIDCUserInfo,
+			},
+			HelpSynopsis:    "Retrieve the claims of an entity",
+			HelpDescription: "Retrieve the claims of the requested scopes for the entity an access token was issued for. The access token must be sent as a bearer token.",
+		},
+	}
+}
+
+func (i *IdentityStore) pathOIDCScopeExistenceCheck(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+	scope, err := i.getOIDCScope(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+
+	return scope != nil, nil
+}
+
+// pathOIDCCreateUpdateScope is used to create a new scope or update an existing one
+func (i *IdentityStore) pathOIDCCreateUpdateScope(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == openIDScope {
+		return logical.ErrorResponse("the %q scope name is reserved", openIDScope), nil
+	}
+
+	var scope scope
+	if req.Operation == logical.UpdateOperation {
+		existing, err := i.getOIDCScope(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			scope = *existing
+		}
+	}
+
+	if template, ok := d.GetOk("template"); ok {
+		scope.Template = template.(string)
+	}
+
+	// Attempt to decode as base64 and use that if it works
+	if decoded, err := base64.StdEncoding.DecodeString(scope.Template); err == nil {
+		scope.Template = string(decoded)
+	}
+
+	if err := validateOIDCTemplate(scope.Template, providerReservedClaims); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if description, ok := d.GetOk("description"); ok {
+		scope.Description = description.(string)
+	}
+
+	entry, err := logical.StorageEntryJSON(scopeConfigPath+name, scope)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// pathOIDCReadScope is used to read an existing scope
+func (i *IdentityStore) pathOIDCReadScope(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	scope, err := i.getOIDCScope(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if scope == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"template":    scope.Template,
+			"description": scope.Description,
+		},
+	}, nil
+}
+
+// pathOIDCDeleteScope is used to delete a scope which no provider supports
+func (i *IdentityStore) pathOIDCDeleteScope(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	providerNames, err := req.Storage.List(ctx, providerConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	providersReferencingScope := make([]string, 0)
+	for _, providerName := range providerNames {
+		provider, err := i.getOIDCProvider(ctx, req.Storage, providerName)
+		if err != nil {
+			return nil, err
+		}
+		if provider != nil && strutil.StrListContains(provider.ScopesSupported, name) {
+			providersReferencingScope = append(providersReferencingScope, providerName)
+		}
+	}
+
+	if len(providersReferencingScope) > 0 {
+		return logical.ErrorResponse("unable to delete scope %q because it is currently referenced by these providers: %s",
+			name, strings.Join(providersReferencingScope, ", ")), logical.ErrInvalidRequest
+	}
+
+	if err := req.Storage.Delete(ctx, scopeConfigPath+name); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// pathOIDCListScope is used to list the stored scopes
+func (i *IdentityStore) pathOIDCListScope(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	scopes, err := req.Storage.List(ctx, scopeConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(scopes), nil
+}
+
+func (i *IdentityStore) getOIDCScope(ctx context.Context, s logical.Storage, name string) (*scope, error) {
+	entry, err := s.Get(ctx, scopeConfigPath+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var scope scope
+	if err := entry.DecodeJSON(&scope); err != nil {
+		return nil, err
+	}
+
+	return &scope, nil
+}
+
+func (i *IdentityStore) pathOIDCClientExistenceCheck(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+	client, err := i.getOIDCClient(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+
+	return client != nil, nil
+}
+
+// pathOIDCCreateUpdateClient is used to create a new client or update an existing one
+func (i *IdentityStore) pathOIDCCreateUpdateClient(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	client := &client{
+		Name: name,
+	}
+	if req.Operation == logical.UpdateOperation {
+		existing, err := i.getOIDCClient(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			client = existing
+		}
+	}
+
+	if redirectURIs, ok := d.GetOk("redirect_uris"); ok {
+		client.RedirectURIs = redirectURIs.([]string)
+	}
+	for _, redirectURI := range client.RedirectURIs {
+		u, err := url.Parse(redirectURI)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return logical.ErrorResponse("invalid redirect URI %q, which must be an absolute URI without fragment", redirectURI), nil
+		}
+	}
+
+	if key, ok := d.GetOk("key"); ok {
+		client.Key = key.(string)
+	}
+	if client.Key == "" {
+		return logical.ErrorResponse("the key parameter is required"), nil
+	}
+	key, err := i.getNamedKey(ctx, req.Storage, client.Key)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return logical.ErrorResponse("key %q not found", client.Key), nil
+	}
+
+	if ttl, ok := d.GetOk("id_token_ttl"); ok {
+		client.IDTokenTTL = time.Duration(ttl.(int)) * time.Second
+	} else if req.Operation == logical.CreateOperation {
+		client.IDTokenTTL = time.Duration(d.Get("id_token_ttl").(int)) * time.Second
+	}
+
+	if ttl, ok := d.GetOk("access_token_ttl"); ok {
+		client.AccessTokenTTL = time.Duration(ttl.(int)) * time.Second
+	} else if req.Operation == logical.CreateOperation {
+		client.AccessTokenTTL = time.Duration(d.Get("access_token_ttl").(int)) * time.Second
+	}
+
+	clientType := d.Get("client_type").(string)
+	switch {
+	case client.Type == "":
+		if clientType != clientTypeConfidential && clientType != clientTypePublic {
+			return logical.ErrorResponse("invalid client_type %q, which must be %q or %q", clientType, clientTypeConfidential, clientTypePublic), nil
+		}
+		client.Type = clientType
+	case d.Raw["client_type"] != nil && clientType != client.Type:
+		return logical.ErrorResponse("client_type cannot be updated"), nil
+	}
+
+	if client.ClientID == "" {
+		client.ClientID, err = base62.Random(32)
+		if err != nil {
+			return nil, err
+		}
+		if client.Type == clientTypeConfidential {
+			client.ClientSecret, err = base62.Random(64)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(clientConfigPath+name, client)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// pathOIDCReadClient is used to read an existing client
+func (i *IdentityStore) pathOIDCReadClient(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	client, err := i.getOIDCClient(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, nil
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"redirect_uris":    client.RedirectURIs,
+			"key":              client.Key,
+			"id_token_ttl":     int64(client.IDTokenTTL.Seconds()),
+			"access_token_ttl": int64(client.AccessTokenTTL.Seconds()),
+			"client_type":      client.Type,
+			"client_id":        client.ClientID,
+		},
+	}
+	if client.Type == clientTypeConfidential {
+		resp.Data["client_secret"] = client.ClientSecret
+	}
+
+	return resp, nil
+}
+
+// pathOIDCDeleteClient is used to delete a client along with the tokens
+// issued to it
+func (i *IdentityStore) pathOIDCDeleteClient(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	client, err := i.getOIDCClient(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, nil
+	}
+
+	if err := req.Storage.Delete(ctx, clientConfigPath+name); err != nil {
+		return nil, err
+	}
+
+	if err := i.revokeOIDCClientTokens(ctx, req.Storage, client.ClientID); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// pathOIDCListClient is used to list the stored clients
+func (i *IdentityStore) pathOIDCListClient(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	clients, err := req.Storage.List(ctx, clientConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(clients), nil
+}
+
+func (i *IdentityStore) getOIDCClient(ctx context.Context, s logical.Storage, name string) (*client, error) {
+	entry, err := s.Get(ctx, clientConfigPath+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var client client
+	if err := entry.DecodeJSON(&client); err != nil {
+		return nil, err
+	}
+	client.Name = name
+
+	return &client, nil
+}
+
+func (i *IdentityStore) listOIDCClients(ctx context.Context, s logical.Storage) ([]*client, error) {
+	names, err := s.List(ctx, clientConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	clients := make([]*client, 0, len(names))
+	for _, name := range names {
+		client, err := i.getOIDCClient(ctx, s, name)
+		if err != nil {
+			return nil, err
+		}
+		if client != nil {
+			clients = append(clients, client)
+		}
+	}
+
+	return clients, nil
+}
+
+func (i *IdentityStore) getOIDCClientByID(ctx context.Context, s logical.Storage, clientID string) (*client, error) {
+	clients, err := i.listOIDCClients(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, client := range clients {
+		if client.ClientID == clientID {
+			return client, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (i *IdentityStore) pathOIDCProviderExistenceCheck(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+	provider, err := i.getOIDCProvider(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+
+	return provider != nil, nil
+}
+
+// pathOIDCCreateUpdateProvider is used to create a new provider or update an existing one
+func (i *IdentityStore) pathOIDCCreateUpdateProvider(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	var provider provider
+	if req.Operation == logical.UpdateOperation {
+		existing, err := i.getOIDCProvider(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			provider = *existing
+		}
+	}
+
+	if issuer, ok := d.GetOk("issuer"); ok {
+		provider.Issuer = issuer.(string)
+	}
+	if provider.Issuer != "" && !validIssuer(provider.Issuer) {
+		return logical.ErrorResponse(
+			"invalid issuer, which must include only a scheme, host, " +
+				"and optional port (e.g. https://example.com:8200)"), nil
+	}
+
+	if allowedClientIDs, ok := d.GetOk("allowed_client_ids"); ok {
+		provider.AllowedClientIDs = allowedClientIDs.([]string)
+	}
+
+	if scopesSupported, ok := d.GetOk("scopes_supported"); ok {
+		provider.ScopesSupported = scopesSupported.([]string)
+	}
+	for _, scopeName := range provider.ScopesSupported {
+		if scopeName == openIDScope {
+			return logical.ErrorResponse("the %q scope is always supported and must not be listed", openIDScope), nil
+		}
+		scope, err := i.getOIDCScope(ctx, req.Storage, scopeName)
+		if err != nil {
+			return nil, err
+		}
+		if scope == nil {
+			return logical.ErrorResponse("scope %q not found", scopeName), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(providerConfigPath+name, provider)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// pathOIDCReadProvider is used to read an existing provider
+func (i *IdentityStore) pathOIDCReadProvider(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	provider, err := i.getOIDCProvider(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"issuer":             provider.effectiveIssuer,
+			"allowed_client_ids": provider.AllowedClientIDs,
+			"scopes_supported":   provider.ScopesSupported,
+		},
+	}, nil
+}
+
+// pathOIDCDeleteProvider is used to delete a provider along with the tokens
+// it issued
+func (i *IdentityStore) pathOIDCDeleteProvider(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if err := req.Storage.Delete(ctx, providerConfigPath+name); err != nil {
+		return nil, err
+	}
+
+	if err := i.tidyOIDCProviderTokens(ctx, req.Storage, func(provider, clientID string, expireAt time.Time) bool {
+		return provider == name
+	}); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// pathOIDCListProvider is used to list the stored providers
+func (i *IdentityStore) pathOIDCListProvider(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	providers, err := req.Storage.List(ctx, providerConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(providers), nil
+}
+
+func (i *IdentityStore) getOIDCProvider(ctx context.Context, s logical.Storage, name string) (*provider, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := s.Get(ctx, providerConfigPath+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var provider provider
+	if err := entry.DecodeJSON(&provider); err != nil {
+		return nil, err
+	}
+
+	provider.effectiveIssuer = provider.Issuer
+	if provider.effectiveIssuer == "" {
+		c, err := i.getOIDCConfig(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		provider.effectiveIssuer = c.Issuer
+	}
+	if provider.effectiveIssuer == "" {
+		provider.effectiveIssuer = i.core.redirectAddr
+	}
+
+	provider.effectiveIssuer += "/v1/" + ns.Path + issuerPath + "/provider/" + name
+
+	return &provider, nil
+}
+
+// allowsClient returns whether the client can use the provider
+func (p *provider) allowsClient(clientID string) bool {
+	return strutil.StrListContains(p.AllowedClientIDs, "*") || strutil.StrListContains(p.AllowedClientIDs, clientID)
+}
+
+// pathOIDCProviderDiscovery returns the metadata of a provider
+func (i *IdentityStore) pathOIDCProviderDiscovery(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	provider, err := i.getOIDCProvider(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return nil, nil
+	}
+
+	disc := providerDiscovery{
+		Issuer:                provider.effectiveIssuer,
+		Keys:                  provider.effectiveIssuer + "/.well-known/keys",
+		AuthorizationEndpoint: provider.effectiveIssuer + "/authorize",
+		TokenEndpoint:         provider.effectiveIssuer + "/token",
+		UserinfoEndpoint:      provider.effectiveIssuer + "/userinfo",
+		ScopesSupported:       append([]string{openIDScope}, provider.ScopesSupported...),
+		ResponseTypes:         []string{"code"},
+		GrantTypes:            []string{"authorization_code"},
+		Subjects:              []string{"public"},
+		IDTokenAlgs:           supportedAlgs,
+		AuthMethods:           []string{"client_secret_post", "none"},
+		CodeChallengeMethods:  []string{codeChallengeMethodS256, codeChallengeMethodPlain},
+	}
+
+	data, err := json.Marshal(disc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:      200,
+			logical.HTTPRawBody:         data,
+			logical.HTTPContentType:     "application/json",
+			logical.HTTPRawCacheControl: "max-age=3600",
+		},
+	}, nil
+}
+
+// pathOIDCProviderReadPublicKeys returns the public keys of the named keys
+// used by the clients of a provider
+func (i *IdentityStore) pathOIDCProviderReadPublicKeys(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	provider, err := i.getOIDCProvider(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return nil, nil
+	}
+
+	clients, err := i.listOIDCClients(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	keyNames := make(map[string]bool)
+	for _, client := range clients {
+		if provider.allowsClient(client.ClientID) {
+			keyNames[client.Key] = true
+		}
+	}
+
+	i.oidcLock.RLock()
+	defer i.oidcLock.RUnlock()
+
+	keyIDs := make(map[string]bool)
+	for keyName := range keyNames {
+		key, err := i.getNamedKey(ctx, req.Storage, keyName)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			continue
+		}
+		for _, k := range key.KeyRing {
+			keyIDs[k.KeyID] = true
+		}
+	}
+
+	// Only return the public keys which have not expired yet
+	publicKeyIDs, err := listOIDCPublicKeys(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(publicKeyIDs)
+
+	jwks := &jose.JSONWebKeySet{
+		Keys: make([]jose.JSONWebKey, 0, len(keyIDs)),
+	}
+	for _, keyID := range publicKeyIDs {
+		if !keyIDs[keyID] {
+			continue
+		}
+		publicKey, err := loadOIDCPublicKey(ctx, req.Storage, keyID)
+		if err != nil {
+			return nil, err
+		}
+		jwks.Keys = append(jwks.Keys, *publicKey)
+	}
+
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:  200,
+			logical.HTTPRawBody:     data,
+			logical.HTTPContentType: "application/json",
+		},
+	}, nil
+}
+
+// pathOIDCAuthorize issues an authorization code to a client for the entity
+// of the request's token
+func (i *IdentityStore) pathOIDCAuthorize(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	provider, err := i.getOIDCProvider(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return logical.ErrorResponse("provider %q not found", name), nil
+	}
+
+	clientID := d.Get("client_id").(string)
+	if clientID == "" {
+		return logical.ErrorResponse("the client_id parameter is required"), nil
+	}
+	client, err := i.getOIDCClientByID(ctx, req.Storage, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil || !provider.allowsClient(clientID) {
+		return logical.ErrorResponse("client %q is not allowed to use provider %q", clientID, name), nil
+	}
+
+	redirectURI := d.Get("redirect_uri").(string)
+	if !strutil.StrListContains(client.RedirectURIs, redirectURI) {
+		return logical.ErrorResponse("redirect_uri %q is not one of the redirect URIs of the client", redirectURI), nil
+	}
+
+	if responseType := d.Get("response_type").(string); responseType != "code" {
+		return logical.ErrorResponse(`unsupported response_type %q, only "code" is supported`, responseType), nil
+	}
+
+	// Unsupported scopes are ignored, as per the OIDC specification
+	requestedScopes := strings.Fields(d.Get("scope").(string))
+	if !strutil.StrListContains(requestedScopes, openIDScope) {
+		return logical.ErrorResponse("the scope parameter must include %q", openIDScope), nil
+	}
+	scopes := make([]string, 0, len(requestedScopes))
+	for _, scope := range strutil.RemoveDuplicatesStable(requestedScopes, false) {
+		if scope == openIDScope || strutil.StrListContains(provider.ScopesSupported, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	codeChallenge := d.Get("code_challenge").(string)
+	if codeChallenge == "" {
+		return logical.ErrorResponse("the code_challenge parameter is required"), nil
+	}
+	codeChallengeMethod := d.Get("code_challenge_method").(string)
+	if codeChallengeMethod != codeChallengeMethodS256 && codeChallengeMethod != codeChallengeMethodPlain {
+		return logical.ErrorResponse("unsupported code_challenge_method %q", codeChallengeMethod), nil
+	}
+
+	if req.EntityID == "" {
+		return logical.ErrorResponse("no entity associated with the request's token"), nil
+	}
+	entity, err := i.MemDBEntityByID(req.EntityID, false)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil || entity.Disabled {
+		return logical.ErrorResponse("entity %q not found or disabled", req.EntityID), nil
+	}
+
+	now := time.Now()
+	authTime := now.Unix()
+	if te := req.TokenEntry(); te != nil && te.CreationTime > 0 {
+		authTime = te.CreationTime
+	}
+
+	code, err := base62.Random(32)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := logical.StorageEntryJSON(authCodePath+hashOIDCProviderToken(code), &authCode{
+		Provider:            name,
+		ClientID:            clientID,
+		EntityID:            req.EntityID,
+		RedirectURI:         redirectURI,
+		Scopes:              scopes,
+		Nonce:               d.Get("nonce").(string),
+		CodeChallenge:       codeChallenge,
+		CodeChallengeMethod: codeChallengeMethod,
+		AuthTime:            authTime,
+		ExpireAt:            now.Add(authCodeTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"code":  code,
+			"state": d.Get("state").(string),
+		},
+	}, nil
+}
+
+// pathOIDCToken exchanges an authorization code for an ID token and an
+// access token. Its responses follow RFC 6749 rather than the Vault API.
+func (i *IdentityStore) pathOIDCToken(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := d.Get("name").(string)
+
+	provider, err := i.getOIDCProvider(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return oauthErrorResponse(http.StatusBadRequest, "invalid_request", fmt.Sprintf("provider %q not found", name))
+	}
+
+	if grantType := d.Get("grant_type").(string); grantType != "authorization_code" {
+		return oauthErrorResponse(http.StatusBadRequest, "unsupported_grant_type", fmt.Sprintf("unsupported grant_type %q", grantType))
+	}
+
+	// Authenticate the client
+	clientID := d.Get("client_id").(string)
+	client, err := i.getOIDCClientByID(ctx, req.Storage, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil || !provider.allowsClient(clientID) {
+		return oauthErrorResponse(http.StatusUnauthorized, "invalid_client", "client not allowed to use the provider")
+	}
+	if client.Type == clientTypeConfidential &&
+		subtle.ConstantTimeCompare([]byte(client.ClientSecret), []byte(d.Get("client_secret").(string))) != 1 {
+		return oauthErrorResponse(http.StatusUnauthorized, "invalid_client", "invalid client secret")
+	}
+
+	// Authorization codes can only be used once
+	code, err := i.redeemOIDCAuthCode(ctx, req.Storage, d.Get("code").(string))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case code == nil:
+		return oauthErrorResponse(http.StatusBadRequest, "invalid_grant", "invalid or expired authorization code")
+	case code.Provider != name || code.ClientID != clientID:
+		return oauthErrorResponse(http.StatusBadRequest, "invalid_grant", "authorization code not issued to the client")
+	case code.RedirectURI != d.Get("redirect_uri").(string):
+		return oauthErrorResponse(http.StatusBadRequest, "invalid_grant", "redirect_uri does not match the authorization request")
+	}
+	if err := verifyCodeChallenge(code.CodeChallenge, code.CodeChallengeMethod, d.Get("code_verifier").(string)); err != nil {
+		return oauthErrorResponse(http.StatusBadRequest, "invalid_grant", err.Error())
+	}
+
+	entity, err := i.MemDBEntityByID(code.EntityID, true)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil || entity.Disabled {
+		return oauthErrorResponse(http.StatusBadRequest, "invalid_grant", "entity not found or disabled")
+	}
+
+	key, err := i.getNamedKey(ctx, req.Storage, client.Key)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, fmt.Errorf("key %q of client %q not found", client.Key, client.Name)
+	}
+	// Validate that the client is allowed to sign with its key (the key could have been updated)
+	if !strutil.StrListContains(key.AllowedClientIDs, "*") && !strutil.StrListContains(key.AllowedClientIDs, clientID) {
+		return oauthErrorResponse(http.StatusBadRequest, "unauthorized_client",
+			fmt.Sprintf("the key %q does not list the client ID of the client as an allowed client ID", client.Key))
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":       provider.effectiveIssuer,
+		"namespace": ns.ID,
+		"sub":       entity.ID,
+		"aud":       clientID,
+		"exp":       now.Add(client.IDTokenTTL).Unix(),
+		"iat":       now.Unix(),
+		"auth_time": code.AuthTime,
+	}
+	if code.Nonce != "" {
+		claims["nonce"] = code.Nonce
+	}
+	if err := i.populateScopeClaims(ctx, req.Storage, claims, code.Scopes, entity); err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	signedIDToken, err := key.signPayload(payload)
+	if err != nil {
+		return nil, errwrap.Wrapf("error signing OIDC token: {{err}}", err)
+	}
+
+	token, err := base62.Random(64)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := logical.StorageEntryJSON(accessTokenPath+hashOIDCProviderToken(token), &accessToken{
+		Provider: name,
+		ClientID: clientID,
+		EntityID: entity.ID,
+		Scopes:   code.Scopes,
+		ExpireAt: now.Add(client.AccessTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return oauthResponse(http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int64(client.AccessTokenTTL.Seconds()),
+		"id_token":     signedIDToken,
+	})
+}
+
+// pathOIDCUserInfo returns the claims of the scopes an access token was
+// issued for
+func (i *IdentityStore) pathOIDCUserInfo(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	// The router passes the bearer token of userinfo requests as is
+	if req.ClientToken == "" {
+		return oauthErrorResponse(http.StatusUnauthorized, "invalid_token", "missing access token")
+	}
+
+	entry, err := req.Storage.Get(ctx, accessTokenPath+hashOIDCProviderToken(req.ClientToken))
+	if err != nil {
+		return nil, err
+	}
+	var token accessToken
+	if entry != nil {
+		if err := entry.DecodeJSON(&token); err != nil {
+			return nil, err
+		}
+	}
+	if entry == nil || token.Provider != name || time.Now().After(token.ExpireAt) {
+		return oauthErrorResponse(http.StatusUnauthorized, "invalid_token", "invalid or expired access token")
+	}
+
+	entity, err := i.MemDBEntityByID(token.EntityID, true)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil || entity.Disabled {
+		return oauthErrorResponse(http.StatusUnauthorized, "invalid_token", "entity not found or disabled")
+	}
+
+	claims := map[string]interface{}{
+		"sub": entity.ID,
+	}
+	if err := i.populateScopeClaims(ctx, req.Storage, claims, token.Scopes, entity); err != nil {
+		return nil, err
+	}
+
+	return oauthResponse(http.StatusOK, claims)
+}
+
+// populateScopeClaims merges the claims templated by the scopes into claims,
+// in the order of the scopes
+func (i *IdentityStore) populateScopeClaims(ctx context.Context, s logical.Storage, claims map[string]interface{}, scopes []string, entity *identity.Entity) error {
+	groups, inheritedGroups, err := i.groupsByEntityID(entity.ID)
+	if err != nil {
+		return err
+	}
+	groups = append(groups, inheritedGroups...)
+
+	for _, scopeName := range scopes {
+		if scopeName == openIDScope {
+			continue
+		}
+		scope, err := i.getOIDCScope(ctx, s, scopeName)
+		if err != nil {
+			return err
+		}
+		if scope == nil || scope.Template == "" {
+			continue
+		}
+		populateTemplateClaims(i.Logger(), claims, scope.Template, providerReservedClaims, entity, groups)
+	}
+
+	return nil
+}
+
+// redeemOIDCAuthCode loads and deletes an authorization code, returning nil
+// if it does not exist or has expired
+func (i *IdentityStore) redeemOIDCAuthCode(ctx context.Context, s logical.Storage, code string) (*authCode, error) {
+	if code == "" {
+		return nil, nil
+	}
+
+	i.oidcLock.Lock()
+	defer i.oidcLock.Unlock()
+
+	path := authCodePath + hashOIDCProviderToken(code)
+	entry, err := s.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	if err := s.Delete(ctx, path); err != nil {
+		return nil, err
+	}
+
+	var ret authCode
+	if err := entry.DecodeJSON(&ret); err != nil {
+		return nil, err
+	}
+	if time.Now().After(ret.ExpireAt) {
+		return nil, nil
+	}
+
+	return &ret, nil
+}
+
+// verifyCodeChallenge verifies the PKCE code verifier against the code
+// challenge of the authorization request, as per RFC 7636
+func verifyCodeChallenge(challenge, method, verifier string) error {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return fmt.Errorf("code_verifier must be between 43 and 128 characters long")
+	}
+
+	expected := verifier
+	if method == codeChallengeMethodS256 {
+		sum := sha256.Sum256([]byte(verifier))
+		expected = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) != 1 {
+		return fmt.Errorf("code_verifier does not match the code challenge")
+	}
+
+	return nil
+}
+
+// revokeOIDCClientTokens deletes the authorization codes and access tokens
+// issued to a client
+func (i *IdentityStore) revokeOIDCClientTokens(ctx context.Context, s logical.Storage, clientID string) error {
+	return i.tidyOIDCProviderTokens(ctx, s, func(provider, tokenClientID string, expireAt time.Time) bool {
+		return tokenClientID == clientID
+	})
+}
+
+// expireOIDCProviderTokens deletes the expired authorization codes and access
+// tokens
+func (i *IdentityStore) expireOIDCProviderTokens(ctx context.Context, s logical.Storage) error {
+	now := time.Now()
+	return i.tidyOIDCProviderTokens(ctx, s, func(provider, clientID string, expireAt time.Time) bool {
+		return now.After(expireAt)
+	})
+}
+
+// tidyOIDCProviderTokens deletes the authorization codes and access tokens
+// for which shouldDelete returns true
+func (i *IdentityStore) tidyOIDCProviderTokens(ctx context.Context, s logical.Storage, shouldDelete func(provider, clientID string, expireAt time.Time) bool) error {
+	for _, prefix := range []string{authCodePath, accessTokenPath} {
+		hashes, err := s.List(ctx, prefix)
+		if err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			entry, err := s.Get(ctx, prefix+hash)
+			if err != nil {
+				return err
+			}
+			if entry == nil {
+				continue
+			}
+
+			// Authorization codes and access tokens share these fields
+			var token accessToken
+			if err := entry.DecodeJSON(&token); err != nil {
+				return err
+			}
+			if !shouldDelete(token.Provider, token.ClientID, token.ExpireAt) {
+				continue
+			}
+			if err := s.Delete(ctx, prefix+hash); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// hashOIDCProviderToken returns the hash under which an authorization code or
+// access token is stored
+func hashOIDCProviderToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// oauthResponse returns a raw JSON response, as the token and userinfo
+// endpoints do not follow the Vault API
+func oauthResponse(status int, body interface{}) (*logical.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:      status,
+			logical.HTTPRawBody:         data,
+			logical.HTTPContentType:     "application/json",
+			logical.HTTPRawCacheControl: "no-store",
+		},
+	}, nil
+}
+
+// oauthErrorResponse returns an error response as defined in RFC 6749
+func oauthErrorResponse(status int, code, description string) (*logical.Response, error) {
+	return oauthResponse(status, map[string]interface{}{
+		"error":             code,
+		"error_description": description,
+	})
+}
@@ -0,0 +1,482 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/identity"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestOIDC_Path_OIDCScope(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+	storage := &logical.InmemStorage{}
+
+	// The openid scope name is reserved
+	resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/scope/openid",
+		Operation: logical.CreateOperation,
+		Storage:   storage,
+	})
+	expectError(t, resp, err)
+
+	// Templates may not set the claims of the provider
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/scope/test-scope",
+		Operation: logical.CreateOperation,
+		Data: map[string]interface{}{
+			"template": `{"nonce": "foo"}`,
+		},
+		Storage: storage,
+	})
+	expectError(t, resp, err)
+
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/scope/test-scope",
+		Operation: logical.CreateOperation,
+		Data: map[string]interface{}{
+			"template":    `{"email": {{identity.entity.metadata.email}}}`,
+			"description": "the email of the entity",
+		},
+		Storage: storage,
+	})
+	expectSuccess(t, resp, err)
+
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/scope/test-scope",
+		Operation: logical.ReadOperation,
+		Storage:   storage,
+	})
+	expectSuccess(t, resp, err)
+	if resp.Data["description"] != "the email of the entity" {
+		t.Fatalf("bad scope: %#v", resp.Data)
+	}
+
+	// Scopes supported by a provider cannot be deleted
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/provider/test-provider",
+		Operation: logical.CreateOperation,
+		Data: map[string]interface{}{
+			"scopes_supported": "test-scope",
+		},
+		Storage: storage,
+	})
+	expectSuccess(t, resp, err)
+
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/scope/test-scope",
+		Operation: logical.DeleteOperation,
+		Storage:   storage,
+	})
+	expectError(t, resp, err)
+
+	// Providers can only support existing scopes
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/provider/test-provider",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"scopes_supported": "test-scope,unknown-scope",
+		},
+		Storage: storage,
+	})
+	expectError(t, resp, err)
+
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/provider/test-provider",
+		Operation: logical.DeleteOperation,
+		Storage:   storage,
+	})
+	expectSuccess(t, resp, err)
+
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/scope/test-scope",
+		Operation: logical.DeleteOperation,
+		Storage:   storage,
+	})
+	expectSuccess(t, resp, err)
+
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/scope",
+		Operation: logical.ListOperation,
+		Storage:   storage,
+	})
+	expectSuccess(t, resp, err)
+	if keys, ok := resp.Data["keys"]; ok {
+		t.Fatalf("expected no scopes, got %v", keys)
+	}
+}
+
+func TestOIDC_Path_OIDCClient(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+	storage := &logical.InmemStorage{}
+
+	// The key of the client must exist
+	resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/client/test-client",
+		Operation: logical.CreateOperation,
+		Data: map[string]interface{}{
+			"key": "test-key",
+		},
+		Storage: storage,
+	})
+	expectError(t, resp, err)
+
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/key/test-key",
+		Operation: logical.CreateOperation,
+		Storage:   storage,
+	})
+	expectSuccess(t, resp, err)
+
+	// Redirect URIs must be absolute
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/client/test-client",
+		Operation: logical.CreateOperation,
+		Data: map[string]interface{}{
+			"key":           "test-key",
+			"redirect_uris": "/callback",
+		},
+		Storage: storage,
+	})
+	expectError(t, resp, err)
+
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/client/test-client",
+		Operation: logical.CreateOperation,
+		Data: map[string]interface{}{
+			"key":           "test-key",
+			"redirect_uris": "https://app.example.com/callback",
+		},
+		Storage: storage,
+	})
+	expectSuccess(t, resp, err)
+
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/client/test-client",
+		Operation: logical.ReadOperation,
+		Storage:   storage,
+	})
+	expectSuccess(t, resp, err)
+	if resp.Data["client_type"] != clientTypeConfidential || resp.Data["client_id"] == "" || resp.Data["client_secret"] == "" {
+		t.Fatalf("bad client: %#v", resp.Data)
+	}
+	if resp.Data["id_token_ttl"] != int64(86400) {
+		t.Fatalf("bad id_token_ttl: %v", resp.Data["id_token_ttl"])
+	}
+
+	// The client type cannot be changed
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/client/test-client",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"client_type": clientTypePublic,
+		},
+		Storage: storage,
+	})
+	expectError(t, resp, err)
+
+	// Public clients have no secret
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/client/test-public-client",
+		Operation: logical.CreateOperation,
+		Data: map[string]interface{}{
+			"key":         "test-key",
+			"client_type": clientTypePublic,
+		},
+		Storage: storage,
+	})
+	expectSuccess(t, resp, err)
+
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/client/test-public-client",
+		Operation: logical.ReadOperation,
+		Storage:   storage,
+	})
+	expectSuccess(t, resp, err)
+	if _, ok := resp.Data["client_secret"]; ok {
+		t.Fatalf("expected no client secret for a public client: %#v", resp.Data)
+	}
+
+	// Keys referenced by clients cannot be deleted
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/key/test-key",
+		Operation: logical.DeleteOperation,
+		Storage:   storage,
+	})
+	expectError(t, resp, err)
+	expectedStrings := map[string]interface{}{
+		"unable to delete key \"test-key\" because it is currently referenced by these clients: test-client, test-public-client": true,
+	}
+	expectStrings(t, []string{resp.Data["error"].(string)}, expectedStrings)
+
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/client",
+		Operation: logical.ListOperation,
+		Storage:   storage,
+	})
+	expectSuccess(t, resp, err)
+	if len(resp.Data["keys"].([]string)) != 2 {
+		t.Fatalf("expected 2 clients, got %v", resp.Data["keys"])
+	}
+}
+
+func TestOIDC_Provider_AuthorizationCodeFlow(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+	storage := &logical.InmemStorage{}
+
+	testEntity := &identity.Entity{
+		Name:      "test-entity-name",
+		ID:        "test-entity-id",
+		BucketKey: "test-entity-bucket-key",
+		Metadata: map[string]string{
+			"email": "test@example.com",
+		},
+	}
+
+	txn := c.identityStore.db.Txn(true)
+	defer txn.Abort()
+	err := c.identityStore.upsertEntityInTxn(ctx, txn, testEntity, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn.Commit()
+
+	handle := func(path string, op logical.Operation, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+			Path:      path,
+			Operation: op,
+			Data:      data,
+			Storage:   storage,
+			EntityID:  testEntity.ID,
+		})
+		expectSuccess(t, resp, err)
+		return resp
+	}
+
+	handle("oidc/key/test-key", logical.CreateOperation, map[string]interface{}{
+		"allowed_client_ids": "*",
+	})
+	handle("oidc/scope/email", logical.CreateOperation, map[string]interface{}{
+		"template": `{"email": {{identity.entity.metadata.email}}}`,
+	})
+	handle("oidc/client/test-client", logical.CreateOperation, map[string]interface{}{
+		"key":           "test-key",
+		"redirect_uris": "https://app.example.com/callback",
+	})
+	resp := handle("oidc/client/test-client", logical.ReadOperation, nil)
+	clientID := resp.Data["client_id"].(string)
+	clientSecret := resp.Data["client_secret"].(string)
+
+	handle("oidc/provider/test-provider", logical.CreateOperation, map[string]interface{}{
+		"issuer":             "https://vault.example.com",
+		"allowed_client_ids": clientID,
+		"scopes_supported":   "email",
+	})
+
+	// The discovery document lists the endpoints of the provider
+	resp = handle("oidc/provider/test-provider/.well-known/openid-configuration", logical.ReadOperation, nil)
+	var disc providerDiscovery
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &disc); err != nil {
+		t.Fatal(err)
+	}
+	issuer := "https://vault.example.com/v1/identity/oidc/provider/test-provider"
+	if disc.Issuer != issuer || disc.TokenEndpoint != issuer+"/token" {
+		t.Fatalf("bad discovery document: %#v", disc)
+	}
+
+	verifier := strings.Repeat("v", 43)
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	authorize := func() string {
+		t.Helper()
+		resp := handle("oidc/provider/test-provider/authorize", logical.ReadOperation, map[string]interface{}{
+			"client_id":             clientID,
+			"redirect_uri":          "https://app.example.com/callback",
+			"response_type":         "code",
+			"scope":                 "openid email unknown",
+			"state":                 "test-state",
+			"nonce":                 "test-nonce",
+			"code_challenge":        challenge,
+			"code_challenge_method": "S256",
+		})
+		if resp.Data["state"] != "test-state" {
+			t.Fatalf("bad state: %v", resp.Data["state"])
+		}
+		return resp.Data["code"].(string)
+	}
+
+	token := func(data map[string]interface{}) (int, map[string]interface{}) {
+		t.Helper()
+		resp := handle("oidc/provider/test-provider/token", logical.UpdateOperation, data)
+		var body map[string]interface{}
+		if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &body); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data[logical.HTTPStatusCode].(int), body
+	}
+
+	// The openid scope is required
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/provider/test-provider/authorize",
+		Operation: logical.ReadOperation,
+		Data: map[string]interface{}{
+			"client_id":      clientID,
+			"redirect_uri":   "https://app.example.com/callback",
+			"response_type":  "code",
+			"scope":          "email",
+			"code_challenge": challenge,
+		},
+		Storage:  storage,
+		EntityID: testEntity.ID,
+	})
+	expectError(t, resp, err)
+
+	// Unknown redirect URIs are rejected
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/provider/test-provider/authorize",
+		Operation: logical.ReadOperation,
+		Data: map[string]interface{}{
+			"client_id":      clientID,
+			"redirect_uri":   "https://evil.example.com/callback",
+			"response_type":  "code",
+			"scope":          "openid",
+			"code_challenge": challenge,
+		},
+		Storage:  storage,
+		EntityID: testEntity.ID,
+	})
+	expectError(t, resp, err)
+
+	validRequest := func(code string) map[string]interface{} {
+		return map[string]interface{}{
+			"grant_type":    "authorization_code",
+			"code":          code,
+			"redirect_uri":  "https://app.example.com/callback",
+			"code_verifier": verifier,
+			"client_id":     clientID,
+			"client_secret": clientSecret,
+		}
+	}
+
+	// A wrong code verifier is rejected, and the code cannot be used again
+	code := authorize()
+	data := validRequest(code)
+	data["code_verifier"] = strings.Repeat("w", 43)
+	if status, body := token(data); status != 400 || body["error"] != "invalid_grant" {
+		t.Fatalf("bad response: %d %v", status, body)
+	}
+	if status, body := token(validRequest(code)); status != 400 || body["error"] != "invalid_grant" {
+		t.Fatalf("bad response: %d %v", status, body)
+	}
+
+	// A wrong client secret is rejected
+	data = validRequest(authorize())
+	data["client_secret"] = "wrong"
+	if status, body := token(data); status != 401 || body["error"] != "invalid_client" {
+		t.Fatalf("bad response: %d %v", status, body)
+	}
+
+	code = authorize()
+	status, body := token(validRequest(code))
+	if status != 200 || body["token_type"] != "Bearer" {
+		t.Fatalf("bad response: %d %v", status, body)
+	}
+
+	// Codes can only be used once
+	if status, body := token(validRequest(code)); status != 400 || body["error"] != "invalid_grant" {
+		t.Fatalf("bad response: %d %v", status, body)
+	}
+
+	// Validate the ID token with the keys of the provider
+	resp = handle("oidc/provider/test-provider/.well-known/keys", logical.ReadOperation, nil)
+	jwks := &jose.JSONWebKeySet{}
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), jwks); err != nil {
+		t.Fatal(err)
+	}
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("expected 1 key, got %d", len(jwks.Keys))
+	}
+
+	parsedToken, err := jwt.ParseSigned(body["id_token"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := map[string]interface{}{}
+	if err := parsedToken.Claims(jwks.Keys[0], &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims["iss"] != issuer || claims["aud"] != clientID || claims["sub"] != testEntity.ID ||
+		claims["nonce"] != "test-nonce" || claims["email"] != "test@example.com" {
+		t.Fatalf("bad claims: %#v", claims)
+	}
+
+	// The access token is used as a bearer token for the userinfo endpoint
+	resp = handle("oidc/provider/test-provider/userinfo", logical.ReadOperation, nil)
+	if resp.Data[logical.HTTPStatusCode] != 401 {
+		t.Fatalf("expected unauthorized without access token, got %v", resp.Data[logical.HTTPStatusCode])
+	}
+
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:        "oidc/provider/test-provider/userinfo",
+		Operation:   logical.ReadOperation,
+		Storage:     storage,
+		ClientToken: body["access_token"].(string),
+	})
+	expectSuccess(t, resp, err)
+	userinfo := map[string]interface{}{}
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &userinfo); err != nil {
+		t.Fatal(err)
+	}
+	if userinfo["sub"] != testEntity.ID || userinfo["email"] != "test@example.com" {
+		t.Fatalf("bad userinfo: %#v", userinfo)
+	}
+
+	// Deleting the client revokes its access tokens
+	handle("oidc/client/test-client", logical.DeleteOperation, nil)
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:        "oidc/provider/test-provider/userinfo",
+		Operation:   logical.ReadOperation,
+		Storage:     storage,
+		ClientToken: body["access_token"].(string),
+	})
+	expectSuccess(t, resp, err)
+	if resp.Data[logical.HTTPStatusCode] != 401 {
+		t.Fatalf("expected unauthorized with a revoked access token, got %v", resp.Data[logical.HTTPStatusCode])
+	}
+}
+
+func TestOIDC_verifyCodeChallenge(t *testing.T) {
+	verifier := strings.Repeat("a", 43)
+	sum := sha256.Sum256([]byte(verifier))
+	s256 := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	cases := []struct {
+		challenge string
+		method    string
+		verifier  string
+		valid     bool
+	}{
+		{s256, codeChallengeMethodS256, verifier, true},
+		{verifier, codeChallengeMethodPlain, verifier, true},
+		{verifier, codeChallengeMethodS256, verifier, false},
+		{s256, codeChallengeMethodPlain, verifier, false},
+		{"short", codeChallengeMethodPlain, "short", false},
+	}
+	for _, tc := range cases {
+		err := verifyCodeChallenge(tc.challenge, tc.method, tc.verifier)
+		if (err == nil) != tc.valid {
+			t.Fatalf("challenge %q method %q: expected valid %t, got error %v", tc.challenge, tc.method, tc.valid, err)
+		}
+	}
+}
@@ -0,0 +1,1382 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/identity"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	scimConfigStorageKey = "scim/config"
+
+	scimSchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimSchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimSchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimSchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	scimSchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimSchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	scimSchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	scimContentType = "application/scim+json"
+
+	// scimMaxResults is the maximum number of resources returned by a list
+	// request
+	scimMaxResults = 200
+
+	// The entity and group metadata keys holding the SCIM attributes which
+	// have no counterpart in the identity store
+	scimMetadataExternalID  = "external_id"
+	scimMetadataDisplayName = "display_name"
+	scimMetadataGivenName   = "given_name"
+	scimMetadataFamilyName  = "family_name"
+	scimMetadataEmail       = "email"
+
+	// SCIM error types, as defined in RFC 7644
+	scimErrorInvalidFilter = "invalidFilter"
+	scimErrorInvalidPath   = "invalidPath"
+	scimErrorInvalidSyntax = "invalidSyntax"
+	scimErrorInvalidValue  = "invalidValue"
+	scimErrorUniqueness    = "uniqueness"
+)
+
+var (
+	scimUserMetadataKeys  = []string{scimMetadataExternalID, scimMetadataDisplayName, scimMetadataGivenName, scimMetadataFamilyName, scimMetadataEmail}
+	scimGroupMetadataKeys = []string{scimMetadataExternalID}
+
+	// scimFilterRegex matches the filters supported on list requests, which
+	// are a single equality comparison as sent by provisioning connectors,
+	// e.g. userName eq "alice"
+	scimFilterRegex = regexp.MustCompile(`^\s*([A-Za-z][\w.]*)\s+(?i:eq)\s+("(?:[^"\\]|\\.)*")\s*$`)
+)
+
+// scimConfig is the configuration of the SCIM API of a namespace.
+type scimConfig struct {
+	// MountAccessor is the accessor of the auth mount on which an alias named
+	// after the userName of the provisioned users is created, so that they
+	// are attached to their entity when logging in.
+	MountAccessor string `json:"mount_accessor"`
+}
+
+// scimBool is a boolean which may also be sent as a string, as some
+// provisioning connectors do.
+type scimBool bool
+
+func (b *scimBool) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		data = []byte(strings.ToLower(s))
+	}
+
+	var v bool
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	*b = scimBool(v)
+	return nil
+}
+
+type scimName struct {
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type scimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type scimReference struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created"`
+	LastModified string `json:"lastModified"`
+}
+
+// scimUser is the SCIM representation of an entity.
+type scimUser struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id,omitempty"`
+	ExternalID  string          `json:"externalId,omitempty"`
+	UserName    string          `json:"userName"`
+	DisplayName string          `json:"displayName,omitempty"`
+	Name        *scimName       `json:"name,omitempty"`
+	Emails      []scimEmail     `json:"emails,omitempty"`
+	Active      *scimBool       `json:"active,omitempty"`
+	Groups      []scimReference `json:"groups,omitempty"`
+	Meta        *scimMeta       `json:"meta,omitempty"`
+}
+
+// scimGroup is the SCIM representation of an internal group.
+type scimGroup struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id,omitempty"`
+	ExternalID  string          `json:"externalId,omitempty"`
+	DisplayName string          `json:"displayName"`
+	Members     []scimReference `json:"members"`
+	Meta        *scimMeta       `json:"meta,omitempty"`
+}
+
+type scimPatchOp struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []scimPatchOperation `json:"Operations"`
+}
+
+type scimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type scimListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// scimError is a SCIM error, returned as a response with its status.
+type scimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+func (e *scimError) Error() string {
+	return e.Detail
+}
+
+func newSCIMError(status int, scimType, detail string) *scimError {
+	return &scimError{
+		Schemas:  []string{scimSchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
+
+func scimPaths(i *IdentityStore) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "scim/config/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"mount_accessor": {
+					Type:        framework.TypeString,
+					Description: "Accessor of the auth mount on which an alias named after the userName of the provisioned users is created. If not set, no alias is created.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   i.pathSCIMReadConfig,
+				logical.UpdateOperation: i.pathSCIMUpdateConfig,
+			},
+			HelpSynopsis:    "Configuration of the SCIM provisioning API.",
+			HelpDescription: "Configure the auth mount on which aliases are created for the users provisioned through the SCIM API.",
+		},
+		{
+			Pattern: "scim/v2/ServiceProviderConfig$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: i.pathSCIMServiceProviderConfig,
+			},
+			HelpSynopsis:    "SCIM service provider configuration.",
+			HelpDescription: "Returns the SCIM features supported by the identity store.",
+		},
+		{
+			Pattern: "scim/v2/ResourceTypes$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: i.pathSCIMResourceTypes,
+			},
+			HelpSynopsis:    "SCIM resource types.",
+			HelpDescription: "Returns the SCIM resource types provisioned in the identity store.",
+		},
+		{
+			Pattern: "scim/v2/Users$",
+			Fields:  scimListFields(),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   i.pathSCIMListUsers,
+				logical.UpdateOperation: i.pathSCIMCreateUser,
+			},
+			HelpSynopsis:    "List and create SCIM users.",
+			HelpDescription: "List the entities of the namespace as SCIM users, or create an entity from a SCIM user.",
+		},
+		{
+			Pattern: "scim/v2/Users/" + framework.GenericNameRegex("id"),
+			Fields: map[string]*framework.FieldSchema{
+				"id": {
+					Type:        framework.TypeString,
+					Description: "ID of the entity.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   i.pathSCIMReadUser,
+				logical.UpdateOperation: i.pathSCIMUpdateUser,
+				logical.DeleteOperation: i.pathSCIMDeleteUser,
+			},
+			HelpSynopsis:    "Read, replace, patch and delete SCIM users.",
+			HelpDescription: "Read, replace, patch and delete the entity with the given ID as a SCIM user. A request with the PatchOp schema patches the user, any other update replaces it.",
+		},
+		{
+			Pattern: "scim/v2/Groups$",
+			Fields:  scimListFields(),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   i.pathSCIMListGroups,
+				logical.UpdateOperation: i.pathSCIMCreateGroup,
+			},
+			HelpSynopsis:    "List and create SCIM groups.",
+			HelpDescription: "List the internal groups of the namespace as SCIM groups, or create an internal group from a SCIM group.",
+		},
+		{
+			Pattern: "scim/v2/Groups/" + framework.GenericNameRegex("id"),
+			Fields: map[string]*framework.FieldSchema{
+				"id": {
+					Type:        framework.TypeString,
+					Description: "ID of the group.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   i.pathSCIMReadGroup,
+				logical.UpdateOperation: i.pathSCIMUpdateGroup,
+				logical.DeleteOperation: i.pathSCIMDeleteGroup,
+			},
+			HelpSynopsis:    "Read, replace, patch and delete SCIM groups.",
+			HelpDescription: "Read, replace, patch and delete the internal group with the given ID as a SCIM group. A request with the PatchOp schema patches the group, any other update replaces it.",
+		},
+	}
+}
+
+func scimListFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"filter": {
+			Type:        framework.TypeString,
+			Description: `Filter of the resources to list, comparing an attribute to a value with the "eq" operator.`,
+		},
+		"startIndex": {
+			Type:        framework.TypeInt,
+			Description: "1-based index of the first resource to return.",
+			Default:     1,
+		},
+		"count": {
+			Type:        framework.TypeInt,
+			Description: "Maximum number of resources to return.",
+			Default:     scimMaxResults,
+		},
+	}
+}
+
+func (i *IdentityStore) pathSCIMReadConfig(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := getSCIMConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"mount_accessor": config.MountAccessor,
+		},
+	}, nil
+}
+
+func (i *IdentityStore) pathSCIMUpdateConfig(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := getSCIMConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if mountAccessorRaw, ok := d.GetOk("mount_accessor"); ok {
+		config.MountAccessor = mountAccessorRaw.(string)
+	}
+
+	if config.MountAccessor != "" {
+		ns, err := namespace.FromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		mountEntry := i.core.router.MatchingMountByAccessor(config.MountAccessor)
+		if mountEntry == nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid mount accessor %q", config.MountAccessor)), nil
+		}
+		if mountEntry.Local {
+			return logical.ErrorResponse(fmt.Sprintf("mount accessor %q is of a local mount", config.MountAccessor)), nil
+		}
+		if mountEntry.NamespaceID != ns.ID {
+			return logical.ErrorResponse("matching mount is in a different namespace than request"), logical.ErrPermissionDenied
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(scimConfigStorageKey, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func getSCIMConfig(ctx context.Context, s logical.Storage) (*scimConfig, error) {
+	var config scimConfig
+	entry, err := s.Get(ctx, scimConfigStorageKey)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		if err := entry.DecodeJSON(&config); err != nil {
+			return nil, err
+		}
+	}
+
+	return &config, nil
+}
+
+func (i *IdentityStore) pathSCIMServiceProviderConfig(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return scimResponse(http.StatusOK, map[string]interface{}{
+		"schemas": []string{scimSchemaServiceProviderConfig},
+		"patch": map[string]interface{}{
+			"supported": true,
+		},
+		"bulk": map[string]interface{}{
+			"supported":      false,
+			"maxOperations":  0,
+			"maxPayloadSize": 0,
+		},
+		"filter": map[string]interface{}{
+			"supported":  true,
+			"maxResults": scimMaxResults,
+		},
+		"changePassword": map[string]interface{}{
+			"supported": false,
+		},
+		"sort": map[string]interface{}{
+			"supported": false,
+		},
+		"etag": map[string]interface{}{
+			"supported": false,
+		},
+		"authenticationSchemes": []map[string]interface{}{
+			{
+				"type":        "oauthbearertoken",
+				"name":        "Vault token",
+				"description": "A Vault token sent as a bearer token in the Authorization header",
+				"primary":     true,
+			},
+		},
+	})
+}
+
+func (i *IdentityStore) pathSCIMResourceTypes(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	resourceTypes := []interface{}{
+		map[string]interface{}{
+			"schemas":  []string{scimSchemaResourceType},
+			"id":       "User",
+			"name":     "User",
+			"endpoint": "/Users",
+			"schema":   scimSchemaUser,
+		},
+		map[string]interface{}{
+			"schemas":  []string{scimSchemaResourceType},
+			"id":       "Group",
+			"name":     "Group",
+			"endpoint": "/Groups",
+			"schema":   scimSchemaGroup,
+		},
+	}
+
+	return scimResponse(http.StatusOK, &scimListResponse{
+		Schemas:      []string{scimSchemaListResponse},
+		TotalResults: len(resourceTypes),
+		StartIndex:   1,
+		ItemsPerPage: len(resourceTypes),
+		Resources:    resourceTypes,
+	})
+}
+
+func (i *IdentityStore) pathSCIMListUsers(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	attribute, value, err := parseSCIMFilter(d.Get("filter").(string))
+	if err != nil {
+		return scimErrorResponse(err)
+	}
+
+	txn := i.db.Txn(false)
+	iter, err := txn.Get(entitiesTable, "namespace_id", ns.ID)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to fetch iterator for entities in memdb: {{err}}", err)
+	}
+
+	var users []*scimUser
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		user, err := i.scimUserFromEntity(raw.(*identity.Entity))
+		if err != nil {
+			return nil, err
+		}
+
+		if attribute != "" {
+			match, err := user.matches(attribute, value)
+			if err != nil {
+				return scimErrorResponse(err)
+			}
+			if !match {
+				continue
+			}
+		}
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].UserName < users[j].UserName
+	})
+	resources := make([]interface{}, len(users))
+	for idx, user := range users {
+		resources[idx] = user
+	}
+
+	return scimListResponseFromResources(resources, d)
+}
+
+func (i *IdentityStore) pathSCIMCreateUser(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	var user scimUser
+	if err := decodeSCIMRequest(req, &user); err != nil {
+		return scimErrorResponse(err)
+	}
+
+	config, err := getSCIMConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	entity := new(identity.Entity)
+	if err := i.applySCIMUser(ctx, config, entity, &user); err != nil {
+		return scimErrorResponse(err)
+	}
+	if err := i.upsertEntity(ctx, entity, nil, true); err != nil {
+		return nil, err
+	}
+
+	created, err := i.scimUserFromEntity(entity)
+	if err != nil {
+		return nil, err
+	}
+	return scimResponse(http.StatusCreated, created)
+}
+
+func (i *IdentityStore) pathSCIMReadUser(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entity, err := i.scimEntityByID(ctx, d.Get("id").(string), false)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil {
+		return scimErrorResponse(newSCIMError(http.StatusNotFound, "", "user not found"))
+	}
+
+	user, err := i.scimUserFromEntity(entity)
+	if err != nil {
+		return nil, err
+	}
+	return scimResponse(http.StatusOK, user)
+}
+
+func (i *IdentityStore) pathSCIMUpdateUser(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := getSCIMConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	entity, err := i.scimEntityByID(ctx, d.Get("id").(string), true)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil {
+		return scimErrorResponse(newSCIMError(http.StatusNotFound, "", "user not found"))
+	}
+
+	patch, err := isSCIMPatchRequest(req)
+	if err != nil {
+		return scimErrorResponse(err)
+	}
+
+	user := new(scimUser)
+	switch {
+	case patch:
+		var patch scimPatchOp
+		if err := decodeSCIMRequest(req, &patch); err != nil {
+			return scimErrorResponse(err)
+		}
+
+		user, err = i.scimUserFromEntity(entity)
+		if err != nil {
+			return nil, err
+		}
+		for _, op := range patch.Operations {
+			if err := user.applyPatchOperation(op); err != nil {
+				return scimErrorResponse(err)
+			}
+		}
+
+	default:
+		if err := decodeSCIMRequest(req, user); err != nil {
+			return scimErrorResponse(err)
+		}
+	}
+
+	if err := i.applySCIMUser(ctx, config, entity, user); err != nil {
+		return scimErrorResponse(err)
+	}
+	if err := i.upsertEntity(ctx, entity, nil, true); err != nil {
+		return nil, err
+	}
+
+	updated, err := i.scimUserFromEntity(entity)
+	if err != nil {
+		return nil, err
+	}
+	return scimResponse(http.StatusOK, updated)
+}
+
+func (i *IdentityStore) pathSCIMDeleteUser(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	txn := i.db.Txn(true)
+	defer txn.Abort()
+
+	entity, err := i.MemDBEntityByIDInTxn(txn, d.Get("id").(string), true)
+	if err != nil {
+		return nil, err
+	}
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil || entity.NamespaceID != ns.ID {
+		return scimErrorResponse(newSCIMError(http.StatusNotFound, "", "user not found"))
+	}
+
+	if err := i.handleEntityDeleteCommon(ctx, txn, entity); err != nil {
+		return nil, err
+	}
+	txn.Commit()
+
+	return scimResponse(http.StatusNoContent, nil)
+}
+
+// scimEntityByID returns the entity with the given ID if it belongs to the
+// namespace of the request
+func (i *IdentityStore) scimEntityByID(ctx context.Context, entityID string, clone bool) (*identity.Entity, error) {
+	entity, err := i.MemDBEntityByID(entityID, clone)
+	if err != nil || entity == nil {
+		return nil, err
+	}
+
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if entity.NamespaceID != ns.ID {
+		return nil, nil
+	}
+	return entity, nil
+}
+
+func (i *IdentityStore) scimUserFromEntity(entity *identity.Entity) (*scimUser, error) {
+	active := scimBool(!entity.Disabled)
+	user := &scimUser{
+		Schemas:     []string{scimSchemaUser},
+		ID:          entity.ID,
+		ExternalID:  entity.Metadata[scimMetadataExternalID],
+		UserName:    entity.Name,
+		DisplayName: entity.Metadata[scimMetadataDisplayName],
+		Active:      &active,
+		Meta: &scimMeta{
+			ResourceType: "User",
+			Created:      ptypes.TimestampString(entity.CreationTime),
+			LastModified: ptypes.TimestampString(entity.LastUpdateTime),
+		},
+	}
+
+	givenName, familyName := entity.Metadata[scimMetadataGivenName], entity.Metadata[scimMetadataFamilyName]
+	if givenName != "" || familyName != "" {
+		user.Name = &scimName{
+			GivenName:  givenName,
+			FamilyName: familyName,
+		}
+	}
+	if email := entity.Metadata[scimMetadataEmail]; email != "" {
+		user.Emails = []scimEmail{
+			{
+				Value:   email,
+				Primary: true,
+			},
+		}
+	}
+
+	groups, err := i.MemDBGroupsByMemberEntityID(entity.ID, false, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if group.Type != groupTypeInternal {
+			continue
+		}
+		user.Groups = append(user.Groups, scimReference{
+			Value:   group.ID,
+			Display: group.Name,
+		})
+	}
+	sort.Slice(user.Groups, func(i, j int) bool {
+		return user.Groups[i].Display < user.Groups[j].Display
+	})
+
+	return user, nil
+}
+
+// applySCIMUser replaces the attributes of the entity with those of the user.
+// The metadata keys not mapped to SCIM attributes and the policies of the
+// entity are kept.
+// N.B.: This must be called with the identity store lock held.
+func (i *IdentityStore) applySCIMUser(ctx context.Context, config *scimConfig, entity *identity.Entity, user *scimUser) error {
+	if user.UserName == "" {
+		return newSCIMError(http.StatusBadRequest, scimErrorInvalidValue, "missing userName")
+	}
+
+	entityByName, err := i.MemDBEntityByName(ctx, user.UserName, false)
+	if err != nil {
+		return err
+	}
+	if entityByName != nil && entityByName.ID != entity.ID {
+		return newSCIMError(http.StatusConflict, scimErrorUniqueness, fmt.Sprintf("userName %q is already in use", user.UserName))
+	}
+
+	metadata := make(map[string]string, len(entity.Metadata))
+	for k, v := range entity.Metadata {
+		if !strutil.StrListContains(scimUserMetadataKeys, k) {
+			metadata[k] = v
+		}
+	}
+	setSCIMMetadata(metadata, scimMetadataExternalID, user.ExternalID)
+	setSCIMMetadata(metadata, scimMetadataDisplayName, user.DisplayName)
+	if user.Name != nil {
+		setSCIMMetadata(metadata, scimMetadataGivenName, user.Name.GivenName)
+		setSCIMMetadata(metadata, scimMetadataFamilyName, user.Name.FamilyName)
+	}
+	setSCIMMetadata(metadata, scimMetadataEmail, user.primaryEmail())
+	if err := validateMetadata(metadata); err != nil {
+		return newSCIMError(http.StatusBadRequest, scimErrorInvalidValue, err.Error())
+	}
+
+	entity.Name = user.UserName
+	entity.Metadata = metadata
+	entity.Disabled = user.Active != nil && !bool(*user.Active)
+
+	if err := i.sanitizeEntity(ctx, entity); err != nil {
+		return err
+	}
+
+	if config.MountAccessor == "" {
+		return nil
+	}
+
+	// Keep the alias on the configured mount named after the userName
+	aliasByFactors, err := i.MemDBAliasByFactors(config.MountAccessor, user.UserName, false, false)
+	if err != nil {
+		return err
+	}
+	if aliasByFactors != nil && aliasByFactors.CanonicalID != entity.ID {
+		return newSCIMError(http.StatusConflict, scimErrorUniqueness, fmt.Sprintf("userName %q is already an alias of entity %q", user.UserName, aliasByFactors.CanonicalID))
+	}
+
+	var alias *identity.Alias
+	for _, entityAlias := range entity.Aliases {
+		if entityAlias.MountAccessor == config.MountAccessor {
+			alias = entityAlias
+			break
+		}
+	}
+	if alias == nil {
+		alias = &identity.Alias{
+			MountAccessor: config.MountAccessor,
+		}
+		entity.Aliases = append(entity.Aliases, alias)
+	}
+	alias.Name = user.UserName
+	alias.CanonicalID = entity.ID
+
+	return i.sanitizeAlias(ctx, alias)
+}
+
+func (u *scimUser) primaryEmail() string {
+	for _, email := range u.Emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+	return ""
+}
+
+// matches returns whether the given attribute of the user equals the value.
+// As defined in the core schema, userName is compared case-insensitively.
+func (u *scimUser) matches(attribute, value string) (bool, error) {
+	switch strings.ToLower(attribute) {
+	case "id":
+		return u.ID == value, nil
+	case "username":
+		return strings.EqualFold(u.UserName, value), nil
+	case "externalid":
+		return u.ExternalID == value, nil
+	case "emails", "emails.value":
+		return strings.EqualFold(u.primaryEmail(), value), nil
+	default:
+		return false, newSCIMError(http.StatusBadRequest, scimErrorInvalidFilter, fmt.Sprintf("filtering users on %q is not supported", attribute))
+	}
+}
+
+// applyPatchOperation applies the operation to the user. Attributes which are
+// not stored in the identity store are ignored, as they are when creating or
+// replacing the user.
+func (u *scimUser) applyPatchOperation(op scimPatchOperation) error {
+	path, _, err := parseSCIMPatchPath(op.Path, scimSchemaUser)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+		if path == "" {
+			// The value holds the attributes to set, by path
+			var attributes map[string]json.RawMessage
+			if err := json.Unmarshal(op.Value, &attributes); err != nil {
+				return newSCIMError(http.StatusBadRequest, scimErrorInvalidSyntax, "the value of an operation without path must be an object")
+			}
+			for attributePath, value := range attributes {
+				if attributePath == "" {
+					continue
+				}
+				if err := u.applyPatchOperation(scimPatchOperation{Op: op.Op, Path: attributePath, Value: value}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		var target interface{}
+		switch path {
+		case "username":
+			target = &u.UserName
+		case "displayname":
+			target = &u.DisplayName
+		case "externalid":
+			target = &u.ExternalID
+		case "active":
+			u.Active = new(scimBool)
+			target = u.Active
+		case "name":
+			u.Name = new(scimName)
+			target = u.Name
+		case "name.givenname", "name.familyname":
+			if u.Name == nil {
+				u.Name = new(scimName)
+			}
+			target = &u.Name.GivenName
+			if path == "name.familyname" {
+				target = &u.Name.FamilyName
+			}
+		case "emails":
+			u.Emails = nil
+			target = &u.Emails
+		case "emails.value":
+			u.Emails = []scimEmail{{Primary: true}}
+			target = &u.Emails[0].Value
+		default:
+			return nil
+		}
+		if err := json.Unmarshal(op.Value, target); err != nil {
+			return newSCIMError(http.StatusBadRequest, scimErrorInvalidValue, fmt.Sprintf("invalid value for %q", op.Path))
+		}
+
+	case "remove":
+		switch path {
+		case "":
+			return newSCIMError(http.StatusBadRequest, scimErrorInvalidPath, "missing path of remove operation")
+		case "username":
+			return newSCIMError(http.StatusBadRequest, scimErrorInvalidValue, "userName cannot be removed")
+		case "displayname":
+			u.DisplayName = ""
+		case "externalid":
+			u.ExternalID = ""
+		case "active":
+			u.Active = nil
+		case "name":
+			u.Name = nil
+		case "name.givenname":
+			if u.Name != nil {
+				u.Name.GivenName = ""
+			}
+		case "name.familyname":
+			if u.Name != nil {
+				u.Name.FamilyName = ""
+			}
+		case "emails", "emails.value":
+			u.Emails = nil
+		}
+
+	default:
+		return newSCIMError(http.StatusBadRequest, scimErrorInvalidSyntax, fmt.Sprintf("invalid operation %q", op.Op))
+	}
+
+	return nil
+}
+
+func (i *IdentityStore) pathSCIMListGroups(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	attribute, value, err := parseSCIMFilter(d.Get("filter").(string))
+	if err != nil {
+		return scimErrorResponse(err)
+	}
+
+	txn := i.db.Txn(false)
+	iter, err := txn.Get(groupsTable, "namespace_id", ns.ID)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to fetch iterator for groups in memdb: {{err}}", err)
+	}
+
+	var groups []*scimGroup
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		group := raw.(*identity.Group)
+		if group.Type != groupTypeInternal {
+			continue
+		}
+
+		resource, err := i.scimGroupFromGroup(group)
+		if err != nil {
+			return nil, err
+		}
+
+		if attribute != "" {
+			match, err := resource.matches(attribute, value)
+			if err != nil {
+				return scimErrorResponse(err)
+			}
+			if !match {
+				continue
+			}
+		}
+		groups = append(groups, resource)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].DisplayName < groups[j].DisplayName
+	})
+	resources := make([]interface{}, len(groups))
+	for idx, group := range groups {
+		resources[idx] = group
+	}
+
+	return scimListResponseFromResources(resources, d)
+}
+
+func (i *IdentityStore) pathSCIMCreateGroup(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	var resource scimGroup
+	if err := decodeSCIMRequest(req, &resource); err != nil {
+		return scimErrorResponse(err)
+	}
+
+	i.groupLock.Lock()
+	defer i.groupLock.Unlock()
+
+	group := &identity.Group{
+		Type: groupTypeInternal,
+	}
+	if err := i.applySCIMGroup(ctx, group, &resource); err != nil {
+		return scimErrorResponse(err)
+	}
+
+	created, err := i.scimGroupFromGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	return scimResponse(http.StatusCreated, created)
+}
+
+func (i *IdentityStore) pathSCIMReadGroup(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	group, err := i.scimGroupByID(ctx, d.Get("id").(string), false)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return scimErrorResponse(newSCIMError(http.StatusNotFound, "", "group not found"))
+	}
+
+	resource, err := i.scimGroupFromGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	return scimResponse(http.StatusOK, resource)
+}
+
+func (i *IdentityStore) pathSCIMUpdateGroup(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	i.groupLock.Lock()
+	defer i.groupLock.Unlock()
+
+	group, err := i.scimGroupByID(ctx, d.Get("id").(string), true)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return scimErrorResponse(newSCIMError(http.StatusNotFound, "", "group not found"))
+	}
+
+	patch, err := isSCIMPatchRequest(req)
+	if err != nil {
+		return scimErrorResponse(err)
+	}
+
+	resource := new(scimGroup)
+	switch {
+	case patch:
+		var patch scimPatchOp
+		if err := decodeSCIMRequest(req, &patch); err != nil {
+			return scimErrorResponse(err)
+		}
+
+		resource, err = i.scimGroupFromGroup(group)
+		if err != nil {
+			return nil, err
+		}
+		for _, op := range patch.Operations {
+			if err := resource.applyPatchOperation(op); err != nil {
+				return scimErrorResponse(err)
+			}
+		}
+
+	default:
+		if err := decodeSCIMRequest(req, resource); err != nil {
+			return scimErrorResponse(err)
+		}
+	}
+
+	if err := i.applySCIMGroup(ctx, group, resource); err != nil {
+		return scimErrorResponse(err)
+	}
+
+	updated, err := i.scimGroupFromGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	return scimResponse(http.StatusOK, updated)
+}
+
+func (i *IdentityStore) pathSCIMDeleteGroup(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	group, err := i.scimGroupByID(ctx, d.Get("id").(string), false)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return scimErrorResponse(newSCIMError(http.StatusNotFound, "", "group not found"))
+	}
+
+	resp, err := i.handleGroupDeleteCommon(ctx, group.ID, true)
+	if err != nil || resp != nil {
+		return resp, err
+	}
+
+	return scimResponse(http.StatusNoContent, nil)
+}
+
+// scimGroupByID returns the group with the given ID if it is an internal group
+// of the namespace of the request
+func (i *IdentityStore) scimGroupByID(ctx context.Context, groupID string, clone bool) (*identity.Group, error) {
+	group, err := i.MemDBGroupByID(groupID, clone)
+	if err != nil || group == nil {
+		return nil, err
+	}
+
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if group.NamespaceID != ns.ID || group.Type != groupTypeInternal {
+		return nil, nil
+	}
+	return group, nil
+}
+
+func (i *IdentityStore) scimGroupFromGroup(group *identity.Group) (*scimGroup, error) {
+	resource := &scimGroup{
+		Schemas:     []string{scimSchemaGroup},
+		ID:          group.ID,
+		ExternalID:  group.Metadata[scimMetadataExternalID],
+		DisplayName: group.Name,
+		Members:     []scimReference{},
+		Meta: &scimMeta{
+			ResourceType: "Group",
+			Created:      ptypes.TimestampString(group.CreationTime),
+			LastModified: ptypes.TimestampString(group.LastUpdateTime),
+		},
+	}
+
+	for _, entityID := range group.MemberEntityIDs {
+		entity, err := i.MemDBEntityByID(entityID, false)
+		if err != nil {
+			return nil, err
+		}
+		if entity == nil {
+			continue
+		}
+		resource.Members = append(resource.Members, scimReference{
+			Value:   entity.ID,
+			Display: entity.Name,
+		})
+	}
+	sort.Slice(resource.Members, func(i, j int) bool {
+		return resource.Members[i].Display < resource.Members[j].Display
+	})
+
+	return resource, nil
+}
+
+// applySCIMGroup replaces the name, external ID and member entities of the
+// group with those of the SCIM group and stores it. The member groups and
+// policies of the group are kept.
+// N.B.: This must be called with the group lock held.
+func (i *IdentityStore) applySCIMGroup(ctx context.Context, group *identity.Group, resource *scimGroup) error {
+	if resource.DisplayName == "" {
+		return newSCIMError(http.StatusBadRequest, scimErrorInvalidValue, "missing displayName")
+	}
+
+	groupByName, err := i.MemDBGroupByName(ctx, resource.DisplayName, false)
+	if err != nil {
+		return err
+	}
+	if groupByName != nil && groupByName.ID != group.ID {
+		return newSCIMError(http.StatusConflict, scimErrorUniqueness, fmt.Sprintf("displayName %q is already in use", resource.DisplayName))
+	}
+
+	memberEntityIDs := make([]string, 0, len(resource.Members))
+	for _, member := range resource.Members {
+		entity, err := i.scimEntityByID(ctx, member.Value, false)
+		if err != nil {
+			return err
+		}
+		if entity == nil {
+			return newSCIMError(http.StatusBadRequest, scimErrorInvalidValue, fmt.Sprintf("member %q is not a user", member.Value))
+		}
+		memberEntityIDs = append(memberEntityIDs, entity.ID)
+	}
+
+	metadata := make(map[string]string, len(group.Metadata))
+	for k, v := range group.Metadata {
+		if !strutil.StrListContains(scimGroupMetadataKeys, k) {
+			metadata[k] = v
+		}
+	}
+	setSCIMMetadata(metadata, scimMetadataExternalID, resource.ExternalID)
+	if err := validateMetadata(metadata); err != nil {
+		return newSCIMError(http.StatusBadRequest, scimErrorInvalidValue, err.Error())
+	}
+
+	group.Name = resource.DisplayName
+	group.Metadata = metadata
+	group.MemberEntityIDs = memberEntityIDs
+
+	return i.sanitizeAndUpsertGroup(ctx, group, nil, nil)
+}
+
+// matches returns whether the given attribute of the group equals the value.
+// As defined in the core schema, displayName is compared case-insensitively.
+func (g *scimGroup) matches(attribute, value string) (bool, error) {
+	switch strings.ToLower(attribute) {
+	case "id":
+		return g.ID == value, nil
+	case "displayname":
+		return strings.EqualFold(g.DisplayName, value), nil
+	case "externalid":
+		return g.ExternalID == value, nil
+	case "members", "members.value":
+		for _, member := range g.Members {
+			if member.Value == value {
+				return true, nil
+			}
+		}
+		return false, nil
+	default:
+		return false, newSCIMError(http.StatusBadRequest, scimErrorInvalidFilter, fmt.Sprintf("filtering groups on %q is not supported", attribute))
+	}
+}
+
+// applyPatchOperation applies the operation to the group. Attributes which are
+// not stored in the identity store are ignored.
+func (g *scimGroup) applyPatchOperation(op scimPatchOperation) error {
+	path, filterValue, err := parseSCIMPatchPath(op.Path, scimSchemaGroup)
+	if err != nil {
+		return err
+	}
+
+	var members []scimReference
+	if path == "members" && len(op.Value) > 0 {
+		if err := json.Unmarshal(op.Value, &members); err != nil {
+			return newSCIMError(http.StatusBadRequest, scimErrorInvalidValue, "invalid value for members")
+		}
+	}
+
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+		switch path {
+		case "":
+			// The value holds the attributes to set, by path
+			var attributes map[string]json.RawMessage
+			if err := json.Unmarshal(op.Value, &attributes); err != nil {
+				return newSCIMError(http.StatusBadRequest, scimErrorInvalidSyntax, "the value of an operation without path must be an object")
+			}
+			for attributePath, value := range attributes {
+				if attributePath == "" {
+					continue
+				}
+				if err := g.applyPatchOperation(scimPatchOperation{Op: op.Op, Path: attributePath, Value: value}); err != nil {
+					return err
+				}
+			}
+
+		case "displayname":
+			if err := json.Unmarshal(op.Value, &g.DisplayName); err != nil {
+				return newSCIMError(http.StatusBadRequest, scimErrorInvalidValue, "invalid value for displayName")
+			}
+
+		case "externalid":
+			if err := json.Unmarshal(op.Value, &g.ExternalID); err != nil {
+				return newSCIMError(http.StatusBadRequest, scimErrorInvalidValue, "invalid value for externalId")
+			}
+
+		case "members":
+			if filterValue != "" {
+				return newSCIMError(http.StatusBadRequest, scimErrorInvalidPath, "members cannot be filtered when adding or replacing them")
+			}
+			if strings.ToLower(op.Op) == "replace" {
+				g.Members = nil
+			}
+			g.Members = append(g.Members, members...)
+		}
+
+	case "remove":
+		switch path {
+		case "":
+			return newSCIMError(http.StatusBadRequest, scimErrorInvalidPath, "missing path of remove operation")
+
+		case "displayname":
+			return newSCIMError(http.StatusBadRequest, scimErrorInvalidValue, "displayName cannot be removed")
+
+		case "externalid":
+			g.ExternalID = ""
+
+		case "members":
+			// Remove the members selected by the filter or listed in the
+			// value, or all of them
+			var remove []string
+			for _, member := range members {
+				remove = append(remove, member.Value)
+			}
+			if filterValue != "" {
+				remove = append(remove, filterValue)
+			}
+
+			var kept []scimReference
+			if len(remove) > 0 {
+				for _, member := range g.Members {
+					if !strutil.StrListContains(remove, member.Value) {
+						kept = append(kept, member)
+					}
+				}
+			}
+			g.Members = kept
+		}
+
+	default:
+		return newSCIMError(http.StatusBadRequest, scimErrorInvalidSyntax, fmt.Sprintf("invalid operation %q", op.Op))
+	}
+
+	return nil
+}
+
+// parseSCIMFilter parses a filter comparing an attribute to a value with the
+// eq operator, the only one supported.
+func parseSCIMFilter(filter string) (string, string, error) {
+	if filter == "" {
+		return "", "", nil
+	}
+
+	matches := scimFilterRegex.FindStringSubmatch(filter)
+	if matches == nil {
+		return "", "", newSCIMError(http.StatusBadRequest, scimErrorInvalidFilter, fmt.Sprintf("unsupported filter %q, only the eq operator is supported", filter))
+	}
+	value, err := strconv.Unquote(matches[2])
+	if err != nil {
+		return "", "", newSCIMError(http.StatusBadRequest, scimErrorInvalidFilter, fmt.Sprintf("invalid value in filter %q", filter))
+	}
+
+	return matches[1], value, nil
+}
+
+// parseSCIMPatchPath returns the lower-cased attribute path of a patch
+// operation, without the schema of the resource, along with the value the
+// filter of a multi-valued attribute selects, e.g. members[value eq "id"] or
+// emails[type eq "work"].value.
+func parseSCIMPatchPath(path, schema string) (string, string, error) {
+	if len(path) > len(schema) && strings.EqualFold(path[:len(schema)+1], schema+":") {
+		path = path[len(schema)+1:]
+	}
+
+	var filterValue string
+	if start := strings.Index(path, "["); start >= 0 {
+		end := strings.Index(path, "]")
+		if end < start {
+			return "", "", newSCIMError(http.StatusBadRequest, scimErrorInvalidPath, fmt.Sprintf("invalid path %q", path))
+		}
+
+		var err error
+		_, filterValue, err = parseSCIMFilter(path[start+1 : end])
+		if err != nil {
+			return "", "", newSCIMError(http.StatusBadRequest, scimErrorInvalidPath, fmt.Sprintf("invalid filter in path %q", path))
+		}
+		path = path[:start] + path[end+1:]
+	}
+
+	return strings.ToLower(path), filterValue, nil
+}
+
+func setSCIMMetadata(metadata map[string]string, key, value string) {
+	if value != "" {
+		metadata[key] = value
+	}
+}
+
+// isSCIMPatchRequest returns whether the request patches a resource, that is
+// whether it was sent with the PATCH method, as both PUT and PATCH are mapped
+// to an update operation. A body which does not match the method is rejected.
+func isSCIMPatchRequest(req *logical.Request) (bool, error) {
+	patch := req.HTTPRequest != nil && req.HTTPRequest.Method == http.MethodPatch
+
+	isPatchOp := false
+	schemas, _ := req.Data["schemas"].([]interface{})
+	for _, schema := range schemas {
+		if s, ok := schema.(string); ok && s == scimSchemaPatchOp {
+			isPatchOp = true
+		}
+	}
+
+	switch {
+	case patch && !isPatchOp:
+		return false, newSCIMError(http.StatusBadRequest, scimErrorInvalidSyntax, "the body of a PATCH request must be a PatchOp message")
+	case !patch && isPatchOp:
+		return false, newSCIMError(http.StatusBadRequest, scimErrorInvalidSyntax, "PatchOp messages must be sent with the PATCH method")
+	}
+	return patch, nil
+}
+
+func decodeSCIMRequest(req *logical.Request, out interface{}) error {
+	data, err := json.Marshal(req.Data)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return newSCIMError(http.StatusBadRequest, scimErrorInvalidSyntax, fmt.Sprintf("invalid request: %v", err))
+	}
+	return nil
+}
+
+func scimListResponseFromResources(resources []interface{}, d *framework.FieldData) (*logical.Response, error) {
+	startIndex := d.Get("startIndex").(int)
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count := d.Get("count").(int)
+	if count < 0 {
+		count = 0
+	}
+	if count > scimMaxResults {
+		count = scimMaxResults
+	}
+
+	page := []interface{}{}
+	if startIndex <= len(resources) {
+		page = resources[startIndex-1:]
+		if len(page) > count {
+			page = page[:count]
+		}
+	}
+
+	return scimResponse(http.StatusOK, &scimListResponse{
+		Schemas:      []string{scimSchemaListResponse},
+		TotalResults: len(resources),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	})
+}
+
+// scimResponse returns a SCIM response with the given status and body. A nil
+// body is only valid along with a 204 status.
+func scimResponse(status int, body interface{}) (*logical.Response, error) {
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode: status,
+		},
+	}
+	if body == nil {
+		return resp, nil
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Data[logical.HTTPRawBody] = data
+	resp.Data[logical.HTTPContentType] = scimContentType
+
+	return resp, nil
+}
+
+// scimErrorResponse returns the response of a SCIM error, or the error itself
+// if it is not one
+func scimErrorResponse(err error) (*logical.Response, error) {
+	scimErr, ok := err.(*scimError)
+	if !ok {
+		return nil, err
+	}
+
+	status, _ := strconv.Atoi(scimErr.Status)
+	return scimResponse(status, scimErr)
+}
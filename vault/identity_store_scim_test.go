@@ -0,0 +1,356 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// testSCIMRequest sends a request to the SCIM API and decodes the response
+// body into out, checking the status of the response
+func testSCIMRequest(ctx context.Context, t *testing.T, is *IdentityStore, method, path string, data map[string]interface{}, status int, out interface{}) {
+	t.Helper()
+
+	var op logical.Operation
+	switch method {
+	case http.MethodGet:
+		op = logical.ReadOperation
+	case http.MethodDelete:
+		op = logical.DeleteOperation
+	default:
+		op = logical.UpdateOperation
+	}
+
+	// Requests are decoded as sent through the HTTP API
+	if data != nil {
+		buf, err := json.Marshal(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = nil
+		if err := json.Unmarshal(buf, &data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, err := is.HandleRequest(ctx, &logical.Request{
+		Path:        path,
+		Operation:   op,
+		Data:        data,
+		Storage:     is.view,
+		HTTPRequest: &http.Request{Method: method},
+	})
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	if resp == nil || resp.Data[logical.HTTPStatusCode] != status {
+		t.Fatalf("%s %s: expected status %d, got %#v", method, path, status, resp)
+	}
+	if out == nil {
+		return
+	}
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), out); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSCIM_Users(t *testing.T) {
+	ctx := namespace.RootContext(nil)
+	is, ghAccessor, _ := testIdentityStoreWithGithubAuth(ctx, t)
+
+	resp, err := is.HandleRequest(ctx, &logical.Request{
+		Path:      "scim/config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"mount_accessor": ghAccessor,
+		},
+		Storage: is.view,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	// Create a user
+	var user scimUser
+	testSCIMRequest(ctx, t, is, http.MethodPost, "scim/v2/Users", map[string]interface{}{
+		"schemas":    []string{scimSchemaUser},
+		"userName":   "alice",
+		"externalId": "00u1",
+		"name": map[string]interface{}{
+			"givenName":  "Alice",
+			"familyName": "Liddell",
+		},
+		"emails": []map[string]interface{}{
+			{"value": "alice@example.com", "primary": true},
+		},
+		"active": true,
+	}, 201, &user)
+	if user.ID == "" || user.UserName != "alice" || user.ExternalID != "00u1" || !bool(*user.Active) {
+		t.Fatalf("bad: %#v", user)
+	}
+
+	entity, err := is.MemDBEntityByID(user.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entity.Name != "alice" || entity.Metadata["email"] != "alice@example.com" || entity.Metadata["given_name"] != "Alice" {
+		t.Fatalf("bad: %#v", entity)
+	}
+	if len(entity.Aliases) != 1 || entity.Aliases[0].Name != "alice" || entity.Aliases[0].MountAccessor != ghAccessor {
+		t.Fatalf("bad aliases: %#v", entity.Aliases)
+	}
+
+	// The userName is unique
+	var scimErr scimError
+	testSCIMRequest(ctx, t, is, http.MethodPost, "scim/v2/Users", map[string]interface{}{
+		"userName": "alice",
+	}, 409, &scimErr)
+	if scimErr.ScimType != scimErrorUniqueness {
+		t.Fatalf("bad: %#v", scimErr)
+	}
+
+	// Filter the users
+	var list scimListResponse
+	testSCIMRequest(ctx, t, is, http.MethodGet, "scim/v2/Users", map[string]interface{}{
+		"filter": `userName eq "ALICE"`,
+	}, 200, &list)
+	if list.TotalResults != 1 || len(list.Resources) != 1 {
+		t.Fatalf("bad: %#v", list)
+	}
+	testSCIMRequest(ctx, t, is, http.MethodGet, "scim/v2/Users", map[string]interface{}{
+		"filter": `userName eq "bob"`,
+	}, 200, &list)
+	if list.TotalResults != 0 || len(list.Resources) != 0 {
+		t.Fatalf("bad: %#v", list)
+	}
+	testSCIMRequest(ctx, t, is, http.MethodGet, "scim/v2/Users", map[string]interface{}{
+		"filter": `userName sw "al"`,
+	}, 400, &scimErr)
+	if scimErr.ScimType != scimErrorInvalidFilter {
+		t.Fatalf("bad: %#v", scimErr)
+	}
+
+	// Deactivate the user and rename it, with the string booleans some
+	// connectors send
+	userID := user.ID
+	user = scimUser{}
+	testSCIMRequest(ctx, t, is, http.MethodPatch, "scim/v2/Users/"+userID, map[string]interface{}{
+		"schemas": []string{scimSchemaPatchOp},
+		"Operations": []map[string]interface{}{
+			{"op": "Replace", "value": map[string]interface{}{"active": "False"}},
+			{"op": "replace", "path": "userName", "value": "alice.liddell"},
+			{"op": "replace", "path": `emails[type eq "work"].value`, "value": "al@example.com"},
+			{"op": "remove", "path": "name.givenName"},
+		},
+	}, 200, &user)
+	if bool(*user.Active) || user.UserName != "alice.liddell" || user.Emails[0].Value != "al@example.com" || user.Name.GivenName != "" || user.Name.FamilyName != "Liddell" {
+		t.Fatalf("bad: %#v", user)
+	}
+
+	entity, err = is.MemDBEntityByID(user.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !entity.Disabled || len(entity.Aliases) != 1 || entity.Aliases[0].Name != "alice.liddell" {
+		t.Fatalf("bad: %#v", entity)
+	}
+	alias, err := is.MemDBAliasByFactors(ghAccessor, "alice.liddell", false, false)
+	if err != nil || alias == nil || alias.CanonicalID != user.ID {
+		t.Fatalf("err:%v alias:%#v", err, alias)
+	}
+
+	// The body must match the method
+	testSCIMRequest(ctx, t, is, http.MethodPatch, "scim/v2/Users/"+userID, map[string]interface{}{
+		"schemas":  []string{scimSchemaUser},
+		"userName": "alice",
+	}, 400, &scimErr)
+	if scimErr.ScimType != scimErrorInvalidSyntax {
+		t.Fatalf("bad: %#v", scimErr)
+	}
+	testSCIMRequest(ctx, t, is, http.MethodPut, "scim/v2/Users/"+userID, map[string]interface{}{
+		"schemas": []string{scimSchemaPatchOp},
+		"Operations": []map[string]interface{}{
+			{"op": "replace", "path": "userName", "value": "alice"},
+		},
+	}, 400, &scimErr)
+	if scimErr.ScimType != scimErrorInvalidSyntax {
+		t.Fatalf("bad: %#v", scimErr)
+	}
+
+	// Replacing the user keeps the metadata and policies not managed through
+	// SCIM
+	entity, err = entity.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entity.Policies = []string{"default"}
+	entity.Metadata["team"] = "eng"
+	if err := is.upsertEntity(ctx, entity, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	user = scimUser{}
+	testSCIMRequest(ctx, t, is, http.MethodPut, "scim/v2/Users/"+userID, map[string]interface{}{
+		"schemas":  []string{scimSchemaUser},
+		"userName": "alice.liddell",
+		"active":   true,
+	}, 200, &user)
+	if user.ExternalID != "" || len(user.Emails) != 0 || user.Name != nil || !bool(*user.Active) {
+		t.Fatalf("bad: %#v", user)
+	}
+	entity, err = is.MemDBEntityByID(user.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entity.Disabled || entity.Metadata["team"] != "eng" || entity.Metadata["email"] != "" || len(entity.Policies) != 1 {
+		t.Fatalf("bad: %#v", entity)
+	}
+
+	// Delete the user
+	testSCIMRequest(ctx, t, is, http.MethodDelete, "scim/v2/Users/"+user.ID, nil, 204, nil)
+	testSCIMRequest(ctx, t, is, http.MethodGet, "scim/v2/Users/"+user.ID, nil, 404, &scimErr)
+	alias, err = is.MemDBAliasByFactors(ghAccessor, "alice.liddell", false, false)
+	if err != nil || alias != nil {
+		t.Fatalf("err:%v alias:%#v", err, alias)
+	}
+}
+
+func TestSCIM_Groups(t *testing.T) {
+	ctx := namespace.RootContext(nil)
+	is, _, _ := testIdentityStoreWithGithubAuth(ctx, t)
+
+	var userIDs []string
+	for _, name := range []string{"alice", "bob", "carol"} {
+		var user scimUser
+		testSCIMRequest(ctx, t, is, http.MethodPost, "scim/v2/Users", map[string]interface{}{
+			"userName": name,
+		}, 201, &user)
+		userIDs = append(userIDs, user.ID)
+	}
+
+	// Create a group
+	var group scimGroup
+	testSCIMRequest(ctx, t, is, http.MethodPost, "scim/v2/Groups", map[string]interface{}{
+		"schemas":     []string{scimSchemaGroup},
+		"displayName": "engineering",
+		"externalId":  "00g1",
+		"members": []map[string]interface{}{
+			{"value": userIDs[0]},
+		},
+	}, 201, &group)
+	if group.ID == "" || group.DisplayName != "engineering" || group.ExternalID != "00g1" || len(group.Members) != 1 || group.Members[0].Display != "alice" {
+		t.Fatalf("bad: %#v", group)
+	}
+
+	// Members must be users
+	var scimErr scimError
+	testSCIMRequest(ctx, t, is, http.MethodPost, "scim/v2/Groups", map[string]interface{}{
+		"displayName": "other",
+		"members": []map[string]interface{}{
+			{"value": "invalid"},
+		},
+	}, 400, &scimErr)
+
+	// Add and remove members
+	testSCIMRequest(ctx, t, is, http.MethodPatch, "scim/v2/Groups/"+group.ID, map[string]interface{}{
+		"schemas": []string{scimSchemaPatchOp},
+		"Operations": []map[string]interface{}{
+			{"op": "add", "path": "members", "value": []map[string]interface{}{{"value": userIDs[1]}, {"value": userIDs[2]}}},
+			{"op": "remove", "path": fmt.Sprintf("members[value eq %q]", userIDs[0])},
+		},
+	}, 200, &group)
+	if len(group.Members) != 2 || group.Members[0].Value != userIDs[1] || group.Members[1].Value != userIDs[2] {
+		t.Fatalf("bad: %#v", group)
+	}
+
+	// The groups of the users are listed
+	var user scimUser
+	testSCIMRequest(ctx, t, is, http.MethodGet, "scim/v2/Users/"+userIDs[1], nil, 200, &user)
+	if len(user.Groups) != 1 || user.Groups[0].Value != group.ID || user.Groups[0].Display != "engineering" {
+		t.Fatalf("bad: %#v", user)
+	}
+
+	// Rename the group
+	testSCIMRequest(ctx, t, is, http.MethodPatch, "scim/v2/Groups/"+group.ID, map[string]interface{}{
+		"schemas": []string{scimSchemaPatchOp},
+		"Operations": []map[string]interface{}{
+			{"op": "replace", "value": map[string]interface{}{"displayName": "eng"}},
+		},
+	}, 200, &group)
+	if group.DisplayName != "eng" || len(group.Members) != 2 {
+		t.Fatalf("bad: %#v", group)
+	}
+
+	// External groups are not exposed
+	resp, err := is.HandleRequest(ctx, &logical.Request{
+		Path:      "group",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"name": "external",
+			"type": "external",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	externalGroupID := resp.Data["id"].(string)
+	testSCIMRequest(ctx, t, is, http.MethodGet, "scim/v2/Groups/"+externalGroupID, nil, 404, &scimErr)
+
+	var list scimListResponse
+	testSCIMRequest(ctx, t, is, http.MethodGet, "scim/v2/Groups", map[string]interface{}{}, 200, &list)
+	if list.TotalResults != 1 {
+		t.Fatalf("bad: %#v", list)
+	}
+	testSCIMRequest(ctx, t, is, http.MethodGet, "scim/v2/Groups", map[string]interface{}{
+		"filter": `displayName eq "eng"`,
+	}, 200, &list)
+	if list.TotalResults != 1 {
+		t.Fatalf("bad: %#v", list)
+	}
+
+	// Deleting a user removes it from the group
+	testSCIMRequest(ctx, t, is, http.MethodDelete, "scim/v2/Users/"+userIDs[1], nil, 204, nil)
+	testSCIMRequest(ctx, t, is, http.MethodGet, "scim/v2/Groups/"+group.ID, nil, 200, &group)
+	if len(group.Members) != 1 || group.Members[0].Value != userIDs[2] {
+		t.Fatalf("bad: %#v", group)
+	}
+
+	testSCIMRequest(ctx, t, is, http.MethodDelete, "scim/v2/Groups/"+group.ID, nil, 204, nil)
+	testSCIMRequest(ctx, t, is, http.MethodGet, "scim/v2/Groups/"+group.ID, nil, 404, &scimErr)
+}
+
+func TestSCIM_ListPagination(t *testing.T) {
+	ctx := namespace.RootContext(nil)
+	is, _, _ := testIdentityStoreWithGithubAuth(ctx, t)
+
+	for _, name := range []string{"d", "b", "a", "c"} {
+		testSCIMRequest(ctx, t, is, http.MethodPost, "scim/v2/Users", map[string]interface{}{
+			"userName": name,
+		}, 201, nil)
+	}
+
+	var list struct {
+		TotalResults int        `json:"totalResults"`
+		StartIndex   int        `json:"startIndex"`
+		ItemsPerPage int        `json:"itemsPerPage"`
+		Resources    []scimUser `json:"Resources"`
+	}
+	testSCIMRequest(ctx, t, is, http.MethodGet, "scim/v2/Users", map[string]interface{}{
+		"startIndex": "2",
+		"count":      "2",
+	}, 200, &list)
+	if list.TotalResults != 4 || list.StartIndex != 2 || list.ItemsPerPage != 2 || list.Resources[0].UserName != "b" || list.Resources[1].UserName != "c" {
+		t.Fatalf("bad: %#v", list)
+	}
+
+	testSCIMRequest(ctx, t, is, http.MethodGet, "scim/v2/Users", map[string]interface{}{
+		"startIndex": "5",
+	}, 200, &list)
+	if list.TotalResults != 4 || list.ItemsPerPage != 0 || len(list.Resources) != 0 {
+		t.Fatalf("bad: %#v", list)
+	}
+}
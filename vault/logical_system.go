@@ -159,6 +159,7 @@ func NewSystemBackend(core *Core, logger log.Logger) *SystemBackend {
 	b.Backend.Paths = append(b.Backend.Paths, b.remountPath())
 	b.Backend.Paths = append(b.Backend.Paths, b.metricsPath())
 	b.Backend.Paths = append(b.Backend.Paths, b.hostInfoPath())
+	b.Backend.Paths = append(b.Backend.Paths, b.quotasPaths()...)
 
 	if core.rawEnabled {
 		b.Backend.Paths = append(b.Backend.Paths, b.rawPaths()...)
@@ -263,6 +264,32 @@ func (b *SystemBackend) handleTidyLeases(ctx context.Context, req *logical.Reque
 	return logical.RespondWithStatusCode(resp, req, http.StatusAccepted)
 }
 
+// handleLeaseCounts returns the number of pending leases of every mount in
+// the request's namespace, as indexed by the expiration manager
+func (b *SystemBackend) handleLeaseCounts(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]interface{})
+	var total int
+	for mountPath, count := range b.Core.expiration.LeaseCountsByMount() {
+		if !strings.HasPrefix(mountPath, ns.Path) {
+			continue
+		}
+		counts[ns.TrimmedPath(mountPath)] = count
+		total += count
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"counts": counts,
+			"total":  total,
+		},
+	}, nil
+}
+
 func (b *SystemBackend) handlePluginCatalogTypedList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	pluginType, err := consts.ParsePluginType(d.Get("type").(string))
 	if err != nil {
@@ -3852,6 +3879,15 @@ Enable a new audit backend or disable an existing backend.
 		on a given path.`,
 	},
 
+	"lease_counts": {
+		"Returns the number of leases held by each mount.",
+		`
+Returns the number of leases currently tracked by the expiration manager for
+each secrets engine or auth method mount, along with their total. Leases
+without an expiration, such as root tokens, are not counted.
+		`,
+	},
+
 	"tidy_leases": {
 		`This endpoint performs cleanup tasks that can be run if certain error
 conditions have occurred.`,
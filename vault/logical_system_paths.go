@@ -1153,6 +1153,20 @@ func (b *SystemBackend) leasePaths() []*framework.Path {
 			HelpSynopsis:    strings.TrimSpace(sysHelp["tidy_leases"][0]),
 			HelpDescription: strings.TrimSpace(sysHelp["tidy_leases"][1]),
 		},
+
+		{
+			Pattern: "leases/counts$",
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCounts,
+					Summary:  "Returns the number of leases held by each mount.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["lease_counts"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["lease_counts"][1]),
+		},
 	}
 }
 
@@ -0,0 +1,423 @@
+package vault
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault/quotas"
+)
+
+// quotasPaths returns paths that enable quota management
+func (b *SystemBackend) quotasPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "quotas/config$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"rate_limit_exempt_paths": {
+					Type:        framework.TypeStringSlice,
+					Description: "Request paths that are never subject to rate limit quotas. Paths ending in '*' are treated as prefixes.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleQuotasConfigRead(),
+					Summary:  "Read the quota configuration.",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleQuotasConfigUpdate(),
+					Summary:  "Update the quota configuration.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysQuotasHelp["quotas-config"][0]),
+			HelpDescription: strings.TrimSpace(sysQuotasHelp["quotas-config"][1]),
+		},
+		{
+			Pattern: "quotas/rate-limit/?$",
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.handleRateLimitQuotasList(),
+					Summary:  "List the names of the rate limit quotas.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysQuotasHelp["rate-limit-list"][0]),
+			HelpDescription: strings.TrimSpace(sysQuotasHelp["rate-limit-list"][1]),
+		},
+		{
+			Pattern: "quotas/rate-limit/" + framework.GenericNameRegex("name"),
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the quota.",
+				},
+				"path": {
+					Type:        framework.TypeString,
+					Description: "Mount path, such as 'secret/' or 'auth/userpass/', the quota applies to. An empty path applies the quota globally.",
+				},
+				"rate": {
+					Type:        framework.TypeFloat,
+					Description: "Number of requests per second allowed by the quota. Must be positive.",
+				},
+				"burst": {
+					Type:        framework.TypeInt,
+					Description: "Maximum number of requests allowed at once. Defaults to the rate rounded up.",
+				},
+				"per_client_ip": {
+					Type:        framework.TypeBool,
+					Description: "If set, the rate and burst apply to each client IP address separately.",
+				},
+			},
+
+			ExistenceCheck: b.handleRateLimitQuotaExistenceCheck(),
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.handleRateLimitQuotaUpdate(),
+					Summary:  "Create a rate limit quota.",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleRateLimitQuotaUpdate(),
+					Summary:  "Update a rate limit quota.",
+				},
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleRateLimitQuotaRead(),
+					Summary:  "Read a rate limit quota.",
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.handleRateLimitQuotaDelete(),
+					Summary:  "Delete a rate limit quota.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysQuotasHelp["rate-limit"][0]),
+			HelpDescription: strings.TrimSpace(sysQuotasHelp["rate-limit"][1]),
+		},
+		{
+			Pattern: "quotas/lease-count/?$",
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCountQuotasList(),
+					Summary:  "List the names of the lease count quotas.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysQuotasHelp["lease-count-list"][0]),
+			HelpDescription: strings.TrimSpace(sysQuotasHelp["lease-count-list"][1]),
+		},
+		{
+			Pattern: "quotas/lease-count/" + framework.GenericNameRegex("name"),
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the quota.",
+				},
+				"path": {
+					Type:        framework.TypeString,
+					Description: "Mount path, such as 'aws/' or 'auth/approle/', the quota applies to. An empty path applies the quota to all the leases.",
+				},
+				"max_leases": {
+					Type:        framework.TypeInt,
+					Description: "Maximum number of leases that can be held under the path. Must be positive.",
+				},
+			},
+
+			ExistenceCheck: b.handleLeaseCountQuotaExistenceCheck(),
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCountQuotaUpdate(),
+					Summary:  "Create a lease count quota.",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCountQuotaUpdate(),
+					Summary:  "Update a lease count quota.",
+				},
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCountQuotaRead(),
+					Summary:  "Read a lease count quota.",
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCountQuotaDelete(),
+					Summary:  "Delete a lease count quota.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysQuotasHelp["lease-count"][0]),
+			HelpDescription: strings.TrimSpace(sysQuotasHelp["lease-count"][1]),
+		},
+	}
+}
+
+func (b *SystemBackend) handleQuotasConfigRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		config := b.Core.quotaManager.Config()
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"rate_limit_exempt_paths": config.RateLimitExemptPaths,
+			},
+		}, nil
+	}
+}
+
+func (b *SystemBackend) handleQuotasConfigUpdate() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		config := b.Core.quotaManager.Config()
+		if exemptRaw, ok := d.GetOk("rate_limit_exempt_paths"); ok {
+			config.RateLimitExemptPaths = exemptRaw.([]string)
+		}
+
+		if err := b.Core.quotaManager.SetConfig(ctx, config); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *SystemBackend) handleRateLimitQuotasList() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		names, err := b.Core.quotaManager.QuotaNames(quotas.TypeRateLimit)
+		if err != nil {
+			return nil, err
+		}
+		return logical.ListResponse(names), nil
+	}
+}
+
+func (b *SystemBackend) handleRateLimitQuotaExistenceCheck() framework.ExistenceFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+		return b.Core.quotaManager.QuotaByName(quotas.TypeRateLimit, d.Get("name").(string)) != nil, nil
+	}
+}
+
+func (b *SystemBackend) handleRateLimitQuotaUpdate() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+
+		ns, err := namespace.FromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var path string
+		var rateLimit float64
+		var burst int
+		var perClientIP bool
+		if existing, ok := b.Core.quotaManager.QuotaByName(quotas.TypeRateLimit, name).(*quotas.RateLimitQuota); ok {
+			path, rateLimit, burst, perClientIP = ns.TrimmedPath(existing.Path), existing.Rate, existing.Burst, existing.PerClientIP
+		} else if req.Operation == logical.UpdateOperation {
+			return logical.ErrorResponse("quota %q does not exist", name), logical.ErrInvalidRequest
+		}
+
+		if pathRaw, ok := d.GetOk("path"); ok {
+			path = quotas.NormalizePath(pathRaw.(string))
+		}
+		if rateRaw, ok := d.GetOk("rate"); ok {
+			rateLimit = rateRaw.(float64)
+		}
+		if burstRaw, ok := d.GetOk("burst"); ok {
+			burst = burstRaw.(int)
+		}
+		if perClientIPRaw, ok := d.GetOk("per_client_ip"); ok {
+			perClientIP = perClientIPRaw.(bool)
+		}
+
+		if !b.validQuotaPath(ctx, path) {
+			return logical.ErrorResponse("no mount exists at path %q", path), logical.ErrInvalidRequest
+		}
+
+		quota, err := quotas.NewRateLimitQuota(name, ns.Path+path, rateLimit, burst, perClientIP)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+
+		return b.setQuota(ctx, quota)
+	}
+}
+
+func (b *SystemBackend) handleRateLimitQuotaRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		quota, ok := b.Core.quotaManager.QuotaByName(quotas.TypeRateLimit, d.Get("name").(string)).(*quotas.RateLimitQuota)
+		if !ok {
+			return nil, nil
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"name":          quota.Name,
+				"type":          string(quotas.TypeRateLimit),
+				"path":          quota.Path,
+				"rate":          quota.Rate,
+				"burst":         quota.Burst,
+				"per_client_ip": quota.PerClientIP,
+			},
+		}, nil
+	}
+}
+
+func (b *SystemBackend) handleRateLimitQuotaDelete() framework.OperationFunc {
+	return b.handleQuotaDelete(quotas.TypeRateLimit)
+}
+
+func (b *SystemBackend) handleLeaseCountQuotasList() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		names, err := b.Core.quotaManager.QuotaNames(quotas.TypeLeaseCount)
+		if err != nil {
+			return nil, err
+		}
+		return logical.ListResponse(names), nil
+	}
+}
+
+func (b *SystemBackend) handleLeaseCountQuotaExistenceCheck() framework.ExistenceFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+		return b.Core.quotaManager.QuotaByName(quotas.TypeLeaseCount, d.Get("name").(string)) != nil, nil
+	}
+}
+
+func (b *SystemBackend) handleLeaseCountQuotaUpdate() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+
+		ns, err := namespace.FromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var path string
+		var maxLeases int
+		if existing, ok := b.Core.quotaManager.QuotaByName(quotas.TypeLeaseCount, name).(*quotas.LeaseCountQuota); ok {
+			path, maxLeases = ns.TrimmedPath(existing.Path), existing.MaxLeases
+		} else if req.Operation == logical.UpdateOperation {
+			return logical.ErrorResponse("quota %q does not exist", name), logical.ErrInvalidRequest
+		}
+
+		if pathRaw, ok := d.GetOk("path"); ok {
+			path = quotas.NormalizePath(pathRaw.(string))
+		}
+		if maxLeasesRaw, ok := d.GetOk("max_leases"); ok {
+			maxLeases = maxLeasesRaw.(int)
+		}
+
+		if !b.validQuotaPath(ctx, path) {
+			return logical.ErrorResponse("no mount exists at path %q", path), logical.ErrInvalidRequest
+		}
+
+		quota, err := quotas.NewLeaseCountQuota(name, ns.Path+path, maxLeases)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+
+		return b.setQuota(ctx, quota)
+	}
+}
+
+func (b *SystemBackend) handleLeaseCountQuotaRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		quota, ok := b.Core.quotaManager.QuotaByName(quotas.TypeLeaseCount, d.Get("name").(string)).(*quotas.LeaseCountQuota)
+		if !ok {
+			return nil, nil
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"name":        quota.Name,
+				"type":        string(quotas.TypeLeaseCount),
+				"path":        quota.Path,
+				"max_leases":  quota.MaxLeases,
+				"lease_count": b.Core.expiration.LeaseCount(quota.Path),
+			},
+		}, nil
+	}
+}
+
+func (b *SystemBackend) handleLeaseCountQuotaDelete() framework.OperationFunc {
+	return b.handleQuotaDelete(quotas.TypeLeaseCount)
+}
+
+func (b *SystemBackend) handleQuotaDelete(qType quotas.Type) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		err := b.Core.quotaManager.DeleteQuota(ctx, qType, d.Get("name").(string))
+		if err != nil && err != quotas.ErrQuotaNotFound {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+// validQuotaPath checks that a normalized quota path, relative to the request
+// namespace, is either empty or the path of a mount.
+func (b *SystemBackend) validQuotaPath(ctx context.Context, path string) bool {
+	if path == "" {
+		return true
+	}
+
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return false
+	}
+	return b.Core.router.MatchingMount(ctx, path) == ns.Path+path
+}
+
+func (b *SystemBackend) setQuota(ctx context.Context, quota quotas.Quota) (*logical.Response, error) {
+	if err := b.Core.quotaManager.SetQuota(ctx, quota); err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+var sysQuotasHelp = map[string][2]string{
+	"quotas-config": {
+		"Configures the quota subsystem.",
+		`
+This path manages settings shared by all quotas, such as the request paths that
+are exempt from rate limiting.
+		`,
+	},
+	"rate-limit-list": {
+		"Lists the rate limit quotas.",
+		"",
+	},
+	"rate-limit": {
+		"Manages rate limit quotas.",
+		`
+A rate limit quota throttles the requests made against a mount with a token
+bucket: up to 'burst' requests are allowed at once, refilled at 'rate' requests
+per second. A quota with an empty path applies to every request without a more
+specific quota. Rejected requests receive a 429 status code and a Retry-After
+header.
+		`,
+	},
+	"lease-count-list": {
+		"Lists the lease count quotas.",
+		"",
+	},
+	"lease-count": {
+		"Manages lease count quotas.",
+		`
+A lease count quota caps the number of leases that can be held under a mount.
+Registering a lease beyond 'max_leases' fails and the newly created secret or
+token is revoked. A quota with an empty path counts every lease and applies to
+all mounts without a more specific quota. Existing leases are never revoked
+because of a quota.
+		`,
+	},
+}
@@ -99,6 +99,19 @@ func (b *SystemBackend) raftStoragePaths() []*framework.Path {
 			HelpSynopsis:    strings.TrimSpace(sysRaftHelp["raft-configuration"][0]),
 			HelpDescription: strings.TrimSpace(sysRaftHelp["raft-configuration"][1]),
 		},
+		{
+			Pattern: "storage/raft/autopilot/state",
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleRaftAutopilotStateGet(),
+					Summary:  "Returns the state of the raft cluster as seen by autopilot.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysRaftHelp["raft-autopilot-state"][0]),
+			HelpDescription: strings.TrimSpace(sysRaftHelp["raft-autopilot-state"][1]),
+		},
 		{
 			Pattern: "storage/raft/snapshot",
 			Operations: map[logical.Operation]framework.OperationHandler{
@@ -115,6 +128,19 @@ func (b *SystemBackend) raftStoragePaths() []*framework.Path {
 			HelpSynopsis:    strings.TrimSpace(sysRaftHelp["raft-snapshot"][0]),
 			HelpDescription: strings.TrimSpace(sysRaftHelp["raft-snapshot"][1]),
 		},
+		{
+			Pattern: "storage/raft/snapshot-auto/status",
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleStorageRaftSnapshotAutoStatusRead(),
+					Summary:  "Returns the status of the automated snapshots.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysRaftHelp["raft-snapshot-auto-status"][0]),
+			HelpDescription: strings.TrimSpace(sysRaftHelp["raft-snapshot-auto-status"][1]),
+		},
 		{
 			Pattern: "storage/raft/snapshot-force",
 			Operations: map[logical.Operation]framework.OperationHandler{
@@ -151,6 +177,30 @@ func (b *SystemBackend) handleRaftConfigurationGet() framework.OperationFunc {
 	}
 }
 
+func (b *SystemBackend) handleRaftAutopilotStateGet() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		raftStorage, ok := b.Core.underlyingPhysical.(*raft.RaftBackend)
+		if !ok {
+			return logical.ErrorResponse("raft storage is not in use"), logical.ErrInvalidRequest
+		}
+
+		state, err := raftStorage.AutopilotState()
+		if err != nil {
+			return nil, err
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"healthy":           state.Healthy,
+				"failure_tolerance": state.FailureTolerance,
+				"leader":            state.Leader,
+				"voters":            state.Voters,
+				"servers":           state.Servers,
+			},
+		}, nil
+	}
+}
+
 func (b *SystemBackend) handleRaftRemovePeerUpdate() framework.OperationFunc {
 	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 		serverID := d.Get("server_id").(string)
@@ -167,7 +217,7 @@ func (b *SystemBackend) handleRaftRemovePeerUpdate() framework.OperationFunc {
 			return nil, err
 		}
 		if b.Core.raftFollowerStates != nil {
-			b.Core.raftFollowerStates.delete(serverID)
+			b.Core.raftFollowerStates.Delete(serverID)
 		}
 
 		return nil, nil
@@ -277,7 +327,7 @@ func (b *SystemBackend) handleRaftBootstrapAnswerWrite() framework.OperationFunc
 		}
 
 		if b.Core.raftFollowerStates != nil {
-			b.Core.raftFollowerStates.update(serverID, 0)
+			b.Core.raftFollowerStates.Update(serverID, 0)
 		}
 
 		peers, err := raftStorage.Peers(ctx)
@@ -313,6 +363,37 @@ func (b *SystemBackend) handleStorageRaftSnapshotRead() framework.OperationFunc
 	}
 }
 
+func (b *SystemBackend) handleStorageRaftSnapshotAutoStatusRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		raftStorage, ok := b.Core.underlyingPhysical.(*raft.RaftBackend)
+		if !ok {
+			return logical.ErrorResponse("raft storage is not in use"), logical.ErrInvalidRequest
+		}
+
+		status := raftStorage.AutoSnapshotStatus()
+		data := map[string]interface{}{
+			"enabled":              status.Enabled,
+			"running":              status.Running,
+			"interval":             status.Interval,
+			"retain":               status.Retain,
+			"destination":          status.Destination,
+			"last_snapshot":        status.LastSnapshot,
+			"last_error":           status.LastError,
+			"consecutive_failures": status.ConsecutiveFailures,
+		}
+		if !status.LastSuccess.IsZero() {
+			data["last_success"] = status.LastSuccess
+		}
+		if !status.LastFailure.IsZero() {
+			data["last_failure"] = status.LastFailure
+		}
+
+		return &logical.Response{
+			Data: data,
+		}, nil
+	}
+}
+
 func (b *SystemBackend) handleStorageRaftSnapshotWrite(force bool) framework.OperationFunc {
 	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 		raftStorage, ok := b.Core.underlyingPhysical.(*raft.RaftBackend)
@@ -440,6 +521,16 @@ var sysRaftHelp = map[string][2]string{
 		"Returns the raft cluster configuration.",
 		"",
 	},
+	"raft-autopilot-state": {
+		"Returns the state of the raft cluster as seen by autopilot.",
+		`
+Autopilot tracks the health of the raft servers from the heartbeats they send
+to the active node, promotes new servers to voters once they have been healthy
+for the stabilization time, and removes dead servers when configured to do so.
+This endpoint returns the health of each server and the failure tolerance of
+the cluster.
+		`,
+	},
 	"raft-remove-peer": {
 		"Removes a peer from the raft cluster.",
 		"",
@@ -448,6 +539,15 @@ var sysRaftHelp = map[string][2]string{
 		"Restores and saves snapshots from the raft cluster.",
 		"",
 	},
+	"raft-snapshot-auto-status": {
+		"Returns the status of the automated snapshots.",
+		`
+When an automated snapshot interval is set in the raft storage configuration,
+the active node writes snapshots to the configured destination on that
+interval and keeps the most recent ones. This endpoint returns the outcome of
+the last snapshot attempts.
+		`,
+	},
 	"raft-snapshot-force": {
 		"Force restore a raft cluster snapshot",
 		"",
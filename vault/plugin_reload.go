@@ -189,7 +189,8 @@ func (c *Core) reloadBackendCommon(ctx context.Context, entry *MountEntry, isAut
 		paths := backend.SpecialPaths()
 		if paths != nil {
 			re.rootPaths.Store(pathsToRadix(paths.Root))
-			re.loginPaths.Store(pathsToRadix(paths.Unauthenticated))
+			re.loginPaths.Store(parseUnauthenticatedPaths(paths.Unauthenticated))
+			re.allowedResponseHeaders.Store(paths.AllowedResponseHeaders)
 		}
 	}
 
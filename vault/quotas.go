@@ -0,0 +1,48 @@
+package vault
+
+import (
+	"context"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/vault/quotas"
+)
+
+const (
+	// quotaSubPath is the sub-path used for the quota store view. This is
+	// nested under the system view.
+	quotaSubPath = "quotas/"
+)
+
+// setupQuotas loads the quotas into the quota manager. This should only be
+// called with the core state lock held for writing.
+func (c *Core) setupQuotas(ctx context.Context) error {
+	if err := c.quotaManager.Setup(ctx, c.systemBarrierView.SubView(quotaSubPath)); err != nil {
+		return errwrap.Wrapf("failed to set up quotas: {{err}}", err)
+	}
+	return nil
+}
+
+// teardownQuotas releases the quotas held by the quota manager.
+func (c *Core) teardownQuotas() error {
+	return c.quotaManager.Reset()
+}
+
+// ApplyRateLimitQuota checks the request against the rate limit quotas. The
+// request's path must be relative to the namespace in the context. Requests
+// are always allowed while Vault is sealed or on nodes that have not loaded
+// the quotas.
+func (c *Core) ApplyRateLimitQuota(ctx context.Context, req *quotas.Request) (*quotas.Response, error) {
+	req.Type = quotas.TypeRateLimit
+
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req.NamespacePath = ns.Path
+	if req.MountPath == "" && c.router != nil {
+		req.MountPath = c.router.MatchingMount(ctx, req.Path)
+	}
+
+	return c.quotaManager.ApplyQuota(req)
+}
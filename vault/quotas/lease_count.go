@@ -0,0 +1,82 @@
+package quotas
+
+import (
+	"errors"
+	"fmt"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/helper/metricsutil"
+)
+
+// LeaseCountQuota caps the number of leases that can be held under a mount or
+// namespace path, or globally. It is applied when leases are registered, so
+// existing leases are never revoked because of it.
+type LeaseCountQuota struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	MaxLeases int    `json:"max_leases"`
+}
+
+// NewLeaseCountQuota creates a lease count quota.
+func NewLeaseCountQuota(name, path string, maxLeases int) (*LeaseCountQuota, error) {
+	if name == "" {
+		return nil, errors.New("missing quota name")
+	}
+	if maxLeases <= 0 {
+		return nil, errors.New("max_leases must be positive")
+	}
+
+	return &LeaseCountQuota{
+		Name:      name,
+		Path:      NormalizePath(path),
+		MaxLeases: maxLeases,
+	}, nil
+}
+
+// QuotaName returns the name of the quota
+func (q *LeaseCountQuota) QuotaName() string {
+	return q.Name
+}
+
+// QuotaType returns TypeLeaseCount
+func (q *LeaseCountQuota) QuotaType() Type {
+	return TypeLeaseCount
+}
+
+// QuotaPath returns the path the quota applies to
+func (q *LeaseCountQuota) QuotaPath() string {
+	return q.Path
+}
+
+func (q *LeaseCountQuota) initialize(log.Logger) error {
+	if q.MaxLeases <= 0 {
+		return fmt.Errorf("invalid lease count quota %q: max_leases must be positive", q.Name)
+	}
+	return nil
+}
+
+func (q *LeaseCountQuota) allow(req *Request) (*Response, error) {
+	if req.LeaseCount == nil {
+		return nil, fmt.Errorf("lease count quota %q cannot be applied without lease counts", q.Name)
+	}
+
+	count := req.LeaseCount(q.Path)
+	if count < q.MaxLeases {
+		return &Response{Allowed: true}, nil
+	}
+
+	metricsutil.IncrQuotaViolation("lease_count", q.Name, q.Path, req.NamespacePath)
+
+	path := q.Path
+	if path == "" {
+		path = "all mounts"
+	}
+	return &Response{
+		Allowed: false,
+		Message: fmt.Sprintf("%s already holds %d leases and quota %q allows at most %d", path, count, q.Name, q.MaxLeases),
+	}, nil
+}
+
+func (q *LeaseCountQuota) close() error {
+	return nil
+}
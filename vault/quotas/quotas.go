@@ -0,0 +1,433 @@
+package quotas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/pathmanager"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Type represents the kind of a quota.
+type Type string
+
+const (
+	// TypeRateLimit represents the rate limiting quota type
+	TypeRateLimit Type = "rate-limit"
+
+	// TypeLeaseCount represents the lease count limiting quota type
+	TypeLeaseCount Type = "lease-count"
+)
+
+const (
+	// configKey is the storage key holding the quota configuration
+	configKey = "config"
+)
+
+var (
+	// ErrRateLimitQuotaExceeded is returned when a request is rejected by a
+	// rate limit quota.
+	ErrRateLimitQuotaExceeded = errors.New("rate limit quota exceeded")
+
+	// ErrLeaseCountQuotaExceeded is returned when a lease cannot be
+	// registered because of a lease count quota.
+	ErrLeaseCountQuotaExceeded = errors.New("lease count quota exceeded")
+
+	// ErrQuotaNotFound is returned when a quota being modified does not exist.
+	ErrQuotaNotFound = errors.New("quota not found")
+
+	// DefaultRateLimitExemptPaths are the paths that are never subject to rate
+	// limit quotas unless the configuration says otherwise. These are needed
+	// to operate and monitor Vault even when clients are being throttled.
+	DefaultRateLimitExemptPaths = []string{
+		"sys/generate-recovery-token/attempt",
+		"sys/generate-recovery-token/update",
+		"sys/generate-root/attempt",
+		"sys/generate-root/update",
+		"sys/health",
+		"sys/seal-status",
+		"sys/unseal",
+	}
+)
+
+// Quota is the interface implemented by every quota type.
+type Quota interface {
+	// QuotaName is the name of the quota
+	QuotaName() string
+
+	// QuotaType is the type of the quota
+	QuotaType() Type
+
+	// QuotaPath is the namespace or mount path the quota applies to; an empty
+	// path applies the quota globally
+	QuotaPath() string
+
+	// initialize sets up the runtime state of the quota
+	initialize(log.Logger) error
+
+	// allow checks whether the given request is permitted by the quota
+	allow(*Request) (*Response, error)
+
+	// close releases the runtime state of the quota
+	close() error
+}
+
+// Request contains the information needed to apply quotas to a request.
+type Request struct {
+	// Type is the type of quota to apply
+	Type Type
+
+	// Path is the request path relative to its namespace
+	Path string
+
+	// NamespacePath is the path of the namespace the request is made in
+	NamespacePath string
+
+	// MountPath is the path of the mount the request is routed to, including
+	// the namespace path
+	MountPath string
+
+	// ClientAddress is the IP address of the client
+	ClientAddress string
+
+	// LeaseCount returns the number of leases currently held under the given
+	// quota path. It is required to apply lease count quotas.
+	LeaseCount func(path string) int
+}
+
+// Response is the result of applying quotas to a request.
+type Response struct {
+	// Allowed is false if the request was rejected by a quota
+	Allowed bool
+
+	// RetryAfter is the duration after which the client may retry a
+	// rejected request
+	RetryAfter time.Duration
+
+	// Message explains why the request was rejected, in addition to the error
+	// of the quota type
+	Message string
+}
+
+// Config holds the settings shared by all quotas.
+type Config struct {
+	// RateLimitExemptPaths are the request paths never subject to rate limit
+	// quotas
+	RateLimitExemptPaths []string `json:"rate_limit_exempt_paths"`
+}
+
+// Manager holds the quotas configured in Vault and applies them to requests.
+type Manager struct {
+	logger  log.Logger
+	storage logical.Storage
+
+	// quotas holds the quotas indexed by type and then name
+	quotas map[Type]map[string]Quota
+
+	config            *Config
+	rateLimitExempted *pathmanager.PathManager
+
+	lock sync.RWMutex
+}
+
+// NewManager creates a quota manager. The manager applies no quotas until
+// Setup is called.
+func NewManager(logger log.Logger) *Manager {
+	m := &Manager{
+		logger: logger,
+	}
+	m.resetLocked()
+	return m
+}
+
+// Setup loads the quota configuration and quotas from the given storage. All
+// changes made through the manager afterwards are persisted to it.
+func (m *Manager) Setup(ctx context.Context, storage logical.Storage) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.closeQuotasLocked()
+	m.resetLocked()
+	m.storage = storage
+
+	entry, err := storage.Get(ctx, configKey)
+	if err != nil {
+		return errwrap.Wrapf("failed to read quota config: {{err}}", err)
+	}
+	if entry != nil {
+		config := new(Config)
+		if err := entry.DecodeJSON(config); err != nil {
+			return errwrap.Wrapf("failed to decode quota config: {{err}}", err)
+		}
+		m.setConfigLocked(config)
+	}
+
+	for _, qType := range []Type{TypeRateLimit, TypeLeaseCount} {
+		names, err := storage.List(ctx, string(qType)+"/")
+		if err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("failed to list %s quotas: {{err}}", qType), err)
+		}
+		for _, name := range names {
+			entry, err := storage.Get(ctx, string(qType)+"/"+name)
+			if err != nil {
+				return errwrap.Wrapf(fmt.Sprintf("failed to read %s quota %q: {{err}}", qType, name), err)
+			}
+			if entry == nil {
+				continue
+			}
+
+			quota, err := newQuota(qType)
+			if err != nil {
+				return err
+			}
+			if err := entry.DecodeJSON(quota); err != nil {
+				return errwrap.Wrapf(fmt.Sprintf("failed to decode %s quota %q: {{err}}", qType, name), err)
+			}
+			if err := quota.initialize(m.logger); err != nil {
+				return err
+			}
+			m.quotas[qType][quota.QuotaName()] = quota
+		}
+	}
+
+	return nil
+}
+
+// Reset tears down all the quotas and detaches the manager from its storage.
+// It is called when Vault seals.
+func (m *Manager) Reset() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	err := m.closeQuotasLocked()
+	m.resetLocked()
+	return err
+}
+
+func (m *Manager) resetLocked() {
+	m.storage = nil
+	m.quotas = map[Type]map[string]Quota{
+		TypeRateLimit:  make(map[string]Quota),
+		TypeLeaseCount: make(map[string]Quota),
+	}
+	m.setConfigLocked(&Config{
+		RateLimitExemptPaths: DefaultRateLimitExemptPaths,
+	})
+}
+
+func (m *Manager) closeQuotasLocked() error {
+	var retErr error
+	for _, quotas := range m.quotas {
+		for _, quota := range quotas {
+			if err := quota.close(); err != nil && retErr == nil {
+				retErr = err
+			}
+		}
+	}
+	return retErr
+}
+
+func (m *Manager) setConfigLocked(config *Config) {
+	m.config = config
+	m.rateLimitExempted = pathmanager.New()
+	m.rateLimitExempted.AddPaths(config.RateLimitExemptPaths)
+}
+
+// Config returns a copy of the quota configuration.
+func (m *Manager) Config() *Config {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return &Config{
+		RateLimitExemptPaths: append([]string{}, m.config.RateLimitExemptPaths...),
+	}
+}
+
+// SetConfig updates and persists the quota configuration.
+func (m *Manager) SetConfig(ctx context.Context, config *Config) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.storage == nil {
+		return errors.New("quota manager is not set up")
+	}
+
+	entry, err := logical.StorageEntryJSON(configKey, config)
+	if err != nil {
+		return err
+	}
+	if err := m.storage.Put(ctx, entry); err != nil {
+		return errwrap.Wrapf("failed to persist quota config: {{err}}", err)
+	}
+
+	m.setConfigLocked(config)
+	return nil
+}
+
+// QuotaNames returns the sorted names of all the quotas of the given type.
+func (m *Manager) QuotaNames(qType Type) ([]string, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	quotas, ok := m.quotas[qType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported quota type %q", qType)
+	}
+
+	names := make([]string, 0, len(quotas))
+	for name := range quotas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// QuotaByName returns the quota of the given type and name, or nil if there
+// is none.
+func (m *Manager) QuotaByName(qType Type, name string) Quota {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.quotas[qType][name]
+}
+
+// SetQuota creates or replaces a quota and persists it. Replacing a quota
+// resets its runtime state.
+func (m *Manager) SetQuota(ctx context.Context, quota Quota) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.storage == nil {
+		return errors.New("quota manager is not set up")
+	}
+
+	quotas, ok := m.quotas[quota.QuotaType()]
+	if !ok {
+		return fmt.Errorf("unsupported quota type %q", quota.QuotaType())
+	}
+	for name, existing := range quotas {
+		if name != quota.QuotaName() && existing.QuotaPath() == quota.QuotaPath() {
+			return errutil.UserError{Err: fmt.Sprintf("quota %q already applies to path %q", name, quota.QuotaPath())}
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(string(quota.QuotaType())+"/"+quota.QuotaName(), quota)
+	if err != nil {
+		return err
+	}
+	if err := m.storage.Put(ctx, entry); err != nil {
+		return errwrap.Wrapf("failed to persist quota: {{err}}", err)
+	}
+
+	if err := quota.initialize(m.logger); err != nil {
+		return err
+	}
+	if existing, ok := quotas[quota.QuotaName()]; ok {
+		if err := existing.close(); err != nil {
+			m.logger.Warn("failed to close replaced quota", "name", quota.QuotaName(), "error", err)
+		}
+	}
+	quotas[quota.QuotaName()] = quota
+
+	return nil
+}
+
+// DeleteQuota removes a quota from the manager and from storage.
+func (m *Manager) DeleteQuota(ctx context.Context, qType Type, name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.storage == nil {
+		return errors.New("quota manager is not set up")
+	}
+
+	quotas, ok := m.quotas[qType]
+	if !ok {
+		return fmt.Errorf("unsupported quota type %q", qType)
+	}
+	quota, ok := quotas[name]
+	if !ok {
+		return ErrQuotaNotFound
+	}
+
+	if err := m.storage.Delete(ctx, string(qType)+"/"+name); err != nil {
+		return errwrap.Wrapf("failed to delete quota: {{err}}", err)
+	}
+
+	delete(quotas, name)
+	return quota.close()
+}
+
+// ApplyQuota applies the most specific matching quota of the request's type.
+// A quota on the request's mount takes precedence over a quota on its
+// namespace, which in turn takes precedence over a global quota. Requests
+// with no matching quota are allowed.
+func (m *Manager) ApplyQuota(req *Request) (*Response, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if req.Type == TypeRateLimit && m.rateLimitExempted.HasPath(strings.TrimPrefix(req.Path, "/")) {
+		return &Response{Allowed: true}, nil
+	}
+
+	quota := m.matchingQuotaLocked(req)
+	if quota == nil {
+		return &Response{Allowed: true}, nil
+	}
+
+	return quota.allow(req)
+}
+
+func (m *Manager) matchingQuotaLocked(req *Request) Quota {
+	quotas := m.quotas[req.Type]
+	if len(quotas) == 0 {
+		return nil
+	}
+
+	var nsQuota, globalQuota Quota
+	for _, quota := range quotas {
+		switch quota.QuotaPath() {
+		case "":
+			globalQuota = quota
+		case req.MountPath:
+			return quota
+		case req.NamespacePath:
+			nsQuota = quota
+		}
+	}
+
+	if nsQuota != nil {
+		return nsQuota
+	}
+	return globalQuota
+}
+
+// NormalizePath cleans a quota path so that it matches the mount and
+// namespace paths used when applying quotas.
+func NormalizePath(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return ""
+	}
+	return path.Clean(p) + "/"
+}
+
+func newQuota(qType Type) (Quota, error) {
+	switch qType {
+	case TypeRateLimit:
+		return new(RateLimitQuota), nil
+	case TypeLeaseCount:
+		return new(LeaseCountQuota), nil
+	default:
+		return nil, fmt.Errorf("unsupported quota type %q", qType)
+	}
+}
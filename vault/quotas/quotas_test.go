@@ -0,0 +1,273 @@
+package quotas
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/logging"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func testManager(t *testing.T) (*Manager, logical.Storage) {
+	t.Helper()
+
+	m := NewManager(logging.NewVaultLogger(0))
+	storage := &logical.InmemStorage{}
+	if err := m.Setup(context.Background(), storage); err != nil {
+		t.Fatal(err)
+	}
+	return m, storage
+}
+
+func testRateLimitQuota(t *testing.T, name, path string, rateLimit float64, burst int, perClientIP bool) *RateLimitQuota {
+	t.Helper()
+
+	q, err := NewRateLimitQuota(name, path, rateLimit, burst, perClientIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestRateLimitQuota_Allow(t *testing.T) {
+	now := time.Now()
+	q := testRateLimitQuota(t, "test", "", 1, 2, false)
+	q.now = func() time.Time { return now }
+	if err := q.initialize(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &Request{Type: TypeRateLimit, Path: "secret/foo"}
+	for i := 0; i < 2; i++ {
+		resp, err := q.allow(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !resp.Allowed {
+			t.Fatalf("request %d should be allowed within burst", i)
+		}
+	}
+
+	resp, err := q.allow(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Allowed {
+		t.Fatal("expected request beyond burst to be rejected")
+	}
+	if resp.RetryAfter <= 0 || resp.RetryAfter > time.Second {
+		t.Fatalf("bad retry after: %s", resp.RetryAfter)
+	}
+
+	// A rejected request must not consume a token
+	now = now.Add(time.Second)
+	resp, err = q.allow(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Allowed {
+		t.Fatal("expected request to be allowed after refill")
+	}
+}
+
+func TestRateLimitQuota_PerClientIP(t *testing.T) {
+	now := time.Now()
+	q := testRateLimitQuota(t, "test", "", 1, 1, true)
+	q.now = func() time.Time { return now }
+	if err := q.initialize(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, addr := range []string{"10.0.0.1", "10.0.0.2"} {
+		resp, err := q.allow(&Request{Type: TypeRateLimit, ClientAddress: addr})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !resp.Allowed {
+			t.Fatalf("expected first request from %s to be allowed", addr)
+		}
+	}
+
+	resp, err := q.allow(&Request{Type: TypeRateLimit, ClientAddress: "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Allowed {
+		t.Fatal("expected second request from the same client to be rejected")
+	}
+
+	// Idle clients are purged
+	now = now.Add(clientLimiterMinIdle + clientLimiterPurgeInterval)
+	if _, err := q.allow(&Request{Type: TypeRateLimit, ClientAddress: "10.0.0.3"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(q.clientLimiters) != 1 {
+		t.Fatalf("expected idle client limiters to be purged, have %d", len(q.clientLimiters))
+	}
+}
+
+func TestManager_ApplyQuota(t *testing.T) {
+	ctx := context.Background()
+	m, storage := testManager(t)
+
+	for _, q := range []*RateLimitQuota{
+		testRateLimitQuota(t, "global", "", 1000, 1000, false),
+		testRateLimitQuota(t, "secret", "secret", 1, 1, false),
+	} {
+		if err := m.SetQuota(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.SetQuota(ctx, testRateLimitQuota(t, "dup", "secret/", 1, 1, false)); err == nil {
+		t.Fatal("expected error setting a second quota on the same path")
+	}
+
+	apply := func(path, mount string) bool {
+		t.Helper()
+		resp, err := m.ApplyQuota(&Request{Type: TypeRateLimit, Path: path, MountPath: mount})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Allowed
+	}
+
+	if !apply("secret/foo", "secret/") {
+		t.Fatal("expected first request to be allowed")
+	}
+	if apply("secret/foo", "secret/") {
+		t.Fatal("expected mount quota to reject the second request")
+	}
+	if !apply("kv/foo", "kv/") {
+		t.Fatal("expected global quota to allow requests on other mounts")
+	}
+	for i := 0; i < 5; i++ {
+		if !apply("sys/health", "sys/") {
+			t.Fatal("expected exempt path to be allowed")
+		}
+	}
+
+	// Quotas survive a reload from storage
+	m2 := NewManager(logging.NewVaultLogger(0))
+	if err := m2.Setup(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	names, err := m2.QuotaNames(TypeRateLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "global" || names[1] != "secret" {
+		t.Fatalf("bad quota names after reload: %v", names)
+	}
+	q := m2.QuotaByName(TypeRateLimit, "secret").(*RateLimitQuota)
+	if q.Path != "secret/" || q.Rate != 1 || q.Burst != 1 {
+		t.Fatalf("bad reloaded quota: %#v", q)
+	}
+
+	if err := m2.DeleteQuota(ctx, TypeRateLimit, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m2.DeleteQuota(ctx, TypeRateLimit, "secret"); err != ErrQuotaNotFound {
+		t.Fatalf("expected ErrQuotaNotFound, got %v", err)
+	}
+
+	if err := m2.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := m2.ApplyQuota(&Request{Type: TypeRateLimit, Path: "kv/foo", MountPath: "kv/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Allowed {
+		t.Fatal("expected reset manager to allow requests")
+	}
+}
+
+func TestManager_Config(t *testing.T) {
+	ctx := context.Background()
+	m, storage := testManager(t)
+
+	if err := m.SetQuota(ctx, testRateLimitQuota(t, "global", "", 1, 1, false)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetConfig(ctx, &Config{RateLimitExemptPaths: []string{"kv/*"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	m2 := NewManager(logging.NewVaultLogger(0))
+	if err := m2.Setup(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	config := m2.Config()
+	if len(config.RateLimitExemptPaths) != 1 || config.RateLimitExemptPaths[0] != "kv/*" {
+		t.Fatalf("bad config: %#v", config)
+	}
+
+	for i := 0; i < 3; i++ {
+		resp, err := m2.ApplyQuota(&Request{Type: TypeRateLimit, Path: "kv/foo", MountPath: "kv/"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !resp.Allowed {
+			t.Fatal("expected exempt path to be allowed")
+		}
+	}
+}
+
+func TestLeaseCountQuota(t *testing.T) {
+	ctx := context.Background()
+	m, _ := testManager(t)
+
+	q, err := NewLeaseCountQuota("secret", "secret/", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetQuota(ctx, q); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int{"secret/": 1}
+	req := &Request{
+		Type:      TypeLeaseCount,
+		Path:      "secret/creds/foo",
+		MountPath: "secret/",
+		LeaseCount: func(path string) int {
+			return counts[path]
+		},
+	}
+
+	resp, err := m.ApplyQuota(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Allowed {
+		t.Fatal("expected lease to be allowed below the maximum")
+	}
+
+	counts["secret/"] = 2
+	resp, err = m.ApplyQuota(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Allowed {
+		t.Fatal("expected lease to be rejected at the maximum")
+	}
+	if resp.Message == "" {
+		t.Fatal("expected rejection message")
+	}
+
+	// Lease count quotas do not affect other quota types
+	resp, err = m.ApplyQuota(&Request{Type: TypeRateLimit, Path: "secret/creds/foo", MountPath: "secret/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Allowed {
+		t.Fatal("expected request to be allowed")
+	}
+
+	req.LeaseCount = nil
+	if _, err := m.ApplyQuota(req); err == nil {
+		t.Fatal("expected error applying a lease count quota without counts")
+	}
+}
@@ -0,0 +1,186 @@
+package quotas
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/helper/metricsutil"
+	"golang.org/x/time/rate"
+)
+
+var (
+	// clientLimiterPurgeInterval is how often idle per-client limiters are
+	// looked for. Making this a package var allows tests to modify it.
+	clientLimiterPurgeInterval = time.Minute
+
+	// clientLimiterMinIdle is the minimum time a per-client limiter must be
+	// unused before it is purged.
+	clientLimiterMinIdle = 3 * time.Minute
+)
+
+// RateLimitQuota is a token bucket rate limit applied to the requests made
+// against a mount or namespace path, or globally. When PerClientIP is set,
+// every client address gets its own bucket.
+type RateLimitQuota struct {
+	Name        string  `json:"name"`
+	Path        string  `json:"path"`
+	Rate        float64 `json:"rate"`
+	Burst       int     `json:"burst"`
+	PerClientIP bool    `json:"per_client_ip"`
+
+	logger         log.Logger
+	lock           sync.Mutex
+	limiter        *rate.Limiter
+	clientLimiters map[string]*clientLimiter
+	lastPurge      time.Time
+
+	// now is used in tests to control time
+	now func() time.Time
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimitQuota creates a rate limit quota. A burst of zero defaults to
+// the rate rounded up.
+func NewRateLimitQuota(name, path string, rateLimit float64, burst int, perClientIP bool) (*RateLimitQuota, error) {
+	if name == "" {
+		return nil, errors.New("missing quota name")
+	}
+	if rateLimit <= 0 {
+		return nil, errors.New("rate must be positive")
+	}
+	if burst < 0 {
+		return nil, errors.New("burst must not be negative")
+	}
+	if burst == 0 {
+		burst = int(math.Ceil(rateLimit))
+	}
+
+	return &RateLimitQuota{
+		Name:        name,
+		Path:        NormalizePath(path),
+		Rate:        rateLimit,
+		Burst:       burst,
+		PerClientIP: perClientIP,
+	}, nil
+}
+
+// QuotaName returns the name of the quota
+func (q *RateLimitQuota) QuotaName() string {
+	return q.Name
+}
+
+// QuotaType returns TypeRateLimit
+func (q *RateLimitQuota) QuotaType() Type {
+	return TypeRateLimit
+}
+
+// QuotaPath returns the path the quota applies to
+func (q *RateLimitQuota) QuotaPath() string {
+	return q.Path
+}
+
+func (q *RateLimitQuota) initialize(logger log.Logger) error {
+	if q.Rate <= 0 || q.Burst <= 0 {
+		return fmt.Errorf("invalid rate limit quota %q: rate and burst must be positive", q.Name)
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if logger != nil {
+		q.logger = logger.Named("rate-limit").With("name", q.Name)
+	}
+	if q.now == nil {
+		q.now = time.Now
+	}
+	q.limiter = rate.NewLimiter(rate.Limit(q.Rate), q.Burst)
+	q.clientLimiters = make(map[string]*clientLimiter)
+	q.lastPurge = q.now()
+
+	return nil
+}
+
+func (q *RateLimitQuota) allow(req *Request) (*Response, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.limiter == nil {
+		return nil, fmt.Errorf("rate limit quota %q is not initialized", q.Name)
+	}
+
+	now := q.now()
+	limiter := q.limiter
+	if q.PerClientIP && req.ClientAddress != "" {
+		limiter = q.clientLimiterLocked(req.ClientAddress, now)
+	}
+
+	reservation := limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return nil, fmt.Errorf("rate limit quota %q cannot admit requests", q.Name)
+	}
+	delay := reservation.DelayFrom(now)
+	if delay == 0 {
+		return &Response{Allowed: true}, nil
+	}
+
+	// Give the token back so that rejected requests do not push the
+	// allowance further into the future
+	reservation.CancelAt(now)
+
+	metricsutil.IncrQuotaViolation("rate_limit", q.Name, q.Path, req.NamespacePath)
+	if q.logger != nil && q.logger.IsTrace() {
+		q.logger.Trace("request rejected", "path", req.Path, "client_address", req.ClientAddress, "retry_after", delay)
+	}
+
+	return &Response{
+		Allowed:    false,
+		RetryAfter: delay,
+		Message:    fmt.Sprintf("quota %q allows %g requests per second", q.Name, q.Rate),
+	}, nil
+}
+
+// clientLimiterLocked returns the limiter of the given client, creating it if
+// needed, and purges the limiters of clients that have been idle for long
+// enough that a fresh limiter would be equivalent.
+func (q *RateLimitQuota) clientLimiterLocked(addr string, now time.Time) *rate.Limiter {
+	if now.Sub(q.lastPurge) >= clientLimiterPurgeInterval {
+		idle := clientLimiterMinIdle
+		if refill := time.Duration(float64(q.Burst) / q.Rate * float64(time.Second)); refill > idle {
+			idle = refill
+		}
+		for clientAddr, cl := range q.clientLimiters {
+			if now.Sub(cl.lastSeen) >= idle {
+				delete(q.clientLimiters, clientAddr)
+			}
+		}
+		q.lastPurge = now
+	}
+
+	cl, ok := q.clientLimiters[addr]
+	if !ok {
+		cl = &clientLimiter{
+			limiter: rate.NewLimiter(rate.Limit(q.Rate), q.Burst),
+		}
+		q.clientLimiters[addr] = cl
+	}
+	cl.lastSeen = now
+
+	return cl.limiter
+}
+
+func (q *RateLimitQuota) close() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.limiter = nil
+	q.clientLimiters = nil
+	return nil
+}
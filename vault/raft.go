@@ -6,11 +6,9 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"math"
 	"net/http"
 	"net/url"
 	"strings"
-	"sync"
 	"sync/atomic"
 	"time"
 
@@ -33,49 +31,6 @@ var (
 	raftTLSRotationPeriod = 24 * time.Hour
 )
 
-type raftFollowerStates struct {
-	l         sync.RWMutex
-	followers map[string]uint64
-}
-
-func (s *raftFollowerStates) update(nodeID string, appliedIndex uint64) {
-	s.l.Lock()
-	s.followers[nodeID] = appliedIndex
-	s.l.Unlock()
-}
-func (s *raftFollowerStates) delete(nodeID string) {
-	s.l.RLock()
-	delete(s.followers, nodeID)
-	s.l.RUnlock()
-}
-func (s *raftFollowerStates) get(nodeID string) uint64 {
-	s.l.RLock()
-	index := s.followers[nodeID]
-	s.l.RUnlock()
-	return index
-}
-func (s *raftFollowerStates) minIndex() uint64 {
-	var min uint64 = math.MaxUint64
-	minFunc := func(a, b uint64) uint64 {
-		if a > b {
-			return b
-		}
-		return a
-	}
-
-	s.l.RLock()
-	for _, i := range s.followers {
-		min = minFunc(min, i)
-	}
-	s.l.RUnlock()
-
-	if min == math.MaxUint64 {
-		return 0
-	}
-
-	return min
-}
-
 // startRaftStorage will call SetupCluster in the raft backend which starts raft
 // up and enables the cluster handler.
 func (c *Core) startRaftStorage(ctx context.Context) (retErr error) {
@@ -160,10 +115,27 @@ func (c *Core) startRaftStorage(ctx context.Context) (retErr error) {
 
 func (c *Core) setupRaftActiveNode(ctx context.Context) error {
 	c.pendingRaftPeers = make(map[string][]byte)
-	return c.startPeriodicRaftTLSRotate(ctx)
+	if err := c.startPeriodicRaftTLSRotate(ctx); err != nil {
+		return err
+	}
+
+	if raftStorage, ok := c.underlyingPhysical.(*raft.RaftBackend); ok {
+		raftStorage.StartAutopilot(c.raftFollowerStates)
+
+		// A broken snapshot destination should not prevent the node from
+		// becoming active; the failure is reported in the snapshot status.
+		if err := raftStorage.StartAutoSnapshots(c.seal.GetAccess()); err != nil {
+			c.logger.Error("failed to start automated raft snapshots", "error", err)
+		}
+	}
+	return nil
 }
 
 func (c *Core) stopRaftActiveNode() {
+	if raftStorage, ok := c.underlyingPhysical.(*raft.RaftBackend); ok {
+		raftStorage.StopAutoSnapshots()
+		raftStorage.StopAutopilot()
+	}
 	c.pendingRaftPeers = nil
 	c.stopPeriodicRaftTLSRotate()
 }
@@ -194,9 +166,7 @@ func (c *Core) startPeriodicRaftTLSRotate(ctx context.Context) error {
 	}
 
 	stopCh := make(chan struct{})
-	followerStates := &raftFollowerStates{
-		followers: make(map[string]uint64),
-	}
+	followerStates := raft.NewFollowerStates()
 
 	// Pre-populate the follower list with the set of peers.
 	raftConfig, err := raftStorage.GetConfiguration(ctx)
@@ -205,7 +175,7 @@ func (c *Core) startPeriodicRaftTLSRotate(ctx context.Context) error {
 	}
 	for _, server := range raftConfig.Servers {
 		if server.NodeID != raftStorage.NodeID() {
-			followerStates.update(server.NodeID, 0)
+			followerStates.Update(server.NodeID, 0)
 		}
 	}
 
@@ -316,7 +286,7 @@ func (c *Core) startPeriodicRaftTLSRotate(ctx context.Context) error {
 		case keyring.Keys[1].AppliedIndex != keyring.AppliedIndex:
 			// We haven't fully committed the new key, continue here
 			return nil
-		case followerStates.minIndex() < keyring.AppliedIndex:
+		case followerStates.MinIndex() < keyring.AppliedIndex:
 			// Not all the followers have applied the latest key
 			return nil
 		}
@@ -587,7 +557,7 @@ func (c *Core) JoinRaftCluster(ctx context.Context, leaderAddr string, tlsConfig
 			return err
 		}
 
-		if sealConfig.Type != c.seal.BarrierType() {
+		if !SealAcceptsBarrierType(c.seal, sealConfig.Type) {
 			return fmt.Errorf("mismatching seal types between leader (%s) and follower (%s)", sealConfig.Type, c.seal.BarrierType())
 		}
 
@@ -18,7 +18,7 @@ type forwardedRequestRPCServer struct {
 	handler               http.Handler
 	perfStandbySlots      chan struct{}
 	perfStandbyRepCluster *replication.Cluster
-	raftFollowerStates    *raftFollowerStates
+	raftFollowerStates    *raft.FollowerStates
 }
 
 func (s *forwardedRequestRPCServer) ForwardRequest(ctx context.Context, freq *forwarding.Request) (*forwarding.Response, error) {
@@ -74,7 +74,7 @@ func (s *forwardedRequestRPCServer) Echo(ctx context.Context, in *EchoRequest) (
 	}
 
 	if in.RaftAppliedIndex > 0 && len(in.RaftNodeID) > 0 && s.raftFollowerStates != nil {
-		s.raftFollowerStates.update(in.RaftNodeID, in.RaftAppliedIndex)
+		s.raftFollowerStates.Update(in.RaftNodeID, in.RaftAppliedIndex)
 	}
 
 	reply := &EchoReply{
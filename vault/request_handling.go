@@ -22,6 +22,7 @@ import (
 	"github.com/hashicorp/vault/sdk/helper/strutil"
 	"github.com/hashicorp/vault/sdk/helper/wrapping"
 	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault/quotas"
 	uberAtomic "go.uber.org/atomic"
 )
 
@@ -814,6 +815,9 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 
 			leaseID, err := registerFunc(ctx, req, resp)
 			if err != nil {
+				if errwrap.Contains(err, quotas.ErrLeaseCountQuotaExceeded.Error()) {
+					return logical.ErrorResponse(err.Error()), auth, logical.ErrInvalidRequest
+				}
 				c.logger.Error("failed to register lease", "request_path", req.Path, "error", err)
 				retErr = multierror.Append(retErr, ErrInternalError)
 				return nil, auth, retErr
@@ -883,6 +887,9 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 				if err := c.tokenStore.revokeOrphan(ctx, resp.Auth.ClientToken); err != nil {
 					c.logger.Warn("failed to clean up token lease during auth/token/ request", "request_path", req.Path, "error", err)
 				}
+				if errwrap.Contains(err, quotas.ErrLeaseCountQuotaExceeded.Error()) {
+					return logical.ErrorResponse(err.Error()), auth, logical.ErrInvalidRequest
+				}
 				c.logger.Error("failed to register token lease during auth/token/ request", "request_path", req.Path, "error", err)
 				retErr = multierror.Append(retErr, ErrInternalError)
 				return nil, auth, retErr
@@ -1222,6 +1229,9 @@ func (c *Core) RegisterAuth(ctx context.Context, tokenTTL time.Duration, path st
 			if err := c.tokenStore.revokeOrphan(ctx, te.ID); err != nil {
 				c.logger.Warn("failed to clean up token lease during login request", "request_path", path, "error", err)
 			}
+			if errwrap.Contains(err, quotas.ErrLeaseCountQuotaExceeded.Error()) {
+				return err
+			}
 			c.logger.Error("failed to register token lease during login request", "request_path", path, "error", err)
 			return ErrInternalError
 		}
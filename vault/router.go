@@ -59,6 +59,10 @@ type routeEntry struct {
 	rootPaths     atomic.Value
 	loginPaths    atomic.Value
 	l             sync.RWMutex
+
+	// allowedResponseHeaders are the response headers the backend declared
+	// in its special paths
+	allowedResponseHeaders atomic.Value
 }
 
 type validateMountResponse struct {
@@ -139,7 +143,8 @@ func (r *Router) Mount(backend logical.Backend, prefix string, mountEntry *Mount
 		storageView:   storageView,
 	}
 	re.rootPaths.Store(pathsToRadix(paths.Root))
-	re.loginPaths.Store(pathsToRadix(paths.Unauthenticated))
+	re.loginPaths.Store(parseUnauthenticatedPaths(paths.Unauthenticated))
+	re.allowedResponseHeaders.Store(paths.AllowedResponseHeaders)
 
 	switch {
 	case prefix == "":
@@ -553,6 +558,9 @@ func (r *Router) routeCommon(ctx context.Context, req *logical.Request, existenc
 	switch {
 	case strings.HasPrefix(originalPath, "auth/token/"):
 	case strings.HasPrefix(originalPath, "sys/"):
+	case strings.HasPrefix(originalPath, "identity/oidc/provider/") && strings.HasSuffix(originalPath, "/userinfo"):
+		// The OIDC provider validates the access token presented as a bearer
+		// token to its userinfo endpoint
 	case strings.HasPrefix(originalPath, cubbyholeMountPath):
 		if req.Operation == logical.RollbackOperation {
 			// Backend doesn't support this and it can't properly look up a
@@ -620,6 +628,9 @@ func (r *Router) routeCommon(ctx context.Context, req *logical.Request, existenc
 	if rawVal, ok := re.mountEntry.synthesizedConfigCache.Load("allowed_response_headers"); ok {
 		allowedResponseHeaders = rawVal.([]string)
 	}
+	if backendHeaders, ok := re.allowedResponseHeaders.Load().([]string); ok && len(backendHeaders) > 0 {
+		allowedResponseHeaders = append(append([]string(nil), allowedResponseHeaders...), backendHeaders...)
+	}
 
 	if len(passthroughRequestHeaders) > 0 {
 		req.Headers = filteredHeaders(headers, passthroughRequestHeaders, deniedPassthroughRequestHeaders)
@@ -791,20 +802,85 @@ func (r *Router) LoginPath(ctx context.Context, path string) bool {
 	remain := strings.TrimPrefix(adjustedPath, mount)
 
 	// Check the loginPaths of this backend
-	loginPaths := re.loginPaths.Load().(*radix.Tree)
-	match, raw, ok := loginPaths.LongestPrefix(remain)
-	if !ok {
-		return false
+	loginPaths := re.loginPaths.Load().(*loginPathsEntry)
+	match, raw, ok := loginPaths.paths.LongestPrefix(remain)
+	if ok {
+		prefixMatch := raw.(bool)
+
+		// Handle the prefix match case
+		if prefixMatch && strings.HasPrefix(remain, match) {
+			return true
+		}
+
+		// Handle the exact match case
+		if match == remain {
+			return true
+		}
 	}
-	prefixMatch := raw.(bool)
 
-	// Handle the prefix match case
-	if prefixMatch {
-		return strings.HasPrefix(remain, match)
+	// Check the paths with wildcard segments
+	for _, pattern := range loginPaths.wildcardPaths {
+		if wildcardPathMatches(pattern, remain) {
+			return true
+		}
 	}
 
-	// Handle the exact match case
-	return match == remain
+	return false
+}
+
+// loginPathsEntry holds the unauthenticated paths of a backend
+type loginPathsEntry struct {
+	paths *radix.Tree
+
+	// wildcardPaths are the paths split into segments, in which a "+"
+	// segment matches any single path segment
+	wildcardPaths [][]string
+}
+
+// parseUnauthenticatedPaths converts the unauthenticated paths of a backend
+// to a loginPathsEntry
+func parseUnauthenticatedPaths(paths []string) *loginPathsEntry {
+	var exactPaths []string
+	entry := &loginPathsEntry{}
+	for _, path := range paths {
+		if strings.Contains(path, "+") {
+			entry.wildcardPaths = append(entry.wildcardPaths, strings.Split(path, "/"))
+			continue
+		}
+		exactPaths = append(exactPaths, path)
+	}
+	entry.paths = pathsToRadix(exactPaths)
+
+	return entry
+}
+
+// wildcardPathMatches returns whether the path matches the pattern segments.
+// A "+" segment matches any non-empty segment, and a trailing "*" makes the
+// last segment a prefix match.
+func wildcardPathMatches(pattern []string, path string) bool {
+	segments := strings.Split(path, "/")
+	for i, p := range pattern {
+		if i == len(pattern)-1 && strings.HasSuffix(p, "*") {
+			if len(segments) < len(pattern) {
+				return false
+			}
+			return strings.HasPrefix(strings.Join(segments[i:], "/"), strings.TrimSuffix(p, "*"))
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if p == "+" {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if p != segments[i] {
+			return false
+		}
+	}
+
+	return len(segments) == len(pattern)
 }
 
 // pathsToRadix converts a list of special paths to a radix tree.
@@ -348,6 +348,8 @@ func TestRouter_LoginPath(t *testing.T) {
 		Login: []string{
 			"login",
 			"oauth/*",
+			"provider/+/token",
+			"provider/+/.well-known/*",
 		},
 	}
 	err = r.Mount(n, "auth/foo/", &MountEntry{UUID: meUUID, Accessor: "authfooaccessor", NamespaceID: namespace.RootNamespaceID, namespace: namespace.RootNamespace}, view)
@@ -365,6 +367,12 @@ func TestRouter_LoginPath(t *testing.T) {
 		{"auth/foo/login", true},
 		{"auth/foo/oauth", false},
 		{"auth/foo/oauth/redirect", true},
+		{"auth/foo/provider/bar/token", true},
+		{"auth/foo/provider/bar/token/baz", false},
+		{"auth/foo/provider//token", false},
+		{"auth/foo/provider/bar", false},
+		{"auth/foo/provider/bar/.well-known/keys", true},
+		{"auth/foo/provider/bar/.well-known", false},
 	}
 
 	for _, tc := range tcases {
@@ -0,0 +1,345 @@
+package seal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	proto "github.com/golang/protobuf/proto"
+	"github.com/hashicorp/errwrap"
+	log "github.com/hashicorp/go-hclog"
+	wrapping "github.com/hashicorp/go-kms-wrapping"
+	multierror "github.com/hashicorp/go-multierror"
+)
+
+// MultiWrapperType is the type of a MultiWrapper, which is stored as the type
+// of the barrier seal configuration
+const MultiWrapperType = "multiseal"
+
+// multiBlobVersion marks blobs encrypted by a MultiWrapper
+const multiBlobVersion = 1
+
+var (
+	// multiHealthCheckTTL is how long the result of a health check of a
+	// wrapper is reused
+	multiHealthCheckTTL = 10 * time.Second
+
+	// multiHealthCheckTimeout is how long a health check of a wrapper may
+	// take before the wrapper is reported unhealthy
+	multiHealthCheckTimeout = 10 * time.Second
+)
+
+// MultiWrapperEntry is one of the wrappers of a MultiWrapper
+type MultiWrapperEntry struct {
+	// Name identifies the wrapper in encrypted blobs, so it must not change
+	// once data has been encrypted
+	Name string
+
+	// Priority orders the wrappers, the lowest being tried first
+	Priority int
+
+	Wrapper wrapping.Wrapper
+}
+
+// WrapperStatus is the health of one of the wrappers of a MultiWrapper
+type WrapperStatus struct {
+	Name        string
+	Type        string
+	Priority    int
+	Healthy     bool
+	LastError   string
+	LastChecked time.Time
+}
+
+// MultiWrapper is a wrapper that encrypts data with each of several wrappers,
+// such as KMS keys in different regions, so that it can be decrypted as long
+// as any one of them is reachable. Wrappers failing to encrypt are skipped, and
+// the key ID of the resulting blob reflects which wrappers encrypted it, so
+// that the stored keys are rewrapped once they are healthy again.
+type MultiWrapper struct {
+	logger  log.Logger
+	entries []*MultiWrapperEntry
+
+	statusLock sync.Mutex
+	status     map[string]*WrapperStatus
+}
+
+// Ensure that we are implementing Wrapper
+var _ wrapping.Wrapper = (*MultiWrapper)(nil)
+
+// multiBlob is the ciphertext of a blob encrypted by a MultiWrapper, holding
+// the blob encrypted by each wrapper
+type multiBlob struct {
+	Version int              `json:"version"`
+	Blobs   []*multiBlobPart `json:"blobs"`
+}
+
+type multiBlobPart struct {
+	Name string `json:"name"`
+
+	// Blob is the proto encoded wrapping.EncryptedBlobInfo
+	Blob []byte `json:"blob"`
+}
+
+// NewMultiWrapper creates a MultiWrapper from the given wrappers
+func NewMultiWrapper(logger log.Logger, entries []*MultiWrapperEntry) (*MultiWrapper, error) {
+	if len(entries) == 0 {
+		return nil, errors.New("no wrappers provided")
+	}
+	if logger == nil {
+		logger = log.NewNullLogger()
+	}
+
+	sorted := make([]*MultiWrapperEntry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+
+	m := &MultiWrapper{
+		logger:  logger,
+		entries: sorted,
+		status:  make(map[string]*WrapperStatus, len(sorted)),
+	}
+	for i, entry := range sorted {
+		switch {
+		case entry.Name == "":
+			return nil, errors.New("wrapper name must be set")
+		case entry.Wrapper == nil:
+			return nil, fmt.Errorf("wrapper %q is nil", entry.Name)
+		case strings.ContainsAny(entry.Name, ":,"):
+			return nil, fmt.Errorf("wrapper name %q must not contain ':' or ','", entry.Name)
+		}
+		if _, ok := m.status[entry.Name]; ok {
+			return nil, fmt.Errorf("duplicate wrapper name %q", entry.Name)
+		}
+		if i > 0 && sorted[i-1].Priority == entry.Priority {
+			return nil, fmt.Errorf("wrappers %q and %q have the same priority", sorted[i-1].Name, entry.Name)
+		}
+		m.status[entry.Name] = &WrapperStatus{
+			Name:     entry.Name,
+			Type:     entry.Wrapper.Type(),
+			Priority: entry.Priority,
+			Healthy:  true,
+		}
+	}
+
+	return m, nil
+}
+
+// Entries returns the wrappers in priority order
+func (m *MultiWrapper) Entries() []*MultiWrapperEntry {
+	ret := make([]*MultiWrapperEntry, len(m.entries))
+	copy(ret, m.entries)
+	return ret
+}
+
+// HasType returns whether one of the wrappers is of the given type
+func (m *MultiWrapper) HasType(wrapperType string) bool {
+	for _, entry := range m.entries {
+		if entry.Wrapper.Type() == wrapperType {
+			return true
+		}
+	}
+	return false
+}
+
+// Init initializes each of the wrappers
+func (m *MultiWrapper) Init(ctx context.Context) error {
+	var retErr *multierror.Error
+	for _, entry := range m.entries {
+		if err := entry.Wrapper.Init(ctx); err != nil {
+			retErr = multierror.Append(retErr, errwrap.Wrapf(fmt.Sprintf("error initializing wrapper %q: {{err}}", entry.Name), err))
+		}
+	}
+	return retErr.ErrorOrNil()
+}
+
+// Finalize finalizes each of the wrappers
+func (m *MultiWrapper) Finalize(ctx context.Context) error {
+	var retErr *multierror.Error
+	for _, entry := range m.entries {
+		if err := entry.Wrapper.Finalize(ctx); err != nil {
+			retErr = multierror.Append(retErr, errwrap.Wrapf(fmt.Sprintf("error finalizing wrapper %q: {{err}}", entry.Name), err))
+		}
+	}
+	return retErr.ErrorOrNil()
+}
+
+// Type returns the type for this particular Wrapper implementation
+func (m *MultiWrapper) Type() string {
+	return MultiWrapperType
+}
+
+// KeyID returns the key ID a blob encrypted by every wrapper with its current
+// key would have
+func (m *MultiWrapper) KeyID() string {
+	keyIDs := make([]string, 0, len(m.entries))
+	for _, entry := range m.entries {
+		keyIDs = append(keyIDs, entry.Name+":"+entry.Wrapper.KeyID())
+	}
+	return strings.Join(keyIDs, ",")
+}
+
+// HMACKeyID returns the last known HMAC key id
+func (m *MultiWrapper) HMACKeyID() string {
+	return ""
+}
+
+// Encrypt encrypts the plaintext with each of the wrappers. It only fails if
+// none of them succeeds.
+func (m *MultiWrapper) Encrypt(ctx context.Context, plaintext, aad []byte) (*wrapping.EncryptedBlobInfo, error) {
+	blob := &multiBlob{
+		Version: multiBlobVersion,
+	}
+	keyIDs := make([]string, 0, len(m.entries))
+
+	var retErr *multierror.Error
+	for _, entry := range m.entries {
+		part, err := entry.Wrapper.Encrypt(ctx, plaintext, aad)
+		if err == nil {
+			var encoded []byte
+			encoded, err = proto.Marshal(part)
+			if err == nil {
+				blob.Blobs = append(blob.Blobs, &multiBlobPart{
+					Name: entry.Name,
+					Blob: encoded,
+				})
+				keyIDs = append(keyIDs, entry.Name+":"+entry.Wrapper.KeyID())
+			}
+		}
+		m.recordStatus(entry, err)
+		if err != nil {
+			m.logger.Warn("failed to encrypt with wrapper", "name", entry.Name, "error", err)
+			retErr = multierror.Append(retErr, errwrap.Wrapf(fmt.Sprintf("error encrypting with wrapper %q: {{err}}", entry.Name), err))
+		}
+	}
+
+	if len(blob.Blobs) == 0 {
+		return nil, retErr
+	}
+
+	ciphertext, err := json.Marshal(blob)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wrapping.EncryptedBlobInfo{
+		Ciphertext: ciphertext,
+		KeyInfo: &wrapping.KeyInfo{
+			KeyID: strings.Join(keyIDs, ","),
+		},
+	}, nil
+}
+
+// Decrypt decrypts the blob with the first wrapper, in priority order, which
+// succeeds. Blobs encrypted by a single wrapper, before the seal had several,
+// are decrypted as well.
+func (m *MultiWrapper) Decrypt(ctx context.Context, in *wrapping.EncryptedBlobInfo, aad []byte) ([]byte, error) {
+	if in == nil {
+		return nil, errors.New("given input for decryption is nil")
+	}
+
+	parts := make(map[string]*wrapping.EncryptedBlobInfo, len(m.entries))
+	blob := new(multiBlob)
+	if err := json.Unmarshal(in.Ciphertext, blob); err == nil && blob.Version == multiBlobVersion {
+		for _, part := range blob.Blobs {
+			info := new(wrapping.EncryptedBlobInfo)
+			if err := proto.Unmarshal(part.Blob, info); err != nil {
+				return nil, errwrap.Wrapf(fmt.Sprintf("failed to proto decode blob of wrapper %q: {{err}}", part.Name), err)
+			}
+			parts[part.Name] = info
+		}
+	} else {
+		for _, entry := range m.entries {
+			parts[entry.Name] = in
+		}
+	}
+
+	var retErr *multierror.Error
+	for _, entry := range m.entries {
+		part, ok := parts[entry.Name]
+		if !ok {
+			continue
+		}
+		pt, err := entry.Wrapper.Decrypt(ctx, part, aad)
+		m.recordStatus(entry, err)
+		if err == nil {
+			return pt, nil
+		}
+		m.logger.Warn("failed to decrypt with wrapper", "name", entry.Name, "error", err)
+		retErr = multierror.Append(retErr, errwrap.Wrapf(fmt.Sprintf("error decrypting with wrapper %q: {{err}}", entry.Name), err))
+	}
+
+	if retErr == nil {
+		return nil, errors.New("blob was not encrypted by any of the configured wrappers")
+	}
+	return nil, retErr
+}
+
+// Status returns the health of each wrapper in priority order. Wrappers which
+// have not been used recently are checked by encrypting a test value.
+func (m *MultiWrapper) Status(ctx context.Context) []*WrapperStatus {
+	var wg sync.WaitGroup
+	for _, entry := range m.entries {
+		m.statusLock.Lock()
+		stale := time.Since(m.status[entry.Name].LastChecked) > multiHealthCheckTTL
+		m.statusLock.Unlock()
+		if !stale {
+			continue
+		}
+
+		wg.Add(1)
+		go func(entry *MultiWrapperEntry) {
+			defer wg.Done()
+			m.recordStatus(entry, m.checkHealth(ctx, entry))
+		}(entry)
+	}
+	wg.Wait()
+
+	m.statusLock.Lock()
+	defer m.statusLock.Unlock()
+
+	ret := make([]*WrapperStatus, 0, len(m.entries))
+	for _, entry := range m.entries {
+		status := *m.status[entry.Name]
+		ret = append(ret, &status)
+	}
+	return ret
+}
+
+func (m *MultiWrapper) checkHealth(ctx context.Context, entry *MultiWrapperEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, multiHealthCheckTimeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := entry.Wrapper.Encrypt(ctx, []byte("a"), nil)
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return errors.New("health check timed out")
+	}
+}
+
+func (m *MultiWrapper) recordStatus(entry *MultiWrapperEntry, err error) {
+	m.statusLock.Lock()
+	defer m.statusLock.Unlock()
+
+	status := m.status[entry.Name]
+	status.Healthy = err == nil
+	status.LastError = ""
+	if err != nil {
+		status.LastError = err.Error()
+	}
+	status.LastChecked = time.Now()
+}
@@ -0,0 +1,191 @@
+package seal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	wrapping "github.com/hashicorp/go-kms-wrapping"
+)
+
+// failingWrapper is a test wrapper which can be made unreachable
+type failingWrapper struct {
+	*wrapping.TestWrapper
+	fail bool
+}
+
+func (f *failingWrapper) Encrypt(ctx context.Context, plaintext, aad []byte) (*wrapping.EncryptedBlobInfo, error) {
+	if f.fail {
+		return nil, errors.New("unreachable")
+	}
+	return f.TestWrapper.Encrypt(ctx, plaintext, aad)
+}
+
+func (f *failingWrapper) Decrypt(ctx context.Context, in *wrapping.EncryptedBlobInfo, aad []byte) ([]byte, error) {
+	if f.fail {
+		return nil, errors.New("unreachable")
+	}
+	return f.TestWrapper.Decrypt(ctx, in, aad)
+}
+
+func TestNewMultiWrapper(t *testing.T) {
+	w := wrapping.NewTestWrapper(nil)
+	cases := map[string][]*MultiWrapperEntry{
+		"none":               nil,
+		"no name":            {{Priority: 1, Wrapper: w}},
+		"nil wrapper":        {{Name: "a", Priority: 1}},
+		"duplicate name":     {{Name: "a", Priority: 1, Wrapper: w}, {Name: "a", Priority: 2, Wrapper: w}},
+		"duplicate priority": {{Name: "a", Priority: 1, Wrapper: w}, {Name: "b", Priority: 1, Wrapper: w}},
+		"bad name":           {{Name: "a:b", Priority: 1, Wrapper: w}},
+	}
+	for name, entries := range cases {
+		if _, err := NewMultiWrapper(nil, entries); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+
+	m, err := NewMultiWrapper(nil, []*MultiWrapperEntry{
+		{Name: "b", Priority: 2, Wrapper: w},
+		{Name: "a", Priority: 1, Wrapper: w},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := m.Entries(); entries[0].Name != "a" || entries[1].Name != "b" {
+		t.Fatal("expected wrappers to be sorted by priority")
+	}
+	if m.KeyID() != "a:static-key,b:static-key" {
+		t.Fatalf("bad key id %q", m.KeyID())
+	}
+	if !m.HasType(wrapping.Test) || m.HasType(wrapping.AWSKMS) {
+		t.Fatal("bad HasType result")
+	}
+}
+
+func TestMultiWrapper_Fallback(t *testing.T) {
+	ctx := context.Background()
+	primary := &failingWrapper{TestWrapper: wrapping.NewTestWrapper([]byte("primary"))}
+	secondary := &failingWrapper{TestWrapper: wrapping.NewTestWrapper([]byte("secondary"))}
+
+	m, err := NewMultiWrapper(nil, []*MultiWrapperEntry{
+		{Name: "primary", Priority: 1, Wrapper: primary},
+		{Name: "secondary", Priority: 2, Wrapper: secondary},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := []byte("foo")
+	blob, err := m.Encrypt(ctx, input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob.KeyInfo.KeyID != m.KeyID() {
+		t.Fatalf("expected key id %q, got %q", m.KeyID(), blob.KeyInfo.KeyID)
+	}
+
+	// Either wrapper can decrypt
+	for _, w := range []*failingWrapper{primary, secondary} {
+		w.fail = true
+		pt, err := m.Decrypt(ctx, blob, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(input, pt) {
+			t.Fatalf("expected %s, got %s", input, pt)
+		}
+		w.fail = false
+	}
+
+	// None can decrypt
+	primary.fail, secondary.fail = true, true
+	if _, err := m.Decrypt(ctx, blob, nil); err == nil {
+		t.Fatal("expected error with no reachable wrapper")
+	}
+	if _, err := m.Encrypt(ctx, input, nil); err == nil {
+		t.Fatal("expected error with no reachable wrapper")
+	}
+
+	// A blob encrypted while a wrapper is unreachable has a different key id,
+	// so that it gets rewrapped
+	primary.fail = false
+	blob, err = m.Encrypt(ctx, input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob.KeyInfo.KeyID != "primary:static-key" {
+		t.Fatalf("bad key id %q", blob.KeyInfo.KeyID)
+	}
+	secondary.fail = false
+	primary.fail = true
+	if _, err := m.Decrypt(ctx, blob, nil); err == nil {
+		t.Fatal("expected error decrypting with a wrapper missing from the blob")
+	}
+}
+
+func TestMultiWrapper_SingleWrapperBlob(t *testing.T) {
+	ctx := context.Background()
+	primary := &failingWrapper{TestWrapper: wrapping.NewTestWrapper([]byte("primary"))}
+
+	input := []byte("foo")
+	blob, err := primary.Encrypt(ctx, input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewMultiWrapper(nil, []*MultiWrapperEntry{
+		{Name: "primary", Priority: 1, Wrapper: primary},
+		{Name: "secondary", Priority: 2, Wrapper: wrapping.NewTestWrapper([]byte("secondary"))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pt, err := m.Decrypt(ctx, blob, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(input, pt) {
+		t.Fatalf("expected %s, got %s", input, pt)
+	}
+}
+
+func TestMultiWrapper_Status(t *testing.T) {
+	ctx := context.Background()
+	primary := &failingWrapper{TestWrapper: wrapping.NewTestWrapper(nil)}
+	secondary := &failingWrapper{TestWrapper: wrapping.NewTestWrapper(nil), fail: true}
+
+	m, err := NewMultiWrapper(nil, []*MultiWrapperEntry{
+		{Name: "primary", Priority: 1, Wrapper: primary},
+		{Name: "secondary", Priority: 2, Wrapper: secondary},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := m.Status(ctx)
+	if len(status) != 2 {
+		t.Fatalf("expected 2 statuses, got %d", len(status))
+	}
+	if !status[0].Healthy || status[0].Name != "primary" || status[0].Type != wrapping.Test || status[0].Priority != 1 {
+		t.Fatalf("bad status: %#v", status[0])
+	}
+	if status[1].Healthy || status[1].LastError != "unreachable" {
+		t.Fatalf("bad status: %#v", status[1])
+	}
+
+	// Recent results are reused
+	secondary.fail = false
+	if status := m.Status(ctx); status[1].Healthy {
+		t.Fatal("expected cached status")
+	}
+
+	// Using the wrapper updates its status
+	if _, err := m.Encrypt(ctx, []byte("foo"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if status := m.Status(ctx); !status[1].Healthy {
+		t.Fatal("expected wrapper to be healthy after use")
+	}
+}
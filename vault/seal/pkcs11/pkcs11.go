@@ -0,0 +1,662 @@
+// +build cgo
+
+package pkcs11
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/errwrap"
+	log "github.com/hashicorp/go-hclog"
+	wrapping "github.com/hashicorp/go-kms-wrapping"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/vault/seal"
+	"github.com/miekg/pkcs11"
+)
+
+// These constants contain the accepted env vars, which take precedence over
+// the values in the seal configuration
+const (
+	EnvHSMLib         = "VAULT_HSM_LIB"
+	EnvHSMSlot        = "VAULT_HSM_SLOT"
+	EnvHSMTokenLabel  = "VAULT_HSM_TOKEN_LABEL"
+	EnvHSMPin         = "VAULT_HSM_PIN"
+	EnvHSMKeyLabel    = "VAULT_HSM_KEY_LABEL"
+	EnvHSMMechanism   = "VAULT_HSM_MECHANISM"
+	EnvHSMRSAOAEPHash = "VAULT_HSM_RSA_OAEP_HASH"
+	EnvHSMGenerateKey = "VAULT_HSM_GENERATE_KEY"
+
+	EnvHSMDefaultKeyLabel     = "VAULT_HSM_DEFAULT_KEY_LABEL"
+	EnvHSMHMACKeyLabel        = "VAULT_HSM_HMAC_KEY_LABEL"
+	EnvHSMHMACDefaultKeyLabel = "VAULT_HSM_HMAC_DEFAULT_KEY_LABEL"
+	EnvHSMHMACMechanism       = "VAULT_HSM_HMAC_MECHANISM"
+	EnvHSMRSAEncryptLocal     = "VAULT_HSM_RSA_ENCRYPT_LOCAL"
+)
+
+// ignoredParams are the parameters of existing PKCS#11 seal configurations
+// that do not apply to this seal. They are accepted so that these
+// configurations keep working, and a warning is logged when they are set.
+var ignoredParams = []struct {
+	env, key, reason string
+}{
+	{EnvHSMHMACKeyLabel, "hmac_key_label", "data keys are wrapped with an authenticated mechanism, which needs no HMAC key"},
+	{EnvHSMHMACDefaultKeyLabel, "default_hmac_key_label", "data keys are wrapped with an authenticated mechanism, which needs no HMAC key"},
+	{EnvHSMHMACMechanism, "hmac_mechanism", "data keys are wrapped with an authenticated mechanism, which needs no HMAC key"},
+	{EnvHSMRSAEncryptLocal, "rsa_encrypt_local", "data keys are always encrypted by the HSM"},
+}
+
+const (
+	// gcmIVSize and gcmTagSize are the sizes, in bytes, of the IV and tag
+	// used when wrapping data keys with CKM_AES_GCM
+	gcmIVSize  = 12
+	gcmTagSize = 16
+
+	// generatedAESKeySize and generatedRSAKeyBits are the sizes of the keys
+	// created when generate_key is set
+	generatedAESKeySize = 32
+	generatedRSAKeyBits = 2048
+)
+
+var mechanismNames = map[string]uint{
+	"CKM_AES_GCM":       pkcs11.CKM_AES_GCM,
+	"CKM_RSA_PKCS_OAEP": pkcs11.CKM_RSA_PKCS_OAEP,
+}
+
+// legacyMechanisms are mechanisms of existing PKCS#11 seal configurations
+// that wrap data keys without authentication. They are rejected with an error
+// naming the supported mechanism using the same type of key.
+var legacyMechanisms = map[string]struct {
+	value, replacement uint
+}{
+	"CKM_AES_CBC_PAD": {pkcs11.CKM_AES_CBC_PAD, pkcs11.CKM_AES_GCM},
+	"CKM_AES_CBC":     {pkcs11.CKM_AES_CBC, pkcs11.CKM_AES_GCM},
+	"CKM_RSA_PKCS":    {pkcs11.CKM_RSA_PKCS, pkcs11.CKM_RSA_PKCS_OAEP},
+}
+
+var oaepHashes = map[string][2]uint{
+	"sha1":   {pkcs11.CKM_SHA_1, pkcs11.CKG_MGF1_SHA1},
+	"sha224": {pkcs11.CKM_SHA224, pkcs11.CKG_MGF1_SHA224},
+	"sha256": {pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256},
+	"sha384": {pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384},
+	"sha512": {pkcs11.CKM_SHA512, pkcs11.CKG_MGF1_SHA512},
+}
+
+// Wrapper is a wrapper that protects data with a key held in an HSM, using
+// a PKCS#11 library. Data is encrypted with a random data key, which is in
+// turn encrypted by the HSM with either an AES key (CKM_AES_GCM) or an RSA
+// key pair (CKM_RSA_PKCS_OAEP).
+type Wrapper struct {
+	logger log.Logger
+
+	// l serializes the use of the session, which may not be shared between
+	// concurrent operations
+	l       sync.Mutex
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+
+	slot            uint
+	keyLabel        string
+	defaultKeyLabel string
+	mechanism       uint
+	oaepHash        string
+	generateKey     bool
+
+	envelope *seal.Envelope
+}
+
+// Ensure that we are implementing Wrapper
+var _ wrapping.Wrapper = (*Wrapper)(nil)
+
+// NewWrapper creates a new PKCS#11 wrapper
+func NewWrapper(opts *wrapping.WrapperOptions) *Wrapper {
+	if opts == nil {
+		opts = new(wrapping.WrapperOptions)
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.NewNullLogger()
+	}
+	return &Wrapper{
+		logger:   logger,
+		envelope: seal.NewEnvelope(),
+	}
+}
+
+// SetConfig loads the PKCS#11 library, logs into the token and looks up the
+// key used to encrypt data keys, generating it if requested. It returns the
+// non-sensitive configuration info.
+func (w *Wrapper) SetConfig(config map[string]string) (map[string]string, error) {
+	if config == nil {
+		config = map[string]string{}
+	}
+	value := func(env, key string) string {
+		if v := os.Getenv(env); v != "" {
+			return v
+		}
+		return config[key]
+	}
+
+	lib := value(EnvHSMLib, "lib")
+	if lib == "" {
+		return nil, errors.New("'lib' not found for PKCS#11 seal configuration")
+	}
+	pin := value(EnvHSMPin, "pin")
+	if pin == "" {
+		return nil, errors.New("'pin' not found for PKCS#11 seal configuration")
+	}
+	w.keyLabel = value(EnvHSMKeyLabel, "key_label")
+	if w.keyLabel == "" {
+		return nil, errors.New("'key_label' not found for PKCS#11 seal configuration")
+	}
+
+	slotRaw := value(EnvHSMSlot, "slot")
+	tokenLabel := value(EnvHSMTokenLabel, "token_label")
+	if slotRaw == "" && tokenLabel == "" {
+		return nil, errors.New("one of 'slot' or 'token_label' must be set for PKCS#11 seal configuration")
+	}
+	if slotRaw != "" && tokenLabel != "" {
+		return nil, errors.New("only one of 'slot' or 'token_label' may be set for PKCS#11 seal configuration")
+	}
+
+	// Data encrypted before a key rotation without the key label recorded is
+	// decrypted with the default key label
+	w.defaultKeyLabel = value(EnvHSMDefaultKeyLabel, "default_key_label")
+
+	if raw := value(EnvHSMMechanism, "mechanism"); raw != "" {
+		mechanism, err := parseMechanism(raw)
+		if err != nil {
+			return nil, err
+		}
+		w.mechanism = mechanism
+	}
+
+	for _, param := range ignoredParams {
+		if value(param.env, param.key) != "" {
+			w.logger.Warn("ignoring PKCS#11 seal parameter", "parameter", param.key, "reason", param.reason)
+		}
+	}
+
+	w.oaepHash = strings.ToLower(value(EnvHSMRSAOAEPHash, "rsa_oaep_hash"))
+	if w.oaepHash == "" {
+		w.oaepHash = "sha256"
+	}
+	if _, ok := oaepHashes[w.oaepHash]; !ok {
+		return nil, fmt.Errorf("unsupported 'rsa_oaep_hash' %q for PKCS#11 seal configuration", w.oaepHash)
+	}
+
+	if raw := value(EnvHSMGenerateKey, "generate_key"); raw != "" {
+		generateKey, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing 'generate_key' for PKCS#11 seal configuration: {{err}}", err)
+		}
+		w.generateKey = generateKey
+	}
+
+	ctx := pkcs11.New(lib)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load PKCS#11 library %q", lib)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, errwrap.Wrapf("failed to initialize PKCS#11 library: {{err}}", err)
+	}
+	w.ctx = ctx
+
+	if err := w.openSession(slotRaw, tokenLabel, pin); err != nil {
+		w.close()
+		return nil, err
+	}
+
+	// Look up the key now, to fail early if it does not exist and to settle
+	// on the mechanism matching its type
+	w.l.Lock()
+	_, _, mechanism, err := w.findKey(w.keyLabel, w.mechanism, w.generateKey)
+	w.l.Unlock()
+	if err != nil {
+		w.close()
+		return nil, err
+	}
+	w.mechanism = mechanism
+
+	wrapperInfo := map[string]string{
+		"lib":       lib,
+		"slot":      strconv.FormatUint(uint64(w.slot), 10),
+		"key_label": w.keyLabel,
+		"mechanism": mechanismName(w.mechanism),
+	}
+	if tokenLabel != "" {
+		wrapperInfo["token_label"] = tokenLabel
+	}
+	if w.defaultKeyLabel != "" {
+		wrapperInfo["default_key_label"] = w.defaultKeyLabel
+	}
+	if w.mechanism == pkcs11.CKM_RSA_PKCS_OAEP {
+		wrapperInfo["rsa_oaep_hash"] = w.oaepHash
+	}
+
+	return wrapperInfo, nil
+}
+
+// Init is called during core.Initialize. This is a no-op.
+func (w *Wrapper) Init(_ context.Context) error {
+	return nil
+}
+
+// Finalize is called during shutdown and closes the session with the HSM
+func (w *Wrapper) Finalize(_ context.Context) error {
+	w.close()
+	return nil
+}
+
+// Type returns the type for this particular Wrapper implementation
+func (w *Wrapper) Type() string {
+	return wrapping.PKCS11
+}
+
+// KeyID returns the label of the key used for encryption
+func (w *Wrapper) KeyID() string {
+	return w.keyLabel
+}
+
+// HMACKeyID returns the last known HMAC key id
+func (w *Wrapper) HMACKeyID() string {
+	return ""
+}
+
+// Encrypt encrypts the plaintext with a random data key, and encrypts the
+// data key with the HSM key
+func (w *Wrapper) Encrypt(_ context.Context, plaintext, aad []byte) (blob *wrapping.EncryptedBlobInfo, err error) {
+	if plaintext == nil {
+		return nil, errors.New("given plaintext for encryption is nil")
+	}
+
+	env, err := w.envelope.Encrypt(plaintext, aad)
+	if err != nil {
+		return nil, errwrap.Wrapf("error wrapping data: {{err}}", err)
+	}
+
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	if w.ctx == nil {
+		return nil, errors.New("PKCS#11 seal is not configured")
+	}
+
+	encryptKey, _, mechanism, err := w.findKey(w.keyLabel, w.mechanism, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var wrappedKey []byte
+	switch mechanism {
+	case pkcs11.CKM_AES_GCM:
+		iv, err := uuid.GenerateRandomBytes(gcmIVSize)
+		if err != nil {
+			return nil, err
+		}
+		params := pkcs11.NewGCMParams(iv, nil, gcmTagSize*8)
+		defer params.Free()
+
+		ciphertext, err := w.encrypt(pkcs11.NewMechanism(pkcs11.CKM_AES_GCM, params), encryptKey, env.Key)
+		if err != nil {
+			return nil, err
+		}
+		// The HSM may have generated its own IV
+		iv = params.IV()
+		if len(iv) != gcmIVSize {
+			return nil, fmt.Errorf("unexpected IV size %d returned by the HSM", len(iv))
+		}
+		wrappedKey = append(iv, ciphertext...)
+
+	case pkcs11.CKM_RSA_PKCS_OAEP:
+		wrappedKey, err = w.encrypt(w.oaepMechanism(), encryptKey, env.Key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ret := &wrapping.EncryptedBlobInfo{
+		Ciphertext: env.Ciphertext,
+		IV:         env.IV,
+		KeyInfo: &wrapping.KeyInfo{
+			Mechanism:  uint64(mechanism),
+			KeyID:      w.keyLabel,
+			WrappedKey: wrappedKey,
+		},
+	}
+	return ret, nil
+}
+
+// Decrypt decrypts the data key with the HSM key it was encrypted with, and
+// then decrypts the ciphertext with the data key
+func (w *Wrapper) Decrypt(_ context.Context, in *wrapping.EncryptedBlobInfo, aad []byte) (pt []byte, err error) {
+	if in == nil {
+		return nil, errors.New("given input for decryption is nil")
+	}
+	if in.KeyInfo == nil {
+		return nil, errors.New("key info is nil")
+	}
+
+	// Data may have been encrypted with a previously configured key
+	keyLabel := in.KeyInfo.KeyID
+	if keyLabel == "" {
+		keyLabel = w.defaultKeyLabel
+	}
+	if keyLabel == "" {
+		keyLabel = w.keyLabel
+	}
+	mechanism := uint(in.KeyInfo.Mechanism)
+	if mechanism != pkcs11.CKM_AES_GCM && mechanism != pkcs11.CKM_RSA_PKCS_OAEP {
+		return nil, fmt.Errorf("unsupported mechanism 0x%x", mechanism)
+	}
+
+	key, err := func() ([]byte, error) {
+		w.l.Lock()
+		defer w.l.Unlock()
+
+		if w.ctx == nil {
+			return nil, errors.New("PKCS#11 seal is not configured")
+		}
+
+		_, decryptKey, _, err := w.findKey(keyLabel, mechanism, false)
+		if err != nil {
+			return nil, err
+		}
+
+		switch mechanism {
+		case pkcs11.CKM_AES_GCM:
+			if len(in.KeyInfo.WrappedKey) < gcmIVSize+gcmTagSize {
+				return nil, errors.New("wrapped key is too short")
+			}
+			iv, ciphertext := in.KeyInfo.WrappedKey[:gcmIVSize], in.KeyInfo.WrappedKey[gcmIVSize:]
+			params := pkcs11.NewGCMParams(iv, nil, gcmTagSize*8)
+			defer params.Free()
+			return w.decrypt(pkcs11.NewMechanism(pkcs11.CKM_AES_GCM, params), decryptKey, ciphertext)
+
+		default:
+			return w.decrypt(w.oaepMechanism(), decryptKey, in.KeyInfo.WrappedKey)
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	envInfo := &wrapping.EnvelopeInfo{
+		Key:        key,
+		IV:         in.IV,
+		Ciphertext: in.Ciphertext,
+	}
+	plaintext, err := w.envelope.Decrypt(envInfo, aad)
+	if err != nil {
+		return nil, errwrap.Wrapf("error decrypting data: {{err}}", err)
+	}
+
+	return plaintext, nil
+}
+
+// openSession selects the slot, either by number or by the label of the
+// token it holds, opens a session on it and logs in
+func (w *Wrapper) openSession(slotRaw, tokenLabel, pin string) error {
+	if slotRaw != "" {
+		slot, err := strconv.ParseUint(slotRaw, 0, 64)
+		if err != nil {
+			return errwrap.Wrapf("failed parsing 'slot' for PKCS#11 seal configuration: {{err}}", err)
+		}
+		w.slot = uint(slot)
+	} else {
+		slots, err := w.ctx.GetSlotList(true)
+		if err != nil {
+			return errwrap.Wrapf("failed listing PKCS#11 slots: {{err}}", err)
+		}
+		found := false
+		for _, slot := range slots {
+			info, err := w.ctx.GetTokenInfo(slot)
+			if err != nil {
+				return errwrap.Wrapf("failed reading PKCS#11 token info: {{err}}", err)
+			}
+			if strings.TrimSpace(info.Label) == tokenLabel {
+				w.slot = slot
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("no PKCS#11 token found with label %q", tokenLabel)
+		}
+	}
+
+	session, err := w.ctx.OpenSession(w.slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		return errwrap.Wrapf(fmt.Sprintf("failed opening session on PKCS#11 slot %d: {{err}}", w.slot), err)
+	}
+	w.session = session
+
+	if err := w.ctx.Login(session, pkcs11.CKU_USER, pin); err != nil {
+		if perr, ok := err.(pkcs11.Error); !ok || perr != pkcs11.CKR_USER_ALREADY_LOGGED_IN {
+			return errwrap.Wrapf("failed logging into PKCS#11 token: {{err}}", err)
+		}
+	}
+
+	return nil
+}
+
+// close logs out and releases the PKCS#11 library
+func (w *Wrapper) close() {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	if w.ctx == nil {
+		return
+	}
+	if w.session != 0 {
+		w.ctx.Logout(w.session)
+		w.ctx.CloseSession(w.session)
+		w.session = 0
+	}
+	w.ctx.Finalize()
+	w.ctx.Destroy()
+	w.ctx = nil
+}
+
+// findKey returns the handles of the objects used to encrypt and decrypt with
+// the key labelled label, and the mechanism to use with them. If mechanism is
+// zero it is chosen from the type of the key. If generate is set and no key
+// exists, one is created. Must be called with the lock held.
+func (w *Wrapper) findKey(label string, mechanism uint, generate bool) (encryptKey, decryptKey pkcs11.ObjectHandle, _ uint, err error) {
+	if mechanism == 0 || mechanism == pkcs11.CKM_AES_GCM {
+		secretKey, err := w.findObject(label, pkcs11.CKO_SECRET_KEY)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if secretKey != 0 {
+			return secretKey, secretKey, pkcs11.CKM_AES_GCM, nil
+		}
+	}
+
+	if mechanism == 0 || mechanism == pkcs11.CKM_RSA_PKCS_OAEP {
+		publicKey, err := w.findObject(label, pkcs11.CKO_PUBLIC_KEY)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		privateKey, err := w.findObject(label, pkcs11.CKO_PRIVATE_KEY)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		switch {
+		case publicKey != 0 && privateKey != 0:
+			return publicKey, privateKey, pkcs11.CKM_RSA_PKCS_OAEP, nil
+		case publicKey != 0 || privateKey != 0:
+			return 0, 0, 0, fmt.Errorf("both the public and private keys labelled %q are required", label)
+		}
+	}
+
+	if !generate {
+		return 0, 0, 0, fmt.Errorf("no PKCS#11 key found with label %q", label)
+	}
+
+	w.logger.Info("generating PKCS#11 key", "key_label", label)
+	if mechanism == pkcs11.CKM_RSA_PKCS_OAEP {
+		publicKey, privateKey, err := w.generateRSAKey(label)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		return publicKey, privateKey, pkcs11.CKM_RSA_PKCS_OAEP, nil
+	}
+	secretKey, err := w.generateAESKey(label)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return secretKey, secretKey, pkcs11.CKM_AES_GCM, nil
+}
+
+// findObject returns the handle of the object of the given class with the
+// given label, or zero if there is none
+func (w *Wrapper) findObject(label string, class uint) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := w.ctx.FindObjectsInit(w.session, template); err != nil {
+		return 0, errwrap.Wrapf("failed searching PKCS#11 objects: {{err}}", err)
+	}
+	objects, _, err := w.ctx.FindObjects(w.session, 2)
+	if finalErr := w.ctx.FindObjectsFinal(w.session); err == nil {
+		err = finalErr
+	}
+	if err != nil {
+		return 0, errwrap.Wrapf("failed searching PKCS#11 objects: {{err}}", err)
+	}
+
+	switch len(objects) {
+	case 0:
+		return 0, nil
+	case 1:
+		return objects[0], nil
+	default:
+		return 0, fmt.Errorf("multiple PKCS#11 objects found with label %q", label)
+	}
+}
+
+// generateAESKey creates a non-extractable AES key on the token
+func (w *Wrapper) generateAESKey(label string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_SECRET_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_AES),
+		pkcs11.NewAttribute(pkcs11.CKA_VALUE_LEN, generatedAESKeySize),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_ENCRYPT, true),
+		pkcs11.NewAttribute(pkcs11.CKA_DECRYPT, true),
+	}
+	mechanism := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_KEY_GEN, nil)}
+	key, err := w.ctx.GenerateKey(w.session, mechanism, template)
+	if err != nil {
+		return 0, errwrap.Wrapf("failed generating PKCS#11 AES key: {{err}}", err)
+	}
+	return key, nil
+}
+
+// generateRSAKey creates an RSA key pair on the token, whose private key is
+// non-extractable
+func (w *Wrapper) generateRSAKey(label string) (publicKey, privateKey pkcs11.ObjectHandle, err error) {
+	publicTemplate := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PUBLIC_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA),
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, generatedRSAKeyBits),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_ENCRYPT, true),
+	}
+	privateTemplate := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_DECRYPT, true),
+	}
+	mechanism := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN, nil)}
+	publicKey, privateKey, err = w.ctx.GenerateKeyPair(w.session, mechanism, publicTemplate, privateTemplate)
+	if err != nil {
+		return 0, 0, errwrap.Wrapf("failed generating PKCS#11 RSA key pair: {{err}}", err)
+	}
+	return publicKey, privateKey, nil
+}
+
+func (w *Wrapper) oaepMechanism() *pkcs11.Mechanism {
+	hash := oaepHashes[w.oaepHash]
+	params := pkcs11.NewOAEPParams(hash[0], hash[1], pkcs11.CKZ_DATA_SPECIFIED, nil)
+	return pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_OAEP, params)
+}
+
+func (w *Wrapper) encrypt(mechanism *pkcs11.Mechanism, key pkcs11.ObjectHandle, plaintext []byte) ([]byte, error) {
+	if err := w.ctx.EncryptInit(w.session, []*pkcs11.Mechanism{mechanism}, key); err != nil {
+		return nil, errwrap.Wrapf("error encrypting data key: {{err}}", err)
+	}
+	ciphertext, err := w.ctx.Encrypt(w.session, plaintext)
+	if err != nil {
+		return nil, errwrap.Wrapf("error encrypting data key: {{err}}", err)
+	}
+	return ciphertext, nil
+}
+
+func (w *Wrapper) decrypt(mechanism *pkcs11.Mechanism, key pkcs11.ObjectHandle, ciphertext []byte) ([]byte, error) {
+	if err := w.ctx.DecryptInit(w.session, []*pkcs11.Mechanism{mechanism}, key); err != nil {
+		return nil, errwrap.Wrapf("error decrypting data key: {{err}}", err)
+	}
+	plaintext, err := w.ctx.Decrypt(w.session, ciphertext)
+	if err != nil {
+		return nil, errwrap.Wrapf("error decrypting data key: {{err}}", err)
+	}
+	return plaintext, nil
+}
+
+// parseMechanism accepts either the name of a supported mechanism or its
+// numeric value, e.g. "CKM_AES_GCM" or "0x1087". Legacy mechanisms are
+// rejected with an error naming the supported one for the same type of key.
+func parseMechanism(raw string) (uint, error) {
+	if mechanism, ok := mechanismNames[strings.ToUpper(raw)]; ok {
+		return mechanism, nil
+	}
+	if m, ok := legacyMechanisms[strings.ToUpper(raw)]; ok {
+		return 0, legacyMechanismError(strings.ToUpper(raw), m.replacement)
+	}
+	value, parseErr := strconv.ParseUint(raw, 0, 64)
+	if parseErr == nil {
+		for _, mechanism := range mechanismNames {
+			if uint(value) == mechanism {
+				return mechanism, nil
+			}
+		}
+		for name, m := range legacyMechanisms {
+			if uint(value) == m.value {
+				return 0, legacyMechanismError(name, m.replacement)
+			}
+		}
+	}
+	return 0, fmt.Errorf("unsupported 'mechanism' %q for PKCS#11 seal configuration, must be CKM_AES_GCM or CKM_RSA_PKCS_OAEP", raw)
+}
+
+func legacyMechanismError(name string, replacement uint) error {
+	return fmt.Errorf("'mechanism' %s is not supported by the PKCS#11 seal as it wraps data keys without authentication, use %s with the same key instead", name, mechanismName(replacement))
+}
+
+func mechanismName(mechanism uint) string {
+	for name, value := range mechanismNames {
+		if value == mechanism {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%x", mechanism)
+}
@@ -0,0 +1,169 @@
+// +build cgo
+
+package pkcs11
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/miekg/pkcs11"
+)
+
+func TestParseMechanism(t *testing.T) {
+	cases := []struct {
+		raw       string
+		mechanism uint
+		err       string
+	}{
+		{"CKM_AES_GCM", pkcs11.CKM_AES_GCM, ""},
+		{"ckm_rsa_pkcs_oaep", pkcs11.CKM_RSA_PKCS_OAEP, ""},
+		{"0x1087", pkcs11.CKM_AES_GCM, ""},
+		{"9", pkcs11.CKM_RSA_PKCS_OAEP, ""},
+		{"CKM_AES_CBC", 0, "use CKM_AES_GCM"},
+		{"0x1085", 0, "use CKM_AES_GCM"},
+		{"0x0001", 0, "use CKM_RSA_PKCS_OAEP"},
+		{"CKM_DES3_CBC", 0, "unsupported"},
+		{"0x0133", 0, "unsupported"},
+	}
+
+	for _, tc := range cases {
+		mechanism, err := parseMechanism(tc.raw)
+		switch {
+		case tc.err == "" && err != nil:
+			t.Fatalf("%s: unexpected error: %v", tc.raw, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Fatalf("%s: expected error containing %q, got %v", tc.raw, tc.err, err)
+		}
+		if mechanism != tc.mechanism {
+			t.Fatalf("%s: expected mechanism 0x%x, got 0x%x", tc.raw, tc.mechanism, mechanism)
+		}
+	}
+}
+
+func TestPKCS11Wrapper_SetConfig(t *testing.T) {
+	for _, env := range []string{EnvHSMLib, EnvHSMSlot, EnvHSMTokenLabel, EnvHSMPin, EnvHSMKeyLabel, EnvHSMMechanism} {
+		if os.Getenv(env) != "" {
+			t.Skipf("%s is set", env)
+		}
+	}
+
+	cases := map[string]map[string]string{
+		"no lib":           {"pin": "1234", "key_label": "vault", "slot": "0"},
+		"no pin":           {"lib": "/nonexistent.so", "key_label": "vault", "slot": "0"},
+		"no key label":     {"lib": "/nonexistent.so", "pin": "1234", "slot": "0"},
+		"no slot":          {"lib": "/nonexistent.so", "pin": "1234", "key_label": "vault"},
+		"slot and token":   {"lib": "/nonexistent.so", "pin": "1234", "key_label": "vault", "slot": "0", "token_label": "vault"},
+		"bad mechanism":    {"lib": "/nonexistent.so", "pin": "1234", "key_label": "vault", "slot": "0", "mechanism": "CKM_DES3_CBC"},
+		"legacy mechanism": {"lib": "/nonexistent.so", "pin": "1234", "key_label": "vault", "slot": "0", "mechanism": "CKM_AES_CBC_PAD"},
+		"bad oaep hash":    {"lib": "/nonexistent.so", "pin": "1234", "key_label": "vault", "slot": "0", "rsa_oaep_hash": "md5"},
+		"bad generate key": {"lib": "/nonexistent.so", "pin": "1234", "key_label": "vault", "slot": "0", "generate_key": "maybe"},
+		"missing library":  {"lib": "/nonexistent.so", "pin": "1234", "key_label": "vault", "slot": "0"},
+	}
+
+	for name, config := range cases {
+		if _, err := NewWrapper(nil).SetConfig(config); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+// TestPKCS11Wrapper_Lifecycle runs against a real PKCS#11 library, such as
+// SoftHSMv2 with a token initialized with:
+//
+//	softhsm2-util --init-token --free --label vault --pin 1234 --so-pin 1234
+//
+// and VAULT_HSM_LIB, VAULT_HSM_TOKEN_LABEL and VAULT_HSM_PIN set accordingly.
+func TestPKCS11Wrapper_Lifecycle(t *testing.T) {
+	if os.Getenv("VAULT_ACC") == "" || os.Getenv(EnvHSMLib) == "" {
+		t.Skip()
+	}
+	if os.Getenv(EnvHSMKeyLabel) != "" || os.Getenv(EnvHSMMechanism) != "" {
+		t.Skip("VAULT_HSM_KEY_LABEL and VAULT_HSM_MECHANISM must not be set")
+	}
+
+	for _, mechanism := range []string{"CKM_AES_GCM", "CKM_RSA_PKCS_OAEP"} {
+		t.Run(mechanism, func(t *testing.T) {
+			keyLabel, err := uuid.GenerateUUID()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// SoftHSMv2 only supports SHA-1 with RSA OAEP
+			w := NewWrapper(nil)
+			info, err := w.SetConfig(map[string]string{
+				"key_label":     keyLabel,
+				"mechanism":     mechanism,
+				"generate_key":  "true",
+				"rsa_oaep_hash": "sha1",
+			})
+			if err != nil {
+				t.Fatalf("error setting wrapper config: %v", err)
+			}
+			defer w.Finalize(context.Background())
+			defer destroyKeys(t, w, keyLabel)
+
+			if info["mechanism"] != mechanism || info["key_label"] != keyLabel {
+				t.Fatalf("bad wrapper info: %v", info)
+			}
+			if w.KeyID() != keyLabel {
+				t.Fatalf("expected key id %q, got %q", keyLabel, w.KeyID())
+			}
+
+			input := []byte("foo")
+			aad := []byte("bar")
+			swi, err := w.Encrypt(context.Background(), input, aad)
+			if err != nil {
+				t.Fatalf("err: %s", err.Error())
+			}
+
+			pt, err := w.Decrypt(context.Background(), swi, aad)
+			if err != nil {
+				t.Fatalf("err: %s", err.Error())
+			}
+			if !reflect.DeepEqual(input, pt) {
+				t.Fatalf("expected %s, got %s", input, pt)
+			}
+
+			if _, err := w.Decrypt(context.Background(), swi, []byte("baz")); err == nil {
+				t.Fatal("expected error decrypting with the wrong aad")
+			}
+
+			// A second wrapper finds the generated key
+			w2 := NewWrapper(nil)
+			if _, err := w2.SetConfig(map[string]string{"key_label": keyLabel, "rsa_oaep_hash": "sha1"}); err != nil {
+				t.Fatalf("error setting wrapper config: %v", err)
+			}
+			defer w2.Finalize(context.Background())
+
+			pt, err = w2.Decrypt(context.Background(), swi, aad)
+			if err != nil {
+				t.Fatalf("err: %s", err.Error())
+			}
+			if !reflect.DeepEqual(input, pt) {
+				t.Fatalf("expected %s, got %s", input, pt)
+			}
+		})
+	}
+}
+
+func destroyKeys(t *testing.T, w *Wrapper, label string) {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	for _, class := range []uint{pkcs11.CKO_SECRET_KEY, pkcs11.CKO_PUBLIC_KEY, pkcs11.CKO_PRIVATE_KEY} {
+		object, err := w.findObject(label, class)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if object == 0 {
+			continue
+		}
+		if err := w.ctx.DestroyObject(w.session, object); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -51,3 +51,23 @@ func (s *SealAccess) ClearCaches(ctx context.Context) {
 func (s *SealAccess) GetAccess() *seal.Access {
 	return s.seal.GetAccess()
 }
+
+// WrapperStatus returns the health of the wrappers of a multiseal, and
+// whether the stored keys need to be rewrapped. It returns nil for other
+// seals.
+func (s *SealAccess) WrapperStatus(ctx context.Context) ([]*seal.WrapperStatus, bool, error) {
+	d, ok := s.seal.(*autoSeal)
+	if !ok {
+		return nil, false, nil
+	}
+	multi, ok := d.Access.Wrapper.(*seal.MultiWrapper)
+	if !ok {
+		return nil, false, nil
+	}
+
+	needsRewrap, err := d.NeedsRewrap(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	return multi.Status(ctx), needsRewrap, nil
+}
@@ -78,6 +78,28 @@ func (d *autoSeal) BarrierType() string {
 	return d.Type()
 }
 
+// acceptsBarrierType returns whether the seal can be used with a barrier
+// configured for the given seal type. A multiseal accepts the types of its
+// wrappers, so a single wrapper seal can be extended with more wrappers.
+func (d *autoSeal) acceptsBarrierType(barrierType string) bool {
+	if barrierType == d.BarrierType() {
+		return true
+	}
+	if multi, ok := d.Access.Wrapper.(*seal.MultiWrapper); ok {
+		return multi.HasType(barrierType)
+	}
+	return false
+}
+
+// SealAcceptsBarrierType returns whether the seal can be used with a barrier
+// configured for the given seal type
+func SealAcceptsBarrierType(s Seal, barrierType string) bool {
+	if d, ok := s.(*autoSeal); ok {
+		return d.acceptsBarrierType(barrierType)
+	}
+	return s.BarrierType() == barrierType
+}
+
 func (d *autoSeal) StoredKeysSupported() seal.StoredKeysSupport {
 	return seal.StoredKeysSupportedGeneric
 }
@@ -150,9 +172,64 @@ func (d *autoSeal) UpgradeKeys(ctx context.Context) error {
 	if err := d.upgradeStoredKeys(ctx); err != nil {
 		return err
 	}
+	if err := d.upgradeBarrierConfigType(ctx); err != nil {
+		return err
+	}
 	return nil
 }
 
+// NeedsRewrap returns whether the stored keys or the recovery key were not
+// encrypted with the current key, for a multiseal by every one of its
+// wrappers. They are rewrapped by UpgradeKeys.
+func (d *autoSeal) NeedsRewrap(ctx context.Context) (bool, error) {
+	if err := d.checkCore(); err != nil {
+		return false, err
+	}
+
+	for _, path := range []string{StoredBarrierKeysPath, recoveryKeyPath} {
+		pe, err := d.core.physical.Get(ctx, path)
+		if err != nil {
+			return false, errwrap.Wrapf(fmt.Sprintf("failed to fetch %q: {{err}}", path), err)
+		}
+		if pe == nil {
+			continue
+		}
+
+		blobInfo := &wrapping.EncryptedBlobInfo{}
+		if err := proto.Unmarshal(pe.Value, blobInfo); err != nil {
+			return false, errwrap.Wrapf(fmt.Sprintf("failed to proto decode %q: {{err}}", path), err)
+		}
+		if blobInfo.KeyInfo != nil && blobInfo.KeyInfo.KeyID != d.Access.KeyID() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// upgradeBarrierConfigType stores the barrier seal configuration with the
+// type of the seal, if it was accepted for a barrier configured for another
+// type of seal
+func (d *autoSeal) upgradeBarrierConfigType(ctx context.Context) error {
+	entry, err := d.core.physical.Get(ctx, barrierSealConfigPath)
+	if err != nil {
+		return errwrap.Wrapf("failed to read barrier seal configuration: {{err}}", err)
+	}
+	if entry == nil {
+		return nil
+	}
+
+	conf := &SealConfig{}
+	if err := json.Unmarshal(entry.Value, conf); err != nil {
+		return errwrap.Wrapf("failed to decode barrier seal configuration: {{err}}", err)
+	}
+	if conf.Type == d.BarrierType() {
+		return nil
+	}
+
+	d.logger.Info("upgrading barrier seal configuration type", "from", conf.Type, "to", d.BarrierType())
+	return d.SetBarrierConfig(ctx, conf)
+}
+
 func (d *autoSeal) BarrierConfig(ctx context.Context) (*SealConfig, error) {
 	if d.barrierConfig.Load().(*SealConfig) != nil {
 		return d.barrierConfig.Load().(*SealConfig).Clone(), nil
@@ -193,6 +270,11 @@ func (d *autoSeal) BarrierConfig(ctx context.Context) (*SealConfig, error) {
 
 	barrierTypeUpgradeCheck(d.BarrierType(), conf)
 
+	if conf.Type != d.BarrierType() && d.acceptsBarrierType(conf.Type) {
+		d.logger.Info("barrier seal type accepted by loaded seal, it will be upgraded once unsealed", "seal_type", conf.Type, "loaded_type", d.BarrierType())
+		conf.Type = d.BarrierType()
+	}
+
 	if conf.Type != d.BarrierType() {
 		d.logger.Error("barrier seal type does not match loaded type", "seal_type", conf.Type, "loaded_type", d.BarrierType())
 		return nil, fmt.Errorf("barrier seal type of %q does not match loaded type of %q", conf.Type, d.BarrierType())
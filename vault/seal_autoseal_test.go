@@ -3,6 +3,7 @@ package vault
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"reflect"
 	"testing"
 
@@ -157,3 +158,112 @@ func TestAutoSeal_UpgradeKeys(t *testing.T) {
 	}
 	check()
 }
+
+func TestAutoSeal_MultiWrapperUpgrade(t *testing.T) {
+	core, _, _ := TestCoreUnsealed(t)
+	pBackend := newTestBackend(t)
+	core.physical = pBackend
+	ctx := context.Background()
+
+	// Initialize with a single wrapper
+	primary := seal.NewTestSeal(nil)
+	single := NewAutoSeal(primary)
+	single.SetCore(core)
+	if err := single.SetBarrierConfig(ctx, &SealConfig{
+		SecretShares:    1,
+		SecretThreshold: 1,
+		StoredShares:    1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	inkeys := [][]byte{[]byte("grist"), []byte("house")}
+	if err := single.SetStoredKeys(ctx, inkeys); err != nil {
+		t.Fatal(err)
+	}
+	if err := single.SetRecoveryKey(ctx, []byte("falernum")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a second wrapper
+	multiWrapper, err := seal.NewMultiWrapper(nil, []*seal.MultiWrapperEntry{
+		{Name: "secondary", Priority: 2, Wrapper: wrapping.NewTestWrapper([]byte("secondary"))},
+		{Name: "primary", Priority: 1, Wrapper: primary.Wrapper},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	multi := NewAutoSeal(&seal.Access{Wrapper: multiWrapper})
+	multi.SetCore(core)
+
+	if !SealAcceptsBarrierType(multi, wrapping.Test) {
+		t.Fatal("expected multiseal to accept the barrier type of its wrappers")
+	}
+	if SealAcceptsBarrierType(single, seal.MultiWrapperType) {
+		t.Fatal("expected single wrapper seal not to accept a multiseal barrier type")
+	}
+
+	conf, err := multi.BarrierConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Type != seal.MultiWrapperType {
+		t.Fatalf("expected barrier type %q, got %q", seal.MultiWrapperType, conf.Type)
+	}
+
+	outkeys, err := multi.GetStoredKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inkeys, outkeys) {
+		t.Fatalf("incorrect stored keys: want %v, got %v", inkeys, outkeys)
+	}
+
+	needsRewrap, err := multi.NeedsRewrap(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !needsRewrap {
+		t.Fatal("expected keys encrypted by a single wrapper to need rewrapping")
+	}
+
+	if err := multi.UpgradeKeys(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	needsRewrap, err = multi.NeedsRewrap(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if needsRewrap {
+		t.Fatal("expected keys not to need rewrapping after UpgradeKeys")
+	}
+
+	// The barrier configuration now records the multiseal
+	multi.SetCachedBarrierConfig(nil)
+	entry, err := pBackend.Get(ctx, barrierSealConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := &SealConfig{}
+	if err := json.Unmarshal(entry.Value, stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Type != seal.MultiWrapperType {
+		t.Fatalf("expected stored barrier type %q, got %q", seal.MultiWrapperType, stored.Type)
+	}
+
+	// The secondary wrapper alone can decrypt the rewrapped keys
+	secondaryOnly, err := seal.NewMultiWrapper(nil, []*seal.MultiWrapperEntry{
+		{Name: "secondary", Priority: 2, Wrapper: wrapping.NewTestWrapper([]byte("secondary"))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outkeys, err = readStoredKeys(ctx, core.physical, &seal.Access{Wrapper: secondaryOnly})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inkeys, outkeys) {
+		t.Fatalf("incorrect stored keys: want %v, got %v", inkeys, outkeys)
+	}
+}
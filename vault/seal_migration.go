@@ -0,0 +1,305 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	aeadwrapper "github.com/hashicorp/go-kms-wrapping/wrappers/aead"
+)
+
+const (
+	// SealMigrationStatePending is the state of a node in seal migration
+	// mode which has not been unsealed yet
+	SealMigrationStatePending = "pending"
+
+	// SealMigrationStateWaitingForActive is the state of a node of an HA
+	// cluster which has been unsealed in seal migration mode, and migrates
+	// the stored keys once it becomes active
+	SealMigrationStateWaitingForActive = "waiting-for-active"
+
+	// SealMigrationStateMigrating is the state of a node migrating the stored
+	// keys to the new seal
+	SealMigrationStateMigrating = "migrating"
+
+	// SealMigrationStateComplete is the state of a node once the stored keys
+	// have been migrated to the new seal, by this node or another one of the
+	// cluster
+	SealMigrationStateComplete = "complete"
+
+	// SealMigrationStateFailed is the state of a node which failed to migrate
+	// the stored keys, in which case it seals itself
+	SealMigrationStateFailed = "failed"
+)
+
+// SealMigrationStatus is the progress of a seal migration on this node
+type SealMigrationStatus struct {
+	State     string
+	FromType  string
+	ToType    string
+	Error     string
+	UpdatedAt time.Time
+}
+
+// migrationInformation holds the keys recovered with the migration seal when
+// a node of an HA cluster is unsealed in seal migration mode, so that the
+// stored keys can be migrated once it becomes active
+type migrationInformation struct {
+	// unsealKey is the combined key provided when unsealing, which becomes
+	// the recovery key when migrating from Shamir
+	unsealKey []byte
+
+	// recoveryKey is the recovery key of the migration seal, if it has one
+	recoveryKey []byte
+
+	// barrierConfig and recoveryConfig are the configurations of the new
+	// seal, stored once the migration is done
+	barrierConfig  *SealConfig
+	recoveryConfig *SealConfig
+}
+
+// SealMigrationStatus returns the progress of the seal migration on this node,
+// or nil if the node has not been in seal migration mode
+func (c *Core) SealMigrationStatus(ctx context.Context) (*SealMigrationStatus, error) {
+	status, _ := c.sealMigrationStatus.Load().(*SealMigrationStatus)
+	if status == nil {
+		return nil, nil
+	}
+	ret := *status
+
+	// Another node of the cluster may have migrated the stored keys already
+	if ret.State == SealMigrationStateWaitingForActive {
+		barrierConfig, _, err := c.PhysicalSealConfigs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if barrierConfig != nil && barrierConfig.Type == ret.ToType {
+			ret.State = SealMigrationStateComplete
+		}
+	}
+
+	return &ret, nil
+}
+
+func (c *Core) setSealMigrationState(state string, err error) {
+	status := &SealMigrationStatus{
+		State:     state,
+		UpdatedAt: time.Now(),
+	}
+	if c.migrationSeal != nil {
+		status.FromType = c.migrationSeal.BarrierType()
+	} else if old, ok := c.sealMigrationStatus.Load().(*SealMigrationStatus); ok && old != nil {
+		status.FromType = old.FromType
+	}
+	status.ToType = c.seal.BarrierType()
+	if err != nil {
+		status.Error = err.Error()
+	}
+	c.sealMigrationStatus.Store(status)
+}
+
+// prepareSealMigration keeps the keys recovered with the migration seal, for
+// the stored keys to be migrated once this node becomes active. Until then the
+// other nodes of the cluster keep using the stored keys of the migration seal.
+// N.B.: This must be called with the state write lock held.
+func (c *Core) prepareSealMigration(ctx context.Context, unsealKey, recoveryKey []byte) error {
+	barrierConfig, err := c.seal.BarrierConfig(ctx)
+	if err != nil {
+		return errwrap.Wrapf("error fetching new barrier config: {{err}}", err)
+	}
+	info := &migrationInformation{
+		unsealKey:     copyKey(unsealKey),
+		recoveryKey:   copyKey(recoveryKey),
+		barrierConfig: barrierConfig,
+	}
+	if c.seal.RecoveryKeySupported() {
+		info.recoveryConfig, err = c.seal.RecoveryConfig(ctx)
+		if err != nil {
+			return errwrap.Wrapf("error fetching new recovery config: {{err}}", err)
+		}
+	}
+
+	c.migrationInfo = info
+	c.setSealMigrationState(SealMigrationStateWaitingForActive, nil)
+	c.logger.Info("unsealed in seal migration mode, stored keys will be migrated once this node is active")
+
+	return nil
+}
+
+// migrateSeal migrates the stored keys to the new seal once a node unsealed in
+// seal migration mode becomes active, unless another node did it already.
+// N.B.: This must be called with the state write lock held.
+func (c *Core) migrateSeal(ctx context.Context) (retErr error) {
+	info := c.migrationInfo
+	defer func() {
+		memzero(info.unsealKey)
+		memzero(info.recoveryKey)
+		c.migrationInfo = nil
+		if retErr != nil {
+			c.setSealMigrationState(SealMigrationStateFailed, retErr)
+		}
+	}()
+
+	barrierConfig, _, err := c.PhysicalSealConfigs(ctx)
+	if err != nil {
+		return err
+	}
+	if barrierConfig != nil && SealAcceptsBarrierType(c.seal, barrierConfig.Type) {
+		c.logger.Info("stored keys already migrated to the new seal")
+		c.migrationSeal = nil
+		c.setSealMigrationState(SealMigrationStateComplete, nil)
+		return nil
+	}
+
+	c.logger.Info("migrating stored keys to the new seal", "from_barrier_type", c.migrationSeal.BarrierType(), "to_barrier_type", c.seal.BarrierType())
+	c.setSealMigrationState(SealMigrationStateMigrating, nil)
+
+	// Pick up any rekey or key rotation done while this node was a standby
+	if err := c.reloadMasterKey(ctx); err != nil {
+		return err
+	}
+	if err := c.barrier.ReloadKeyring(ctx); err != nil {
+		return errwrap.Wrapf("error reloading keyring: {{err}}", err)
+	}
+	keyring, err := c.barrier.Keyring()
+	if err != nil {
+		return errwrap.Wrapf("error fetching keyring: {{err}}", err)
+	}
+	masterKey := copyKey(keyring.MasterKey())
+	defer memzero(masterKey)
+
+	c.seal.SetCachedBarrierConfig(info.barrierConfig)
+	if c.seal.RecoveryKeySupported() {
+		c.seal.SetCachedRecoveryConfig(info.recoveryConfig)
+	}
+
+	if _, err := c.migrateSealKeys(ctx, masterKey, info.unsealKey, info.recoveryKey); err != nil {
+		return err
+	}
+	if err := c.finishSealMigration(ctx); err != nil {
+		return err
+	}
+
+	c.logger.Info("seal migration complete")
+	return nil
+}
+
+// migrateSealKeys stores the keys under the new seal, the barrier being
+// unsealed. It returns the key to unseal the barrier with afterwards.
+func (c *Core) migrateSealKeys(ctx context.Context, masterKey, unsealKey, recoveryKey []byte) ([]byte, error) {
+	switch {
+	case c.migrationSeal.RecoveryKeySupported() && c.seal.RecoveryKeySupported():
+		// Set the recovery and barrier keys to be the same.
+		recoveryKey, err := c.migrationSeal.RecoveryKey(ctx)
+		if err != nil {
+			return nil, errwrap.Wrapf("error getting recovery key to set on new seal: {{err}}", err)
+		}
+
+		if err := c.seal.SetRecoveryKey(ctx, recoveryKey); err != nil {
+			return nil, errwrap.Wrapf("error setting new recovery key information during migrate: {{err}}", err)
+		}
+
+		barrierKeys, err := c.migrationSeal.GetStoredKeys(ctx)
+		if err != nil {
+			return nil, errwrap.Wrapf("error getting stored keys to set on new seal: {{err}}", err)
+		}
+
+		if err := c.seal.SetStoredKeys(ctx, barrierKeys); err != nil {
+			return nil, errwrap.Wrapf("error setting new barrier key information during migrate: {{err}}", err)
+		}
+
+		return masterKey, nil
+
+	case c.migrationSeal.RecoveryKeySupported():
+		// Auto to Shamir, since recovery key isn't supported on new seal
+
+		// In this case we have to ensure that the recovery information was
+		// set properly.
+		if recoveryKey == nil {
+			return nil, errors.New("did not get expected recovery information to set new seal during migration")
+		}
+
+		// We have recovery keys; we're going to use them as the new
+		// shamir KeK.
+		err := c.seal.GetAccess().Wrapper.(*aeadwrapper.Wrapper).SetAESGCMKeyBytes(recoveryKey)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to set master key in seal: {{err}}", err)
+		}
+		if err := c.seal.SetStoredKeys(ctx, [][]byte{masterKey}); err != nil {
+			return nil, errwrap.Wrapf("error setting new barrier key information during migrate: {{err}}", err)
+		}
+
+		return recoveryKey, nil
+
+	case c.seal.RecoveryKeySupported():
+		// The new seal will have recovery keys; we set it to the existing
+		// master key, so barrier key shares -> recovery key shares
+		if err := c.seal.SetRecoveryKey(ctx, unsealKey); err != nil {
+			return nil, errwrap.Wrapf("error setting new recovery key information: {{err}}", err)
+		}
+
+		// Generate a new master key
+		newMasterKey, err := c.barrier.GenerateKey(c.secureRandomReader)
+		if err != nil {
+			return nil, errwrap.Wrapf("error generating new master key: {{err}}", err)
+		}
+
+		// Rekey the barrier
+		if err := c.barrier.Rekey(ctx, newMasterKey); err != nil {
+			return nil, errwrap.Wrapf("error rekeying barrier during migration: {{err}}", err)
+		}
+
+		// Store the new master key
+		if err := c.seal.SetStoredKeys(ctx, [][]byte{newMasterKey}); err != nil {
+			return nil, errwrap.Wrapf("error storing new master key: {{err}}", err)
+		}
+
+		// Return the new key so it can be used to unlock the barrier
+		return newMasterKey, nil
+
+	default:
+		return nil, errors.New("unhandled migration case (shamir to shamir)")
+	}
+}
+
+// finishSealMigration stores the configuration of the new seal and leaves
+// seal migration mode
+func (c *Core) finishSealMigration(ctx context.Context) error {
+	// At this point we've swapped things around and need to ensure we
+	// don't migrate again
+	c.migrationSeal = nil
+	atomic.StoreUint32(c.sealMigrated, 1)
+
+	// Ensure we populate the new values
+	bc, err := c.seal.BarrierConfig(ctx)
+	if err != nil {
+		return errwrap.Wrapf("error fetching barrier config after migration: {{err}}", err)
+	}
+	if err := c.seal.SetBarrierConfig(ctx, bc); err != nil {
+		return errwrap.Wrapf("error storing barrier config after migration: {{err}}", err)
+	}
+
+	if c.seal.RecoveryKeySupported() {
+		rc, err := c.seal.RecoveryConfig(ctx)
+		if err != nil {
+			return errwrap.Wrapf("error fetching recovery config after migration: {{err}}", err)
+		}
+		if err := c.seal.SetRecoveryConfig(ctx, rc); err != nil {
+			return errwrap.Wrapf("error storing recovery config after migration: {{err}}", err)
+		}
+	}
+
+	c.setSealMigrationState(SealMigrationStateComplete, nil)
+	return nil
+}
+
+func copyKey(key []byte) []byte {
+	if key == nil {
+		return nil
+	}
+	ret := make([]byte, len(key))
+	copy(ret, key)
+	return ret
+}